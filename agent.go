@@ -0,0 +1,169 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+)
+
+// runAgent runs node agent collecting node-local prefixes and reporting them to the aggregator until ctx is done
+func runAgent(ctx context.Context, config *prefixcollector.Config) error {
+	aggregatorURL, err := url.Parse(config.AggregatorURL)
+	if err != nil {
+		return errors.Wrap(err, "Wrong aggregator URL")
+	}
+
+	var spiffeIDs []string
+	if config.AggregatorSpiffeID != "" {
+		spiffeIDs = append(spiffeIDs, config.AggregatorSpiffeID)
+	}
+	dialOptions, err := grpcDialOptions(config, config.AggregatorTLS, spiffeIDs...)
+	if err != nil {
+		return err
+	}
+	cc, err := grpc.DialContext(ctx, grpcutils.URLToTarget(aggregatorURL), append(aggregation.DialOptions(), dialOptions...)...)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to dial aggregator %s", config.AggregatorURL)
+	}
+	defer func() { _ = cc.Close() }()
+
+	logrus.Infof("Node %s agent reports to %s", config.NodeName, config.AggregatorURL)
+	ctx = prefixcollector.WithLifecycle(ctx, utils.NewLifecycle())
+	bus := utils.NewBatchingEventBus(config.EventBatchWindow)
+	sources := buildSources(ctx, nodeLocalEntries(sourceEntries(config)), bus)
+	agent := aggregation.NewAgent(aggregation.NewAggregatorClient(cc), config.NodeName, config.AgentReportInterval, sources...)
+	if config.BlackholeRoutes {
+		routes, err := prefixcollector.NewBlackholeRoutes(config.BlackholeRoutesOptions())
+		if err != nil {
+			return err
+		}
+		agent.OnPublished(func(_ context.Context, prefixes []string) {
+			if err := routes.Sync(prefixes); err != nil {
+				logrus.Errorf("Failed to sync node routes of the excluded prefixes: %v", err)
+			}
+		})
+		defer func() {
+			if err := routes.Flush(); err != nil {
+				logrus.Errorf("Failed to remove node routes of the excluded prefixes: %v", err)
+			}
+		}()
+	}
+	if config.NftablesSets {
+		sets, err := prefixcollector.NewNftablesSets(config.NftablesTable, config.NftablesSet)
+		if err != nil {
+			return err
+		}
+		agent.OnPublished(func(_ context.Context, prefixes []string) {
+			if err := sets.Sync(prefixes); err != nil {
+				logrus.Errorf("Failed to sync nftables sets of the excluded prefixes: %v", err)
+			}
+		})
+	}
+
+	prefixCollector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(agent.Write),
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithShutdownTimeout(config.ShutdownTimeout),
+		prefixcollector.WithSources(sources...),
+	)
+
+	go agent.Serve(ctx)
+	prefixCollector.Serve(ctx)
+	return nil
+}
+
+// serveCollectorAPI serves the collector gRPC API on the configured listen URL: aggregator of node agents
+// reports and federation of the prefixes collected by sources. API is served with TLS of apiTLSConfig if the API
+// certificate is configured. Returns sources with the aggregator added and
+// the aggregator, which should publish the collector prefixes to the agents.
+func serveCollectorAPI(ctx context.Context, config *prefixcollector.Config, notify *utils.EventBus,
+	sources []prefixcollector.PrefixSource) ([]prefixcollector.PrefixSource, *aggregation.Aggregator, error) {
+	listenURL, err := url.Parse(config.AggregatorListenURL)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Wrong aggregator listen URL")
+	}
+
+	serverOptions, err := grpcServerOptions(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	aggregator := aggregation.NewAggregator(ctx, notify, config.AgentReportTTL)
+	sources = append(sources, aggregator)
+
+	server := aggregation.NewServer(serverOptions...)
+	aggregation.RegisterAggregatorServer(server, aggregator)
+	if config.FeatureGates.Enabled(prefixcollector.FederationFeature) {
+		aggregation.RegisterFederationServer(server, aggregation.NewFederation(config.ClusterID, config.FederationMaxHops, sources...))
+	}
+
+	errCh := grpcutils.ListenAndServe(ctx, listenURL, server)
+	go func() {
+		for err := range errCh {
+			logrus.Errorf("Collector API server error: %v", err)
+		}
+	}()
+	logrus.Infof("Collector API listens on %s", config.AggregatorListenURL)
+	return sources, aggregator, nil
+}
+
+// federationSourceEntries returns sources of the prefixes pulled from remote collectors
+func federationSourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	if !featureEnabled(config, prefixcollector.FederationFeature, len(config.FederationPeers) > 0) {
+		return nil
+	}
+	peers, err := config.FederationPeerURLs()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	dialOptions, err := grpcDialOptions(config, config.FederationTLS)
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+
+	entries := make([]*sourceEntry, 0, len(peers))
+	for cluster, peerURL := range peers {
+		cluster, peerURL := cluster, peerURL
+		entries = append(entries, &sourceEntry{
+			name: aggregation.FederationSourcePrefix + cluster,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewFederationPrefixSource(ctx, notify, &prefixsource.FederationOptions{
+					Cluster:         config.ClusterID,
+					RemoteCluster:   cluster,
+					URL:             peerURL,
+					RefreshInterval: config.FederationRefreshInterval,
+					DialOptions:     dialOptions,
+				})
+			},
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
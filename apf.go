@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// apfPriorityLevelHeader and apfFlowSchemaHeader are set by API priority and fairness to UIDs of the priority
+	// level and flow schema the request is classified to
+	apfPriorityLevelHeader = "X-Kubernetes-PF-PriorityLevel-UID"
+	apfFlowSchemaHeader    = "X-Kubernetes-PF-FlowSchema-UID"
+	apfRetryBaseBackoff    = 500 * time.Millisecond
+	apfRetryMaxBackoff     = 30 * time.Second
+)
+
+// apfRetryTransport retries requests rejected by API priority and fairness of Kubernetes API server
+// with exponential backoff, which is never shorter than Retry-After the server asks for
+type apfRetryTransport struct {
+	next    http.RoundTripper
+	retries int
+}
+
+// apfRetryWrapper returns transport wrapper retrying requests rejected by API priority and fairness retries times
+func apfRetryWrapper(retries int) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &apfRetryTransport{next: next, retries: retries}
+	}
+}
+
+// RoundTrip sends request retrying it while APF rejects it, requests with body which can't be replayed aren't retried
+func (t *apfRetryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := t.next.RoundTrip(request)
+		if err != nil || !rejectedByAPF(response) || attempt >= t.retries ||
+			(request.Body != nil && request.GetBody == nil) {
+			return response, err
+		}
+
+		backoff := apfBackoff(attempt, response)
+		logrus.Warnf("Kubernetes API request %s %s is rejected by priority level %s of flow schema %s, retry %d/%d in %v",
+			request.Method, request.URL.Path, response.Header.Get(apfPriorityLevelHeader),
+			response.Header.Get(apfFlowSchemaHeader), attempt+1, t.retries, backoff)
+		_ = response.Body.Close()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+		if request, err = replayRequest(request); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rejectedByAPF returns true if the request of response is rejected by API priority and fairness
+func rejectedByAPF(response *http.Response) bool {
+	return response.StatusCode == http.StatusTooManyRequests && response.Header.Get(apfPriorityLevelHeader) != ""
+}
+
+// apfBackoff returns exponential backoff of the retry attempt, which isn't shorter than Retry-After of response
+func apfBackoff(attempt int, response *http.Response) time.Duration {
+	backoff := apfRetryMaxBackoff
+	if attempt < 16 {
+		backoff = apfRetryBaseBackoff << uint(attempt)
+	}
+	if backoff > apfRetryMaxBackoff {
+		backoff = apfRetryMaxBackoff
+	}
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		if retryAfter := time.Duration(seconds) * time.Second; retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+	return backoff
+}
+
+// replayRequest returns copy of request with a fresh body
+func replayRequest(request *http.Request) (*http.Request, error) {
+	replay := request.Clone(request.Context())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		replay.Body = body
+	}
+	return replay, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// requestTimeoutTransport limits time of Kubernetes API requests until their response body is closed.
+// Watches aren't limited, they are ended by API server after their own timeout and resumed by the sources.
+type requestTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// requestTimeoutWrapper returns transport wrapper limiting Kubernetes API requests except watches to timeout
+func requestTimeoutWrapper(timeout time.Duration) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &requestTimeoutTransport{next: next, timeout: timeout}
+	}
+}
+
+// RoundTrip sends request with the timeout, which is canceled when the response body is closed
+func (t *requestTimeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if isWatchRequest(request) {
+		return t.next.RoundTrip(request)
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), t.timeout)
+	response, err := t.next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelOnCloseBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// isWatchRequest returns true if request watches Kubernetes API resources
+func isWatchRequest(request *http.Request) bool {
+	watch := request.URL.Query().Get("watch")
+	return watch == "true" || watch == "1"
+}
+
+// cancelOnCloseBody is response body canceling the request context when it is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// apiDialer returns dial func of Kubernetes API connections with the dial timeout and TCP keep-alive interval,
+// so dead connections over flaky links are detected and redialed instead of hanging requests and watches
+func apiDialer(timeout, keepAlive time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: keepAlive}
+	return dialer.DialContext
+}
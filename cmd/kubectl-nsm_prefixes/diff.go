@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// prefixesDiff is difference between excluded prefixes published to NSM config map and the live cluster state
+type prefixesDiff struct {
+	// Missing are prefixes of the cluster state, which aren't covered by the published ones
+	Missing []prefixcollector.PrefixEntry `json:"missing,omitempty"`
+	// Unmatched are published prefixes, which aren't covered by the cluster state. Prefixes of other sources than
+	// the cluster state are expected here, prefixes attributed only to the cluster state sources are stale.
+	Unmatched []prefixcollector.PrefixEntry `json:"unmatched,omitempty"`
+}
+
+// diff compares published prefixes with prefixes of kubeadm and kubernetes sources run against the cluster
+func diff(ctx context.Context, clientSet kubernetes.Interface, namespace string, opts *options) error {
+	document, err := prefixcollector.ReadOutput(ctx, clientSet.CoreV1().ConfigMaps(namespace), opts.name)
+	if err != nil {
+		return err
+	}
+
+	live, err := clusterPrefixes(ctx, clientSet, opts)
+	if err != nil {
+		return err
+	}
+
+	published := make([]string, 0, len(document.Prefixes))
+	for _, entry := range document.Prefixes {
+		published = append(published, entry.Prefix)
+	}
+	result := &prefixesDiff{}
+	for _, entry := range live {
+		if !utils.CoveredBy(entry.Prefix, published) {
+			result.Missing = append(result.Missing, entry)
+		}
+	}
+	livePrefixes := make([]string, 0, len(live))
+	for _, entry := range live {
+		livePrefixes = append(livePrefixes, entry.Prefix)
+	}
+	for _, entry := range document.Prefixes {
+		if !utils.CoveredBy(entry.Prefix, livePrefixes) {
+			result.Unmatched = append(result.Unmatched, entry)
+		}
+	}
+
+	if opts.format == jsonFormat {
+		err = printJSON(result)
+	} else {
+		err = printDiff(result)
+	}
+	if err == nil && len(result.Missing) > 0 {
+		err = errors.Errorf("%d prefixes of the cluster state are missing from the output", len(result.Missing))
+	}
+	return err
+}
+
+// clusterPrefixes runs kubeadm and kubernetes sources until they settle and returns their attributed prefixes
+func clusterPrefixes(ctx context.Context, clientSet kubernetes.Interface, opts *options) ([]prefixcollector.PrefixEntry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, clientSet)
+	ctx = prefixcollector.WithResourceVersions(ctx, utils.NewResourceVersions(nil))
+
+	bus := utils.NewEventBus()
+	sources := []prefixcollector.NamedPrefixSource{
+		prefixsource.NewKubeAdmPrefixSource(ctx, bus),
+		prefixsource.NewKubernetesPrefixSource(ctx, bus),
+	}
+	if err := utils.WaitSettled(ctx, bus.Events(), opts.settle); err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	sourcePrefixes := make(map[string][]string, len(sources))
+	for _, source := range sources {
+		sourcePrefixes[source.Name()] = source.Prefixes()
+		prefixes = append(prefixes, source.Prefixes()...)
+	}
+	prefixes, err := utils.AggregatePrefixes(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	return prefixcollector.PrefixEntries(prefixes, sourcePrefixes)
+}
+
+// printDiff prints missing prefixes with "-" and unmatched ones with "+" like a diff of the output to the cluster state
+func printDiff(result *prefixesDiff) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, entry := range result.Missing {
+		_, _ = fmt.Fprintf(tw, "-\t%s\t%s\tmissing from the output\n", entry.Prefix, strings.Join(entry.Sources, ","))
+	}
+	for _, entry := range result.Unmatched {
+		sources := strings.Join(entry.Sources, ",")
+		note := "not in the cluster state"
+		if sources == "" {
+			sources = "<unknown>"
+		} else if onlyClusterSources(entry.Sources) {
+			note = "stale"
+		}
+		_, _ = fmt.Fprintf(tw, "+\t%s\t%s\t%s\n", entry.Prefix, sources, note)
+	}
+	if len(result.Missing) == 0 && len(result.Unmatched) == 0 {
+		_, _ = fmt.Fprintln(tw, "Output matches the cluster state")
+	}
+	return tw.Flush()
+}
+
+// onlyClusterSources returns true if sources are the ones diff reads the cluster state with
+func onlyClusterSources(sources []string) bool {
+	for _, source := range sources {
+		if source != "kubeadm" && source != "kubernetes" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main contains kubectl plugin showing excluded prefixes published by the collector: kubectl nsm-prefixes
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	showCommand          = "show"
+	diffCommand          = "diff"
+	resyncCommand        = "resync"
+	reserveCommand       = "reserve"
+	releaseCommand       = "release"
+	defaultConfigMapName = "nsm-config"
+	defaultSettleTime    = 3 * time.Second
+	defaultTimeout       = time.Minute
+	textFormat           = "text"
+	jsonFormat           = "json"
+	rpslFormat           = "rpsl"
+	usage                = `Usage: kubectl nsm-prefixes [show|diff|resync|reserve|release] [flags] [prefix]
+
+  show     print excluded prefixes published to the NSM config map with their sources, or as RPSL route objects
+  diff     compare published prefixes with prefixes of the live cluster state
+  resync   request the collector to recollect all the sources and rewrite the output
+  reserve  reserve prefix in the reservations config map, so it is excluded until released or its lease expires
+  release  release prefix reservation
+`
+)
+
+// options is flags shared by the plugin commands
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	name       string
+	format     string
+	settle     time.Duration
+	timeout    time.Duration
+	// reservations is name of the reservations config map
+	reservations string
+	lease        time.Duration
+	reason       string
+	prefix       string
+	// origin, maintainer and source are attributes of RPSL route objects
+	origin     string
+	maintainer string
+	source     string
+}
+
+func main() {
+	logrus.SetLevel(logrus.WarnLevel)
+	if err := run(os.Args[1:]); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the plugin command of args, show is the default one
+func run(args []string) error {
+	command := showCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("kubectl nsm-prefixes "+command, flag.ContinueOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	opts := &options{}
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path of kubeconfig, KUBECONFIG or ~/.kube/config is used if empty")
+	flags.StringVar(&opts.context, "context", "", "Name of kubeconfig context, the current context is used if empty")
+	flags.StringVar(&opts.namespace, "n", "", "Namespace of NSM and reservations config maps, namespace of the context is used if empty")
+	flags.StringVar(&opts.name, "name", defaultConfigMapName, "Name of NSM config map")
+	flags.StringVar(&opts.format, "o", textFormat, "Output format of show and diff: text or json, or rpsl route objects of show")
+	flags.DurationVar(&opts.settle, "settle", defaultSettleTime, "Time cluster state should stay unchanged to be compared by diff")
+	flags.DurationVar(&opts.timeout, "timeout", defaultTimeout, "Maximum time of the command")
+	flags.StringVar(&opts.reservations, "reservations", prefixcollector.DefaultReservationsConfigMapName, "Name of reservations config map")
+	flags.DurationVar(&opts.lease, "lease", 0, "Lease of reserve, the reservation doesn't expire if 0")
+	flags.StringVar(&opts.reason, "reason", "", "Reason of reserve recorded with the reservation")
+	flags.StringVar(&opts.origin, "origin", prefixcollector.DefaultRPSLOrigin, "Origin AS of RPSL route objects")
+	flags.StringVar(&opts.maintainer, "mnt-by", "", "Maintainer of RPSL route objects, omitted if empty")
+	flags.StringVar(&opts.source, "source", prefixcollector.DefaultRPSLSource, "Registry source of RPSL route objects")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case opts.format == rpslFormat && command != showCommand:
+		return errors.Errorf("Output format %q is supported only by show", opts.format)
+	case opts.format != textFormat && opts.format != jsonFormat && opts.format != rpslFormat:
+		return errors.Errorf("Unknown output format %q", opts.format)
+	}
+	opts.prefix = flags.Arg(0)
+
+	clientSet, namespace, err := opts.clientSet()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	switch command {
+	case showCommand:
+		return show(ctx, clientSet, namespace, opts)
+	case diffCommand:
+		return diff(ctx, clientSet, namespace, opts)
+	case resyncCommand:
+		return resync(ctx, clientSet, namespace, opts)
+	case reserveCommand:
+		return reserve(ctx, clientSet, namespace, opts)
+	case releaseCommand:
+		return release(ctx, clientSet, namespace, opts)
+	default:
+		flags.Usage()
+		return errors.Errorf("Unknown command: %s", command)
+	}
+}
+
+// clientConfig returns client config of the kubeconfig context
+func (o *options) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.context})
+}
+
+// clientSet returns Kubernetes clientSet of the kubeconfig context and namespace of NSM config map
+func (o *options) clientSet() (kubernetes.Interface, string, error) {
+	clientConfig := o.clientConfig()
+
+	namespace := o.namespace
+	if namespace == "" {
+		var err error
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, "", errors.Wrap(err, "Failed to get namespace of kubeconfig context")
+		}
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to build Kubernetes client config")
+	}
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to build Kubernetes clientSet")
+	}
+	return clientSet, namespace, nil
+}
+
+// show prints excluded prefixes published to NSM config map with their sources
+func show(ctx context.Context, clientSet kubernetes.Interface, namespace string, opts *options) error {
+	document, err := prefixcollector.ReadOutput(ctx, clientSet.CoreV1().ConfigMaps(namespace), opts.name)
+	if err != nil {
+		return err
+	}
+	switch opts.format {
+	case jsonFormat:
+		return printJSON(document)
+	case rpslFormat:
+		_, err = fmt.Fprint(os.Stdout, prefixcollector.RPSLRouteObjects(document, &prefixcollector.RPSLOptions{
+			Origin:     opts.origin,
+			Maintainer: opts.maintainer,
+			Source:     opts.source,
+		}))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PREFIX\tFAMILY\tSOURCES")
+	for _, entry := range document.Prefixes {
+		sources := strings.Join(entry.Sources, ",")
+		if sources == "" {
+			sources = "<unknown>"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Prefix, entry.Family, sources)
+	}
+	return tw.Flush()
+}
+
+// resync sets resync annotation of NSM config map to the current time
+func resync(ctx context.Context, clientSet kubernetes.Interface, namespace string, opts *options) error {
+	configMaps := clientSet.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, opts.name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get NSM ConfigMap '%s/%s'", namespace, opts.name)
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	requested := time.Now().UTC().Format(time.RFC3339Nano)
+	configMap.Annotations[prefixcollector.ResyncAnnotation] = requested
+	if _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "Failed to update NSM ConfigMap '%s/%s'", namespace, opts.name)
+	}
+	_, err = fmt.Fprintf(os.Stdout, "Resync of configmap/%s in namespace %s requested at %s\n", opts.name, namespace, requested)
+	return err
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reserve stores reservation of the prefix to the reservations config map recorded with user of the kubeconfig context
+func reserve(ctx context.Context, clientSet kubernetes.Interface, namespace string, opts *options) error {
+	if opts.prefix == "" {
+		return errors.New("Reserved prefix should be set")
+	}
+	if opts.lease < 0 {
+		return errors.New("Lease should not be negative")
+	}
+	requester, err := opts.requester()
+	if err != nil {
+		return err
+	}
+
+	reservation := &prefixcollector.Reservation{
+		Prefix:    opts.prefix,
+		Requester: requester,
+		Reason:    opts.reason,
+		Created:   time.Now().UTC(),
+	}
+	if opts.lease > 0 {
+		reservation.Expires = reservation.Created.Add(opts.lease)
+	}
+	if err := prefixcollector.Reserve(ctx, clientSet.CoreV1().ConfigMaps(namespace), opts.reservations, reservation); err != nil {
+		return err
+	}
+
+	expires := "never"
+	if !reservation.Expires.IsZero() {
+		expires = reservation.Expires.Format(time.RFC3339)
+	}
+	_, err = fmt.Fprintf(os.Stdout, "Prefix %s reserved by %s in configmap/%s in namespace %s, expires %s\n",
+		reservation.Prefix, requester, opts.reservations, namespace, expires)
+	return err
+}
+
+// release removes reservation of the prefix from the reservations config map
+func release(ctx context.Context, clientSet kubernetes.Interface, namespace string, opts *options) error {
+	if opts.prefix == "" {
+		return errors.New("Released prefix should be set")
+	}
+	if err := prefixcollector.Release(ctx, clientSet.CoreV1().ConfigMaps(namespace), opts.reservations, opts.prefix); err != nil {
+		return errors.Wrapf(err, "Failed to release %s", opts.prefix)
+	}
+	_, err := fmt.Fprintf(os.Stdout, "Prefix %s released in configmap/%s in namespace %s\n", opts.prefix, opts.reservations, namespace)
+	return err
+}
+
+// requester returns user name of the kubeconfig context reservations are recorded with
+func (o *options) requester() (string, error) {
+	rawConfig, err := o.clientConfig().RawConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to load kubeconfig")
+	}
+	contextName := o.context
+	if contextName == "" {
+		contextName = rawConfig.CurrentContext
+	}
+	kubeContext, ok := rawConfig.Contexts[contextName]
+	if !ok || kubeContext.AuthInfo == "" {
+		return "", errors.Errorf("User of kubeconfig context %q is unknown", contextName)
+	}
+	return kubeContext.AuthInfo, nil
+}
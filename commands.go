@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/rbac"
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rbacCommand     = "rbac"
+	validateCommand = "validate"
+	crdCommand      = "crd"
+	schemaCommand   = "schema"
+	defaultRoleName = "exclude-prefixes-k8s"
+)
+
+// accessReviewRule is access required to probe the ServiceAccount permissions
+var accessReviewRule = rbac.Rule{
+	APIGroup: "authorization.k8s.io",
+	Resource: "selfsubjectaccessreviews",
+	Verbs:    []string{"create"},
+}
+
+// runCommand runs subcommand name with args
+func runCommand(name string, args []string) error {
+	switch name {
+	case rbacCommand:
+		return runRBAC(args)
+	case validateCommand:
+		return runValidate(args)
+	case simulateCommand:
+		return runSimulate(args)
+	case devCommand, "--" + devCommand:
+		return runDev(args)
+	case crdCommand:
+		_, err := os.Stdout.WriteString(prefixcollector.StatusCustomResourceDefinition)
+		return err
+	case schemaCommand:
+		data, err := prefixcollector.ConfigJSONSchema(envPrefix)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return errors.Errorf("Unknown command: %s", name)
+	}
+}
+
+// runRBAC prints minimal Role/ClusterRole YAML for the configured sources and output
+func runRBAC(args []string) error {
+	flags := flag.NewFlagSet(rbacCommand, flag.ContinueOnError)
+	roleName := flags.String("name", defaultRoleName, "Name of the generated roles")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := &prefixcollector.Config{}
+	if err := loadConfig(config); err != nil {
+		return err
+	}
+
+	var rules []rbac.Rule
+	for _, entry := range sourceEntries(config) {
+		rules = append(rules, entry.rules...)
+	}
+	if config.UsesNSMNamespace() {
+		outputNamespace, err := nsmConfigMapNamespace(config)
+		if err != nil {
+			return errors.Wrap(err, "Set NSM config map namespace to generate output roles")
+		}
+		rules = append(rules, outputRules(config, outputNamespace)...)
+	}
+	rules = append(rules, reservationsAPIRules(config)...)
+	if config.ProbeAccess {
+		rules = append(rules, accessReviewRule)
+	}
+
+	data, err := rbac.Render(*roleName, rules...)
+	if err != nil {
+		return errors.Wrap(err, "Failed to render roles")
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
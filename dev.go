@@ -0,0 +1,185 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	devCommand          = "dev"
+	devNamespace        = "default"
+	fixtureDecodeBuffer = 4096
+)
+
+// devFixtures are Kubernetes objects the fake cluster of dev mode is seeded with. Objects of the built-in kinds
+// are served by both typed and dynamic clients, the other ones are served by dynamic client only.
+type devFixtures struct {
+	typed   []runtime.Object
+	dynamic []runtime.Object
+}
+
+// runDev runs the collector against in-memory fake cluster seeded with fixtures until interrupted,
+// so sources can be run and iterated on locally without a cluster
+func runDev(args []string) error {
+	flags := flag.NewFlagSet(devCommand, flag.ContinueOnError)
+	fixturesDir := flags.String("fixtures", "", "Directory of YAML or JSON manifests of the Kubernetes objects the fake cluster is seeded with")
+	envFile := flags.String("env-file", "", "File with KEY=VALUE environment configuration, process environment is used if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *envFile != "" {
+		if err := setEnvFromFile(*envFile); err != nil {
+			return err
+		}
+	}
+	config := &prefixcollector.Config{}
+	if err := loadConfig(config); err != nil {
+		return err
+	}
+	// fake cluster grants no permissions to review, so all the sources are run
+	config.ProbeAccess = false
+	if config.PodNamespace == "" {
+		config.PodNamespace = devNamespace
+	}
+
+	fixtures := &devFixtures{}
+	if *fixturesDir != "" {
+		if err := fixtures.load(*fixturesDir); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ctx, clientSet := fixtures.withClients(ctx)
+	if err := ensureDevOutput(ctx, config, clientSet); err != nil {
+		return err
+	}
+
+	logrus.Infof("Running in dev mode against fake cluster of %d objects", len(fixtures.dynamic))
+	ctx, prefixCollector, err := newCollector(ctx, config, clientSet)
+	if err != nil {
+		return err
+	}
+	prefixCollector.Serve(ctx)
+	return nil
+}
+
+// load loads fixtures of all the YAML and JSON files of dir and its subdirectories
+func (f *devFixtures) load(dir string) error {
+	return filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".yaml", ".yml", ".json":
+			return errors.Wrapf(f.loadFile(filePath), "Failed to load fixtures of %s", filePath)
+		default:
+			return nil
+		}
+	})
+}
+
+// loadFile loads fixtures of the file documents
+func (f *devFixtures) loadFile(filePath string) error {
+	file, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	decoder := yaml.NewYAMLOrJSONDecoder(file, fixtureDecodeBuffer)
+	for {
+		object := &unstructured.Unstructured{}
+		if err = decoder.Decode(&object.Object); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(object.Object) == 0 {
+			continue
+		}
+		if object.GetKind() == "" || object.GetName() == "" {
+			return errors.New("Fixture should have kind and name")
+		}
+		if err = f.add(object); err != nil {
+			return err
+		}
+	}
+}
+
+// add adds fixture object, objects of the built-in kinds are converted to the typed ones
+func (f *devFixtures) add(object *unstructured.Unstructured) error {
+	f.dynamic = append(f.dynamic, object)
+	if typed, err := scheme.Scheme.New(object.GroupVersionKind()); err == nil {
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+			return errors.Wrapf(err, "Invalid %s %s", object.GetKind(), object.GetName())
+		}
+		f.typed = append(f.typed, typed)
+	}
+	return nil
+}
+
+// withClients puts fake Kubernetes clients serving the fixtures to context
+func (f *devFixtures) withClients(ctx context.Context) (context.Context, kubernetes.Interface) {
+	clientSet := fake.NewSimpleClientset(f.typed...)
+	ctx = prefixcollector.WithKubernetesInterface(ctx, clientSet)
+	ctx = prefixcollector.WithDynamicInterface(ctx, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), f.dynamic...))
+	return ctx, clientSet
+}
+
+// ensureDevOutput creates the output config map in the fake cluster if it isn't seeded with it
+func ensureDevOutput(ctx context.Context, config *prefixcollector.Config, clientSet kubernetes.Interface) error {
+	if config.PrefixesOutputType != prefixcollector.ConfigMapOutputType {
+		return nil
+	}
+	namespace, err := nsmConfigMapNamespace(config)
+	if err != nil {
+		return err
+	}
+	configMaps := clientSet.CoreV1().ConfigMaps(namespace)
+	_, err = configMaps.Create(ctx, &apiV1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.NSMConfigMapName, Namespace: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "Failed to create NSM ConfigMap in fake cluster")
+	}
+	return nil
+}
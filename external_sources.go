@@ -0,0 +1,306 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/rbac"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// externalSourceEntries returns configured prefix sources of systems and networks outside of the cluster.
+// HTTP sources share client using the configured proxy, CA bundle and client certificate.
+func externalSourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	var entries []*sourceEntry
+	client, err := externalHTTPClient(config)
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	if config.NetboxURL != "" {
+		entries = append(entries, &sourceEntry{
+			name: "netbox",
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewNetboxPrefixSource(ctx, notify, &prefixsource.NetboxOptions{
+					URL:             config.NetboxURL,
+					TokenPath:       config.NetboxTokenPath,
+					Tags:            config.NetboxTags,
+					Sites:           config.NetboxSites,
+					RefreshInterval: config.NetboxRefreshInterval,
+					Client:          client,
+				})
+			},
+		})
+	}
+	if config.InfobloxURL != "" {
+		entries = append(entries, &sourceEntry{
+			name: "infoblox",
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewInfobloxPrefixSource(ctx, notify, &prefixsource.InfobloxOptions{
+					URL:                  config.InfobloxURL,
+					Username:             config.InfobloxUsername,
+					PasswordPath:         config.InfobloxPasswordPath,
+					NetworkView:          config.InfobloxNetworkView,
+					ExtensibleAttributes: config.InfobloxExtensibleAttributes,
+					RefreshInterval:      config.InfobloxRefreshInterval,
+					Client:               client,
+				})
+			},
+		})
+	}
+	if len(config.RestURLTemplates) > 0 {
+		entries = append(entries, &sourceEntry{
+			name: "rest",
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewRestPrefixSource(ctx, notify, &prefixsource.RestOptions{
+					URLTemplates:    config.RestURLTemplates,
+					Params:          config.RestParams,
+					PrefixPath:      config.RestPrefixPath,
+					AuthHeader:      config.RestAuthHeader,
+					AuthValuePath:   config.RestAuthValuePath,
+					RefreshInterval: config.RestRefreshInterval,
+					Client:          client,
+				})
+			},
+		})
+	}
+	if config.KeaURL != "" || config.DhcpdConfPath != "" {
+		entries = append(entries, &sourceEntry{
+			name: "dhcp",
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewDHCPPrefixSource(ctx, notify, &prefixsource.DHCPOptions{
+					KeaURL:          config.KeaURL,
+					KeaServices:     config.KeaServices,
+					KeaUsername:     config.KeaUsername,
+					KeaPasswordPath: config.KeaPasswordPath,
+					ConfPath:        config.DhcpdConfPath,
+					RefreshInterval: config.DHCPRefreshInterval,
+					Client:          client,
+				})
+			},
+		})
+	}
+	entries = append(entries, registrySourceEntries(config)...)
+	if config.OpenstackNeutronURL != "" || config.KuryrConfigSource {
+		entries = append(entries, openstackEntry(config, client))
+	}
+	if len(config.AwsRegions) > 0 || len(config.GcpProjects) > 0 || len(config.AzureSubscriptions) > 0 {
+		entries = append(entries, cloudTagsEntry(config, client))
+	}
+	return entries
+}
+
+// hostSourceEntries returns configured node-local prefix sources of the node network and its neighbours
+func hostSourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	var entries []*sourceEntry
+	if config.RouterAdvertisementSource {
+		entries = append(entries, &sourceEntry{
+			name:      "router-advertisement",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewRouterAdvertisementPrefixSource(ctx, notify)
+			},
+		})
+	}
+	if config.HostRoutesSource {
+		entries = append(entries, &sourceEntry{
+			name:      "host-routes",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewHostRoutesPrefixSource(ctx, notify, &prefixsource.HostRoutesOptions{
+					Protocols:         config.HostRoutesProtocols,
+					Tables:            config.HostRoutesTables,
+					ExcludeInterfaces: config.HostRoutesExcludeInterfaces,
+					RefreshInterval:   config.HostRoutesRefreshInterval,
+				})
+			},
+		})
+	}
+	if config.OverlaySource {
+		entries = append(entries, &sourceEntry{
+			name:      "overlay-interfaces",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewOverlayPrefixSource(ctx, notify, &prefixsource.OverlayOptions{
+					TailscaleInterfaces: config.OverlayTailscaleInterfaces,
+					WireGuardInterfaces: config.OverlayWireguardInterfaces,
+					RefreshInterval:     config.OverlayRefreshInterval,
+				})
+			},
+		})
+	}
+	if config.RuntimeNetworksSource {
+		entries = append(entries, &sourceEntry{
+			name:      "container-runtime",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewContainerRuntimePrefixSource(ctx, notify, &prefixsource.ContainerRuntimeOptions{
+					Interfaces:        config.RuntimeInterfaces,
+					DockerConfigPath:  config.RuntimeDockerConfig,
+					PodmanNetworksDir: config.RuntimePodmanNetworksDir,
+					CNIConfigs:        config.RuntimeCniConfigs,
+					RefreshInterval:   config.RuntimeRefreshInterval,
+				})
+			},
+		})
+	}
+	if config.HnsSource {
+		entries = append(entries, &sourceEntry{
+			name:      "hns-networks",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewHNSPrefixSource(ctx, notify, &prefixsource.HNSOptions{
+					Networks:        config.HnsNetworks,
+					RefreshInterval: config.HnsRefreshInterval,
+				})
+			},
+		})
+	}
+	if config.CloudNetworkProvider != "" {
+		entries = append(entries, &sourceEntry{
+			name:      "cloud-network",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewCloudNetworkPrefixSource(ctx, notify, &prefixsource.CloudNetworkOptions{
+					Provider:        config.CloudNetworkProvider,
+					MetadataURL:     config.CloudNetworkMetadataURL,
+					RefreshInterval: config.CloudNetworkRefreshInterval,
+				})
+			},
+		})
+	}
+	if len(config.NetworkdConfigDirs) > 0 || len(config.NetworkManagerConnectionDirs) > 0 {
+		entries = append(entries, &sourceEntry{
+			name:      "host-network-config",
+			nodeLocal: true,
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewHostNetworkConfigPrefixSource(ctx, notify, &prefixsource.HostNetworkConfigOptions{
+					NetworkdDirs:       config.NetworkdConfigDirs,
+					NetworkManagerDirs: config.NetworkManagerConnectionDirs,
+					RefreshInterval:    config.HostNetworkRefreshInterval,
+				})
+			},
+		})
+	}
+	return entries
+}
+
+// registrySourceEntries returns source of IP context prefixes of the NSEs registered in NSM registry if it is set
+func registrySourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	if config.RegistryURL == "" {
+		return nil
+	}
+	registryURL, err := url.Parse(config.RegistryURL)
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	dialOptions, err := grpcDialOptions(config, config.RegistryTLS)
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	return []*sourceEntry{{
+		name: "nsm-registry",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewRegistryPrefixSource(ctx, notify, &prefixsource.RegistryOptions{
+				URL:             registryURL,
+				CIDRsLabel:      config.RegistryCIDRsLabel,
+				NetworkService:  config.RegistryNetworkService,
+				RefreshInterval: config.RegistryRefreshInterval,
+				DialOptions:     dialOptions,
+			})
+		},
+	}}
+}
+
+// openstackEntry returns OpenStack source of the Neutron subnets of the provider networks and kuryr.conf
+func openstackEntry(config *prefixcollector.Config, client *http.Client) *sourceEntry {
+	options := &prefixsource.OpenstackOptions{
+		NeutronURL:       config.OpenstackNeutronURL,
+		AuthURL:          config.OpenstackAuthURL,
+		CredentialID:     config.OpenstackCredentialID,
+		CredentialPath:   config.OpenstackCredentialPath,
+		TokenPath:        config.OpenstackTokenPath,
+		ProviderNetworks: config.OpenstackProviderNetworks,
+		RefreshInterval:  config.OpenstackRefreshInterval,
+		Client:           client,
+	}
+	entry := &sourceEntry{
+		name: "openstack",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewOpenstackPrefixSource(ctx, notify, options)
+		},
+	}
+	if config.KuryrConfigSource {
+		options.KuryrConfigMapName = config.KuryrConfigMapName
+		options.KuryrConfigMapNamespace = config.KuryrConfigMapNamespace
+		entry.rules = []rbac.Rule{
+			{Namespace: config.KuryrConfigMapNamespace, Resource: "configmaps", Verbs: []string{"get"}},
+		}
+	}
+	return entry
+}
+
+// cloudTagsEntry returns source of the tagged subnets of the configured cloud providers
+func cloudTagsEntry(config *prefixcollector.Config, client *http.Client) *sourceEntry {
+	options := &prefixsource.CloudTagsOptions{
+		TagKey:          config.CloudTagsKey,
+		TagValue:        config.CloudTagsValue,
+		RefreshInterval: config.CloudTagsRefreshInterval,
+		Client:          client,
+	}
+	if len(config.AwsRegions) > 0 {
+		options.AWS = &prefixsource.AWSSubnetsOptions{
+			Regions:       config.AwsRegions,
+			EndpointURL:   config.AwsEndpointURL,
+			AccessKeyID:   config.AwsAccessKeyID,
+			SecretKeyPath: config.AwsSecretKeyPath,
+		}
+	}
+	if len(config.GcpProjects) > 0 {
+		options.GCP = &prefixsource.GCPSubnetsOptions{
+			Projects:         config.GcpProjects,
+			ComputeURL:       config.GcpComputeURL,
+			TokenPath:        config.GcpTokenPath,
+			MetadataTokenURL: prefixsource.DefaultGCPMetadataTokenURL,
+		}
+	}
+	if len(config.AzureSubscriptions) > 0 {
+		options.Azure = &prefixsource.AzureSubnetsOptions{
+			Subscriptions:    config.AzureSubscriptions,
+			ManagementURL:    config.AzureManagementURL,
+			LoginURL:         config.AzureLoginURL,
+			TenantID:         config.AzureTenantID,
+			ClientID:         config.AzureClientID,
+			ClientSecretPath: config.AzureClientSecretPath,
+			TokenPath:        config.AzureTokenPath,
+		}
+	}
+	return &sourceEntry{
+		name: "cloud-tags",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewCloudTagsPrefixSource(ctx, notify, options)
+		},
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// externalTLSConfig returns TLS config of the external sources: configured CA bundle is trusted in addition to
+// the system CAs and client certificate is presented if it is set. Returns nil if none of them is configured.
+func externalTLSConfig(config *prefixcollector.Config) (*tls.Config, error) {
+	return utils.ClientTLSConfig(config.ExternalCAPath, config.ExternalClientCertPath, config.ExternalClientKeyPath)
+}
+
+// externalHTTPClient returns HTTP client of the external sources using the configured proxy,
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used if it isn't set
+func externalHTTPClient(config *prefixcollector.Config) (*http.Client, error) {
+	tlsConfig, err := externalTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ExternalProxyURL != "" {
+		proxyURL, err := url.Parse(config.ExternalProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "Wrong external proxy URL")
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// grpcDialOptions returns options of connections to remote collectors, NSM registry and the aggregator: TLS with
+// the external sources CA bundle and client certificate if useTLS is set, insecure connections otherwise.
+// Server certificate should have one of spiffeIDs instead of the host name if they are set.
+// Connections use HTTPS_PROXY and NO_PROXY environment variables.
+func grpcDialOptions(config *prefixcollector.Config, useTLS bool, spiffeIDs ...string) ([]grpc.DialOption, error) {
+	if !useTLS {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+	tlsConfig, err := externalTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if len(spiffeIDs) > 0 {
+		utils.AuthorizeSpiffeIDs(tlsConfig, spiffeIDs)
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}, nil
+}
+
+// apiTLSConfig returns TLS config of the collector gRPC and HTTP APIs: the API certificate is presented, client
+// certificates are verified with the API client CA bundle and should have one of the API SPIFFE IDs if they are set.
+// Returns nil if the certificate isn't set, so the APIs are served insecure.
+func apiTLSConfig(config *prefixcollector.Config) (*tls.Config, error) {
+	tlsConfig, err := utils.ServerTLSConfig(config.APICertPath, config.APIKeyPath, config.APIClientCAPath)
+	if err != nil || tlsConfig == nil {
+		return nil, err
+	}
+	if len(config.APISpiffeIDs) > 0 {
+		utils.AuthorizeSpiffeIDs(tlsConfig, config.APISpiffeIDs)
+	}
+	return tlsConfig, nil
+}
+
+// grpcServerOptions returns options of the collector API server: TLS of apiTLSConfig, no options if the API
+// certificate isn't set
+func grpcServerOptions(config *prefixcollector.Config) ([]grpc.ServerOption, error) {
+	tlsConfig, err := apiTLSConfig(config)
+	if err != nil || tlsConfig == nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}, nil
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+
+	"github.com/sirupsen/logrus"
+)
+
+// featureEnabled returns true if feature is enabled by the config feature gates. Settings of the disabled
+// feature are ignored, so they are reported if configured.
+func featureEnabled(config *prefixcollector.Config, feature string, configured bool) bool {
+	if config.FeatureGates.Enabled(feature) {
+		return true
+	}
+	if configured {
+		logrus.Warnf("%s feature is disabled by feature gates, its settings are ignored", feature)
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Agent reports node-local excluded prefixes to the aggregator. The last prefixes are reported again every
+// interval, so the aggregator keeps them while the agent is alive. Health of the node-local health reporting
+// sources is reported along with the prefixes.
+type Agent struct {
+	client   AggregatorClient
+	node     string
+	interval time.Duration
+	sources  []prefixcollector.PrefixSource
+	mutex    sync.Mutex
+	prefixes []string
+	// published handle the collector prefixes returned by the aggregator when their hash changes
+	published      []func(ctx context.Context, prefixes []string)
+	publishedMutex sync.Mutex
+	publishedHash  string
+}
+
+// NewAgent creates Agent of the node reporting health of the sources
+func NewAgent(client AggregatorClient, node string, interval time.Duration, sources ...prefixcollector.PrefixSource) *Agent {
+	return &Agent{
+		client:   client,
+		node:     node,
+		interval: interval,
+		sources:  sources,
+	}
+}
+
+// OnPublished adds handler of the prefixes published by the collector, it is called by the reports when the
+// aggregator returns changed prefixes. Handlers should be added before the agent is served.
+func (a *Agent) OnPublished(handler func(ctx context.Context, prefixes []string)) {
+	a.published = append(a.published, handler)
+}
+
+// Write reports prefixes to the aggregator, it is used as the collector output
+func (a *Agent) Write(ctx context.Context, prefixes []string) error {
+	a.mutex.Lock()
+	a.prefixes = prefixes
+	a.mutex.Unlock()
+
+	return a.report(ctx)
+}
+
+// Serve reports the last prefixes every interval until ctx is done
+func (a *Agent) Serve(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.report(ctx); err != nil {
+				logrus.Warn(err)
+			}
+		}
+	}
+}
+
+func (a *Agent) report(ctx context.Context) error {
+	a.mutex.Lock()
+	report := &Report{Node: a.node, Prefixes: a.prefixes}
+	a.mutex.Unlock()
+	if health := prefixcollector.SourcesHealth(a.sources); len(health) > 0 {
+		report.Sources = health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.interval)
+	defer cancel()
+
+	response, err := a.client.Report(ctx, report)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to report node %s prefixes to the aggregator", a.node)
+	}
+	if len(a.published) == 0 || response.Hash == "" {
+		return nil
+	}
+
+	a.publishedMutex.Lock()
+	defer a.publishedMutex.Unlock()
+	if response.Hash != a.publishedHash {
+		a.publishedHash = response.Hash
+		for _, handler := range a.published {
+			handler(ctx, response.Prefixes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+)
+
+func TestAgentReportsToAggregator(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	aggregator := aggregation.NewAggregator(ctx, notify, 200*time.Millisecond)
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	listenURL := &url.URL{Scheme: "tcp", Host: "127.0.0.1:0"}
+	server := aggregation.NewServer()
+	aggregation.RegisterAggregatorServer(server, aggregator)
+	errCh := grpcutils.ListenAndServe(serverCtx, listenURL, server)
+	defer func() {
+		stopServer()
+		<-errCh
+	}()
+
+	cc, err := grpc.DialContext(ctx, grpcutils.URLToTarget(listenURL),
+		append(aggregation.DialOptions(), grpc.WithInsecure(), grpc.WithBlock())...)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cc.Close() }()
+
+	client := aggregation.NewAggregatorClient(cc)
+	node1 := aggregation.NewAgent(client, "node-1", time.Second)
+	node2 := aggregation.NewAgent(client, "node-2", time.Second)
+
+	g.Expect(node1.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(node2.Write(ctx, []string{"10.0.0.0/24"})).To(Succeed())
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+
+	g.Expect(aggregator.Nodes()).To(Equal([]string{"node-1", "node-2"}))
+	g.Expect(aggregator.Prefixes()).To(Equal([]string{"10.0.0.0/24", "fd00::/64"}))
+
+	// the same report doesn't notify
+	g.Expect(node1.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+	g.Consistently(notify.Events(), 50*time.Millisecond).ShouldNot(Receive())
+
+	_, err = client.Report(ctx, &aggregation.Report{Prefixes: []string{"10.1.0.0/24"}})
+	g.Expect(err).To(HaveOccurred())
+
+	// prefixes of the nodes not reporting anymore expire
+	g.Eventually(func() []string {
+		select {
+		case <-notify.Events():
+		default:
+		}
+		return aggregator.Prefixes()
+	}, time.Second).Should(BeEmpty())
+}
+
+type healthSource struct {
+	health prefixcollector.SourceHealth
+}
+
+func (s *healthSource) Prefixes() []string {
+	return nil
+}
+
+func (s *healthSource) Name() string {
+	return "sidecar"
+}
+
+func (s *healthSource) Health() prefixcollector.SourceHealth {
+	return s.health
+}
+
+func TestAggregatorHealth(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	aggregator := aggregation.NewAggregator(ctx, notify, time.Minute)
+	g.Expect(aggregator.Health()).To(Equal(prefixcollector.SourceHealth{Healthy: true}))
+
+	reports := []*aggregation.Report{
+		{Node: "node-1", Sources: prefixcollector.SourcesHealth([]prefixcollector.PrefixSource{&healthSource{
+			health: prefixcollector.SourceHealth{Healthy: true, Counters: map[string]uint64{"fetches": 2}},
+		}})},
+		{Node: "node-2", Sources: prefixcollector.SourcesHealth([]prefixcollector.PrefixSource{&healthSource{
+			health: prefixcollector.SourceHealth{Message: "timeout", Counters: map[string]uint64{"fetches": 1, "errors": 1}},
+		}})},
+	}
+	for _, report := range reports {
+		_, err := aggregator.Report(ctx, report)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Eventually(notify.Events(), time.Second).Should(Receive())
+	}
+
+	g.Expect(aggregator.Health()).To(Equal(prefixcollector.SourceHealth{
+		Message:  "node-2/sidecar: timeout",
+		Counters: map[string]uint64{"sidecar_fetches": 3, "sidecar_errors": 1},
+	}))
+}
+
+type localClient struct {
+	aggregator *aggregation.Aggregator
+}
+
+func (c *localClient) Report(ctx context.Context, report *aggregation.Report, _ ...grpc.CallOption) (*aggregation.ReportResponse, error) {
+	return c.aggregator.Report(ctx, report)
+}
+
+func TestAgentReceivesPublishedPrefixes(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	aggregator := aggregation.NewAggregator(ctx, utils.NewEventBus(), time.Minute)
+	agent := aggregation.NewAgent(&localClient{aggregator: aggregator}, "node-1", time.Second)
+	var published [][]string
+	agent.OnPublished(func(_ context.Context, prefixes []string) {
+		published = append(published, prefixes)
+	})
+	var calls int
+	agent.OnPublished(func(context.Context, []string) { calls++ })
+
+	// nothing is published until the collector publishes prefixes
+	g.Expect(agent.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+	g.Expect(published).To(BeEmpty())
+
+	publish := func(prefixes ...string) {
+		data, err := json.Marshal(&prefixcollector.PublishedPrefixes{Prefixes: prefixes, Hash: prefixcollector.PrefixesHash(prefixes)})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(aggregator.Publish(ctx, data)).To(Succeed())
+	}
+	publish("10.96.0.0/12", "fd00::/64")
+	g.Expect(agent.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+	g.Expect(agent.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+	publish()
+	g.Expect(agent.Write(ctx, []string{"fd00::/64"})).To(Succeed())
+
+	g.Expect(published).To(Equal([][]string{{"10.96.0.0/12", "fd00::/64"}, nil}))
+	g.Expect(calls).To(Equal(2))
+	g.Expect(aggregator.Publish(ctx, []byte("{"))).ToNot(Succeed())
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Aggregator is AggregatorServer and excluded prefix source of the prefixes reported by node agents.
+// Prefixes of the node are removed, if its agent doesn't report them for ttl. Health of the node-local sources
+// reported by the agents is aggregated in the aggregator health. Aggregator is also prefixcollector.Publisher
+// of the collector prefixes, which are returned to the agents in the report responses.
+type Aggregator struct {
+	notify    *utils.EventBus
+	ttl       time.Duration
+	mutex     sync.Mutex
+	reports   map[string]*nodeReport
+	published *ReportResponse
+}
+
+type nodeReport struct {
+	prefixes []string
+	sources  map[string]prefixcollector.SourceHealth
+	expiry   time.Time
+}
+
+// NewAggregator creates Aggregator
+func NewAggregator(ctx context.Context, notify *utils.EventBus, ttl time.Duration) *Aggregator {
+	aggregator := &Aggregator{
+		notify:  notify,
+		ttl:     ttl,
+		reports: map[string]*nodeReport{},
+	}
+
+	go aggregator.expire(ctx)
+	return aggregator
+}
+
+// Report stores prefixes and sources health reported by node agent
+func (a *Aggregator) Report(_ context.Context, report *Report) (*ReportResponse, error) {
+	if report.Node == "" {
+		return nil, errors.New("Report node is not set")
+	}
+
+	a.mutex.Lock()
+	previous, ok := a.reports[report.Node]
+	changed := !ok || !equalPrefixes(previous.prefixes, report.Prefixes) || !reflect.DeepEqual(previous.sources, report.Sources)
+	a.reports[report.Node] = &nodeReport{
+		prefixes: report.Prefixes,
+		sources:  report.Sources,
+		expiry:   time.Now().Add(a.ttl),
+	}
+	response := &ReportResponse{}
+	if a.published != nil {
+		response = a.published
+	}
+	a.mutex.Unlock()
+
+	if changed {
+		a.notify.Notify()
+	}
+	return response, nil
+}
+
+// Publish stores JSON prefixcollector.PublishedPrefixes of the collector returned to the agents
+func (a *Aggregator) Publish(_ context.Context, data []byte) error {
+	published := &prefixcollector.PublishedPrefixes{}
+	if err := json.Unmarshal(data, published); err != nil {
+		return errors.Wrap(err, "Failed to unmarshal published prefixes")
+	}
+
+	a.mutex.Lock()
+	a.published = &ReportResponse{Prefixes: published.Prefixes, Hash: published.Hash}
+	a.mutex.Unlock()
+	return nil
+}
+
+// Prefixes returns prefixes reported by all the nodes
+func (a *Aggregator) Prefixes() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var prefixes []string
+	for _, report := range a.reports {
+		prefixes = append(prefixes, report.prefixes...)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// Name returns name of the source
+func (a *Aggregator) Name() string {
+	return "agents"
+}
+
+// Health returns health of the sources reported by all the nodes. Aggregator is unhealthy if any of the node
+// sources is unhealthy, counters of the sources are summed up by the source and counter names.
+func (a *Aggregator) Health() prefixcollector.SourceHealth {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	health := prefixcollector.SourceHealth{Healthy: true}
+	var unhealthy []string
+	for node, report := range a.reports {
+		for source, sourceHealth := range report.sources {
+			if !sourceHealth.Healthy {
+				unhealthy = append(unhealthy, node+"/"+source+": "+sourceHealth.Message)
+			}
+			for counter, value := range sourceHealth.Counters {
+				if health.Counters == nil {
+					health.Counters = map[string]uint64{}
+				}
+				health.Counters[source+"_"+counter] += value
+			}
+		}
+	}
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		health.Healthy = false
+		health.Message = strings.Join(unhealthy, ", ")
+	}
+	return health
+}
+
+// Nodes returns names of the nodes, which agents have reported prefixes
+func (a *Aggregator) Nodes() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	nodes := make([]string, 0, len(a.reports))
+	for node := range a.reports {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func (a *Aggregator) expire(ctx context.Context) {
+	ticker := time.NewTicker(a.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.mutex.Lock()
+			expired := false
+			for node, report := range a.reports {
+				if now.After(report.expiry) {
+					delete(a.reports, node)
+					expired = true
+				}
+			}
+			a.mutex.Unlock()
+
+			if expired {
+				a.notify.Notify()
+			}
+		}
+	}
+}
+
+func equalPrefixes(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	federationServiceName = "networkservicemesh.excludedprefixes.v1.Federation"
+	// FederationSourcePrefix is name prefix of the sources of prefixes pulled from remote collectors
+	FederationSourcePrefix = "federation/"
+)
+
+// PrefixesRequest is request of remote collector for the published prefixes
+type PrefixesRequest struct {
+	// Cluster is id of the requesting collector cluster
+	Cluster string `json:"cluster"`
+}
+
+// FederatedPrefix is prefix published by collector with its origin metadata
+type FederatedPrefix struct {
+	Prefix string `json:"prefix"`
+	// Origin is id of the cluster the prefix is collected in
+	Origin string `json:"origin"`
+	// Hops is number of collectors the prefix is pulled through from the origin one
+	Hops int `json:"hops"`
+}
+
+// PrefixesResponse is response to PrefixesRequest
+type PrefixesResponse struct {
+	// Cluster is id of the responding collector cluster
+	Cluster  string            `json:"cluster"`
+	Prefixes []FederatedPrefix `json:"prefixes"`
+}
+
+// FederatedSource is prefix source of the prefixes pulled from remote collector, keeping their origin metadata
+type FederatedSource interface {
+	prefixcollector.PrefixSource
+	FederatedPrefixes() []FederatedPrefix
+}
+
+// FederationServer is server of the published prefixes
+type FederationServer interface {
+	Prefixes(context.Context, *PrefixesRequest) (*PrefixesResponse, error)
+}
+
+// FederationClient is client of the published prefixes
+type FederationClient interface {
+	Prefixes(ctx context.Context, request *PrefixesRequest, opts ...grpc.CallOption) (*PrefixesResponse, error)
+}
+
+var federationServiceDesc = grpc.ServiceDesc{
+	ServiceName: federationServiceName,
+	HandlerType: (*FederationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(federationServiceName, "Prefixes", func() interface{} { return &PrefixesRequest{} },
+			func(srv interface{}, ctx context.Context, request interface{}) (interface{}, error) {
+				return srv.(FederationServer).Prefixes(ctx, request.(*PrefixesRequest))
+			}),
+	},
+}
+
+// RegisterFederationServer registers srv on server created with NewServer
+func RegisterFederationServer(server *grpc.Server, srv FederationServer) {
+	server.RegisterService(&federationServiceDesc, srv)
+}
+
+type federationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewFederationClient creates FederationClient of the connection created with DialOptions
+func NewFederationClient(cc grpc.ClientConnInterface) FederationClient {
+	return &federationClient{cc: cc}
+}
+
+func (c *federationClient) Prefixes(ctx context.Context, request *PrefixesRequest,
+	opts ...grpc.CallOption) (*PrefixesResponse, error) {
+	response := &PrefixesResponse{}
+	if err := c.cc.Invoke(ctx, "/"+federationServiceName+"/Prefixes", request, response, opts...); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Federation is FederationServer of the prefixes collected by the sources of the cluster.
+// Prefixes are never returned to their origin cluster and to the cluster they are pulled from, so they don't
+// loop between the clusters. Prefixes pulled through more than maxHops collectors are dropped, 0 is unlimited.
+type Federation struct {
+	cluster string
+	maxHops int
+	sources []prefixcollector.PrefixSource
+}
+
+// NewFederation creates Federation of the cluster sources
+func NewFederation(cluster string, maxHops int, sources ...prefixcollector.PrefixSource) *Federation {
+	return &Federation{
+		cluster: cluster,
+		maxHops: maxHops,
+		sources: sources,
+	}
+}
+
+// Prefixes returns prefixes of the sources aggregated by origin and hops, except the ones looping back
+func (f *Federation) Prefixes(_ context.Context, request *PrefixesRequest) (*PrefixesResponse, error) {
+	if request.Cluster == f.cluster {
+		return nil, errors.Errorf("Federation request from the cluster %q itself", request.Cluster)
+	}
+
+	groups := map[FederatedPrefix][]string{}
+	for _, source := range f.sources {
+		if prefixcollector.SourceName(source) == FederationSourcePrefix+request.Cluster {
+			continue
+		}
+		federatedSource, ok := source.(FederatedSource)
+		if !ok {
+			local := FederatedPrefix{Origin: f.cluster}
+			groups[local] = append(groups[local], source.Prefixes()...)
+			continue
+		}
+		for _, entry := range federatedSource.FederatedPrefixes() {
+			group := FederatedPrefix{Origin: entry.Origin, Hops: entry.Hops + 1}
+			if entry.Origin == request.Cluster || entry.Origin == f.cluster || f.maxHops > 0 && group.Hops > f.maxHops {
+				continue
+			}
+			groups[group] = append(groups[group], entry.Prefix)
+		}
+	}
+
+	response := &PrefixesResponse{Cluster: f.cluster, Prefixes: []FederatedPrefix{}}
+	for group, prefixes := range groups {
+		aggregated, err := utils.AggregatePrefixes(prefixes)
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range aggregated {
+			response.Prefixes = append(response.Prefixes, FederatedPrefix{Prefix: prefix, Origin: group.Origin, Hops: group.Hops})
+		}
+	}
+	sort.Slice(response.Prefixes, func(i, j int) bool {
+		x, y := &response.Prefixes[i], &response.Prefixes[j]
+		if x.Origin != y.Origin {
+			return x.Origin < y.Origin
+		}
+		if x.Hops != y.Hops {
+			return x.Hops < y.Hops
+		}
+		return x.Prefix < y.Prefix
+	})
+	return response, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+type namedSource struct {
+	name     string
+	prefixes []string
+}
+
+func (s *namedSource) Prefixes() []string {
+	return s.prefixes
+}
+
+func (s *namedSource) Name() string {
+	return s.name
+}
+
+type federatedSource struct {
+	namedSource
+	entries []aggregation.FederatedPrefix
+}
+
+func (s *federatedSource) FederatedPrefixes() []aggregation.FederatedPrefix {
+	return s.entries
+}
+
+func TestFederationDoesNotReturnPrefixesToTheirOrigin(t *testing.T) {
+	g := NewWithT(t)
+
+	federation := aggregation.NewFederation("core", 2,
+		prefixsource.NewEnvPrefixSource([]string{"10.0.0.0/24", "10.0.1.0/24"}),
+		&namedSource{name: "static", prefixes: []string{"10.0.2.0/24"}},
+		&federatedSource{
+			namedSource: namedSource{name: aggregation.FederationSourcePrefix + "edge"},
+			entries: []aggregation.FederatedPrefix{
+				{Prefix: "192.168.0.0/16", Origin: "edge"},
+				{Prefix: "172.16.0.0/16", Origin: "far-edge", Hops: 1},
+			},
+		},
+		&federatedSource{
+			namedSource: namedSource{name: aggregation.FederationSourcePrefix + "region"},
+			entries: []aggregation.FederatedPrefix{
+				{Prefix: "172.20.0.0/16", Origin: "region"},
+				{Prefix: "172.21.0.0/16", Origin: "edge", Hops: 1},
+				{Prefix: "172.22.0.0/16", Origin: "world", Hops: 2},
+			},
+		},
+	)
+
+	response, err := federation.Prefixes(context.Background(), &aggregation.PrefixesRequest{Cluster: "edge"})
+	g.Expect(err).To(BeNil())
+	g.Expect(response).To(Equal(&aggregation.PrefixesResponse{
+		Cluster: "core",
+		Prefixes: []aggregation.FederatedPrefix{
+			{Prefix: "10.0.0.0/23", Origin: "core"},
+			{Prefix: "10.0.2.0/24", Origin: "core"},
+			{Prefix: "172.20.0.0/16", Origin: "region", Hops: 1},
+		},
+	}))
+
+	response, err = federation.Prefixes(context.Background(), &aggregation.PrefixesRequest{Cluster: "region"})
+	g.Expect(err).To(BeNil())
+	g.Expect(response.Prefixes).To(Equal([]aggregation.FederatedPrefix{
+		{Prefix: "10.0.0.0/23", Origin: "core"},
+		{Prefix: "10.0.2.0/24", Origin: "core"},
+		{Prefix: "192.168.0.0/16", Origin: "edge", Hops: 1},
+		{Prefix: "172.16.0.0/16", Origin: "far-edge", Hops: 2},
+	}))
+
+	_, err = federation.Prefixes(context.Background(), &aggregation.PrefixesRequest{Cluster: "core"})
+	g.Expect(err).NotTo(BeNil())
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package aggregation contains gRPC services of the collector: aggregator node agents report node-local
+// excluded prefixes to and federation remote collectors pull published prefixes from
+package aggregation
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	aggregatorServiceName = "networkservicemesh.excludedprefixes.v1.Aggregator"
+	codecName             = "json"
+)
+
+// Report is node agent report of the node-local excluded prefixes
+type Report struct {
+	Node     string   `json:"node"`
+	Prefixes []string `json:"prefixes"`
+	// Sources are health of the node-local health reporting sources by their names
+	Sources map[string]prefixcollector.SourceHealth `json:"sources,omitempty"`
+}
+
+// ReportResponse is response to Report
+type ReportResponse struct {
+	// Prefixes are excluded prefixes published by the collector, they are set only if Hash is set
+	Prefixes []string `json:"prefixes,omitempty"`
+	Hash     string   `json:"hash,omitempty"`
+}
+
+// AggregatorServer is server of node agent reports
+type AggregatorServer interface {
+	Report(context.Context, *Report) (*ReportResponse, error)
+}
+
+// AggregatorClient is client of node agent reports
+type AggregatorClient interface {
+	Report(ctx context.Context, report *Report, opts ...grpc.CallOption) (*ReportResponse, error)
+}
+
+// jsonCodec encodes messages as JSON, so the service doesn't depend on generated protobuf code
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+func (c jsonCodec) String() string {
+	return c.Name()
+}
+
+// unaryMethod returns description of unary method of service, newRequest creates empty method request
+// and call calls the method of the server
+func unaryMethod(service, method string, newRequest func() interface{},
+	call func(srv interface{}, ctx context.Context, request interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, decode func(interface{}) error,
+			interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := newRequest()
+			if err := decode(request); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv, ctx, request)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + service + "/" + method}
+			return interceptor(ctx, request, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				return call(srv, ctx, request)
+			})
+		},
+	}
+}
+
+var aggregatorServiceDesc = grpc.ServiceDesc{
+	ServiceName: aggregatorServiceName,
+	HandlerType: (*AggregatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(aggregatorServiceName, "Report", func() interface{} { return &Report{} },
+			func(srv interface{}, ctx context.Context, request interface{}) (interface{}, error) {
+				return srv.(AggregatorServer).Report(ctx, request.(*Report))
+			}),
+	},
+}
+
+// NewServer creates gRPC server of the collector services
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(append([]grpc.ServerOption{grpc.CustomCodec(jsonCodec{})}, opts...)...)
+}
+
+// RegisterAggregatorServer registers srv on server created with NewServer
+func RegisterAggregatorServer(server *grpc.Server, srv AggregatorServer) {
+	server.RegisterService(&aggregatorServiceDesc, srv)
+}
+
+// DialOptions returns options of connections to the collector services
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{}))}
+}
+
+type aggregatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewAggregatorClient creates AggregatorClient of the connection created with DialOptions
+func NewAggregatorClient(cc grpc.ClientConnInterface) AggregatorClient {
+	return &aggregatorClient{cc: cc}
+}
+
+func (c *aggregatorClient) Report(ctx context.Context, report *Report, opts ...grpc.CallOption) (*ReportResponse, error) {
+	response := &ReportResponse{}
+	if err := c.cc.Invoke(ctx, "/"+aggregatorServiceName+"/Report", report, response, opts...); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/networkservicemesh/api/pkg/api/networkservice"
+)
+
+// AllocationConflictReason is reason of the Kubernetes event reporting excluded prefixes overlapping
+// live NSM connection allocations
+const AllocationConflictReason = "ExcludedPrefixesConflict"
+
+// allocationChecker checks newly excluded prefixes against addresses allocated to live NSM connections
+type allocationChecker struct {
+	managers []networkservice.MonitorConnectionClient
+	timeout  time.Duration
+	// configMapName and namespace are of the config map conflicts events are reported for, events aren't
+	// reported if configMapName is empty
+	configMapName string
+	namespace     string
+}
+
+// AllocationConflict is excluded prefix overlapping addresses allocated to NSM connections
+type AllocationConflict struct {
+	Prefix      string
+	Connections []string
+}
+
+// WithAllocationCheck is ExcludedPrefixCollector option, which checks every newly excluded prefix against
+// addresses and extra prefixes allocated to connections monitored by NSM managers and reports overlaps,
+// since they break the existing connections. Overlaps are reported in status and by Kubernetes events of
+// configMapName config map in namespace, if it is set. Every manager is queried within timeout.
+func WithAllocationCheck(configMapName, namespace string, timeout time.Duration,
+	managers ...networkservice.MonitorConnectionClient) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.allocations = &allocationChecker{
+			managers:      managers,
+			timeout:       timeout,
+			configMapName: configMapName,
+			namespace:     namespace,
+		}
+		collector.status.AllocationsChecked = true
+	}
+}
+
+// checkAllocations reports prefixes of the change overlapping live connection allocations
+func (epc *ExcludedPrefixCollector) checkAllocations(ctx context.Context, change *PrefixesChange) {
+	if epc.allocations == nil {
+		return
+	}
+	conflicts := epc.allocations.conflicts(ctx, change.Added)
+
+	prefixes := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		prefixes = append(prefixes, conflict.Prefix)
+		logrus.WithField("connections", conflict.Connections).
+			Warnf("Excluded prefix %s overlaps addresses of live NSM connections", conflict.Prefix)
+		if err := epc.allocations.reportEvent(ctx, conflict); err != nil {
+			logrus.Error(err)
+		}
+	}
+	if len(prefixes) == 0 && len(epc.status.AllocationConflicts) == 0 {
+		return
+	}
+	epc.status.AllocationConflicts = prefixes
+	epc.reportStatus(ctx)
+}
+
+// conflicts returns prefixes overlapping addresses allocated to connections of all the managers, managers
+// failed to be queried are reported and skipped
+func (c *allocationChecker) conflicts(ctx context.Context, prefixes []string) []AllocationConflict {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	allocations := map[string][]string{}
+	for _, manager := range c.managers {
+		managerAllocations, err := c.connectionAllocations(ctx, manager)
+		if err != nil {
+			logrus.Errorf("Failed to check NSM connection allocations: %v", err)
+			continue
+		}
+		for id, addresses := range managerAllocations {
+			allocations[id] = append(allocations[id], addresses...)
+		}
+	}
+	return AllocationConflicts(prefixes, allocations)
+}
+
+// connectionAllocations returns addresses and extra prefixes allocated to the manager connections by connection id
+func (c *allocationChecker) connectionAllocations(ctx context.Context,
+	manager networkservice.MonitorConnectionClient) (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stream, err := manager.MonitorConnections(ctx, &networkservice.MonitorScopeSelector{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to monitor NSM connections")
+	}
+	event, err := stream.Recv()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to receive NSM connections")
+	}
+
+	allocations := make(map[string][]string, len(event.GetConnections()))
+	for id, connection := range event.GetConnections() {
+		ipContext := connection.GetContext().GetIpContext()
+		var addresses []string
+		for _, address := range append([]string{ipContext.GetSrcIpAddr(), ipContext.GetDstIpAddr()},
+			ipContext.GetExtraPrefixes()...) {
+			if address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+		allocations[id] = addresses
+	}
+	return allocations, nil
+}
+
+// reportEvent creates Kubernetes warning event of the conflict for the config map
+func (c *allocationChecker) reportEvent(ctx context.Context, conflict AllocationConflict) error {
+	if c.configMapName == "" {
+		return nil
+	}
+	now := metav1.Now()
+	_, err := KubernetesInterface(ctx).CoreV1().Events(c.namespace).Create(ctx, &apiV1.Event{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: c.configMapName + "-"},
+		InvolvedObject: apiV1.ObjectReference{
+			Kind: "ConfigMap", APIVersion: "v1", Namespace: c.namespace, Name: c.configMapName,
+		},
+		Reason: AllocationConflictReason,
+		Message: fmt.Sprintf("Excluded prefix %s overlaps addresses of live NSM connections %s",
+			conflict.Prefix, strings.Join(conflict.Connections, ", ")),
+		Type:           apiV1.EventTypeWarning,
+		Source:         apiV1.EventSource{Component: "excluded-prefixes-collector"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	return errors.Wrapf(err, "Failed to report conflict of excluded prefix %s", conflict.Prefix)
+}
+
+// AllocationConflicts returns prefixes overlapping allocations, which are addresses by connection id
+func AllocationConflicts(prefixes []string, allocations map[string][]string) []AllocationConflict {
+	var conflicts []AllocationConflict
+	for _, prefix := range prefixes {
+		conflict := AllocationConflict{Prefix: prefix}
+		for id, addresses := range allocations {
+			for _, address := range addresses {
+				if utils.Overlaps(prefix, address) {
+					conflict.Connections = append(conflict.Connections, id)
+					break
+				}
+			}
+		}
+		if len(conflict.Connections) > 0 {
+			sort.Strings(conflict.Connections)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
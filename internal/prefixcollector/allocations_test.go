@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/networkservicemesh/api/pkg/api/networkservice"
+)
+
+type testMonitorConnectionClient struct {
+	connections map[string]*networkservice.Connection
+}
+
+func (c *testMonitorConnectionClient) MonitorConnections(context.Context, *networkservice.MonitorScopeSelector,
+	...grpc.CallOption) (networkservice.MonitorConnection_MonitorConnectionsClient, error) {
+	return &testMonitorConnectionsStream{event: &networkservice.ConnectionEvent{
+		Type:        networkservice.ConnectionEventType_INITIAL_STATE_TRANSFER,
+		Connections: c.connections,
+	}}, nil
+}
+
+type testMonitorConnectionsStream struct {
+	grpc.ClientStream
+	event *networkservice.ConnectionEvent
+}
+
+func (s *testMonitorConnectionsStream) Recv() (*networkservice.ConnectionEvent, error) {
+	return s.event, nil
+}
+
+func connectionWithAddresses(src, dst string) *networkservice.Connection {
+	return &networkservice.Connection{Context: &networkservice.ConnectionContext{
+		IpContext: &networkservice.IPContext{SrcIpAddr: src, DstIpAddr: dst},
+	}}
+}
+
+func TestAllocationConflicts(t *testing.T) {
+	conflicts := prefixcollector.AllocationConflicts([]string{"10.0.0.0/16", "10.1.0.0/16", "fd00::/64"},
+		map[string][]string{
+			"conn-1": {"10.0.0.5/32", "10.0.0.6/32"},
+			"conn-2": {"10.0.1.5/32"},
+			"conn-3": {"172.16.0.1/32"},
+		})
+	require.Equal(t, []prefixcollector.AllocationConflict{
+		{Prefix: "10.0.0.0/16", Connections: []string{"conn-1", "conn-2"}},
+	}, conflicts)
+}
+
+func TestAllocationCheck(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	manager := &testMonitorConnectionClient{connections: map[string]*networkservice.Connection{
+		"conn-1": connectionWithAddresses("10.96.0.5/32", "10.96.0.6/32"),
+		"conn-2": connectionWithAddresses("172.16.0.1/32", "172.16.0.2/32"),
+	}}
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithAllocationCheck(nsmConfigMapName, configMapNamespace, time.Second, manager),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12", "10.244.0.0/16"})),
+	).Serve(ctx)
+
+	var events *v1.EventList
+	require.Eventually(t, func() bool {
+		var err error
+		events, err = clientSet.CoreV1().Events(configMapNamespace).List(ctx, metav1.ListOptions{})
+		return err == nil && len(events.Items) > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Len(t, events.Items, 1)
+	require.Equal(t, prefixcollector.AllocationConflictReason, events.Items[0].Reason)
+	require.Equal(t, nsmConfigMapName, events.Items[0].InvolvedObject.Name)
+	require.Contains(t, events.Items[0].Message, "10.96.0.0/12")
+	require.Contains(t, events.Items[0].Message, "conn-1")
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// AuditConfigMapKey is audit config map key containing JSON list of the latest prefixes changes
+const AuditConfigMapKey = "audit.json"
+
+// SourceChange is a change of prefixes provided by a single source
+type SourceChange struct {
+	Source  string   `json:"source"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// PrefixesChange is a change of excluded prefixes with the source changes caused it
+type PrefixesChange struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Added     []string       `json:"added,omitempty"`
+	Removed   []string       `json:"removed,omitempty"`
+	Sources   []SourceChange `json:"sources,omitempty"`
+}
+
+// changeHandlerFunc is excluded prefixes change handler func
+type changeHandlerFunc func(context.Context, *PrefixesChange)
+
+// WithAuditFile is ExcludedPrefixCollector option, which appends every prefixes change to file as JSON line
+func WithAuditFile(filePath string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.changeHandlers = append(collector.changeHandlers, fileAuditor(filePath))
+	}
+}
+
+// WithAuditConfigMap is ExcludedPrefixCollector option, which keeps the latest size prefixes changes in configMap
+func WithAuditConfigMap(name, namespace string, size int) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.changeHandlers = append(collector.changeHandlers, configMapAuditor(name, namespace, size))
+	}
+}
+
+// fileAuditor - creates file changeHandlerFunc
+func fileAuditor(filePath string) changeHandlerFunc {
+	return func(ctx context.Context, change *PrefixesChange) {
+		span := spanhelper.FromContext(ctx, "Append excluded prefixes change to audit file")
+		defer span.Finish()
+
+		data, err := json.Marshal(change)
+		if err != nil {
+			span.Logger().Errorf("Can not marshal prefixes change: %v", err)
+			return
+		}
+
+		file, err := os.OpenFile(filepath.Clean(filePath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, outputFilePermissions)
+		if err != nil {
+			span.Logger().Errorf("Unable to open audit file: %v", err)
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		if _, err = file.Write(append(data, '\n')); err != nil {
+			span.Logger().Errorf("Unable to write into audit file: %v", err)
+		}
+	}
+}
+
+// configMapAuditor - creates k8s config map ring buffer changeHandlerFunc
+func configMapAuditor(configMapName, configMapNamespace string, size int) changeHandlerFunc {
+	return func(ctx context.Context, change *PrefixesChange) {
+		span := spanhelper.FromContext(ctx, "Append excluded prefixes change to audit config map")
+		defer span.Finish()
+
+		if err := appendAuditConfigMap(ctx, configMapName, configMapNamespace, size, change); err != nil {
+			span.Logger().Error(err)
+		}
+	}
+}
+
+func appendAuditConfigMap(ctx context.Context, configMapName, configMapNamespace string,
+	size int, change *PrefixesChange) error {
+	configMapInterface := KubernetesInterface(ctx).
+		CoreV1().
+		ConfigMaps(configMapNamespace)
+
+	configMap, err := configMapInterface.Get(ctx, configMapName, metav1.GetOptions{})
+	create := apierrors.IsNotFound(err)
+	if err != nil && !create {
+		return errors.Wrapf(err, "Failed to get audit ConfigMap '%s/%s'", configMapNamespace, configMapName)
+	}
+
+	var changes []*PrefixesChange
+	if create {
+		configMap = &apiV1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapName}}
+	} else if data, ok := configMap.Data[AuditConfigMapKey]; ok {
+		if err = json.Unmarshal([]byte(data), &changes); err != nil {
+			return errors.Wrap(err, "Can not unmarshal audit ConfigMap changes")
+		}
+	}
+
+	changes = append(changes, change)
+	if len(changes) > size {
+		changes = changes[len(changes)-size:]
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return errors.Wrap(err, "Can not marshal audit ConfigMap changes")
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[AuditConfigMapKey] = string(data)
+
+	if create {
+		_, err = configMapInterface.Create(ctx, configMap, metav1.CreateOptions{})
+		return errors.Wrap(err, "Failed to create audit ConfigMap")
+	}
+	_, err = configMapInterface.Update(ctx, configMap, metav1.UpdateOptions{})
+	return errors.Wrap(err, "Failed to update audit ConfigMap")
+}
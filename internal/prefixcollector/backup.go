@@ -0,0 +1,209 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// BackupSnapshotPrefix is key prefix of the output snapshots in the backup object store
+	BackupSnapshotPrefix = "excluded-prefixes-"
+	// BackupSnapshotSuffix is key suffix of the output snapshots, they contain YAML list of the prefixes
+	BackupSnapshotSuffix = ".yaml"
+
+	// backupTimeFormat is UTC time format of the snapshot keys, which are sorted in the order of their times
+	backupTimeFormat = "20060102T150405.000Z"
+	backupTimeout    = 30 * time.Second
+	// backupPruneInterval is interval of the snapshots pruning, the first pruning follows the first snapshot
+	backupPruneInterval = 10 * time.Minute
+)
+
+// outputBackup uploads snapshots of the output to the object store and prunes snapshots out of retention
+type outputBackup struct {
+	store *ObjectStore
+	// retention is age of snapshots they are deleted after, 0 keeps the snapshots regardless of age
+	retention time.Duration
+	// count is number of the latest snapshots kept, 0 keeps all of them
+	count int
+	start sync.Once
+	// latest is the latest output snapshot not yet uploaded, older ones are replaced by it
+	latest chan *outputSnapshot
+}
+
+// outputSnapshot is output prefixes written at time
+type outputSnapshot struct {
+	prefixes []string
+	time     time.Time
+}
+
+// WithBackup is ExcludedPrefixCollector option, which uploads timestamped snapshot of the output prefixes
+// to store after every output write. Snapshots older than retention or beyond count latest ones are deleted,
+// zero retention and count don't limit the snapshots. Snapshots are uploaded and pruned by goroutine
+// of the context Lifecycle, outputs written while the previous snapshot is being uploaded are coalesced
+// into the latest one.
+func WithBackup(store *ObjectStore, retention time.Duration, count int) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.backup = &outputBackup{
+			store:     store,
+			retention: retention,
+			count:     count,
+			latest:    make(chan *outputSnapshot, 1),
+		}
+	}
+}
+
+// backupOutput queues snapshot of the written output prefixes for upload replacing the queued one,
+// failures don't affect the output. Uploading goroutine is started on the first snapshot.
+func (epc *ExcludedPrefixCollector) backupOutput(ctx context.Context, prefixes []string) {
+	if epc.backup == nil {
+		return
+	}
+	epc.backup.start.Do(func() {
+		Lifecycle(ctx).Go("output backup", func() { epc.backup.run(ctx) })
+	})
+	// the snapshots are queued by Serve goroutine only, so the emptied channel has room for the latest one
+	select {
+	case <-epc.backup.latest:
+	default:
+	}
+	epc.backup.latest <- &outputSnapshot{prefixes: prefixes, time: time.Now().UTC()}
+}
+
+// run uploads the queued snapshots and prunes the snapshots every backupPruneInterval until ctx is done
+func (b *outputBackup) run(ctx context.Context) {
+	pruneTicker := time.NewTicker(backupPruneInterval)
+	defer pruneTicker.Stop()
+	pruned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case snapshot := <-b.latest:
+			if b.upload(ctx, snapshot) && !pruned {
+				pruned = b.pruneSnapshots(ctx)
+			}
+		case <-pruneTicker.C:
+			pruned = b.pruneSnapshots(ctx)
+		}
+	}
+}
+
+// upload uploads snapshot, returns false if it failed
+func (b *outputBackup) upload(ctx context.Context, snapshot *outputSnapshot) bool {
+	span := spanhelper.FromContext(ctx, "Backup excluded prefixes")
+	defer span.Finish()
+
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+	if err := b.snapshot(ctx, snapshot.prefixes, snapshot.time); err != nil {
+		span.Logger().Errorf("Failed to backup excluded prefixes: %v", err)
+		return false
+	}
+	return true
+}
+
+// pruneSnapshots prunes snapshots out of retention now, returns false if it failed
+func (b *outputBackup) pruneSnapshots(ctx context.Context) bool {
+	span := spanhelper.FromContext(ctx, "Prune excluded prefixes backup")
+	defer span.Finish()
+
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+	if err := b.prune(ctx, time.Now().UTC()); err != nil {
+		span.Logger().Warnf("Failed to prune excluded prefixes backup: %v", err)
+		return false
+	}
+	return true
+}
+
+// snapshot uploads prefixes as the snapshot taken at now
+func (b *outputBackup) snapshot(ctx context.Context, prefixes []string, now time.Time) error {
+	data, err := utils.PrefixesToYaml(prefixes)
+	if err != nil {
+		return err
+	}
+	return b.store.Put(ctx, BackupSnapshotPrefix+now.Format(backupTimeFormat)+BackupSnapshotSuffix, data)
+}
+
+// prune deletes snapshots out of retention at now, the latest snapshot is always kept
+func (b *outputBackup) prune(ctx context.Context, now time.Time) error {
+	keys, err := b.store.List(ctx, BackupSnapshotPrefix)
+	if err != nil {
+		return err
+	}
+	var snapshots []string
+	var times []time.Time
+	for _, key := range keys {
+		if taken, ok := snapshotTime(key); ok {
+			snapshots, times = append(snapshots, key), append(times, taken)
+		}
+	}
+	for i, key := range snapshots {
+		latest := i == len(snapshots)-1
+		expired := b.retention > 0 && now.Sub(times[i]) > b.retention
+		exceeding := b.count > 0 && i < len(snapshots)-b.count
+		if latest || !expired && !exceeding {
+			continue
+		}
+		if err := b.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestSnapshot returns key and prefixes of the latest snapshot of store, empty key if there are no snapshots
+func latestSnapshot(ctx context.Context, store *ObjectStore) (string, []string, error) {
+	keys, err := store.List(ctx, BackupSnapshotPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if _, ok := snapshotTime(keys[i]); !ok {
+			continue
+		}
+		data, err := store.Get(ctx, keys[i])
+		if err != nil {
+			return "", nil, err
+		}
+		prefixes, err := utils.YamlToPrefixes(data)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "Can not unmarshal prefixes of snapshot %s", keys[i])
+		}
+		return keys[i], prefixes, nil
+	}
+	return "", nil, nil
+}
+
+// snapshotTime returns time the snapshot with key was taken at, false if key isn't snapshot key
+func snapshotTime(key string) (time.Time, bool) {
+	if !strings.HasPrefix(key, BackupSnapshotPrefix) || !strings.HasSuffix(key, BackupSnapshotSuffix) {
+		return time.Time{}, false
+	}
+	value := strings.TrimSuffix(strings.TrimPrefix(key, BackupSnapshotPrefix), BackupSnapshotSuffix)
+	taken, err := time.Parse(backupTimeFormat, value)
+	return taken, err == nil
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	backupOldSnapshot   = "nsm/excluded-prefixes-20200101T000000.000Z.yaml"
+	backupOtherObject   = "nsm/other.yaml"
+	backupAccessKeyID   = "AKIDEXAMPLE"
+	backupSecretKeyName = "secret"
+)
+
+func TestBackup(t *testing.T) {
+	bucket := newFakeBucket(backupOldSnapshot, backupOtherObject)
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	store, err := prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{
+		BucketURL:     server.URL + "/bucket/nsm/",
+		AccessKeyID:   backupAccessKeyID,
+		SecretKeyPath: backupSecretKeyPath(t),
+		Client:        server.Client(),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithBackup(store, time.Hour, 0),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		keys := bucket.keys()
+		return len(keys) == 2 && keys[0] != backupOldSnapshot && keys[1] == backupOtherObject
+	}, time.Second, 10*time.Millisecond)
+
+	prefixes, err := utils.YamlToPrefixes(bucket.object(bucket.keys()[0]))
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.96.0.0/12"}, prefixes)
+	require.False(t, bucket.unsigned())
+}
+
+func TestBackupRetentionCount(t *testing.T) {
+	bucket := newFakeBucket(backupOldSnapshot)
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	store, err := prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{
+		BucketURL:     server.URL + "/bucket/nsm/",
+		AccessKeyID:   backupAccessKeyID,
+		SecretKeyPath: backupSecretKeyPath(t),
+		Client:        server.Client(),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithBackup(store, 0, 2),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		keys := bucket.keys()
+		return len(keys) == 2 && keys[0] == backupOldSnapshot
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSlowBackup(t *testing.T) {
+	bucket := newFakeBucket()
+	puts := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodPut {
+			puts <- struct{}{}
+			<-release
+		}
+		bucket.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	store, err := prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{
+		BucketURL:     server.URL + "/bucket/nsm/",
+		AccessKeyID:   backupAccessKeyID,
+		SecretKeyPath: backupSecretKeyPath(t),
+		Client:        server.Client(),
+	})
+	require.NoError(t, err)
+
+	source := &mutablePrefixSource{prefixes: []string{"10.96.0.0/12"}}
+	bus := utils.NewEventBus()
+	written := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			written <- prefixes
+			return nil
+		}),
+		prefixcollector.WithBackup(store, 0, 0),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	requireWritten(t, written, []string{"10.96.0.0/12"})
+	<-puts
+	// the output is updated while the first snapshot is still being uploaded
+	for _, prefix := range []string{"10.97.0.0/16", "10.98.0.0/16"} {
+		source.set([]string{prefix})
+		bus.Notify()
+		requireWritten(t, written, []string{prefix})
+	}
+
+	close(release)
+	select {
+	case <-puts:
+	case <-time.After(time.Second):
+		require.FailNow(t, "The latest snapshot wasn't uploaded")
+	}
+	require.Eventually(t, func() bool {
+		keys := bucket.keys()
+		prefixes, err := utils.YamlToPrefixes(bucket.object(keys[len(keys)-1]))
+		return err == nil && len(prefixes) == 1 && prefixes[0] == "10.98.0.0/16"
+	}, time.Second, 10*time.Millisecond)
+	// the snapshot written while the first one was being uploaded is coalesced into the latest one
+	require.Never(t, func() bool { return len(puts) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestWrongObjectStore(t *testing.T) {
+	for _, bucketURL := range []string{"s3://bucket", "https://", "https://storage.googleapis.com/", "%"} {
+		_, err := prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{BucketURL: bucketURL})
+		require.Error(t, err, bucketURL)
+	}
+}
+
+func backupSecretKeyPath(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), backupSecretKeyName)
+	require.NoError(t, ioutil.WriteFile(path, []byte("wJalrXUtnFEMI\n"), 0600))
+	return path
+}
+
+// fakeBucket is the part of S3 API of a single bucket the object store depends on
+type fakeBucket struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	unsignedSeen bool
+}
+
+func newFakeBucket(keys ...string) *fakeBucket {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	for _, key := range keys {
+		bucket.objects[key] = []byte("[]")
+	}
+	return bucket
+}
+
+func (b *fakeBucket) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+backupAccessKeyID+"/") {
+		b.unsignedSeen = true
+		http.Error(writer, "unsigned request", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(request.URL.Path, "/bucket"), "/")
+	switch request.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(request.Body)
+		b.objects[key] = data
+	case http.MethodDelete:
+		delete(b.objects, key)
+		writer.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if key != "" {
+			data, ok := b.objects[key]
+			if !ok {
+				http.Error(writer, "no such key", http.StatusNotFound)
+				return
+			}
+			_, _ = writer.Write(data)
+			return
+		}
+		prefix := request.URL.Query().Get("prefix")
+		var contents strings.Builder
+		for objectKey := range b.objects {
+			if strings.HasPrefix(objectKey, prefix) {
+				_, _ = fmt.Fprintf(&contents, "<Contents><Key>%s</Key></Contents>", objectKey)
+			}
+		}
+		_, _ = fmt.Fprintf(writer, "<ListBucketResult>%s<IsTruncated>false</IsTruncated></ListBucketResult>", contents.String())
+	}
+}
+
+func (b *fakeBucket) keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (b *fakeBucket) object(key string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects[key]
+}
+
+func (b *fakeBucket) unsigned() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.unsignedSeen
+}
@@ -0,0 +1,619 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultBGPPort is TCP port of BGP router the prefixes are announced to if the peer address has no port
+	DefaultBGPPort = "179"
+	// BGPBlackholeCommunity is RFC 7999 BLACKHOLE well-known community 65535:666
+	BGPBlackholeCommunity = "65535:666"
+
+	bgpMessageHeaderLength = 19
+	bgpMaxMessageLength    = 4096
+	bgpVersion             = 4
+	bgpASTrans             = 23456
+	bgpConnectTimeout      = 10 * time.Second
+	bgpRetryInterval       = 10 * time.Second
+	// bgpPrefixesPerUpdate keeps UPDATE messages of the longest IPv6 prefixes within the maximal message length
+	bgpPrefixesPerUpdate = 200
+	// BGPMaxCommunities is maximal number of communities of the announced prefixes
+	BGPMaxCommunities = 64
+)
+
+// BGP message types, path attributes and capabilities of RFC 4271, RFC 4760 and RFC 6793
+const (
+	bgpOpenMessage         = 1
+	bgpUpdateMessage       = 2
+	bgpNotificationMessage = 3
+	bgpKeepaliveMessage    = 4
+
+	bgpOriginAttribute        = 1
+	bgpASPathAttribute        = 2
+	bgpNextHopAttribute       = 3
+	bgpLocalPrefAttribute     = 5
+	bgpCommunitiesAttribute   = 8
+	bgpMPReachAttribute       = 14
+	bgpMPUnreachAttribute     = 15
+	bgpAS4PathAttribute       = 17
+	bgpOptionalFlag           = 0x80
+	bgpTransitiveFlag         = 0x40
+	bgpExtendedLengthFlag     = 0x10
+	bgpOriginIncomplete       = 2
+	bgpASSequence             = 2
+	bgpDefaultLocalPreference = 100
+
+	bgpCapabilitiesParameter     = 2
+	bgpMultiprotocolCapability   = 1
+	bgpFourOctetASCapability     = 65
+	bgpAFIIPv4                   = 1
+	bgpAFIIPv6                   = 2
+	bgpSAFIUnicast               = 1
+	bgpHoldTimerExpiredError     = 4
+	bgpCeaseError                = 6
+	bgpOpenMessageError          = 2
+	bgpBadPeerASSubcode          = 2
+	bgpUnsupportedVersionSubcode = 1
+)
+
+// BGPOptions are settings of BGP session the excluded prefixes are announced with
+type BGPOptions struct {
+	// PeerAddress is host:port of the upstream router, DefaultBGPPort is used if the port is omitted
+	PeerAddress string
+	LocalAS     uint32
+	// PeerAS is AS of the router, the session is iBGP if it is equal to LocalAS
+	PeerAS uint32
+	// RouterID is BGP identifier, local IPv4 address of the session is used if it is nil
+	RouterID net.IP
+	// NextHop and NextHopIPv6 are next hops of IPv4 and IPv6 prefixes, local address of the session of the same
+	// family is used if nil. Prefixes of a family without next hop aren't announced.
+	NextHop     net.IP
+	NextHopIPv6 net.IP
+	// Communities are communities of the announced prefixes, e.g. BGPBlackholeCommunity
+	Communities []uint32
+	HoldTime    time.Duration
+}
+
+// ParseBGPCommunity parses community of ASN:value form
+func ParseBGPCommunity(value string) (uint32, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("BGP community %q should be ASN:value pair", value)
+	}
+	asn, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid ASN of BGP community %q", value)
+	}
+	communityValue, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid value of BGP community %q", value)
+	}
+	return uint32(asn<<16 | communityValue), nil
+}
+
+// BGPAnnouncer announces the excluded prefixes to upstream router over BGP session, so the physical network
+// can blackhole or steer around NSM-reserved space. The session is reestablished after failures and the prefixes
+// are withdrawn by the router when it is closed.
+type BGPAnnouncer struct {
+	options  *BGPOptions
+	mutex    sync.Mutex
+	prefixes []string
+	changed  chan struct{}
+}
+
+// bgpSession is established BGP session
+type bgpSession struct {
+	options     *BGPOptions
+	conn        net.Conn
+	fourOctetAS bool
+	iBGP        bool
+	nextHop     net.IP
+	nextHopIPv6 net.IP
+}
+
+// bgpMessage is received BGP message or error of the connection
+type bgpMessage struct {
+	messageType byte
+	body        []byte
+	err         error
+}
+
+// NewBGPAnnouncer creates BGPAnnouncer of the session with options
+func NewBGPAnnouncer(options *BGPOptions) (*BGPAnnouncer, error) {
+	switch {
+	case options.LocalAS == 0 || options.PeerAS == 0:
+		return nil, errors.New("Local and peer AS of BGP session should be set")
+	case len(options.Communities) > BGPMaxCommunities:
+		return nil, errors.Errorf("Number of BGP communities should not exceed %d", BGPMaxCommunities)
+	case options.HoldTime != 0 && (options.HoldTime < 3*time.Second || options.HoldTime > 0xffff*time.Second):
+		return nil, errors.New("BGP hold time should be 0 or from 3s to 65535s")
+	case options.RouterID != nil && options.RouterID.To4() == nil:
+		return nil, errors.Errorf("BGP router ID %s should be IPv4 address", options.RouterID)
+	case options.NextHop != nil && options.NextHop.To4() == nil:
+		return nil, errors.Errorf("BGP next hop %s should be IPv4 address", options.NextHop)
+	case options.NextHopIPv6 != nil && options.NextHopIPv6.To4() != nil:
+		return nil, errors.Errorf("BGP IPv6 next hop %s should be IPv6 address", options.NextHopIPv6)
+	}
+	withPort := *options
+	if _, _, err := net.SplitHostPort(options.PeerAddress); err != nil {
+		withPort.PeerAddress = net.JoinHostPort(options.PeerAddress, DefaultBGPPort)
+	}
+	if _, _, err := net.SplitHostPort(withPort.PeerAddress); err != nil || withPort.PeerAddress == "" {
+		return nil, errors.Errorf("Wrong BGP peer address %q", options.PeerAddress)
+	}
+	return &BGPAnnouncer{options: &withPort, changed: make(chan struct{}, 1)}, nil
+}
+
+// WithBGPAnnouncer is ExcludedPrefixCollector option, which announces the excluded prefixes with announcer.
+// The session is established after the first output write.
+func WithBGPAnnouncer(announcer *BGPAnnouncer) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		prefixes := prefixSet{}
+		var once sync.Once
+		collector.changeHandlers = append(collector.changeHandlers, func(ctx context.Context, change *PrefixesChange) {
+			prefixes.apply(change)
+			announcer.Announce(prefixes.sorted())
+			once.Do(func() {
+				Lifecycle(ctx).Go("bgp announcer", func() { announcer.Serve(ctx) })
+			})
+		})
+	}
+}
+
+// Announce sets prefixes announced to the router, they are announced when the session is established
+func (a *BGPAnnouncer) Announce(prefixes []string) {
+	a.mutex.Lock()
+	a.prefixes = prefixes
+	a.mutex.Unlock()
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// announced returns prefixes to announce
+func (a *BGPAnnouncer) announced() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.prefixes
+}
+
+// Serve keeps BGP session with the router until ctx is done, failed sessions are retried
+func (a *BGPAnnouncer) Serve(ctx context.Context) {
+	logger := logrus.WithField("bgpPeer", a.options.PeerAddress)
+	for {
+		err := a.serveSession(ctx, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("BGP session failed, retrying in %s: %v", bgpRetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bgpRetryInterval):
+		}
+	}
+}
+
+// serveSession establishes BGP session and announces the prefixes over it until ctx is done or the session fails
+func (a *BGPAnnouncer) serveSession(ctx context.Context, logger logrus.FieldLogger) error {
+	dialer := &net.Dialer{Timeout: bgpConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", a.options.PeerAddress)
+	if err != nil {
+		return errors.Wrap(err, "Failed to connect BGP peer")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	defer func() { _ = conn.Close() }()
+	messages := make(chan *bgpMessage)
+	go readBGPMessages(conn, messages, done)
+
+	session, holdTime, err := a.open(ctx, conn, messages)
+	if err != nil {
+		return err
+	}
+	logger.Infof("BGP session is established, hold time %s", holdTime)
+
+	// hold time of the peer messages is checked on every keepalive
+	var keepalives <-chan time.Time
+	if holdTime > 0 {
+		ticker := time.NewTicker(holdTime / 3)
+		defer ticker.Stop()
+		keepalives = ticker.C
+	}
+	received := time.Now()
+
+	announced := map[string]bool{}
+	if err := session.sync(a.announced(), announced); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			_ = writeBGPMessage(conn, bgpNotificationMessage, []byte{bgpCeaseError, 0})
+			return nil
+		case <-a.changed:
+			err = session.sync(a.announced(), announced)
+		case <-keepalives:
+			if time.Since(received) > holdTime {
+				_ = writeBGPMessage(conn, bgpNotificationMessage, []byte{bgpHoldTimerExpiredError, 0})
+				return errors.New("BGP hold timer expired")
+			}
+			err = writeBGPMessage(conn, bgpKeepaliveMessage, nil)
+		case message := <-messages:
+			received = time.Now()
+			err = bgpMessageError(message)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// open exchanges OPEN and KEEPALIVE messages with the peer, returns the established session and negotiated hold time
+func (a *BGPAnnouncer) open(ctx context.Context, conn net.Conn, messages <-chan *bgpMessage) (*bgpSession, time.Duration, error) {
+	local := conn.LocalAddr().(*net.TCPAddr).IP
+	routerID := a.options.RouterID
+	if routerID == nil {
+		routerID = local.To4()
+	}
+	if routerID == nil {
+		return nil, 0, errors.New("BGP router ID should be set for IPv6 sessions")
+	}
+	if err := writeBGPMessage(conn, bgpOpenMessage, a.openMessage(routerID.To4())); err != nil {
+		return nil, 0, err
+	}
+
+	holdTimeout := a.options.HoldTime
+	if holdTimeout == 0 {
+		holdTimeout = bgpConnectTimeout
+	}
+	timeout := time.NewTimer(holdTimeout)
+	defer timeout.Stop()
+	session := &bgpSession{
+		options:     a.options,
+		conn:        conn,
+		iBGP:        a.options.LocalAS == a.options.PeerAS,
+		nextHop:     a.options.NextHop,
+		nextHopIPv6: a.options.NextHopIPv6,
+	}
+	if session.nextHop == nil {
+		session.nextHop = local.To4()
+	}
+	if session.nextHopIPv6 == nil && local.To4() == nil {
+		session.nextHopIPv6 = local
+	}
+	var holdTime time.Duration
+	for opened := false; ; {
+		var message *bgpMessage
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-timeout.C:
+			return nil, 0, errors.New("BGP peer didn't open the session in time")
+		case message = <-messages:
+		}
+		if err := bgpMessageError(message); err != nil {
+			return nil, 0, err
+		}
+		switch {
+		case !opened && message.messageType == bgpOpenMessage:
+			peerHoldTime, fourOctetAS, err := a.parseOpen(conn, message.body)
+			if err != nil {
+				return nil, 0, err
+			}
+			opened, session.fourOctetAS = true, fourOctetAS
+			holdTime = a.options.HoldTime
+			if peerHoldTime < holdTime {
+				holdTime = peerHoldTime
+			}
+			if err := writeBGPMessage(conn, bgpKeepaliveMessage, nil); err != nil {
+				return nil, 0, err
+			}
+		case opened && message.messageType == bgpKeepaliveMessage:
+			return session, holdTime, nil
+		default:
+			return nil, 0, errors.Errorf("Unexpected BGP message of type %d while opening the session", message.messageType)
+		}
+	}
+}
+
+// openMessage returns OPEN message body with multiprotocol IPv4 and IPv6 unicast and four-octet AS capabilities
+func (a *BGPAnnouncer) openMessage(routerID net.IP) []byte {
+	myAS := uint16(bgpASTrans)
+	if a.options.LocalAS <= 0xffff {
+		myAS = uint16(a.options.LocalAS)
+	}
+	capabilities := []byte{
+		bgpMultiprotocolCapability, 4, 0, bgpAFIIPv4, 0, bgpSAFIUnicast,
+		bgpMultiprotocolCapability, 4, 0, bgpAFIIPv6, 0, bgpSAFIUnicast,
+		bgpFourOctetASCapability, 4,
+	}
+	capabilities = appendUint32(capabilities, a.options.LocalAS)
+
+	body := []byte{bgpVersion}
+	body = appendUint16(body, myAS)
+	body = appendUint16(body, uint16(a.options.HoldTime/time.Second))
+	body = append(body, routerID...)
+	body = append(body, byte(len(capabilities)+2), bgpCapabilitiesParameter, byte(len(capabilities)))
+	return append(body, capabilities...)
+}
+
+// parseOpen checks OPEN message body of the peer, returns its hold time and if it supports four-octet AS
+func (a *BGPAnnouncer) parseOpen(conn net.Conn, body []byte) (holdTime time.Duration, fourOctetAS bool, err error) {
+	if len(body) < 10 || len(body) < 10+int(body[9]) {
+		return 0, false, errors.New("Malformed BGP OPEN message")
+	}
+	if body[0] != bgpVersion {
+		_ = writeBGPMessage(conn, bgpNotificationMessage, []byte{bgpOpenMessageError, bgpUnsupportedVersionSubcode})
+		return 0, false, errors.Errorf("Unsupported BGP version %d of the peer", body[0])
+	}
+	peerAS := uint32(binary.BigEndian.Uint16(body[1:3]))
+	holdTime = time.Duration(binary.BigEndian.Uint16(body[3:5])) * time.Second
+	for params := body[10 : 10+int(body[9])]; len(params) >= 2 && len(params) >= 2+int(params[1]); params = params[2+int(params[1]):] {
+		if params[0] != bgpCapabilitiesParameter {
+			continue
+		}
+		for capabilities := params[2 : 2+int(params[1])]; len(capabilities) >= 2 && len(capabilities) >= 2+int(capabilities[1]); capabilities = capabilities[2+int(capabilities[1]):] {
+			if capabilities[0] == bgpFourOctetASCapability && capabilities[1] == 4 {
+				fourOctetAS = true
+				peerAS = binary.BigEndian.Uint32(capabilities[2:6])
+			}
+		}
+	}
+	if peerAS != a.options.PeerAS {
+		_ = writeBGPMessage(conn, bgpNotificationMessage, []byte{bgpOpenMessageError, bgpBadPeerASSubcode})
+		return 0, false, errors.Errorf("BGP peer AS %d differs from the configured %d", peerAS, a.options.PeerAS)
+	}
+	return holdTime, fourOctetAS, nil
+}
+
+// sync announces prefixes missing in announced ones and withdraws announced prefixes missing in prefixes
+func (s *bgpSession) sync(prefixes []string, announced map[string]bool) error {
+	desired := map[string]bool{}
+	var added, removed [2][][]byte
+	for _, prefix := range prefixes {
+		desired[prefix] = true
+		if announced[prefix] {
+			continue
+		}
+		if family, nlri, ok := s.nlri(prefix); ok {
+			added[family] = append(added[family], nlri)
+		}
+	}
+	for prefix := range announced {
+		if desired[prefix] {
+			continue
+		}
+		if family, nlri, ok := s.nlri(prefix); ok {
+			removed[family] = append(removed[family], nlri)
+		}
+	}
+
+	for family := range added {
+		for _, update := range s.updateMessages(family == 1, removed[family], added[family]) {
+			if err := writeBGPMessage(s.conn, bgpUpdateMessage, update); err != nil {
+				return err
+			}
+		}
+	}
+	for prefix := range announced {
+		delete(announced, prefix)
+	}
+	for prefix := range desired {
+		if _, _, ok := s.nlri(prefix); ok {
+			announced[prefix] = true
+		}
+	}
+	return nil
+}
+
+// nlri returns encoded NLRI of prefix with its family, 0 for IPv4 and 1 for IPv6. Prefixes of a family
+// without next hop aren't announced.
+func (s *bgpSession) nlri(prefix string) (family int, nlri []byte, ok bool) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return 0, nil, false
+	}
+	ones, _ := ipNet.Mask.Size()
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		family, ip = 1, ipNet.IP.To16()
+		if s.nextHopIPv6 == nil {
+			return 0, nil, false
+		}
+	} else if s.nextHop == nil {
+		return 0, nil, false
+	}
+	return family, append([]byte{byte(ones)}, ip[:(ones+7)/8]...), true
+}
+
+// updateMessages returns UPDATE message bodies withdrawing and announcing NLRIs of the family in chunks
+// fitting the maximal message length
+func (s *bgpSession) updateMessages(ipv6 bool, withdrawn, announced [][]byte) [][]byte {
+	var updates [][]byte
+	for len(withdrawn) > 0 {
+		chunk := withdrawn[:chunkLength(len(withdrawn))]
+		withdrawn = withdrawn[len(chunk):]
+		if ipv6 {
+			attribute := bgpAttribute(bgpOptionalFlag, bgpMPUnreachAttribute,
+				append([]byte{0, bgpAFIIPv6, bgpSAFIUnicast}, joinNLRI(chunk)...))
+			updates = append(updates, updateMessage(nil, attribute, nil))
+		} else {
+			updates = append(updates, updateMessage(joinNLRI(chunk), nil, nil))
+		}
+	}
+	for len(announced) > 0 {
+		chunk := announced[:chunkLength(len(announced))]
+		announced = announced[len(chunk):]
+		attributes := s.pathAttributes()
+		if ipv6 {
+			reach := append([]byte{0, bgpAFIIPv6, bgpSAFIUnicast, net.IPv6len}, s.nextHopIPv6.To16()...)
+			reach = append(append(reach, 0), joinNLRI(chunk)...)
+			attributes = append(bgpAttribute(bgpOptionalFlag, bgpMPReachAttribute, reach), attributes...)
+			updates = append(updates, updateMessage(nil, attributes, nil))
+		} else {
+			attributes = append(attributes, bgpAttribute(bgpTransitiveFlag, bgpNextHopAttribute, s.nextHop.To4())...)
+			updates = append(updates, updateMessage(nil, attributes, joinNLRI(chunk)))
+		}
+	}
+	return updates
+}
+
+// pathAttributes returns ORIGIN, AS_PATH, LOCAL_PREF of iBGP sessions and COMMUNITIES attributes of the
+// announced prefixes
+func (s *bgpSession) pathAttributes() []byte {
+	attributes := bgpAttribute(bgpTransitiveFlag, bgpOriginAttribute, []byte{bgpOriginIncomplete})
+	options := s.options
+	if s.iBGP {
+		attributes = append(attributes, bgpAttribute(bgpTransitiveFlag, bgpASPathAttribute, nil)...)
+		localPref := appendUint32(nil, bgpDefaultLocalPreference)
+		attributes = append(attributes, bgpAttribute(bgpTransitiveFlag, bgpLocalPrefAttribute, localPref)...)
+	} else if s.fourOctetAS {
+		asPath := appendUint32([]byte{bgpASSequence, 1}, options.LocalAS)
+		attributes = append(attributes, bgpAttribute(bgpTransitiveFlag, bgpASPathAttribute, asPath)...)
+	} else {
+		myAS := uint16(bgpASTrans)
+		if options.LocalAS <= 0xffff {
+			myAS = uint16(options.LocalAS)
+		}
+		asPath := appendUint16([]byte{bgpASSequence, 1}, myAS)
+		attributes = append(attributes, bgpAttribute(bgpTransitiveFlag, bgpASPathAttribute, asPath)...)
+		if options.LocalAS > 0xffff {
+			as4Path := appendUint32([]byte{bgpASSequence, 1}, options.LocalAS)
+			attributes = append(attributes, bgpAttribute(bgpOptionalFlag|bgpTransitiveFlag, bgpAS4PathAttribute, as4Path)...)
+		}
+	}
+	if len(options.Communities) > 0 {
+		var communities []byte
+		for _, community := range options.Communities {
+			communities = appendUint32(communities, community)
+		}
+		attributes = append(attributes, bgpAttribute(bgpOptionalFlag|bgpTransitiveFlag, bgpCommunitiesAttribute, communities)...)
+	}
+	return attributes
+}
+
+// bgpAttribute returns encoded path attribute, long values are encoded with extended length
+func bgpAttribute(flags, attributeType byte, value []byte) []byte {
+	if len(value) > 0xff {
+		attribute := []byte{flags | bgpExtendedLengthFlag, attributeType}
+		return append(appendUint16(attribute, uint16(len(value))), value...)
+	}
+	return append([]byte{flags, attributeType, byte(len(value))}, value...)
+}
+
+// updateMessage returns UPDATE message body of IPv4 withdrawn routes, path attributes and IPv4 NLRI
+func updateMessage(withdrawn, attributes, nlri []byte) []byte {
+	body := appendUint16(nil, uint16(len(withdrawn)))
+	body = append(body, withdrawn...)
+	body = appendUint16(body, uint16(len(attributes)))
+	body = append(body, attributes...)
+	return append(body, nlri...)
+}
+
+// chunkLength returns number of NLRIs of the next UPDATE message of length ones
+func chunkLength(length int) int {
+	if length > bgpPrefixesPerUpdate {
+		return bgpPrefixesPerUpdate
+	}
+	return length
+}
+
+// appendUint16 and appendUint32 append big-endian encoded value to data
+func appendUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value))
+}
+
+func appendUint32(data []byte, value uint32) []byte {
+	return append(data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+// joinNLRI returns concatenated encoded NLRIs
+func joinNLRI(nlris [][]byte) []byte {
+	var joined []byte
+	for _, nlri := range nlris {
+		joined = append(joined, nlri...)
+	}
+	return joined
+}
+
+// writeBGPMessage writes BGP message of type with body, peers not reading messages fail the write in connect timeout
+func writeBGPMessage(conn net.Conn, messageType byte, body []byte) error {
+	message := make([]byte, 16, bgpMessageHeaderLength+len(body))
+	for i := range message {
+		message[i] = 0xff
+	}
+	message = appendUint16(message, uint16(bgpMessageHeaderLength+len(body)))
+	message = append(append(message, messageType), body...)
+	_ = conn.SetWriteDeadline(time.Now().Add(bgpConnectTimeout))
+	_, err := conn.Write(message)
+	return errors.Wrap(err, "Failed to write BGP message")
+}
+
+// readBGPMessages sends BGP messages read from conn to messages until a read fails or done is closed
+func readBGPMessages(conn net.Conn, messages chan<- *bgpMessage, done <-chan struct{}) {
+	for {
+		message := &bgpMessage{}
+		header := make([]byte, bgpMessageHeaderLength)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			message.err = errors.Wrap(err, "Failed to read BGP message")
+		} else if length := int(binary.BigEndian.Uint16(header[16:18])); length < bgpMessageHeaderLength || length > bgpMaxMessageLength {
+			message.err = errors.Errorf("Wrong BGP message length %d", length)
+		} else {
+			message.messageType = header[18]
+			message.body = make([]byte, length-bgpMessageHeaderLength)
+			if _, err := io.ReadFull(conn, message.body); err != nil {
+				message.err = errors.Wrap(err, "Failed to read BGP message")
+			}
+		}
+		select {
+		case messages <- message:
+		case <-done:
+			return
+		}
+		if message.err != nil {
+			return
+		}
+	}
+}
+
+// bgpMessageError returns error of message failed to be read or NOTIFICATION message of the peer
+func bgpMessageError(message *bgpMessage) error {
+	switch {
+	case message.err != nil:
+		return message.err
+	case message.messageType == bgpNotificationMessage && len(message.body) >= 2:
+		return errors.Errorf("BGP peer closed the session with error code %d, subcode %d", message.body[0], message.body[1])
+	case message.messageType == bgpNotificationMessage:
+		return errors.New("BGP peer closed the session")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// birdConfig is BIRD 2 config of passive eBGP session of AS 65000 with the announcer of AS 4200000001,
+// direct routes of the loopback resolve next hops of the announced prefixes
+const birdConfig = `router id 10.0.0.2;
+log stderr all;
+protocol device {}
+protocol direct {
+	ipv4;
+	ipv6;
+	interface "lo";
+}
+protocol bgp collector {
+	local 127.0.0.1 port %d as 65000;
+	neighbor 127.0.0.1 as 4200000001;
+	passive on;
+	multihop;
+	hold time 9;
+	ipv4 { import all; export none; };
+	ipv6 { import all; export none; };
+}
+`
+
+// TestBGPAnnouncerBIRDInterop checks the prefixes are announced to and withdrawn from BIRD 2 router,
+// it is skipped if bird and birdc aren't installed
+func TestBGPAnnouncerBIRDInterop(t *testing.T) {
+	bird, err := exec.LookPath("bird")
+	if err != nil {
+		t.Skip("BIRD isn't installed")
+	}
+	birdc, err := exec.LookPath("birdc")
+	if err != nil {
+		t.Skip("BIRD client isn't installed")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "bird.conf")
+	socketPath := filepath.Join(dir, "bird.ctl")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(fmt.Sprintf(birdConfig, port)), 0600))
+	router := exec.Command(bird, "-f", "-c", configPath, "-s", socketPath) // #nosec
+	router.Stderr = os.Stderr
+	require.NoError(t, router.Start())
+	defer func() {
+		_ = router.Process.Kill()
+		_ = router.Wait()
+	}()
+
+	show := func(args ...string) string {
+		output, _ := exec.Command(birdc, append([]string{"-s", socketPath}, args...)...).CombinedOutput() // #nosec
+		return string(output)
+	}
+	require.Eventually(t, func() bool { return strings.Contains(show("show", "status"), "Daemon is up") },
+		5*time.Second, 50*time.Millisecond)
+
+	blackhole, err := prefixcollector.ParseBGPCommunity(prefixcollector.BGPBlackholeCommunity)
+	require.NoError(t, err)
+	announcer, err := prefixcollector.NewBGPAnnouncer(&prefixcollector.BGPOptions{
+		PeerAddress: fmt.Sprintf("127.0.0.1:%d", port),
+		LocalAS:     4200000001,
+		PeerAS:      65000,
+		NextHopIPv6: net.ParseIP("::1"),
+		Communities: []uint32{blackhole},
+		HoldTime:    9 * time.Second,
+	})
+	require.NoError(t, err)
+	announcer.Announce([]string{"10.96.0.0/12", "fd00:96::/64"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		announcer.Serve(ctx)
+	}()
+
+	routes := func() string { return show("show", "route", "all", "protocol", "collector") }
+	require.Eventually(t, func() bool {
+		output := routes()
+		return strings.Contains(output, "10.96.0.0/12") && strings.Contains(output, "fd00:96::/64") &&
+			strings.Contains(output, "(65535,666)") && strings.Contains(output, "4200000001")
+	}, 10*time.Second, 100*time.Millisecond, "routes of BIRD: %s", routes())
+
+	announcer.Announce([]string{"fd00:96::/64"})
+	require.Eventually(t, func() bool {
+		output := routes()
+		return !strings.Contains(output, "10.96.0.0/12") && strings.Contains(output, "fd00:96::/64")
+	}, 10*time.Second, 100*time.Millisecond, "routes of BIRD: %s", routes())
+
+	// the router withdraws the prefixes of the closed session
+	cancel()
+	<-served
+	require.Eventually(t, func() bool { return !strings.Contains(routes(), "fd00:96::/64") },
+		10*time.Second, 100*time.Millisecond)
+}
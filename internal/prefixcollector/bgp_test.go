@@ -0,0 +1,129 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// readBGPMessage reads BGP message from conn and returns its type and body
+func readBGPMessage(t *testing.T, conn net.Conn) (messageType byte, body []byte) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	header := make([]byte, 19)
+	_, err := io.ReadFull(conn, header)
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte{0xff}, 16), header[:16])
+	body = make([]byte, int(binary.BigEndian.Uint16(header[16:18]))-len(header))
+	_, err = io.ReadFull(conn, body)
+	require.NoError(t, err)
+	return header[18], body
+}
+
+// writeBGPMessage writes BGP message of type with body to conn
+func writeBGPMessage(t *testing.T, conn net.Conn, messageType byte, body []byte) {
+	message := append(bytes.Repeat([]byte{0xff}, 16), byte(0), byte(19+len(body)), messageType)
+	_, err := conn.Write(append(message, body...))
+	require.NoError(t, err)
+}
+
+func TestParseBGPCommunity(t *testing.T) {
+	community, err := prefixcollector.ParseBGPCommunity(prefixcollector.BGPBlackholeCommunity)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xffff029a), community)
+
+	for _, value := range []string{"65535", "65536:1", "1:65536", "a:b"} {
+		_, err := prefixcollector.ParseBGPCommunity(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestBGPAnnouncer(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	blackhole, err := prefixcollector.ParseBGPCommunity(prefixcollector.BGPBlackholeCommunity)
+	require.NoError(t, err)
+	announcer, err := prefixcollector.NewBGPAnnouncer(&prefixcollector.BGPOptions{
+		PeerAddress: listener.Addr().String(),
+		LocalAS:     4200000001,
+		PeerAS:      65000,
+		NextHopIPv6: net.ParseIP("fd00::1"),
+		Communities: []uint32{blackhole},
+		HoldTime:    9 * time.Second,
+	})
+	require.NoError(t, err)
+	announcer.Announce([]string{"10.96.0.0/12", "fd00:96::/64"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		announcer.Serve(ctx)
+	}()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// AS_TRANS is sent as 2-octet AS, the local AS is sent in four-octet AS capability
+	messageType, open := readBGPMessage(t, conn)
+	require.Equal(t, byte(1), messageType)
+	require.Equal(t, []byte{4, 0x5b, 0xa0, 0, 9, 127, 0, 0, 1}, open[:9])
+	require.True(t, bytes.Contains(open, []byte{65, 4, 0xfa, 0x56, 0xea, 0x01}))
+
+	writeBGPMessage(t, conn, 1, []byte{4, 0xfd, 0xe8, 0, 30, 10, 0, 0, 2, 8, 2, 6, 65, 4, 0, 0, 0xfd, 0xe8})
+	writeBGPMessage(t, conn, 4, nil)
+	messageType, _ = readBGPMessage(t, conn)
+	require.Equal(t, byte(4), messageType)
+
+	messageType, update := readBGPMessage(t, conn)
+	require.Equal(t, byte(2), messageType)
+	require.True(t, bytes.HasSuffix(update, []byte{3, 4, 127, 0, 0, 1, 12, 10, 96}), update)
+	require.True(t, bytes.Contains(update, []byte{2, 6, 2, 1, 0xfa, 0x56, 0xea, 0x01}), "AS path %v", update)
+	require.True(t, bytes.Contains(update, []byte{0xc0, 8, 4, 0xff, 0xff, 0x02, 0x9a}), "communities %v", update)
+
+	messageType, update = readBGPMessage(t, conn)
+	require.Equal(t, byte(2), messageType)
+	mpReach := append([]byte{0x80, 14, 30, 0, 2, 1, 16}, net.ParseIP("fd00::1")...)
+	mpReach = append(mpReach, 0, 64, 0xfd, 0, 0, 0x96, 0, 0, 0, 0)
+	require.True(t, bytes.Contains(update, mpReach), update)
+
+	announcer.Announce([]string{"fd00:96::/64"})
+	messageType, update = readBGPMessage(t, conn)
+	require.Equal(t, byte(2), messageType)
+	require.Equal(t, []byte{0, 3, 12, 10, 96, 0, 0}, update)
+
+	cancel()
+	messageType, notification := readBGPMessage(t, conn)
+	require.Equal(t, byte(3), messageType)
+	require.Equal(t, []byte{6, 0}, notification)
+	<-served
+}
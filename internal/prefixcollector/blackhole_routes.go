@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BlackholeRouteType is type of the routes silently dropping packets to the excluded prefixes
+	BlackholeRouteType = "blackhole"
+	// UnreachableRouteType is type of the routes rejecting packets to the excluded prefixes with ICMP unreachable
+	UnreachableRouteType = "unreachable"
+	// DefaultBlackholeRouteTable is main routing table of the node
+	DefaultBlackholeRouteTable = 254
+)
+
+// BlackholeRoutesOptions are options of the node routes of the excluded prefixes
+type BlackholeRoutesOptions struct {
+	// Type is BlackholeRouteType or UnreachableRouteType
+	Type  string
+	Table uint32
+	// Metric of the routes, routes of the same prefixes with lower metric are preferred to them
+	Metric uint32
+	// Ranges limit the routed prefixes to the ones covered by them, all the prefixes are routed if empty
+	Ranges []string
+}
+
+// BlackholeRoutes installs blackhole or unreachable routes of the excluded prefixes on the node, so the node
+// enforces the exclusions. Routes are owned by a dedicated route protocol, routes of the prefixes which are
+// not excluded anymore are removed on every sync.
+type BlackholeRoutes struct {
+	options *BlackholeRoutesOptions
+	mutex   sync.Mutex
+}
+
+// NewBlackholeRoutes creates BlackholeRoutes with options
+func NewBlackholeRoutes(options *BlackholeRoutesOptions) (*BlackholeRoutes, error) {
+	if options.Type != BlackholeRouteType && options.Type != UnreachableRouteType {
+		return nil, errors.Errorf("Route type %q should be %s or %s", options.Type, BlackholeRouteType, UnreachableRouteType)
+	}
+	if options.Table == 0 {
+		return nil, errors.New("Routing table of blackhole routes should be set")
+	}
+	for _, prefix := range options.Ranges {
+		if _, _, err := net.ParseCIDR(prefix); err != nil {
+			return nil, errors.Wrapf(err, "Wrong blackhole routes range %q", prefix)
+		}
+	}
+	return &BlackholeRoutes{options: options}, nil
+}
+
+// Sync installs routes of prefixes covered by the ranges and removes the other routes owned by it
+func (r *BlackholeRoutes) Sync(prefixes []string) error {
+	var networks []*net.IPNet
+	for _, prefix := range prefixes {
+		if len(r.options.Ranges) > 0 && !utils.CoveredBy(prefix, r.options.Ranges) {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to parse excluded prefix %q", prefix)
+		}
+		networks = append(networks, ipNet)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return syncBlackholeRoutes(networks, r.options)
+}
+
+// Flush removes all the routes owned by it
+func (r *BlackholeRoutes) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return syncBlackholeRoutes(nil, r.options)
+}
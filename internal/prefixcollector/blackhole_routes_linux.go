@@ -0,0 +1,256 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// blackholeRouteProtocol is route protocol of the routes installed by BlackholeRoutes, routes of the other
+// protocols are never changed
+const blackholeRouteProtocol = 78
+
+var blackholeRouteTypes = map[string]uint8{
+	BlackholeRouteType:   syscall.RTN_BLACKHOLE,
+	UnreachableRouteType: syscall.RTN_UNREACHABLE,
+}
+
+// blackholeRoute is route of a prefix owned by BlackholeRoutes
+type blackholeRoute struct {
+	dst       *net.IPNet
+	table     uint32
+	metric    uint32
+	routeType uint8
+}
+
+// syncBlackholeRoutes installs routes of networks missing in the options table and removes the other owned
+// routes of the table with netlink
+func syncBlackholeRoutes(networks []*net.IPNet, options *BlackholeRoutesOptions) error {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return errors.Wrap(err, "Failed to dump host routes")
+	}
+	owned, err := parseBlackholeRoutes(data, options.Table)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]*blackholeRoute{}
+	for _, network := range networks {
+		desired[network.String()] = &blackholeRoute{
+			dst:       network,
+			table:     options.Table,
+			metric:    options.Metric,
+			routeType: blackholeRouteTypes[options.Type],
+		}
+	}
+
+	var removed, added []*blackholeRoute
+	for _, route := range owned {
+		if want, ok := desired[route.dst.String()]; ok && want.equal(route) {
+			delete(desired, route.dst.String())
+			continue
+		}
+		removed = append(removed, route)
+	}
+	for _, route := range desired {
+		added = append(added, route)
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	conn, err := dialNetlink(syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Close(conn) }()
+
+	var failed []string
+	for i, route := range removed {
+		if err := requestNetlink(conn, routeMessage(syscall.RTM_DELROUTE, 0, uint32(i+1), route), uint32(i+1)); err != nil {
+			failed = append(failed, fmt.Sprintf("remove %s: %v", route.dst, err))
+		}
+	}
+	for i, route := range added {
+		flags := uint16(syscall.NLM_F_CREATE | syscall.NLM_F_EXCL)
+		seq := uint32(len(removed) + i + 1)
+		if err := requestNetlink(conn, routeMessage(syscall.RTM_NEWROUTE, flags, seq, route), seq); err != nil {
+			failed = append(failed, fmt.Sprintf("add %s: %v", route.dst, err))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.Errorf("Failed to sync %d of %d blackhole routes: %s", len(failed), len(removed)+len(added),
+			strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// equal returns true if routes have the same destination, table, metric and type
+func (r *blackholeRoute) equal(other *blackholeRoute) bool {
+	return r.dst.String() == other.dst.String() && r.table == other.table && r.metric == other.metric &&
+		r.routeType == other.routeType
+}
+
+// parseBlackholeRoutes parses netlink RTM_NEWROUTE messages of the routes of table owned by BlackholeRoutes.
+// Netlink attributes are in host byte order.
+func parseBlackholeRoutes(data []byte, table uint32) ([]*blackholeRoute, error) {
+	messages, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse netlink messages")
+	}
+
+	var routes []*blackholeRoute
+	for i := range messages {
+		message := &messages[i]
+		if message.Header.Type != syscall.RTM_NEWROUTE || len(message.Data) < syscall.SizeofRtMsg ||
+			message.Data[5] != blackholeRouteProtocol {
+			continue
+		}
+		family, dstLen := message.Data[0], int(message.Data[1])
+		route := &blackholeRoute{table: uint32(message.Data[4]), routeType: message.Data[7]}
+
+		attributes, err := syscall.ParseNetlinkRouteAttr(message)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse netlink route attributes")
+		}
+		dst := net.IPv4zero.To4()
+		bits := 8 * net.IPv4len
+		if family == syscall.AF_INET6 {
+			dst, bits = net.IPv6zero, 8*net.IPv6len
+		}
+		for _, attribute := range attributes {
+			switch attribute.Attr.Type {
+			case syscall.RTA_DST:
+				dst = attribute.Value
+			case syscall.RTA_TABLE:
+				route.table = utils.NativeEndian.Uint32(attribute.Value)
+			case syscall.RTA_PRIORITY:
+				route.metric = utils.NativeEndian.Uint32(attribute.Value)
+			}
+		}
+		if route.table != table {
+			continue
+		}
+		route.dst = &net.IPNet{IP: net.IP(dst), Mask: net.CIDRMask(dstLen, bits)}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routeMessage returns netlink request message of msgType with flags changing route
+func routeMessage(msgType, flags uint16, seq uint32, route *blackholeRoute) []byte {
+	family, dst := uint8(syscall.AF_INET), route.dst.IP.To4()
+	if dst == nil {
+		family, dst = syscall.AF_INET6, route.dst.IP.To16()
+	}
+	ones, _ := route.dst.Mask.Size()
+	table := uint8(syscall.RT_TABLE_UNSPEC)
+	if route.table < 256 {
+		table = uint8(route.table)
+	}
+
+	message := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+syscall.SizeofRtMsg+3*syscall.SizeofRtAttr+24)
+	message = append(message, family, uint8(ones), 0, 0, table, blackholeRouteProtocol, syscall.RT_SCOPE_UNIVERSE,
+		route.routeType, 0, 0, 0, 0)
+	message = appendNetlinkAttribute(message, syscall.RTA_DST, dst)
+	message = appendNetlinkAttribute(message, syscall.RTA_TABLE, nativeUint32(route.table))
+	message = appendNetlinkAttribute(message, syscall.RTA_PRIORITY, nativeUint32(route.metric))
+
+	utils.NativeEndian.PutUint32(message[0:4], uint32(len(message)))
+	utils.NativeEndian.PutUint16(message[4:6], msgType)
+	utils.NativeEndian.PutUint16(message[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|flags)
+	utils.NativeEndian.PutUint32(message[8:12], seq)
+	return message
+}
+
+// appendNetlinkAttribute appends netlink attribute of attributeType to message padded to 4 bytes
+func appendNetlinkAttribute(message []byte, attributeType uint16, value []byte) []byte {
+	header := make([]byte, syscall.SizeofRtAttr)
+	utils.NativeEndian.PutUint16(header[0:2], uint16(syscall.SizeofRtAttr+len(value)))
+	utils.NativeEndian.PutUint16(header[2:4], attributeType)
+	message = append(append(message, header...), value...)
+	for len(message)%syscall.RTA_ALIGNTO != 0 {
+		message = append(message, 0)
+	}
+	return message
+}
+
+func nativeUint32(value uint32) []byte {
+	data := make([]byte, 4)
+	utils.NativeEndian.PutUint32(data, value)
+	return data
+}
+
+// dialNetlink opens netlink socket of protocol
+func dialNetlink(protocol int) (int, error) {
+	conn, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to open netlink socket")
+	}
+	if err := syscall.Bind(conn, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		_ = syscall.Close(conn)
+		return 0, errors.Wrap(err, "Failed to bind netlink socket")
+	}
+	return conn, nil
+}
+
+// requestNetlink sends messages to the kernel and waits for acknowledgements of the messages of seqs, returns
+// the first error reported by them
+func requestNetlink(conn int, messages []byte, seqs ...uint32) error {
+	if err := syscall.Sendto(conn, messages, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+	pending := make(map[uint32]struct{}, len(seqs))
+	for _, seq := range seqs {
+		pending[seq] = struct{}{}
+	}
+	var ackErr error
+	buffer := make([]byte, 1<<16)
+	for len(pending) > 0 {
+		n, _, err := syscall.Recvfrom(conn, buffer, 0)
+		if err != nil {
+			return err
+		}
+		replies, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return err
+		}
+		for i := range replies {
+			if _, ok := pending[replies[i].Header.Seq]; !ok || replies[i].Header.Type != syscall.NLMSG_ERROR ||
+				len(replies[i].Data) < 4 {
+				continue
+			}
+			delete(pending, replies[i].Header.Seq)
+			if code := int32(utils.NativeEndian.Uint32(replies[i].Data[0:4])); code != 0 && ackErr == nil {
+				ackErr = syscall.Errno(-code)
+			}
+		}
+	}
+	return ackErr
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixcollector
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlackholeRouteMessages(t *testing.T) {
+	route := func(prefix string, table, metric uint32, routeType uint8) *blackholeRoute {
+		_, dst, err := net.ParseCIDR(prefix)
+		require.NoError(t, err)
+		return &blackholeRoute{dst: dst, table: table, metric: metric, routeType: routeType}
+	}
+	routes := []*blackholeRoute{
+		route("10.96.0.0/12", DefaultBlackholeRouteTable, 4096, syscall.RTN_BLACKHOLE),
+		route("fd00::/64", DefaultBlackholeRouteTable, 4096, syscall.RTN_UNREACHABLE),
+		route("10.244.0.0/16", 1000, 0, syscall.RTN_BLACKHOLE),
+	}
+	var data []byte
+	for i, r := range routes {
+		data = append(data, routeMessage(syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE, uint32(i), r)...)
+	}
+	// routes of the other protocols aren't owned
+	foreign := routeMessage(syscall.RTM_NEWROUTE, 0, 3, route("192.168.0.0/16", DefaultBlackholeRouteTable, 0, syscall.RTN_BLACKHOLE))
+	foreign[syscall.NLMSG_HDRLEN+5] = syscall.RTPROT_STATIC
+	data = append(data, foreign...)
+
+	parsed, err := parseBlackholeRoutes(data, DefaultBlackholeRouteTable)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	require.True(t, parsed[0].equal(routes[0]), parsed[0].dst.String())
+	require.True(t, parsed[1].equal(routes[1]), parsed[1].dst.String())
+
+	// tables not fitting rtmsg are set by attribute only
+	parsed, err = parseBlackholeRoutes(data, 1000)
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	require.True(t, parsed[0].equal(routes[2]), parsed[0].dst.String())
+}
+
+func TestNewBlackholeRoutes(t *testing.T) {
+	_, err := NewBlackholeRoutes(&BlackholeRoutesOptions{Type: BlackholeRouteType, Table: DefaultBlackholeRouteTable,
+		Ranges: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+	_, err = NewBlackholeRoutes(&BlackholeRoutesOptions{Type: "prohibit", Table: DefaultBlackholeRouteTable})
+	require.Error(t, err)
+	_, err = NewBlackholeRoutes(&BlackholeRoutesOptions{Type: UnreachableRouteType})
+	require.Error(t, err)
+	_, err = NewBlackholeRoutes(&BlackholeRoutesOptions{Type: UnreachableRouteType, Table: 1, Ranges: []string{"10.0.0.0"}})
+	require.Error(t, err)
+}
+
+func TestBlackholeRoutesSync(t *testing.T) {
+	var routes [][]*blackholeRoute
+	var errs []error
+	inNetworkNamespace(t, func() {
+		blackholeRoutes, err := NewBlackholeRoutes(&BlackholeRoutesOptions{Type: UnreachableRouteType,
+			Table: DefaultBlackholeRouteTable, Metric: 4096, Ranges: []string{"198.18.0.0/15", "2001:db8::/32"}})
+		errs = append(errs, err)
+		dump := func() {
+			data, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+			errs = append(errs, err)
+			parsed, err := parseBlackholeRoutes(data, DefaultBlackholeRouteTable)
+			errs = append(errs, err)
+			routes = append(routes, parsed)
+		}
+		errs = append(errs, blackholeRoutes.Sync([]string{"198.18.0.0/24", "198.19.0.0/16", "10.0.0.0/8", "2001:db8:1::/64"}))
+		dump()
+		errs = append(errs, blackholeRoutes.Sync([]string{"198.18.0.0/24"}))
+		dump()
+		errs = append(errs, blackholeRoutes.Flush())
+		dump()
+	})
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	prefixes := func(routes []*blackholeRoute) []string {
+		var result []string
+		for _, route := range routes {
+			require.Equal(t, uint8(syscall.RTN_UNREACHABLE), route.routeType)
+			require.Equal(t, uint32(4096), route.metric)
+			result = append(result, route.dst.String())
+		}
+		return result
+	}
+	require.Len(t, routes, 3)
+	require.ElementsMatch(t, []string{"198.18.0.0/24", "198.19.0.0/16", "2001:db8:1::/64"}, prefixes(routes[0]))
+	require.Equal(t, []string{"198.18.0.0/24"}, prefixes(routes[1]))
+	require.Empty(t, routes[2])
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package prefixcollector
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// syncBlackholeRoutes is not supported on this platform
+func syncBlackholeRoutes(_ []*net.IPNet, _ *BlackholeRoutesOptions) error {
+	return errors.New("Blackhole routes are supported only on Linux")
+}
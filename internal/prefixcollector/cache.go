@@ -0,0 +1,165 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// sourceCache persists the last prefixes of the sources to file and serves them for the sources,
+// which haven't provided own prefixes since start, e.g. while Kubernetes API is unreachable
+type sourceCache struct {
+	filePath string
+	cached   map[string][]string
+	// live are names of the sources, which provided own prefixes since start
+	live   map[string]bool
+	stored map[string][]string
+}
+
+// sourceCacheFile is content of the source cache file
+type sourceCacheFile struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Sources   map[string][]string `json:"sources"`
+}
+
+// WithSourceCache is ExcludedPrefixCollector option, which persists the last prefixes of the sources to filePath
+// and loads them on start. Cached prefixes of the source are used until it is refreshed or provides prefixes,
+// the output is reported stale meanwhile.
+func WithSourceCache(filePath string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.sourceCache = &sourceCache{
+			filePath: filePath,
+			cached:   loadSourceCache(filePath),
+			live:     map[string]bool{},
+		}
+	}
+}
+
+// loadSourceCache returns prefixes of the sources cached in filePath, missing or broken cache is empty
+func loadSourceCache(filePath string) map[string][]string {
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if os.IsNotExist(err) {
+		return map[string][]string{}
+	}
+	var file sourceCacheFile
+	if err == nil {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		logrus.Warnf("Ignoring source cache %s: %v", filePath, err)
+		return map[string][]string{}
+	}
+	logrus.Infof("Loaded prefixes of %d sources cached at %v", len(file.Sources), file.Timestamp)
+	return file.Sources
+}
+
+// prefixes returns prefixes of the source name, which are cached ones until the source is refreshed
+// or provides own prefixes. Returns true if the prefixes are cached.
+func (c *sourceCache) prefixes(name string, prefixes []string, refreshTimes *utils.RefreshTimes) ([]string, bool) {
+	if c == nil || c.live[name] {
+		return prefixes, false
+	}
+	if len(prefixes) > 0 || !refreshTimes.Load(name).IsZero() {
+		c.live[name] = true
+		return prefixes, false
+	}
+	if cached, ok := c.cached[name]; ok {
+		return cached, true
+	}
+	return prefixes, false
+}
+
+// store persists prefixes of the sources if they are changed since the last store
+func (c *sourceCache) store(sourcePrefixes map[string][]string) {
+	if c == nil || sourcePrefixesEqual(c.stored, sourcePrefixes) {
+		return
+	}
+	data, err := json.Marshal(&sourceCacheFile{Timestamp: time.Now().UTC(), Sources: sourcePrefixes})
+	if err == nil {
+		err = writeFileAtomically(c.filePath, data)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to store source cache: %v", err)
+		return
+	}
+	c.stored = sourcePrefixes
+}
+
+// writeFileAtomically replaces file with data, so the file is never read partially written
+func writeFileAtomically(filePath string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create temporary file of %s", filePath)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	if _, err = tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrapf(err, "Failed to write %s", tmpFile.Name())
+	}
+	if err = tmpFile.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write %s", tmpFile.Name())
+	}
+	return errors.Wrapf(os.Rename(tmpFile.Name(), filePath), "Failed to replace %s", filePath)
+}
+
+func sourcePrefixesEqual(x, y map[string][]string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for name, prefixes := range x {
+		other, ok := y[name]
+		if !ok || !utils.UnorderedSlicesEquals(prefixes, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateCachedSources reports status if names of the sources using cached prefixes are changed
+func (epc *ExcludedPrefixCollector) updateCachedSources(ctx context.Context, names []string) {
+	if utils.UnorderedSlicesEquals(names, epc.status.CachedSources) {
+		return
+	}
+	if len(names) > 0 {
+		logrus.Warnf("Using cached prefixes for sources: %v", names)
+	} else {
+		logrus.Info("All the sources provide own prefixes, source cache isn't used anymore")
+	}
+	epc.status.CachedSources = names
+	epc.reportStatus(ctx)
+}
+
+// sortedNames returns sorted names of the sources
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestSourceCache(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	cachePath := filepath.Join(t.TempDir(), "sources.json")
+	cacheData, err := json.Marshal(map[string]interface{}{
+		"sources": map[string][]string{prefixcollector.SourceName(source): {"10.0.0.0/8"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(cachePath, cacheData, 0600))
+
+	output := utils.NewSynchronizedPrefixesContainer()
+	notifyChan := make(chan struct{}, 1)
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			output.Store(prefixes)
+			return nil
+		}),
+		prefixcollector.WithSourceCache(cachePath),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		return utils.UnorderedSlicesEquals(output.Load(), []string{"10.0.0.0/8"})
+	}, time.Second, 10*time.Millisecond)
+
+	source.Store([]string{"10.96.0.0/12"})
+	notifyChan <- struct{}{}
+	require.Eventually(t, func() bool {
+		return utils.UnorderedSlicesEquals(output.Load(), []string{"10.96.0.0/12"})
+	}, time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		data, err := ioutil.ReadFile(filepath.Clean(cachePath))
+		if err != nil {
+			return false
+		}
+		var cache struct {
+			Sources map[string][]string `json:"sources"`
+		}
+		return json.Unmarshal(data, &cache) == nil &&
+			utils.UnorderedSlicesEquals(cache.Sources[prefixcollector.SourceName(source)], []string{"10.96.0.0/12"})
+	}, time.Second, 10*time.Millisecond)
+}
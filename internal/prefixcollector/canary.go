@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// canaryOutput writes every new prefixes set to the shadow config map and holds it from the output
+// until it stays unchanged for soak time
+type canaryOutput struct {
+	write    writePrefixesFunc
+	soakTime time.Duration
+	prefixes []string
+	written  bool
+	since    time.Time
+	timer    *time.Timer
+	// soaked is notified when soak time of the shadow prefixes may have passed
+	soaked chan struct{}
+}
+
+// WithCanary is ExcludedPrefixCollector option, which publishes new prefixes of configMap output to shadow
+// config map name in namespace first. Prefixes are promoted to the output after they stay unchanged for soakTime,
+// so transient data of flapping sources doesn't reach forwarders.
+func WithCanary(name, namespace string, soakTime time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.canary = &canaryOutput{
+			write:    shadowConfigMapWriter(name, namespace, &collector.configMapOutput),
+			soakTime: soakTime,
+			soaked:   make(chan struct{}, 1),
+		}
+	}
+}
+
+// hold writes prefixes to the shadow config map if they differ from the shadow ones.
+// Returns true if the prefixes haven't soaked yet and shouldn't be written to the output.
+func (c *canaryOutput) hold(ctx context.Context, prefixes []string) bool {
+	if c == nil {
+		return false
+	}
+	if c.written && utils.UnorderedSlicesEquals(prefixes, c.prefixes) {
+		return time.Since(c.since) < c.soakTime
+	}
+
+	if err := c.write(ctx, prefixes); err != nil {
+		c.written = false
+		logrus.Errorf("Failed to write canary prefixes: %v", err)
+		return true
+	}
+	c.prefixes, c.since, c.written = prefixes, time.Now(), true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(c.soakTime, func() {
+		select {
+		case c.soaked <- struct{}{}:
+		default:
+		}
+	})
+	logrus.Infof("Canary prefixes are written, promoting them after %v without changes: %v", c.soakTime, prefixes)
+	return true
+}
+
+// soakedChan returns channel notified when soak time of the shadow prefixes may have passed
+func (c *canaryOutput) soakedChan() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.soaked
+}
+
+// stop stops soak timer
+func (c *canaryOutput) stop() {
+	if c != nil && c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// shadowConfigMapWriter - creates writePrefixesFunc writing shadow config map in the output format,
+// the shadow config map is created if it doesn't exist
+func shadowConfigMapWriter(configMapName, configMapNamespace string, output *configMapOutput) writePrefixesFunc {
+	return func(ctx context.Context, newPrefixes []string) error {
+		configMapInterface := KubernetesInterface(ctx).
+			CoreV1().
+			ConfigMaps(configMapNamespace)
+
+		span := spanhelper.FromContext(ctx, "Update excluded prefixes shadow config map")
+		defer span.Finish()
+
+		configMap, err := configMapInterface.Get(ctx, configMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap, err = configMapInterface.Create(ctx, &apiV1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: configMapName},
+			}, metav1.CreateOptions{})
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get shadow ConfigMap '%s/%s'", configMapNamespace, configMapName)
+		}
+		return updateConfigMap(ctx, newPrefixes, configMap, configMapInterface, output)
+	}
+}
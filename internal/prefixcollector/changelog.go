@@ -0,0 +1,218 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ChangelogPath is HTTP API path streaming the excluded prefixes changes as Server-Sent Events
+	ChangelogPath = "/changelog"
+	// ChangelogEventType is type of the Server-Sent Events carrying ChangelogEntry
+	ChangelogEventType = "prefixes-change"
+
+	changelogKeepAlive = 30 * time.Second
+)
+
+// ChangelogEntry is excluded prefixes change with hashes of the prefixes before and after it
+type ChangelogEntry struct {
+	PrefixesChange
+	Sequence     uint64 `json:"sequence"`
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previousHash"`
+}
+
+// Changelog keeps the latest excluded prefixes changes and streams them to the subscribers
+type Changelog struct {
+	mutex       sync.Mutex
+	size        int
+	prefixes    prefixSet
+	entries     []*ChangelogEntry
+	sequence    uint64
+	subscribers map[chan *ChangelogEntry]struct{}
+}
+
+// NewChangelog creates Changelog keeping size latest changes, subscribers resume from them after reconnect
+func NewChangelog(size int) *Changelog {
+	return &Changelog{
+		size:        size,
+		prefixes:    prefixSet{},
+		subscribers: map[chan *ChangelogEntry]struct{}{},
+	}
+}
+
+// WithChangelog is ExcludedPrefixCollector option, which appends every prefixes change to changelog
+func WithChangelog(changelog *Changelog) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.changeHandlers = append(collector.changeHandlers, func(_ context.Context, change *PrefixesChange) {
+			changelog.Append(change)
+		})
+	}
+}
+
+// Append appends change to the changelog and sends it to the subscribers. Subscribers not keeping up with
+// the changes are disconnected, so they resume from the kept changes.
+func (c *Changelog) Append(change *PrefixesChange) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sequence++
+	entry := &ChangelogEntry{PrefixesChange: *change, Sequence: c.sequence, PreviousHash: PrefixesHash(c.prefixes.sorted())}
+	c.prefixes.apply(change)
+	entry.Hash = PrefixesHash(c.prefixes.sorted())
+
+	c.entries = append(c.entries, entry)
+	if len(c.entries) > c.size {
+		c.entries = c.entries[len(c.entries)-c.size:]
+	}
+	for subscriber := range c.subscribers {
+		select {
+		case subscriber <- entry:
+		default:
+			delete(c.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// prefixSet is set of the prefixes tracked by applying the prefixes changes
+type prefixSet map[string]struct{}
+
+// apply removes and adds prefixes of change to the set
+func (s prefixSet) apply(change *PrefixesChange) {
+	for _, prefix := range change.Removed {
+		delete(s, prefix)
+	}
+	for _, prefix := range change.Added {
+		s[prefix] = struct{}{}
+	}
+}
+
+// sorted returns sorted prefixes of the set
+func (s prefixSet) sorted() []string {
+	prefixes := make([]string, 0, len(s))
+	for prefix := range s {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// subscribe returns kept changes following the one with after sequence and channel receiving the next ones
+func (c *Changelog) subscribe(after uint64) ([]*ChangelogEntry, chan *ChangelogEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var entries []*ChangelogEntry
+	for _, entry := range c.entries {
+		if entry.Sequence > after {
+			entries = append(entries, entry)
+		}
+	}
+	subscriber := make(chan *ChangelogEntry, c.size)
+	c.subscribers[subscriber] = struct{}{}
+	return entries, subscriber
+}
+
+// unsubscribe stops sending changes to subscriber
+func (c *Changelog) unsubscribe(subscriber chan *ChangelogEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.subscribers[subscriber]; ok {
+		delete(c.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// ChangelogHandler returns HTTP handler streaming changelog as Server-Sent Events with JSON ChangelogEntry data.
+// Clients reconnecting with Last-Event-ID header receive the kept changes they missed.
+func ChangelogHandler(changelog *Changelog) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", http.MethodGet)
+			http.Error(writer, "Only GET requests stream changelog", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			http.Error(writer, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		var after uint64
+		if lastEventID := request.Header.Get("Last-Event-ID"); lastEventID != "" {
+			var err error
+			if after, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+				http.Error(writer, "Last-Event-ID should be a changelog sequence", http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, subscriber := changelog.subscribe(after)
+		defer changelog.unsubscribe(subscriber)
+
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.WriteHeader(http.StatusOK)
+		for _, entry := range entries {
+			if writeChangelogEvent(writer, entry) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		streamChangelog(request.Context(), writer, flusher, subscriber)
+	})
+}
+
+// streamChangelog writes changes received by subscriber until ctx is done or subscriber is closed
+func streamChangelog(ctx context.Context, writer http.ResponseWriter, flusher http.Flusher, subscriber <-chan *ChangelogEntry) {
+	keepAlive := time.NewTicker(changelogKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case entry, ok := <-subscriber:
+			if !ok || writeChangelogEvent(writer, entry) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeChangelogEvent writes entry as Server-Sent Event with the entry sequence id
+func writeChangelogEvent(writer http.ResponseWriter, entry *ChangelogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", entry.Sequence, ChangelogEventType, data)
+	return err
+}
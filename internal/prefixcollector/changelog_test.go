@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"bufio"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestChangelogStream(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	changelog := prefixcollector.NewChangelog(2)
+	changelog.Append(&prefixcollector.PrefixesChange{Added: []string{"10.96.0.0/12"}})
+	changelog.Append(&prefixcollector.PrefixesChange{Added: []string{"10.244.0.0/16"}})
+
+	server := httptest.NewServer(prefixcollector.ChangelogHandler(changelog))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	request.Header.Set("Last-Event-ID", "1")
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(response.Body)
+	second := readChangelogEvent(t, events)
+	require.Equal(t, uint64(2), second.Sequence)
+	require.Equal(t, []string{"10.244.0.0/16"}, second.Added)
+	require.Equal(t, prefixcollector.PrefixesHash([]string{"10.244.0.0/16", "10.96.0.0/12"}), second.Hash)
+
+	changelog.Append(&prefixcollector.PrefixesChange{Removed: []string{"10.244.0.0/16"}})
+	third := readChangelogEvent(t, events)
+	require.Equal(t, uint64(3), third.Sequence)
+	require.Equal(t, second.Hash, third.PreviousHash)
+	require.Equal(t, prefixcollector.PrefixesHash([]string{"10.96.0.0/12"}), third.Hash)
+}
+
+func TestChangelogWrongLastEventID(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, prefixcollector.ChangelogPath, nil)
+	request.Header.Set("Last-Event-ID", "latest")
+	prefixcollector.ChangelogHandler(prefixcollector.NewChangelog(1)).ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// readChangelogEvent reads the next Server-Sent Event of events and decodes its data
+func readChangelogEvent(t *testing.T, events *bufio.Reader) *prefixcollector.ChangelogEntry {
+	entry := &prefixcollector.ChangelogEntry{}
+	for {
+		line, err := events.ReadString('\n')
+		require.NoError(t, err)
+		if data := strings.TrimPrefix(line, "data: "); data != line {
+			require.NoError(t, json.Unmarshal([]byte(data), entry))
+		}
+		if line == "\n" {
+			return entry
+		}
+	}
+}
@@ -20,23 +20,34 @@ package prefixcollector
 import (
 	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"crypto/ed25519"
+	"fmt"
+	"time"
 
 	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
 
 	"github.com/sirupsen/logrus"
-
-	"github.com/networkservicemesh/sdk/pkg/tools/prefixpool"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-const defaultPrefixesFilePath = "/var/lib/networkservicemesh/config/excluded_prefixes.yaml"
+const (
+	defaultPrefixesFilePath = "/var/lib/networkservicemesh/config/excluded_prefixes.yaml"
+	defaultShutdownTimeout  = 5 * time.Second
+)
 
 // PrefixSource is source of excluded prefixes
 type PrefixSource interface {
 	Prefixes() []string
 }
 
+// NamedPrefixSource is PrefixSource having a name, which is used for prefixes attribution
+type NamedPrefixSource interface {
+	PrefixSource
+	Name() string
+}
+
 // writePrefixesFunc is excluded prefixes write func
-type writePrefixesFunc func(context.Context, []string)
+type writePrefixesFunc func(context.Context, []string) error
 
 // watchPrefixesFunc is excluded prefixes resource watch func
 type watchPrefixesFunc func(context.Context, *utils.SynchronizedPrefixesContainer)
@@ -48,10 +59,42 @@ type Option func(collector *ExcludedPrefixCollector)
 // and writing result using provided writePrefixesFunc
 type ExcludedPrefixCollector struct {
 	notifyChan       <-chan struct{}
+	eventBus         *utils.EventBus
 	writeFunc        writePrefixesFunc
 	watchFunc        watchPrefixesFunc
 	sources          []PrefixSource
 	previousPrefixes *utils.SynchronizedPrefixesContainer
+	configMapOutput  configMapOutput
+	changeHandlers   []changeHandlerFunc
+	statusHandlers   []statusHandlerFunc
+	sourcePrefixes   map[string][]string
+	status           Status
+	// outputMergeStrategy and auditMergeStrategy are strategies of combining prefixes of the sources for sinks
+	outputMergeStrategy string
+	auditMergeStrategy  string
+	sourcePriorities    []string
+	// outputSelector and auditSelector select prefixes by their tags for sinks, nil selects all the prefixes
+	outputSelector labels.Selector
+	auditSelector  labels.Selector
+	// auditPrefixes are the last prefixes combined for the audit
+	auditPrefixes []string
+	// pausedByConfig freezes the output regardless of the output config map annotation
+	pausedByConfig bool
+	canary         *canaryOutput
+	// staleWindow is time without refreshes of all the sources they are reported stale after, 0 disables the check
+	staleWindow     time.Duration
+	shutdownTimeout time.Duration
+	sourceCache     *sourceCache
+	consumers       *consumerTracker
+	allocations     *allocationChecker
+	poolLint        *poolLint
+	quotas          *sourceQuotas
+	publicPrefixes  *publicPrefixesCheck
+	backup          *outputBackup
+	restore         *backupRestore
+	// propagation observes latency of pendingEvents notifications of the sources until the output write
+	propagation   *PropagationMetrics
+	pendingEvents map[string]time.Time
 }
 
 // WithFileOutput is ExcludedPrefixCollector option, which sets file output
@@ -65,8 +108,25 @@ func WithFileOutput(outputFilePath string) Option {
 // WithConfigMapOutput is ExcludedPrefixCollector option, which sets configMap output
 func WithConfigMapOutput(name, namespace string) Option {
 	return func(collector *ExcludedPrefixCollector) {
-		collector.writeFunc = configMapWriter(name, namespace)
-		collector.watchFunc = configMapWatchFunc(name, namespace)
+		collector.writeFunc = configMapWriter(name, namespace, &collector.configMapOutput)
+		collector.watchFunc = configMapWatchFunc(name, namespace, &collector.configMapOutput)
+	}
+}
+
+// WithOutputFunc is ExcludedPrefixCollector option, which sets output writing prefixes with write
+func WithOutputFunc(write func(context.Context, []string) error) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.writeFunc = write
+		collector.watchFunc = nil
+	}
+}
+
+// WithSigningKey is ExcludedPrefixCollector option, which enables signing of configMap output with key.
+// Public part of the key is published to publicKeyConfigMapName configMap in the output namespace.
+func WithSigningKey(key ed25519.PrivateKey, publicKeyConfigMapName string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.signingKey = key
+		collector.configMapOutput.publicKeyConfigMapName = publicKeyConfigMapName
 	}
 }
 
@@ -77,6 +137,22 @@ func WithNotifyChan(notifyChan <-chan struct{}) Option {
 	}
 }
 
+// WithEventBus is ExcludedPrefixCollector option, which sets event bus notifying collector about sources changes
+func WithEventBus(bus *utils.EventBus) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.notifyChan = bus.Events()
+		collector.eventBus = bus
+	}
+}
+
+// WithShutdownTimeout is ExcludedPrefixCollector option, which sets time collector waits for goroutines
+// of the context Lifecycle to stop on shutdown
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.shutdownTimeout = timeout
+	}
+}
+
 // WithSources is ExcludedPrefixCollector option, which sets prefix sources
 func WithSources(sources ...PrefixSource) Option {
 	return func(collector *ExcludedPrefixCollector) {
@@ -90,7 +166,10 @@ func NewExcludePrefixCollector(options ...Option) *ExcludedPrefixCollector {
 		notifyChan:       make(chan struct{}, 1),
 		previousPrefixes: utils.NewSynchronizedPrefixesContainer(),
 		writeFunc:        fileWriter(defaultPrefixesFilePath),
+		sourcePrefixes:   map[string][]string{},
+		shutdownTimeout:  defaultShutdownTimeout,
 	}
+	collector.configMapOutput.pauseChanged = make(chan struct{}, 1)
 
 	for _, option := range options {
 		option(collector)
@@ -100,47 +179,203 @@ func NewExcludePrefixCollector(options ...Option) *ExcludedPrefixCollector {
 }
 
 // Serve - begin monitoring sources.
-// Updates exclude prefix file after every notification.
+// Updates exclude prefix file after every notification. Output is rewritten on forced resync even if
+// the prefixes aren't changed. Returns after ctx is done and goroutines of the context Lifecycle are stopped
+// or shutdown timeout passes.
 func (epc *ExcludedPrefixCollector) Serve(ctx context.Context) {
+	resync := ResyncSignal(ctx).Subscribe()
+	defer epc.canary.stop()
+	defer epc.restore.stop()
+	staleTicks, stopStaleTicks := epc.staleTicks()
+	defer stopStaleTicks()
+	consumerTicks, stopConsumerTicks := epc.consumerTicks()
+	defer stopConsumerTicks()
+	coverageTicks, stopCoverageTicks := epc.coverageTicks()
+	defer stopCoverageTicks()
 	if epc.watchFunc != nil {
-		go epc.watchFunc(ctx, epc.previousPrefixes)
+		Lifecycle(ctx).Go("output watch", func() { epc.watchFunc(ctx, epc.previousPrefixes) })
 	}
 
 	// check current state of sources
-	epc.updateExcludedPrefixes(ctx)
+	epc.restoreOutput(ctx)
+	epc.loadPool(ctx)
+	epc.reportStatus(ctx)
+	epc.updateExcludedPrefixes(ctx, false)
 	for {
 		select {
 		case <-epc.notifyChan:
-			epc.updateExcludedPrefixes(ctx)
+			epc.updateExcludedPrefixes(ctx, false)
+		case <-resync:
+			epc.updateExcludedPrefixes(ctx, true)
+		case <-epc.configMapOutput.pauseChanged:
+			epc.updateExcludedPrefixes(ctx, false)
+		case <-epc.canary.soakedChan():
+			epc.updateExcludedPrefixes(ctx, false)
+		case <-epc.restore.expiredChan():
+			epc.updateExcludedPrefixes(ctx, false)
+		case <-staleTicks:
+			epc.checkStale(ctx)
+		case <-consumerTicks:
+			epc.checkConsumers(ctx)
+		case <-coverageTicks:
+			epc.reportCoverage(ctx)
 		case <-ctx.Done():
+			epc.shutdown(ctx)
 			return
 		}
 	}
 }
 
-func (epc *ExcludedPrefixCollector) updateExcludedPrefixes(ctx context.Context) {
-	excludePrefixPool, _ := prefixpool.New()
+// shutdown waits for goroutines of the context Lifecycle to stop for shutdown timeout and reports leaked ones
+func (epc *ExcludedPrefixCollector) shutdown(ctx context.Context) {
+	if epc.eventBus != nil {
+		stats := epc.eventBus.Stats()
+		logrus.Infof("Sources published %d notifications, %d of them were coalesced", stats.Published, stats.Coalesced)
+		for name, suppressed := range stats.Suppressed {
+			logrus.Infof("Source %s had %d notifications suppressed by batch window", name, suppressed)
+		}
+	}
+	if running := Lifecycle(ctx).Wait(epc.shutdownTimeout); len(running) > 0 {
+		logrus.Warnf("Goroutines are still running after %v shutdown timeout: %v", epc.shutdownTimeout, running)
+	}
+}
 
+func (epc *ExcludedPrefixCollector) updateExcludedPrefixes(ctx context.Context, force bool) {
+	epc.takePendingEvents()
+	sets := make([]sourceSet, 0, len(epc.sources))
+	cachedSources := map[string]bool{}
 	for _, v := range epc.sources {
-		sourcePrefixes := v.Prefixes()
-		if len(sourcePrefixes) == 0 {
-			continue
+		name := SourceName(v)
+		prefixes, cached := epc.sourceCache.prefixes(name, v.Prefixes(), RefreshTimes(ctx))
+		if cached {
+			cachedSources[name] = true
 		}
+		sets = append(sets, sourceSet{name: name, scope: SourceScope(v), prefixes: prefixes})
+	}
+	epc.sourceCache.store(setsPrefixes(sets))
+	epc.updateCachedSources(ctx, sortedNames(cachedSources))
+	epc.updatePendingSources(ctx)
+	epc.updateSourcesHealth(ctx)
+	sets = epc.applyQuotas(ctx, sets)
+	sets = epc.applyPublicPrefixesCheck(ctx, sets)
+	sourcePrefixes := setsPrefixes(sets)
+
+	outputSets := selectPrefixes(sets, epc.outputSelector)
+	newPrefixes, err := mergePrefixes(epc.outputMergeStrategy, outputSets, epc.sourcePriorities)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	auditPrefixes, err := epc.mergeAuditPrefixes(sets, newPrefixes)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
 
-		if err := excludePrefixPool.ReleaseExcludedPrefixes(v.Prefixes()); err != nil {
-			logrus.Error(err)
+	span := spanhelper.FromContext(ctx, "Update excluded prefixes")
+	defer span.Finish()
+
+	if epc.lintPool(ctx, newPrefixes) || epc.restore.hold(ctx, epc.sources) {
+		return
+	}
+	previousPrefixes := epc.previousPrefixes.Load()
+	// the first update is written even if it is empty, so consumers don't keep stale output of the previous run
+	if epc.holdPaused(ctx, newPrefixes, previousPrefixes, sourcePrefixes) {
+		return
+	}
+	epc.configMapOutput.storeSourcePrefixes(setsPrefixes(outputSets))
+	epc.configMapOutput.storeVLANPrefixes(sourcesVLANPrefixes(epc.sources))
+	epc.configMapOutput.storePrefixesExpiry(sourcesPrefixesExpiry(epc.sources))
+	if epc.canary.hold(ctx, newPrefixes) {
+		return
+	}
+	changed := !epc.status.OutputWritten || !utils.UnorderedSlicesEquals(newPrefixes, previousPrefixes)
+	if changed || force {
+		// the output watch compares own writes against previousPrefixes, so they are stored before writing
+		epc.previousPrefixes.Store(newPrefixes)
+		err = epc.writeFunc(ctx, newPrefixes)
+		if err != nil {
+			epc.previousPrefixes.Store(previousPrefixes)
+		}
+		if err == errOutputPaused && epc.holdPaused(ctx, newPrefixes, previousPrefixes, sourcePrefixes) {
+			return
+		}
+		if err != nil {
+			epc.status.OutputError = err
+			epc.reportStatus(ctx)
+			span.Logger().Errorf("Failed to write excluded prefixes: %v", err)
 			return
 		}
+		epc.status.OutputWritten = true
+		epc.status.OutputError = nil
+		epc.reportStatus(ctx)
+		epc.observePropagation(span.Span())
+		epc.backupOutput(ctx, newPrefixes)
+		span.Logger().Infof("Excluded prefixes were successfully updated: %v", newPrefixes)
+	} else {
+		// notifications not changing the output have nothing to propagate
+		epc.pendingEvents = nil
 	}
 
-	newPrefixes := excludePrefixPool.GetPrefixes()
-	if utils.UnorderedSlicesEquals(newPrefixes, epc.previousPrefixes.Load()) {
-		return
+	if changed || !utils.UnorderedSlicesEquals(auditPrefixes, epc.auditPrefixes) {
+		change := epc.prefixesChange(epc.auditPrefixes, auditPrefixes, sourcePrefixes)
+		for _, handler := range epc.changeHandlers {
+			handler(ctx, change)
+		}
+		epc.checkAllocations(ctx, change)
 	}
+	epc.auditPrefixes = auditPrefixes
+	epc.sourcePrefixes = sourcePrefixes
+}
 
-	span := spanhelper.FromContext(ctx, "Update excluded prefixes")
+// mergeAuditPrefixes returns prefixes of the source sets combined for the audit, which are outputPrefixes
+// unless the audit has own strategy or selector
+func (epc *ExcludedPrefixCollector) mergeAuditPrefixes(sets []sourceSet, outputPrefixes []string) ([]string, error) {
+	strategy := epc.auditMergeStrategy
+	if strategy == "" {
+		strategy = epc.outputMergeStrategy
+	}
+	if strategy == epc.outputMergeStrategy && epc.outputSelector == nil && epc.auditSelector == nil {
+		return outputPrefixes, nil
+	}
+	return mergePrefixes(strategy, selectPrefixes(sets, epc.auditSelector), epc.sourcePriorities)
+}
+
+func (epc *ExcludedPrefixCollector) reportStatus(ctx context.Context) {
+	epc.status.Panics = Lifecycle(ctx).Panics()
+	for _, handler := range epc.statusHandlers {
+		handler(ctx, &epc.status)
+	}
+}
+
+// prefixesChange returns change from previousPrefixes to newPrefixes
+func (epc *ExcludedPrefixCollector) prefixesChange(previousPrefixes, newPrefixes []string,
+	sourcePrefixes map[string][]string) *PrefixesChange {
+	change := &PrefixesChange{
+		Timestamp: time.Now().UTC(),
+		Added:     utils.Difference(newPrefixes, previousPrefixes),
+		Removed:   utils.Difference(previousPrefixes, newPrefixes),
+	}
 
-	epc.previousPrefixes.Store(newPrefixes)
-	epc.writeFunc(ctx, newPrefixes)
-	span.Logger().Infof("Excluded prefixes were successfully updated: %v", newPrefixes)
+	for _, v := range epc.sources {
+		name := SourceName(v)
+		sourceChange := SourceChange{
+			Source:  name,
+			Added:   utils.Difference(sourcePrefixes[name], epc.sourcePrefixes[name]),
+			Removed: utils.Difference(epc.sourcePrefixes[name], sourcePrefixes[name]),
+		}
+		if len(sourceChange.Added) > 0 || len(sourceChange.Removed) > 0 {
+			change.Sources = append(change.Sources, sourceChange)
+		}
+	}
+
+	return change
+}
+
+// SourceName returns name of the source. Unnamed sources are named by their type.
+func SourceName(source PrefixSource) string {
+	if namedSource, ok := source.(NamedPrefixSource); ok {
+		return namedSource.Name()
+	}
+	return fmt.Sprintf("%T", source)
 }
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"cmd-exclude-prefixes-k8s/pkg/sourcetest"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// pipelineLoads are numbers of sources and prefixes per source of the pipeline benchmarks
+var pipelineLoads = []struct {
+	sources, prefixes int
+}{
+	{5, 100},
+	{20, 1000},
+	{50, 5000},
+}
+
+// BenchmarkCollectorPipeline measures latency from a source change to the output write: merge, aggregation,
+// YAML encoding and file write of the prefixes churned by 1% per change
+func BenchmarkCollectorPipeline(b *testing.B) {
+	for _, load := range pipelineLoads {
+		load := load
+		b.Run(fmt.Sprintf("%dx%d", load.sources, load.prefixes), func(b *testing.B) {
+			benchmarkPipeline(b, sourcetest.NewLoadGenerator(load.sources, load.prefixes, 0.01, 1))
+		})
+	}
+}
+
+func benchmarkPipeline(b *testing.B, generator *sourcetest.LoadGenerator) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outputPath := filepath.Join(b.TempDir(), "excluded_prefixes.yaml")
+	notifyChan := make(chan struct{}, 1)
+	written := make(chan int)
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(generator.Sources()...),
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			data, err := utils.PrefixesToYaml(prefixes)
+			if err == nil {
+				err = ioutil.WriteFile(outputPath, data, 0600)
+			}
+			written <- len(prefixes)
+			return err
+		}),
+	).Serve(ctx)
+	<-written
+
+	var outputPrefixes, churned int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		churned += generator.Churn()
+		notifyChan <- struct{}{}
+		outputPrefixes = <-written
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(generator.Prefixes()), "prefixes")
+	b.ReportMetric(float64(outputPrefixes), "output-prefixes")
+	b.ReportMetric(float64(churned)/float64(b.N), "churned/op")
+}
+
+// TestCollectorPipelineLoad publishes pipeline benchmark results of the smallest load in the test output
+func TestCollectorPipelineLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Pipeline load isn't measured in short mode")
+	}
+	load := pipelineLoads[0]
+	result := testing.Benchmark(func(b *testing.B) {
+		benchmarkPipeline(b, sourcetest.NewLoadGenerator(load.sources, load.prefixes, 0.01, 1))
+	})
+	t.Logf("Pipeline of %d sources x %d prefixes: %s %s", load.sources, load.prefixes, result.String(), result.MemString())
+}
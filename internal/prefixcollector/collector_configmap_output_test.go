@@ -21,6 +21,11 @@ import (
 	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
 	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"io/ioutil"
 	"path/filepath"
@@ -38,13 +43,14 @@ import (
 )
 
 const (
-	configMapPath       = "./testfiles/configMap.yaml"
-	kubeConfigMapPath   = "./testfiles/kubeAdmConfigMap.yaml"
-	nsmConfigMapPath    = "./testfiles/nsmConfigMap.yaml"
-	excludedPrefixesKey = "excluded_prefixes.yaml"
-	configMapNamespace  = "default"
-	userConfigMapName   = "test"
-	nsmConfigMapName    = "nsm-config"
+	configMapPath          = "./testfiles/configMap.yaml"
+	kubeConfigMapPath      = "./testfiles/kubeAdmConfigMap.yaml"
+	nsmConfigMapPath       = "./testfiles/nsmConfigMap.yaml"
+	excludedPrefixesKey    = "excluded_prefixes.yaml"
+	configMapNamespace     = "default"
+	userConfigMapName      = "test"
+	nsmConfigMapName       = "nsm-config"
+	publicKeyConfigMapName = "excluded-prefixes-public-key"
 )
 
 type dummyPrefixSource struct {
@@ -59,6 +65,15 @@ func newDummyPrefixSource(prefixes []string) *dummyPrefixSource {
 	return &dummyPrefixSource{prefixes}
 }
 
+type vlanPrefixSource struct {
+	dummyPrefixSource
+	vlanPrefixes map[int][]string
+}
+
+func (v *vlanPrefixSource) VLANPrefixes() map[int][]string {
+	return v.vlanPrefixes
+}
+
 type ExcludedPrefixesSuite struct {
 	suite.Suite
 	clientSet kubernetes.Interface
@@ -76,7 +91,7 @@ func (eps *ExcludedPrefixesSuite) TearDownTest() {
 
 func (eps *ExcludedPrefixesSuite) TestCollectorWithDummySources() {
 	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
-	notifyChan := make(chan struct{}, 1)
+	notifyChan := utils.NewEventBus()
 	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
 	defer cancel()
 
@@ -112,7 +127,7 @@ func (eps *ExcludedPrefixesSuite) TestConfigMapSource() {
 		"168.0.0.0/10",
 		"1.0.0.0/11",
 	}
-	notifyChan := make(chan struct{}, 1)
+	notifyChan := utils.NewEventBus()
 
 	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
 	defer cancel()
@@ -137,7 +152,7 @@ func (eps *ExcludedPrefixesSuite) TestKubeAdmConfigSource() {
 		"10.96.0.0/12",
 	}
 
-	notifyChan := make(chan struct{}, 1)
+	notifyChan := utils.NewEventBus()
 	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
 	defer cancel()
 
@@ -161,7 +176,7 @@ func (eps *ExcludedPrefixesSuite) TestAllSources() {
 		"1.0.0.0/11",
 	}
 
-	notifyChan := make(chan struct{}, 1)
+	notifyChan := utils.NewEventBus()
 	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
 	defer cancel()
 
@@ -188,6 +203,225 @@ func (eps *ExcludedPrefixesSuite) TestAllSources() {
 	eps.testCollectorWithConfigmapOutput(ctx, notifyChan, expectedResult, sources)
 }
 
+func (eps *ExcludedPrefixesSuite) TestSignedConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	defer eps.deleteConfigMap(context.Background(), configMapNamespace, publicKeyConfigMapName)
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	eps.Require().NoError(err)
+
+	notifyChan := utils.NewEventBus()
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	expectedResult := []string{"10.20.0.0/16"}
+	sources := []prefixcollector.PrefixSource{newDummyPrefixSource(expectedResult)}
+	eps.testCollectorWithConfigmapOutput(ctx, notifyChan, expectedResult, sources,
+		prefixcollector.WithSigningKey(signingKey, publicKeyConfigMapName),
+		prefixcollector.WithOutputSchemas(prefixcollector.SchemaV1, prefixcollector.SchemaV2),
+		prefixcollector.WithFamilyKeys())
+
+	configMaps := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	nsmConfigMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	eps.Require().Equal(publicKeyConfigMapName, nsmConfigMap.Annotations[prefixcollector.PublicKeyAnnotation])
+
+	publicKeyConfigMap, err := configMaps.Get(ctx, publicKeyConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	block, _ := pem.Decode([]byte(publicKeyConfigMap.Data[prefixcollector.PublicKeyConfigMapKey]))
+	eps.Require().NotNil(block)
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	eps.Require().NoError(err)
+
+	signature, err := base64.StdEncoding.DecodeString(nsmConfigMap.Annotations[prefixcollector.SignatureAnnotation])
+	eps.Require().NoError(err)
+	eps.Require().True(ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(nsmConfigMap.Data[excludedPrefixesKey]), signature))
+	for _, key := range []string{excludedPrefixesKey, prefixcollector.SchemaV2Key,
+		prefixcollector.IPv4PrefixesKey, prefixcollector.IPv6PrefixesKey} {
+		eps.Require().NoError(prefixcollector.VerifyKeySignature(nsmConfigMap, key, publicKey.(ed25519.PublicKey)), key)
+	}
+
+	nsmConfigMap.Data[prefixcollector.SchemaV2Key] += "\n"
+	eps.Require().Error(prefixcollector.VerifyKeySignature(nsmConfigMap, prefixcollector.SchemaV2Key, publicKey.(ed25519.PublicKey)))
+}
+
+func (eps *ExcludedPrefixesSuite) TestShardedConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	defer func() {
+		for i := 0; i < 3; i++ {
+			eps.deleteConfigMap(context.Background(), configMapNamespace, prefixcollector.ShardName(nsmConfigMapName, i))
+		}
+		eps.deleteConfigMap(context.Background(), configMapNamespace, nsmConfigMapName)
+		eps.createConfigMap(context.Background(), configMapNamespace, nsmConfigMapPath)
+	}()
+
+	ctx, cancel := context.WithTimeout(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet), time.Second)
+	defer cancel()
+
+	expectedResult := []string{"10.0.0.0/24", "10.0.2.0/24", "10.0.4.0/24", "10.0.6.0/24", "10.0.8.0/24"}
+	collector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithNotifyChan(make(chan struct{}, 1)),
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithOutputShards(2),
+		prefixcollector.WithSources(newDummyPrefixSource(expectedResult)),
+	)
+
+	errCh := eps.watchConfigMap(ctx, 1)
+	go collector.Serve(ctx)
+	eps.Require().NoError(<-errCh)
+
+	configMaps := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	nsmConfigMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	eps.Require().NotContains(nsmConfigMap.Data, excludedPrefixesKey)
+
+	index := &prefixcollector.ShardIndex{}
+	eps.Require().NoError(yaml.Unmarshal([]byte(nsmConfigMap.Data[prefixcollector.ShardIndexKey]), index))
+	eps.Require().Equal(prefixcollector.PrefixesHash(expectedResult), index.Hash)
+	eps.Require().Len(index.Shards, 3)
+
+	var prefixes []string
+	for _, name := range index.Shards {
+		shard, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		eps.Require().NoError(err)
+		shardPrefixes, err := utils.YamlToPrefixes([]byte(shard.Data[excludedPrefixesKey]))
+		eps.Require().NoError(err)
+		eps.Require().LessOrEqual(len(shardPrefixes), 2)
+		prefixes = append(prefixes, shardPrefixes...)
+	}
+	eps.Require().Equal(expectedResult, prefixes)
+}
+
+func (eps *ExcludedPrefixesSuite) TestCompressedConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	defer func() {
+		eps.deleteConfigMap(context.Background(), configMapNamespace, nsmConfigMapName)
+		eps.createConfigMap(context.Background(), configMapNamespace, nsmConfigMapPath)
+	}()
+
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	configMaps := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	nsmConfigMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	nsmConfigMap.Annotations = map[string]string{prefixcollector.AcceptEncodingAnnotation: prefixcollector.GzipBase64Encoding}
+	_, err = configMaps.Update(ctx, nsmConfigMap, metav1.UpdateOptions{})
+	eps.Require().NoError(err)
+
+	expectedResult := []string{"10.20.0.0/16", "fd00::/64"}
+	errCh := eps.watchConfigMap(ctx, 1)
+	collector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithNotifyChan(make(chan struct{}, 1)),
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithOutputCompression(),
+		prefixcollector.WithSources(newDummyPrefixSource(expectedResult)),
+	)
+	go collector.Serve(ctx)
+	eps.Require().NoError(<-errCh)
+
+	nsmConfigMap, err = configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	encoding := nsmConfigMap.Annotations[prefixcollector.EncodingAnnotation]
+	eps.Require().Equal(prefixcollector.GzipBase64Encoding, encoding)
+
+	prefixes, err := prefixcollector.DecodePrefixes(nsmConfigMap.Data[excludedPrefixesKey], encoding)
+	eps.Require().NoError(err)
+	eps.Require().Equal(expectedResult, prefixes)
+}
+
+func (eps *ExcludedPrefixesSuite) TestSchemaV2ConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	sources := []prefixcollector.PrefixSource{
+		prefixsource.NewEnvPrefixSource([]string{"10.0.0.0/24", "fd00::/64"}),
+		newDummyPrefixSource([]string{"10.0.1.0/24"}),
+	}
+	eps.testCollectorWithConfigmapOutput(ctx, utils.NewEventBus(), []string{"10.0.0.0/23", "fd00::/64"}, sources,
+		prefixcollector.WithOutputSchemas(prefixcollector.SchemaV1, prefixcollector.SchemaV2))
+
+	nsmConfigMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	eps.Require().Equal("v1,v2", nsmConfigMap.Annotations[prefixcollector.SchemaAnnotation])
+
+	document, err := prefixcollector.DecodeDocument(nsmConfigMap.Data[prefixcollector.SchemaV2Key], "")
+	eps.Require().NoError(err)
+	eps.Require().Equal(&prefixcollector.PrefixesDocument{
+		Version: prefixcollector.SchemaV2,
+		Prefixes: []prefixcollector.PrefixEntry{
+			{Prefix: "10.0.0.0/23", Family: prefixcollector.FamilyIPv4, Sources: []string{"*prefixcollector_test.dummyPrefixSource", "env"}},
+			{Prefix: "fd00::/64", Family: prefixcollector.FamilyIPv6, Sources: []string{"env"}},
+		},
+	}, document)
+}
+
+func (eps *ExcludedPrefixesSuite) TestSchemaV2VLANConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	sources := []prefixcollector.PrefixSource{
+		&vlanPrefixSource{
+			dummyPrefixSource: dummyPrefixSource{[]string{"10.0.0.0/24", "10.0.1.0/24", "192.168.0.0/24"}},
+			vlanPrefixes:      map[int][]string{100: {"10.0.1.0/24"}, 20: {"10.0.0.0/24"}},
+		},
+	}
+	eps.testCollectorWithConfigmapOutput(ctx, utils.NewEventBus(), []string{"10.0.0.0/23", "192.168.0.0/24"}, sources,
+		prefixcollector.WithOutputSchemas(prefixcollector.SchemaV1, prefixcollector.SchemaV2))
+
+	nsmConfigMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	document, err := prefixcollector.DecodeDocument(nsmConfigMap.Data[prefixcollector.SchemaV2Key], "")
+	eps.Require().NoError(err)
+	eps.Require().Equal([]prefixcollector.PrefixEntry{
+		{Prefix: "10.0.0.0/23", Family: prefixcollector.FamilyIPv4, Sources: []string{"*prefixcollector_test.vlanPrefixSource"}, VLANs: []int{20, 100}},
+		{Prefix: "192.168.0.0/24", Family: prefixcollector.FamilyIPv4, Sources: []string{"*prefixcollector_test.vlanPrefixSource"}},
+	}, document.Prefixes)
+}
+
+func (eps *ExcludedPrefixesSuite) TestFamilyKeysConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	expectedResult := []string{"10.0.0.0/24", "fd00::/64", "172.16.0.0/12"}
+	sources := []prefixcollector.PrefixSource{newDummyPrefixSource(expectedResult)}
+	eps.testCollectorWithConfigmapOutput(ctx, utils.NewEventBus(), expectedResult, sources,
+		prefixcollector.WithFamilyKeys())
+
+	nsmConfigMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+
+	ipv4Prefixes, err := utils.YamlToPrefixes([]byte(nsmConfigMap.Data[prefixcollector.IPv4PrefixesKey]))
+	eps.Require().NoError(err)
+	eps.Require().Equal([]string{"10.0.0.0/24", "172.16.0.0/12"}, ipv4Prefixes)
+
+	ipv6Prefixes, err := utils.YamlToPrefixes([]byte(nsmConfigMap.Data[prefixcollector.IPv6PrefixesKey]))
+	eps.Require().NoError(err)
+	eps.Require().Equal([]string{"fd00::/64"}, ipv6Prefixes)
+}
+
+func (eps *ExcludedPrefixesSuite) TestCanonicalConfigMapOutput() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
+	defer cancel()
+
+	expectedResult := []string{"10.0.0.0/24", "172.16.0.0/12", "192.168.1.0/24", "fd00::/64"}
+	sources := []prefixcollector.PrefixSource{
+		newDummyPrefixSource([]string{"FD00:0::1/64", "172.16.0.0/12", "::ffff:192.168.1.0/120", "10.0.0.7/24"}),
+	}
+	eps.testCollectorWithConfigmapOutput(ctx, utils.NewEventBus(), expectedResult, sources)
+
+	nsmConfigMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	eps.Require().NoError(err)
+	data, err := utils.PrefixesToYaml(expectedResult)
+	eps.Require().NoError(err)
+	eps.Require().Equal(string(data), nsmConfigMap.Data[excludedPrefixesKey])
+	eps.Require().Equal(prefixcollector.PrefixesHash(expectedResult), nsmConfigMap.Annotations[prefixcollector.PrefixesHashAnnotation])
+}
+
 func TestExcludedPrefixesSuite(t *testing.T) {
 	suite.Run(t, &ExcludedPrefixesSuite{})
 }
@@ -210,13 +444,13 @@ func (eps *ExcludedPrefixesSuite) createConfigMap(ctx context.Context, namespace
 	}
 }
 
-func (eps *ExcludedPrefixesSuite) testCollectorWithConfigmapOutput(ctx context.Context, notifyChan chan struct{},
-	expectedResult []string, sources []prefixcollector.PrefixSource) {
-	collector := prefixcollector.NewExcludePrefixCollector(
-		prefixcollector.WithNotifyChan(notifyChan),
+func (eps *ExcludedPrefixesSuite) testCollectorWithConfigmapOutput(ctx context.Context, notifyChan *utils.EventBus,
+	expectedResult []string, sources []prefixcollector.PrefixSource, options ...prefixcollector.Option) {
+	collector := prefixcollector.NewExcludePrefixCollector(append([]prefixcollector.Option{
+		prefixcollector.WithEventBus(notifyChan),
 		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
 		prefixcollector.WithSources(sources...),
-	)
+	}, options...)...)
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
@@ -229,14 +463,22 @@ func (eps *ExcludedPrefixesSuite) testCollectorWithConfigmapOutput(ctx context.C
 		eps.T().Fatal("Error watching config map: ", err)
 	}
 
-	configMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
-	if err != nil {
-		eps.T().Fatal("Error getting nsm config map: ", err)
-	}
+	// the first output may be written before the sources load their prefixes
+	var prefixes []string
+	for {
+		configMap, err := eps.clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			eps.T().Fatal("Error getting nsm config map: ", err)
+		}
 
-	prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
-	if err != nil {
-		eps.T().Fatal("Error transforming yaml to prefixes: ", err)
+		prefixes, err = utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
+		if err != nil {
+			eps.T().Fatal("Error transforming yaml to prefixes: ", err)
+		}
+		if utils.UnorderedSlicesEquals(expectedResult, prefixes) || ctx.Err() != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
 	eps.Require().ElementsMatch(expectedResult, prefixes)
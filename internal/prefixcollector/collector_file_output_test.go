@@ -21,6 +21,7 @@ import (
 	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
 	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -33,6 +34,7 @@ import (
 
 const (
 	prefixesFileName = "excluded_prefixes.yaml"
+	auditFileName    = "audit.log"
 )
 
 func (eps *ExcludedPrefixesSuite) TestAllSourcesWithFileOutput() {
@@ -46,7 +48,7 @@ func (eps *ExcludedPrefixesSuite) TestAllSourcesWithFileOutput() {
 		"1.0.0.0/11",
 	}
 
-	notifyChan := make(chan struct{}, 1)
+	notifyChan := utils.NewEventBus()
 	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), eps.clientSet))
 	defer cancel()
 
@@ -73,14 +75,42 @@ func (eps *ExcludedPrefixesSuite) TestAllSourcesWithFileOutput() {
 	eps.testCollectorWithFileOutput(ctx, notifyChan, expectedResult, sources)
 }
 
-func (eps *ExcludedPrefixesSuite) testCollectorWithFileOutput(ctx context.Context, notifyChan chan struct{},
+func (eps *ExcludedPrefixesSuite) TestAuditFile() {
+	defer goleak.VerifyNone(eps.T(), goleak.IgnoreCurrent())
+	auditFilePath := filepath.Join(eps.T().TempDir(), auditFileName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithFileOutput(filepath.Join(eps.T().TempDir(), prefixesFileName)),
+		prefixcollector.WithAuditFile(auditFilePath),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.20.0.0/16"})),
+	)
+	go collector.Serve(ctx)
+
+	eps.Require().Eventually(func() bool {
+		bytes, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+		return err == nil && len(bytes) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	bytes, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+	eps.Require().NoError(err)
+	change := &prefixcollector.PrefixesChange{}
+	eps.Require().NoError(json.Unmarshal(bytes, change))
+	eps.Require().Equal([]string{"10.20.0.0/16"}, change.Added)
+	eps.Require().Len(change.Sources, 1)
+	eps.Require().Equal([]string{"10.20.0.0/16"}, change.Sources[0].Added)
+}
+
+func (eps *ExcludedPrefixesSuite) testCollectorWithFileOutput(ctx context.Context, notifyChan *utils.EventBus,
 	expectedResult []string, sources []prefixcollector.PrefixSource) {
 	prefixesFilePath := filepath.Join(os.TempDir(), prefixesFileName)
 	_, err := os.Create(prefixesFilePath)
 	eps.Require().NoError(err)
 
 	collector := prefixcollector.NewExcludePrefixCollector(
-		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithEventBus(notifyChan),
 		prefixcollector.WithFileOutput(prefixesFilePath),
 		prefixcollector.WithSources(sources...),
 	)
@@ -17,9 +17,19 @@
 package prefixcollector
 
 import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"encoding/json"
+	"fmt"
 	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 const (
@@ -27,30 +37,1170 @@ const (
 	ConfigMapOutputType = "config-map"
 	// FileOutputType is excluded prefixes file output type
 	FileOutputType = "file"
+
+	// CollectorMode is mode of the central collector publishing excluded prefixes
+	CollectorMode = "collector"
+	// AgentMode is mode of the node agent reporting node-local excluded prefixes to the collector
+	AgentMode = "agent"
+
+	// AllNamespaces is namespaces list item selecting all the namespaces
+	AllNamespaces = "*"
 )
 
+// PrefixList is list of prefixes, which can be decoded from JSON array, comma or whitespace separated list
+type PrefixList []string
+
+// Decode decodes PrefixList from value
+func (l *PrefixList) Decode(value string) error {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var prefixes []string
+		if err := json.Unmarshal([]byte(value), &prefixes); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return errors.Errorf("invalid JSON prefixes list at offset %d: %v", syntaxErr.Offset, err)
+			}
+			return errors.Wrap(err, "invalid JSON prefixes list")
+		}
+		for i := range prefixes {
+			prefixes[i] = strings.TrimSpace(prefixes[i])
+		}
+		*l = prefixes
+		return nil
+	}
+
+	*l = strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	return nil
+}
+
+// Validate checks every prefix of the list and reports all invalid entries
+func (l PrefixList) Validate() error {
+	var invalid []string
+	for i, prefix := range l {
+		if !validCIDR(prefix) {
+			invalid = append(invalid, fmt.Sprintf("entry %d %q", i+1, prefix))
+		}
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid CIDR in %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// Valid returns valid prefixes of the list, invalid entries are logged and skipped.
+// Returns error if none of the entries is valid.
+func (l PrefixList) Valid() (PrefixList, error) {
+	valid := make(PrefixList, 0, len(l))
+	for i, prefix := range l {
+		if !validCIDR(prefix) {
+			logrus.Warnf("Skipping invalid CIDR in entry %d %q", i+1, prefix)
+			continue
+		}
+		valid = append(valid, prefix)
+	}
+	if len(valid) == len(l) {
+		return l, nil
+	}
+	if len(valid) == 0 {
+		return nil, l.Validate()
+	}
+	return valid, nil
+}
+
+// ScheduledPrefix is excluded prefix active from Start until End, zero Start or End is unbounded
+type ScheduledPrefix struct {
+	Prefix string    `json:"prefix"`
+	Start  time.Time `json:"start,omitempty"`
+	End    time.Time `json:"end,omitempty"`
+}
+
+// Active returns true if the prefix is excluded at now
+func (p *ScheduledPrefix) Active(now time.Time) bool {
+	return (p.Start.IsZero() || !now.Before(p.Start)) && (p.End.IsZero() || now.Before(p.End))
+}
+
+// ScheduleList is list of scheduled prefixes decoded from JSON array of objects with prefix field and
+// optional RFC 3339 start and end fields
+type ScheduleList []ScheduledPrefix
+
+// Decode decodes ScheduleList from value
+func (l *ScheduleList) Decode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		*l = nil
+		return nil
+	}
+	var prefixes []ScheduledPrefix
+	if err := json.Unmarshal([]byte(value), &prefixes); err != nil {
+		return errors.Wrap(err, "invalid JSON scheduled prefixes list")
+	}
+	*l = prefixes
+	return nil
+}
+
+// Validate checks every prefix of the list and its schedule and reports all invalid entries
+func (l ScheduleList) Validate() error {
+	var invalid []string
+	for i := range l {
+		switch {
+		case !validCIDR(l[i].Prefix):
+			invalid = append(invalid, fmt.Sprintf("entry %d %q CIDR", i+1, l[i].Prefix))
+		case !l[i].Start.IsZero() && !l[i].End.IsZero() && !l[i].End.After(l[i].Start):
+			invalid = append(invalid, fmt.Sprintf("entry %d %q schedule ending before start", i+1, l[i].Prefix))
+		}
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// SelectorPrefixes is map of node label selectors to prefixes excluded if the collector node matches them,
+// decoded from JSON object
+type SelectorPrefixes map[string][]string
+
+// Decode decodes SelectorPrefixes from value
+func (p *SelectorPrefixes) Decode(value string) error {
+	return decodeJSONObject(value, p, "node selector prefixes")
+}
+
+// SourceSelectors is map of source names to node label selectors the collector node should match to enable
+// the sources, decoded from JSON object
+type SourceSelectors map[string]string
+
+// Decode decodes SourceSelectors from value
+func (s *SourceSelectors) Decode(value string) error {
+	return decodeJSONObject(value, s, "source node selectors")
+}
+
+// decodeJSONObject decodes JSON object from value to result, empty value is nil result
+func decodeJSONObject(value string, result interface{}, what string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal([]byte(value), result), "invalid JSON %s", what)
+}
+
+// validCIDR returns true if prefix is valid CIDR
+func validCIDR(prefix string) bool {
+	_, _, err := net.ParseCIDR(prefix)
+	return err == nil
+}
+
 // Config - configuration for cmd-exclude-prefixes-k8s
 type Config struct {
-	ExcludedPrefixes   []string `desc:"List of excluded prefixes" split_words:"true"`
-	ConfigMapNamespace string   `default:"default" desc:"Namespace of user config map" split_words:"true"`
-	ConfigMapName      string   `default:"excluded-prefixes-config" desc:"Name of user config map" split_words:"true"`
-	NSMConfigMapName   string   `default:"nsm-config" desc:"Name of nsm config map" split_words:"true"`
-	OutputFilePath     string   `default:"/var/lib/networkservicemesh/config/excluded_prefixes.yaml" desc:"Path of output prefixes file" split_words:"true"`
-	PrefixesOutputType string   `default:"file" desc:"Where to write excluded prefixes" split_words:"true"`
+	ExcludedPrefixes             PrefixList        `desc:"List of excluded prefixes: JSON array, comma or whitespace separated" split_words:"true"`
+	ExcludedPresets              []string          `desc:"Comma separated presets of excluded well-known ranges: rfc1918, cgnat, ula, link-local, multicast, benchmarking, documentation" split_words:"true"`
+	NodeSelectorPrefixes         SelectorPrefixes  `desc:"JSON object of node label selectors to prefix lists excluded only if the collector node matches them" split_words:"true"`
+	SourceNodeSelectors          SourceSelectors   `desc:"JSON object of source names to node label selectors the collector node should match to enable them" split_words:"true"`
+	ScheduledPrefixes            ScheduleList      `desc:"JSON array of excluded prefixes with optional RFC 3339 start and end times of their activation" split_words:"true"`
+	ConfigMapNamespace           string            `default:"default" desc:"Namespace of user config map" split_words:"true"`
+	ConfigMapName                string            `default:"excluded-prefixes-config" desc:"Name of user config map" split_words:"true"`
+	ConfigMapNamespaces          []string          `desc:"Comma separated namespaces user config maps with the name are merged from, * merges them from all the namespaces, the user config map namespace is used if empty" split_words:"true"`
+	KubeadmConfigMapSelector     string            `desc:"Label selector of kubeadm-style config maps, e.g. of Cluster API control plane pools, which subnets are merged with kubeadm-config ones, disabled if empty" split_words:"true"`
+	KubeadmConfigMapNamespaces   []string          `default:"kube-system" desc:"Comma separated namespaces of kubeadm-style config maps selected by label selector" split_words:"true"`
+	ConfigMapSelector            string            `desc:"Label selector of user config maps, which excluded prefixes are merged, disabled if empty" split_words:"true"`
+	ConfigMapSelectorNamespaces  []string          `desc:"Comma separated namespaces of user config maps selected by label selector, all the namespaces if empty" split_words:"true"`
+	NSMConfigMapName             string            `default:"nsm-config" desc:"Name of nsm config map" split_words:"true"`
+	NSMConfigMapNamespace        string            `desc:"Namespace of nsm config map, defaults to the collector namespace" split_words:"true"`
+	OutputFilePath               string            `default:"/var/lib/networkservicemesh/config/excluded_prefixes.yaml" desc:"Path of output prefixes file" split_words:"true"`
+	PrefixesOutputType           string            `default:"file" desc:"Where to write excluded prefixes" split_words:"true"`
+	Kubeconfig                   string            `desc:"Path of kubeconfig the collector runs against out of cluster, in cluster config is used if it and kubeconfig context are empty" split_words:"true"`
+	KubeconfigContext            string            `desc:"Name of kubeconfig context the collector runs against, the current context is used if empty" split_words:"true"`
+	ImpersonateUser              string            `desc:"User the collector impersonates in Kubernetes API requests" split_words:"true"`
+	ImpersonateGroups            []string          `desc:"Comma separated groups the collector impersonates in Kubernetes API requests" split_words:"true"`
+	APIUserAgent                 string            `desc:"User agent of the collector Kubernetes API requests identifying it in audit logs, client-go default if empty" split_words:"true"`
+	APIClientQPS                 float32           `default:"5" desc:"Maximum rate of the collector Kubernetes API requests per second" split_words:"true"`
+	APIClientBurst               int               `default:"10" desc:"Maximum burst of the collector Kubernetes API requests over the rate" split_words:"true"`
+	APIRequestTimeout            time.Duration     `desc:"Timeout of the collector Kubernetes API requests except watches, including their APF retries, 0 disables it" split_words:"true"`
+	APIWatchTimeout              time.Duration     `desc:"Timeout of the source Kubernetes API watches after which they are resumed from the last resource version, API server picks a random one of its minimal request timeout if 0" split_words:"true"`
+	APIDialTimeout               time.Duration     `default:"30s" desc:"Timeout of establishing the collector Kubernetes API connections" split_words:"true"`
+	APIKeepAlive                 time.Duration     `default:"30s" desc:"Interval of TCP keep-alive probes detecting dead Kubernetes API connections over flaky links, negative disables them" split_words:"true"`
+	APFRetries                   int               `desc:"Number of retries of Kubernetes API requests rejected by API priority and fairness, with exponential backoff honoring Retry-After, 0 disables them" split_words:"true"`
+	SourceTokenFiles             map[string]string `desc:"Comma separated source:path pairs of ServiceAccount token files Kubernetes sources use instead of the collector credentials" split_words:"true"`
+	SourceImpersonateUsers       map[string]string `desc:"Comma separated source:user pairs of users Kubernetes sources impersonate instead of the collector impersonated user" split_words:"true"`
+	SourceKubeconfigs            map[string]string `desc:"Comma separated source:path pairs of kubeconfigs of the clusters Kubernetes sources watch instead of the collector one, e.g. Cluster API management cluster" split_words:"true"`
+	PodNamespace                 string            `desc:"Namespace of the collector pod, usually set from metadata.namespace using the Downward API" split_words:"true"`
+	NodeName                     string            `desc:"Name of the node running the collector, usually set from spec.nodeName using the Downward API" split_words:"true"`
+	ProbeAccess                  bool              `default:"true" desc:"Probe ServiceAccount permissions at startup and disable sources lacking them" split_words:"true"`
+	SourceInitTimeout            time.Duration     `default:"10s" desc:"Time startup waits for every source initialization, sources are initialized concurrently and the slower ones are served once initialized" split_words:"true"`
+	SigningKeyPath               string            `desc:"Path of PEM encoded ed25519 private key used to sign config map output" split_words:"true"`
+	PublicKeyConfigMapName       string            `default:"excluded-prefixes-public-key" desc:"Name of config map the signing public key is published to" split_words:"true"`
+	AuditFilePath                string            `desc:"Path of file every excluded prefixes change is appended to" split_words:"true"`
+	AuditConfigMapName           string            `desc:"Name of config map keeping the latest excluded prefixes changes" split_words:"true"`
+	AuditConfigMapSize           int               `default:"100" desc:"Number of the latest changes kept in the audit config map" split_words:"true"`
+	StatusResourceName           string            `desc:"Name of PrefixCollectorStatus custom resource the collector status is published to" split_words:"true"`
+	OutputShardSize              int               `desc:"Maximum number of prefixes in a single nsm config map shard, 0 disables sharding" split_words:"true"`
+	OutputCompression            bool              `desc:"Compress nsm config map payload with gzip+base64, if the config map accept encoding annotation allows it" split_words:"true"`
+	OutputSchemas                []string          `default:"v1" desc:"Comma separated schema versions of nsm config map payload: v1, v2 or both" split_words:"true"`
+	OutputFamilyKeys             bool              `desc:"Publish IPv4 and IPv6 prefixes under separate nsm config map keys alongside the combined list" split_words:"true"`
+	OutputDiffKey                bool              `desc:"Publish diff from the previously written prefixes under excluded_prefixes_diff.yaml key of nsm config map" split_words:"true"`
+	OutputCommitLease            string            `desc:"Name of coordination Lease guarding two-phase publish of nsm config map: prefixes are staged in a slot key before excluded_prefixes_pointer key is flipped to it, disabled if empty" split_words:"true"`
+	OutputOwner                  string            `desc:"Owner of nsm config maps and the status resource as group/version/resource/name in their namespace, e.g. apps/v1/deployments/exclude-prefixes, so they are garbage collected with it" split_words:"true"`
+	ExternalProxyURL             string            `desc:"Proxy URL of HTTP external sources, HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used if empty" split_words:"true"`
+	ExternalCAPath               string            `desc:"Path of PEM CA bundle external sources trust in addition to the system CAs" split_words:"true"`
+	ExternalClientCertPath       string            `desc:"Path of PEM client certificate external sources present" split_words:"true"`
+	ExternalClientKeyPath        string            `desc:"Path of PEM private key of the external sources client certificate" split_words:"true"`
+	NetboxURL                    string            `desc:"NetBox base URL, enables NetBox IPAM source" split_words:"true"`
+	NetboxTokenPath              string            `desc:"Path of file containing NetBox API token" split_words:"true"`
+	NetboxTags                   []string          `desc:"Comma separated NetBox tag slugs of excluded prefixes" split_words:"true"`
+	NetboxSites                  []string          `desc:"Comma separated NetBox site slugs of excluded prefixes" split_words:"true"`
+	NetboxRefreshInterval        time.Duration     `default:"5m" desc:"Interval of NetBox prefixes refresh" split_words:"true"`
+	InfobloxURL                  string            `desc:"Infoblox WAPI base URL including version, enables Infoblox IPAM source" split_words:"true"`
+	InfobloxUsername             string            `desc:"Infoblox WAPI username" split_words:"true"`
+	InfobloxPasswordPath         string            `desc:"Path of file containing Infoblox WAPI password" split_words:"true"`
+	InfobloxNetworkView          string            `desc:"Infoblox network view of excluded networks, all views are used if empty" split_words:"true"`
+	InfobloxExtensibleAttributes map[string]string `desc:"Infoblox extensible attributes of excluded networks, as name:value pairs separated by commas" split_words:"true"`
+	InfobloxRefreshInterval      time.Duration     `default:"5m" desc:"Interval of Infoblox networks refresh" split_words:"true"`
+	RestURLTemplates             []string          `desc:"Comma separated text/template URL templates of REST IPAM source, enables the source" split_words:"true"`
+	RestParams                   map[string]string `desc:"Parameters of REST IPAM source URL templates, as name:value pairs separated by commas" split_words:"true"`
+	RestPrefixPath               string            `desc:"Kubernetes JSONPath template extracting whitespace or comma separated prefixes from REST IPAM responses" split_words:"true"`
+	RestAuthHeader               string            `desc:"Name of REST IPAM request header containing authentication value" split_words:"true"`
+	RestAuthValuePath            string            `desc:"Path of file containing REST IPAM authentication header value" split_words:"true"`
+	RestRefreshInterval          time.Duration     `default:"5m" desc:"Interval of REST IPAM prefixes refresh" split_words:"true"`
+	KeaURL                       string            `desc:"ISC Kea control agent URL, enables DHCP scopes source" split_words:"true"`
+	KeaServices                  []string          `default:"dhcp4,dhcp6" desc:"Comma separated Kea servers DHCP scopes are read from" split_words:"true"`
+	KeaUsername                  string            `desc:"Kea control agent basic authentication username" split_words:"true"`
+	KeaPasswordPath              string            `desc:"Path of file containing Kea control agent basic authentication password" split_words:"true"`
+	DhcpdConfPath                string            `desc:"Path of mounted ISC dhcpd.conf, enables DHCP scopes source" split_words:"true"`
+	DHCPRefreshInterval          time.Duration     `default:"5m" desc:"Interval of DHCP scopes refresh" split_words:"true"`
+	OpenstackNeutronURL          string            `desc:"OpenStack Neutron API endpoint URL, enables OpenStack Kuryr source" split_words:"true"`
+	OpenstackAuthURL             string            `desc:"Keystone v3 URL the application credential is exchanged for Neutron token at" split_words:"true"`
+	OpenstackCredentialID        string            `desc:"ID of Keystone application credential" split_words:"true"`
+	OpenstackCredentialPath      string            `desc:"Path of file containing Keystone application credential secret" split_words:"true"`
+	OpenstackTokenPath           string            `desc:"Path of file containing Keystone token of Neutron requests, used if Keystone URL isn't set" split_words:"true"`
+	OpenstackProviderNetworks    []string          `desc:"Comma separated Neutron provider network IDs, CIDRs of all their subnets are excluded" split_words:"true"`
+	OpenstackRefreshInterval     time.Duration     `default:"5m" desc:"Interval of OpenStack subnets refresh" split_words:"true"`
+	CloudTagsKey                 string            `default:"nsm.io/exclude" desc:"Key of tag cloud subnets are marked for exclusion with" split_words:"true"`
+	CloudTagsValue               string            `default:"true" desc:"Value of tag cloud subnets are marked for exclusion with, any value matches if empty" split_words:"true"`
+	CloudTagsRefreshInterval     time.Duration     `default:"5m" desc:"Interval of cloud tagged subnets refresh" split_words:"true"`
+	AwsRegions                   []string          `desc:"Comma separated AWS regions tagged VPC subnets are excluded from, enables cloud tags source" split_words:"true"`
+	AwsEndpointURL               string            `desc:"EC2 API endpoint URL of all the AWS regions, https://ec2.<region>.amazonaws.com if empty" split_words:"true"`
+	AwsAccessKeyID               string            `desc:"ID of AWS access key subnets are described with" split_words:"true"`
+	AwsSecretKeyPath             string            `desc:"Path of file containing AWS secret access key" split_words:"true"`
+	GcpProjects                  []string          `desc:"Comma separated GCP projects subnetworks with the tag as key=value in description are excluded from, enables cloud tags source" split_words:"true"`
+	GcpComputeURL                string            `default:"https://compute.googleapis.com" desc:"Google Compute Engine API endpoint URL" split_words:"true"`
+	GcpTokenPath                 string            `desc:"Path of file containing GCP OAuth 2.0 access token, token of GCE metadata server is used if empty" split_words:"true"`
+	AzureSubscriptions           []string          `desc:"Comma separated Azure subscriptions subnets of tagged virtual networks are excluded from, enables cloud tags source" split_words:"true"`
+	AzureManagementURL           string            `default:"https://management.azure.com" desc:"Azure Resource Manager endpoint URL" split_words:"true"`
+	AzureLoginURL                string            `default:"https://login.microsoftonline.com" desc:"Microsoft identity platform endpoint URL service principal token is requested at" split_words:"true"`
+	AzureTenantID                string            `desc:"ID of Azure tenant of the service principal" split_words:"true"`
+	AzureClientID                string            `desc:"Client ID of Azure service principal virtual networks are listed with" split_words:"true"`
+	AzureClientSecretPath        string            `desc:"Path of file containing Azure service principal client secret" split_words:"true"`
+	AzureTokenPath               string            `desc:"Path of file containing Azure Resource Manager access token, used if client ID isn't set" split_words:"true"`
+	KuryrConfigSource            bool              `desc:"Exclude pod, service and worker nodes subnets of kuryr.conf of Kuryr config map, enables OpenStack Kuryr source" split_words:"true"`
+	KuryrConfigMapName           string            `default:"kuryr-config" desc:"Name of config map containing kuryr.conf" split_words:"true"`
+	KuryrConfigMapNamespace      string            `default:"kube-system" desc:"Namespace of config map containing kuryr.conf" split_words:"true"`
+	RouterAdvertisementSource    bool              `desc:"Exclude on-link prefixes of IPv6 router advertisements received by the node, requires hostNetwork and NET_RAW capability" split_words:"true"`
+	HostRoutesSource             bool              `desc:"Exclude prefixes of the node routing table, requires hostNetwork, routes of Windows nodes are in table 254" split_words:"true"`
+	HostRoutesProtocols          []string          `default:"kernel,boot,static" desc:"Comma separated origins of excluded host routes: kernel for directly connected, boot or static for static ones" split_words:"true"`
+	HostRoutesTables             []int             `default:"254" desc:"Comma separated routing table ids of excluded host routes" split_words:"true"`
+	HostRoutesExcludeInterfaces  []string          `desc:"Comma separated glob patterns of output interfaces, which host routes aren't excluded" split_words:"true"`
+	HostRoutesRefreshInterval    time.Duration     `default:"30s" desc:"Interval of host routes refresh" split_words:"true"`
+	NetworkdConfigDirs           []string          `desc:"Comma separated host directories of systemd-networkd .network files, enables host network config source" split_words:"true"`
+	NetworkManagerConnectionDirs []string          `desc:"Comma separated host directories of NetworkManager .nmconnection profiles, enables host network config source" split_words:"true"`
+	HostNetworkRefreshInterval   time.Duration     `default:"1m" desc:"Interval of host network config refresh" split_words:"true"`
+	OverlaySource                bool              `desc:"Exclude networks of Tailscale and WireGuard overlay interfaces of the node and routes over them, requires hostNetwork" split_words:"true"`
+	OverlayTailscaleInterfaces   []string          `default:"tailscale*" desc:"Comma separated glob patterns of Tailscale interfaces, which addresses exclude the whole Tailscale ranges" split_words:"true"`
+	OverlayWireguardInterfaces   []string          `default:"wg*" desc:"Comma separated glob patterns of WireGuard interfaces, ones of WireGuard device type are detected regardless of names" split_words:"true"`
+	OverlayRefreshInterval       time.Duration     `default:"30s" desc:"Interval of overlay interfaces refresh" split_words:"true"`
+	RuntimeNetworksSource        bool              `desc:"Exclude bridge networks of Docker, Podman and nerdctl of the node, requires hostNetwork and runtimes config files mounted from the host" split_words:"true"`
+	RuntimeInterfaces            []string          `default:"docker0,br-*,podman*,cni-podman*,nerdctl*" desc:"Comma separated glob patterns of container runtimes bridge interfaces" split_words:"true"`
+	RuntimeDockerConfig          string            `default:"/etc/docker/daemon.json" desc:"Path of Docker daemon.json, which bip, fixed-cidr and default-address-pools are excluded" split_words:"true"`
+	RuntimePodmanNetworksDir     string            `default:"/etc/containers/networks" desc:"Directory of Podman netavark network files" split_words:"true"`
+	RuntimeCniConfigs            []string          `default:"/etc/cni/net.d/nerdctl-*.conflist,/etc/cni/net.d/87-podman*.conflist" desc:"Comma separated glob patterns of nerdctl and Podman CNI network lists" split_words:"true"`
+	RuntimeRefreshInterval       time.Duration     `default:"1m" desc:"Interval of container runtime networks refresh" split_words:"true"`
+	HnsSource                    bool              `desc:"Exclude subnets of Host Networking Service networks of Windows node, e.g. l2bridge pod networks, requires HostProcess container" split_words:"true"`
+	HnsNetworks                  []string          `desc:"Comma separated glob patterns of names of HNS networks, which subnets are excluded, all the networks if empty" split_words:"true"`
+	HnsRefreshInterval           time.Duration     `default:"30s" desc:"Interval of HNS networks refresh" split_words:"true"`
+	CloudNetworkProvider         string            `desc:"Exclude private networks attached to the node by cloud provider learned from its metadata service: hetzner, digitalocean or linode, disabled if empty" split_words:"true"`
+	CloudNetworkMetadataURL      string            `desc:"URL of the cloud provider metadata service, link-local http://169.254.169.254 if empty" split_words:"true"`
+	CloudNetworkRefreshInterval  time.Duration     `default:"5m" desc:"Interval of cloud provider private networks refresh" split_words:"true"`
+	DistroDetection              bool              `default:"true" desc:"Detect kind, minikube and Docker Desktop local development clusters and exclude their default subnets" split_words:"true"`
+	KubeletConfigSource          bool              `desc:"Exclude cluster DNS IPs of kubelet config maps of kube-system namespace" split_words:"true"`
+	HostNetworkPodSource         bool              `desc:"Exclude IPs of running hostNetwork pods of all the namespaces, e.g. control plane components and node daemons" split_words:"true"`
+	GatewayAPISource             bool              `desc:"Exclude IP addresses of Gateway API gateways and address pools of their classes parameters config maps" split_words:"true"`
+	GatewayAPIVersion            string            `default:"v1" desc:"Version of Gateway API resources watched by Gateway API source: v1 or v1beta1" split_words:"true"`
+	IngressControllerSource      bool              `desc:"Exclude external and load balancer IPs of ingress controller services and proxy CIDRs of their config maps" split_words:"true"`
+	IngressControllerSelector    string            `default:"app.kubernetes.io/name in (ingress-nginx,haproxy-ingress,kubernetes-ingress,traefik)" desc:"Label selector of ingress controller services and config maps of all the namespaces" split_words:"true"`
+	CriticalServices             []string          `desc:"Comma separated namespace/name patterns of critical services like cert-manager/* which cluster IPs are excluded as single addresses" split_words:"true"`
+	ServiceAnnotationSource      bool              `desc:"Exclude CIDRs listed in exclude-prefixes.nsm.io/cidrs annotation of the services of all the namespaces" split_words:"true"`
+	Metal3Source                 bool              `desc:"Exclude provisioning networks of Metal3 Provisioning resources and Ironic config map and boot NIC IPs of BareMetalHosts" split_words:"true"`
+	Metal3IronicNamespace        string            `default:"baremetal-operator-system" desc:"Namespace of Ironic config map of Metal3 source" split_words:"true"`
+	Metal3IronicConfigMapName    string            `default:"ironic-bmo-configmap" desc:"Name of Ironic config map of Metal3 source containing PROVISIONING_IP and PROVISIONING_CIDR" split_words:"true"`
+	CapiSource                   bool              `desc:"Exclude pods and services CIDR blocks of Cluster API Cluster resources, watched in the cluster of capi kubeconfig of source kubeconfigs if it is set" split_words:"true"`
+	CapiClusterName              string            `desc:"Name of Cluster API Cluster resource of the collector cluster, all the clusters are excluded if empty" split_words:"true"`
+	CapiNamespaces               []string          `desc:"Comma separated namespaces of Cluster API Cluster resources, all the namespaces if empty" split_words:"true"`
+	SriovNetworkSource           bool              `desc:"Exclude subnets of SriovNetwork and SriovIBNetwork IPAM configurations" split_words:"true"`
+	SriovNetworkNamespace        string            `default:"openshift-sriov-network-operator" desc:"Namespace of SR-IOV network custom resources" split_words:"true"`
+	MultusSource                 bool              `desc:"Exclude subnets of Multus NetworkAttachmentDefinition IPAM configurations of all the namespaces, v2 schema output attributes them to their VLAN tags" split_words:"true"`
+	Mode                         string            `default:"collector" desc:"Run mode: collector publishes prefixes, agent reports node-local prefixes to the collector" split_words:"true"`
+	FeatureGates                 FeatureGates      `desc:"Comma separated Name=bool pairs enabling or disabling gated features: Federation (alpha, disabled by default), CollectorAPI (beta, enabled by default)" split_words:"true"`
+	AggregatorURL                string            `desc:"URL of the collector aggregator node agents report to, e.g. tcp://collector:5003" split_words:"true"`
+	AggregatorListenURL          string            `desc:"URL the collector serves node agent reports and federation requests on, e.g. tcp://:5003, enables agents source" split_words:"true"`
+	AgentReportInterval          time.Duration     `default:"30s" desc:"Interval of node agent reports" split_words:"true"`
+	ClusterID                    string            `desc:"ID of the cluster, remote collectors recognize prefixes pulled from the cluster with it" split_words:"true"`
+	RegistryURL                  string            `desc:"URL of NSM registry gRPC API, e.g. tcp://registry:5002, enables source of IP context prefixes the registered NSEs advertise" split_words:"true"`
+	RegistryCIDRsLabel           string            `default:"exclude-prefixes.nsm.io/cidrs" desc:"Network service label of NSEs listing their comma separated IP context prefixes" split_words:"true"`
+	RegistryNetworkService       string            `desc:"Network service the excluded prefixes are allocated for, IP context prefixes NSEs advertise for it aren't excluded" split_words:"true"`
+	RegistryTLS                  bool              `desc:"Connect NSM registry with TLS using the external CA bundle and client certificate" split_words:"true"`
+	RegistryRefreshInterval      time.Duration     `default:"1m" desc:"Interval of NSM registry NSEs refresh" split_words:"true"`
+	FederationPeers              []string          `desc:"Comma separated cluster-id=URL pairs of remote collectors prefixes are pulled from" split_words:"true"`
+	FederationTLS                bool              `desc:"Connect remote collectors with TLS using the external CA bundle and client certificate" split_words:"true"`
+	FederationRefreshInterval    time.Duration     `default:"1m" desc:"Interval of remote collectors prefixes refresh" split_words:"true"`
+	FederationMaxHops            int               `default:"3" desc:"Maximum number of collectors prefixes are pulled through to be served to remote collectors, 0 is unlimited" split_words:"true"`
+	APICertPath                  string            `desc:"Path of PEM certificate the collector gRPC API and HTTP APIs are served with over TLS, e.g. X.509 SVID written by SPIFFE helper, insecure if empty" split_words:"true"`
+	APIKeyPath                   string            `desc:"Path of PEM private key of the collector API certificate" split_words:"true"`
+	APIClientCAPath              string            `desc:"Path of PEM CA bundle client certificates of the collector APIs are verified with, e.g. SPIFFE trust bundle, client certificates aren't required if empty" split_words:"true"`
+	APISpiffeIDs                 []string          `desc:"Comma separated SPIFFE IDs clients of the collector APIs should have as URI SAN of their certificates, e.g. spiffe://example.org/ns/nsm-system/sa/agent, any certificate of the client CA is accepted if empty" split_words:"true"`
+	AggregatorTLS                bool              `desc:"Connect the aggregator in agent mode with TLS using the external CA bundle and client certificate" split_words:"true"`
+	AggregatorSpiffeID           string            `desc:"SPIFFE ID the aggregator certificate should have as URI SAN instead of host name of the aggregator URL" split_words:"true"`
+	AgentReportTTL               time.Duration     `default:"2m" desc:"Time node prefixes are kept by the collector after the last node agent report" split_words:"true"`
+	BlackholeRoutes              bool              `desc:"Install routes of the excluded prefixes published by the collector on the node in agent mode, so the node drops traffic to them" split_words:"true"`
+	BlackholeRouteType           string            `default:"blackhole" desc:"Type of the node routes of the excluded prefixes: blackhole silently drops packets, unreachable rejects them with ICMP unreachable" split_words:"true"`
+	BlackholeRouteTable          uint32            `default:"254" desc:"Routing table of the node routes of the excluded prefixes, 254 is the main table" split_words:"true"`
+	BlackholeRouteMetric         uint32            `default:"4096" desc:"Metric of the node routes of the excluded prefixes, routes of the same prefixes with lower metric are preferred to them" split_words:"true"`
+	BlackholeRouteRanges         []string          `desc:"Comma separated CIDR ranges limiting the node routes to the excluded prefixes covered by them, e.g. external ranges only, all the prefixes if empty" split_words:"true"`
+	NftablesSets                 bool              `desc:"Maintain nftables interval sets of IPv4 and IPv6 excluded prefixes published by the collector on the node in agent mode, host firewall rules can reference them" split_words:"true"`
+	NftablesTable                string            `default:"nsm" desc:"Name of inet nftables table of the excluded prefixes sets, it is created if missing" split_words:"true"`
+	NftablesSet                  string            `default:"excluded-prefixes" desc:"Name prefix of the excluded prefixes sets, the sets are named with -ipv4 and -ipv6 suffixes" split_words:"true"`
+	OutputMergeStrategy          string            `default:"union" desc:"Strategy of combining prefixes of the sources for the output: union, priority-override or intersection" split_words:"true"`
+	AuditMergeStrategy           string            `desc:"Strategy of combining prefixes of the sources for the audit, the output strategy is used if empty" split_words:"true"`
+	SourcePriorities             []string          `desc:"Comma separated source names from the highest priority to the lowest one for priority-override strategy" split_words:"true"`
+	SourceQuotas                 map[string]int    `desc:"Comma separated source:number pairs limiting how many prefixes the sources contribute to the output" split_words:"true"`
+	SourceQuotaPolicy            string            `default:"truncate" desc:"Policy of the sources exceeding their quotas: truncate keeps the widest prefixes, alarm only reports them, reject keeps the last prefixes within quota" split_words:"true"`
+	PublicPrefixesPolicy         string            `default:"warn" desc:"Policy of prefixes the sources provide covering public address space: warn only reports them, block drops them, ignore disables the check" split_words:"true"`
+	AllowedPublicPrefixes        PrefixList        `desc:"List of public address space prefixes, which are excluded intentionally and aren't flagged: JSON array, comma or whitespace separated" split_words:"true"`
+	OutputSelector               string            `desc:"Selector of source, family (IPv4 or IPv6) and scope (cluster, external or federated) prefix tags the output receives, e.g. scope=cluster" split_words:"true"`
+	AuditSelector                string            `desc:"Selector of prefix tags the audit receives, all the prefixes are audited if empty" split_words:"true"`
+	ResyncListenAddress          string            `desc:"Address of HTTP server accepting POST /resync forced resync and POST /reauth external sources re-authentication requests, e.g. :8080, disabled if empty" split_words:"true"`
+	SecretsCheckInterval         time.Duration     `default:"10s" desc:"Interval of checking mounted secrets external sources read, the sources fetch prefixes again as soon as they are rotated, 0 disables it" split_words:"true"`
+	MetricsListenAddress         string            `desc:"Address of HTTP server serving GET /metrics propagation latency metrics with trace exemplars, e.g. :9090, disabled if empty" split_words:"true"`
+	ChangelogListenAddress       string            `desc:"Address of HTTP server streaming GET /changelog prefixes changes as Server-Sent Events, e.g. :8080, disabled if empty" split_words:"true"`
+	ChangelogSize                int               `default:"100" desc:"Number of the latest changes kept for changelog clients resuming with Last-Event-ID" split_words:"true"`
+	DashboardListenAddress       string            `desc:"Address of HTTP server serving GET /dashboard/ read-only web UI of the sources prefixes and health, the output and its latest changes, e.g. :8080, disabled if empty" split_words:"true"`
+	DashboardChanges             int               `default:"20" desc:"Number of the latest changes shown by the dashboard" split_words:"true"`
+	PublisherURL                 string            `desc:"URL of message bus every prefixes change is published to with the full set: nats://host:4222 NATS server or kafka+http(s)://host:8082 Kafka REST proxy, disabled if empty" split_words:"true"`
+	PublisherTopic               string            `default:"excluded-prefixes" desc:"NATS subject or Kafka topic the prefixes changes are published to" split_words:"true"`
+	BGPPeerAddress               string            `desc:"Address host:port of upstream router the excluded prefixes are announced to over BGP, port 179 if omitted, disabled if empty" split_words:"true"`
+	BGPLocalAS                   uint32            `desc:"Local AS of BGP session with the upstream router" split_words:"true"`
+	BGPPeerAS                    uint32            `desc:"AS of the upstream router, the session is iBGP if it is equal to local AS" split_words:"true"`
+	BGPRouterID                  string            `desc:"BGP identifier IPv4 address, local IPv4 address of the session if empty" split_words:"true"`
+	BGPNextHop                   string            `desc:"Next hop of the announced IPv4 prefixes, local IPv4 address of the session if empty" split_words:"true"`
+	BGPNextHopIPv6               string            `desc:"Next hop of the announced IPv6 prefixes, local IPv6 address of the session if empty, IPv6 prefixes aren't announced over IPv4 sessions without it" split_words:"true"`
+	BGPCommunities               []string          `default:"65535:666" desc:"Comma separated ASN:value communities of the announced prefixes, 65535:666 is RFC 7999 BLACKHOLE" split_words:"true"`
+	BGPHoldTime                  time.Duration     `default:"90s" desc:"Hold time of BGP session, 0 disables keepalives" split_words:"true"`
+	BackupBucketURL              string            `desc:"Path style URL of S3 compatible bucket timestamped output snapshots are uploaded to, e.g. https://s3.eu-west-1.amazonaws.com/bucket/nsm/ or https://storage.googleapis.com/bucket/nsm/, disabled if empty" split_words:"true"`
+	BackupRegion                 string            `default:"us-east-1" desc:"Region the backup bucket requests are signed for" split_words:"true"`
+	BackupAccessKeyID            string            `desc:"ID of access key of the backup bucket, HMAC key ID for GCS" split_words:"true"`
+	BackupSecretKeyPath          string            `desc:"Path of file containing secret access key of the backup bucket" split_words:"true"`
+	BackupRetention              time.Duration     `desc:"Age of output snapshots they are deleted from the backup bucket after, 0 keeps them regardless of age" split_words:"true"`
+	BackupRetentionCount         int               `desc:"Number of the latest output snapshots kept in the backup bucket, 0 keeps all of them" split_words:"true"`
+	BackupRestore                bool              `desc:"Create the missing nsm config map on start with the latest output snapshot of the backup bucket, e.g. after the cluster rebuild" split_words:"true"`
+	BackupRestoreHoldTime        time.Duration     `default:"1m" desc:"Time the restored nsm config map is kept at most until all the sources provide prefixes" split_words:"true"`
+	ReservationsListenAddress    string            `desc:"Address of HTTPS server serving /reservations API operators reserve and release prefixes with, e.g. :8443, requires the API certificate, disabled if empty" split_words:"true"`
+	ReservationSource            bool              `desc:"Exclude prefixes reserved in the reservations config map until they are released or their leases expire" split_words:"true"`
+	ReservationsConfigMapName    string            `default:"excluded-prefixes-reservations" desc:"Name of the config map prefix reservations are stored in" split_words:"true"`
+	ReservationsNamespace        string            `default:"default" desc:"Namespace of the prefix reservations config map" split_words:"true"`
+	OutputPaused                 bool              `desc:"Freeze the output, prefixes are still collected and held changes are reported in logs and status" split_words:"true"`
+	CanaryConfigMapName          string            `desc:"Name of shadow config map new prefixes are published to before the nsm config map, canary is disabled if empty" split_words:"true"`
+	StaleSourcesWindow           time.Duration     `default:"30m" desc:"Time without refreshes of all the sources the SourcesDegraded condition is raised after, 0 disables the check" split_words:"true"`
+	ShutdownTimeout              time.Duration     `default:"5s" desc:"Time collector waits for the sources to stop on shutdown" split_words:"true"`
+	EventBatchWindow             time.Duration     `default:"1s" desc:"Window the following events of a source are batched in after the first one, so event storm is processed once per window, 0 disables batching" split_words:"true"`
+	ConsumerSelector             string            `desc:"Label selector of consumer pods acknowledging applied prefixes with annotation, consumer tracking is disabled if empty" split_words:"true"`
+	ConsumerNamespace            string            `desc:"Namespace of consumer pods, all the namespaces if empty" split_words:"true"`
+	ConsumerCheckInterval        time.Duration     `default:"30s" desc:"Interval consumer pods acknowledgments are checked with" split_words:"true"`
+	NSMManagerURLs               []string          `desc:"Comma separated URLs of NSM managers newly excluded prefixes are checked against allocations of their connections, e.g. tcp://nsmgr:5001" split_words:"true"`
+	AllocationCheckTimeout       time.Duration     `default:"5s" desc:"Time every NSM manager connections are queried within" split_words:"true"`
+	NSMIPAMPool                  PrefixList        `desc:"Prefixes of NSM IPAM pool excluded prefixes should leave free addresses of, pool isn't checked if empty" split_words:"true"`
+	NSMIPAMMinFreeAddresses      int64             `default:"1" desc:"Minimum number of NSM IPAM pool addresses excluded prefixes should leave free" split_words:"true"`
+	NSMIPAMPoolConfigMapName     string            `desc:"Name of config map in nsm config map namespace, which prefix_pool.yaml key contains NSM IPAM pool prefixes" split_words:"true"`
+	PoolCoverageInterval         time.Duration     `default:"1h" desc:"Interval of reports of NSM IPAM pool fraction usable after exclusions, 0 disables the reports" split_words:"true"`
+	RefuseExhaustingPrefixes     bool              `desc:"Keep the previous output instead of writing excluded prefixes leaving too few NSM IPAM pool addresses" split_words:"true"`
+	SourceCachePath              string            `desc:"Path of file the last prefixes of the sources are persisted to and served from on start until the sources are refreshed, disabled if empty" split_words:"true"`
+	CanarySoakTime               time.Duration     `default:"5m" desc:"Time new prefixes should stay unchanged in the shadow config map to be promoted to the nsm config map" split_words:"true"`
 }
 
 // Validate - validates config. Checks PrefixesOutputType and every CIDR from config.ExcludedPrefixes.
 func (c *Config) Validate() error {
-	for _, prefix := range c.ExcludedPrefixes {
-		_, _, err := net.ParseCIDR(prefix)
-		if err != nil {
-			return errors.Wrap(err, "Failed to parse prefixes from environment")
-		}
+	if err := c.validateStaticPrefixes(); err != nil {
+		return err
 	}
 
 	if c.PrefixesOutputType != ConfigMapOutputType && c.PrefixesOutputType != FileOutputType {
 		return errors.New("Wrong prefixes output type")
 	}
 
+	if c.AuditConfigMapSize <= 0 {
+		return errors.New("Audit config map size should be positive")
+	}
+	if err := c.validateSourceEvents(); err != nil {
+		return err
+	}
+	if c.CanarySoakTime <= 0 {
+		return errors.New("Canary soak time should be positive")
+	}
+
+	if err := c.validateCredentials(); err != nil {
+		return err
+	}
+	if err := c.validateOutput(); err != nil {
+		return err
+	}
+	if err := c.validateSchemas(); err != nil {
+		return err
+	}
+	if err := c.validateSources(); err != nil {
+		return err
+	}
+	if err := c.validateAggregation(); err != nil {
+		return err
+	}
+	if err := c.validateFederation(); err != nil {
+		return err
+	}
+	if err := c.validateSinks(); err != nil {
+		return err
+	}
+
+	return c.validateConflicts()
+}
+
+// validateStaticPrefixes checks excluded prefixes and presets, and scheduled prefixes from environment.
+// Invalid excluded prefixes are dropped, unless none of them is valid.
+func (c *Config) validateStaticPrefixes() error {
+	prefixes, err := c.ExcludedPrefixes.Valid()
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse prefixes from environment")
+	}
+	c.ExcludedPrefixes = prefixes
+	if _, err := PresetPrefixes(c.ExcludedPresets); err != nil {
+		return errors.Wrap(err, "Invalid excluded presets")
+	}
+	return errors.Wrap(c.ScheduledPrefixes.Validate(), "Failed to parse scheduled prefixes from environment")
+}
+
+// validateSourceEvents checks settings of the source events processing
+func (c *Config) validateSourceEvents() error {
+	if c.StaleSourcesWindow < 0 {
+		return errors.New("Stale sources window should not be negative")
+	}
+	if c.EventBatchWindow < 0 {
+		return errors.New("Event batch window should not be negative")
+	}
+	return nil
+}
+
+// validateCredentials checks impersonation and API client settings and that own credentials are set only
+// for Kubernetes sources
+func (c *Config) validateCredentials() error {
+	if len(c.ImpersonateGroups) > 0 && c.ImpersonateUser == "" {
+		return errors.New("Impersonated groups require impersonated user")
+	}
+	if c.APIClientQPS <= 0 || c.APIClientBurst <= 0 {
+		return errors.New("API client QPS and burst should be positive")
+	}
+	if c.APFRetries < 0 {
+		return errors.New("APF retries should not be negative")
+	}
+	if c.SecretsCheckInterval < 0 {
+		return errors.New("Secrets check interval should not be negative")
+	}
+	if c.APIRequestTimeout < 0 || c.APIWatchTimeout < 0 || c.APIDialTimeout < 0 {
+		return errors.New("API request, watch and dial timeouts should not be negative")
+	}
+	kubernetesSources := map[string]bool{
+		"kubeadm": true, "kubernetes": true, "configmap": true, "configmaps": true,
+		"kubelet-config": true, "sriov": true, "distro": true,
+		"service-annotations": true, "host-network-pods": true, "gateway-api": true,
+		"ingress-controllers": true, "critical-services": true,
+		"metal3": true, "multus": true, "reservations": true, "capi": true,
+	}
+	for _, credentials := range []map[string]string{c.SourceTokenFiles, c.SourceImpersonateUsers, c.SourceKubeconfigs} {
+		for name := range credentials {
+			if !kubernetesSources[name] {
+				return errors.Errorf("Own credentials of %q source aren't supported, only Kubernetes sources have them", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOutput checks that output features are supported by the output type
+func (c *Config) validateOutput() error {
+	if c.CanaryConfigMapName != "" && c.PrefixesOutputType != ConfigMapOutputType {
+		return errors.New("Canary is supported only for config map output")
+	}
+	if c.SigningKeyPath != "" && c.PrefixesOutputType != ConfigMapOutputType {
+		return errors.New("Output signing is supported only for config map output")
+	}
+	if c.OutputShardSize < 0 {
+		return errors.New("Output shard size should not be negative")
+	}
+	if c.OutputShardSize > 0 && c.PrefixesOutputType != ConfigMapOutputType {
+		return errors.New("Output sharding is supported only for config map output")
+	}
+	if c.OutputCompression && c.PrefixesOutputType != ConfigMapOutputType {
+		return errors.New("Output compression is supported only for config map output")
+	}
+	if c.OutputFamilyKeys && (c.PrefixesOutputType != ConfigMapOutputType || c.OutputShardSize > 0) {
+		return errors.New("Output family keys are supported only for not sharded config map output")
+	}
+	if c.OutputDiffKey && (c.PrefixesOutputType != ConfigMapOutputType || c.OutputShardSize > 0) {
+		return errors.New("Output diff key is supported only for not sharded config map output")
+	}
+	return c.validateOutputChecks()
+}
+
+// validateOutputChecks checks consumer tracking, NSM connection allocations check and NSM IPAM pool lint settings
+func (c *Config) validateOutputChecks() error {
+	if _, err := labels.Parse(c.ConsumerSelector); err != nil {
+		return errors.Wrap(err, "Invalid consumer pods label selector")
+	}
+	if c.ConsumerSelector != "" && c.ConsumerCheckInterval <= 0 {
+		return errors.New("Consumer check interval should be positive")
+	}
+	for _, managerURL := range c.NSMManagerURLs {
+		if _, err := url.Parse(managerURL); err != nil {
+			return errors.Wrapf(err, "Wrong NSM manager URL %q", managerURL)
+		}
+	}
+	if len(c.NSMManagerURLs) > 0 && c.AllocationCheckTimeout <= 0 {
+		return errors.New("Allocation check timeout should be positive")
+	}
+	if err := c.NSMIPAMPool.Validate(); err != nil {
+		return errors.Wrap(err, "Failed to parse NSM IPAM pool")
+	}
+	if c.NSMIPAMMinFreeAddresses < 0 {
+		return errors.New("NSM IPAM pool minimum free addresses should not be negative")
+	}
+	if c.PoolCoverageInterval < 0 {
+		return errors.New("Pool coverage interval should not be negative")
+	}
+	return c.validateOutputCommit()
+}
+
+// validateOutputCommit checks that two-phase publish is used only with not sharded config map output
+func (c *Config) validateOutputCommit() error {
+	if c.OutputCommitLease != "" && (c.PrefixesOutputType != ConfigMapOutputType || c.OutputShardSize > 0) {
+		return errors.New("Two-phase publish is supported only for not sharded config map output")
+	}
+	return c.validateOutputOwner()
+}
+
+// validateOutputOwner checks that output owner is well formed and there are resources it can own
+func (c *Config) validateOutputOwner() error {
+	if c.OutputOwner == "" {
+		return nil
+	}
+	if c.PrefixesOutputType != ConfigMapOutputType && c.StatusResourceName == "" {
+		return errors.New("Output owner is supported only for config map output or status resource")
+	}
+	_, _, err := ParseOwner(c.OutputOwner)
+	return err
+}
+
+// validateSchemas checks output schema versions
+func (c *Config) validateSchemas() error {
+	if len(c.OutputSchemas) == 0 {
+		return errors.New("At least one output schema version should be set")
+	}
+	for _, version := range c.OutputSchemas {
+		switch {
+		case version != SchemaV1 && version != SchemaV2:
+			return errors.Errorf("Unknown output schema version %q", version)
+		case version == SchemaV2 && c.PrefixesOutputType != ConfigMapOutputType:
+			return errors.New("Output schema v2 is supported only for config map output")
+		case version == SchemaV2 && c.OutputShardSize > 0:
+			return errors.New("Output schema v2 is not supported for sharded output")
+		}
+	}
+	return nil
+}
+
+// validateSources checks settings of the external prefix sources
+func (c *Config) validateSources() error {
+	sources := []struct {
+		name     string
+		url      string
+		interval time.Duration
+	}{
+		{"NetBox", c.NetboxURL, c.NetboxRefreshInterval},
+		{"Infoblox", c.InfobloxURL, c.InfobloxRefreshInterval},
+		{"Kea", c.KeaURL, c.DHCPRefreshInterval},
+		{"Neutron", c.OpenstackNeutronURL, c.OpenstackRefreshInterval},
+		{"Keystone", c.OpenstackAuthURL, c.OpenstackRefreshInterval},
+	}
+	if c.SourceInitTimeout <= 0 {
+		return errors.New("Source init timeout should be positive")
+	}
+	if len(c.RestURLTemplates) > 0 && c.RestPrefixPath == "" {
+		return errors.New("REST IPAM prefix JSONPath should be set")
+	}
+	if len(c.RestURLTemplates) > 0 && c.RestRefreshInterval <= 0 {
+		return errors.New("REST IPAM refresh interval should be positive")
+	}
+	if c.DhcpdConfPath != "" && c.DHCPRefreshInterval <= 0 {
+		return errors.New("DHCP refresh interval should be positive")
+	}
+	for _, source := range sources {
+		if source.url == "" {
+			continue
+		}
+		if err := validateSourceURL(source.url); err != nil {
+			return errors.Wrapf(err, "Wrong %s URL", source.name)
+		}
+		if source.interval <= 0 {
+			return errors.Errorf("%s refresh interval should be positive", source.name)
+		}
+	}
+	if err := c.validateKubernetesSources(); err != nil {
+		return err
+	}
+	if err := c.validateInfrastructureSources(); err != nil {
+		return err
+	}
+	if err := c.validateCloudTagsSource(); err != nil {
+		return err
+	}
+	if (c.ExternalClientCertPath == "") != (c.ExternalClientKeyPath == "") {
+		return errors.New("External client certificate and key should be set together")
+	}
+	return c.validateHostSources()
+}
+
+// validateInfrastructureSources checks NSM registry URL, Ironic config map of the Metal3 source, Keystone
+// credentials and Kuryr config map settings of the OpenStack source
+func (c *Config) validateInfrastructureSources() error {
+	if err := c.validateRegistrySource(); err != nil {
+		return err
+	}
+	if c.Metal3Source && (c.Metal3IronicNamespace == "" || c.Metal3IronicConfigMapName == "") {
+		return errors.New("Ironic config map name and namespace should be set")
+	}
+	if c.OpenstackAuthURL != "" && (c.OpenstackCredentialID == "" || c.OpenstackCredentialPath == "") {
+		return errors.New("Keystone application credential ID and secret path should be set with Keystone URL")
+	}
+	if !c.KuryrConfigSource {
+		return nil
+	}
+	if c.KuryrConfigMapName == "" || c.KuryrConfigMapNamespace == "" {
+		return errors.New("Kuryr config map name and namespace should be set")
+	}
+	if c.OpenstackRefreshInterval <= 0 {
+		return errors.New("OpenStack refresh interval should be positive")
+	}
+	return nil
+}
+
+// validateCloudTagsSource checks tag, endpoints and credentials of the cloud providers of the cloud tags source
+func (c *Config) validateCloudTagsSource() error {
+	if len(c.AwsRegions) == 0 && len(c.GcpProjects) == 0 && len(c.AzureSubscriptions) == 0 {
+		return nil
+	}
+	if c.CloudTagsKey == "" {
+		return errors.New("Cloud tags key should be set")
+	}
+	if c.CloudTagsRefreshInterval <= 0 {
+		return errors.New("Cloud tags refresh interval should be positive")
+	}
+	if len(c.AwsRegions) > 0 && (c.AwsAccessKeyID == "" || c.AwsSecretKeyPath == "") {
+		return errors.New("AWS access key ID and secret key path should be set with AWS regions")
+	}
+	if len(c.AzureSubscriptions) > 0 {
+		if c.AzureClientID == "" && c.AzureTokenPath == "" {
+			return errors.New("Azure client ID or token path should be set with Azure subscriptions")
+		}
+		if c.AzureClientID != "" && (c.AzureTenantID == "" || c.AzureClientSecretPath == "") {
+			return errors.New("Azure tenant ID and client secret path should be set with Azure client ID")
+		}
+	}
+	endpoints := []struct {
+		name    string
+		url     string
+		enabled bool
+	}{
+		{"EC2", c.AwsEndpointURL, len(c.AwsRegions) > 0 && c.AwsEndpointURL != ""},
+		{"Compute Engine", c.GcpComputeURL, len(c.GcpProjects) > 0},
+		{"Azure Resource Manager", c.AzureManagementURL, len(c.AzureSubscriptions) > 0},
+		{"Microsoft identity platform", c.AzureLoginURL, len(c.AzureSubscriptions) > 0 && c.AzureClientID != ""},
+	}
+	for _, endpoint := range endpoints {
+		if !endpoint.enabled {
+			continue
+		}
+		if err := validateSourceURL(endpoint.url); err != nil {
+			return errors.Wrapf(err, "Wrong %s URL", endpoint.name)
+		}
+	}
+	return nil
+}
+
+// validateRegistrySource checks NSM registry URL, label and refresh interval
+func (c *Config) validateRegistrySource() error {
+	if c.RegistryURL == "" {
+		return nil
+	}
+	if registryURL, err := url.Parse(c.RegistryURL); err != nil || registryURL.Host == "" && registryURL.Path == "" {
+		return errors.New("Wrong NSM registry URL")
+	}
+	if c.RegistryCIDRsLabel == "" {
+		return errors.New("NSM registry CIDRs label should be set")
+	}
+	if c.RegistryRefreshInterval <= 0 {
+		return errors.New("NSM registry refresh interval should be positive")
+	}
+	return nil
+}
+
+// validateKubernetesSources checks namespaces and label selectors of the Kubernetes resources sources and Gateway API version
+func (c *Config) validateKubernetesSources() error {
+	for _, namespace := range c.ConfigMapNamespaces {
+		if namespace == AllNamespaces && len(c.ConfigMapNamespaces) > 1 {
+			return errors.New("All the user config map namespaces can't be combined with the other ones")
+		}
+		if namespace == "" {
+			return errors.New("User config map namespaces should not be empty")
+		}
+	}
+	if _, err := labels.Parse(c.ConfigMapSelector); err != nil {
+		return errors.Wrap(err, "Invalid user config maps label selector")
+	}
+	if _, err := labels.Parse(c.KubeadmConfigMapSelector); err != nil {
+		return errors.Wrap(err, "Invalid kubeadm config maps label selector")
+	}
+	if c.KubeadmConfigMapSelector != "" && len(c.KubeadmConfigMapNamespaces) == 0 {
+		return errors.New("Kubeadm config map namespaces should be set")
+	}
+	if _, err := labels.Parse(c.IngressControllerSelector); err != nil || c.IngressControllerSelector == "" {
+		return errors.New("Ingress controllers label selector should be valid and not empty")
+	}
+	for _, pattern := range c.CriticalServices {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, "/") {
+			return errors.Errorf("Critical service pattern %q should be valid namespace/name pattern", pattern)
+		}
+	}
+	if c.GatewayAPIVersion != "v1" && c.GatewayAPIVersion != "v1beta1" {
+		return errors.New("Gateway API version should be v1 or v1beta1")
+	}
+	return c.validateReservations()
+}
+
+// validateReservations checks the reservations config map of the reservations API and source
+func (c *Config) validateReservations() error {
+	if !c.ReservationSource && c.ReservationsListenAddress == "" {
+		return nil
+	}
+	if c.ReservationsConfigMapName == "" || c.ReservationsNamespace == "" {
+		return errors.New("Reservations config map name and namespace should be set")
+	}
+	// bearer tokens of the requesters shouldn't be sent in plain text
+	if c.ReservationsListenAddress != "" && c.APICertPath == "" {
+		return errors.New("Reservations API requires the API certificate, it is served over TLS only")
+	}
+	return nil
+}
+
+// validateCloudNetworkSource checks provider, metadata service URL and refresh interval of the cloud network source
+func (c *Config) validateCloudNetworkSource() error {
+	if c.CloudNetworkProvider == "" {
+		return nil
+	}
+	switch c.CloudNetworkProvider {
+	case "hetzner", "digitalocean", "linode":
+	default:
+		return errors.Errorf("Cloud network provider %q should be hetzner, digitalocean or linode", c.CloudNetworkProvider)
+	}
+	if c.CloudNetworkMetadataURL != "" {
+		if err := validateSourceURL(c.CloudNetworkMetadataURL); err != nil {
+			return errors.Wrap(err, "Invalid cloud provider metadata service URL")
+		}
+	}
+	if c.CloudNetworkRefreshInterval <= 0 {
+		return errors.New("Cloud network refresh interval should be positive")
+	}
+	return nil
+}
+
+// validateHostSources checks settings of the host routes, host network config, overlay, container runtime, HNS
+// and cloud network sources
+func (c *Config) validateHostSources() error {
+	if c.HostRoutesSource && c.HostRoutesRefreshInterval <= 0 {
+		return errors.New("Host routes refresh interval should be positive")
+	}
+	if len(c.NetworkdConfigDirs)+len(c.NetworkManagerConnectionDirs) > 0 && c.HostNetworkRefreshInterval <= 0 {
+		return errors.New("Host network config refresh interval should be positive")
+	}
+	for _, pattern := range c.HostRoutesExcludeInterfaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "Wrong host routes interface pattern %q", pattern)
+		}
+	}
+	if c.OverlaySource && c.OverlayRefreshInterval <= 0 {
+		return errors.New("Overlay interfaces refresh interval should be positive")
+	}
+	for _, pattern := range append(c.OverlayTailscaleInterfaces, c.OverlayWireguardInterfaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "Wrong overlay interface pattern %q", pattern)
+		}
+	}
+	if c.RuntimeNetworksSource && c.RuntimeRefreshInterval <= 0 {
+		return errors.New("Container runtime networks refresh interval should be positive")
+	}
+	for _, pattern := range append(c.RuntimeInterfaces, c.RuntimeCniConfigs...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "Wrong container runtime pattern %q", pattern)
+		}
+	}
+	if c.HnsSource && c.HnsRefreshInterval <= 0 {
+		return errors.New("HNS networks refresh interval should be positive")
+	}
+	for _, pattern := range c.HnsNetworks {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "Wrong HNS network pattern %q", pattern)
+		}
+	}
+	if err := c.validateCloudNetworkSource(); err != nil {
+		return err
+	}
+	return c.validateNodeSelectors()
+}
+
+// validateNodeSelectors checks node label selectors of the prefixes and the sources
+func (c *Config) validateNodeSelectors() error {
+	if len(c.NodeSelectorPrefixes)+len(c.SourceNodeSelectors) > 0 && c.NodeName == "" {
+		return errors.New("Node selectors require name of the collector node")
+	}
+	for selector, prefixes := range c.NodeSelectorPrefixes {
+		if _, err := labels.Parse(selector); err != nil {
+			return errors.Wrapf(err, "Invalid node selector %q of prefixes", selector)
+		}
+		if err := PrefixList(prefixes).Validate(); err != nil {
+			return errors.Wrapf(err, "Failed to parse prefixes of node selector %q", selector)
+		}
+	}
+	for name, selector := range c.SourceNodeSelectors {
+		if _, err := labels.Parse(selector); err != nil {
+			return errors.Wrapf(err, "Invalid node selector of %q source", name)
+		}
+	}
+	return nil
+}
+
+// validateAggregation checks run mode and settings of node agents reports
+func (c *Config) validateAggregation() error {
+	if (c.BlackholeRoutes || c.NftablesSets) && c.Mode != AgentMode {
+		return errors.New("Blackhole routes and nftables sets are supported only in agent mode")
+	}
+	switch c.Mode {
+	case CollectorMode:
+		if c.AggregatorListenURL == "" {
+			return nil
+		}
+		if _, err := url.Parse(c.AggregatorListenURL); err != nil {
+			return errors.Wrap(err, "Wrong aggregator listen URL")
+		}
+		if c.AgentReportTTL <= 0 {
+			return errors.New("Agent report TTL should be positive")
+		}
+	case AgentMode:
+		if c.AggregatorURL == "" {
+			return errors.New("Aggregator URL should be set in agent mode")
+		}
+		if _, err := url.Parse(c.AggregatorURL); err != nil {
+			return errors.Wrap(err, "Wrong aggregator URL")
+		}
+		if c.NodeName == "" {
+			return errors.New("Node name should be set in agent mode")
+		}
+		if c.AgentReportInterval <= 0 {
+			return errors.New("Agent report interval should be positive")
+		}
+		if c.BlackholeRoutes {
+			if _, err := NewBlackholeRoutes(c.BlackholeRoutesOptions()); err != nil {
+				return err
+			}
+		}
+		if c.NftablesSets {
+			if _, err := NewNftablesSets(c.NftablesTable, c.NftablesSet); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("Unknown mode %q", c.Mode)
+	}
+	return nil
+}
+
+// BlackholeRoutesOptions returns options of the node routes of the excluded prefixes
+func (c *Config) BlackholeRoutesOptions() *BlackholeRoutesOptions {
+	return &BlackholeRoutesOptions{
+		Type:   c.BlackholeRouteType,
+		Table:  c.BlackholeRouteTable,
+		Metric: c.BlackholeRouteMetric,
+		Ranges: c.BlackholeRouteRanges,
+	}
+}
+
+// validateFederation checks remote collectors settings
+func (c *Config) validateFederation() error {
+	if c.FederationMaxHops < 0 {
+		return errors.New("Federation max hops should not be negative")
+	}
+	if (c.APICertPath == "") != (c.APIKeyPath == "") {
+		return errors.New("Collector API certificate and key should be set together")
+	}
+	if c.APIClientCAPath != "" && c.APICertPath == "" {
+		return errors.New("Collector API client CA bundle requires the API certificate")
+	}
+	if len(c.APISpiffeIDs) > 0 && c.APIClientCAPath == "" {
+		return errors.New("Collector API SPIFFE IDs require the API client CA bundle")
+	}
+	for _, id := range c.APISpiffeIDs {
+		if err := utils.ValidateSpiffeID(id); err != nil {
+			return err
+		}
+	}
+	if c.AggregatorSpiffeID != "" {
+		if !c.AggregatorTLS {
+			return errors.New("Aggregator SPIFFE ID requires aggregator TLS")
+		}
+		if err := utils.ValidateSpiffeID(c.AggregatorSpiffeID); err != nil {
+			return err
+		}
+	}
+	if len(c.FederationPeers) == 0 {
+		return nil
+	}
+	if c.ClusterID == "" {
+		return errors.New("Cluster ID should be set to pull prefixes from remote collectors")
+	}
+	if c.FederationRefreshInterval <= 0 {
+		return errors.New("Federation refresh interval should be positive")
+	}
+	peers, err := c.FederationPeerURLs()
+	if err != nil {
+		return err
+	}
+	if _, ok := peers[c.ClusterID]; ok {
+		return errors.Errorf("Federation peer %q is the cluster itself", c.ClusterID)
+	}
+	return nil
+}
+
+// validateSinks checks strategies of combining prefixes of the sources and prefix tag selectors of the sinks
+func (c *Config) validateSinks() error {
+	for _, strategy := range []string{c.OutputMergeStrategy, c.AuditMergeStrategy} {
+		switch strategy {
+		case "", UnionMergeStrategy, PriorityOverrideMergeStrategy, IntersectionMergeStrategy:
+		default:
+			return errors.Errorf("Unknown merge strategy %q", strategy)
+		}
+	}
+	for _, selector := range []string{c.OutputSelector, c.AuditSelector} {
+		if _, err := labels.Parse(selector); err != nil {
+			return errors.Wrapf(err, "Invalid prefix tags selector %q", selector)
+		}
+	}
+	return c.validateQuotas()
+}
+
+// validateQuotas checks prefix quotas of the sources and their overflow policy
+func (c *Config) validateQuotas() error {
+	for name, quota := range c.SourceQuotas {
+		if quota < 0 {
+			return errors.Errorf("Prefix quota of %q source should not be negative", name)
+		}
+	}
+	switch c.SourceQuotaPolicy {
+	case QuotaTruncatePolicy, QuotaAlarmPolicy, QuotaRejectPolicy:
+		return c.validatePublicPrefixes()
+	default:
+		return errors.Errorf("Unknown source quota policy %q", c.SourceQuotaPolicy)
+	}
+}
+
+// validatePublicPrefixes checks policy of the prefixes covering public address space and the allowed ones
+func (c *Config) validatePublicPrefixes() error {
+	switch c.PublicPrefixesPolicy {
+	case PublicPrefixesWarnPolicy, PublicPrefixesBlockPolicy, PublicPrefixesIgnorePolicy:
+	default:
+		return errors.Errorf("Unknown public prefixes policy %q", c.PublicPrefixesPolicy)
+	}
+	if err := c.AllowedPublicPrefixes.Validate(); err != nil {
+		return errors.Wrap(err, "Failed to parse allowed public prefixes")
+	}
+	return c.validateChangelog()
+}
+
+// validateChangelog checks size of the changelog kept for the clients and number of the dashboard changes
+func (c *Config) validateChangelog() error {
+	if c.ChangelogListenAddress != "" && c.ChangelogSize <= 0 {
+		return errors.New("Changelog size should be positive")
+	}
+	if c.DashboardListenAddress != "" && c.DashboardChanges <= 0 {
+		return errors.New("Number of dashboard changes should be positive")
+	}
+	return c.validatePublisher()
+}
+
+// validatePublisher checks URL and topic of the message bus the prefixes changes are published to and BGP
+// session the prefixes are announced with
+func (c *Config) validatePublisher() error {
+	if c.PublisherURL != "" {
+		if _, err := NewPublisher(c.PublisherURL, c.PublisherTopic, nil, nil); err != nil {
+			return err
+		}
+	}
+	if c.BGPPeerAddress != "" {
+		if _, err := c.BGPOptions(); err != nil {
+			return err
+		}
+	}
+	return c.validateBackup()
+}
+
+// BGPOptions returns options of BGP session the excluded prefixes are announced with
+func (c *Config) BGPOptions() (*BGPOptions, error) {
+	options := &BGPOptions{
+		PeerAddress: c.BGPPeerAddress,
+		LocalAS:     c.BGPLocalAS,
+		PeerAS:      c.BGPPeerAS,
+		HoldTime:    c.BGPHoldTime,
+	}
+	var err error
+	if options.RouterID, err = parseBGPAddress(c.BGPRouterID); err != nil {
+		return nil, err
+	}
+	if options.NextHop, err = parseBGPAddress(c.BGPNextHop); err != nil {
+		return nil, err
+	}
+	if options.NextHopIPv6, err = parseBGPAddress(c.BGPNextHopIPv6); err != nil {
+		return nil, err
+	}
+	for _, value := range c.BGPCommunities {
+		community, err := ParseBGPCommunity(value)
+		if err != nil {
+			return nil, err
+		}
+		options.Communities = append(options.Communities, community)
+	}
+	if _, err := NewBGPAnnouncer(options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// parseBGPAddress parses IP address of BGP session setting, nil if value is empty
+func parseBGPAddress(value string) (net.IP, error) {
+	if value == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, errors.Errorf("Invalid BGP address %q", value)
+	}
+	return ip, nil
+}
+
+// validateBackup checks bucket, credentials and retention policy of the output backup
+func (c *Config) validateBackup() error {
+	if c.BackupBucketURL == "" {
+		if c.BackupRestore {
+			return errors.New("Backup restore requires backup bucket URL")
+		}
+		return nil
+	}
+	if c.BackupRestore && c.PrefixesOutputType != ConfigMapOutputType {
+		return errors.New("Backup restore is supported only for config map output")
+	}
+	if c.BackupRestoreHoldTime <= 0 {
+		return errors.New("Backup restore hold time should be positive")
+	}
+	if _, err := NewObjectStore(&ObjectStoreOptions{BucketURL: c.BackupBucketURL}); err != nil {
+		return err
+	}
+	if c.BackupAccessKeyID == "" || c.BackupSecretKeyPath == "" {
+		return errors.New("Backup access key ID and secret key path should be set with backup bucket URL")
+	}
+	if c.BackupRetention < 0 || c.BackupRetentionCount < 0 {
+		return errors.New("Backup retention should not be negative")
+	}
+	return nil
+}
+
+// FederationPeerURLs returns URLs of remote collectors by their cluster ids
+func (c *Config) FederationPeerURLs() (map[string]*url.URL, error) {
+	peers := make(map[string]*url.URL, len(c.FederationPeers))
+	for _, peer := range c.FederationPeers {
+		i := strings.Index(peer, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("Federation peer %q should be cluster-id=URL pair", peer)
+		}
+		cluster := peer[:i]
+		if _, ok := peers[cluster]; ok {
+			return nil, errors.Errorf("Duplicate federation peer %q", cluster)
+		}
+		peerURL, err := url.Parse(peer[i+1:])
+		if err != nil || peerURL.Host == "" && peerURL.Path == "" {
+			return nil, errors.Errorf("Wrong federation peer %q URL", cluster)
+		}
+		peers[cluster] = peerURL
+	}
+	return peers, nil
+}
+
+// validateSourceURL checks that value is absolute HTTP or HTTPS URL
+func validateSourceURL(value string) error {
+	sourceURL, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (sourceURL.Scheme != "http" && sourceURL.Scheme != "https") || sourceURL.Host == "" {
+		return errors.Errorf("%q is not an absolute HTTP(S) URL", value)
+	}
+	return nil
+}
+
+// validateConflicts checks that collector config maps don't overlap
+func (c *Config) validateConflicts() error {
+	if c.PrefixesOutputType != ConfigMapOutputType {
+		return nil
+	}
+	if c.AuditConfigMapName == c.NSMConfigMapName {
+		return errors.New("Audit config map should differ from nsm config map")
+	}
+	if c.CanaryConfigMapName != "" && (c.CanaryConfigMapName == c.NSMConfigMapName ||
+		c.CanaryConfigMapName == c.AuditConfigMapName) {
+		return errors.New("Canary config map should differ from nsm and audit config maps")
+	}
+	if c.SigningKeyPath != "" && c.PublicKeyConfigMapName == c.NSMConfigMapName {
+		return errors.New("Public key config map should differ from nsm config map")
+	}
+	if c.ConfigMapName == c.NSMConfigMapName && c.ConfigMapNamespace == c.nsmConfigMapNamespace() {
+		return errors.New("User config map should differ from nsm config map")
+	}
+
 	return nil
 }
+
+// nsmConfigMapNamespace returns namespace of nsm config map known from the config: the configured one,
+// the collector pod namespace by default
+func (c *Config) nsmConfigMapNamespace() string {
+	if c.NSMConfigMapNamespace != "" {
+		return c.NSMConfigMapNamespace
+	}
+	return c.PodNamespace
+}
+
+// UsesKubeconfig returns true if the collector runs against kubeconfig context instead of in cluster config
+func (c *Config) UsesKubeconfig() bool {
+	return c.Kubeconfig != "" || c.KubeconfigContext != ""
+}
+
+// UsesNSMNamespace returns true if the output or any of collector resources are placed in the NSM namespace
+func (c *Config) UsesNSMNamespace() bool {
+	return c.PrefixesOutputType == ConfigMapOutputType || c.AuditConfigMapName != "" || c.StatusResourceName != "" ||
+		c.NSMIPAMPoolConfigMapName != ""
+}
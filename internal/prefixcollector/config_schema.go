@@ -0,0 +1,117 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	// configKeysFormat is envconfig usage template listing environment variable and field names of the config
+	configKeysFormat = "{{range .}}{{usage_key .}}\t{{.Name}}\n{{end}}"
+)
+
+// configValuePatterns are patterns of environment variable values decoded to the config field types
+var configValuePatterns = map[reflect.Type]string{
+	reflect.TypeOf(false):            `^(1|0|t|f|T|F|true|false|TRUE|FALSE|True|False)$`,
+	reflect.TypeOf(0):                `^[+-]?[0-9]+$`,
+	reflect.TypeOf(int64(0)):         `^[+-]?[0-9]+$`,
+	reflect.TypeOf(uint32(0)):        `^[+]?[0-9]+$`,
+	reflect.TypeOf(float32(0)):       `^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`,
+	reflect.TypeOf([]int(nil)):       `^([+-]?[0-9]+(,[+-]?[0-9]+)*)?$`,
+	reflect.TypeOf(time.Duration(0)): `^([+-]?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+|0)$`,
+}
+
+// configValueEnums are allowed values of the config fields having fixed set of them
+var configValueEnums = map[string][]string{
+	"PrefixesOutputType":   {ConfigMapOutputType, FileOutputType},
+	"Mode":                 {CollectorMode, AgentMode},
+	"OutputMergeStrategy":  {UnionMergeStrategy, PriorityOverrideMergeStrategy, IntersectionMergeStrategy},
+	"AuditMergeStrategy":   {"", UnionMergeStrategy, PriorityOverrideMergeStrategy, IntersectionMergeStrategy},
+	"GatewayAPIVersion":    {"v1", "v1beta1"},
+	"PublicPrefixesPolicy": {PublicPrefixesWarnPolicy, PublicPrefixesBlockPolicy, PublicPrefixesIgnorePolicy},
+	"BlackholeRouteType":   {BlackholeRouteType, UnreachableRouteType},
+}
+
+// configSchema is JSON Schema of the config environment variables
+type configSchema struct {
+	Schema      string                     `json:"$schema"`
+	Title       string                     `json:"title"`
+	Description string                     `json:"description"`
+	Type        string                     `json:"type"`
+	Properties  map[string]*propertySchema `json:"properties"`
+}
+
+// propertySchema is JSON Schema of a single config environment variable
+type propertySchema struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// ConfigJSONSchema returns JSON Schema of the environment variables with prefix the Config is processed from.
+// All the values are strings as environment variables are, their patterns follow the decoded field types.
+func ConfigJSONSchema(prefix string) ([]byte, error) {
+	keys := &bytes.Buffer{}
+	if err := envconfig.Usagef(prefix, &Config{}, keys, configKeysFormat); err != nil {
+		return nil, errors.Wrap(err, "Failed to list config environment variables")
+	}
+
+	schema := &configSchema{
+		Schema:      jsonSchemaDraft,
+		Title:       "cmd-exclude-prefixes-k8s configuration",
+		Description: "Environment variables of the excluded prefixes collector",
+		Type:        "object",
+		Properties:  map[string]*propertySchema{},
+	}
+	configType := reflect.TypeOf(Config{})
+	scanner := bufio.NewScanner(keys)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		field, ok := configType.FieldByName(fields[1])
+		if !ok {
+			return nil, errors.Errorf("Unknown config field %s", fields[1])
+		}
+		schema.Properties[fields[0]] = &propertySchema{
+			Type:        "string",
+			Description: field.Tag.Get("desc"),
+			Default:     field.Tag.Get("default"),
+			Pattern:     configValuePatterns[field.Type],
+			Enum:        configValueEnums[field.Name],
+		}
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal config JSON Schema")
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixListDecode(t *testing.T) {
+	values := map[string]string{
+		"json":       `["10.0.0.0/8", " 172.16.0.0/12"]`,
+		"csv":        "10.0.0.0/8,172.16.0.0/12",
+		"whitespace": "10.0.0.0/8\n 172.16.0.0/12 ",
+	}
+	for name, value := range values {
+		var prefixes prefixcollector.PrefixList
+		require.NoError(t, prefixes.Decode(value), name)
+		require.Equal(t, prefixcollector.PrefixList{"10.0.0.0/8", "172.16.0.0/12"}, prefixes, name)
+	}
+
+	var prefixes prefixcollector.PrefixList
+	require.Error(t, prefixes.Decode(`["10.0.0.0/8",`))
+}
+
+func TestPrefixListValidate(t *testing.T) {
+	prefixes := prefixcollector.PrefixList{"10.0.0.0/8", "10.0.0/8", "fc00::/7", "fc00::"}
+	err := prefixes.Validate()
+	require.EqualError(t, err, `invalid CIDR in entry 2 "10.0.0/8", entry 4 "fc00::"`)
+}
+
+func TestPrefixListValid(t *testing.T) {
+	prefixes, err := prefixcollector.PrefixList{"10.0.0.0/8", "10.0.0/8", "fc00::/7"}.Valid()
+	require.NoError(t, err)
+	require.Equal(t, prefixcollector.PrefixList{"10.0.0.0/8", "fc00::/7"}, prefixes)
+
+	_, err = prefixcollector.PrefixList{"10.0.0/8", "fc00::"}.Valid()
+	require.EqualError(t, err, `invalid CIDR in entry 1 "10.0.0/8", entry 2 "fc00::"`)
+}
+
+func TestConfigValidateMixedPrefixes(t *testing.T) {
+	const env = "MIXED_TEST_EXCLUDED_PREFIXES"
+	defer func() { _ = os.Unsetenv(env) }()
+
+	values := map[string]string{
+		"json": `["10.0.0.0/8", "10.0.0/8", " 172.16.0.0/12"]`,
+		"csv":  "10.0.0.0/8,10.0.0/8,172.16.0.0/12",
+	}
+	for name, value := range values {
+		require.NoError(t, os.Setenv(env, value), name)
+		config := &prefixcollector.Config{}
+		require.NoError(t, envconfig.Process("mixed_test", config), name)
+		require.NoError(t, config.Validate(), name)
+		require.Equal(t, prefixcollector.PrefixList{"10.0.0.0/8", "172.16.0.0/12"}, config.ExcludedPrefixes, name)
+	}
+
+	require.NoError(t, os.Setenv(env, `["10.0.0/8", "fc00::"]`))
+	config := &prefixcollector.Config{}
+	require.NoError(t, envconfig.Process("mixed_test", config))
+	require.EqualError(t, config.Validate(),
+		`Failed to parse prefixes from environment: invalid CIDR in entry 1 "10.0.0/8", entry 2 "fc00::"`)
+}
+
+func TestScheduleListDecode(t *testing.T) {
+	var scheduled prefixcollector.ScheduleList
+	require.NoError(t, scheduled.Decode(`[
+		{"prefix": "10.0.0.0/8", "start": "2021-06-01T02:00:00Z"},
+		{"prefix": "10.0.0/8", "start": "2021-06-01T02:00:00Z", "end": "2021-06-01T01:00:00Z"},
+		{"prefix": "fc00::/7", "start": "2021-06-01T02:00:00Z", "end": "2021-06-01T01:00:00Z"}
+	]`))
+	require.Len(t, scheduled, 3)
+	require.True(t, scheduled[0].End.IsZero())
+	require.True(t, scheduled[0].Active(scheduled[0].Start))
+	require.False(t, scheduled[0].Active(scheduled[0].Start.Add(-time.Second)))
+
+	err := scheduled.Validate()
+	require.EqualError(t, err, `invalid entry 2 "10.0.0/8" CIDR, entry 3 "fc00::/7" schedule ending before start`)
+}
+
+func TestConfigJSONSchema(t *testing.T) {
+	data, err := prefixcollector.ConfigJSONSchema("exclude_prefixes_k8s")
+	require.NoError(t, err)
+
+	schema := struct {
+		Properties map[string]struct {
+			Default string   `json:"default"`
+			Pattern string   `json:"pattern"`
+			Enum    []string `json:"enum"`
+		} `json:"properties"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	require.Contains(t, schema.Properties, "EXCLUDE_PREFIXES_K8S_EXCLUDED_PREFIXES")
+	require.Equal(t, []string{"config-map", "file"}, schema.Properties["EXCLUDE_PREFIXES_K8S_PREFIXES_OUTPUT_TYPE"].Enum)
+
+	for key, property := range schema.Properties {
+		if property.Default != "" && property.Pattern != "" {
+			require.Regexp(t, property.Pattern, property.Default, key)
+		}
+		if property.Default != "" && property.Enum != nil {
+			require.Contains(t, property.Enum, property.Default, key)
+		}
+	}
+}
+
+func TestFeatureGatesDecode(t *testing.T) {
+	var gates prefixcollector.FeatureGates
+	require.NoError(t, gates.Decode(""))
+	require.False(t, gates.Enabled(prefixcollector.FederationFeature))
+	require.True(t, gates.Enabled(prefixcollector.CollectorAPIFeature))
+
+	require.NoError(t, gates.Decode("Federation=true, CollectorAPI=false"))
+	require.True(t, gates.Enabled(prefixcollector.FederationFeature))
+	require.False(t, gates.Enabled(prefixcollector.CollectorAPIFeature))
+
+	require.Error(t, gates.Decode("Federation"))
+	require.Error(t, gates.Decode("Federation=yes"))
+	require.EqualError(t, gates.Decode("Webhook=true"),
+		`unknown feature gate "Webhook", known ones are CollectorAPI, Federation`)
+}
+
+func TestPresetPrefixes(t *testing.T) {
+	prefixes, err := prefixcollector.PresetPrefixes([]string{"cgnat", "link-local"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"100.64.0.0/10", "169.254.0.0/16", "fe80::/10"}, prefixes)
+
+	for _, preset := range prefixcollector.Presets() {
+		presetPrefixes, err := prefixcollector.PresetPrefixes([]string{preset})
+		require.NoError(t, err)
+		require.NoError(t, prefixcollector.PrefixList(presetPrefixes).Validate(), preset)
+	}
+
+	_, err = prefixcollector.PresetPrefixes([]string{"rfc1918", "private"})
+	require.EqualError(t, err, `Unknown preset "private", known ones are benchmarking, cgnat, documentation, `+
+		`link-local, multicast, rfc1918, ula`)
+}
+
+func TestConfigValidateUserConfigMapConflict(t *testing.T) {
+	config := &prefixcollector.Config{}
+	require.NoError(t, envconfig.Process("conflict_test", config))
+	config.PrefixesOutputType = prefixcollector.ConfigMapOutputType
+	config.ConfigMapName = config.NSMConfigMapName
+	config.ConfigMapNamespace = "nsm-system"
+	require.NoError(t, config.Validate())
+
+	// nsm config map is placed in the collector namespace by default
+	config.PodNamespace = "nsm-system"
+	require.EqualError(t, config.Validate(), "User config map should differ from nsm config map")
+
+	config.NSMConfigMapNamespace = "nsm"
+	require.NoError(t, config.Validate())
+	config.NSMConfigMapNamespace = "nsm-system"
+	require.EqualError(t, config.Validate(), "User config map should differ from nsm config map")
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// PrefixesHashAnnotation is output config map annotation containing PrefixesHash of the written prefixes
+	PrefixesHashAnnotation = "networkservicemesh.io/excluded-prefixes-hash"
+	// AppliedHashAnnotation is consumer pod annotation acknowledging PrefixesHash of the prefixes the consumer
+	// applied last
+	AppliedHashAnnotation = "networkservicemesh.io/excluded-prefixes-applied-hash"
+)
+
+// consumerTracker tracks how many consumer pods acknowledged the latest written prefixes
+type consumerTracker struct {
+	namespace string
+	selector  labels.Selector
+	interval  time.Duration
+	// hash is hash of the latest written prefixes, writtenAt is time it is first observed at
+	hash      string
+	writtenAt time.Time
+}
+
+// WithConsumerTracking is ExcludedPrefixCollector option, which checks consumer pods selected by selector
+// in namespace every interval and reports in status how many of them acknowledged the latest prefixes
+// with AppliedHashAnnotation. Pods of all the namespaces are checked if namespace is empty.
+func WithConsumerTracking(namespace string, selector labels.Selector, interval time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.consumers = &consumerTracker{namespace: namespace, selector: selector, interval: interval}
+		collector.status.ConsumersTracked = true
+	}
+}
+
+// consumerTicks returns channel ticking when the consumers should be checked, nil if they aren't tracked
+func (epc *ExcludedPrefixCollector) consumerTicks() (ticks <-chan time.Time, stop func()) {
+	if epc.consumers == nil {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(epc.consumers.interval)
+	return ticker.C, ticker.Stop
+}
+
+// checkConsumers counts consumer pods, which applied the latest written prefixes, and reports status if it is changed
+func (epc *ExcludedPrefixCollector) checkConsumers(ctx context.Context) {
+	tracker := epc.consumers
+	if hash := PrefixesHash(epc.previousPrefixes.Load()); hash != tracker.hash {
+		tracker.hash = hash
+		tracker.writtenAt = time.Now().UTC()
+	}
+
+	pods, err := KubernetesInterface(ctx).CoreV1().Pods(tracker.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: tracker.selector.String(),
+	})
+	if err != nil {
+		logrus.Errorf("Failed to list consumer pods: %v", err)
+		return
+	}
+	var lagging []string
+	for i := range pods.Items {
+		if pods.Items[i].Annotations[AppliedHashAnnotation] != tracker.hash {
+			lagging = append(lagging, pods.Items[i].Namespace+"/"+pods.Items[i].Name)
+		}
+	}
+	sort.Strings(lagging)
+
+	consumers, upToDate := len(pods.Items), len(pods.Items)-len(lagging)
+	if consumers == epc.status.Consumers && upToDate == epc.status.ConsumersUpToDate {
+		return
+	}
+	epc.status.Consumers = consumers
+	epc.status.ConsumersUpToDate = upToDate
+	epc.status.PrefixesWrittenAt = tracker.writtenAt
+	if len(lagging) > 0 {
+		logrus.WithField("lagging", lagging).Infof("%d of %d consumers applied prefixes written %v ago",
+			upToDate, consumers, time.Since(tracker.writtenAt).Round(time.Second))
+	} else {
+		logrus.Infof("All %d consumers applied the latest prefixes", consumers)
+	}
+	epc.reportStatus(ctx)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func consumerPod(name, appliedHash string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   configMapNamespace,
+		Labels:      map[string]string{"app": "forwarder"},
+		Annotations: map[string]string{prefixcollector.AppliedHashAnnotation: appliedHash},
+	}}
+}
+
+func TestConsumerTracking(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	prefixes := []string{"10.96.0.0/12"}
+	hash := prefixcollector.PrefixesHash(prefixes)
+	clientSet := fake.NewSimpleClientset(consumerPod("forwarder-1", hash), consumerPod("forwarder-2", "outdated"))
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx := prefixcollector.WithKubernetesInterface(context.Background(), clientSet)
+	ctx, cancel := context.WithCancel(prefixcollector.WithDynamicInterface(ctx, dynamicClient))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithStatusResource(statusResourceName, configMapNamespace),
+		prefixcollector.WithConsumerTracking(configMapNamespace, labels.SelectorFromSet(labels.Set{"app": "forwarder"}),
+			20*time.Millisecond),
+		prefixcollector.WithSources(newDummyPrefixSource(prefixes)),
+	).Serve(ctx)
+
+	consumersReason := func() string {
+		resource, err := dynamicClient.Resource(prefixcollector.StatusResource).Namespace(configMapNamespace).
+			Get(ctx, statusResourceName, metav1.GetOptions{})
+		if err != nil {
+			return ""
+		}
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		for _, condition := range conditions {
+			if fields, ok := condition.(map[string]interface{}); ok && fields["type"] == prefixcollector.ConditionConsumersSynced {
+				return fields["reason"].(string)
+			}
+		}
+		return ""
+	}
+
+	require.Eventually(t, func() bool {
+		return consumersReason() == "ConsumersLagging"
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := clientSet.CoreV1().Pods(configMapNamespace).Update(ctx, consumerPod("forwarder-2", hash), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return consumersReason() == "AllConsumersSynced"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -17,15 +17,36 @@
 package prefixcollector
 
 import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"time"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
 type clientSetKeyType string
 
-// clientSetKey is ClientSet key in context map
-const clientSetKey clientSetKeyType = "clientsetKey"
+const (
+	// clientSetKey is ClientSet key in context map
+	clientSetKey clientSetKeyType = "clientsetKey"
+	// dynamicClientKey is dynamic client key in context map
+	dynamicClientKey clientSetKeyType = "dynamicClientKey"
+	// resourceVersionsKey is resource versions key in context map
+	resourceVersionsKey clientSetKeyType = "resourceVersionsKey"
+	// resyncSignalKey is resync signal key in context map
+	resyncSignalKey clientSetKeyType = "resyncSignalKey"
+	// refreshTimesKey is source refresh times key in context map
+	refreshTimesKey clientSetKeyType = "refreshTimesKey"
+	// lifecycleKey is sources lifecycle key in context map
+	lifecycleKey clientSetKeyType = "lifecycleKey"
+	// watchTimeoutKey is Kubernetes API watch timeout key in context map
+	watchTimeoutKey clientSetKeyType = "watchTimeoutKey"
+	// reauthSignalKey is re-authentication signal key in context map
+	reauthSignalKey clientSetKeyType = "reauthSignalKey"
+	// secretsCheckIntervalKey is mounted secrets check interval key in context map
+	secretsCheckIntervalKey clientSetKeyType = "secretsCheckIntervalKey"
+)
 
 // KubernetesInterface returns ClientSet from context ctx
 func KubernetesInterface(ctx context.Context) kubernetes.Interface {
@@ -36,3 +57,97 @@ func KubernetesInterface(ctx context.Context) kubernetes.Interface {
 func WithKubernetesInterface(ctx context.Context, clientSet kubernetes.Interface) context.Context {
 	return context.WithValue(ctx, clientSetKey, clientSet)
 }
+
+// DynamicInterface returns dynamic client from context ctx
+func DynamicInterface(ctx context.Context) dynamic.Interface {
+	return ctx.Value(dynamicClientKey).(dynamic.Interface)
+}
+
+// WithDynamicInterface puts dynamic client to context
+func WithDynamicInterface(ctx context.Context, client dynamic.Interface) context.Context {
+	return context.WithValue(ctx, dynamicClientKey, client)
+}
+
+// ResourceVersions returns resource versions container from context ctx, nil if it isn't set
+func ResourceVersions(ctx context.Context) *utils.ResourceVersions {
+	versions, _ := ctx.Value(resourceVersionsKey).(*utils.ResourceVersions)
+	return versions
+}
+
+// WithResourceVersions puts resource versions container to context
+func WithResourceVersions(ctx context.Context, versions *utils.ResourceVersions) context.Context {
+	return context.WithValue(ctx, resourceVersionsKey, versions)
+}
+
+// ResyncSignal returns forced resync signal from context ctx, nil if it isn't set
+func ResyncSignal(ctx context.Context) *utils.ResyncSignal {
+	signal, _ := ctx.Value(resyncSignalKey).(*utils.ResyncSignal)
+	return signal
+}
+
+// WithResyncSignal puts forced resync signal to context
+func WithResyncSignal(ctx context.Context, signal *utils.ResyncSignal) context.Context {
+	return context.WithValue(ctx, resyncSignalKey, signal)
+}
+
+// RefreshTimes returns source refresh times container from context ctx, nil if it isn't set
+func RefreshTimes(ctx context.Context) *utils.RefreshTimes {
+	times, _ := ctx.Value(refreshTimesKey).(*utils.RefreshTimes)
+	return times
+}
+
+// WithRefreshTimes puts source refresh times container to context
+func WithRefreshTimes(ctx context.Context, times *utils.RefreshTimes) context.Context {
+	return context.WithValue(ctx, refreshTimesKey, times)
+}
+
+// Lifecycle returns sources lifecycle from context ctx, nil if it isn't set
+func Lifecycle(ctx context.Context) *utils.Lifecycle {
+	lifecycle, _ := ctx.Value(lifecycleKey).(*utils.Lifecycle)
+	return lifecycle
+}
+
+// WithLifecycle puts sources lifecycle to context
+func WithLifecycle(ctx context.Context, lifecycle *utils.Lifecycle) context.Context {
+	return context.WithValue(ctx, lifecycleKey, lifecycle)
+}
+
+// WatchTimeoutSeconds returns timeout of Kubernetes API watches in seconds from context ctx, to be set in
+// their list options. Nil if it isn't set, so the API server picks a random one of its minimal request timeout.
+func WatchTimeoutSeconds(ctx context.Context) *int64 {
+	timeout, _ := ctx.Value(watchTimeoutKey).(time.Duration)
+	if timeout <= 0 {
+		return nil
+	}
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+	return &seconds
+}
+
+// WithWatchTimeout puts timeout of Kubernetes API watches to context
+func WithWatchTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, watchTimeoutKey, timeout)
+}
+
+// ReauthSignal returns signal requesting external sources to fetch prefixes with fresh credentials from context ctx,
+// nil if it isn't set
+func ReauthSignal(ctx context.Context) *utils.ResyncSignal {
+	signal, _ := ctx.Value(reauthSignalKey).(*utils.ResyncSignal)
+	return signal
+}
+
+// WithReauthSignal puts re-authentication signal to context
+func WithReauthSignal(ctx context.Context, signal *utils.ResyncSignal) context.Context {
+	return context.WithValue(ctx, reauthSignalKey, signal)
+}
+
+// SecretsCheckInterval returns interval of checking mounted secrets of external sources from context ctx,
+// 0 if it isn't set and the secrets aren't checked
+func SecretsCheckInterval(ctx context.Context) time.Duration {
+	interval, _ := ctx.Value(secretsCheckIntervalKey).(time.Duration)
+	return interval
+}
+
+// WithSecretsCheckInterval puts interval of checking mounted secrets of external sources to context
+func WithSecretsCheckInterval(ctx context.Context, interval time.Duration) context.Context {
+	return context.WithValue(ctx, secretsCheckIntervalKey, interval)
+}
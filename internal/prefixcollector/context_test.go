@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchTimeoutSeconds(t *testing.T) {
+	ctx := context.Background()
+	require.Nil(t, prefixcollector.WatchTimeoutSeconds(ctx))
+	require.Nil(t, prefixcollector.WatchTimeoutSeconds(prefixcollector.WithWatchTimeout(ctx, 0)))
+
+	timeout := prefixcollector.WatchTimeoutSeconds(prefixcollector.WithWatchTimeout(ctx, 5*time.Minute))
+	require.NotNil(t, timeout)
+	require.Equal(t, int64(300), *timeout)
+
+	// API server accepts whole seconds only, so shorter timeouts are rounded up
+	timeout = prefixcollector.WatchTimeoutSeconds(prefixcollector.WithWatchTimeout(ctx, 1500*time.Millisecond))
+	require.NotNil(t, timeout)
+	require.Equal(t, int64(2), *timeout)
+}
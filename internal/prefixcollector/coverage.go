@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PoolPrefixesKey is NSM config map key containing prefixes YAML of NSM IPAM pool
+	PoolPrefixesKey = "prefix_pool.yaml"
+	// coverageHistorySize is number of the latest coverage reports the trend is reported over
+	coverageHistorySize = 24
+)
+
+// WithPoolConfigMap is ExcludedPrefixCollector option, which loads NSM IPAM pool from PoolPrefixesKey of
+// configMapName config map in namespace on start and with every coverage report. Loaded pool replaces
+// the one of WithPoolLint.
+func WithPoolConfigMap(configMapName, namespace string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		lint := collector.ensurePoolLint()
+		lint.configMapName = configMapName
+		lint.namespace = namespace
+	}
+}
+
+// WithCoverageReport is ExcludedPrefixCollector option, which reports fraction of NSM IPAM pool left usable
+// by excluded prefixes and its trend every interval
+func WithCoverageReport(interval time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.ensurePoolLint().reportInterval = interval
+	}
+}
+
+// coverageTicks returns channel ticking when the pool coverage should be reported, nil if it isn't reported
+func (epc *ExcludedPrefixCollector) coverageTicks() (ticks <-chan time.Time, stop func()) {
+	if epc.poolLint == nil || epc.poolLint.reportInterval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(epc.poolLint.reportInterval)
+	return ticker.C, ticker.Stop
+}
+
+// loadPool loads the pool from the config map if it is set, the previous pool is kept on failure
+func (epc *ExcludedPrefixCollector) loadPool(ctx context.Context) {
+	if epc.poolLint == nil || epc.poolLint.configMapName == "" {
+		return
+	}
+	pool, err := loadPoolConfigMap(ctx, epc.poolLint.configMapName, epc.poolLint.namespace)
+	if err != nil {
+		logrus.Errorf("Failed to load NSM IPAM pool: %v", err)
+		return
+	}
+	if !utils.UnorderedSlicesEquals(pool, epc.poolLint.pool) {
+		logrus.Infof("NSM IPAM pool is loaded: %v", pool)
+		epc.poolLint.pool = pool
+	}
+}
+
+// loadPoolConfigMap returns pool prefixes of the config map, config map without PoolPrefixesKey has an empty pool
+func loadPoolConfigMap(ctx context.Context, name, namespace string) ([]string, error) {
+	configMap, err := KubernetesInterface(ctx).CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get config map '%s/%s'", namespace, name)
+	}
+	data, ok := configMap.Data[PoolPrefixesKey]
+	if !ok {
+		return nil, nil
+	}
+	pool, err := utils.YamlToPrefixes([]byte(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can not unmarshal %s of config map '%s/%s'", PoolPrefixesKey, namespace, name)
+	}
+	return pool, nil
+}
+
+// reportCoverage reloads the pool, reports fraction of its addresses left usable by the written prefixes
+// with the trend over the latest reports and lints the written prefixes against the reloaded pool
+func (epc *ExcludedPrefixCollector) reportCoverage(ctx context.Context) {
+	epc.loadPool(ctx)
+	lint := epc.poolLint
+	prefixes := epc.previousPrefixes.Load()
+
+	total, err := utils.FreeAddresses(lint.pool, nil)
+	if err != nil || total.Sign() == 0 {
+		logrus.Warnf("NSM IPAM pool coverage isn't reported, pool %v is empty or invalid", lint.pool)
+		return
+	}
+	free, err := utils.FreeAddresses(lint.pool, prefixes)
+	if err != nil {
+		logrus.Errorf("Failed to report NSM IPAM pool coverage: %v", err)
+		return
+	}
+	usable, _ := new(big.Rat).SetFrac(free, total).Float64()
+
+	lint.history = append(lint.history, usable)
+	if len(lint.history) > coverageHistorySize {
+		lint.history = lint.history[len(lint.history)-coverageHistorySize:]
+	}
+	logrus.WithFields(logrus.Fields{
+		"free":  free.String(),
+		"total": total.String(),
+		"trend": fmt.Sprintf("%+.2f%%", 100*(usable-lint.history[0])),
+	}).Infof("%.2f%% of NSM IPAM pool is usable after exclusions, trend is over the latest %d reports",
+		100*usable, len(lint.history))
+
+	epc.status.PoolUsable = fmt.Sprintf("%.2f%%", 100*usable)
+	epc.lintPool(ctx, prefixes)
+	epc.reportStatus(ctx)
+}
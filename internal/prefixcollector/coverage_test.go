@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPoolCoverageReport(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+		Data:       map[string]string{prefixcollector.PoolPrefixesKey: "prefixes:\n- 169.254.0.0/24\n"},
+	})
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx := prefixcollector.WithKubernetesInterface(context.Background(), clientSet)
+	ctx, cancel := context.WithCancel(prefixcollector.WithDynamicInterface(ctx, dynamicClient))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithStatusResource(statusResourceName, configMapNamespace),
+		prefixcollector.WithPoolConfigMap(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithCoverageReport(20*time.Millisecond),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.0.0.0/8", "169.254.0.0/25"})),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		resource, err := dynamicClient.Resource(prefixcollector.StatusResource).Namespace(configMapNamespace).
+			Get(ctx, statusResourceName, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		for _, condition := range conditions {
+			if fields, ok := condition.(map[string]interface{}); ok && fields["type"] == prefixcollector.ConditionPoolExhausted {
+				return fields["status"] == string(metav1.ConditionFalse) &&
+					strings.Contains(fields["message"].(string), "50.00% of the pool is usable")
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	_ "embed" // dashboard page is embedded
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DashboardPath is HTTP API path of read-only web UI of the collector, its state is served on DashboardPath+"state"
+	DashboardPath = "/dashboard/"
+
+	dashboardStatePath = DashboardPath + "state"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// DashboardSource is state of a single source shown by the dashboard
+type DashboardSource struct {
+	Name     string        `json:"name"`
+	Prefixes []string      `json:"prefixes"`
+	Health   *SourceHealth `json:"health,omitempty"`
+}
+
+// DashboardState is live state of the collector shown by the dashboard: prefixes of the sources and the output,
+// the latest changes and conditions of the collector status
+type DashboardState struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Output     []string          `json:"output"`
+	Sources    []DashboardSource `json:"sources"`
+	Changes    []*PrefixesChange `json:"changes"`
+	Conditions []Condition       `json:"conditions"`
+}
+
+// Dashboard keeps the latest changes and status of the collector for read-only web UI of operators without
+// the metrics stack, prefixes of the sources and the output are read live on every request
+type Dashboard struct {
+	mutex      sync.Mutex
+	size       int
+	sources    []PrefixSource
+	output     *utils.SynchronizedPrefixesContainer
+	changes    []*PrefixesChange
+	conditions []Condition
+}
+
+// NewDashboard creates Dashboard keeping size latest changes
+func NewDashboard(size int) *Dashboard {
+	return &Dashboard{size: size}
+}
+
+// WithDashboard is ExcludedPrefixCollector option, which shows the collector sources, output, changes and status
+// on dashboard
+func WithDashboard(dashboard *Dashboard) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.changeHandlers = append(collector.changeHandlers, func(_ context.Context, change *PrefixesChange) {
+			dashboard.appendChange(change)
+		})
+		collector.statusHandlers = append(collector.statusHandlers, func(_ context.Context, status *Status) {
+			dashboard.updateStatus(collector.sources, collector.previousPrefixes, status.Conditions())
+		})
+	}
+}
+
+// appendChange keeps change as the latest one
+func (d *Dashboard) appendChange(change *PrefixesChange) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.changes = append(d.changes, change)
+	if len(d.changes) > d.size {
+		d.changes = d.changes[len(d.changes)-d.size:]
+	}
+}
+
+// updateStatus stores sources and output of the collector and conditions of its status
+func (d *Dashboard) updateStatus(sources []PrefixSource, output *utils.SynchronizedPrefixesContainer, conditions []Condition) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.sources, d.output, d.conditions = sources, output, conditions
+}
+
+// State returns current state of the collector, the latest changes first
+func (d *Dashboard) State() *DashboardState {
+	d.mutex.Lock()
+	sources, output := d.sources, d.output
+	state := &DashboardState{
+		Timestamp:  time.Now().UTC(),
+		Output:     []string{},
+		Sources:    []DashboardSource{},
+		Changes:    make([]*PrefixesChange, 0, len(d.changes)),
+		Conditions: append([]Condition(nil), d.conditions...),
+	}
+	for i := len(d.changes) - 1; i >= 0; i-- {
+		state.Changes = append(state.Changes, d.changes[i])
+	}
+	d.mutex.Unlock()
+
+	if output != nil {
+		state.Output = append(state.Output, output.Load()...)
+		sort.Strings(state.Output)
+	}
+	health := SourcesHealth(sources)
+	for _, source := range sources {
+		dashboardSource := DashboardSource{
+			Name:     SourceName(source),
+			Prefixes: append([]string{}, source.Prefixes()...),
+		}
+		sort.Strings(dashboardSource.Prefixes)
+		if sourceHealth, ok := health[dashboardSource.Name]; ok {
+			dashboardSource.Health = &sourceHealth
+		}
+		state.Sources = append(state.Sources, dashboardSource)
+	}
+	return state
+}
+
+// DashboardHandler returns HTTP handler serving the dashboard page on GET DashboardPath requests and its JSON
+// state polled by the page on GET DashboardPath+"state" requests
+func DashboardHandler(dashboard *Dashboard) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", http.MethodGet)
+			http.Error(writer, "Only GET requests serve dashboard", http.StatusMethodNotAllowed)
+			return
+		}
+		switch request.URL.Path {
+		case DashboardPath:
+			writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = writer.Write(dashboardPage)
+		case dashboardStatePath:
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Header().Set("Cache-Control", "no-cache")
+			_ = json.NewEncoder(writer).Encode(dashboard.State())
+		default:
+			http.NotFound(writer, request)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestDashboard(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dashboard := prefixcollector.NewDashboard(10)
+	collectOnce(t,
+		prefixcollector.WithSources(
+			&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12", "10.244.0.0/16"}},
+			&namedPrefixSource{name: "netbox", prefixes: []string{"172.16.0.0/12"}},
+		),
+		prefixcollector.WithDashboard(dashboard),
+	)
+
+	server := httptest.NewServer(prefixcollector.DashboardHandler(dashboard))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	response, err := client.Get(server.URL + prefixcollector.DashboardPath)
+	require.NoError(t, err)
+	page, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.True(t, strings.HasPrefix(response.Header.Get("Content-Type"), "text/html"))
+	require.Contains(t, string(page), "Excluded prefixes collector")
+
+	var state prefixcollector.DashboardState
+	require.Eventually(t, func() bool {
+		response, err := client.Get(server.URL + prefixcollector.DashboardPath + "state")
+		require.NoError(t, err)
+		defer func() { _ = response.Body.Close() }()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&state))
+		return len(state.Conditions) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []string{"10.244.0.0/16", "10.96.0.0/12", "172.16.0.0/12"}, state.Output)
+	require.Equal(t, []prefixcollector.DashboardSource{
+		{Name: "kubeadm", Prefixes: []string{"10.244.0.0/16", "10.96.0.0/12"}},
+		{Name: "netbox", Prefixes: []string{"172.16.0.0/12"}},
+	}, state.Sources)
+	require.Len(t, state.Changes, 1)
+	require.ElementsMatch(t, []string{"10.96.0.0/12", "10.244.0.0/16", "172.16.0.0/12"}, state.Changes[0].Added)
+	require.Equal(t, prefixcollector.ConditionReady, state.Conditions[0].Type)
+
+	response, err = client.Post(server.URL+prefixcollector.DashboardPath+"state", "application/json", nil)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+// DiffKey is output config map key containing PrefixesDiff from the previously written prefixes
+const DiffKey = "excluded_prefixes_diff.yaml"
+
+// PrefixesDiff is change of the output prefixes. Consumer, which applied prefixes with From hash, applies
+// Added and Removed to get prefixes with To hash, others reread the full list. Diff without From adds all
+// the prefixes.
+type PrefixesDiff struct {
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// WithDiffKey is ExcludedPrefixCollector option, which publishes PrefixesDiff of configMap output under DiffKey
+// alongside the full list, so streaming consumers can apply changes incrementally
+func WithDiffKey() Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.diffKey = true
+	}
+}
+
+// writeDiffKey sets diff from the prefixes currently written to the config map to prefixes, if it is enabled
+// for the output. Should be called before the current prefixes are overwritten. Rewrite of the same prefixes
+// keeps the last diff.
+func writeDiffKey(configMap *apiV1.ConfigMap, prefixes []string, encoding string, output *configMapOutput) error {
+	if !output.diffKey {
+		delete(configMap.Data, DiffKey)
+		return nil
+	}
+	hash := PrefixesHash(prefixes)
+	previousHash := configMap.Annotations[PrefixesHashAnnotation]
+	if previousHash == hash && configMap.Data[DiffKey] != "" {
+		return nil
+	}
+
+	diff := &PrefixesDiff{To: hash, Added: prefixes, Removed: []string{}}
+	if previous, ok := writtenPrefixes(configMap); ok && previousHash != "" && PrefixesHash(previous) == previousHash {
+		diff.From = previousHash
+		diff.Added = utils.Difference(prefixes, previous)
+		diff.Removed = utils.Difference(previous, prefixes)
+	}
+	data, err := yaml.Marshal(diff)
+	if err != nil {
+		return errors.Wrap(err, "Can not marshal prefixes diff")
+	}
+	configMap.Data[DiffKey], err = encodePayload(data, encoding)
+	return err
+}
+
+// writtenPrefixes returns prefixes currently written to the config map in v1 or v2 schema
+func writtenPrefixes(configMap *apiV1.ConfigMap) ([]string, bool) {
+	encoding := configMap.Annotations[EncodingAnnotation]
+	if payload, ok := configMap.Data[configMapKey]; ok {
+		prefixes, err := DecodePrefixes(payload, encoding)
+		return prefixes, err == nil
+	}
+	if payload, ok := configMap.Data[SchemaV2Key]; ok {
+		document, err := DecodeDocument(payload, encoding)
+		if err != nil {
+			return nil, false
+		}
+		prefixes := make([]string, 0, len(document.Prefixes))
+		for _, entry := range document.Prefixes {
+			prefixes = append(prefixes, entry.Prefix)
+		}
+		return prefixes, true
+	}
+	return nil, false
+}
+
+// DecodeDiff decodes diff payload in the encoding, which is the value of EncodingAnnotation
+func DecodeDiff(payload, encoding string) (*PrefixesDiff, error) {
+	data, err := decodePayload(payload, encoding)
+	if err != nil {
+		return nil, err
+	}
+	diff := &PrefixesDiff{}
+	if err = yaml.Unmarshal(data, diff); err != nil {
+		return nil, errors.Wrap(err, "Can not unmarshal prefixes diff")
+	}
+	return diff, nil
+}
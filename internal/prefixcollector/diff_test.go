@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffKey(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	notifyChan := make(chan struct{}, 1)
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	source.Store([]string{"10.96.0.0/12", "10.244.0.0/16"})
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithDiffKey(),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	diff := func() *prefixcollector.PrefixesDiff {
+		configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		diff, err := prefixcollector.DecodeDiff(configMap.Data[prefixcollector.DiffKey], "")
+		if err != nil {
+			return nil
+		}
+		return diff
+	}
+
+	firstHash := prefixcollector.PrefixesHash([]string{"10.96.0.0/12", "10.244.0.0/16"})
+	require.Eventually(t, func() bool {
+		d := diff()
+		return d != nil && d.To == firstHash
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, diff().From)
+	require.ElementsMatch(t, []string{"10.96.0.0/12", "10.244.0.0/16"}, diff().Added)
+
+	source.Store([]string{"10.96.0.0/12", "172.16.0.0/12"})
+	notifyChan <- struct{}{}
+	require.Eventually(t, func() bool {
+		d := diff()
+		return d != nil && d.From == firstHash
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"172.16.0.0/12"}, diff().Added)
+	require.Equal(t, []string{"10.244.0.0/16"}, diff().Removed)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EncodingAnnotation is output config map annotation containing encoding of the excluded prefixes payload.
+	// Payload without the annotation is plain YAML.
+	EncodingAnnotation = "networkservicemesh.io/excluded-prefixes-encoding"
+	// AcceptEncodingAnnotation is output config map annotation containing comma separated list of payload encodings
+	// supported by all the consumers. It is set by the consumers deployment, payload is encoded only if they accept it.
+	AcceptEncodingAnnotation = "networkservicemesh.io/excluded-prefixes-accept-encoding"
+	// GzipBase64Encoding is encoding of the payload compressed with gzip and encoded with base64
+	GzipBase64Encoding = "gzip+base64"
+)
+
+// WithOutputCompression is ExcludedPrefixCollector option, which enables gzip+base64 encoding of configMap output
+// payload, when the output config map accepts it
+func WithOutputCompression() Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.compress = true
+	}
+}
+
+// payloadEncoding returns encoding of the payload written to the output config map
+func payloadEncoding(configMap *apiV1.ConfigMap, output *configMapOutput) string {
+	if !output.compress {
+		return ""
+	}
+	for _, encoding := range strings.Split(configMap.Annotations[AcceptEncodingAnnotation], ",") {
+		if strings.TrimSpace(encoding) == GzipBase64Encoding {
+			return GzipBase64Encoding
+		}
+	}
+	return ""
+}
+
+// setEncoding sets encoding annotation of the config map, plain YAML payload has no annotation
+func setEncoding(configMap *apiV1.ConfigMap, encoding string) {
+	if encoding == "" {
+		delete(configMap.Annotations, EncodingAnnotation)
+		return
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[EncodingAnnotation] = encoding
+}
+
+// encodePrefixes returns prefixes payload in the encoding
+func encodePrefixes(prefixes []string, encoding string) (string, error) {
+	data, err := utils.PrefixesToYaml(prefixes)
+	if err != nil {
+		return "", errors.Wrap(err, "Can not create marshal prefixes")
+	}
+	return encodePayload(data, encoding)
+}
+
+// DecodePrefixes decodes prefixes payload in the encoding, which is the value of EncodingAnnotation
+func DecodePrefixes(payload, encoding string) ([]string, error) {
+	data, err := decodePayload(payload, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return utils.YamlToPrefixes(data)
+}
+
+// encodePayload returns data in the encoding
+func encodePayload(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return string(data), nil
+	case GzipBase64Encoding:
+		buffer := &bytes.Buffer{}
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(data); err != nil {
+			return "", errors.Wrap(err, "Can not compress payload")
+		}
+		if err := writer.Close(); err != nil {
+			return "", errors.Wrap(err, "Can not compress payload")
+		}
+		return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+	default:
+		return "", errors.Errorf("Unknown payload encoding %q", encoding)
+	}
+}
+
+// decodePayload returns data of the payload in the encoding
+func decodePayload(payload, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(payload), nil
+	case GzipBase64Encoding:
+		compressed, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "Can not decode base64 payload")
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, errors.Wrap(err, "Can not decompress payload")
+		}
+		data, err := ioutil.ReadAll(reader)
+		return data, errors.Wrap(err, "Can not decompress payload")
+	default:
+		return nil, errors.Errorf("Unknown payload encoding %q", encoding)
+	}
+}
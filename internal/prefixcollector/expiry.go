@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"time"
+)
+
+// ExpiringPrefixSource is PrefixSource knowing when its prefixes stop being excluded, e.g. scheduled ones.
+// Remaining time of the prefixes is published as TTL of v2 schema entries.
+type ExpiringPrefixSource interface {
+	PrefixSource
+	// PrefixesExpiry returns end times of the expiring prefixes of the source, prefixes without end aren't returned
+	PrefixesExpiry() map[string]time.Time
+}
+
+// sourcesPrefixesExpiry returns the earliest end times of the prefixes of the expiring sources
+func sourcesPrefixesExpiry(sources []PrefixSource) map[string]time.Time {
+	expiry := map[string]time.Time{}
+	for _, source := range sources {
+		expiringSource, ok := source.(ExpiringPrefixSource)
+		if !ok {
+			continue
+		}
+		for prefix, end := range expiringSource.PrefixesExpiry() {
+			if earliest, ok := expiry[prefix]; !ok || end.Before(earliest) {
+				expiry[prefix] = end
+			}
+		}
+	}
+	return expiry
+}
+
+// AttributeTTLs sets TTL of the entries containing expiring prefixes of expiry to the time from now until
+// the earliest of them ends, since the entry changes then. Prefixes ending before now are skipped.
+func AttributeTTLs(entries []PrefixEntry, expiry map[string]time.Time, now time.Time) {
+	entryIndex := prefixEntryIndex(entries)
+	entryEnds := map[int]time.Time{}
+	for prefix, end := range expiry {
+		i, ok := containingEntry(entryIndex, prefix)
+		if !ok || !end.After(now) {
+			continue
+		}
+		if earliest, ok := entryEnds[i]; !ok || end.Before(earliest) {
+			entryEnds[i] = end
+		}
+	}
+	for i, end := range entryEnds {
+		entries[i].TTL = end.Sub(now).Round(time.Second).String()
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeTTLs(t *testing.T) {
+	entries, err := prefixcollector.PrefixEntries([]string{"10.0.0.0/15", "10.2.0.0/16", "fd00::/64"}, nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	prefixcollector.AttributeTTLs(entries, map[string]time.Time{
+		"10.0.0.0/16": now.Add(2 * time.Hour),
+		"10.1.0.0/16": now.Add(90 * time.Minute),
+		"fd00::/64":   now.Add(-time.Minute),
+	}, now)
+
+	// aggregated entry changes when the first of its prefixes expires
+	require.Equal(t, "1h30m0s", entries[0].TTL)
+	require.Empty(t, entries[1].TTL)
+	require.Empty(t, entries[2].TTL)
+}
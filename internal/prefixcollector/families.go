@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+const (
+	// IPv4PrefixesKey is output config map key containing IPv4 part of the excluded prefixes in v1 schema
+	IPv4PrefixesKey = "excluded_prefixes_v4.yaml"
+	// IPv6PrefixesKey is output config map key containing IPv6 part of the excluded prefixes in v1 schema
+	IPv6PrefixesKey = "excluded_prefixes_v6.yaml"
+)
+
+// WithFamilyKeys is ExcludedPrefixCollector option, which publishes IPv4 and IPv6 prefixes of configMap output
+// under separate keys alongside the combined list, so single stack consumers don't need to filter them.
+// The family keys are signed in their KeySignatureAnnotation if the output is signed.
+func WithFamilyKeys() Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.familyKeys = true
+	}
+}
+
+// writeFamilyKeys sets per family payloads to the config map, if they are enabled for the output
+func writeFamilyKeys(configMap *apiV1.ConfigMap, prefixes []string, encoding string, output *configMapOutput) error {
+	delete(configMap.Data, IPv4PrefixesKey)
+	delete(configMap.Data, IPv6PrefixesKey)
+	if !output.familyKeys {
+		return nil
+	}
+
+	ipv4Prefixes, ipv6Prefixes, err := splitFamilies(prefixes)
+	if err != nil {
+		return err
+	}
+	if configMap.Data[IPv4PrefixesKey], err = encodePrefixes(ipv4Prefixes, encoding); err != nil {
+		return err
+	}
+	configMap.Data[IPv6PrefixesKey], err = encodePrefixes(ipv6Prefixes, encoding)
+	return err
+}
+
+// splitFamilies returns IPv4 and IPv6 prefixes of the list
+func splitFamilies(prefixes []string) (ipv4Prefixes, ipv6Prefixes []string, err error) {
+	ipv4Prefixes, ipv6Prefixes = []string{}, []string{}
+	for _, prefix := range prefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Wrong CIDR: %v", prefix)
+		}
+		if len(ipNet.IP) == net.IPv4len {
+			ipv4Prefixes = append(ipv4Prefixes, prefix)
+		} else {
+			ipv6Prefixes = append(ipv6Prefixes, prefix)
+		}
+	}
+	return ipv4Prefixes, ipv6Prefixes, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FederationFeature gates pulling prefixes from remote collectors and serving them to remote collectors
+	FederationFeature = "Federation"
+	// CollectorAPIFeature gates gRPC API of the collector serving node agents reports and federation requests
+	CollectorAPIFeature = "CollectorAPI"
+)
+
+// defaultFeatureGates are enablement of the features by default, experimental features are disabled
+var defaultFeatureGates = map[string]bool{
+	FederationFeature:   false,
+	CollectorAPIFeature: true,
+}
+
+// FeatureGates is map of feature names to their enablement overriding the defaults, decoded from comma
+// separated Name=bool pairs like Kubernetes feature gates
+type FeatureGates map[string]bool
+
+// Decode decodes FeatureGates from value
+func (g *FeatureGates) Decode(value string) error {
+	gates := FeatureGates{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return errors.Errorf("feature gate %q should be Name=bool pair", pair)
+		}
+		name := strings.TrimSpace(pair[:i])
+		if _, ok := defaultFeatureGates[name]; !ok {
+			return errors.Errorf("unknown feature gate %q, known ones are %s", name, strings.Join(Features(), ", "))
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return errors.Wrapf(err, "invalid value of feature gate %q", name)
+		}
+		gates[name] = enabled
+	}
+	*g = gates
+	return nil
+}
+
+// Enabled returns true if feature is enabled by the gates or by default
+func (g FeatureGates) Enabled(feature string) bool {
+	if enabled, ok := g[feature]; ok {
+		return enabled
+	}
+	return defaultFeatureGates[feature]
+}
+
+// Features returns sorted names of the gated features
+func Features() []string {
+	features := make([]string, 0, len(defaultFeatureGates))
+	for feature := range defaultFeatureGates {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
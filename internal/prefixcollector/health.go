@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SourceHealth is health and counters reported by a source
+type SourceHealth struct {
+	Healthy bool `json:"healthy"`
+	// Message describes why the source is unhealthy
+	Message string `json:"message,omitempty"`
+	// Counters are monotonic counters of the source by name, e.g. fetches or errors
+	Counters map[string]uint64 `json:"counters,omitempty"`
+}
+
+// HealthReportingSource is PrefixSource reporting own health and counters, e.g. external or sidecar source.
+// The collector reports unhealthy sources in SourcesDegraded condition and exposes health and counters of
+// the sources in its metrics. Source should notify the collector event bus when its health changes.
+type HealthReportingSource interface {
+	PrefixSource
+	Health() SourceHealth
+}
+
+// SourcesHealth returns health of the health reporting sources by their names
+func SourcesHealth(sources []PrefixSource) map[string]SourceHealth {
+	health := map[string]SourceHealth{}
+	for _, source := range sources {
+		if healthSource, ok := source.(HealthReportingSource); ok {
+			health[SourceName(source)] = healthSource.Health()
+		}
+	}
+	return health
+}
+
+// updateSourcesHealth observes health of the sources in metrics and reports status if the unhealthy sources
+// are changed
+func (epc *ExcludedPrefixCollector) updateSourcesHealth(ctx context.Context) {
+	health := SourcesHealth(epc.sources)
+	if len(health) == 0 {
+		return
+	}
+	var unhealthy []string
+	for name, sourceHealth := range health {
+		if epc.propagation != nil {
+			epc.propagation.ObserveHealth(name, sourceHealth)
+		}
+		if !sourceHealth.Healthy {
+			unhealthy = append(unhealthy, name+": "+sourceHealth.Message)
+		}
+	}
+	sort.Strings(unhealthy)
+	if utils.UnorderedSlicesEquals(unhealthy, epc.status.UnhealthySources) {
+		return
+	}
+	if len(unhealthy) > 0 {
+		logrus.Warnf("Sources report unhealthy state: %v", unhealthy)
+	} else {
+		logrus.Info("All the sources report healthy state")
+	}
+	epc.status.UnhealthySources = unhealthy
+	epc.reportStatus(ctx)
+}
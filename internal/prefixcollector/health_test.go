@@ -0,0 +1,123 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type healthSource struct {
+	mutex  sync.Mutex
+	health prefixcollector.SourceHealth
+}
+
+func (s *healthSource) Prefixes() []string {
+	return []string{"10.96.0.0/12"}
+}
+
+func (s *healthSource) Name() string {
+	return "sidecar"
+}
+
+func (s *healthSource) Health() prefixcollector.SourceHealth {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.health
+}
+
+func (s *healthSource) setHealth(health prefixcollector.SourceHealth) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.health = health
+}
+
+func TestSourcesHealth(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx, cancel := context.WithCancel(prefixcollector.WithDynamicInterface(context.Background(), dynamicClient))
+	defer cancel()
+
+	source := &healthSource{health: prefixcollector.SourceHealth{
+		Message:  "upstream is unavailable",
+		Counters: map[string]uint64{"fetches": 3, "errors": 1},
+	}}
+	bus := utils.NewEventBus()
+	metrics := prefixcollector.NewPropagationMetrics()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithPropagationMetrics(metrics),
+		prefixcollector.WithStatusResource(statusResourceName, configMapNamespace),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	degraded := func() (reason, message string) {
+		resource, err := dynamicClient.Resource(prefixcollector.StatusResource).Namespace(configMapNamespace).
+			Get(ctx, statusResourceName, metav1.GetOptions{})
+		if err != nil {
+			return "", ""
+		}
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		for _, condition := range conditions {
+			if fields, ok := condition.(map[string]interface{}); ok && fields["type"] == prefixcollector.ConditionSourcesDegraded {
+				reason, _ = fields["reason"].(string)
+				message, _ = fields["message"].(string)
+				return reason, message
+			}
+		}
+		return "", ""
+	}
+	require.Eventually(t, func() bool {
+		reason, message := degraded()
+		return reason == "SourcesUnhealthy" && message == "Sources report unhealthy state: sidecar: upstream is unavailable"
+	}, time.Second, 10*time.Millisecond)
+
+	server := httptest.NewServer(prefixcollector.MetricsHandler(metrics))
+	defer server.Close()
+	response, err := http.Get(server.URL + prefixcollector.MetricsPath)
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	output := &bytes.Buffer{}
+	_, err = output.ReadFrom(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, output.String(), prefixcollector.SourceHealthyMetric+`{source="sidecar"} 0`)
+	require.Contains(t, output.String(), prefixcollector.SourceCounterMetric+`_total{source="sidecar",counter="errors"} 1`)
+	require.Contains(t, output.String(), prefixcollector.SourceCounterMetric+`_total{source="sidecar",counter="fetches"} 3`)
+
+	source.setHealth(prefixcollector.SourceHealth{Healthy: true})
+	bus.Source(source.Name()).Notify()
+	require.Eventually(t, func() bool {
+		reason, _ := degraded()
+		return reason == "AllSourcesServed"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestServeWaitsForSources(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	lifecycle := utils.NewLifecycle()
+	ctx, cancel := context.WithCancel(prefixcollector.WithLifecycle(context.Background(), lifecycle))
+
+	stopped := make(chan struct{})
+	lifecycle.Go("slow", func() {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		close(stopped)
+	})
+
+	served := make(chan struct{})
+	go func() {
+		prefixcollector.NewExcludePrefixCollector(
+			prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+			prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+		).Serve(ctx)
+		close(served)
+	}()
+
+	cancel()
+	<-served
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Serve returned before the source is stopped")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	lifecycle := utils.NewLifecycle()
+	ctx, cancel := context.WithCancel(prefixcollector.WithLifecycle(context.Background(), lifecycle))
+
+	release := make(chan struct{})
+	defer close(release)
+	lifecycle.Go("leaked", func() { <-release })
+
+	served := make(chan struct{})
+	go func() {
+		prefixcollector.NewExcludePrefixCollector(
+			prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+			prefixcollector.WithShutdownTimeout(50*time.Millisecond),
+		).Serve(ctx)
+		close(served)
+	}()
+
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case <-served:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
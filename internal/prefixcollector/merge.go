@@ -0,0 +1,194 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// UnionMergeStrategy combines prefixes of all the sources
+	UnionMergeStrategy = "union"
+	// PriorityOverrideMergeStrategy drops prefixes overlapping prefixes of a higher priority source
+	PriorityOverrideMergeStrategy = "priority-override"
+	// IntersectionMergeStrategy keeps only address ranges provided by every source having prefixes
+	IntersectionMergeStrategy = "intersection"
+)
+
+// WithOutputMergeStrategy is ExcludedPrefixCollector option, which sets how prefixes of the sources are combined
+// for the output
+func WithOutputMergeStrategy(strategy string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.outputMergeStrategy = strategy
+	}
+}
+
+// WithAuditMergeStrategy is ExcludedPrefixCollector option, which sets how prefixes of the sources are combined
+// for the audit. Audit uses the output strategy by default.
+func WithAuditMergeStrategy(strategy string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.auditMergeStrategy = strategy
+	}
+}
+
+// WithSourcePriorities is ExcludedPrefixCollector option, which sets names of the sources from the highest
+// priority to the lowest one for priority-override strategy. Sources not listed have the lowest priority.
+func WithSourcePriorities(names ...string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.sourcePriorities = names
+	}
+}
+
+// sourceSet is prefixes of the named source
+type sourceSet struct {
+	name     string
+	scope    string
+	prefixes []string
+}
+
+// mergePrefixes combines prefixes of the source sets in the collector order with strategy and aggregates
+// the result
+func mergePrefixes(strategy string, sets []sourceSet, priorities []string) ([]string, error) {
+	switch strategy {
+	case UnionMergeStrategy, "":
+		var prefixes []string
+		for i := range sets {
+			prefixes = append(prefixes, sets[i].prefixes...)
+		}
+		return utils.AggregatePrefixes(prefixes)
+	case PriorityOverrideMergeStrategy:
+		return priorityOverride(priorityLevels(sets, priorities))
+	case IntersectionMergeStrategy:
+		return intersection(sets)
+	default:
+		return nil, errors.Errorf("Unknown merge strategy %q", strategy)
+	}
+}
+
+// priorityLevels groups source sets by priority from the highest one, not listed sources share the lowest level
+func priorityLevels(sets []sourceSet, priorities []string) [][]sourceSet {
+	levels := make([][]sourceSet, len(priorities)+1)
+	for _, set := range sets {
+		level := len(priorities)
+		for i, priority := range priorities {
+			if set.name == priority {
+				level = i
+				break
+			}
+		}
+		levels[level] = append(levels[level], set)
+	}
+	return levels
+}
+
+// priorityOverride keeps prefixes of every level, which don't overlap prefixes of the higher levels
+func priorityOverride(levels [][]sourceSet) ([]string, error) {
+	var accepted []*net.IPNet
+	for _, level := range levels {
+		var levelNetworks []*net.IPNet
+		for i := range level {
+			networks, err := parseNetworks(level[i].prefixes)
+			if err != nil {
+				return nil, err
+			}
+			for _, network := range networks {
+				if !overlapsAny(network, accepted) {
+					levelNetworks = append(levelNetworks, network)
+				}
+			}
+		}
+		accepted = append(accepted, levelNetworks...)
+	}
+	return aggregateNetworks(accepted)
+}
+
+// intersection returns address ranges provided by every source set having prefixes
+func intersection(sets []sourceSet) ([]string, error) {
+	var result []*net.IPNet
+	first := true
+	for i := range sets {
+		if len(sets[i].prefixes) == 0 {
+			continue
+		}
+		networks, err := parseNetworks(sets[i].prefixes)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			result, first = networks, false
+			continue
+		}
+		result = intersectNetworks(result, networks)
+	}
+	return aggregateNetworks(result)
+}
+
+// intersectNetworks returns the smaller network of every overlapping pair of x and y networks
+func intersectNetworks(x, y []*net.IPNet) []*net.IPNet {
+	var result []*net.IPNet
+	for _, xNetwork := range x {
+		for _, yNetwork := range y {
+			if !overlaps(xNetwork, yNetwork) {
+				continue
+			}
+			xOnes, _ := xNetwork.Mask.Size()
+			yOnes, _ := yNetwork.Mask.Size()
+			if xOnes >= yOnes {
+				result = append(result, xNetwork)
+			} else {
+				result = append(result, yNetwork)
+			}
+		}
+	}
+	return result
+}
+
+func overlaps(x, y *net.IPNet) bool {
+	return x.Contains(y.IP) || y.Contains(x.IP)
+}
+
+func overlapsAny(network *net.IPNet, networks []*net.IPNet) bool {
+	for _, other := range networks {
+		if overlaps(network, other) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNetworks(prefixes []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		_, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid prefix %q", prefix)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func aggregateNetworks(networks []*net.IPNet) ([]string, error) {
+	prefixes := make([]string, 0, len(networks))
+	for _, network := range networks {
+		prefixes = append(prefixes, network.String())
+	}
+	return utils.AggregatePrefixes(prefixes)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+type namedPrefixSource struct {
+	name     string
+	prefixes []string
+}
+
+func (s *namedPrefixSource) Prefixes() []string {
+	return s.prefixes
+}
+
+func (s *namedPrefixSource) Name() string {
+	return s.name
+}
+
+func mergeSources() []prefixcollector.PrefixSource {
+	return []prefixcollector.PrefixSource{
+		&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12", "10.244.0.0/16"}},
+		&namedPrefixSource{name: "configmap", prefixes: []string{"10.96.0.0/16", "192.168.0.0/16"}},
+		&namedPrefixSource{name: "netbox", prefixes: []string{"10.0.0.0/8", "10.244.1.0/24", "172.16.0.0/12"}},
+		&namedPrefixSource{name: "empty"},
+	}
+}
+
+// collectOnce serves collector with options until the first output is written and returns it
+func collectOnce(t *testing.T, options ...prefixcollector.Option) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	written := make(chan []string, 1)
+	options = append(options, prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+		select {
+		case written <- prefixes:
+		default:
+		}
+		return nil
+	}))
+	go prefixcollector.NewExcludePrefixCollector(options...).Serve(ctx)
+
+	select {
+	case prefixes := <-written:
+		return prefixes
+	case <-time.After(time.Second):
+		require.FailNow(t, "Output is not written")
+		return nil
+	}
+}
+
+func TestOutputMergeStrategies(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, testCase := range []struct {
+		name       string
+		strategy   string
+		priorities []string
+		expected   []string
+	}{
+		{
+			name:     "union",
+			strategy: prefixcollector.UnionMergeStrategy,
+			expected: []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+		},
+		{
+			name:       "priority-override",
+			strategy:   prefixcollector.PriorityOverrideMergeStrategy,
+			priorities: []string{"configmap", "kubeadm"},
+			expected:   []string{"10.96.0.0/16", "10.244.0.0/16", "172.16.0.0/12", "192.168.0.0/16"},
+		},
+		{
+			name:     "intersection",
+			strategy: prefixcollector.IntersectionMergeStrategy,
+			expected: []string{"10.96.0.0/16"},
+		},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, collectOnce(t,
+				prefixcollector.WithSources(mergeSources()...),
+				prefixcollector.WithOutputMergeStrategy(testCase.strategy),
+				prefixcollector.WithSourcePriorities(testCase.priorities...),
+			))
+		})
+	}
+}
+
+func TestAuditMergeStrategy(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	auditFilePath := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	require.Equal(t, []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}, collectOnce(t,
+		prefixcollector.WithSources(mergeSources()...),
+		prefixcollector.WithAuditFile(auditFilePath),
+		prefixcollector.WithAuditMergeStrategy(prefixcollector.IntersectionMergeStrategy),
+	))
+
+	require.Eventually(t, func() bool {
+		data, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+		return err == nil && strings.HasSuffix(string(data), "\n")
+	}, time.Second, 10*time.Millisecond)
+
+	data, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+	require.NoError(t, err)
+	change := &prefixcollector.PrefixesChange{}
+	require.NoError(t, json.Unmarshal(data, change))
+	require.Equal(t, []string{"10.96.0.0/16"}, change.Added)
+}
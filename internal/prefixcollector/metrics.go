@@ -0,0 +1,247 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// MetricsPath is HTTP API path serving the collector metrics in OpenMetrics text format
+	MetricsPath = "/metrics"
+	// PropagationLatencyMetric is histogram of latency from a source notification to the output write
+	// containing its prefixes, labeled by the source
+	PropagationLatencyMetric = "exclude_prefixes_propagation_latency_seconds"
+	// SourceHealthyMetric is gauge of the health reporting sources, 1 if the source is healthy, labeled by the source
+	SourceHealthyMetric = "exclude_prefixes_source_healthy"
+	// SourceCounterMetric is counter reported by the health reporting sources, labeled by the source and counter name
+	SourceCounterMetric = "exclude_prefixes_source_counter"
+
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// propagationLatencyBuckets are upper bounds of the propagation latency histogram buckets in seconds
+var propagationLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// PropagationMetrics are latencies of the sources notifications propagation to the output and health of
+// the health reporting sources. Every histogram bucket keeps exemplar of the last latency observed in it
+// with trace id of the output write.
+type PropagationMetrics struct {
+	mutex   sync.Mutex
+	sources map[string]*latencyHistogram
+	health  map[string]SourceHealth
+}
+
+// latencyHistogram is histogram of latencies of a single source, counts aren't cumulative and the last one is +Inf
+type latencyHistogram struct {
+	counts    []uint64
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+// exemplar is observed latency in seconds with id of the trace it was observed in
+type exemplar struct {
+	traceID   string
+	value     float64
+	timestamp time.Time
+}
+
+// NewPropagationMetrics creates PropagationMetrics
+func NewPropagationMetrics() *PropagationMetrics {
+	return &PropagationMetrics{sources: map[string]*latencyHistogram{}, health: map[string]SourceHealth{}}
+}
+
+// WithPropagationMetrics is ExcludedPrefixCollector option, which observes latency of the notifications published
+// to the collector event bus until the output write in metrics
+func WithPropagationMetrics(metrics *PropagationMetrics) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.propagation = metrics
+	}
+}
+
+// Observe adds latency of the source notification written to the output at now in trace traceID.
+// Exemplar isn't kept if traceID is empty.
+func (m *PropagationMetrics) Observe(source string, latency time.Duration, traceID string, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	histogram, ok := m.sources[source]
+	if !ok {
+		histogram = &latencyHistogram{
+			counts:    make([]uint64, len(propagationLatencyBuckets)+1),
+			exemplars: make([]*exemplar, len(propagationLatencyBuckets)+1),
+		}
+		m.sources[source] = histogram
+	}
+
+	value := latency.Seconds()
+	bucket := sort.SearchFloat64s(propagationLatencyBuckets, value)
+	histogram.counts[bucket]++
+	histogram.sum += value
+	histogram.count++
+	if traceID != "" {
+		histogram.exemplars[bucket] = &exemplar{traceID: traceID, value: value, timestamp: now}
+	}
+}
+
+// ObserveHealth sets the last health reported by the source
+func (m *PropagationMetrics) ObserveHealth(source string, health SourceHealth) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.health[source] = health
+}
+
+// Write writes the metrics to writer in OpenMetrics text format
+func (m *PropagationMetrics) Write(writer io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sources := make([]string, 0, len(m.sources))
+	for source := range m.sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	buffer := bufio.NewWriter(writer)
+	_, _ = fmt.Fprintf(buffer, "# TYPE %s histogram\n", PropagationLatencyMetric)
+	_, _ = fmt.Fprintf(buffer, "# HELP %s Latency from a source notification to the output write.\n", PropagationLatencyMetric)
+	_, _ = fmt.Fprintf(buffer, "# UNIT %s seconds\n", PropagationLatencyMetric)
+	for _, source := range sources {
+		histogram := m.sources[source]
+		var cumulative uint64
+		for i, count := range histogram.counts {
+			cumulative += count
+			bound := "+Inf"
+			if i < len(propagationLatencyBuckets) {
+				bound = formatFloat(propagationLatencyBuckets[i])
+			}
+			_, _ = fmt.Fprintf(buffer, "%s_bucket{source=%q,le=%q} %d", PropagationLatencyMetric, source, bound, cumulative)
+			if e := histogram.exemplars[i]; e != nil {
+				_, _ = fmt.Fprintf(buffer, " # {trace_id=%q} %s %s", e.traceID, formatFloat(e.value),
+					formatFloat(float64(e.timestamp.UnixNano())/float64(time.Second)))
+			}
+			_, _ = fmt.Fprintln(buffer)
+		}
+		_, _ = fmt.Fprintf(buffer, "%s_sum{source=%q} %s\n", PropagationLatencyMetric, source, formatFloat(histogram.sum))
+		_, _ = fmt.Fprintf(buffer, "%s_count{source=%q} %d\n", PropagationLatencyMetric, source, histogram.count)
+	}
+	if len(m.health) > 0 {
+		m.writeHealth(buffer)
+	}
+	_, _ = fmt.Fprintln(buffer, "# EOF")
+	return buffer.Flush()
+}
+
+// writeHealth writes health and counters of the health reporting sources to buffer
+func (m *PropagationMetrics) writeHealth(buffer *bufio.Writer) {
+	sources := make([]string, 0, len(m.health))
+	for source := range m.health {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	_, _ = fmt.Fprintf(buffer, "# TYPE %s gauge\n", SourceHealthyMetric)
+	_, _ = fmt.Fprintf(buffer, "# HELP %s Whether the source reports healthy state.\n", SourceHealthyMetric)
+	for _, source := range sources {
+		healthy := 0
+		if m.health[source].Healthy {
+			healthy = 1
+		}
+		_, _ = fmt.Fprintf(buffer, "%s{source=%q} %d\n", SourceHealthyMetric, source, healthy)
+	}
+	_, _ = fmt.Fprintf(buffer, "# TYPE %s counter\n", SourceCounterMetric)
+	_, _ = fmt.Fprintf(buffer, "# HELP %s Counters reported by the source.\n", SourceCounterMetric)
+	for _, source := range sources {
+		counters := m.health[source].Counters
+		names := make([]string, 0, len(counters))
+		for name := range counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(buffer, "%s_total{source=%q,counter=%q} %d\n", SourceCounterMetric, source, name, counters[name])
+		}
+	}
+}
+
+// MetricsHandler returns HTTP handler serving metrics on GET requests
+func MetricsHandler(metrics *PropagationMetrics) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", http.MethodGet)
+			http.Error(writer, "Only GET requests serve metrics", http.StatusMethodNotAllowed)
+			return
+		}
+		writer.Header().Set("Content-Type", openMetricsContentType)
+		_ = metrics.Write(writer)
+	})
+}
+
+// takePendingEvents merges the event bus notifications pending since the previous update into the ones
+// not written to the output yet, keeping the earliest notification of every source
+func (epc *ExcludedPrefixCollector) takePendingEvents() {
+	if epc.propagation == nil || epc.eventBus == nil {
+		return
+	}
+	if epc.pendingEvents == nil {
+		epc.pendingEvents = map[string]time.Time{}
+	}
+	for source, notified := range epc.eventBus.TakePending() {
+		if previous, ok := epc.pendingEvents[source]; !ok || notified.Before(previous) {
+			epc.pendingEvents[source] = notified
+		}
+	}
+}
+
+// observePropagation observes latency of the pending notifications written to the output in span
+func (epc *ExcludedPrefixCollector) observePropagation(span opentracing.Span) {
+	if epc.propagation == nil {
+		return
+	}
+	now := time.Now()
+	id := traceID(span)
+	for source, notified := range epc.pendingEvents {
+		epc.propagation.Observe(source, now.Sub(notified), id, now)
+	}
+	epc.pendingEvents = nil
+}
+
+// traceID returns id of the trace span belongs to, empty if the span isn't traced by Jaeger
+func traceID(span opentracing.Span) string {
+	if span == nil {
+		return ""
+	}
+	spanContext, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !spanContext.IsValid() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// formatFloat formats value in the shortest OpenMetrics representation
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"cmd-exclude-prefixes-k8s/pkg/sourcetest"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/goleak"
+)
+
+func TestPropagationMetrics(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer func() { _ = closer.Close() }()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	generator := sourcetest.NewLoadGenerator(1, 2, 0.5, 1)
+	bus := utils.NewEventBus()
+	metrics := prefixcollector.NewPropagationMetrics()
+	written := make(chan struct{}, 1)
+	collector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error {
+			written <- struct{}{}
+			return nil
+		}),
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithPropagationMetrics(metrics),
+		prefixcollector.WithSources(generator.Sources()...),
+	)
+	done := make(chan struct{})
+	go func() {
+		collector.Serve(ctx)
+		close(done)
+	}()
+	<-written
+
+	generator.Churn()
+	bus.Source("synthetic-0").Notify()
+	<-written
+
+	server := httptest.NewServer(prefixcollector.MetricsHandler(metrics))
+	defer server.Close()
+	response, err := http.Get(server.URL + prefixcollector.MetricsPath)
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	output := &bytes.Buffer{}
+	_, err = output.ReadFrom(response.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, output.String(), prefixcollector.PropagationLatencyMetric+`_count{source="synthetic-0"} 1`)
+	require.Contains(t, output.String(), prefixcollector.PropagationLatencyMetric+`_bucket{source="synthetic-0",le="+Inf"} 1`)
+	require.Regexp(t, regexp.MustCompile(`_bucket\{source="synthetic-0",le="[^"]+"\} 1 # \{trace_id="[0-9a-f]+"\} [0-9.e-]+ [0-9.e+]+`), output.String())
+	require.Regexp(t, regexp.MustCompile(`# EOF\n$`), output.String())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("collector isn't stopped")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixcollector
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// inNetworkNamespace runs f in a new network namespace, so it can change the node routes and nftables without
+// affecting the host. f runs in another goroutine, so it should only record the results checked by the test.
+// The test is skipped without CAP_SYS_ADMIN, tests run in the privileged container have it.
+func inNetworkNamespace(t *testing.T, f func()) {
+	created := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the thread isn't unlocked, so it exits with the goroutine instead of running the other goroutines
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			created <- false
+			return
+		}
+		created <- true
+		f()
+	}()
+	<-done
+	if !<-created {
+		t.Skip("Network namespace can not be created")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultNftablesTable is inet nftables table of the excluded prefixes sets
+	DefaultNftablesTable = "nsm"
+	// DefaultNftablesSet is name prefix of the excluded prefixes sets
+	DefaultNftablesSet = "excluded-prefixes"
+
+	// nftablesMaxNameLength is maximum length of nftables table and set names
+	nftablesMaxNameLength = 255
+)
+
+// NftablesSets maintains interval sets of IPv4 and IPv6 excluded prefixes in inet nftables table of the node,
+// named with -ipv4 and -ipv6 suffixes, so firewall rules and other host tooling can reference the current
+// exclusion set, e.g. ip daddr @excluded-prefixes-ipv4 drop. Table and sets are created if they are missing,
+// elements of the sets are replaced in a single nftables transaction, so they are never seen partially updated.
+// Sets are kept when the agent stops, since rules may reference them.
+type NftablesSets struct {
+	table string
+	set   string
+	mutex sync.Mutex
+}
+
+// nftablesSet is interval set of networks of a single family
+type nftablesSet struct {
+	name     string
+	ipv6     bool
+	networks []*net.IPNet
+}
+
+// NewNftablesSets creates NftablesSets of set name prefix in the inet table
+func NewNftablesSets(table, set string) (*NftablesSets, error) {
+	for _, name := range []string{table, set + "-ipv4"} {
+		if name == "" || len(name) > nftablesMaxNameLength || strings.ContainsAny(name, " \t\r\n") {
+			return nil, errors.Errorf("nftables name %q should be non-empty, contain no whitespace and be at most %d characters",
+				name, nftablesMaxNameLength)
+		}
+	}
+	return &NftablesSets{table: table, set: set}, nil
+}
+
+// IPv4Set returns name of the set of IPv4 excluded prefixes
+func (s *NftablesSets) IPv4Set() string {
+	return s.set + "-ipv4"
+}
+
+// IPv6Set returns name of the set of IPv6 excluded prefixes
+func (s *NftablesSets) IPv6Set() string {
+	return s.set + "-ipv6"
+}
+
+// Sync replaces elements of the sets with prefixes
+func (s *NftablesSets) Sync(prefixes []string) error {
+	aggregated, err := utils.AggregatePrefixes(prefixes)
+	if err != nil {
+		return errors.Wrap(err, "Failed to aggregate excluded prefixes")
+	}
+	var ipv4, ipv6 []*net.IPNet
+	for _, prefix := range aggregated {
+		_, ipNet, _ := net.ParseCIDR(prefix)
+		if ipNet.IP.To4() != nil {
+			ipv4 = append(ipv4, ipNet)
+		} else {
+			ipv6 = append(ipv6, ipNet)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return syncNftablesSets(s.table, []*nftablesSet{
+		{name: s.IPv4Set(), networks: ipv4},
+		{name: s.IPv6Set(), ipv6: true, networks: ipv6},
+	})
+}
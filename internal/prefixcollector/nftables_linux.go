@@ -0,0 +1,209 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"encoding/binary"
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// nf_tables netlink protocol constants of linux/netfilter/nfnetlink.h and linux/netfilter/nf_tables.h
+const (
+	nfnlSubsysNftables = 10
+	nfnlMsgBatchBegin  = 0x10
+	nfnlMsgBatchEnd    = 0x11
+	nfprotoInet        = 1
+
+	nftMsgNewTable   = 0
+	nftMsgNewSet     = 9
+	nftMsgNewSetElem = 12
+	nftMsgDelSetElem = 14
+
+	nftaTableName           = 1
+	nftaSetTable            = 1
+	nftaSetName             = 2
+	nftaSetFlags            = 3
+	nftaSetKeyType          = 4
+	nftaSetKeyLen           = 5
+	nftaSetID               = 10
+	nftaSetElemListTable    = 1
+	nftaSetElemListSet      = 2
+	nftaSetElemListElements = 3
+	nftaListElem            = 1
+	nftaSetElemKey          = 1
+	nftaSetElemFlags        = 3
+	nftaDataValue           = 1
+
+	nftSetInterval        = 0x4
+	nftSetElemIntervalEnd = 0x1
+	nlaFNested            = 0x8000
+
+	// nftTypeIPAddr and nftTypeIP6Addr are nft data types of the set keys
+	nftTypeIPAddr  = 7
+	nftTypeIP6Addr = 8
+
+	// nftablesElementsPerMessage limits the set elements added by a single netlink message
+	nftablesElementsPerMessage = 256
+)
+
+// nftablesBatch is batch of nf_tables netlink messages applied by the kernel in a single transaction
+type nftablesBatch struct {
+	data  []byte
+	count uint32
+	// seqs are sequence numbers of the messages requesting acknowledgement
+	seqs []uint32
+}
+
+// syncNftablesSets creates inet table and interval sets if they are missing and replaces elements of the sets
+// with their networks in a single transaction
+func syncNftablesSets(table string, sets []*nftablesSet) error {
+	batch := nftablesSetsBatch(table, sets)
+
+	conn, err := dialNetlink(syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Close(conn) }()
+	// batch may exceed the default send buffer of the socket
+	_ = syscall.SetsockoptInt(conn, syscall.SOL_SOCKET, syscall.SO_SNDBUFFORCE, len(batch.data))
+
+	return errors.Wrapf(requestNetlink(conn, batch.data, batch.seqs...), "Failed to update nftables sets of %s table", table)
+}
+
+// nftablesSetsBatch returns batch creating table and sets and replacing elements of the sets
+func nftablesSetsBatch(table string, sets []*nftablesSet) *nftablesBatch {
+	batch := &nftablesBatch{}
+	batch.add(nfnlMsgBatchBegin, 0, 0, nil)
+	batch.add(nftMsgNewTable, syscall.NLM_F_CREATE|syscall.NLM_F_ACK, nfprotoInet,
+		appendNetlinkAttribute(nil, nftaTableName, nftablesString(table)))
+
+	for i, set := range sets {
+		keyType, keyLen := uint32(nftTypeIPAddr), uint32(net.IPv4len)
+		if set.ipv6 {
+			keyType, keyLen = nftTypeIP6Addr, net.IPv6len
+		}
+		var attributes []byte
+		attributes = appendNetlinkAttribute(attributes, nftaSetTable, nftablesString(table))
+		attributes = appendNetlinkAttribute(attributes, nftaSetName, nftablesString(set.name))
+		attributes = appendNetlinkAttribute(attributes, nftaSetFlags, bigEndianUint32(nftSetInterval))
+		attributes = appendNetlinkAttribute(attributes, nftaSetKeyType, bigEndianUint32(keyType))
+		attributes = appendNetlinkAttribute(attributes, nftaSetKeyLen, bigEndianUint32(keyLen))
+		attributes = appendNetlinkAttribute(attributes, nftaSetID, bigEndianUint32(uint32(i+1)))
+		batch.add(nftMsgNewSet, syscall.NLM_F_CREATE|syscall.NLM_F_ACK, nfprotoInet, attributes)
+
+		// deleting elements without the list flushes the set
+		setAttributes := appendNetlinkAttribute(nil, nftaSetElemListTable, nftablesString(table))
+		setAttributes = appendNetlinkAttribute(setAttributes, nftaSetElemListSet, nftablesString(set.name))
+		batch.add(nftMsgDelSetElem, syscall.NLM_F_ACK, nfprotoInet, setAttributes)
+
+		elements := intervalElements(set.networks)
+		for len(elements) > 0 {
+			n := len(elements)
+			if n > nftablesElementsPerMessage {
+				n = nftablesElementsPerMessage
+			}
+			var list []byte
+			for _, element := range elements[:n] {
+				list = appendNetlinkAttribute(list, nftaListElem|nlaFNested, element)
+			}
+			elements = elements[n:]
+			batch.add(nftMsgNewSetElem, syscall.NLM_F_CREATE|syscall.NLM_F_ACK, nfprotoInet,
+				appendNetlinkAttribute(setAttributes, nftaSetElemListElements|nlaFNested, list))
+		}
+	}
+	batch.add(nfnlMsgBatchEnd, 0, 0, nil)
+	return batch
+}
+
+// add appends nf_tables message of msgType with nfgenmsg of family and attributes to the batch. Batch begin and
+// end messages are addressed to nf_tables subsystem.
+func (b *nftablesBatch) add(msgType, flags uint16, family uint8, attributes []byte) {
+	seq := b.count + 1
+	if msgType != nfnlMsgBatchBegin && msgType != nfnlMsgBatchEnd {
+		msgType |= nfnlSubsysNftables << 8
+	}
+	resID := uint16(0)
+	if family == 0 {
+		resID = nfnlSubsysNftables
+	}
+
+	message := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+4+len(attributes))
+	message = append(message, family, 0, byte(resID>>8), byte(resID))
+	message = append(message, attributes...)
+	utils.NativeEndian.PutUint32(message[0:4], uint32(len(message)))
+	utils.NativeEndian.PutUint16(message[4:6], msgType)
+	utils.NativeEndian.PutUint16(message[6:8], syscall.NLM_F_REQUEST|flags)
+	utils.NativeEndian.PutUint32(message[8:12], seq)
+	b.data = append(b.data, message...)
+	b.count++
+	if flags&syscall.NLM_F_ACK != 0 {
+		b.seqs = append(b.seqs, seq)
+	}
+}
+
+// intervalElements returns nested attributes of interval set elements of sorted non-overlapping networks: key of
+// the first address of every network and key of the address following it flagged as interval end
+func intervalElements(networks []*net.IPNet) [][]byte {
+	var elements [][]byte
+	for _, network := range networks {
+		start := network.IP.To4()
+		if start == nil {
+			start = network.IP.To16()
+		}
+		elements = append(elements, appendNetlinkAttribute(nil, nftaSetElemKey|nlaFNested,
+			appendNetlinkAttribute(nil, nftaDataValue, start)))
+
+		end := make([]byte, len(start))
+		mask := network.Mask
+		if len(mask) != len(start) {
+			mask = mask[len(mask)-len(start):]
+		}
+		carry := true
+		for i := len(start) - 1; i >= 0; i-- {
+			end[i] = start[i] | ^mask[i]
+			if carry {
+				end[i]++
+				carry = end[i] == 0
+			}
+		}
+		if carry {
+			// the network ends at the last address, so the interval has no end
+			continue
+		}
+		element := appendNetlinkAttribute(nil, nftaSetElemKey|nlaFNested, appendNetlinkAttribute(nil, nftaDataValue, end))
+		elements = append(elements, appendNetlinkAttribute(element, nftaSetElemFlags, bigEndianUint32(nftSetElemIntervalEnd)))
+	}
+	return elements
+}
+
+// nftablesString returns NUL-terminated nf_tables string attribute value
+func nftablesString(value string) []byte {
+	return append([]byte(value), 0)
+}
+
+func bigEndianUint32(value uint32) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, value)
+	return data
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNftablesIntervalElements(t *testing.T) {
+	networks := func(prefixes ...string) []*net.IPNet {
+		var result []*net.IPNet
+		for _, prefix := range prefixes {
+			_, ipNet, err := net.ParseCIDR(prefix)
+			require.NoError(t, err)
+			result = append(result, ipNet)
+		}
+		return result
+	}
+	element := func(key []byte, end bool) []byte {
+		element := appendNetlinkAttribute(nil, nftaSetElemKey|nlaFNested, appendNetlinkAttribute(nil, nftaDataValue, key))
+		if end {
+			element = appendNetlinkAttribute(element, nftaSetElemFlags, bigEndianUint32(nftSetElemIntervalEnd))
+		}
+		return element
+	}
+
+	require.Equal(t, [][]byte{
+		element([]byte{10, 0, 1, 0}, false), element([]byte{10, 0, 2, 0}, true),
+		element([]byte{10, 0, 255, 0}, false), element([]byte{10, 1, 0, 0}, true),
+		// the last network has no interval end
+		element([]byte{255, 255, 255, 0}, false),
+	}, intervalElements(networks("10.0.1.0/24", "10.0.255.0/24", "255.255.255.0/24")))
+	require.Equal(t, [][]byte{
+		element(net.ParseIP("fd00::"), false), element(net.ParseIP("fd00:0:0:1::"), true),
+	}, intervalElements(networks("fd00::/64")))
+}
+
+func TestNftablesSetsBatch(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+	var ipv4 []*net.IPNet
+	for i := 0; i < nftablesElementsPerMessage+1; i++ {
+		ipv4 = append(ipv4, &net.IPNet{IP: net.IPv4(10, byte(i>>8), byte(i), 0).To4(), Mask: net.CIDRMask(24, 32)})
+	}
+	batch := nftablesSetsBatch("nsm", []*nftablesSet{
+		{name: "excluded-prefixes-ipv4", networks: append(ipv4, ipNet)},
+		{name: "excluded-prefixes-ipv6", ipv6: true},
+	})
+
+	messages, err := syscall.ParseNetlinkMessage(batch.data)
+	require.NoError(t, err)
+	var types []uint16
+	for i := range messages {
+		require.Equal(t, uint32(i+1), messages[i].Header.Seq)
+		types = append(types, messages[i].Header.Type)
+	}
+	nft := func(msgType uint16) uint16 { return nfnlSubsysNftables<<8 | msgType }
+	require.Equal(t, []uint16{
+		nfnlMsgBatchBegin, nft(nftMsgNewTable),
+		// elements of the IPv4 set don't fit a single message
+		nft(nftMsgNewSet), nft(nftMsgDelSetElem), nft(nftMsgNewSetElem), nft(nftMsgNewSetElem), nft(nftMsgNewSetElem),
+		nft(nftMsgNewSet), nft(nftMsgDelSetElem),
+		nfnlMsgBatchEnd,
+	}, types)
+	require.Len(t, batch.seqs, len(messages)-2)
+}
+
+func TestNewNftablesSets(t *testing.T) {
+	sets, err := NewNftablesSets(DefaultNftablesTable, DefaultNftablesSet)
+	require.NoError(t, err)
+	require.Equal(t, "excluded-prefixes-ipv4", sets.IPv4Set())
+	require.Equal(t, "excluded-prefixes-ipv6", sets.IPv6Set())
+	_, err = NewNftablesSets("", DefaultNftablesSet)
+	require.Error(t, err)
+	_, err = NewNftablesSets(DefaultNftablesTable, "excluded prefixes")
+	require.Error(t, err)
+}
+
+// nftMsgGetSetElem is nf_tables message type of the set elements dump
+const nftMsgGetSetElem = 13
+
+// netlinkAttributes returns values of netlink attributes of data by their types without the nested flag
+func netlinkAttributes(data []byte) map[uint16][][]byte {
+	attributes := map[uint16][][]byte{}
+	for len(data) >= syscall.SizeofRtAttr {
+		length := int(utils.NativeEndian.Uint16(data[0:2]))
+		if length < syscall.SizeofRtAttr || length > len(data) {
+			break
+		}
+		attributeType := utils.NativeEndian.Uint16(data[2:4]) &^ nlaFNested
+		attributes[attributeType] = append(attributes[attributeType], data[syscall.SizeofRtAttr:length])
+		data = data[(length+syscall.RTA_ALIGNTO-1)&^(syscall.RTA_ALIGNTO-1):]
+	}
+	return attributes
+}
+
+// nftablesSetElements dumps elements of the set of inet table as start addresses and ends of intervals
+func nftablesSetElements(table, set string) ([]string, error) {
+	batch := &nftablesBatch{}
+	attributes := appendNetlinkAttribute(nil, nftaSetElemListTable, nftablesString(table))
+	batch.add(nftMsgGetSetElem, syscall.NLM_F_DUMP, nfprotoInet,
+		appendNetlinkAttribute(attributes, nftaSetElemListSet, nftablesString(set)))
+
+	conn, err := dialNetlink(syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = syscall.Close(conn) }()
+	if err := syscall.Sendto(conn, batch.data, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var elements []string
+	buffer := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(conn, buffer, 0)
+		if err != nil {
+			return nil, err
+		}
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return nil, err
+		}
+		for i := range messages {
+			switch messages[i].Header.Type {
+			case syscall.NLMSG_DONE:
+				return elements, nil
+			case syscall.NLMSG_ERROR:
+				return nil, syscall.Errno(-int32(utils.NativeEndian.Uint32(messages[i].Data[0:4])))
+			}
+			for _, list := range netlinkAttributes(messages[i].Data[4:])[nftaSetElemListElements] {
+				for _, element := range netlinkAttributes(list)[nftaListElem] {
+					elementAttributes := netlinkAttributes(element)
+					key := netlinkAttributes(elementAttributes[nftaSetElemKey][0])[nftaDataValue][0]
+					value := net.IP(key).String()
+					if flags := elementAttributes[nftaSetElemFlags]; len(flags) > 0 && flags[0][3]&nftSetElemIntervalEnd != 0 {
+						value = "end " + value
+					}
+					elements = append(elements, value)
+				}
+			}
+		}
+	}
+}
+
+func TestNftablesSetsSync(t *testing.T) {
+	var elements [][]string
+	var errs []error
+	inNetworkNamespace(t, func() {
+		sets, err := NewNftablesSets(DefaultNftablesTable, DefaultNftablesSet)
+		errs = append(errs, err)
+		dump := func() {
+			for _, set := range []string{sets.IPv4Set(), sets.IPv6Set()} {
+				setElements, err := nftablesSetElements(DefaultNftablesTable, set)
+				errs = append(errs, err)
+				elements = append(elements, setElements)
+			}
+		}
+		errs = append(errs, sets.Sync([]string{"10.0.1.0/24", "10.0.2.0/24", "10.0.0.0/24", "fd00::/64"}))
+		dump()
+		errs = append(errs, sets.Sync([]string{"192.168.0.0/16"}))
+		dump()
+	})
+
+	for _, err := range errs {
+		if cause := errors.Cause(err); cause == syscall.EPROTONOSUPPORT || cause == syscall.EOPNOTSUPP {
+			t.Skip("nftables is not supported by the kernel")
+		}
+		require.NoError(t, err)
+	}
+	require.Len(t, elements, 4)
+	// 10.0.0.0/24 and 10.0.1.0/24 are aggregated
+	require.ElementsMatch(t, []string{"10.0.0.0", "end 10.0.2.0", "10.0.2.0", "end 10.0.3.0"}, elements[0])
+	require.ElementsMatch(t, []string{"fd00::", "end fd00:0:0:1::"}, elements[1])
+	require.ElementsMatch(t, []string{"192.168.0.0", "end 192.169.0.0"}, elements[2])
+	require.Empty(t, elements[3])
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultObjectStoreRegion is region the object store requests are signed for if none is configured.
+	// GCS interoperability API accepts any region.
+	DefaultObjectStoreRegion = "us-east-1"
+
+	amzService = "s3"
+)
+
+// ObjectStoreOptions are options of the S3 compatible object store bucket
+type ObjectStoreOptions struct {
+	// BucketURL is path style URL of the bucket with optional key prefix, e.g.
+	// https://s3.eu-west-1.amazonaws.com/bucket/nsm/ or https://storage.googleapis.com/bucket/nsm/
+	BucketURL string
+	// Region is region the requests are signed for
+	Region string
+	// AccessKeyID is ID of the access key, GCS HMAC key ID for GCS
+	AccessKeyID string
+	// SecretKeyPath is path of file containing the secret access key, it is read for every request,
+	// so the rotated key is picked up without restart
+	SecretKeyPath string
+	// Client is HTTP client of the object store requests
+	Client *http.Client
+}
+
+// ObjectStore is S3 compatible object store bucket accessed with AWS Signature Version 4 signed requests
+type ObjectStore struct {
+	options   ObjectStoreOptions
+	bucketURL *url.URL
+	keyPrefix string
+}
+
+// NewObjectStore creates ObjectStore of options
+func NewObjectStore(options *ObjectStoreOptions) (*ObjectStore, error) {
+	bucketURL, err := url.Parse(options.BucketURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Wrong bucket URL %q", options.BucketURL)
+	}
+	path := strings.SplitN(strings.TrimPrefix(bucketURL.Path, "/"), "/", 2)
+	if (bucketURL.Scheme != "http" && bucketURL.Scheme != "https") || bucketURL.Host == "" || path[0] == "" {
+		return nil, errors.Errorf("Bucket URL %q should be http(s)://host/bucket[/prefix] URL", options.BucketURL)
+	}
+	store := &ObjectStore{
+		options:   *options,
+		bucketURL: &url.URL{Scheme: bucketURL.Scheme, Host: bucketURL.Host, Path: "/" + path[0]},
+	}
+	if len(path) > 1 {
+		store.keyPrefix = path[1]
+	}
+	if store.options.Region == "" {
+		store.options.Region = DefaultObjectStoreRegion
+	}
+	if store.options.Client == nil {
+		store.options.Client = http.DefaultClient
+	}
+	return store, nil
+}
+
+// Put uploads data as object of the bucket with key following the key prefix
+func (s *ObjectStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, key, nil, data)
+	return err
+}
+
+// Get returns data of object of the bucket with key following the key prefix
+func (s *ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil, nil)
+}
+
+// Delete deletes object of the bucket with key following the key prefix
+func (s *ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	return err
+}
+
+// listBucketResult is the part of ListObjectsV2 response the store depends on
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns sorted keys of the bucket objects starting with prefix following the key prefix,
+// the key prefix is trimmed from the keys
+func (s *ObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {s.keyPrefix + prefix}}
+	for {
+		data, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := &listBucketResult{}
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, errors.Wrap(err, "Can not unmarshal bucket objects list")
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(content.Key, s.keyPrefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// do sends signed request of the object with key following the key prefix, or of the bucket if key is empty.
+// Returns body of the successful response.
+func (s *ObjectStore) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	requestURL := *s.bucketURL
+	if key != "" {
+		requestURL.Path += "/" + s.keyPrefix + key
+	}
+	requestURL.RawPath = utils.AWSEscapePath(requestURL.Path)
+	requestURL.RawQuery = utils.AWSCanonicalQuery(query)
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create object store request")
+	}
+	if err = s.sign(request, body, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	response, err := s.options.Client.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to request object store %s", s.bucketURL.Host)
+	}
+	defer func() { _ = response.Body.Close() }()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read object store response")
+	}
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return nil, &objectStoreError{status: response.StatusCode, message: fmt.Sprintf("%s %s: %s",
+			method, requestURL.Path, bytes.TrimSpace(data))}
+	}
+	return data, nil
+}
+
+// objectStoreError is error response of the object store
+type objectStoreError struct {
+	status  int
+	message string
+}
+
+func (e *objectStoreError) Error() string {
+	return fmt.Sprintf("Object store responded with %d to %s", e.status, e.message)
+}
+
+// sign signs request with body sent at now with AWS Signature Version 4
+func (s *ObjectStore) sign(request *http.Request, body []byte, now time.Time) error {
+	secret, err := readObjectStoreSecret(s.options.SecretKeyPath)
+	if err != nil {
+		return err
+	}
+	utils.SignAWSRequest(request, body, &utils.AWSCredentials{
+		Region: s.options.Region, Service: amzService, AccessKeyID: s.options.AccessKeyID, SecretKey: secret,
+	}, now)
+	return nil
+}
+
+// readObjectStoreSecret reads secret access key of file
+func readObjectStoreSecret(filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read object store secret key %s", filePath)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// ReadOutput reads excluded prefixes published to the output config map in any schema, encoding or sharding.
+// Entries are attributed to the sources only if v2 schema is published without sharding.
+func ReadOutput(ctx context.Context, configMapInterface v1.ConfigMapInterface, configMapName string) (*PrefixesDocument, error) {
+	configMap, err := configMapInterface.Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get NSM ConfigMap %s", configMapName)
+	}
+
+	if _, ok := configMap.Data[ShardIndexKey]; ok {
+		index, err := decodeShardIndex(configMap)
+		if err != nil {
+			return nil, err
+		}
+		var prefixes []string
+		for _, name := range index.Shards {
+			shard, err := configMapInterface.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to get NSM ConfigMap shard %s", name)
+			}
+			shardPrefixes, err := DecodePrefixes(shard.Data[configMapKey], shard.Annotations[EncodingAnnotation])
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to decode NSM ConfigMap shard %s", name)
+			}
+			prefixes = append(prefixes, shardPrefixes...)
+		}
+		if PrefixesHash(prefixes) != index.Hash {
+			return nil, errors.New("NSM ConfigMap shards are of different versions")
+		}
+		return documentOf(prefixes)
+	}
+
+	if payload, ok := configMap.Data[SchemaV2Key]; ok {
+		return DecodeDocument(payload, configMap.Annotations[EncodingAnnotation])
+	}
+	// two-phase commit output is read from the committed slot
+	key := configMapKey
+	if slot, ok := configMap.Data[CommitPointerKey]; ok {
+		key = slot
+	}
+	prefixes, err := DecodePrefixes(configMap.Data[key], configMap.Annotations[EncodingAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	return documentOf(prefixes)
+}
+
+// documentOf returns v2 schema document of prefixes without attribution
+func documentOf(prefixes []string) (*PrefixesDocument, error) {
+	entries, err := PrefixEntries(prefixes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PrefixesDocument{Version: SchemaV2, Prefixes: entries}, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReadOutput(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, testCase := range []struct {
+		name     string
+		options  []prefixcollector.Option
+		expected []prefixcollector.PrefixEntry
+	}{
+		{
+			name: "v1",
+			expected: []prefixcollector.PrefixEntry{
+				{Prefix: "10.96.0.0/12", Family: prefixcollector.FamilyIPv4},
+				{Prefix: "172.16.0.0/12", Family: prefixcollector.FamilyIPv4},
+			},
+		},
+		{
+			name:    "v2",
+			options: []prefixcollector.Option{prefixcollector.WithOutputSchemas(prefixcollector.SchemaV2)},
+			expected: []prefixcollector.PrefixEntry{
+				{Prefix: "10.96.0.0/12", Family: prefixcollector.FamilyIPv4, Sources: []string{"kubeadm"}},
+				{Prefix: "172.16.0.0/12", Family: prefixcollector.FamilyIPv4, Sources: []string{"netbox"}},
+			},
+		},
+		{
+			name:    "sharded",
+			options: []prefixcollector.Option{prefixcollector.WithOutputShards(1), prefixcollector.WithOutputCompression()},
+			expected: []prefixcollector.PrefixEntry{
+				{Prefix: "10.96.0.0/12", Family: prefixcollector.FamilyIPv4},
+				{Prefix: "172.16.0.0/12", Family: prefixcollector.FamilyIPv4},
+			},
+		},
+		{
+			name:    "two-phase",
+			options: []prefixcollector.Option{prefixcollector.WithTwoPhaseCommit("nsm-config-commit", "collector-0")},
+			expected: []prefixcollector.PrefixEntry{
+				{Prefix: "10.96.0.0/12", Family: prefixcollector.FamilyIPv4},
+				{Prefix: "172.16.0.0/12", Family: prefixcollector.FamilyIPv4},
+			},
+		},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        nsmConfigMapName,
+					Namespace:   configMapNamespace,
+					Annotations: map[string]string{prefixcollector.AcceptEncodingAnnotation: prefixcollector.GzipBase64Encoding},
+				},
+			})
+			ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+			defer cancel()
+
+			options := append([]prefixcollector.Option{
+				prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+				prefixcollector.WithSources(
+					&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12"}},
+					&namedPrefixSource{name: "netbox", prefixes: []string{"172.16.0.0/12"}},
+				),
+			}, testCase.options...)
+			go prefixcollector.NewExcludePrefixCollector(options...).Serve(ctx)
+
+			configMaps := clientSet.CoreV1().ConfigMaps(configMapNamespace)
+			var document *prefixcollector.PrefixesDocument
+			require.Eventually(t, func() bool {
+				var err error
+				document, err = prefixcollector.ReadOutput(ctx, configMaps, nsmConfigMapName)
+				return err == nil && len(document.Prefixes) > 0
+			}, time.Second, 10*time.Millisecond)
+			require.Equal(t, testCase.expected, document.Prefixes)
+		})
+	}
+}
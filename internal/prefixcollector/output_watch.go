@@ -0,0 +1,162 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// outputWatch watches the output config map: restores its prefixes changed externally, recreates it after deletion
+// and tracks its resync and pause annotations
+type outputWatch struct {
+	configMapInterface v1.ConfigMapInterface
+	name               string
+	output             *configMapOutput
+	previousPrefixes   *utils.SynchronizedPrefixesContainer
+	resync             *resyncAnnotationTracker
+	logger             logrus.FieldLogger
+	// last is the last observed state of the config map, nil until it is observed
+	last *apiV1.ConfigMap
+}
+
+// run lists the config map and watches it from the listed resource version, resuming closed watches,
+// until ctx is done or the watched version expires. Changes made while it wasn't watched are handled
+// as if they were watched.
+func (ow *outputWatch) run(ctx context.Context) error {
+	selector := fields.OneTermEqualSelector("metadata.name", ow.name).String()
+	list, err := ow.configMapInterface.List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return errors.Wrap(err, "Failed to list NSM ConfigMap")
+	}
+	var configMap *apiV1.ConfigMap
+	for i := range list.Items {
+		if list.Items[i].Name == ow.name {
+			configMap = &list.Items[i]
+		}
+	}
+	switch {
+	case configMap != nil && ow.last == nil:
+		ow.resync.changed(configMap)
+		ow.output.updatePaused(configMap)
+		ow.last = configMap
+	case configMap != nil:
+		ow.modified(ctx, configMap)
+	case ow.last != nil:
+		ow.deleted(ctx, ow.last)
+	}
+
+	version := list.ResourceVersion
+	for ctx.Err() == nil {
+		watcher, err := ow.configMapInterface.Watch(ctx, metav1.ListOptions{
+			FieldSelector:       selector,
+			ResourceVersion:     version,
+			AllowWatchBookmarks: true,
+			TimeoutSeconds:      WatchTimeoutSeconds(ctx),
+		})
+		if err != nil {
+			return errors.Wrap(err, "Failed to watch NSM ConfigMap")
+		}
+		var expired bool
+		version, expired = ow.handleEvents(ctx, watcher, version)
+		watcher.Stop()
+		if expired {
+			return nil
+		}
+	}
+	return nil
+}
+
+// handleEvents handles watcher events until it is closed, returns the last observed resource version and true
+// if the config map should be listed again
+func (ow *outputWatch) handleEvents(ctx context.Context, watcher watch.Interface, version string) (string, bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return version, false
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return version, false
+			}
+
+			if event.Type == watch.Error {
+				err := apierrors.FromObject(event.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					ow.logger.Info("Nsm configmap watch resource version expired, listing again")
+				} else {
+					ow.logger.Errorf("Error during nsm configmap watch, listing again: %v", err)
+				}
+				return version, true
+			}
+			if accessor, err := meta.Accessor(event.Object); err == nil {
+				version = accessor.GetResourceVersion()
+			}
+
+			configMap, ok := event.Object.(*apiV1.ConfigMap)
+			if !ok || configMap.Name != ow.name {
+				continue
+			}
+			switch event.Type {
+			case watch.Added:
+				ow.last = configMap
+			case watch.Deleted:
+				ow.deleted(ctx, configMap)
+			case watch.Modified:
+				ow.modified(ctx, configMap)
+			}
+		}
+	}
+}
+
+// deleted recreates the deleted config map with the last prefixes
+func (ow *outputWatch) deleted(ctx context.Context, configMap *apiV1.ConfigMap) {
+	ow.logger.Warn("Nsm configmap is deleted, recreating it with the last prefixes")
+	if err := recreateConfigMap(ctx, configMap, ow.previousPrefixes.Load(), ow.configMapInterface, ow.output); err != nil {
+		ow.logger.Error(err)
+	}
+}
+
+// modified handles pause and resync annotations of the modified config map and restores its prefixes
+// changed externally
+func (ow *outputWatch) modified(ctx context.Context, configMap *apiV1.ConfigMap) {
+	ow.last = configMap
+	// paused output isn't restored, resumed one is rewritten by the collector
+	if wasPaused := ow.output.isPaused(); ow.output.updatePaused(configMap) || wasPaused {
+		return
+	}
+	if ow.resync.changed(configMap) {
+		ow.logger.Info("Nsm configmap resync annotation is changed, requesting resync")
+		ResyncSignal(ctx).Trigger()
+		return
+	}
+	if outputChanged(configMap, ow.previousPrefixes.Load(), ow.output) {
+		ow.logger.Warn("Nsm configmap excluded prefixes field external change, restoring last state")
+		if err := updateConfigMap(ctx, ow.previousPrefixes.Load(), configMap, ow.configMapInterface, ow.output); err != nil {
+			ow.logger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// WithOwnerReference is ExcludedPrefixCollector option, which sets owner reference to the output config maps
+// and the status resource, so they are garbage collected with the owner
+func WithOwnerReference(owner *metav1.OwnerReference) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.owner = owner
+	}
+}
+
+// ResolveOwnerReference returns owner reference to the resource of namespace described by owner as
+// group/version/resource/name, e.g. apps/v1/deployments/exclude-prefixes, or version/resource/name
+// for the core group
+func ResolveOwnerReference(ctx context.Context, owner, namespace string) (*metav1.OwnerReference, error) {
+	resource, name, err := ParseOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	object, err := DynamicInterface(ctx).Resource(resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get output owner %s", owner)
+	}
+	return &metav1.OwnerReference{
+		APIVersion: object.GetAPIVersion(),
+		Kind:       object.GetKind(),
+		Name:       object.GetName(),
+		UID:        object.GetUID(),
+	}, nil
+}
+
+// ParseOwner returns resource and name of the owner described as group/version/resource/name or version/resource/name
+func ParseOwner(owner string) (schema.GroupVersionResource, string, error) {
+	parts := strings.Split(owner, "/")
+	switch {
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+		return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, parts[2], nil
+	case len(parts) == 4 && parts[0] != "" && parts[1] != "" && parts[2] != "" && parts[3] != "":
+		return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, parts[3], nil
+	default:
+		return schema.GroupVersionResource{}, "", errors.Errorf("Owner %q should be group/version/resource/name", owner)
+	}
+}
+
+// setOwnerReference adds owner to the owner references of the object, if it isn't there yet
+func setOwnerReference(object metav1.Object, owner *metav1.OwnerReference) {
+	if owner == nil {
+		return
+	}
+	references := object.GetOwnerReferences()
+	for i := range references {
+		if references[i].UID == owner.UID {
+			return
+		}
+	}
+	object.SetOwnerReferences(append(references, *owner))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOutputOwnerReference(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetName("exclude-prefixes")
+	deployment.SetNamespace(configMapNamespace)
+	deployment.SetUID("deployment-uid")
+	ctx := prefixcollector.WithDynamicInterface(context.Background(),
+		dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment))
+
+	_, err := prefixcollector.ResolveOwnerReference(ctx, "deployments/exclude-prefixes", configMapNamespace)
+	require.Error(t, err)
+	_, err = prefixcollector.ResolveOwnerReference(ctx, "apps/v1/deployments/missing", configMapNamespace)
+	require.Error(t, err)
+	owner, err := prefixcollector.ResolveOwnerReference(ctx, "apps/v1/deployments/exclude-prefixes", configMapNamespace)
+	require.NoError(t, err)
+	require.Equal(t, metav1.OwnerReference{
+		APIVersion: "apps/v1", Kind: "Deployment", Name: "exclude-prefixes", UID: "deployment-uid",
+	}, *owner)
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(ctx, clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithOwnerReference(owner),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		return err == nil && len(configMap.OwnerReferences) == 1 && configMap.OwnerReferences[0].UID == owner.UID
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+// PauseAnnotation is output config map annotation, setting it to true freezes the output: prefixes are still collected,
+// but changes are only reported until the annotation is removed
+const PauseAnnotation = "networkservicemesh.io/excluded-prefixes-paused"
+
+// errOutputPaused is returned by the output writer, which found the output paused
+var errOutputPaused = errors.New("Output is paused")
+
+// WithOutputPaused is ExcludedPrefixCollector option, which freezes the output regardless of PauseAnnotation
+func WithOutputPaused() Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.pausedByConfig = true
+	}
+}
+
+// updatePaused sets pause state of the output from PauseAnnotation of configMap and notifies about its change.
+// Returns true if the output is paused.
+func (o *configMapOutput) updatePaused(configMap *apiV1.ConfigMap) bool {
+	var paused int32
+	if value, err := strconv.ParseBool(configMap.Annotations[PauseAnnotation]); err == nil && value {
+		paused = 1
+	}
+	if atomic.SwapInt32(&o.paused, paused) != paused {
+		select {
+		case o.pauseChanged <- struct{}{}:
+		default:
+		}
+	}
+	return paused == 1
+}
+
+// isPaused returns true if the output is paused by PauseAnnotation
+func (o *configMapOutput) isPaused() bool {
+	return atomic.LoadInt32(&o.paused) == 1
+}
+
+// holdPaused reports change from previousPrefixes to newPrefixes held while the output is paused.
+// Returns false if the output isn't paused.
+func (epc *ExcludedPrefixCollector) holdPaused(ctx context.Context, newPrefixes, previousPrefixes []string,
+	sourcePrefixes map[string][]string) bool {
+	if !epc.pausedByConfig && !epc.configMapOutput.isPaused() {
+		if epc.status.OutputPaused {
+			logrus.Info("Output is resumed")
+			epc.status.OutputPaused, epc.status.PendingChange = false, nil
+			epc.reportStatus(ctx)
+		}
+		return false
+	}
+
+	change := epc.prefixesChange(previousPrefixes, newPrefixes, sourcePrefixes)
+	epc.status.OutputPaused, epc.status.PendingChange = true, nil
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		epc.status.PendingChange = change
+		logrus.Warnf("Output is paused, change is held: added %v, removed %v", change.Added, change.Removed)
+	}
+	epc.reportStatus(ctx)
+	return true
+}
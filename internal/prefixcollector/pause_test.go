@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPauseAnnotation(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        nsmConfigMapName,
+			Namespace:   configMapNamespace,
+			Annotations: map[string]string{prefixcollector.PauseAnnotation: "true"},
+		},
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	notifyChan := make(chan struct{}, 1)
+	source := newDummyPrefixSource([]string{"10.96.0.0/12"})
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	configMaps := clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	outputPrefixes := func() string {
+		configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		require.NoError(t, err)
+		return configMap.Data[excludedPrefixesKey]
+	}
+
+	notifyChan <- struct{}{}
+	require.Never(t, func() bool { return outputPrefixes() != "" }, 200*time.Millisecond, 10*time.Millisecond)
+
+	configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	delete(configMap.Annotations, prefixcollector.PauseAnnotation)
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return outputPrefixes() == "Prefixes:\n- 10.96.0.0/12\n"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStatusConditionsPaused(t *testing.T) {
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, OutputPaused: true}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionTrue,
+	}, conditionStatuses(&prefixcollector.Status{
+		OutputWritten: true,
+		OutputPaused:  true,
+		PendingChange: &prefixcollector.PrefixesChange{Added: []string{"10.96.0.0/12"}},
+	}))
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// poolLint checks excluded prefixes leave enough free addresses in NSM IPAM pool
+type poolLint struct {
+	pool    []string
+	minFree *big.Int
+	// refuse prevents writing of the prefixes leaving too few free addresses, they are only reported otherwise
+	refuse bool
+	// configMapName and namespace are of the config map the pool is loaded from, the pool isn't loaded if
+	// configMapName is empty
+	configMapName string
+	namespace     string
+	// reportInterval is interval of the pool coverage reports, history are the latest reported usable fractions
+	reportInterval time.Duration
+	history        []float64
+}
+
+// WithPoolLint is ExcludedPrefixCollector option, which checks that excluded prefixes leave at least minFree
+// addresses of NSM IPAM pool prefixes and reports exhaustion in status. Prefixes exhausting the pool aren't
+// written if refuse is set, so NSM allocation doesn't fail on the datapath.
+func WithPoolLint(pool []string, minFree int64, refuse bool) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		lint := collector.ensurePoolLint()
+		lint.pool = pool
+		lint.minFree = big.NewInt(minFree)
+		lint.refuse = refuse
+	}
+}
+
+// ensurePoolLint returns pool lint of the collector creating one, which requires no free addresses, if it is missing
+func (epc *ExcludedPrefixCollector) ensurePoolLint() *poolLint {
+	if epc.poolLint == nil {
+		epc.poolLint = &poolLint{minFree: new(big.Int)}
+		epc.status.PoolLinted = true
+	}
+	return epc.poolLint
+}
+
+// lintPool checks free addresses of the pool left by prefixes and reports status if exhaustion is changed.
+// Returns true if the prefixes are refused. Prefixes aren't checked until the pool is known.
+func (epc *ExcludedPrefixCollector) lintPool(ctx context.Context, prefixes []string) bool {
+	if epc.poolLint == nil || len(epc.poolLint.pool) == 0 {
+		return false
+	}
+	free, err := utils.FreeAddresses(epc.poolLint.pool, prefixes)
+	if err != nil {
+		logrus.Errorf("Failed to check NSM IPAM pool: %v", err)
+		return false
+	}
+
+	exhausted := free.Cmp(epc.poolLint.minFree) < 0
+	if exhausted != epc.status.PoolExhausted || free.String() != epc.status.PoolFreeAddresses {
+		epc.status.PoolExhausted = exhausted
+		epc.status.PoolFreeAddresses = free.String()
+		if exhausted {
+			logrus.Errorf("Excluded prefixes leave %v free addresses of NSM IPAM pool %v, at least %v are required",
+				free, epc.poolLint.pool, epc.poolLint.minFree)
+		}
+		epc.reportStatus(ctx)
+	}
+	if exhausted && epc.poolLint.refuse {
+		logrus.Warnf("Excluded prefixes exhausting NSM IPAM pool are refused: %v", prefixes)
+		return true
+	}
+	return false
+}
+
+// PoolProblems returns problems of excluded prefixes leaving less than minFree addresses of the pool
+func PoolProblems(pool, prefixes []string, minFree int64) []string {
+	if len(pool) == 0 {
+		return nil
+	}
+	free, err := utils.FreeAddresses(pool, prefixes)
+	if err != nil {
+		return []string{"Failed to check NSM IPAM pool: " + err.Error()}
+	}
+	if free.Cmp(big.NewInt(minFree)) < 0 {
+		return []string{"Excluded prefixes leave " + free.String() + " free addresses of NSM IPAM pool, at least " +
+			big.NewInt(minFree).String() + " are required"}
+	}
+	return nil
+}
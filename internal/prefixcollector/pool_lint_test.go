@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestPoolLintRefusesExhaustingPrefixes(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writes := make(chan []string, 10)
+	notifyChan := make(chan struct{}, 1)
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	source.Store([]string{"10.0.0.0/8", "169.254.0.0/16"})
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			writes <- prefixes
+			return nil
+		}),
+		prefixcollector.WithPoolLint([]string{"169.254.0.0/24"}, 1, true),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	select {
+	case prefixes := <-writes:
+		t.Fatalf("prefixes exhausting the pool are written: %v", prefixes)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	source.Store([]string{"10.0.0.0/8", "169.254.0.0/25"})
+	notifyChan <- struct{}{}
+	select {
+	case prefixes := <-writes:
+		require.Equal(t, []string{"10.0.0.0/8", "169.254.0.0/25"}, prefixes)
+	case <-time.After(time.Second):
+		t.Fatal("prefixes leaving free pool addresses aren't written")
+	}
+	require.Empty(t, writes)
+}
+
+func TestPoolProblems(t *testing.T) {
+	require.Empty(t, prefixcollector.PoolProblems(nil, []string{"0.0.0.0/0"}, 1))
+	require.Empty(t, prefixcollector.PoolProblems([]string{"169.254.0.0/24"}, []string{"169.254.0.0/25"}, 128))
+	require.Len(t, prefixcollector.PoolProblems([]string{"169.254.0.0/24"}, []string{"169.254.0.0/25"}, 129), 1)
+}
@@ -19,45 +19,87 @@ package prefixcollector
 import (
 	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
 )
 
 const (
+	// ResourceVersionsAnnotation is output config map annotation containing JSON map of the last observed
+	// resource versions of the watched resources
+	ResourceVersionsAnnotation = "networkservicemesh.io/excluded-prefixes-resource-versions"
+	// ResyncAnnotation is output config map annotation, setting it to a new value requests the collector to
+	// recollect prefixes of all the sources and rewrite the output
+	ResyncAnnotation = "networkservicemesh.io/excluded-prefixes-resync"
+
 	configMapKey          = "excluded_prefixes.yaml"
 	outputFilePermissions = 0600
+	// maxConfigMapDataSize is the maximum size of config map data accepted by Kubernetes
+	maxConfigMapDataSize = 1024 * 1024
 )
 
+// configMapOutput contains config map output settings, which can be changed by options after the output is set
+type configMapOutput struct {
+	signingKey             ed25519.PrivateKey
+	publicKeyConfigMapName string
+	publicKeyPublished     bool
+	shardSize              int
+	compress               bool
+	schemas                []string
+	familyKeys             bool
+	diffKey                bool
+	twoPhase               *twoPhaseCommit
+	// owner is owner reference set to the output config maps and the status resource, if it is set
+	owner *metav1.OwnerReference
+	// sourcePrefixes is map[string][]string of the prefixes per source used for v2 schema attribution
+	sourcePrefixes atomic.Value
+	// vlanPrefixes is map[int][]string of the prefixes per VLAN tag used for v2 schema attribution
+	vlanPrefixes atomic.Value
+	// prefixesExpiry is map[string]time.Time of the expiring prefixes end times used for v2 schema TTLs
+	prefixesExpiry atomic.Value
+	// paused is 1 if the output is paused by PauseAnnotation, pauseChanged is notified about its changes
+	paused       int32
+	pauseChanged chan struct{}
+}
+
 // fileWriter - creates file writePrefixesFunc
 func fileWriter(filePath string) writePrefixesFunc {
-	return func(ctx context.Context, newPrefixes []string) {
+	return func(ctx context.Context, newPrefixes []string) error {
 		span := spanhelper.FromContext(ctx, "Update excluded prefixes file")
 		defer span.Finish()
 
-		data, err := utils.PrefixesToYaml(newPrefixes)
+		canonicalPrefixes, err := utils.CanonicalPrefixes(newPrefixes)
+		if err != nil {
+			return errors.Wrap(err, "Can not canonicalize prefixes")
+		}
+		data, err := utils.PrefixesToYaml(canonicalPrefixes)
 		if err != nil {
-			span.Logger().Errorf("Can not create marshal prefixes, err: %v", err.Error())
-			return
+			return errors.Wrap(err, "Can not create marshal prefixes")
 		}
 
 		err = ioutil.WriteFile(filePath, data, outputFilePermissions)
 		if err != nil {
 			span.Logger().Fatalf("Unable to write into file: %v", err.Error())
 		}
+		return nil
 	}
 }
 
 // configMapWriter - creates k8s config map writePrefixesFunc
-func configMapWriter(configMapName, configMapNamespace string) writePrefixesFunc {
-	return func(ctx context.Context, newPrefixes []string) {
+func configMapWriter(configMapName, configMapNamespace string, output *configMapOutput) writePrefixesFunc {
+	return func(ctx context.Context, newPrefixes []string) error {
 		configMapInterface := KubernetesInterface(ctx).
 			CoreV1().
 			ConfigMaps(configMapNamespace)
@@ -66,77 +108,106 @@ func configMapWriter(configMapName, configMapNamespace string) writePrefixesFunc
 		defer span.Finish()
 
 		configMap, err := configMapInterface.Get(ctx, configMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			span.Logger().Warnf("NSM ConfigMap '%s/%s' is not found, recreating it", configMapNamespace, configMapName)
+			return recreateConfigMap(ctx, &apiV1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: configMapNamespace},
+			}, newPrefixes, configMapInterface, output)
+		}
 		if err != nil {
-			span.Logger().Fatalf("Failed to get NSM ConfigMap '%s/%s': %v",
-				configMapNamespace, configMapName, err)
-			return
+			return errors.Wrapf(err, "Failed to get NSM ConfigMap '%s/%s'", configMapNamespace, configMapName)
+		}
+
+		if output.updatePaused(configMap) {
+			return errOutputPaused
 		}
 
-		if err := updateConfigMap(ctx, newPrefixes, configMap, configMapInterface); err != nil {
-			span.Logger().Error(err)
+		if output.signingKey != nil && !output.publicKeyPublished {
+			if err := publishPublicKey(ctx, output.signingKey, output.publicKeyConfigMapName, configMapInterface); err != nil {
+				span.Logger().Error(err)
+			} else {
+				output.publicKeyPublished = true
+			}
 		}
+
+		return output.write(ctx, newPrefixes, configMap, configMapInterface)
 	}
 }
 
-// configMapWatchFunc - creates watchPrefixesFunc, that keep track of prefixes k8s config map external changes
-func configMapWatchFunc(configMapName, configMapNamespace string) watchPrefixesFunc {
-	return func(ctx context.Context, previousPrefixes *utils.SynchronizedPrefixesContainer) {
-		configMapInterface := KubernetesInterface(ctx).
-			CoreV1().
-			ConfigMaps(configMapNamespace)
+// write writes prefixes to the output config map with two-phase commit, if it is enabled
+func (o *configMapOutput) write(ctx context.Context, prefixes []string,
+	configMap *apiV1.ConfigMap, configMapInterface v1.ConfigMapInterface) error {
+	if o.twoPhase != nil {
+		return o.twoPhase.commit(ctx, prefixes, configMap, configMapInterface, o)
+	}
+	return updateConfigMap(ctx, prefixes, configMap, configMapInterface, o)
+}
 
+// configMapWatchFunc - creates watchPrefixesFunc, that keep track of prefixes k8s config map external changes.
+// Config map is listed and watched until ctx is done: watch closed by API server is resumed from the last resource
+// version, expired one is listed again, failed list and watch requests are retried with backoff.
+func configMapWatchFunc(configMapName, configMapNamespace string, output *configMapOutput) watchPrefixesFunc {
+	return func(ctx context.Context, previousPrefixes *utils.SynchronizedPrefixesContainer) {
 		span := spanhelper.FromContext(ctx, "Watch NSM config map")
 		defer span.Finish()
 
-		watcher, err := configMapInterface.Watch(ctx, metav1.ListOptions{})
-		if err != nil {
-			span.Logger().Fatalf("Error watching config map: %v", err)
+		ow := &outputWatch{
+			configMapInterface: KubernetesInterface(ctx).CoreV1().ConfigMaps(configMapNamespace),
+			name:               configMapName,
+			output:             output,
+			previousPrefixes:   previousPrefixes,
+			resync:             &resyncAnnotationTracker{},
+			logger: span.Logger().WithFields(logrus.Fields{
+				"configmap-namespace": configMapNamespace,
+				"configmap-name":      configMapName,
+			}),
 		}
-
-		logEntry := span.Logger().WithFields(logrus.Fields{
-			"configmap-namespace": configMapNamespace,
-			"configmap-name":      configMapName,
-		})
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case event, ok := <-watcher.ResultChan():
-				if !ok {
-					return
-				}
-
-				configMap, ok := event.Object.(*apiV1.ConfigMap)
-				if !ok || configMap.Name != configMapName {
-					continue
-				}
-
-				switch event.Type {
-				case watch.Error:
-					logEntry.Errorf("Error during nsm configmap watch: %v", err)
-					return
-				case watch.Modified:
-					prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[configMapKey]))
-					if err != nil || !utils.UnorderedSlicesEquals(prefixes, previousPrefixes.Load()) {
-						logEntry.Warn("Nsm configmap excluded prefixes field external change, restoring last state")
-						if err := updateConfigMap(ctx, previousPrefixes.Load(), configMap, configMapInterface); err != nil {
-							span.Logger().Error(err)
-						}
-					}
-				}
+		backoff := &utils.Backoff{}
+		for ctx.Err() == nil {
+			if err := ow.run(ctx); err != nil {
+				ow.logger.Errorf("Error during nsm configmap watch, retrying: %v", err)
+				backoff.Wait(ctx)
+				continue
 			}
+			backoff.Reset()
 		}
 	}
 }
 
 func updateConfigMap(ctx context.Context, newPrefixes []string,
-	configMap *apiV1.ConfigMap, configMapInterface v1.ConfigMapInterface) error {
-	data, err := utils.PrefixesToYaml(newPrefixes)
+	configMap *apiV1.ConfigMap, configMapInterface v1.ConfigMapInterface, output *configMapOutput) error {
+	// prefixes are serialized canonically, so the same prefixes always produce the same data and hashes
+	newPrefixes, err := utils.CanonicalPrefixes(newPrefixes)
 	if err != nil {
-		return errors.Wrapf(err, "Can not create marshal prefixes")
+		return errors.Wrap(err, "Can not canonicalize prefixes")
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	if output.shardSize > 0 {
+		return updateShardedConfigMap(ctx, newPrefixes, configMap, configMapInterface, output)
+	}
+
+	encoding := payloadEncoding(configMap, output)
+	delete(configMap.Data, ShardIndexKey)
+	if err := writeDiffKey(configMap, newPrefixes, encoding, output); err != nil {
+		return err
+	}
+	payload, err := writeSchemas(configMap, newPrefixes, encoding, output)
+	if err != nil {
+		return err
+	}
+	if err = writeFamilyKeys(configMap, newPrefixes, encoding, output); err != nil {
+		return err
+	}
+	setEncoding(configMap, encoding)
+	if size := configMapDataSize(configMap); size > maxConfigMapDataSize {
+		return errors.Errorf("NSM ConfigMap data size %d exceeds Kubernetes limit %d", size, maxConfigMapDataSize)
+	}
+
+	if err = annotateOutput(ctx, configMap, newPrefixes, payload, output); err != nil {
+		return err
 	}
-	configMap.Data[configMapKey] = string(data)
 
 	_, err = configMapInterface.Update(ctx, configMap, metav1.UpdateOptions{})
 	if err != nil {
@@ -145,3 +216,118 @@ func updateConfigMap(ctx context.Context, newPrefixes []string,
 
 	return nil
 }
+
+// annotateOutput sets owner reference and resource versions, prefixes hash, payload and data keys signature
+// annotations of the output config map
+func annotateOutput(ctx context.Context, configMap *apiV1.ConfigMap, prefixes []string, payload string,
+	output *configMapOutput) error {
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	setOwnerReference(configMap, output.owner)
+	if versions := ResourceVersions(ctx).Snapshot(); len(versions) > 0 {
+		versionsData, err := json.Marshal(versions)
+		if err != nil {
+			return errors.Wrap(err, "Can not marshal resource versions")
+		}
+		configMap.Annotations[ResourceVersionsAnnotation] = string(versionsData)
+	}
+	configMap.Annotations[PrefixesHashAnnotation] = PrefixesHash(prefixes)
+	if output.signingKey != nil {
+		configMap.Annotations[SignatureAnnotation] = signPayload(output.signingKey, payload)
+		signDataKeys(output.signingKey, configMap)
+		configMap.Annotations[PublicKeyAnnotation] = output.publicKeyConfigMapName
+	}
+	return nil
+}
+
+// outputChanged returns true if the output config map doesn't contain prefixes in the negotiated encoding anymore
+func outputChanged(configMap *apiV1.ConfigMap, prefixes []string, output *configMapOutput) bool {
+	if configMap.Annotations[EncodingAnnotation] != payloadEncoding(configMap, output) {
+		return true
+	}
+	if output.shardSize > 0 {
+		index, err := decodeShardIndex(configMap)
+		return err != nil || index.Hash != PrefixesHash(prefixes)
+	}
+	if configMap.Annotations[SchemaAnnotation] != strings.Join(output.schemaVersions(), ",") {
+		return true
+	}
+	if !output.hasSchema(SchemaV1) {
+		document, err := DecodeDocument(configMap.Data[SchemaV2Key], configMap.Annotations[EncodingAnnotation])
+		if err != nil || len(document.Prefixes) != len(prefixes) {
+			return true
+		}
+		outputPrefixes := make([]string, 0, len(document.Prefixes))
+		for _, entry := range document.Prefixes {
+			outputPrefixes = append(outputPrefixes, entry.Prefix)
+		}
+		return !utils.UnorderedSlicesEquals(outputPrefixes, prefixes)
+	}
+	outputPrefixes, err := DecodePrefixes(configMap.Data[configMapKey], configMap.Annotations[EncodingAnnotation])
+	return err != nil || !utils.UnorderedSlicesEquals(outputPrefixes, prefixes)
+}
+
+// storeSourcePrefixes stores prefixes per source, which are the next output is built from
+func (o *configMapOutput) storeSourcePrefixes(sourcePrefixes map[string][]string) {
+	o.sourcePrefixes.Store(sourcePrefixes)
+}
+
+// loadSourcePrefixes returns the last stored prefixes per source
+func (o *configMapOutput) loadSourcePrefixes() map[string][]string {
+	sourcePrefixes, _ := o.sourcePrefixes.Load().(map[string][]string)
+	return sourcePrefixes
+}
+
+// storeVLANPrefixes stores prefixes per VLAN tag, which the next output entries are attributed with
+func (o *configMapOutput) storeVLANPrefixes(vlanPrefixes map[int][]string) {
+	o.vlanPrefixes.Store(vlanPrefixes)
+}
+
+// loadVLANPrefixes returns the last stored prefixes per VLAN tag
+func (o *configMapOutput) loadVLANPrefixes() map[int][]string {
+	vlanPrefixes, _ := o.vlanPrefixes.Load().(map[int][]string)
+	return vlanPrefixes
+}
+
+// storePrefixesExpiry stores end times of the expiring prefixes, which the next output entries TTLs are set from
+func (o *configMapOutput) storePrefixesExpiry(expiry map[string]time.Time) {
+	o.prefixesExpiry.Store(expiry)
+}
+
+// loadPrefixesExpiry returns the last stored end times of the expiring prefixes
+func (o *configMapOutput) loadPrefixesExpiry() map[string]time.Time {
+	expiry, _ := o.prefixesExpiry.Load().(map[string]time.Time)
+	return expiry
+}
+
+// LoadResourceVersions returns resource versions persisted in the output config map annotation
+func LoadResourceVersions(ctx context.Context, configMapName, configMapNamespace string) (*utils.ResourceVersions, error) {
+	configMap, err := KubernetesInterface(ctx).
+		CoreV1().
+		ConfigMaps(configMapNamespace).
+		Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get NSM ConfigMap '%s/%s'", configMapNamespace, configMapName)
+	}
+
+	versions := map[string]string{}
+	if data, ok := configMap.Annotations[ResourceVersionsAnnotation]; ok {
+		if err = json.Unmarshal([]byte(data), &versions); err != nil {
+			return nil, errors.Wrap(err, "Can not unmarshal resource versions")
+		}
+	}
+	return utils.NewResourceVersions(versions), nil
+}
+
+// configMapDataSize returns size of the config map data
+func configMapDataSize(configMap *apiV1.ConfigMap) int {
+	size := 0
+	for key, value := range configMap.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range configMap.BinaryData {
+		size += len(key) + len(value)
+	}
+	return size
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// HetznerProvider is Hetzner Cloud provider of CloudNetworkPrefixSource
+	HetznerProvider = "hetzner"
+	// DigitalOceanProvider is DigitalOcean provider of CloudNetworkPrefixSource
+	DigitalOceanProvider = "digitalocean"
+	// LinodeProvider is Linode (Akamai) provider of CloudNetworkPrefixSource
+	LinodeProvider = "linode"
+	// DefaultMetadataServiceURL is URL of the link-local metadata service of the providers
+	DefaultMetadataServiceURL = "http://169.254.169.254"
+
+	hetznerPrivateNetworksPath = "/hetzner/v1/metadata/private-networks"
+	digitalOceanMetadataPath   = "/metadata/v1.json"
+	linodeTokenPath            = "/v1/token"
+	linodeNetworkPath          = "/v1/network"
+	linodeTokenExpiry          = "300"
+)
+
+// CloudNetworkPrefixSource is excluded prefix source of the private networks attached to the node by the smaller
+// cloud providers, which cloud controller managers route pods over them. Networks are learned from the provider
+// metadata service of the node: Hetzner Cloud networks, DigitalOcean VPC and Linode private and VPC networks.
+type CloudNetworkPrefixSource struct {
+	options  *CloudNetworkOptions
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// CloudNetworkOptions are CloudNetworkPrefixSource settings
+type CloudNetworkOptions struct {
+	// Provider is one of HetznerProvider, DigitalOceanProvider and LinodeProvider
+	Provider string
+	// MetadataURL is URL of the metadata service, DefaultMetadataServiceURL if it is empty
+	MetadataURL     string
+	RefreshInterval time.Duration
+	Client          *http.Client
+}
+
+// NewCloudNetworkPrefixSource creates CloudNetworkPrefixSource
+func NewCloudNetworkPrefixSource(ctx context.Context, notify *utils.EventBus, options *CloudNetworkOptions) *CloudNetworkPrefixSource {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	cns := &CloudNetworkPrefixSource{
+		options:  options,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	fetch := map[string]fetchPrefixesFunc{
+		HetznerProvider:      cns.fetchHetznerNetworks,
+		DigitalOceanProvider: cns.fetchDigitalOceanNetworks,
+		LinodeProvider:       cns.fetchLinodeNetworks,
+	}[options.Provider]
+	if fetch == nil {
+		fetch = func(context.Context) ([]string, error) {
+			return nil, errors.Errorf("Unknown cloud network provider %q", options.Provider)
+		}
+	}
+	prefixcollector.Lifecycle(ctx).Go(cns.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll "+options.Provider+" cloud networks")
+		defer span.Finish()
+		pollPrefixes(ctx, cns.Name(), options.RefreshInterval, fetch, cns.prefixes, notify, span.Logger())
+	})
+	return cns
+}
+
+// Prefixes returns prefixes from source
+func (cns *CloudNetworkPrefixSource) Prefixes() []string {
+	return cns.prefixes.Load()
+}
+
+// Name returns name of the source
+func (cns *CloudNetworkPrefixSource) Name() string {
+	return "cloud-network"
+}
+
+func (cns *CloudNetworkPrefixSource) metadataURL(path string) string {
+	if cns.options.MetadataURL == "" {
+		return DefaultMetadataServiceURL + path
+	}
+	return strings.TrimSuffix(cns.options.MetadataURL, "/") + path
+}
+
+// fetchHetznerNetworks fetches IP ranges of Hetzner Cloud networks of the server private networks
+func (cns *CloudNetworkPrefixSource) fetchHetznerNetworks(ctx context.Context) ([]string, error) {
+	data, err := cns.request(ctx, http.MethodGet, cns.metadataURL(hetznerPrivateNetworksPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	var networks []struct {
+		Network string `json:"network"`
+		Subnet  string `json:"subnet"`
+	}
+	// Hetzner metadata service responds with YAML
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), bufferSize).Decode(&networks); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode Hetzner private networks")
+	}
+	prefixes := []string{}
+	for _, network := range networks {
+		switch {
+		case network.Network != "":
+			prefixes = append(prefixes, network.Network)
+		case network.Subnet != "":
+			prefixes = append(prefixes, network.Subnet)
+		}
+	}
+	return prefixes, nil
+}
+
+// fetchDigitalOceanNetworks fetches VPC networks of the droplet private interfaces, networks are derived
+// from the interface addresses and netmasks
+func (cns *CloudNetworkPrefixSource) fetchDigitalOceanNetworks(ctx context.Context) ([]string, error) {
+	var metadata struct {
+		Interfaces struct {
+			Private []struct {
+				IPv4 struct {
+					IPAddress string `json:"ip_address"`
+					Netmask   string `json:"netmask"`
+				} `json:"ipv4"`
+			} `json:"private"`
+		} `json:"interfaces"`
+	}
+	if err := getJSON(ctx, cns.client, cns.metadataURL(digitalOceanMetadataPath), nil, &metadata); err != nil {
+		return nil, err
+	}
+	prefixes := []string{}
+	for _, privateInterface := range metadata.Interfaces.Private {
+		ip := net.ParseIP(privateInterface.IPv4.IPAddress).To4()
+		mask := net.ParseIP(privateInterface.IPv4.Netmask).To4()
+		if ip == nil || mask == nil {
+			return nil, errors.Errorf("Invalid DigitalOcean private interface address %s/%s",
+				privateInterface.IPv4.IPAddress, privateInterface.IPv4.Netmask)
+		}
+		network := &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+		prefixes = append(prefixes, network.String())
+	}
+	return prefixes, nil
+}
+
+// fetchLinodeNetworks fetches private IPv4 networks and VPC subnets of the Linode interfaces with metadata
+// service token
+func (cns *CloudNetworkPrefixSource) fetchLinodeNetworks(ctx context.Context) ([]string, error) {
+	token, err := cns.request(ctx, http.MethodPut, cns.metadataURL(linodeTokenPath),
+		http.Header{"Metadata-Token-Expiry-Seconds": {linodeTokenExpiry}})
+	if err != nil {
+		return nil, err
+	}
+	var network struct {
+		Interfaces []struct {
+			Purpose     string `json:"purpose"`
+			IPAMAddress string `json:"ipam_address"`
+		} `json:"interfaces"`
+		IPv4 struct {
+			Private []string `json:"private"`
+		} `json:"ipv4"`
+	}
+	header := http.Header{"Metadata-Token": {strings.TrimSpace(string(token))}}
+	if err := getJSON(ctx, cns.client, cns.metadataURL(linodeNetworkPath), header, &network); err != nil {
+		return nil, err
+	}
+
+	addresses := network.IPv4.Private
+	for _, linodeInterface := range network.Interfaces {
+		if linodeInterface.Purpose != "public" && linodeInterface.IPAMAddress != "" {
+			addresses = append(addresses, linodeInterface.IPAMAddress)
+		}
+	}
+	prefixes := []string{}
+	for _, address := range addresses {
+		_, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid Linode private address %q", address)
+		}
+		prefixes = append(prefixes, ipNet.String())
+	}
+	return prefixes, nil
+}
+
+// request sends request with header to url and returns body of the successful response
+func (cns *CloudNetworkPrefixSource) request(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create request to %s", url)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	response, err := cns.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to %s %s", method, url)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Failed to %s %s: %s", method, url, response.Status)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	return data, errors.Wrapf(err, "Failed to read response of %s", url)
+}
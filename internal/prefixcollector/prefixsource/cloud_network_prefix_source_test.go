@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+const (
+	hetznerPrivateNetworks = `- ip: 10.0.0.2
+  alias_ips: []
+  interface_num: 1
+  network_id: 1234
+  network_name: k8s
+  network: 10.0.0.0/16
+  subnet: 10.0.0.0/24
+  gateway: 10.0.0.1
+`
+	digitalOceanMetadata = `{"droplet_id": 1, "interfaces": {
+	"public": [{"ipv4": {"ip_address": "203.0.113.10", "netmask": "255.255.255.0"}}],
+	"private": [{"ipv4": {"ip_address": "10.110.0.2", "netmask": "255.255.240.0"}}]
+}}`
+	linodeNetwork = `{"interfaces": [
+	{"purpose": "public", "ipam_address": ""},
+	{"purpose": "vpc", "ipam_address": "10.0.4.2/24"}
+], "ipv4": {"public": ["198.51.100.10/32"], "private": ["192.168.139.5/17"]}}`
+)
+
+func TestCloudNetworkPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hetzner/v1/metadata/private-networks", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, hetznerPrivateNetworks)
+	})
+	mux.HandleFunc("/metadata/v1.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, digitalOceanMetadata)
+	})
+	mux.HandleFunc("/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Metadata-Token-Expiry-Seconds") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, "linode-token")
+	})
+	mux.HandleFunc("/v1/network", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Token") != "linode-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, linodeNetwork)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	for provider, expected := range map[string][]string{
+		prefixsource.HetznerProvider:      {"10.0.0.0/16"},
+		prefixsource.DigitalOceanProvider: {"10.110.0.0/20"},
+		prefixsource.LinodeProvider:       {"10.0.4.0/24", "192.168.128.0/17"},
+	} {
+		t.Run(provider, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			notify := utils.NewEventBus()
+			source := prefixsource.NewCloudNetworkPrefixSource(ctx, notify, &prefixsource.CloudNetworkOptions{
+				Provider:        provider,
+				MetadataURL:     server.URL,
+				RefreshInterval: time.Hour,
+				Client:          client,
+			})
+			g.Eventually(notify.Events(), time.Second).Should(Receive())
+			g.Expect(sortedPrefixes(source)()).To(Equal(expected))
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// DefaultGCPMetadataTokenURL is URL of GCE metadata server token of the default service account
+	DefaultGCPMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	ec2APIVersion          = "2016-11-15"
+	azureNetworkAPIVersion = "2023-09-01"
+)
+
+// CloudTagsPrefixSource is excluded prefix source of the cloud subnets marked for exclusion with tag, so
+// infrastructure as code pipelines exclude ranges without touching Kubernetes. AWS VPC subnets are matched
+// by their tags. GCP subnetworks and Azure subnets have no tags, so GCP subnetworks with key=value in their
+// description and subnets of Azure virtual networks with the tag are matched.
+type CloudTagsPrefixSource struct {
+	options  *CloudTagsOptions
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// CloudTagsOptions are CloudTagsPrefixSource settings, subnets of the providers with not nil options are excluded
+type CloudTagsOptions struct {
+	// TagKey and TagValue are tag the subnets are marked with, empty TagValue matches any value
+	TagKey          string
+	TagValue        string
+	AWS             *AWSSubnetsOptions
+	GCP             *GCPSubnetsOptions
+	Azure           *AzureSubnetsOptions
+	RefreshInterval time.Duration
+	Client          *http.Client
+}
+
+// AWSSubnetsOptions are settings of EC2 API the tagged VPC subnets are described with
+type AWSSubnetsOptions struct {
+	Regions []string
+	// EndpointURL is EC2 API endpoint URL of all the regions, https://ec2.<region>.amazonaws.com if it is empty
+	EndpointURL string
+	// AccessKeyID is ID of the access key, SecretKeyPath is path of file containing the secret access key
+	AccessKeyID   string
+	SecretKeyPath string
+}
+
+// GCPSubnetsOptions are settings of Compute Engine API the subnetworks are listed with
+type GCPSubnetsOptions struct {
+	Projects   []string
+	ComputeURL string
+	// TokenPath is path of file containing OAuth 2.0 access token, the token of GCE metadata server
+	// at MetadataTokenURL is used if it is empty
+	TokenPath        string
+	MetadataTokenURL string
+}
+
+// AzureSubnetsOptions are settings of Resource Manager API the virtual networks are listed with
+type AzureSubnetsOptions struct {
+	Subscriptions []string
+	ManagementURL string
+	// TenantID, ClientID and ClientSecretPath are service principal the token is requested for at LoginURL
+	// with client credentials grant, TokenPath is used if client ID is empty
+	LoginURL         string
+	TenantID         string
+	ClientID         string
+	ClientSecretPath string
+	// TokenPath is path of file containing Resource Manager access token
+	TokenPath string
+}
+
+// NewCloudTagsPrefixSource creates CloudTagsPrefixSource
+func NewCloudTagsPrefixSource(ctx context.Context, notify *utils.EventBus, options *CloudTagsOptions) *CloudTagsPrefixSource {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	cts := &CloudTagsPrefixSource{
+		options:  options,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(cts.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll cloud tagged subnets")
+		defer span.Finish()
+		pollPrefixes(ctx, cts.Name(), options.RefreshInterval, cts.fetchPrefixes, cts.prefixes, notify, span.Logger())
+	})
+	return cts
+}
+
+// Prefixes returns prefixes from source
+func (cts *CloudTagsPrefixSource) Prefixes() []string {
+	return cts.prefixes.Load()
+}
+
+// Name returns name of the source
+func (cts *CloudTagsPrefixSource) Name() string {
+	return "cloud-tags"
+}
+
+// fetchPrefixes fetches CIDRs of the tagged subnets of all the configured providers
+func (cts *CloudTagsPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	prefixes := []string{}
+	providers := []struct {
+		enabled bool
+		fetch   fetchPrefixesFunc
+	}{
+		{cts.options.AWS != nil, cts.fetchAWSSubnets},
+		{cts.options.GCP != nil, cts.fetchGCPSubnets},
+		{cts.options.Azure != nil, cts.fetchAzureSubnets},
+	}
+	for _, provider := range providers {
+		if !provider.enabled {
+			continue
+		}
+		fetched, err := provider.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, fetched...)
+	}
+	return prefixes, nil
+}
+
+// tagMatches returns true if tags contain the tag of the source
+func (cts *CloudTagsPrefixSource) tagMatches(tags map[string]string) bool {
+	value, ok := tags[cts.options.TagKey]
+	return ok && (cts.options.TagValue == "" || value == cts.options.TagValue)
+}
+
+// describeSubnetsResponse is the part of EC2 DescribeSubnets response the source depends on
+type describeSubnetsResponse struct {
+	Subnets []struct {
+		CIDRBlock     string   `xml:"cidrBlock"`
+		IPv6CIDRBlock []string `xml:"ipv6CidrBlockAssociationSet>item>ipv6CidrBlock"`
+	} `xml:"subnetSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+// fetchAWSSubnets returns IPv4 and IPv6 CIDRs of the tagged VPC subnets of all the regions
+func (cts *CloudTagsPrefixSource) fetchAWSSubnets(ctx context.Context) ([]string, error) {
+	options := cts.options.AWS
+	secret, err := readSecret(ctx, options.SecretKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"Action": {"DescribeSubnets"}, "Version": {ec2APIVersion}}
+	if cts.options.TagValue == "" {
+		query.Set("Filter.1.Name", "tag-key")
+		query.Set("Filter.1.Value.1", cts.options.TagKey)
+	} else {
+		query.Set("Filter.1.Name", "tag:"+cts.options.TagKey)
+		query.Set("Filter.1.Value.1", cts.options.TagValue)
+	}
+
+	var prefixes []string
+	for _, region := range options.Regions {
+		endpointURL := options.EndpointURL
+		if endpointURL == "" {
+			endpointURL = fmt.Sprintf("https://ec2.%s.amazonaws.com", region)
+		}
+		credentials := &utils.AWSCredentials{Region: region, Service: "ec2", AccessKeyID: options.AccessKeyID, SecretKey: secret}
+		query.Del("NextToken")
+		for {
+			response := &describeSubnetsResponse{}
+			if err := cts.getEC2(ctx, endpointURL, query, credentials, response); err != nil {
+				return nil, err
+			}
+			for _, subnet := range response.Subnets {
+				prefixes = append(prefixes, subnet.CIDRBlock)
+				prefixes = append(prefixes, subnet.IPv6CIDRBlock...)
+			}
+			if response.NextToken == "" {
+				break
+			}
+			query.Set("NextToken", response.NextToken)
+		}
+	}
+	return prefixes, nil
+}
+
+// getEC2 sends EC2 API request with query signed with credentials and decodes XML response to result
+func (cts *CloudTagsPrefixSource) getEC2(ctx context.Context, endpointURL string, query url.Values,
+	credentials *utils.AWSCredentials, result interface{}) error {
+	requestURL, err := url.Parse(strings.TrimSuffix(endpointURL, "/") + "/")
+	if err != nil {
+		return errors.Wrapf(err, "Wrong EC2 endpoint URL %s", endpointURL)
+	}
+	requestURL.RawPath = utils.AWSEscapePath(requestURL.Path)
+	requestURL.RawQuery = utils.AWSCanonicalQuery(query)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request to %s", endpointURL)
+	}
+	utils.SignAWSRequest(request, nil, credentials, time.Now())
+	response, err := cts.client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to describe subnets of %s", endpointURL)
+	}
+	defer func() { _ = response.Body.Close() }()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read response of %s", endpointURL)
+	}
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to describe subnets of %s: %s: %s", endpointURL, response.Status, bytes.TrimSpace(data))
+	}
+	return errors.Wrapf(xml.Unmarshal(data, result), "Failed to decode response of %s", endpointURL)
+}
+
+// fetchGCPSubnets returns primary, secondary and IPv6 ranges of the subnetworks of all the projects,
+// which have the tag in their description
+func (cts *CloudTagsPrefixSource) fetchGCPSubnets(ctx context.Context) ([]string, error) {
+	options := cts.options.GCP
+	token, err := cts.gcpToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+
+	var prefixes []string
+	for _, project := range options.Projects {
+		query := url.Values{}
+		for {
+			list := struct {
+				Items map[string]struct {
+					Subnetworks []struct {
+						Description       string `json:"description"`
+						IPCIDRRange       string `json:"ipCidrRange"`
+						IPv6CIDRRange     string `json:"ipv6CidrRange"`
+						SecondaryIPRanges []struct {
+							IPCIDRRange string `json:"ipCidrRange"`
+						} `json:"secondaryIpRanges"`
+					} `json:"subnetworks"`
+				} `json:"items"`
+				NextPageToken string `json:"nextPageToken"`
+			}{}
+			listURL := fmt.Sprintf("%s/compute/v1/projects/%s/aggregated/subnetworks?%s",
+				strings.TrimSuffix(options.ComputeURL, "/"), url.PathEscape(project), query.Encode())
+			if err := getJSON(ctx, cts.client, listURL, header, &list); err != nil {
+				return nil, err
+			}
+			for _, scope := range list.Items {
+				for _, subnetwork := range scope.Subnetworks {
+					if !cts.tagMatches(descriptionTags(subnetwork.Description)) {
+						continue
+					}
+					prefixes = append(prefixes, subnetwork.IPCIDRRange)
+					if subnetwork.IPv6CIDRRange != "" {
+						prefixes = append(prefixes, subnetwork.IPv6CIDRRange)
+					}
+					for _, secondary := range subnetwork.SecondaryIPRanges {
+						prefixes = append(prefixes, secondary.IPCIDRRange)
+					}
+				}
+			}
+			if list.NextPageToken == "" {
+				break
+			}
+			query.Set("pageToken", list.NextPageToken)
+		}
+	}
+	return prefixes, nil
+}
+
+// gcpToken returns access token of the token file if it is set, the token of GCE metadata server otherwise
+func (cts *CloudTagsPrefixSource) gcpToken(ctx context.Context) (string, error) {
+	options := cts.options.GCP
+	if options.TokenPath != "" {
+		return readSecret(ctx, options.TokenPath)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	header := http.Header{"Metadata-Flavor": {"Google"}}
+	if err := getJSON(ctx, cts.client, options.MetadataTokenURL, header, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// descriptionTags returns key=value tags of whitespace or comma separated description
+func descriptionTags(description string) map[string]string {
+	tags := map[string]string{}
+	for _, field := range strings.FieldsFunc(description, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' }) {
+		key := field
+		var value string
+		if separator := strings.Index(field, "="); separator >= 0 {
+			key, value = field[:separator], field[separator+1:]
+		}
+		tags[key] = value
+	}
+	return tags
+}
+
+// fetchAzureSubnets returns address prefixes of the subnets of the tagged virtual networks of all the subscriptions
+func (cts *CloudTagsPrefixSource) fetchAzureSubnets(ctx context.Context) ([]string, error) {
+	options := cts.options.Azure
+	token, err := cts.azureToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+
+	var prefixes []string
+	for _, subscription := range options.Subscriptions {
+		listURL := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Network/virtualNetworks?api-version=%s",
+			strings.TrimSuffix(options.ManagementURL, "/"), url.PathEscape(subscription), azureNetworkAPIVersion)
+		for listURL != "" {
+			list := struct {
+				Value []struct {
+					Tags       map[string]string `json:"tags"`
+					Properties struct {
+						Subnets []struct {
+							Properties struct {
+								AddressPrefix   string   `json:"addressPrefix"`
+								AddressPrefixes []string `json:"addressPrefixes"`
+							} `json:"properties"`
+						} `json:"subnets"`
+					} `json:"properties"`
+				} `json:"value"`
+				NextLink string `json:"nextLink"`
+			}{}
+			if err := getJSON(ctx, cts.client, listURL, header, &list); err != nil {
+				return nil, err
+			}
+			for _, network := range list.Value {
+				if !cts.tagMatches(network.Tags) {
+					continue
+				}
+				for _, subnet := range network.Properties.Subnets {
+					if subnet.Properties.AddressPrefix != "" {
+						prefixes = append(prefixes, subnet.Properties.AddressPrefix)
+					}
+					prefixes = append(prefixes, subnet.Properties.AddressPrefixes...)
+				}
+			}
+			listURL = list.NextLink
+		}
+	}
+	return prefixes, nil
+}
+
+// azureToken returns Resource Manager access token issued for the service principal if client ID is set,
+// the token of the token file otherwise
+func (cts *CloudTagsPrefixSource) azureToken(ctx context.Context) (string, error) {
+	options := cts.options.Azure
+	if options.ClientID == "" {
+		return readSecret(ctx, options.TokenPath)
+	}
+	secret, err := readSecret(ctx, options.ClientSecretPath)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {options.ClientID},
+		"client_secret": {secret},
+		"scope":         {strings.TrimSuffix(options.ManagementURL, "/") + "/.default"},
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(options.LoginURL, "/"), url.PathEscape(options.TenantID))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to create request to %s", tokenURL)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := cts.client.Do(request)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to POST %s", tokenURL)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Failed to POST %s: %s", tokenURL, response.Status)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", errors.Wrapf(err, "Failed to decode response of %s", tokenURL)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+const (
+	ec2SubnetsPage = `<DescribeSubnetsResponse><subnetSet><item><cidrBlock>10.0.0.0/24</cidrBlock>
+<ipv6CidrBlockAssociationSet><item><ipv6CidrBlock>2001:db8:1::/64</ipv6CidrBlock></item></ipv6CidrBlockAssociationSet>
+</item></subnetSet><nextToken>%s</nextToken></DescribeSubnetsResponse>`
+	ec2SubnetsLastPage = `<DescribeSubnetsResponse><subnetSet><item><cidrBlock>10.0.1.0/24</cidrBlock></item></subnetSet>
+</DescribeSubnetsResponse>`
+	gcpSubnetworks = `{"items": {"regions/europe-west1": {"subnetworks": [
+	{"ipCidrRange": "10.132.0.0/20", "description": "managed by terraform, nsm.io/exclude=true",
+	 "secondaryIpRanges": [{"ipCidrRange": "10.4.0.0/14"}]},
+	{"ipCidrRange": "10.164.0.0/20", "description": "nsm.io/exclude=false"}
+]}}}`
+	azureVirtualNetworks = `{"value": [
+	{"tags": {"nsm.io/exclude": "true"}, "properties": {"subnets": [
+		{"properties": {"addressPrefix": "172.16.0.0/24"}},
+		{"properties": {"addressPrefixes": ["172.16.1.0/24", "fd00::/64"]}}
+	]}},
+	{"tags": {}, "properties": {"subnets": [{"properties": {"addressPrefix": "172.17.0.0/24"}}]}}
+]}`
+)
+
+func TestCloudTagsPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	g.Expect(ioutil.WriteFile(secretPath, []byte("secret\n"), 0600)).To(Succeed())
+	tokenPath := filepath.Join(dir, "token")
+	g.Expect(ioutil.WriteFile(tokenPath, []byte("gcp-token\n"), 0600)).To(Succeed())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ec2/", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/") ||
+			query.Get("Action") != "DescribeSubnets" || query.Get("Filter.1.Name") != "tag:nsm.io/exclude" ||
+			query.Get("Filter.1.Value.1") != "true" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if query.Get("NextToken") == "" {
+			_, _ = fmt.Fprintf(w, ec2SubnetsPage, "page-2")
+			return
+		}
+		_, _ = fmt.Fprint(w, ec2SubnetsLastPage)
+	})
+	mux.HandleFunc("/compute/v1/projects/project/aggregated/subnetworks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, gcpSubnetworks)
+	})
+	mux.HandleFunc("/login/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != "client" || r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token": "azure-token"}`)
+	})
+	mux.HandleFunc("/subscriptions/subscription/providers/Microsoft.Network/virtualNetworks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer azure-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, azureVirtualNetworks)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notify := utils.NewEventBus()
+	source := prefixsource.NewCloudTagsPrefixSource(ctx, notify, &prefixsource.CloudTagsOptions{
+		TagKey:   "nsm.io/exclude",
+		TagValue: "true",
+		AWS: &prefixsource.AWSSubnetsOptions{
+			Regions:       []string{"eu-west-1"},
+			EndpointURL:   server.URL + "/ec2",
+			AccessKeyID:   "access-key",
+			SecretKeyPath: secretPath,
+		},
+		GCP: &prefixsource.GCPSubnetsOptions{
+			Projects:   []string{"project"},
+			ComputeURL: server.URL,
+			TokenPath:  tokenPath,
+		},
+		Azure: &prefixsource.AzureSubnetsOptions{
+			Subscriptions:    []string{"subscription"},
+			ManagementURL:    server.URL,
+			LoginURL:         server.URL + "/login",
+			TenantID:         "tenant",
+			ClientID:         "client",
+			ClientSecretPath: secretPath,
+		},
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(sortedPrefixes(source)()).To(Equal([]string{
+		"10.0.0.0/24", "10.0.1.0/24", "10.132.0.0/20", "10.4.0.0/14",
+		"172.16.0.0/24", "172.16.1.0/24", "2001:db8:1::/64", "fd00::/64",
+	}))
+}
+
+func TestCloudTagsPrefixSourceGCPMetadataToken(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token": "gcp-token"}`)
+	})
+	mux.HandleFunc("/compute/v1/projects/project/aggregated/subnetworks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, gcpSubnetworks)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notify := utils.NewEventBus()
+	source := prefixsource.NewCloudTagsPrefixSource(ctx, notify, &prefixsource.CloudTagsOptions{
+		TagKey: "nsm.io/exclude",
+		GCP: &prefixsource.GCPSubnetsOptions{
+			Projects:         []string{"project"},
+			ComputeURL:       server.URL,
+			MetadataTokenURL: server.URL + "/token",
+		},
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	// any value of the tag matches if the value isn't set
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(sortedPrefixes(source)()).To(Equal([]string{"10.132.0.0/20", "10.164.0.0/20", "10.4.0.0/14"}))
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ClusterAPIGroup is API group of Cluster API resources
+const ClusterAPIGroup = "cluster.x-k8s.io"
+
+// ClusterResource is Cluster API Cluster resource
+var ClusterResource = schema.GroupVersionResource{Group: ClusterAPIGroup, Version: "v1beta1", Resource: "clusters"}
+
+// ClusterAPIPrefixSource is excluded prefix source of pods and services CIDR blocks of Cluster API Cluster
+// resources. Clusters are watched either in the management cluster or in the self-managed one, so CAPI
+// provisioned clusters are covered without access to kubeadm ConfigMap.
+type ClusterAPIPrefixSource struct {
+	clusterName string
+	// prefixes are prefixes of the clusters by namespace
+	prefixes map[string]*utils.SynchronizedPrefixesContainer
+}
+
+// NewClusterAPIPrefixSource creates ClusterAPIPrefixSource watching Cluster named clusterName in namespaces,
+// all the clusters are watched if clusterName is empty and all the namespaces if namespaces are empty
+func NewClusterAPIPrefixSource(ctx context.Context, notify *utils.EventBus, clusterName string,
+	namespaces ...string) *ClusterAPIPrefixSource {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	caps := &ClusterAPIPrefixSource{
+		clusterName: clusterName,
+		prefixes:    make(map[string]*utils.SynchronizedPrefixesContainer, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		caps.prefixes[namespace] = utils.NewSynchronizedPrefixesContainer()
+	}
+
+	for namespace, prefixes := range caps.prefixes {
+		namespace, prefixes := namespace, prefixes
+		prefixcollector.Lifecycle(ctx).Go(caps.Name()+"/"+namespace, func() {
+			caps.watch(ctx, namespace, prefixes, notify)
+		})
+	}
+	return caps
+}
+
+// Prefixes returns prefixes from source
+func (caps *ClusterAPIPrefixSource) Prefixes() []string {
+	var prefixes []string
+	for _, namespacePrefixes := range caps.prefixes {
+		prefixes = append(prefixes, namespacePrefixes.Load()...)
+	}
+	return prefixes
+}
+
+// Name returns name of the source
+func (caps *ClusterAPIPrefixSource) Name() string {
+	return "capi"
+}
+
+func (caps *ClusterAPIPrefixSource) watch(ctx context.Context, namespace string,
+	prefixes *utils.SynchronizedPrefixesContainer, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch Cluster API clusters")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ClusterResource).Namespace(namespace),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               caps.Name() + "/" + namespace,
+		prefixesFunc:      clusterPrefixes,
+		prefixes:          prefixes,
+		notify:            notify,
+		logger:            span.Logger().WithField("namespace", namespace),
+	}
+	if caps.clusterName != "" {
+		rw.fieldSelector = fields.OneTermEqualSelector("metadata.name", caps.clusterName)
+	}
+	rw.run(ctx)
+}
+
+// clusterPrefixes returns pods and services CIDR blocks of the Cluster network
+func clusterPrefixes(cluster *unstructured.Unstructured) ([]string, error) {
+	var prefixes []string
+	for _, network := range []string{"pods", "services"} {
+		cidrBlocks, _, err := unstructured.NestedStringSlice(cluster.Object, "spec", "clusterNetwork", network, "cidrBlocks")
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, cidrBlocks...)
+	}
+	return prefixes, nil
+}
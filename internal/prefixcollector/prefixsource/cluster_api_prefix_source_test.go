@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func capiCluster(namespace, name string, pods, services []interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prefixsource.ClusterAPIGroup + "/v1beta1",
+		"kind":       "Cluster",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec": map[string]interface{}{"clusterNetwork": map[string]interface{}{
+			"pods":     map[string]interface{}{"cidrBlocks": pods},
+			"services": map[string]interface{}{"cidrBlocks": services},
+		}},
+	}}
+}
+
+func TestClusterAPIPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		capiCluster("tenant-a", "workload", []interface{}{"192.168.0.0/16", "fd00:10::/56"}, []interface{}{"10.128.0.0/12"}),
+		capiCluster("tenant-a", "other", []interface{}{"192.169.0.0/16"}, nil),
+		capiCluster("tenant-b", "workload", []interface{}{"192.170.0.0/16"}, []interface{}{"10.144.0.0/12"}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewClusterAPIPrefixSource(ctx, utils.NewEventBus(), "workload", "tenant-a")
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.128.0.0/12", "192.168.0.0/16", "fd00:10::/56",
+	}))
+
+	_, err := client.Resource(prefixsource.ClusterResource).Namespace("tenant-a").Update(ctx,
+		capiCluster("tenant-a", "workload", []interface{}{"192.168.0.0/16"}, []interface{}{"10.128.0.0/12"}),
+		metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.128.0.0/12", "192.168.0.0/16"}))
+
+	all := prefixsource.NewClusterAPIPrefixSource(ctx, utils.NewEventBus(), "")
+	g.Eventually(sortedPrefixes(all), time.Second).Should(Equal([]string{
+		"10.128.0.0/12", "10.144.0.0/12", "192.168.0.0/16", "192.169.0.0/16", "192.170.0.0/16",
+	}))
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cniIPAMRange is address range of CNI IPAM configuration
+type cniIPAMRange struct {
+	// Subnet is host-local range subnet
+	Subnet string `json:"subnet"`
+	// Range is whereabouts range, CIDR optionally prefixed by the first address and dash
+	Range string `json:"range"`
+}
+
+// cniIPAMConfig is CNI IPAM configuration of host-local, static and whereabouts plugins
+type cniIPAMConfig struct {
+	cniIPAMRange
+	Ranges    [][]cniIPAMRange `json:"ranges"`
+	IPRanges  []cniIPAMRange   `json:"ipRanges"`
+	Addresses []struct {
+		Address string `json:"address"`
+	} `json:"addresses"`
+}
+
+// cniIPAMPrefixes returns subnets CNI IPAM configuration allocates addresses from
+func cniIPAMPrefixes(config string) ([]string, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	ipam := &cniIPAMConfig{}
+	if err := json.Unmarshal([]byte(config), ipam); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse CNI IPAM config")
+	}
+
+	ranges := append([]cniIPAMRange{ipam.cniIPAMRange}, ipam.IPRanges...)
+	for _, rangeSet := range ipam.Ranges {
+		ranges = append(ranges, rangeSet...)
+	}
+
+	var cidrs []string
+	for _, r := range ranges {
+		if r.Subnet != "" {
+			cidrs = append(cidrs, r.Subnet)
+		}
+		if r.Range != "" {
+			cidrs = append(cidrs, r.Range[strings.LastIndex(r.Range, "-")+1:])
+		}
+	}
+	for _, address := range ipam.Addresses {
+		cidrs = append(cidrs, address.Address)
+	}
+
+	// addresses are converted to their subnets, invalid CIDRs are kept to be reported by the caller
+	prefixes := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if subnet, ok := addressSubnet(cidr); ok {
+			cidr = subnet
+		}
+		prefixes = append(prefixes, cidr)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ConfigMapNamespacesPrefixSource is excluded prefix source of the config maps with the same name in several
+// namespaces, prefixes of ConfigMapPrefixesKey of the config maps are merged
+type ConfigMapNamespacesPrefixSource struct {
+	name       string
+	namespaces []string
+	// prefixes are prefixes of the config maps by namespace
+	prefixes map[string]*utils.SynchronizedPrefixesContainer
+}
+
+// NewConfigMapNamespacesPrefixSource creates ConfigMapNamespacesPrefixSource watching config maps named name
+// in namespaces, config maps of all the namespaces are watched if namespaces are empty
+func NewConfigMapNamespacesPrefixSource(ctx context.Context, notify *utils.EventBus, name string,
+	namespaces ...string) *ConfigMapNamespacesPrefixSource {
+	cmnps := &ConfigMapNamespacesPrefixSource{
+		name:       name,
+		namespaces: append([]string(nil), namespaces...),
+		prefixes:   make(map[string]*utils.SynchronizedPrefixesContainer, len(namespaces)),
+	}
+	sort.Strings(cmnps.namespaces)
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		cmnps.prefixes[namespace] = utils.NewSynchronizedPrefixesContainer()
+	}
+
+	for namespace, prefixes := range cmnps.prefixes {
+		namespace, prefixes := namespace, prefixes
+		prefixcollector.Lifecycle(ctx).Go(cmnps.Name()+"/"+namespace, func() {
+			cmnps.watch(ctx, namespace, prefixes, notify)
+		})
+	}
+	return cmnps
+}
+
+// Prefixes returns prefixes from source
+func (cmnps *ConfigMapNamespacesPrefixSource) Prefixes() []string {
+	var prefixes []string
+	for _, namespacePrefixes := range cmnps.prefixes {
+		prefixes = append(prefixes, namespacePrefixes.Load()...)
+	}
+	return prefixes
+}
+
+// Name returns name of the source
+func (cmnps *ConfigMapNamespacesPrefixSource) Name() string {
+	namespaces := "*"
+	if len(cmnps.namespaces) > 0 {
+		namespaces = strings.Join(cmnps.namespaces, ",")
+	}
+	return "configmap/" + namespaces + "/" + cmnps.name
+}
+
+func (cmnps *ConfigMapNamespacesPrefixSource) watch(ctx context.Context, namespace string,
+	prefixes *utils.SynchronizedPrefixesContainer, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch user config maps")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ConfigMapResource).Namespace(namespace),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               "configmap/" + namespace + "/" + cmnps.name,
+		prefixesFunc:      configMapPrefixes,
+		prefixes:          prefixes,
+		notify:            notify,
+		logger:            span.Logger().WithField("namespace", namespace),
+		fieldSelector:     fields.OneTermEqualSelector("metadata.name", cmnps.name),
+	}
+	rw.run(ctx)
+}
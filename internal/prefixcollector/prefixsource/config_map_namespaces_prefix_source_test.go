@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestConfigMapNamespacesPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		selectedConfigMap("team-a", "excluded-prefixes-config", "", "prefixes:\n- 10.10.0.0/16\n"),
+		selectedConfigMap("team-a", "other", "", "prefixes:\n- 10.11.0.0/16\n"),
+		selectedConfigMap("team-b", "excluded-prefixes-config", "", "prefixes:\n- fd00:20::/64\n"),
+		selectedConfigMap("team-c", "excluded-prefixes-config", "", "prefixes:\n- 10.30.0.0/16\n"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewConfigMapNamespacesPrefixSource(ctx, utils.NewEventBus(), "excluded-prefixes-config",
+		"team-b", "team-a")
+	g.Expect(source.Name()).To(Equal("configmap/team-a,team-b/excluded-prefixes-config"))
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.10.0.0/16", "fd00:20::/64"}))
+
+	configMaps := client.Resource(prefixsource.ConfigMapResource)
+	_, err := configMaps.Namespace("team-a").Update(ctx,
+		selectedConfigMap("team-a", "excluded-prefixes-config", "", "prefixes:\n- 10.12.0.0/16\n"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	_, err = configMaps.Namespace("team-b").Create(ctx,
+		selectedConfigMap("team-b", "other", "", "prefixes:\n- 10.21.0.0/16\n"), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.12.0.0/16", "fd00:20::/64"}))
+
+	err = configMaps.Namespace("team-b").Delete(ctx, "excluded-prefixes-config", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.12.0.0/16"}))
+}
+
+func TestConfigMapNamespacesPrefixSourceAllNamespaces(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		selectedConfigMap("team-a", "excluded-prefixes-config", "", "prefixes:\n- 10.10.0.0/16\n"),
+		selectedConfigMap("team-b", "excluded-prefixes-config", "", "prefixes:\n- fd00:20::/64\n"),
+		selectedConfigMap("team-c", "other", "", "prefixes:\n- 10.30.0.0/16\n"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewConfigMapNamespacesPrefixSource(ctx, utils.NewEventBus(), "excluded-prefixes-config")
+	g.Expect(source.Name()).To(Equal("configmap/*/excluded-prefixes-config"))
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.10.0.0/16", "fd00:20::/64"}))
+}
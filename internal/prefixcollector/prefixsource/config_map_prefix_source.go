@@ -25,14 +25,12 @@ import (
 	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	apiV1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
-const configMapPrefixesKey = "excluded_prefixes.yaml"
+// ConfigMapPrefixesKey is user config map key containing excluded prefixes YAML
+const ConfigMapPrefixesKey = "excluded_prefixes.yaml"
 
 // ConfigMapPrefixSource is Kubernetes ConfigMap excluded prefix source
 type ConfigMapPrefixSource struct {
@@ -41,12 +39,12 @@ type ConfigMapPrefixSource struct {
 	configMapInterface v1.ConfigMapInterface
 	prefixes           *utils.SynchronizedPrefixesContainer
 	ctx                context.Context
-	notify             chan<- struct{}
+	notify             *utils.EventBus
 	span               spanhelper.SpanHelper
 }
 
 // NewConfigMapPrefixSource creates ConfigMapPrefixSource
-func NewConfigMapPrefixSource(ctx context.Context, notify chan<- struct{}, name, namespace string) *ConfigMapPrefixSource {
+func NewConfigMapPrefixSource(ctx context.Context, notify *utils.EventBus, name, namespace string) *ConfigMapPrefixSource {
 	clientSet := prefixcollector.KubernetesInterface(ctx)
 	configMapInterface := clientSet.CoreV1().ConfigMaps(namespace)
 	cmps := ConfigMapPrefixSource{
@@ -58,7 +56,7 @@ func NewConfigMapPrefixSource(ctx context.Context, notify chan<- struct{}, name,
 		prefixes:           utils.NewSynchronizedPrefixesContainer(),
 	}
 
-	go cmps.watchConfigMap()
+	prefixcollector.Lifecycle(ctx).Go(cmps.Name(), cmps.watchConfigMap)
 	return &cmps
 }
 
@@ -67,67 +65,34 @@ func (cmps *ConfigMapPrefixSource) Prefixes() []string {
 	return cmps.prefixes.Load()
 }
 
+// Name returns name of the source
+func (cmps *ConfigMapPrefixSource) Name() string {
+	return "configmap/" + cmps.configMapNameSpace + "/" + cmps.configMapName
+}
+
 func (cmps *ConfigMapPrefixSource) watchConfigMap() {
 	cmps.span = spanhelper.FromContext(cmps.ctx, "Watch kubeadm configMap")
 	defer cmps.span.Finish()
 	logger := cmps.span.Logger()
 
-	cmps.checkCurrentConfigMap()
-	configMapWatch, err := cmps.configMapInterface.Watch(cmps.ctx, metav1.ListOptions{})
-	if err != nil {
-		logger.Errorf("Error creating config map watch: %v", err)
-		return
-	}
-
-	for {
-		select {
-		case <-cmps.ctx.Done():
-			return
-		case event, ok := <-configMapWatch.ResultChan():
-			if !ok {
-				return
-			}
-
-			if event.Type == watch.Error {
-				continue
-			}
-
-			configMap, ok := event.Object.(*apiV1.ConfigMap)
-			if !ok || configMap.Name != cmps.configMapName {
-				continue
-			}
-
-			if event.Type == watch.Deleted {
+	versions := prefixcollector.ResourceVersions(cmps.ctx)
+	watchConfigMap(cmps.ctx, cmps.configMapInterface, cmps.configMapName, versions, cmps.Name(),
+		func(configMap *apiV1.ConfigMap) {
+			if configMap == nil {
 				cmps.prefixes.Store([]string(nil))
-				cmps.notify <- struct{}{}
-				continue
+				cmps.notify.Notify()
+				return
 			}
-
-			if err = cmps.setPrefixesFromConfigMap(configMap); err != nil {
+			if err := cmps.setPrefixesFromConfigMap(configMap); err != nil {
 				logger.Error(err)
 			}
-		}
-	}
-}
-
-func (cmps *ConfigMapPrefixSource) checkCurrentConfigMap() {
-	logger := cmps.span.Logger()
-
-	configMap, err := cmps.configMapInterface.Get(cmps.ctx, cmps.configMapName, metav1.GetOptions{})
-	if err != nil {
-		logger.Errorf("Error getting config map : %v", err)
-		return
-	}
-
-	if err = cmps.setPrefixesFromConfigMap(configMap); err != nil {
-		logrus.Error(err)
-	}
+		})
 }
 
 func (cmps *ConfigMapPrefixSource) setPrefixesFromConfigMap(configMap *apiV1.ConfigMap) error {
 	logger := cmps.span.Logger()
 
-	prefixesField, ok := configMap.Data[configMapPrefixesKey]
+	prefixesField, ok := configMap.Data[ConfigMapPrefixesKey]
 	if !ok {
 		return nil
 	}
@@ -137,7 +102,7 @@ func (cmps *ConfigMapPrefixSource) setPrefixesFromConfigMap(configMap *apiV1.Con
 		return errors.Errorf("Can not unmarshal prefixes, err: %v", err.Error())
 	}
 	cmps.prefixes.Store(prefixes)
-	cmps.notify <- struct{}{}
+	cmps.notify.Notify()
 	logger.Infof("Prefixes sent from config map source: %v", prefixes)
 
 	return nil
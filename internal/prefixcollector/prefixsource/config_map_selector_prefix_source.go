@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ConfigMapResource is Kubernetes ConfigMap resource
+var ConfigMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// ConfigMapSelectorPrefixSource is excluded prefix source of all the config maps matching label selector
+// in the namespaces. Prefixes of ConfigMapPrefixesKey of the config maps are merged, so teams can contribute
+// excluded prefixes with own config maps.
+type ConfigMapSelectorPrefixSource struct {
+	selector labels.Selector
+	// prefixes are prefixes of the config maps by namespace
+	prefixes map[string]*utils.SynchronizedPrefixesContainer
+}
+
+// NewConfigMapSelectorPrefixSource creates ConfigMapSelectorPrefixSource watching config maps selected by selector
+// in namespaces, config maps of all the namespaces are watched if namespaces are empty
+func NewConfigMapSelectorPrefixSource(ctx context.Context, notify *utils.EventBus, selector labels.Selector,
+	namespaces ...string) *ConfigMapSelectorPrefixSource {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	cmsps := &ConfigMapSelectorPrefixSource{
+		selector: selector,
+		prefixes: make(map[string]*utils.SynchronizedPrefixesContainer, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		cmsps.prefixes[namespace] = utils.NewSynchronizedPrefixesContainer()
+	}
+
+	for namespace, prefixes := range cmsps.prefixes {
+		namespace, prefixes := namespace, prefixes
+		prefixcollector.Lifecycle(ctx).Go(cmsps.Name()+"/"+namespace, func() {
+			cmsps.watch(ctx, namespace, prefixes, notify)
+		})
+	}
+	return cmsps
+}
+
+// Prefixes returns prefixes from source
+func (cmsps *ConfigMapSelectorPrefixSource) Prefixes() []string {
+	var prefixes []string
+	for _, namespacePrefixes := range cmsps.prefixes {
+		prefixes = append(prefixes, namespacePrefixes.Load()...)
+	}
+	return prefixes
+}
+
+// Name returns name of the source
+func (cmsps *ConfigMapSelectorPrefixSource) Name() string {
+	return "configmaps/" + cmsps.selector.String()
+}
+
+func (cmsps *ConfigMapSelectorPrefixSource) watch(ctx context.Context, namespace string,
+	prefixes *utils.SynchronizedPrefixesContainer, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch selected config maps")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ConfigMapResource).Namespace(namespace),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               cmsps.Name() + "/" + namespace,
+		prefixesFunc:      configMapPrefixes,
+		prefixes:          prefixes,
+		notify:            notify,
+		logger:            span.Logger().WithField("namespace", namespace),
+		selector:          cmsps.selector,
+	}
+	rw.run(ctx)
+}
+
+// configMapPrefixes returns prefixes of the config map ConfigMapPrefixesKey, config maps without it have no prefixes
+func configMapPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	prefixesField, _, err := unstructured.NestedString(configMap.Object, "data", ConfigMapPrefixesKey)
+	if err != nil || prefixesField == "" {
+		return nil, err
+	}
+	return utils.YamlToPrefixes([]byte(prefixesField))
+}
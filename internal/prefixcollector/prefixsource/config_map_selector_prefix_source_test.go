@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func selectedConfigMap(namespace, name, team, prefixes string) *unstructured.Unstructured {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"data":       map[string]interface{}{prefixsource.ConfigMapPrefixesKey: prefixes},
+	}}
+	if team != "" {
+		configMap.SetLabels(map[string]string{"excluded-prefixes": team})
+	}
+	return configMap
+}
+
+func TestConfigMapSelectorPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		selectedConfigMap("team-a", "prefixes", "a", "prefixes:\n- 10.10.0.0/16\n"),
+		selectedConfigMap("team-b", "prefixes", "b", "prefixes:\n- 10.20.0.0/16\n- fd00:20::/64\n"),
+		selectedConfigMap("team-b", "unlabeled", "", "prefixes:\n- 10.30.0.0/16\n"),
+		selectedConfigMap("team-c", "prefixes", "c", "prefixes:\n- 10.40.0.0/16\n"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	selector, err := labels.Parse("excluded-prefixes")
+	g.Expect(err).To(BeNil())
+	source := prefixsource.NewConfigMapSelectorPrefixSource(ctx, utils.NewEventBus(), selector, "team-a", "team-b")
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.10.0.0/16", "10.20.0.0/16", "fd00:20::/64",
+	}))
+
+	configMaps := client.Resource(prefixsource.ConfigMapResource)
+	_, err = configMaps.Namespace("team-a").Create(ctx,
+		selectedConfigMap("team-a", "more-prefixes", "a", "prefixes:\n- 10.11.0.0/16\n"), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	_, err = configMaps.Namespace("team-b").Update(ctx,
+		selectedConfigMap("team-b", "prefixes", "", "prefixes:\n- 10.20.0.0/16\n"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.10.0.0/16", "10.11.0.0/16",
+	}))
+}
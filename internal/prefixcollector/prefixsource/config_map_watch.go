@@ -0,0 +1,129 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// configMapHandler handles config map state, nil config map means it is deleted
+type configMapHandler func(configMap *apiV1.ConfigMap)
+
+// watchConfigMap lists and watches config map name, passing every its state to handler.
+// The last observed resource version is kept in versions under key: watch is resumed from it
+// after being closed, watch bookmarks keep it fresh and stored version reduces API load on restart.
+// Forced resync lists the config map again from the latest version. Lists and watch events, bookmarks included,
+// refresh source key. Failed list and watch requests, e.g. timed out over flaky links, are retried with backoff
+// until ctx is done.
+func watchConfigMap(ctx context.Context, configMapInterface v1.ConfigMapInterface, name string,
+	versions *utils.ResourceVersions, key string, handler configMapHandler) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	resync := prefixcollector.ResyncSignal(ctx).Subscribe()
+	backoff := &utils.Backoff{}
+	for ctx.Err() == nil {
+		list, err := configMapInterface.List(ctx, metav1.ListOptions{
+			FieldSelector:   selector,
+			ResourceVersion: versions.Load(key),
+		})
+		if err != nil {
+			logrus.Errorf("Failed to list config map %s, retrying: %v", name, err)
+			backoff.Wait(ctx)
+			continue
+		}
+		backoff.Reset()
+		for i := range list.Items {
+			if list.Items[i].Name == name {
+				handler(&list.Items[i])
+			}
+		}
+		versions.Store(key, list.ResourceVersion)
+		prefixcollector.RefreshTimes(ctx).Touch(key)
+
+		for expired := false; !expired && ctx.Err() == nil; {
+			watcher, err := configMapInterface.Watch(ctx, metav1.ListOptions{
+				FieldSelector:       selector,
+				ResourceVersion:     versions.Load(key),
+				AllowWatchBookmarks: true,
+				TimeoutSeconds:      prefixcollector.WatchTimeoutSeconds(ctx),
+			})
+			if err != nil {
+				logrus.Errorf("Failed to watch config map %s, retrying: %v", name, err)
+				backoff.Wait(ctx)
+				continue
+			}
+			backoff.Reset()
+			expired = handleConfigMapEvents(ctx, watcher, resync, name, versions, key, handler)
+			watcher.Stop()
+		}
+	}
+}
+
+// handleConfigMapEvents handles watcher events until it is closed. Returns true if the watched resource version expired
+// or resync is requested.
+func handleConfigMapEvents(ctx context.Context, watcher watch.Interface, resync <-chan struct{}, name string,
+	versions *utils.ResourceVersions, key string, handler configMapHandler) (expired bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resync:
+			logrus.Infof("Resync requested, listing config map %s again", name)
+			versions.Store(key, "")
+			return true
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+
+			if event.Type == watch.Error {
+				if err := apierrors.FromObject(event.Object); apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					logrus.Infof("Config map %s watch resource version expired, listing again", name)
+					versions.Store(key, "")
+					return true
+				}
+				continue
+			}
+
+			if accessor, err := meta.Accessor(event.Object); err == nil {
+				versions.Store(key, accessor.GetResourceVersion())
+			}
+			prefixcollector.RefreshTimes(ctx).Touch(key)
+
+			configMap, ok := event.Object.(*apiV1.ConfigMap)
+			if event.Type == watch.Bookmark || !ok || configMap.Name != name {
+				continue
+			}
+
+			if event.Type == watch.Deleted {
+				handler(nil)
+				continue
+			}
+			handler(configMap)
+		}
+	}
+}
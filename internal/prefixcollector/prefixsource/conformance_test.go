@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/pkg/sourcetest"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/goleak"
+	apiV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var errWatchBroken = errors.New("watch is broken")
+
+// breakableWatches makes watches and lists of the fake client fail after broken is set
+func breakableWatches(fake *k8stesting.Fake, broken *int32) {
+	fake.PrependWatchReactor("*", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return atomic.LoadInt32(broken) == 1, nil, errWatchBroken
+	})
+	fake.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return atomic.LoadInt32(broken) == 1, nil, errWatchBroken
+	})
+}
+
+func TestConfigMapPrefixSourceConformance(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var broken int32
+	sourcetest.Run(t, sourcetest.Suite{
+		Setup: func(ctx context.Context) context.Context {
+			clientSet := fake.NewSimpleClientset(&apiV1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "excluded-prefixes-config", Namespace: "default"},
+				Data:       map[string]string{prefixsource.ConfigMapPrefixesKey: "prefixes:\n- 10.10.0.0/16\n"},
+			})
+			atomic.StoreInt32(&broken, 0)
+			breakableWatches(&clientSet.Fake, &broken)
+			return prefixcollector.WithKubernetesInterface(ctx, clientSet)
+		},
+		New: func(env *sourcetest.Env) sourcetest.Source {
+			return prefixsource.NewConfigMapPrefixSource(env.Ctx, env.Notify, "excluded-prefixes-config", "default")
+		},
+		Expected:   []string{"10.10.0.0/16"},
+		BreakWatch: func(*sourcetest.Env) { atomic.StoreInt32(&broken, 1) },
+	})
+}
+
+func TestKubeletConfigPrefixSourceConformance(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var broken int32
+	sourcetest.Run(t, sourcetest.Suite{
+		Setup: func(ctx context.Context) context.Context {
+			client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+				kubeletConfigMap("kubelet-config", "clusterDNS:\n- 10.96.0.10\n"))
+			atomic.StoreInt32(&broken, 0)
+			breakableWatches(&client.Fake, &broken)
+			return prefixcollector.WithDynamicInterface(ctx, client)
+		},
+		New: func(env *sourcetest.Env) sourcetest.Source {
+			return prefixsource.NewKubeletConfigPrefixSource(env.Ctx, env.Notify)
+		},
+		Expected:   []string{"10.96.0.10/32"},
+		BreakWatch: func(*sourcetest.Env) { atomic.StoreInt32(&broken, 1) },
+	})
+}
+
+func TestDistroPrefixSourceConformance(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var broken int32
+	sourcetest.Run(t, sourcetest.Suite{
+		Setup: func(ctx context.Context) context.Context {
+			clientSet := fake.NewSimpleClientset(&apiV1.Node{ObjectMeta: metav1.ObjectMeta{Name: "docker-desktop"}})
+			atomic.StoreInt32(&broken, 0)
+			breakableWatches(&clientSet.Fake, &broken)
+			return prefixcollector.WithKubernetesInterface(ctx, clientSet)
+		},
+		New: func(env *sourcetest.Env) sourcetest.Source {
+			return prefixsource.NewDistroPrefixSource(env.Ctx, env.Notify)
+		},
+		Expected:   prefixsource.DistroPrefixes[prefixsource.DockerDesktopDistro],
+		BreakWatch: func(*sourcetest.Env) { atomic.StoreInt32(&broken, 1) },
+	})
+}
+
+func TestScheduledPrefixSourceConformance(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	sourcetest.Run(t, sourcetest.Suite{
+		New: func(env *sourcetest.Env) sourcetest.Source {
+			return prefixsource.NewScheduledPrefixSource(env.Ctx, env.Notify, []prefixcollector.ScheduledPrefix{
+				{Prefix: "10.20.0.0/16", End: time.Now().Add(time.Hour)},
+			})
+		},
+		Expected: []string{"10.20.0.0/16"},
+	})
+}
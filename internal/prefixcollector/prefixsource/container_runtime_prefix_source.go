@@ -0,0 +1,240 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// dockerDaemonConfig is networking part of Docker daemon.json
+type dockerDaemonConfig struct {
+	// BIP is address and network of docker0 bridge
+	BIP string `json:"bip"`
+	// FixedCIDR and FixedCIDRv6 are subnets of docker0 bridge containers addresses
+	FixedCIDR   string `json:"fixed-cidr"`
+	FixedCIDRv6 string `json:"fixed-cidr-v6"`
+	// DefaultAddressPools are pools user defined networks subnets are allocated from
+	DefaultAddressPools []struct {
+		Base string `json:"base"`
+	} `json:"default-address-pools"`
+}
+
+// podmanNetworkConfig is netavark network file of Podman
+type podmanNetworkConfig struct {
+	Subnets []struct {
+		Subnet string `json:"subnet"`
+	} `json:"subnets"`
+}
+
+// ContainerRuntimePrefixSource is excluded prefix source of bridge networks of Docker, Podman and nerdctl running
+// next to Kubernetes on the node, which silently collide with NSM pools: networks of the runtimes bridge interfaces,
+// subnets and address pools of Docker daemon.json, Podman netavark networks and nerdctl or Podman CNI network
+// lists. Interfaces require hostNetwork, config files should be mounted from the host.
+type ContainerRuntimePrefixSource struct {
+	options  *ContainerRuntimeOptions
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// ContainerRuntimeOptions are ContainerRuntimePrefixSource settings, missing files are skipped
+type ContainerRuntimeOptions struct {
+	// Interfaces are path.Match patterns of the runtimes bridge interfaces names
+	Interfaces []string
+	// DockerConfigPath is path of Docker daemon.json, not read if it is empty
+	DockerConfigPath string
+	// PodmanNetworksDir is directory of Podman netavark .json network files, not read if it is empty
+	PodmanNetworksDir string
+	// CNIConfigs are glob patterns of nerdctl and Podman CNI .conflist files
+	CNIConfigs      []string
+	RefreshInterval time.Duration
+}
+
+// NewContainerRuntimePrefixSource creates ContainerRuntimePrefixSource
+func NewContainerRuntimePrefixSource(ctx context.Context, notify *utils.EventBus,
+	options *ContainerRuntimeOptions) *ContainerRuntimePrefixSource {
+	crps := &ContainerRuntimePrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(crps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll container runtime networks")
+		defer span.Finish()
+		pollPrefixes(ctx, crps.Name(), options.RefreshInterval, crps.fetchPrefixes, crps.prefixes, notify, span.Logger())
+	})
+	return crps
+}
+
+// Prefixes returns prefixes from source
+func (crps *ContainerRuntimePrefixSource) Prefixes() []string {
+	return crps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (crps *ContainerRuntimePrefixSource) Name() string {
+	return "container-runtime"
+}
+
+func (crps *ContainerRuntimePrefixSource) fetchPrefixes(context.Context) ([]string, error) {
+	interfaces, err := listHostInterfaces(func(name string) bool {
+		return matchesAny(crps.options.Interfaces, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	configPrefixes, err := crps.configPrefixes()
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := []string{}
+	seen := map[string]bool{}
+	add := func(prefix string) {
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	for i := range interfaces {
+		for _, address := range interfaces[i].addresses {
+			if ip, ipNet, err := net.ParseCIDR(address); err == nil && !ip.IsLinkLocalUnicast() {
+				add(ipNet.String())
+			}
+		}
+	}
+	for _, prefix := range configPrefixes {
+		add(prefix)
+	}
+	return prefixes, nil
+}
+
+// configPrefixes returns subnets of Docker, Podman and CNI config files of the runtimes
+func (crps *ContainerRuntimePrefixSource) configPrefixes() ([]string, error) {
+	var prefixes []string
+	if crps.options.DockerConfigPath != "" {
+		dockerPrefixes, err := readRuntimeConfigs(dockerConfigPrefixes, crps.options.DockerConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, dockerPrefixes...)
+	}
+	if crps.options.PodmanNetworksDir != "" {
+		podmanPrefixes, err := readRuntimeConfigs(podmanNetworkPrefixes, filepath.Join(crps.options.PodmanNetworksDir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, podmanPrefixes...)
+	}
+	cniPrefixes, err := readRuntimeConfigs(cniNetworkListPrefixes, crps.options.CNIConfigs...)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefixes, cniPrefixes...), nil
+}
+
+// readRuntimeConfigs returns subnets of the files matching patterns parsed by prefixes
+func readRuntimeConfigs(prefixes func(data []byte) ([]string, error), patterns ...string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Wrong config files pattern %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var result []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Clean(file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s", file)
+		}
+		filePrefixes, err := prefixes(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse %s", file)
+		}
+		result = append(result, filePrefixes...)
+	}
+	return result, nil
+}
+
+// dockerConfigPrefixes returns docker0 bridge network and subnets, and address pools of Docker daemon.json
+func dockerConfigPrefixes(data []byte) ([]string, error) {
+	config := &dockerDaemonConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	values := []string{config.BIP, config.FixedCIDR, config.FixedCIDRv6}
+	for _, pool := range config.DefaultAddressPools {
+		values = append(values, pool.Base)
+	}
+	var prefixes []string
+	for _, value := range values {
+		if subnet, ok := addressSubnet(value); ok {
+			prefixes = append(prefixes, subnet)
+		}
+	}
+	return prefixes, nil
+}
+
+// podmanNetworkPrefixes returns subnets of Podman netavark network file
+func podmanNetworkPrefixes(data []byte) ([]string, error) {
+	config := &podmanNetworkConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	for _, subnet := range config.Subnets {
+		if prefix, ok := addressSubnet(subnet.Subnet); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, nil
+}
+
+// cniNetworkListPrefixes returns subnets CNI IPAM of CNI network list plugins allocates addresses from
+func cniNetworkListPrefixes(data []byte) ([]string, error) {
+	config := &cniNetworkConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	for _, plugin := range append([]cniNetworkConfig{*config}, config.Plugins...) {
+		pluginPrefixes, err := cniIPAMPrefixes(string(plugin.IPAM))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, pluginPrefixes...)
+	}
+	return prefixes, nil
+}
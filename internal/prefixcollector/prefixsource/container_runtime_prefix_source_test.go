@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+const (
+	dockerDaemonFile = `{
+	"bip": "172.26.0.1/16",
+	"fixed-cidr": "172.26.1.0/24",
+	"fixed-cidr-v6": "fd00:d0c::/64",
+	"default-address-pools": [{"base": "172.80.0.0/16", "size": 24}, {"base": "172.90.0.0/16", "size": 24}],
+	"log-driver": "json-file"
+}`
+	podmanNetworkFile = `{
+	"name": "podman",
+	"driver": "bridge",
+	"network_interface": "podman0",
+	"subnets": [{"subnet": "10.88.0.0/16", "gateway": "10.88.0.1"}, {"subnet": "fd00:88::/64"}]
+}`
+	nerdctlNetworkList = `{
+	"cniVersion": "1.0.0",
+	"name": "bridge",
+	"plugins": [
+		{"type": "bridge", "bridge": "nerdctl0", "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.4.0.0/24"}]]}},
+		{"type": "portmap"}
+	]
+}`
+)
+
+func TestContainerRuntimePrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	dockerConfig := filepath.Join(dir, "daemon.json")
+	g.Expect(ioutil.WriteFile(dockerConfig, []byte(dockerDaemonFile), 0600)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "podman.json"), []byte(podmanNetworkFile), 0600)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "nerdctl-bridge.conflist"), []byte(nerdctlNetworkList), 0600)).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewContainerRuntimePrefixSource(ctx, notify, &prefixsource.ContainerRuntimeOptions{
+		Interfaces:        []string{"nsm-missing*"},
+		DockerConfigPath:  dockerConfig,
+		PodmanNetworksDir: dir,
+		CNIConfigs:        []string{filepath.Join(dir, "nerdctl-*.conflist"), filepath.Join(dir, "missing", "*.conflist")},
+		RefreshInterval:   time.Hour,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{
+		"172.26.0.0/16", "172.26.1.0/24", "fd00:d0c::/64", "172.80.0.0/16", "172.90.0.0/16",
+		"10.88.0.0/16", "fd00:88::/64", "10.4.0.0/24",
+	}))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"path"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// CriticalServicePrefixSource is excluded prefix source of cluster IPs of the critical services like cert-manager
+// and admission webhooks. Their addresses are excluded as single address prefixes, so they are protected even if
+// the sources of the service subnet fail.
+type CriticalServicePrefixSource struct {
+	patterns []string
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// NewCriticalServicePrefixSource creates CriticalServicePrefixSource of the services, which namespace/name matches
+// any of path.Match patterns
+func NewCriticalServicePrefixSource(ctx context.Context, notify *utils.EventBus,
+	patterns []string) *CriticalServicePrefixSource {
+	csps := &CriticalServicePrefixSource{
+		patterns: patterns,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(csps.Name(), func() {
+		csps.watch(ctx, notify)
+	})
+	return csps
+}
+
+// Prefixes returns prefixes from source
+func (csps *CriticalServicePrefixSource) Prefixes() []string {
+	return csps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (csps *CriticalServicePrefixSource) Name() string {
+	return "critical-services"
+}
+
+func (csps *CriticalServicePrefixSource) watch(ctx context.Context, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch critical services")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ServiceResource),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               csps.Name(),
+		prefixesFunc:      csps.servicePrefixes,
+		prefixes:          csps.prefixes,
+		notify:            notify,
+		logger:            span.Logger(),
+	}
+	rw.run(ctx)
+}
+
+// servicePrefixes returns single address prefixes of the cluster IPs of the critical service,
+// other services and headless ones have no prefixes
+func (csps *CriticalServicePrefixSource) servicePrefixes(service *unstructured.Unstructured) ([]string, error) {
+	if !csps.critical(service.GetNamespace() + "/" + service.GetName()) {
+		return nil, nil
+	}
+	addresses, _, err := unstructured.NestedStringSlice(service.Object, "spec", "clusterIPs")
+	if err != nil {
+		return nil, err
+	}
+	if clusterIP, _, _ := unstructured.NestedString(service.Object, "spec", "clusterIP"); len(addresses) == 0 && clusterIP != "" {
+		addresses = []string{clusterIP}
+	}
+
+	prefixes := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if address == "None" {
+			continue
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("Invalid service cluster IP %q", address)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		prefixes = append(prefixes, ipToNet(ip).String())
+	}
+	return prefixes, nil
+}
+
+// critical returns true if namespace/name of the service matches any of the patterns
+func (csps *CriticalServicePrefixSource) critical(name string) bool {
+	for _, pattern := range csps.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
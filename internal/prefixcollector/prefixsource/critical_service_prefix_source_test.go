@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func clusterIPService(namespace, name string, clusterIPs ...interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{"clusterIPs": clusterIPs}
+	if len(clusterIPs) > 0 {
+		spec["clusterIP"] = clusterIPs[0]
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}}
+}
+
+func TestCriticalServicePrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		clusterIPService("cert-manager", "cert-manager-webhook", "10.96.10.1"),
+		clusterIPService("cert-manager", "cert-manager", "10.96.10.2", "fd00:96::2"),
+		clusterIPService("kube-system", "kube-dns", "10.96.0.10"),
+		clusterIPService("kube-system", "metrics-server", "10.96.0.20"),
+		clusterIPService("cert-manager", "headless", "None"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewCriticalServicePrefixSource(ctx, utils.NewEventBus(),
+		[]string{"cert-manager/*", "kube-system/kube-dns", "*/*-webhook"})
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.96.0.10/32", "10.96.10.1/32", "10.96.10.2/32", "fd00:96::2/128",
+	}))
+
+	services := client.Resource(prefixsource.ServiceResource)
+	_, err := services.Namespace("policy").Create(ctx,
+		clusterIPService("policy", "gatekeeper-webhook", "10.96.20.1"), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	err = services.Namespace("cert-manager").Delete(ctx, "cert-manager", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.96.0.10/32", "10.96.10.1/32", "10.96.20.1/32",
+	}))
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+var (
+	dhcpdSubnetRegexp  = regexp.MustCompile(`(?m)^\s*subnet\s+(\S+)\s+netmask\s+([^\s{]+)`)
+	dhcpdSubnet6Regexp = regexp.MustCompile(`(?m)^\s*subnet6\s+([^\s{]+)`)
+	dhcpdCommentRegexp = regexp.MustCompile(`#.*`)
+)
+
+// DHCPPrefixSource is excluded prefix source of DHCP scopes. Scopes are read from ISC Kea control agent
+// config-get command and from ISC dhcpd.conf file.
+type DHCPPrefixSource struct {
+	options  *DHCPOptions
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// DHCPOptions are DHCPPrefixSource settings
+type DHCPOptions struct {
+	// KeaURL is Kea control agent URL, Kea isn't queried if it is empty
+	KeaURL string
+	// KeaServices are Kea servers the command is forwarded to: dhcp4, dhcp6 or both
+	KeaServices     []string
+	KeaUsername     string
+	KeaPasswordPath string
+	// ConfPath is path of dhcpd.conf file, it isn't read if it is empty
+	ConfPath        string
+	RefreshInterval time.Duration
+	Client          *http.Client
+}
+
+// keaSubnet is Kea subnet4 or subnet6 configuration
+type keaSubnet struct {
+	Subnet string `json:"subnet"`
+}
+
+// keaServerConfig is Kea Dhcp4 or Dhcp6 configuration
+type keaServerConfig struct {
+	Subnet4        []keaSubnet `json:"subnet4"`
+	Subnet6        []keaSubnet `json:"subnet6"`
+	SharedNetworks []struct {
+		Subnet4 []keaSubnet `json:"subnet4"`
+		Subnet6 []keaSubnet `json:"subnet6"`
+	} `json:"shared-networks"`
+}
+
+// NewDHCPPrefixSource creates DHCPPrefixSource
+func NewDHCPPrefixSource(ctx context.Context, notify *utils.EventBus, options *DHCPOptions) *DHCPPrefixSource {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	dps := &DHCPPrefixSource{
+		options:  options,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(dps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll DHCP scopes")
+		defer span.Finish()
+		pollPrefixes(ctx, dps.Name(), options.RefreshInterval, dps.fetchPrefixes, dps.prefixes, notify, span.Logger())
+	})
+	return dps
+}
+
+// Prefixes returns prefixes from source
+func (dps *DHCPPrefixSource) Prefixes() []string {
+	return dps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (dps *DHCPPrefixSource) Name() string {
+	return "dhcp"
+}
+
+// Scope returns scope of the source prefixes
+func (dps *DHCPPrefixSource) Scope() string {
+	return prefixcollector.ExternalScope
+}
+
+// fetchPrefixes fetches scopes from Kea and dhcpd.conf
+func (dps *DHCPPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	prefixes := []string{}
+	if dps.options.KeaURL != "" {
+		keaPrefixes, err := dps.fetchKeaSubnets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, keaPrefixes...)
+	}
+	if dps.options.ConfPath != "" {
+		data, err := ioutil.ReadFile(filepath.Clean(dps.options.ConfPath))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s", dps.options.ConfPath)
+		}
+		confPrefixes, err := dhcpdConfSubnets(string(data))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, confPrefixes...)
+	}
+	return prefixes, nil
+}
+
+// fetchKeaSubnets returns subnets of Kea servers configuration
+func (dps *DHCPPrefixSource) fetchKeaSubnets(ctx context.Context) ([]string, error) {
+	header := http.Header{}
+	if dps.options.KeaUsername != "" {
+		password, err := readSecret(ctx, dps.options.KeaPasswordPath)
+		if err != nil {
+			return nil, err
+		}
+		credentials := dps.options.KeaUsername + ":" + password
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	command := map[string]interface{}{"command": "config-get", "service": dps.options.KeaServices}
+	var responses []struct {
+		Result    int                        `json:"result"`
+		Text      string                     `json:"text"`
+		Arguments map[string]keaServerConfig `json:"arguments"`
+	}
+	if err := doJSON(ctx, dps.client, http.MethodPost, dps.options.KeaURL, header, command, &responses); err != nil {
+		return nil, err
+	}
+
+	var subnets []keaSubnet
+	for _, response := range responses {
+		if response.Result != 0 {
+			return nil, errors.Errorf("Kea config-get failed: %s", response.Text)
+		}
+		for _, config := range response.Arguments {
+			subnets = append(subnets, config.Subnet4...)
+			subnets = append(subnets, config.Subnet6...)
+			for _, sharedNetwork := range config.SharedNetworks {
+				subnets = append(subnets, sharedNetwork.Subnet4...)
+				subnets = append(subnets, sharedNetwork.Subnet6...)
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(subnets))
+	for _, subnet := range subnets {
+		prefixes = append(prefixes, subnet.Subnet)
+	}
+	return prefixes, nil
+}
+
+// dhcpdConfSubnets returns subnet and subnet6 declarations of dhcpd.conf
+func dhcpdConfSubnets(conf string) ([]string, error) {
+	conf = dhcpdCommentRegexp.ReplaceAllString(conf, "")
+
+	var prefixes []string
+	for _, match := range dhcpdSubnetRegexp.FindAllStringSubmatch(conf, -1) {
+		mask := net.ParseIP(match[2]).To4()
+		if mask == nil {
+			return nil, errors.Errorf("Wrong netmask of subnet %s: %s", match[1], match[2])
+		}
+		ones, bits := net.IPMask(mask).Size()
+		if bits == 0 {
+			return nil, errors.Errorf("Non canonical netmask of subnet %s: %s", match[1], match[2])
+		}
+		prefixes = append(prefixes, fmt.Sprintf("%s/%d", match[1], ones))
+	}
+	for _, match := range dhcpdSubnet6Regexp.FindAllStringSubmatch(conf, -1) {
+		prefixes = append(prefixes, strings.TrimSuffix(match[1], ";"))
+	}
+	return prefixes, nil
+}
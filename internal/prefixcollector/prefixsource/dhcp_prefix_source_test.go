@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+const dhcpdConf = `
+# subnet 192.168.0.0 netmask 255.255.0.0 {
+subnet 10.30.0.0 netmask 255.255.255.0 {
+  range 10.30.0.10 10.30.0.100;
+}
+subnet6 2001:db8:1::/64 {
+  range6 2001:db8:1::100 2001:db8:1::200;
+}
+`
+
+func TestDHCPPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	confPath := filepath.Join(t.TempDir(), "dhcpd.conf")
+	g.Expect(ioutil.WriteFile(confPath, []byte(dhcpdConf), 0600)).To(Succeed())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		command := struct {
+			Command string   `json:"command"`
+			Service []string `json:"service"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&command); err != nil || command.Command != "config-get" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"result": 0, "arguments": {"Dhcp4": {
+			"subnet4": [{"subnet": "10.10.0.0/24", "pools": [{"pool": "10.10.0.10 - 10.10.0.100"}]}],
+			"shared-networks": [{"name": "lan", "subnet4": [{"subnet": "10.20.0.0/24"}]}]
+		}}}]`)
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewDHCPPrefixSource(ctx, notify, &prefixsource.DHCPOptions{
+		KeaURL:          server.URL,
+		KeaServices:     []string{"dhcp4"},
+		ConfPath:        confPath,
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.10.0.0/24", "10.20.0.0/24", "10.30.0.0/24", "2001:db8:1::/64"}))
+}
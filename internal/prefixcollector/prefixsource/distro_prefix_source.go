@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"strings"
+
+	apiV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// KindDistro is kind (Kubernetes in Docker) local development distribution
+	KindDistro = "kind"
+	// MinikubeDistro is minikube local development distribution
+	MinikubeDistro = "minikube"
+	// DockerDesktopDistro is Kubernetes of Docker Desktop
+	DockerDesktopDistro = "docker-desktop"
+
+	kindProviderIDPrefix = "kind://"
+	minikubeNameLabel    = "minikube.k8s.io/name"
+)
+
+// DistroPrefixes are default pod, service and node network subnets of the local development distributions
+var DistroPrefixes = map[string][]string{
+	KindDistro:          {"10.244.0.0/16", "10.96.0.0/16"},
+	MinikubeDistro:      {"10.244.0.0/16", "10.96.0.0/12", "192.168.49.0/24"},
+	DockerDesktopDistro: {"10.1.0.0/16", "10.96.0.0/12"},
+}
+
+// DistroPrefixSource is excluded prefix source of default subnets of the detected local development distribution,
+// so NSM tested locally gets correct exclusions out of the box. Other clusters have no prefixes.
+type DistroPrefixSource struct {
+	ctx      context.Context
+	notify   *utils.EventBus
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// NewDistroPrefixSource creates DistroPrefixSource
+func NewDistroPrefixSource(ctx context.Context, notify *utils.EventBus) *DistroPrefixSource {
+	dps := &DistroPrefixSource{
+		ctx:      ctx,
+		notify:   notify,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(dps.Name(), dps.detect)
+	return dps
+}
+
+// Prefixes returns prefixes from source
+func (dps *DistroPrefixSource) Prefixes() []string {
+	return dps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (dps *DistroPrefixSource) Name() string {
+	return "distro"
+}
+
+// detect detects distribution by the cluster nodes at start and on every forced resync until ctx is done
+func (dps *DistroPrefixSource) detect() {
+	span := spanhelper.FromContext(dps.ctx, "Detect local development distribution")
+	defer span.Finish()
+	logger := span.Logger()
+	resync := prefixcollector.ResyncSignal(dps.ctx).Subscribe()
+
+	for {
+		nodes, err := prefixcollector.KubernetesInterface(dps.ctx).CoreV1().Nodes().List(dps.ctx, metav1.ListOptions{})
+		if err != nil {
+			logger.Errorf("Failed to list nodes: %v", err)
+		} else {
+			prefixcollector.RefreshTimes(dps.ctx).Touch(dps.Name())
+			distro := DetectDistro(nodes.Items)
+			if prefixes := DistroPrefixes[distro]; !utils.UnorderedSlicesEquals(prefixes, dps.prefixes.Load()) {
+				dps.prefixes.Store(prefixes)
+				dps.notify.Notify()
+				logger.Infof("Default subnets of detected %q distribution are excluded: %v", distro, prefixes)
+			}
+		}
+
+		select {
+		case <-dps.ctx.Done():
+			return
+		case <-resync:
+		}
+	}
+}
+
+// DetectDistro returns local development distribution of the cluster nodes, empty string if it isn't detected
+func DetectDistro(nodes []apiV1.Node) string {
+	for i := range nodes {
+		switch {
+		case strings.HasPrefix(nodes[i].Spec.ProviderID, kindProviderIDPrefix):
+			return KindDistro
+		case nodes[i].Labels[minikubeNameLabel] != "":
+			return MinikubeDistro
+		case nodes[i].Name == DockerDesktopDistro:
+			return DockerDesktopDistro
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	apiV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDetectDistro(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(prefixsource.DetectDistro([]apiV1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "kind-control-plane"}, Spec: apiV1.NodeSpec{ProviderID: "kind://docker/kind/kind-control-plane"}},
+	})).To(Equal(prefixsource.KindDistro))
+	g.Expect(prefixsource.DetectDistro([]apiV1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "minikube", Labels: map[string]string{"minikube.k8s.io/name": "minikube"}}},
+	})).To(Equal(prefixsource.MinikubeDistro))
+	g.Expect(prefixsource.DetectDistro([]apiV1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "docker-desktop"}},
+	})).To(Equal(prefixsource.DockerDesktopDistro))
+	g.Expect(prefixsource.DetectDistro([]apiV1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}, Spec: apiV1.NodeSpec{ProviderID: "aws:///eu-west-1a/i-0123"}},
+	})).To(BeEmpty())
+}
+
+func TestDistroPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, fake.NewSimpleClientset(&apiV1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "minikube", Labels: map[string]string{"minikube.k8s.io/name": "minikube"}},
+	}))
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewDistroPrefixSource(ctx, notify)
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal(prefixsource.DistroPrefixes[prefixsource.MinikubeDistro]))
+}
@@ -26,6 +26,11 @@ func (e *EnvPrefixSource) Prefixes() []string {
 	return e.prefixes
 }
 
+// Name returns name of the source
+func (e *EnvPrefixSource) Name() string {
+	return "env"
+}
+
 // NewEnvPrefixSource creates EnvPrefixSource
 func NewEnvPrefixSource(prefixes []string) *EnvPrefixSource {
 	return &EnvPrefixSource{
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// FederationPrefixSource is excluded prefix source of the prefixes published by remote collector.
+// Prefixes originated in this cluster are dropped, so they don't loop between the clusters.
+type FederationPrefixSource struct {
+	options  *FederationOptions
+	client   aggregation.FederationClient
+	prefixes *utils.SynchronizedPrefixesContainer
+	// entries is []aggregation.FederatedPrefix of the last pulled prefixes
+	entries atomic.Value
+}
+
+// FederationOptions are FederationPrefixSource settings
+type FederationOptions struct {
+	// Cluster is id of this cluster
+	Cluster string
+	// RemoteCluster is expected id of the remote collector cluster
+	RemoteCluster string
+	// URL is URL of the remote collector gRPC API
+	URL             *url.URL
+	RefreshInterval time.Duration
+	DialOptions     []grpc.DialOption
+}
+
+// NewFederationPrefixSource creates FederationPrefixSource
+func NewFederationPrefixSource(ctx context.Context, notify *utils.EventBus, options *FederationOptions) *FederationPrefixSource {
+	fps := &FederationPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(fps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll federation "+options.RemoteCluster)
+		defer span.Finish()
+
+		dialOptions := append(aggregation.DialOptions(), options.DialOptions...)
+		cc, err := grpc.DialContext(ctx, grpcutils.URLToTarget(options.URL), dialOptions...)
+		if err != nil {
+			span.Logger().Errorf("Failed to dial remote collector %s: %v", options.URL, err)
+			return
+		}
+		defer func() { _ = cc.Close() }()
+
+		fps.client = aggregation.NewFederationClient(cc)
+		pollPrefixes(ctx, fps.Name(), options.RefreshInterval, fps.fetchPrefixes, fps.prefixes, notify, span.Logger())
+	})
+	return fps
+}
+
+// Prefixes returns prefixes from source
+func (fps *FederationPrefixSource) Prefixes() []string {
+	return fps.prefixes.Load()
+}
+
+// FederatedPrefixes returns the last pulled prefixes with their origin metadata
+func (fps *FederationPrefixSource) FederatedPrefixes() []aggregation.FederatedPrefix {
+	entries, _ := fps.entries.Load().([]aggregation.FederatedPrefix)
+	return entries
+}
+
+// Name returns name of the source, it is used by remote collector to recognize prefixes pulled from it
+func (fps *FederationPrefixSource) Name() string {
+	return aggregation.FederationSourcePrefix + fps.options.RemoteCluster
+}
+
+// Scope returns scope of the source prefixes
+func (fps *FederationPrefixSource) Scope() string {
+	return prefixcollector.FederatedScope
+}
+
+func (fps *FederationPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fps.options.RefreshInterval)
+	defer cancel()
+
+	response, err := fps.client.Prefixes(ctx, &aggregation.PrefixesRequest{Cluster: fps.options.Cluster})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to pull prefixes from remote collector %s", fps.options.URL)
+	}
+	if response.Cluster != fps.options.RemoteCluster {
+		return nil, errors.Errorf("Remote collector %s cluster is %q, expected %q",
+			fps.options.URL, response.Cluster, fps.options.RemoteCluster)
+	}
+
+	entries := make([]aggregation.FederatedPrefix, 0, len(response.Prefixes))
+	prefixes := make([]string, 0, len(response.Prefixes))
+	for _, entry := range response.Prefixes {
+		if entry.Origin == fps.options.Cluster {
+			continue
+		}
+		entries = append(entries, entry)
+		prefixes = append(prefixes, entry.Prefix)
+	}
+	fps.entries.Store(entries)
+	return prefixes, nil
+}
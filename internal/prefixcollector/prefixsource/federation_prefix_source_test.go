@@ -0,0 +1,216 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+)
+
+type federatedSource struct {
+	entries []aggregation.FederatedPrefix
+}
+
+func (s *federatedSource) Prefixes() []string {
+	return nil
+}
+
+func (s *federatedSource) FederatedPrefixes() []aggregation.FederatedPrefix {
+	return s.entries
+}
+
+func TestFederationPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	server := aggregation.NewServer()
+	aggregation.RegisterFederationServer(server,
+		aggregation.NewFederation("core", 0,
+			prefixsource.NewEnvPrefixSource([]string{"10.96.0.0/12"}),
+			&federatedSource{entries: []aggregation.FederatedPrefix{
+				{Prefix: "10.10.0.0/16", Origin: "region", Hops: 1},
+				{Prefix: "10.20.0.0/16", Origin: "edge", Hops: 1},
+			}},
+		))
+	listenURL := &url.URL{Scheme: "tcp", Host: "127.0.0.1:0"}
+	errCh := grpcutils.ListenAndServe(serverCtx, listenURL, server)
+	defer func() {
+		stopServer()
+		<-errCh
+	}()
+
+	sourceCtx, stopSource := context.WithCancel(ctx)
+	defer stopSource()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewFederationPrefixSource(sourceCtx, notify, &prefixsource.FederationOptions{
+		Cluster:         "edge",
+		RemoteCluster:   "core",
+		URL:             listenURL,
+		RefreshInterval: time.Hour,
+		DialOptions:     []grpc.DialOption{grpc.WithInsecure()},
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Name()).To(Equal("federation/core"))
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.96.0.0/12", "10.10.0.0/16"}))
+	g.Expect(source.FederatedPrefixes()).To(Equal([]aggregation.FederatedPrefix{
+		{Prefix: "10.96.0.0/12", Origin: "core"},
+		{Prefix: "10.10.0.0/16", Origin: "region", Hops: 2},
+	}))
+	stopSource()
+
+	// source of unexpected cluster doesn't get prefixes
+	mismatchCtx, stopMismatch := context.WithCancel(ctx)
+	defer stopMismatch()
+	mismatch := prefixsource.NewFederationPrefixSource(mismatchCtx, notify, &prefixsource.FederationOptions{
+		Cluster:         "edge",
+		RemoteCluster:   "core-2",
+		URL:             listenURL,
+		RefreshInterval: time.Hour,
+		DialOptions:     []grpc.DialOption{grpc.WithInsecure()},
+	})
+	g.Consistently(notify.Events(), 200*time.Millisecond).ShouldNot(Receive())
+	g.Expect(mismatch.Prefixes()).To(BeEmpty())
+}
+
+func TestFederationPrefixSourceTLS(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	writeTestCertificates(t, dir)
+	serverTLS, err := utils.ServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"),
+		filepath.Join(dir, "ca.pem"))
+	g.Expect(err).To(BeNil())
+	clientTLS, err := utils.ClientTLSConfig(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"),
+		filepath.Join(dir, "client-key.pem"))
+	g.Expect(err).To(BeNil())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	server := aggregation.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	aggregation.RegisterFederationServer(server,
+		aggregation.NewFederation("core", 0, prefixsource.NewEnvPrefixSource([]string{"10.96.0.0/12"})))
+	listenURL := &url.URL{Scheme: "tcp", Host: "127.0.0.1:0"}
+	errCh := grpcutils.ListenAndServe(serverCtx, listenURL, server)
+	defer func() {
+		stopServer()
+		<-errCh
+	}()
+
+	sourceCtx, stopSource := context.WithCancel(ctx)
+	defer stopSource()
+	notify := utils.NewEventBus()
+	source := prefixsource.NewFederationPrefixSource(sourceCtx, notify, &prefixsource.FederationOptions{
+		Cluster:         "edge",
+		RemoteCluster:   "core",
+		URL:             listenURL,
+		RefreshInterval: time.Hour,
+		DialOptions:     []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(clientTLS))},
+	})
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.96.0.0/12"}))
+	stopSource()
+
+	// clients without certificates of the client CA are rejected
+	for _, dialOption := range []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: clientTLS.RootCAs, MinVersion: tls.VersionTLS12})),
+	} {
+		cc, err := grpc.DialContext(ctx, listenURL.Host, append(aggregation.DialOptions(), dialOption)...)
+		g.Expect(err).To(BeNil())
+		requestCtx, cancelRequest := context.WithTimeout(ctx, time.Second)
+		_, err = aggregation.NewFederationClient(cc).Prefixes(requestCtx, &aggregation.PrefixesRequest{Cluster: "edge"})
+		cancelRequest()
+		g.Expect(err).NotTo(BeNil())
+		g.Expect(cc.Close()).To(BeNil())
+	}
+}
+
+// writeTestCertificates writes CA ca.pem, server.pem certificate of 127.0.0.1 and client.pem certificate
+// it issued with their server-key.pem and client-key.pem keys to dir
+func writeTestCertificates(t *testing.T, dir string) {
+	g := NewWithT(t)
+	now := time.Now()
+	caPublic, caKey, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).To(BeNil())
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, caPublic, caKey)
+	g.Expect(err).To(BeNil())
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", caDER)
+
+	for i, name := range []string{"server", "client"} {
+		public, key, err := ed25519.GenerateKey(rand.Reader)
+		g.Expect(err).To(BeNil())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, public, caKey)
+		g.Expect(err).To(BeNil())
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		g.Expect(err).To(BeNil())
+		writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+		writePEM(t, filepath.Join(dir, name+"-key.pem"), "PRIVATE KEY", keyDER)
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	NewWithT(t).Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+}
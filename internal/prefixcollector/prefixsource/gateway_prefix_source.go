@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// GatewayAPIGroup is API group of Gateway API resources
+	GatewayAPIGroup = "gateway.networking.k8s.io"
+	// GatewayAddressPoolsKey is key of GatewayClass parameters config map listing CIDRs of the address pools
+	// the gateways of the class are assigned addresses from
+	GatewayAddressPoolsKey = "addressPools"
+)
+
+// GatewayPrefixSource is excluded prefix source of Gateway API: IP addresses of Gateway statuses and address pools
+// of GatewayClass parameters config maps. Parameters config maps are read on GatewayClass changes and resyncs.
+type GatewayPrefixSource struct {
+	gatewayPrefixes *utils.SynchronizedPrefixesContainer
+	classPrefixes   *utils.SynchronizedPrefixesContainer
+}
+
+// GatewayResource returns Gateway resource of Gateway API version
+func GatewayResource(version string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: GatewayAPIGroup, Version: version, Resource: "gateways"}
+}
+
+// GatewayClassResource returns GatewayClass resource of Gateway API version
+func GatewayClassResource(version string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: GatewayAPIGroup, Version: version, Resource: "gatewayclasses"}
+}
+
+// NewGatewayPrefixSource creates GatewayPrefixSource watching resources of Gateway API version
+func NewGatewayPrefixSource(ctx context.Context, notify *utils.EventBus, version string) *GatewayPrefixSource {
+	gps := &GatewayPrefixSource{
+		gatewayPrefixes: utils.NewSynchronizedPrefixesContainer(),
+		classPrefixes:   utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	client := prefixcollector.DynamicInterface(ctx)
+	prefixcollector.Lifecycle(ctx).Go(gps.Name()+"/gateways", func() {
+		gps.watch(ctx, "gateways", &resourceWatch{
+			resourceInterface: client.Resource(GatewayResource(version)),
+			key:               gps.Name() + "/gateways",
+			prefixesFunc:      gatewayPrefixes,
+			prefixes:          gps.gatewayPrefixes,
+			notify:            notify,
+		})
+	})
+	prefixcollector.Lifecycle(ctx).Go(gps.Name()+"/gatewayclasses", func() {
+		gps.watch(ctx, "gateway classes", &resourceWatch{
+			resourceInterface: client.Resource(GatewayClassResource(version)),
+			key:               gps.Name() + "/gatewayclasses",
+			prefixesFunc:      gatewayClassPrefixesFunc(ctx, client),
+			prefixes:          gps.classPrefixes,
+			notify:            notify,
+		})
+	})
+	return gps
+}
+
+// Prefixes returns prefixes from source
+func (gps *GatewayPrefixSource) Prefixes() []string {
+	return append(gps.gatewayPrefixes.Load(), gps.classPrefixes.Load()...)
+}
+
+// Name returns name of the source
+func (gps *GatewayPrefixSource) Name() string {
+	return "gateway-api"
+}
+
+func (gps *GatewayPrefixSource) watch(ctx context.Context, resources string, rw *resourceWatch) {
+	span := spanhelper.FromContext(ctx, "Watch Gateway API "+resources)
+	defer span.Finish()
+
+	rw.versions = prefixcollector.ResourceVersions(ctx)
+	rw.logger = span.Logger()
+	rw.run(ctx)
+}
+
+// gatewayPrefixes returns single address prefixes of IP addresses of the gateway status
+func gatewayPrefixes(gateway *unstructured.Unstructured) ([]string, error) {
+	addresses, _, err := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	for _, address := range addresses {
+		fields, ok := address.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// address type defaults to IPAddress, other types like Hostname have no prefixes
+		if addressType, ok := fields["type"].(string); ok && addressType != "" && addressType != "IPAddress" {
+			continue
+		}
+		value, _ := fields["value"].(string)
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, errors.Errorf("Invalid gateway IP address %q", value)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		prefixes = append(prefixes, ipToNet(ip).String())
+	}
+	return prefixes, nil
+}
+
+// gatewayClassPrefixesFunc returns func, which returns address pools of the gateway class parameters config map.
+// Gateway classes without config map parameters have no prefixes.
+func gatewayClassPrefixesFunc(ctx context.Context, client dynamic.Interface) resourcePrefixesFunc {
+	return func(gatewayClass *unstructured.Unstructured) ([]string, error) {
+		parameters, ok, err := unstructured.NestedStringMap(gatewayClass.Object, "spec", "parametersRef")
+		if err != nil || !ok || parameters["group"] != "" || parameters["kind"] != "ConfigMap" {
+			return nil, err
+		}
+		configMap, err := client.Resource(ConfigMapResource).Namespace(parameters["namespace"]).
+			Get(ctx, parameters["name"], metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get parameters config map %s/%s",
+				parameters["namespace"], parameters["name"])
+		}
+		pools, _, err := unstructured.NestedString(configMap.Object, "data", GatewayAddressPoolsKey)
+		if err != nil || pools == "" {
+			return nil, err
+		}
+		var prefixes prefixcollector.PrefixList
+		if err := prefixes.Decode(pools); err != nil {
+			return nil, err
+		}
+		return prefixes, nil
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func gateway(namespace, name string, addresses ...map[string]interface{}) *unstructured.Unstructured {
+	statusAddresses := make([]interface{}, 0, len(addresses))
+	for _, address := range addresses {
+		statusAddresses = append(statusAddresses, address)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prefixsource.GatewayAPIGroup + "/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"status":     map[string]interface{}{"addresses": statusAddresses},
+	}}
+}
+
+func gatewayClass(name, parametersKind, parametersName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prefixsource.GatewayAPIGroup + "/v1",
+		"kind":       "GatewayClass",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"controllerName": "example.com/gateway-controller",
+			"parametersRef": map[string]interface{}{
+				"group": "", "kind": parametersKind, "name": parametersName, "namespace": "gateway-system",
+			},
+		},
+	}}
+}
+
+func TestGatewayPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	parameters := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "pools", "namespace": "gateway-system"},
+		"data":       map[string]interface{}{prefixsource.GatewayAddressPoolsKey: "172.18.100.0/24, fd00:100::/120"},
+	}}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		parameters,
+		gatewayClass("pooled", "ConfigMap", "pools"),
+		gatewayClass("other", "Secret", "pools"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	// gateways are created with the resource, the fake client guesses "gatewaies" resource of Gateway kind
+	gateways := client.Resource(prefixsource.GatewayResource("v1"))
+	for _, created := range []*unstructured.Unstructured{
+		gateway("team-a", "ingress",
+			map[string]interface{}{"type": "IPAddress", "value": "172.18.100.5"},
+			map[string]interface{}{"type": "Hostname", "value": "ingress.example.com"}),
+		gateway("team-b", "ingress", map[string]interface{}{"value": "fd00:100::5"}),
+	} {
+		_, err := gateways.Namespace(created.GetNamespace()).Create(ctx, created, metav1.CreateOptions{})
+		g.Expect(err).To(BeNil())
+	}
+
+	source := prefixsource.NewGatewayPrefixSource(ctx, utils.NewEventBus(), "v1")
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"172.18.100.0/24", "172.18.100.5/32", "fd00:100::/120", "fd00:100::5/128",
+	}))
+
+	_, err := gateways.Namespace("team-a").Update(ctx, gateway("team-a", "ingress",
+		map[string]interface{}{"type": "IPAddress", "value": "172.18.100.6"}), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	err = client.Resource(prefixsource.GatewayClassResource("v1")).Delete(ctx, "pooled", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"172.18.100.6/32", "fd00:100::5/128"}))
+}
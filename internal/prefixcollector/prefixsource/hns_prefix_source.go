@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// hnsNetworksResponse is response of Host Networking Service GET /networks/ request
+type hnsNetworksResponse struct {
+	Success bool         `json:"Success"`
+	Error   string       `json:"Error"`
+	Output  []hnsNetwork `json:"Output"`
+}
+
+// hnsNetwork is Host Networking Service network, e.g. l2bridge network of the node pods or nat network of Docker
+type hnsNetwork struct {
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	Subnets []struct {
+		AddressPrefix string `json:"AddressPrefix"`
+	} `json:"Subnets"`
+}
+
+// HNSPrefixSource is excluded prefix source of the subnets of Host Networking Service networks of Windows node,
+// e.g. pod subnets of Flannel, Calico or Azure CNI l2bridge and overlay networks and Docker nat network.
+// It requires HostProcess container to query HNS of the node.
+type HNSPrefixSource struct {
+	options  *HNSOptions
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// HNSOptions are HNSPrefixSource settings
+type HNSOptions struct {
+	// Networks are path.Match patterns of the networks names, subnets of all the networks are excluded if empty
+	Networks        []string
+	RefreshInterval time.Duration
+}
+
+// NewHNSPrefixSource creates HNSPrefixSource
+func NewHNSPrefixSource(ctx context.Context, notify *utils.EventBus, options *HNSOptions) *HNSPrefixSource {
+	hps := &HNSPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(hps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll HNS networks")
+		defer span.Finish()
+		pollPrefixes(ctx, hps.Name(), options.RefreshInterval, hps.fetchPrefixes, hps.prefixes, notify, span.Logger())
+	})
+	return hps
+}
+
+// Prefixes returns prefixes from source
+func (hps *HNSPrefixSource) Prefixes() []string {
+	return hps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (hps *HNSPrefixSource) Name() string {
+	return "hns-networks"
+}
+
+func (hps *HNSPrefixSource) fetchPrefixes(context.Context) ([]string, error) {
+	data, err := queryHNSNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return hnsNetworksPrefixes(data, hps.options.Networks)
+}
+
+// hnsNetworksPrefixes returns subnets of HNS networks response data, which names match networks patterns
+func hnsNetworksPrefixes(data []byte, networks []string) ([]string, error) {
+	response := &hnsNetworksResponse{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse HNS networks")
+	}
+	if !response.Success {
+		return nil, errors.Errorf("HNS networks request failed: %s", response.Error)
+	}
+
+	prefixes := []string{}
+	seen := map[string]bool{}
+	for i := range response.Output {
+		network := &response.Output[i]
+		if len(networks) > 0 && !matchesAny(networks, network.Name) {
+			continue
+		}
+		for _, subnet := range network.Subnets {
+			_, ipNet, err := net.ParseCIDR(subnet.AddressPrefix)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Wrong subnet of %s HNS network", network.Name)
+			}
+			if prefix := ipNet.String(); !seen[prefix] {
+				seen[prefix] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const hnsNetworks = `{"Success": true, "Output": [
+	{"Name": "cbr0", "Type": "L2Bridge", "Subnets": [{"AddressPrefix": "10.244.1.0/24", "GatewayAddress": "10.244.1.1"}]},
+	{"Name": "nat", "Type": "nat", "Subnets": [{"AddressPrefix": "172.28.16.1/20"}]},
+	{"Name": "vxlan0", "Type": "Overlay", "Subnets": [{"AddressPrefix": "10.244.1.0/24"}, {"AddressPrefix": "fd00:1::/64"}]}
+]}`
+
+func TestHNSNetworksPrefixes(t *testing.T) {
+	g := NewWithT(t)
+
+	prefixes, err := hnsNetworksPrefixes([]byte(hnsNetworks), nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prefixes).To(Equal([]string{"10.244.1.0/24", "172.28.16.0/20", "fd00:1::/64"}))
+
+	prefixes, err = hnsNetworksPrefixes([]byte(hnsNetworks), []string{"cbr*", "nat"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prefixes).To(Equal([]string{"10.244.1.0/24", "172.28.16.0/20"}))
+
+	_, err = hnsNetworksPrefixes([]byte(`{"Success": false, "Error": "Element not found."}`), nil)
+	g.Expect(err).To(MatchError(ContainSubstring("Element not found.")))
+	_, err = hnsNetworksPrefixes([]byte(`{"Success": true, "Output": [{"Name": "cbr0", "Subnets": [{"AddressPrefix": "10.244.1.0"}]}]}`), nil)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package prefixsource
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	vmcompute     = syscall.NewLazyDLL("vmcompute.dll")
+	hnsCall       = vmcompute.NewProc("HNSCall")
+	ole32         = syscall.NewLazyDLL("ole32.dll")
+	coTaskMemFree = ole32.NewProc("CoTaskMemFree")
+)
+
+// queryHNSNetworks returns JSON response of Host Networking Service GET /networks/ request
+func queryHNSNetworks() ([]byte, error) {
+	if err := hnsCall.Find(); err != nil {
+		return nil, errors.Wrap(err, "Host Networking Service is not available")
+	}
+	method, _ := syscall.UTF16PtrFromString("GET")
+	path, _ := syscall.UTF16PtrFromString("/networks/")
+	request, _ := syscall.UTF16PtrFromString("")
+	var response *uint16
+	result, _, _ := hnsCall.Call(uintptr(unsafe.Pointer(method)), uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(request)), uintptr(unsafe.Pointer(&response)))
+	if response != nil {
+		defer func() { _, _, _ = coTaskMemFree.Call(uintptr(unsafe.Pointer(response))) }()
+	}
+	if result != 0 {
+		return nil, errors.Errorf("HNS networks request failed with HRESULT 0x%08x", uint32(result))
+	}
+	if response == nil {
+		return nil, errors.New("HNS networks request returned no response")
+	}
+	return []byte(utf16PtrToString(response)), nil
+}
+
+// utf16PtrToString returns string of NUL-terminated UTF-16 string at p
+func utf16PtrToString(p *uint16) string {
+	n := 0
+	for *(*uint16)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + uintptr(n)*2)) != 0 {
+		n++
+	}
+	return syscall.UTF16ToString((*[1 << 29]uint16)(unsafe.Pointer(p))[:n:n])
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bufio"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+var (
+	networkManagerAddressKeyRegexp = regexp.MustCompile(`^address(es)?\d*$`)
+	networkManagerRouteKeyRegexp   = regexp.MustCompile(`^routes?\d*$`)
+)
+
+// iniEntry is key value pair of INI file section
+type iniEntry struct {
+	section string
+	key     string
+	value   string
+}
+
+// HostNetworkConfigPrefixSource is excluded prefix source of subnets configured by systemd-networkd .network
+// files and NetworkManager keyfile connection profiles of the node. Subnets of the configured addresses and
+// routes destinations are excluded.
+type HostNetworkConfigPrefixSource struct {
+	options  *HostNetworkConfigOptions
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// HostNetworkConfigOptions are HostNetworkConfigPrefixSource settings
+type HostNetworkConfigOptions struct {
+	// NetworkdDirs are directories of systemd-networkd .network files and their .network.d drop-ins
+	NetworkdDirs []string
+	// NetworkManagerDirs are directories of NetworkManager .nmconnection keyfiles
+	NetworkManagerDirs []string
+	RefreshInterval    time.Duration
+}
+
+// NewHostNetworkConfigPrefixSource creates HostNetworkConfigPrefixSource
+func NewHostNetworkConfigPrefixSource(ctx context.Context, notify *utils.EventBus,
+	options *HostNetworkConfigOptions) *HostNetworkConfigPrefixSource {
+	hncps := &HostNetworkConfigPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(hncps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll host network config")
+		defer span.Finish()
+		pollPrefixes(ctx, hncps.Name(), options.RefreshInterval, hncps.fetchPrefixes, hncps.prefixes, notify, span.Logger())
+	})
+	return hncps
+}
+
+// Prefixes returns prefixes from source
+func (hncps *HostNetworkConfigPrefixSource) Prefixes() []string {
+	return hncps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (hncps *HostNetworkConfigPrefixSource) Name() string {
+	return "host-network-config"
+}
+
+// fetchPrefixes reads subnets of networkd and NetworkManager configuration files
+func (hncps *HostNetworkConfigPrefixSource) fetchPrefixes(context.Context) ([]string, error) {
+	prefixes := []string{}
+	for _, dir := range hncps.options.NetworkdDirs {
+		filePrefixes, err := readConfigFiles(networkdSubnets, filepath.Join(dir, "*.network"),
+			filepath.Join(dir, "*.network.d", "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, filePrefixes...)
+	}
+	for _, dir := range hncps.options.NetworkManagerDirs {
+		filePrefixes, err := readConfigFiles(networkManagerSubnets, filepath.Join(dir, "*.nmconnection"))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, filePrefixes...)
+	}
+	return prefixes, nil
+}
+
+// readConfigFiles returns subnets of INI files matching patterns, parsed with subnets
+func readConfigFiles(subnets func([]iniEntry) []string, patterns ...string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Wrong config files pattern %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var prefixes []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read %s", file)
+		}
+		prefixes = append(prefixes, subnets(parseINI(string(data)))...)
+	}
+	return prefixes, nil
+}
+
+// networkdSubnets returns subnets of Address and Route Destination settings of systemd-networkd .network file
+func networkdSubnets(entries []iniEntry) []string {
+	var prefixes []string
+	for _, entry := range entries {
+		isAddress := entry.key == "Address" && (entry.section == "Network" || entry.section == "Address")
+		isRoute := entry.key == "Destination" && entry.section == "Route"
+		if !isAddress && !isRoute {
+			continue
+		}
+		if subnet, ok := addressSubnet(entry.value); ok {
+			prefixes = append(prefixes, subnet)
+		}
+	}
+	return prefixes
+}
+
+// networkManagerSubnets returns subnets of addresses and routes settings of NetworkManager keyfile profile.
+// Values are lists separated by semicolons, of address or destination followed by comma separated gateway
+// and metric.
+func networkManagerSubnets(entries []iniEntry) []string {
+	var prefixes []string
+	for _, entry := range entries {
+		if entry.section != "ipv4" && entry.section != "ipv6" ||
+			!networkManagerAddressKeyRegexp.MatchString(entry.key) && !networkManagerRouteKeyRegexp.MatchString(entry.key) {
+			continue
+		}
+		for _, value := range strings.Split(entry.value, ";") {
+			if subnet, ok := addressSubnet(strings.Split(value, ",")[0]); ok {
+				prefixes = append(prefixes, subnet)
+			}
+		}
+	}
+	return prefixes
+}
+
+// addressSubnet returns subnet of address with prefix length, addresses without it are skipped
+func addressSubnet(address string) (string, bool) {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(address))
+	if err != nil {
+		return "", false
+	}
+	return ipNet.String(), true
+}
+
+// parseINI returns key value pairs of INI data in order, comments starting with # or ; are skipped
+func parseINI(data string) []iniEntry {
+	var entries []iniEntry
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		default:
+			if i := strings.Index(line, "="); i > 0 {
+				entries = append(entries, iniEntry{
+					section: section,
+					key:     strings.TrimSpace(line[:i]),
+					value:   strings.TrimSpace(line[i+1:]),
+				})
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+const (
+	networkdFile = `# uplink
+[Match]
+Name=eth0
+
+[Network]
+Address=192.168.10.15/24
+Address=fd00:10::15/64
+Gateway=192.168.10.1
+
+[Route]
+Destination=10.100.0.0/16
+Gateway=192.168.10.254
+
+[Route]
+Destination=10.200.0.1
+`
+	networkdDropIn = `[Address]
+Address=172.16.5.1/28
+`
+	networkManagerFile = `[connection]
+id=storage
+type=ethernet
+
+[ipv4]
+method=manual
+address1=10.50.0.20/24,10.50.0.1
+route1=10.60.0.0/16,10.50.0.254,100
+; route2=10.70.0.0/16
+
+[ipv6]
+method=auto
+addresses=fd00:50::20/64;fd00:51::20/64;
+`
+)
+
+func TestHostNetworkConfigPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	networkdDir := t.TempDir()
+	g.Expect(ioutil.WriteFile(filepath.Join(networkdDir, "10-eth0.network"), []byte(networkdFile), 0600)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(networkdDir, "10-eth0.link"), []byte(networkdDropIn), 0600)).To(Succeed())
+	g.Expect(os.Mkdir(filepath.Join(networkdDir, "10-eth0.network.d"), 0700)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(networkdDir, "10-eth0.network.d", "address.conf"),
+		[]byte(networkdDropIn), 0600)).To(Succeed())
+
+	networkManagerDir := t.TempDir()
+	g.Expect(ioutil.WriteFile(filepath.Join(networkManagerDir, "storage.nmconnection"),
+		[]byte(networkManagerFile), 0600)).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewHostNetworkConfigPrefixSource(ctx, notify, &prefixsource.HostNetworkConfigOptions{
+		NetworkdDirs:       []string{networkdDir, filepath.Join(networkdDir, "missing")},
+		NetworkManagerDirs: []string{networkManagerDir},
+		RefreshInterval:    time.Hour,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{
+		"192.168.10.0/24", "fd00:10::/64", "10.100.0.0/16", "172.16.5.0/28",
+		"10.50.0.0/24", "10.60.0.0/16", "fd00:50::/64", "fd00:51::/64",
+	}))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// PodResource is Kubernetes Pod resource
+var PodResource = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// HostNetworkPodPrefixSource is excluded prefix source of IPs of hostNetwork pods of all the namespaces.
+// It covers control plane components and node daemons, which addresses are out of the pod CIDR.
+type HostNetworkPodPrefixSource struct {
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// NewHostNetworkPodPrefixSource creates HostNetworkPodPrefixSource
+func NewHostNetworkPodPrefixSource(ctx context.Context, notify *utils.EventBus) *HostNetworkPodPrefixSource {
+	hnpps := &HostNetworkPodPrefixSource{
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(hnpps.Name(), func() {
+		hnpps.watch(ctx, notify)
+	})
+	return hnpps
+}
+
+// Prefixes returns prefixes from source
+func (hnpps *HostNetworkPodPrefixSource) Prefixes() []string {
+	return hnpps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (hnpps *HostNetworkPodPrefixSource) Name() string {
+	return "host-network-pods"
+}
+
+func (hnpps *HostNetworkPodPrefixSource) watch(ctx context.Context, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch hostNetwork pods")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(PodResource),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               hnpps.Name(),
+		prefixesFunc:      hostNetworkPodPrefixes,
+		prefixes:          hnpps.prefixes,
+		notify:            notify,
+		logger:            span.Logger(),
+	}
+	rw.run(ctx)
+}
+
+// hostNetworkPodPrefixes returns single address prefixes of the pod IPs if it is running hostNetwork pod,
+// other pods have no prefixes
+func hostNetworkPodPrefixes(pod *unstructured.Unstructured) ([]string, error) {
+	hostNetwork, _, err := unstructured.NestedBool(pod.Object, "spec", "hostNetwork")
+	if err != nil || !hostNetwork {
+		return nil, err
+	}
+	if phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase"); phase == "Succeeded" || phase == "Failed" {
+		return nil, nil
+	}
+
+	addresses := map[string]bool{}
+	if podIP, _, _ := unstructured.NestedString(pod.Object, "status", "podIP"); podIP != "" {
+		addresses[podIP] = true
+	}
+	podIPs, _, err := unstructured.NestedSlice(pod.Object, "status", "podIPs")
+	if err != nil {
+		return nil, err
+	}
+	for _, podIP := range podIPs {
+		if fields, ok := podIP.(map[string]interface{}); ok {
+			if address, ok := fields["ip"].(string); ok && address != "" {
+				addresses[address] = true
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(addresses))
+	for address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("Invalid pod IP %q", address)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		prefixes = append(prefixes, ipToNet(ip).String())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func hostNetworkPod(namespace, name string, hostNetwork bool, phase string, ips ...string) *unstructured.Unstructured {
+	podIPs := make([]interface{}, 0, len(ips))
+	for _, ip := range ips {
+		podIPs = append(podIPs, map[string]interface{}{"ip": ip})
+	}
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"hostNetwork": hostNetwork},
+		"status":     map[string]interface{}{"phase": phase, "podIPs": podIPs},
+	}}
+	if len(ips) > 0 {
+		_ = unstructured.SetNestedField(pod.Object, ips[0], "status", "podIP")
+	}
+	return pod
+}
+
+func TestHostNetworkPodPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		hostNetworkPod("kube-system", "kube-apiserver", true, "Running", "192.168.0.10"),
+		hostNetworkPod("kube-system", "kube-proxy", true, "Running", "192.168.0.11", "fd00::11"),
+		hostNetworkPod("kube-system", "completed", true, "Succeeded", "192.168.0.12"),
+		hostNetworkPod("default", "app", false, "Running", "10.244.0.5"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewHostNetworkPodPrefixSource(ctx, utils.NewEventBus())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"192.168.0.10/32", "192.168.0.11/32", "fd00::11/128",
+	}))
+
+	pods := client.Resource(prefixsource.PodResource)
+	_, err := pods.Namespace("monitoring").Create(ctx,
+		hostNetworkPod("monitoring", "node-exporter", true, "Running", "192.168.0.20"), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	err = pods.Namespace("kube-system").Delete(ctx, "kube-proxy", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"192.168.0.10/32", "192.168.0.20/32"}))
+}
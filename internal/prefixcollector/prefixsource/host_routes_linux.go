@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var routeProtocols = map[uint8]string{
+	syscall.RTPROT_REDIRECT: "redirect",
+	syscall.RTPROT_KERNEL:   "kernel",
+	syscall.RTPROT_BOOT:     "boot",
+	syscall.RTPROT_STATIC:   "static",
+	syscall.RTPROT_RA:       "ra",
+	syscall.RTPROT_DHCP:     "dhcp",
+}
+
+// listHostRoutes dumps unicast routes of all the node routing tables using netlink
+func listHostRoutes() ([]hostRoute, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to dump host routes")
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list host interfaces")
+	}
+	interfaceNames := make(map[int]string, len(interfaces))
+	for i := range interfaces {
+		interfaceNames[interfaces[i].Index] = interfaces[i].Name
+	}
+
+	return parseRouteMessages(data, interfaceNames)
+}
+
+// parseRouteMessages parses netlink RTM_NEWROUTE messages of unicast routes. Netlink attributes are in host
+// byte order.
+func parseRouteMessages(data []byte, interfaceNames map[int]string) ([]hostRoute, error) {
+	messages, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse netlink messages")
+	}
+
+	var routes []hostRoute
+	for i := range messages {
+		message := &messages[i]
+		if message.Header.Type != syscall.RTM_NEWROUTE || len(message.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		rtMsg := syscall.RtMsg{
+			Family:   message.Data[0],
+			Dst_len:  message.Data[1],
+			Table:    message.Data[4],
+			Protocol: message.Data[5],
+			Type:     message.Data[7],
+		}
+		if rtMsg.Type != syscall.RTN_UNICAST {
+			continue
+		}
+
+		attributes, err := syscall.ParseNetlinkRouteAttr(message)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse netlink route attributes")
+		}
+		route := hostRoute{
+			protocol: routeProtocol(rtMsg.Protocol),
+			table:    int(rtMsg.Table),
+		}
+		dst := net.IPv4zero
+		if rtMsg.Family == syscall.AF_INET6 {
+			dst = net.IPv6zero
+		}
+		for _, attribute := range attributes {
+			switch attribute.Attr.Type {
+			case syscall.RTA_DST:
+				dst = attribute.Value
+			case syscall.RTA_OIF:
+				route.iface = interfaceNames[int(utils.NativeEndian.Uint32(attribute.Value))]
+			case syscall.RTA_TABLE:
+				route.table = int(utils.NativeEndian.Uint32(attribute.Value))
+			}
+		}
+		route.prefix = fmt.Sprintf("%s/%d", net.IP(dst).String(), rtMsg.Dst_len)
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routeProtocol returns name of the route protocol, unknown protocols are named by their number
+func routeProtocol(protocol uint8) string {
+	if name, ok := routeProtocols[protocol]; ok {
+		return name
+	}
+	return strconv.Itoa(int(protocol))
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	. "github.com/onsi/gomega"
+)
+
+func routeAttribute(attributeType uint16, value []byte) []byte {
+	attribute := make([]byte, syscall.SizeofRtAttr, syscall.SizeofRtAttr+len(value)+3)
+	utils.NativeEndian.PutUint16(attribute[0:2], uint16(syscall.SizeofRtAttr+len(value)))
+	utils.NativeEndian.PutUint16(attribute[2:4], attributeType)
+	attribute = append(attribute, value...)
+	for len(attribute)%4 != 0 {
+		attribute = append(attribute, 0)
+	}
+	return attribute
+}
+
+func routeMessage(family, dstLen, protocol, routeType uint8, attributes ...[]byte) []byte {
+	message := make([]byte, syscall.SizeofNlMsghdr+syscall.SizeofRtMsg)
+	utils.NativeEndian.PutUint16(message[4:6], syscall.RTM_NEWROUTE)
+	rtMsg := message[syscall.SizeofNlMsghdr:]
+	rtMsg[0], rtMsg[1], rtMsg[4], rtMsg[5], rtMsg[7] = family, dstLen, syscall.RT_TABLE_MAIN, protocol, routeType
+	for _, attribute := range attributes {
+		message = append(message, attribute...)
+	}
+	utils.NativeEndian.PutUint32(message[0:4], uint32(len(message)))
+	return message
+}
+
+func TestParseRouteMessages(t *testing.T) {
+	g := NewWithT(t)
+
+	oif := make([]byte, 4)
+	utils.NativeEndian.PutUint32(oif, 2)
+
+	var data []byte
+	data = append(data, routeMessage(syscall.AF_INET, 24, syscall.RTPROT_KERNEL, syscall.RTN_UNICAST,
+		routeAttribute(syscall.RTA_DST, net.ParseIP("10.0.0.0").To4()), routeAttribute(syscall.RTA_OIF, oif))...)
+	data = append(data, routeMessage(syscall.AF_INET, 0, syscall.RTPROT_DHCP, syscall.RTN_UNICAST)...)
+	data = append(data, routeMessage(syscall.AF_INET6, 64, 12, syscall.RTN_UNICAST,
+		routeAttribute(syscall.RTA_DST, net.ParseIP("fd00::")))...)
+	data = append(data, routeMessage(syscall.AF_INET, 32, syscall.RTPROT_KERNEL, syscall.RTN_LOCAL,
+		routeAttribute(syscall.RTA_DST, net.ParseIP("10.0.0.1").To4()))...)
+
+	routes, err := parseRouteMessages(data, map[int]string{2: "eth0"})
+	g.Expect(err).To(BeNil())
+	g.Expect(routes).To(Equal([]hostRoute{
+		{prefix: "10.0.0.0/24", protocol: "kernel", table: syscall.RT_TABLE_MAIN, iface: "eth0"},
+		{prefix: "0.0.0.0/0", protocol: "dhcp", table: syscall.RT_TABLE_MAIN},
+		{prefix: "fd00::/64", protocol: "12", table: syscall.RT_TABLE_MAIN},
+	}))
+}
+
+func TestNetlinkLayout(t *testing.T) {
+	g := NewWithT(t)
+
+	// messages are parsed by offsets, which should be the same on all the architectures
+	g.Expect(int(unsafe.Sizeof(syscall.NlMsghdr{}))).To(Equal(syscall.SizeofNlMsghdr))
+	g.Expect(int(unsafe.Sizeof(syscall.RtMsg{}))).To(Equal(syscall.SizeofRtMsg))
+	g.Expect(int(unsafe.Sizeof(syscall.RtAttr{}))).To(Equal(syscall.SizeofRtAttr))
+	g.Expect(syscall.SizeofNlMsghdr).To(Equal(16))
+	g.Expect(syscall.SizeofRtMsg).To(Equal(12))
+	g.Expect(unsafe.Offsetof(syscall.RtMsg{}.Table)).To(Equal(uintptr(4)))
+	g.Expect(unsafe.Offsetof(syscall.RtMsg{}.Protocol)).To(Equal(uintptr(5)))
+	g.Expect(unsafe.Offsetof(syscall.RtMsg{}.Type)).To(Equal(uintptr(7)))
+}
+
+func TestListHostRoutes(t *testing.T) {
+	g := NewWithT(t)
+
+	// the node routes are dumped and parsed in host byte order of the test architecture
+	routes, err := listHostRoutes()
+	g.Expect(err).ToNot(HaveOccurred())
+	for i := range routes {
+		_, _, err := net.ParseCIDR(routes[i].prefix)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(routes[i].table).To(BeNumerically(">", 0))
+	}
+}
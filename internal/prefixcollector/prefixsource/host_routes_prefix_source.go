@@ -0,0 +1,166 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// hostRoute is route of the node routing table
+type hostRoute struct {
+	prefix string
+	// protocol is name of the route origin: kernel for directly connected routes, boot or static for static ones
+	protocol string
+	table    int
+	iface    string
+}
+
+// hostInterface is network interface of the node
+type hostInterface struct {
+	name string
+	// addresses are CIDRs of the interface addresses
+	addresses []string
+}
+
+// listHostInterfaces returns the node interfaces, which names match
+func listHostInterfaces(match func(name string) bool) ([]hostInterface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list host interfaces")
+	}
+	var matched []hostInterface
+	for i := range interfaces {
+		if !match(interfaces[i].Name) {
+			continue
+		}
+		addrs, err := interfaces[i].Addrs()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list addresses of %s interface", interfaces[i].Name)
+		}
+		hostIface := hostInterface{name: interfaces[i].Name}
+		for _, addr := range addrs {
+			hostIface.addresses = append(hostIface.addresses, addr.String())
+		}
+		matched = append(matched, hostIface)
+	}
+	return matched, nil
+}
+
+// HostRoutesPrefixSource is excluded prefix source of the node routing table routes.
+// It requires hostNetwork to read the node routing table.
+type HostRoutesPrefixSource struct {
+	options  *HostRoutesOptions
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// HostRoutesOptions are HostRoutesPrefixSource settings, routes matching all of them are excluded
+type HostRoutesOptions struct {
+	// Protocols are names of the route origins, e.g. kernel, boot or static
+	Protocols []string
+	// Tables are routing tables ids, e.g. 254 is the main table
+	Tables []int
+	// ExcludeInterfaces are path.Match patterns of output interfaces, which routes aren't excluded
+	ExcludeInterfaces []string
+	RefreshInterval   time.Duration
+}
+
+// NewHostRoutesPrefixSource creates HostRoutesPrefixSource
+func NewHostRoutesPrefixSource(ctx context.Context, notify *utils.EventBus, options *HostRoutesOptions) *HostRoutesPrefixSource {
+	hrps := &HostRoutesPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(hrps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll host routes")
+		defer span.Finish()
+		pollPrefixes(ctx, hrps.Name(), options.RefreshInterval, hrps.fetchPrefixes, hrps.prefixes, notify, span.Logger())
+	})
+	return hrps
+}
+
+// Prefixes returns prefixes from source
+func (hrps *HostRoutesPrefixSource) Prefixes() []string {
+	return hrps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (hrps *HostRoutesPrefixSource) Name() string {
+	return "host-routes"
+}
+
+func (hrps *HostRoutesPrefixSource) fetchPrefixes(context.Context) ([]string, error) {
+	routes, err := listHostRoutes()
+	if err != nil {
+		return nil, err
+	}
+	return filterHostRoutes(routes, hrps.options), nil
+}
+
+// filterHostRoutes returns prefixes of the routes matching options. Default routes are never excluded.
+func filterHostRoutes(routes []hostRoute, options *HostRoutesOptions) []string {
+	prefixes := []string{}
+	seen := map[string]bool{}
+	for i := range routes {
+		route := &routes[i]
+		if route.prefix == "0.0.0.0/0" || route.prefix == "::/0" ||
+			!containsString(options.Protocols, route.protocol) ||
+			!containsInt(options.Tables, route.table) ||
+			matchesAny(options.ExcludeInterfaces, route.iface) || seen[route.prefix] {
+			continue
+		}
+		seen[route.prefix] = true
+		prefixes = append(prefixes, route.prefix)
+	}
+	return prefixes
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFilterHostRoutes(t *testing.T) {
+	g := NewWithT(t)
+
+	routes := []hostRoute{
+		{prefix: "0.0.0.0/0", protocol: "dhcp", table: 254, iface: "eth0"},
+		{prefix: "10.0.0.0/24", protocol: "kernel", table: 254, iface: "eth0"},
+		{prefix: "10.0.0.0/24", protocol: "kernel", table: 254, iface: "eth1"},
+		{prefix: "10.1.0.0/16", protocol: "static", table: 254, iface: "eth0"},
+		{prefix: "10.2.0.0/16", protocol: "bird", table: 254, iface: "eth0"},
+		{prefix: "10.3.0.0/16", protocol: "static", table: 100, iface: "eth0"},
+		{prefix: "10.244.1.0/24", protocol: "kernel", table: 254, iface: "cni0"},
+		{prefix: "fd00::/64", protocol: "kernel", table: 254, iface: "eth0"},
+		{prefix: "::/0", protocol: "static", table: 254, iface: "eth0"},
+	}
+
+	prefixes := filterHostRoutes(routes, &HostRoutesOptions{
+		Protocols:         []string{"kernel", "static"},
+		Tables:            []int{254},
+		ExcludeInterfaces: []string{"cni*"},
+	})
+	g.Expect(prefixes).To(Equal([]string{"10.0.0.0/24", "10.1.0.0/16", "fd00::/64"}))
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package prefixsource
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ipForwardRowSize is size of MIB_IPFORWARD_ROW2, rows of MIB_IPFORWARD_TABLE2 follow its 8 bytes aligned
+	// number of entries
+	ipForwardRowSize    = 104
+	ipForwardRowsOffset = 8
+	// windowsRoutesTable is id the single Windows routing table is reported with, so the main table of Linux
+	// filters select it
+	windowsRoutesTable = 254
+)
+
+var (
+	iphlpapi           = syscall.NewLazyDLL("iphlpapi.dll")
+	getIPForwardTable2 = iphlpapi.NewProc("GetIpForwardTable2")
+	freeMibTable       = iphlpapi.NewProc("FreeMibTable")
+)
+
+// windowsRouteProtocols are names of NL_ROUTE_PROTOCOL values, local and static routes are named as their
+// Linux counterparts
+var windowsRouteProtocols = map[uint32]string{
+	2:     "kernel",
+	3:     "static",
+	4:     "redirect",
+	8:     "rip",
+	13:    "ospf",
+	14:    "bgp",
+	19:    "dhcp",
+	10002: "static",
+	10006: "static",
+	10007: "static",
+}
+
+// listHostRoutes dumps routes of the node routing table with IP Helper API
+func listHostRoutes() ([]hostRoute, error) {
+	if err := getIPForwardTable2.Find(); err != nil {
+		return nil, errors.Wrap(err, "IP Helper API is not available")
+	}
+	var table *byte
+	if result, _, _ := getIPForwardTable2.Call(syscall.AF_UNSPEC, uintptr(unsafe.Pointer(&table))); result != 0 {
+		return nil, errors.Wrap(syscall.Errno(result), "Failed to dump host routes")
+	}
+	defer func() { _, _, _ = freeMibTable.Call(uintptr(unsafe.Pointer(table))) }()
+
+	size := ipForwardRowsOffset + int(*(*uint32)(unsafe.Pointer(table)))*ipForwardRowSize
+	data := (*[1 << 30]byte)(unsafe.Pointer(table))[:size:size]
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list host interfaces")
+	}
+	interfaceNames := make(map[int]string, len(interfaces))
+	for i := range interfaces {
+		interfaceNames[interfaces[i].Index] = interfaces[i].Name
+	}
+
+	return parseRouteRows(data, interfaceNames), nil
+}
+
+// parseRouteRows parses MIB_IPFORWARD_ROW2 rows of MIB_IPFORWARD_TABLE2. Loopback, multicast and local host
+// routes, which Linux keeps in the local table, are skipped.
+func parseRouteRows(data []byte, interfaceNames map[int]string) []hostRoute {
+	var routes []hostRoute
+	for offset := ipForwardRowsOffset; offset+ipForwardRowSize <= len(data); offset += ipForwardRowSize {
+		row := data[offset : offset+ipForwardRowSize]
+		var dst net.IP
+		switch binary.LittleEndian.Uint16(row[12:14]) {
+		case syscall.AF_INET:
+			dst = net.IP(row[16:20])
+		case syscall.AF_INET6:
+			dst = net.IP(row[20:36])
+		default:
+			continue
+		}
+		prefixLength := int(row[40])
+		protocol := binary.LittleEndian.Uint32(row[88:92])
+		loopback := row[92] != 0
+		if loopback || dst.IsMulticast() || protocol == 2 && prefixLength == 8*len(dst) {
+			continue
+		}
+		routes = append(routes, hostRoute{
+			prefix:   fmt.Sprintf("%s/%d", dst.String(), prefixLength),
+			protocol: windowsRouteProtocol(protocol),
+			table:    windowsRoutesTable,
+			iface:    interfaceNames[int(binary.LittleEndian.Uint32(row[8:12]))],
+		})
+	}
+	return routes
+}
+
+// windowsRouteProtocol returns name of the route protocol, unknown protocols are named by their number
+func windowsRouteProtocol(protocol uint32) string {
+	if name, ok := windowsRouteProtocols[protocol]; ok {
+		return name
+	}
+	return strconv.Itoa(int(protocol))
+}
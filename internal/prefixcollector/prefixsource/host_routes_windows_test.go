@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package prefixsource
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func routeRow(ifIndex uint32, dst string, prefixLength uint8, protocol uint32, loopback bool) []byte {
+	row := make([]byte, ipForwardRowSize)
+	binary.LittleEndian.PutUint32(row[8:12], ifIndex)
+	if ip := net.ParseIP(dst); ip.To4() != nil {
+		binary.LittleEndian.PutUint16(row[12:14], syscall.AF_INET)
+		copy(row[16:20], ip.To4())
+	} else {
+		binary.LittleEndian.PutUint16(row[12:14], syscall.AF_INET6)
+		copy(row[20:36], ip)
+	}
+	row[40] = prefixLength
+	binary.LittleEndian.PutUint32(row[88:92], protocol)
+	if loopback {
+		row[92] = 1
+	}
+	return row
+}
+
+func TestParseRouteRows(t *testing.T) {
+	g := NewWithT(t)
+
+	data := make([]byte, ipForwardRowsOffset)
+	data = append(data, routeRow(2, "10.0.0.0", 24, 2, false)...)
+	data = append(data, routeRow(2, "10.0.0.5", 32, 2, false)...)
+	data = append(data, routeRow(1, "127.0.0.0", 8, 2, true)...)
+	data = append(data, routeRow(2, "224.0.0.0", 4, 2, false)...)
+	data = append(data, routeRow(2, "0.0.0.0", 0, 3, false)...)
+	data = append(data, routeRow(3, "fd00::", 64, 10002, false)...)
+	data = append(data, routeRow(3, "fd01::", 64, 99, false)...)
+
+	g.Expect(parseRouteRows(data, map[int]string{2: "Ethernet", 3: "vEthernet (cbr0)"})).To(Equal([]hostRoute{
+		{prefix: "10.0.0.0/24", protocol: "kernel", table: windowsRoutesTable, iface: "Ethernet"},
+		{prefix: "0.0.0.0/0", protocol: "static", table: windowsRoutesTable, iface: "Ethernet"},
+		{prefix: "fd00::/64", protocol: "static", table: windowsRoutesTable, iface: "vEthernet (cbr0)"},
+		{prefix: "fd01::/64", protocol: "99", table: windowsRoutesTable, iface: "vEthernet (cbr0)"},
+	}))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const infobloxPageSize = "1000"
+
+// infobloxObjectTypes are WAPI object types, networks of which are excluded
+var infobloxObjectTypes = []string{"network", "networkcontainer", "ipv6network", "ipv6networkcontainer"}
+
+// InfobloxPrefixSource is Infoblox WAPI excluded prefix source. It excludes networks and network containers
+// matching configured extensible attributes.
+type InfobloxPrefixSource struct {
+	options  *InfobloxOptions
+	query    url.Values
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// InfobloxOptions are InfobloxPrefixSource settings
+type InfobloxOptions struct {
+	// URL is WAPI base URL including version, e.g. https://infoblox.example.com/wapi/v2.10
+	URL          string
+	Username     string
+	PasswordPath string
+	// NetworkView is network view of the objects, all views are queried if it is empty
+	NetworkView string
+	// ExtensibleAttributes are values of extensible attributes, objects having all of them are excluded
+	ExtensibleAttributes map[string]string
+	RefreshInterval      time.Duration
+	Client               *http.Client
+}
+
+// NewInfobloxPrefixSource creates InfobloxPrefixSource
+func NewInfobloxPrefixSource(ctx context.Context, notify *utils.EventBus, options *InfobloxOptions) *InfobloxPrefixSource {
+	query := url.Values{
+		"_return_fields":    {"network"},
+		"_return_as_object": {"1"},
+		"_paging":           {"1"},
+		"_max_results":      {infobloxPageSize},
+	}
+	if options.NetworkView != "" {
+		query.Set("network_view", options.NetworkView)
+	}
+	for name, value := range options.ExtensibleAttributes {
+		query.Set("*"+name, value)
+	}
+
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ips := &InfobloxPrefixSource{
+		options:  options,
+		query:    query,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(ips.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll Infoblox networks")
+		defer span.Finish()
+		pollPrefixes(ctx, ips.Name(), options.RefreshInterval, ips.fetchPrefixes, ips.prefixes, notify, span.Logger())
+	})
+	return ips
+}
+
+// Prefixes returns prefixes from source
+func (ips *InfobloxPrefixSource) Prefixes() []string {
+	return ips.prefixes.Load()
+}
+
+// Name returns name of the source
+func (ips *InfobloxPrefixSource) Name() string {
+	return "infoblox"
+}
+
+// Scope returns scope of the source prefixes
+func (ips *InfobloxPrefixSource) Scope() string {
+	return prefixcollector.ExternalScope
+}
+
+// fetchPrefixes fetches networks of all the object types
+func (ips *InfobloxPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	password, err := readSecret(ctx, ips.options.PasswordPath)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(ips.options.Username+":"+password)))
+
+	prefixes := []string{}
+	for _, objectType := range infobloxObjectTypes {
+		networks, err := ips.fetchNetworks(ctx, objectType, header)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, networks...)
+	}
+	return prefixes, nil
+}
+
+// fetchNetworks fetches all pages of the object type networks
+func (ips *InfobloxPrefixSource) fetchNetworks(ctx context.Context, objectType string, header http.Header) ([]string, error) {
+	baseURL := strings.TrimSuffix(ips.options.URL, "/") + "/" + objectType
+	query := url.Values{}
+	for key, values := range ips.query {
+		query[key] = values
+	}
+
+	var networks []string
+	for {
+		page := struct {
+			NextPageID string `json:"next_page_id"`
+			Result     []struct {
+				Network string `json:"network"`
+			} `json:"result"`
+		}{}
+		if err := getJSON(ctx, ips.client, baseURL+"?"+query.Encode(), header, &page); err != nil {
+			return nil, err
+		}
+		for _, result := range page.Result {
+			networks = append(networks, result.Network)
+		}
+		if page.NextPageID == "" {
+			return networks, nil
+		}
+		query = url.Values{"_page_id": {page.NextPageID}}
+	}
+}
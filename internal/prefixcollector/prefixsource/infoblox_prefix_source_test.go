@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+func TestInfobloxPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	passwordPath := filepath.Join(t.TempDir(), "password")
+	g.Expect(ioutil.WriteFile(passwordPath, []byte("secret"), 0600)).To(Succeed())
+
+	pages := map[string]string{
+		"/wapi/v2.10/network":              `{"result": [{"network": "10.10.0.0/16"}], "next_page_id": "page2"}`,
+		"/wapi/v2.10/network/page2":        `{"result": [{"network": "10.20.0.0/16"}]}`,
+		"/wapi/v2.10/networkcontainer":     `{"result": [{"network": "10.0.0.0/8"}]}`,
+		"/wapi/v2.10/ipv6network":          `{"result": []}`,
+		"/wapi/v2.10/ipv6networkcontainer": `{"result": [{"network": "fd00::/48"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		key := r.URL.Path
+		if pageID := query.Get("_page_id"); pageID != "" {
+			key += "/" + pageID
+		} else if query.Get("*Site") != "dc1" || query.Get("network_view") != "default" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, pages[key])
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewInfobloxPrefixSource(ctx, notify, &prefixsource.InfobloxOptions{
+		URL:                  server.URL + "/wapi/v2.10",
+		Username:             "admin",
+		PasswordPath:         passwordPath,
+		NetworkView:          "default",
+		ExtensibleAttributes: map[string]string{"Site": "dc1"},
+		RefreshInterval:      time.Hour,
+		Client:               client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.10.0.0/16", "10.20.0.0/16", "10.0.0.0/8", "fd00::/48"}))
+}
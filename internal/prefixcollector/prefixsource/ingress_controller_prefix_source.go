@@ -0,0 +1,154 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ingressProxyCIDRKeys are keys of ingress controller config maps listing CIDRs of the proxies in front of them:
+// ingress-nginx and HAProxy Technologies controller ones
+var ingressProxyCIDRKeys = []string{"proxy-real-ip-cidr", "proxy-protocol"}
+
+// IngressControllerPrefixSource is excluded prefix source of ingress controllers: external and load balancer IPs
+// of their Services and proxy CIDRs of their config maps. Proxy CIDRs matching all the addresses are skipped.
+type IngressControllerPrefixSource struct {
+	servicePrefixes *utils.SynchronizedPrefixesContainer
+	proxyPrefixes   *utils.SynchronizedPrefixesContainer
+}
+
+// NewIngressControllerPrefixSource creates IngressControllerPrefixSource watching Services and config maps
+// of all the namespaces selected by selector
+func NewIngressControllerPrefixSource(ctx context.Context, notify *utils.EventBus,
+	selector labels.Selector) *IngressControllerPrefixSource {
+	icps := &IngressControllerPrefixSource{
+		servicePrefixes: utils.NewSynchronizedPrefixesContainer(),
+		proxyPrefixes:   utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	client := prefixcollector.DynamicInterface(ctx)
+	prefixcollector.Lifecycle(ctx).Go(icps.Name()+"/services", func() {
+		icps.watch(ctx, "services", &resourceWatch{
+			resourceInterface: client.Resource(ServiceResource),
+			key:               icps.Name() + "/services",
+			prefixesFunc:      ingressServicePrefixes,
+			prefixes:          icps.servicePrefixes,
+			notify:            notify,
+			selector:          selector,
+		})
+	})
+	prefixcollector.Lifecycle(ctx).Go(icps.Name()+"/configmaps", func() {
+		icps.watch(ctx, "config maps", &resourceWatch{
+			resourceInterface: client.Resource(ConfigMapResource),
+			key:               icps.Name() + "/configmaps",
+			prefixesFunc:      ingressProxyPrefixes,
+			prefixes:          icps.proxyPrefixes,
+			notify:            notify,
+			selector:          selector,
+		})
+	})
+	return icps
+}
+
+// Prefixes returns prefixes from source
+func (icps *IngressControllerPrefixSource) Prefixes() []string {
+	return append(icps.servicePrefixes.Load(), icps.proxyPrefixes.Load()...)
+}
+
+// Name returns name of the source
+func (icps *IngressControllerPrefixSource) Name() string {
+	return "ingress-controllers"
+}
+
+func (icps *IngressControllerPrefixSource) watch(ctx context.Context, resources string, rw *resourceWatch) {
+	span := spanhelper.FromContext(ctx, "Watch ingress controller "+resources)
+	defer span.Finish()
+
+	rw.versions = prefixcollector.ResourceVersions(ctx)
+	rw.logger = span.Logger()
+	rw.run(ctx)
+}
+
+// ingressServicePrefixes returns single address prefixes of the external, load balancer and load balancer
+// ingress IPs of the service
+func ingressServicePrefixes(service *unstructured.Unstructured) ([]string, error) {
+	addresses, _, err := unstructured.NestedStringSlice(service.Object, "spec", "externalIPs")
+	if err != nil {
+		return nil, err
+	}
+	if address, _, _ := unstructured.NestedString(service.Object, "spec", "loadBalancerIP"); address != "" {
+		addresses = append(addresses, address)
+	}
+	ingress, _, err := unstructured.NestedSlice(service.Object, "status", "loadBalancer", "ingress")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range ingress {
+		if fields, ok := entry.(map[string]interface{}); ok {
+			if address, ok := fields["ip"].(string); ok && address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("Invalid ingress controller service IP %q", address)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		prefixes = append(prefixes, ipToNet(ip).String())
+	}
+	return prefixes, nil
+}
+
+// ingressProxyPrefixes returns proxy CIDRs of the ingress controller config map, CIDRs matching all
+// the addresses like the ingress-nginx 0.0.0.0/0 default are skipped
+func ingressProxyPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	var prefixes []string
+	for _, key := range ingressProxyCIDRKeys {
+		value, _, err := unstructured.NestedString(configMap.Object, "data", key)
+		if err != nil || value == "" {
+			continue
+		}
+		var cidrs prefixcollector.PrefixList
+		if err := cidrs.Decode(value); err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s", key)
+		}
+		for _, cidr := range cidrs {
+			if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+				if ones, _ := ipNet.Mask.Size(); ones == 0 {
+					continue
+				}
+			}
+			prefixes = append(prefixes, cidr)
+		}
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func ingressControllerService(namespace, name, controller string, externalIPs []interface{},
+	ingressIPs ...string) *unstructured.Unstructured {
+	ingress := make([]interface{}, 0, len(ingressIPs))
+	for _, ip := range ingressIPs {
+		ingress = append(ingress, map[string]interface{}{"ip": ip})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": namespace,
+			"labels": map[string]interface{}{"app.kubernetes.io/name": controller},
+		},
+		"spec":   map[string]interface{}{"type": "LoadBalancer", "externalIPs": externalIPs},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{"ingress": ingress}},
+	}}
+}
+
+func ingressControllerConfigMap(namespace, name, controller string, data map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": namespace,
+			"labels": map[string]interface{}{"app.kubernetes.io/name": controller},
+		},
+		"data": data,
+	}}
+}
+
+func TestIngressControllerPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		ingressControllerService("ingress-nginx", "ingress-nginx-controller", "ingress-nginx",
+			[]interface{}{"203.0.113.10"}, "198.51.100.7"),
+		ingressControllerService("traefik", "traefik", "traefik", nil, "2001:db8::7"),
+		ingressControllerService("default", "app", "app", []interface{}{"203.0.113.99"}),
+		ingressControllerConfigMap("ingress-nginx", "ingress-nginx-controller", "ingress-nginx",
+			map[string]interface{}{"proxy-real-ip-cidr": "0.0.0.0/0,192.0.2.0/24"}),
+		ingressControllerConfigMap("haproxy", "haproxy-kubernetes-ingress", "kubernetes-ingress",
+			map[string]interface{}{"proxy-protocol": "192.0.2.128/25 2001:db8:1::/64"}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	selector, err := labels.Parse("app.kubernetes.io/name in (ingress-nginx,kubernetes-ingress,traefik)")
+	g.Expect(err).To(BeNil())
+	source := prefixsource.NewIngressControllerPrefixSource(ctx, utils.NewEventBus(), selector)
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"192.0.2.0/24", "192.0.2.128/25", "198.51.100.7/32", "2001:db8:1::/64", "2001:db8::7/128", "203.0.113.10/32",
+	}))
+
+	services := client.Resource(prefixsource.ServiceResource)
+	_, err = services.Namespace("ingress-nginx").Update(ctx, ingressControllerService("ingress-nginx",
+		"ingress-nginx-controller", "ingress-nginx", nil, "198.51.100.8"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	err = client.Resource(prefixsource.ConfigMapResource).Namespace("haproxy").
+		Delete(ctx, "haproxy-kubernetes-ingress", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"192.0.2.0/24", "198.51.100.8/32", "2001:db8::7/128",
+	}))
+}
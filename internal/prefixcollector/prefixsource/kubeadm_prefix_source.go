@@ -25,9 +25,9 @@ import (
 	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
 
 	apiV1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/yaml"
-	"k8s.io/apimachinery/pkg/watch"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"sigs.k8s.io/cluster-api/bootstrap/kubeadm/types/v1beta2"
 )
@@ -40,22 +40,42 @@ const (
 	bufferSize = 4096
 )
 
-// KubeAdmPrefixSource is KubeAdm ConfigMap excluded prefix source
+// KubeAdmPrefixSource is KubeAdm ConfigMap excluded prefix source. Prefixes of the additional kubeadm-style
+// ConfigMaps selected by label selector, e.g. the ones of Cluster API control plane pools, are merged with them.
 type KubeAdmPrefixSource struct {
 	configMapInterface v1.ConfigMapInterface
 	prefixes           *utils.SynchronizedPrefixesContainer
 	ctx                context.Context
-	notify             chan<- struct{}
+	notify             *utils.EventBus
 	span               spanhelper.SpanHelper
+	selector           labels.Selector
+	// selectedPrefixes are prefixes of the selected config maps by namespace
+	selectedPrefixes map[string]*utils.SynchronizedPrefixesContainer
 }
 
 // Prefixes returns prefixes from source
 func (kaps *KubeAdmPrefixSource) Prefixes() []string {
-	return kaps.prefixes.Load()
+	prefixes := kaps.prefixes.Load()
+	for _, namespacePrefixes := range kaps.selectedPrefixes {
+		prefixes = append(prefixes, namespacePrefixes.Load()...)
+	}
+	return prefixes
+}
+
+// Name returns name of the source
+func (kaps *KubeAdmPrefixSource) Name() string {
+	return "kubeadm"
 }
 
 // NewKubeAdmPrefixSource creates KubeAdmPrefixSource
-func NewKubeAdmPrefixSource(ctx context.Context, notify chan<- struct{}) *KubeAdmPrefixSource {
+func NewKubeAdmPrefixSource(ctx context.Context, notify *utils.EventBus) *KubeAdmPrefixSource {
+	return NewKubeAdmSelectorPrefixSource(ctx, notify, nil)
+}
+
+// NewKubeAdmSelectorPrefixSource creates KubeAdmPrefixSource merging prefixes of the kubeadm-style config maps
+// selected by selector in namespaces with KubeAdm ConfigMap ones, only KubeAdm ConfigMap is watched if selector is nil
+func NewKubeAdmSelectorPrefixSource(ctx context.Context, notify *utils.EventBus, selector labels.Selector,
+	namespaces ...string) *KubeAdmPrefixSource {
 	clientSet := prefixcollector.KubernetesInterface(ctx)
 	configMapInterface := clientSet.CoreV1().ConfigMaps(KubeNamespace)
 	kaps := KubeAdmPrefixSource{
@@ -63,9 +83,22 @@ func NewKubeAdmPrefixSource(ctx context.Context, notify chan<- struct{}) *KubeAd
 		ctx:                ctx,
 		notify:             notify,
 		prefixes:           utils.NewSynchronizedPrefixesContainer(),
+		selector:           selector,
+		selectedPrefixes:   map[string]*utils.SynchronizedPrefixesContainer{},
+	}
+	if selector != nil {
+		for _, namespace := range namespaces {
+			kaps.selectedPrefixes[namespace] = utils.NewSynchronizedPrefixesContainer()
+		}
 	}
 
-	go kaps.watchKubeAdmConfigMap()
+	prefixcollector.Lifecycle(ctx).Go(kaps.Name(), kaps.watchKubeAdmConfigMap)
+	for namespace, prefixes := range kaps.selectedPrefixes {
+		namespace, prefixes := namespace, prefixes
+		prefixcollector.Lifecycle(ctx).Go(kaps.Name()+"/"+namespace, func() {
+			kaps.watchSelected(namespace, prefixes)
+		})
+	}
 	return &kaps
 }
 
@@ -74,56 +107,58 @@ func (kaps *KubeAdmPrefixSource) watchKubeAdmConfigMap() {
 	defer kaps.span.Finish()
 	logger := kaps.span.Logger()
 
-	kaps.checkCurrentConfigMap()
-	configMapWatch, err := kaps.configMapInterface.Watch(kaps.ctx, metav1.ListOptions{})
-	if err != nil {
-		logger.Errorf("Error creating config map watch: %v", err)
-		return
-	}
-
-	for {
-		select {
-		case <-kaps.ctx.Done():
-			return
-		case event, ok := <-configMapWatch.ResultChan():
-			if !ok {
-				return
-			}
-
-			if event.Type == watch.Error {
-				continue
-			}
-
-			configMap, ok := event.Object.(*apiV1.ConfigMap)
-			if !ok || configMap.Name != KubeName {
-				continue
-			}
-
-			if event.Type == watch.Deleted {
+	versions := prefixcollector.ResourceVersions(kaps.ctx)
+	watchConfigMap(kaps.ctx, kaps.configMapInterface, KubeName, versions, kaps.Name(),
+		func(configMap *apiV1.ConfigMap) {
+			if configMap == nil {
 				kaps.prefixes.Store([]string(nil))
-				kaps.notify <- struct{}{}
-				continue
+				kaps.notify.Notify()
+				return
 			}
-
-			if err = kaps.setPrefixesFromConfigMap(configMap); err != nil {
+			if err := kaps.setPrefixesFromConfigMap(configMap); err != nil {
 				logger.Error(err)
 			}
-		}
-	}
+		})
 }
 
-func (kaps *KubeAdmPrefixSource) checkCurrentConfigMap() {
-	configMap, err := kaps.configMapInterface.Get(kaps.ctx, KubeName, metav1.GetOptions{})
-	logger := kaps.span.Logger()
+func (kaps *KubeAdmPrefixSource) watchSelected(namespace string, prefixes *utils.SynchronizedPrefixesContainer) {
+	span := spanhelper.FromContext(kaps.ctx, "Watch selected kubeadm config maps")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(kaps.ctx).Resource(ConfigMapResource).Namespace(namespace),
+		versions:          prefixcollector.ResourceVersions(kaps.ctx),
+		key:               kaps.Name() + "/" + namespace,
+		prefixesFunc:      kubeadmConfigMapPrefixes,
+		prefixes:          prefixes,
+		notify:            kaps.notify,
+		logger:            span.Logger().WithField("namespace", namespace),
+		selector:          kaps.selector,
+	}
+	rw.run(kaps.ctx)
+}
 
-	if err != nil {
-		logger.Errorf("Error getting KubeAdm config map : %v", err)
-		return
+// kubeadmConfigMapPrefixes returns pod and service subnets of the config map ClusterConfiguration, dual-stack
+// subnets are split. Config maps without ClusterConfiguration have no prefixes.
+func kubeadmConfigMapPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	data, _, err := unstructured.NestedString(configMap.Object, "data", "ClusterConfiguration")
+	if err != nil || data == "" {
+		return nil, err
+	}
+	clusterConfiguration := &v1beta2.ClusterConfiguration{}
+	if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(data), bufferSize).Decode(clusterConfiguration); err != nil {
+		return nil, err
 	}
 
-	if err = kaps.setPrefixesFromConfigMap(configMap); err != nil {
-		logger.Error(err)
+	var prefixes []string
+	for _, subnets := range []string{clusterConfiguration.Networking.PodSubnet, clusterConfiguration.Networking.ServiceSubnet} {
+		for _, subnet := range strings.Split(subnets, ",") {
+			if subnet = strings.TrimSpace(subnet); subnet != "" {
+				prefixes = append(prefixes, subnet)
+			}
+		}
 	}
+	return prefixes, nil
 }
 
 func (kaps *KubeAdmPrefixSource) setPrefixesFromConfigMap(configMap *apiV1.ConfigMap) error {
@@ -151,7 +186,7 @@ func (kaps *KubeAdmPrefixSource) setPrefixesFromConfigMap(configMap *apiV1.Confi
 	prefixes := []string{podSubnet, serviceSubnet}
 
 	kaps.prefixes.Store(prefixes)
-	kaps.notify <- struct{}{}
+	kaps.notify.Notify()
 	logger.Infof("Prefixes sent from kubeadm source: %v", prefixes)
 
 	return nil
@@ -0,0 +1,146 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func clusterConfiguration(podSubnet, serviceSubnet string) string {
+	return "networking:\n  podSubnet: " + podSubnet + "\n  serviceSubnet: " + serviceSubnet + "\n"
+}
+
+func kubeadmStyleConfigMap(namespace, name, pool, configuration string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": namespace, "labels": map[string]interface{}{"control-plane-pool": pool},
+		},
+		"data": map[string]interface{}{"ClusterConfiguration": configuration},
+	}}
+}
+
+func TestKubeAdmSelectorPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: prefixsource.KubeName, Namespace: prefixsource.KubeNamespace},
+		Data:       map[string]string{"ClusterConfiguration": clusterConfiguration("10.244.0.0/16", "10.96.0.0/12")},
+	})
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		kubeadmStyleConfigMap(prefixsource.KubeNamespace, "pool-a", "a",
+			clusterConfiguration("10.10.0.0/16,fd00:10::/56", "10.20.0.0/16")),
+		kubeadmStyleConfigMap("capi", "pool-b", "b", clusterConfiguration("10.30.0.0/16", "10.40.0.0/16")),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, clientSet)
+	ctx = prefixcollector.WithDynamicInterface(ctx, dynamicClient)
+
+	selector, err := labels.Parse("control-plane-pool")
+	g.Expect(err).To(BeNil())
+	source := prefixsource.NewKubeAdmSelectorPrefixSource(ctx, utils.NewEventBus(), selector, prefixsource.KubeNamespace, "capi")
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.10.0.0/16", "10.20.0.0/16", "10.244.0.0/16", "10.30.0.0/16", "10.40.0.0/16", "10.96.0.0/12", "fd00:10::/56",
+	}))
+
+	err = dynamicClient.Resource(prefixsource.ConfigMapResource).Namespace("capi").Delete(ctx, "pool-b", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.10.0.0/16", "10.20.0.0/16", "10.244.0.0/16", "10.96.0.0/12", "fd00:10::/56",
+	}))
+}
+
+func TestKubeAdmPrefixSourceRetries(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: prefixsource.KubeName, Namespace: prefixsource.KubeNamespace},
+		Data:       map[string]string{"ClusterConfiguration": clusterConfiguration("10.244.0.0/16", "10.96.0.0/12")},
+	})
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		kubeadmStyleConfigMap("capi", "pool-b", "b", clusterConfiguration("10.30.0.0/16", "10.40.0.0/16")))
+
+	// requests time out over flaky link a few times before they succeed
+	failures := func(count int32) func(k8stesting.Action) (bool, runtime.Object, error) {
+		return func(k8stesting.Action) (bool, runtime.Object, error) {
+			if atomic.AddInt32(&count, -1) >= 0 {
+				return true, nil, errors.New("i/o timeout")
+			}
+			return false, nil, nil
+		}
+	}
+	clientSet.PrependReactor("list", "configmaps", failures(2))
+	dynamicClient.PrependReactor("list", "configmaps", failures(2))
+	watches := int32(0)
+	clientSet.PrependWatchReactor("configmaps", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		if atomic.LoadInt32(&watches) == 0 {
+			atomic.StoreInt32(&watches, 1)
+			return true, nil, errors.New("i/o timeout")
+		}
+		watcher, err := clientSet.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		atomic.StoreInt32(&watches, 2)
+		return true, watcher, err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, clientSet)
+	ctx = prefixcollector.WithDynamicInterface(ctx, dynamicClient)
+
+	selector, err := labels.Parse("control-plane-pool")
+	g.Expect(err).To(BeNil())
+	source := prefixsource.NewKubeAdmSelectorPrefixSource(ctx, utils.NewEventBus(), selector, "capi")
+	g.Eventually(sortedPrefixes(source), 2*time.Second).Should(Equal([]string{
+		"10.244.0.0/16", "10.30.0.0/16", "10.40.0.0/16", "10.96.0.0/12",
+	}))
+
+	// the resumed watch still delivers changes
+	g.Eventually(func() int32 { return atomic.LoadInt32(&watches) }, time.Second).Should(Equal(int32(2)))
+	_, err = clientSet.CoreV1().ConfigMaps(prefixsource.KubeNamespace).Update(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: prefixsource.KubeName, Namespace: prefixsource.KubeNamespace},
+		Data:       map[string]string{"ClusterConfiguration": clusterConfiguration("10.245.0.0/16", "10.96.0.0/12")},
+	}, metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.245.0.0/16", "10.30.0.0/16", "10.40.0.0/16", "10.96.0.0/12",
+	}))
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// KubeletConfigName is name of kubelet config map, versioned ones are named with its prefix and minor
+	// Kubernetes version like kubelet-config-1.23
+	KubeletConfigName = "kubelet-config"
+	// KubeletConfigKey is kubelet config map key containing KubeletConfiguration YAML
+	KubeletConfigKey = "kubelet"
+)
+
+// KubeletConfigPrefixSource is excluded prefix source of cluster DNS IPs of kubelet config maps.
+// It protects DNS in clusters, where service subnet can't be discovered otherwise.
+type KubeletConfigPrefixSource struct {
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// NewKubeletConfigPrefixSource creates KubeletConfigPrefixSource
+func NewKubeletConfigPrefixSource(ctx context.Context, notify *utils.EventBus) *KubeletConfigPrefixSource {
+	kcps := &KubeletConfigPrefixSource{
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(kcps.Name(), func() {
+		kcps.watch(ctx, notify)
+	})
+	return kcps
+}
+
+// Prefixes returns prefixes from source
+func (kcps *KubeletConfigPrefixSource) Prefixes() []string {
+	return kcps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (kcps *KubeletConfigPrefixSource) Name() string {
+	return "kubelet-config"
+}
+
+func (kcps *KubeletConfigPrefixSource) watch(ctx context.Context, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch kubelet config maps")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ConfigMapResource).Namespace(KubeNamespace),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               kcps.Name(),
+		prefixesFunc:      kubeletConfigPrefixes,
+		prefixes:          kcps.prefixes,
+		notify:            notify,
+		logger:            span.Logger(),
+	}
+	rw.run(ctx)
+}
+
+// kubeletConfigPrefixes returns single address prefixes of cluster DNS IPs of kubelet config map,
+// other config maps have no prefixes
+func kubeletConfigPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	name := configMap.GetName()
+	if name != KubeletConfigName && !strings.HasPrefix(name, KubeletConfigName+"-") {
+		return nil, nil
+	}
+	configField, _, err := unstructured.NestedString(configMap.Object, "data", KubeletConfigKey)
+	if err != nil || configField == "" {
+		return nil, err
+	}
+
+	config := struct {
+		ClusterDNS []string `json:"clusterDNS"`
+	}{}
+	if err := yaml.Unmarshal([]byte(configField), &config); err != nil {
+		return nil, errors.Wrap(err, "Can not unmarshal kubelet configuration")
+	}
+
+	prefixes := make([]string, 0, len(config.ClusterDNS))
+	for _, address := range config.ClusterDNS {
+		ip := net.ParseIP(strings.TrimSpace(address))
+		if ip == nil {
+			return nil, errors.Errorf("Invalid cluster DNS IP %q", address)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		prefixes = append(prefixes, ipToNet(ip).String())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func kubeletConfigMap(name, kubeletConfig string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name, "namespace": prefixsource.KubeNamespace},
+		"data":       map[string]interface{}{prefixsource.KubeletConfigKey: kubeletConfig},
+	}}
+}
+
+func TestKubeletConfigPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		kubeletConfigMap("kubelet-config-1.23", "kind: KubeletConfiguration\nclusterDNS:\n- 10.96.0.10\nclusterDomain: cluster.local\n"),
+		kubeletConfigMap("kubelet-config", "kind: KubeletConfiguration\nclusterDNS:\n- 10.96.0.10\n- fd00:10:96::a\n"),
+		kubeletConfigMap("coredns", "clusterDNS:\n- 10.100.0.10\n"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewKubeletConfigPrefixSource(ctx, utils.NewEventBus())
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.96.0.10/32", "10.96.0.10/32", "fd00:10:96::a/128",
+	}))
+
+	_, err := client.Resource(prefixsource.ConfigMapResource).Namespace(prefixsource.KubeNamespace).Update(ctx,
+		kubeletConfigMap("kubelet-config-1.23", "kind: KubeletConfiguration\nclusterDNS:\n- 10.96.0.53\n"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.96.0.10/32", "10.96.0.53/32", "fd00:10:96::a/128",
+	}))
+}
@@ -31,7 +31,7 @@ import (
 // from Kubernetes pods and services addresses
 type KubernetesPrefixSource struct {
 	prefixes *utils.SynchronizedPrefixesContainer
-	notify   chan<- struct{}
+	notify   *utils.EventBus
 	ctx      context.Context
 }
 
@@ -40,20 +40,25 @@ func (kps *KubernetesPrefixSource) Prefixes() []string {
 	return kps.prefixes.Load()
 }
 
+// Name returns name of the source
+func (kps *KubernetesPrefixSource) Name() string {
+	return "kubernetes"
+}
+
 // NewKubernetesPrefixSource creates KubernetesPrefixSource
-func NewKubernetesPrefixSource(ctx context.Context, notify chan<- struct{}) *KubernetesPrefixSource {
+func NewKubernetesPrefixSource(ctx context.Context, notify *utils.EventBus) *KubernetesPrefixSource {
 	kps := &KubernetesPrefixSource{
 		ctx:      ctx,
 		notify:   notify,
 		prefixes: utils.NewSynchronizedPrefixesContainer(),
 	}
 
-	go func() {
+	prefixcollector.Lifecycle(ctx).Go(kps.Name(), func() {
 		clientSet := prefixcollector.KubernetesInterface(kps.ctx)
 		for kps.ctx.Err() == nil {
 			kps.watchSubnets(clientSet)
 		}
-	}()
+	})
 	return kps
 }
 
@@ -94,9 +99,10 @@ func (kps *KubernetesPrefixSource) waitForSubnets(podChan, serviceChan <-chan *n
 			serviceSubnet = subnet.String()
 		}
 
+		prefixcollector.RefreshTimes(kps.ctx).Touch(kps.Name())
 		prefixes := getPrefixes(podSubnet, serviceSubnet)
 		kps.prefixes.Store(prefixes)
-		kps.notify <- struct{}{}
+		kps.notify.Notify()
 	}
 }
 
@@ -0,0 +1,190 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// Metal3APIGroup is API group of Metal3 resources
+	Metal3APIGroup = "metal3.io"
+	// ProvisioningNetworkDisabled is Provisioning network mode without provisioning network
+	ProvisioningNetworkDisabled = "Disabled"
+	// IronicProvisioningIPKey is key of Ironic config map containing IP of Ironic on the provisioning network
+	IronicProvisioningIPKey = "PROVISIONING_IP"
+	// IronicProvisioningCIDRKey is key of Ironic config map containing prefix length or CIDR of the provisioning network
+	IronicProvisioningCIDRKey = "PROVISIONING_CIDR"
+)
+
+var (
+	// ProvisioningResource is OpenShift Metal3 Provisioning resource
+	ProvisioningResource = schema.GroupVersionResource{Group: Metal3APIGroup, Version: "v1alpha1", Resource: "provisionings"}
+	// BareMetalHostResource is Metal3 BareMetalHost resource
+	BareMetalHostResource = schema.GroupVersionResource{Group: Metal3APIGroup, Version: "v1alpha1", Resource: "baremetalhosts"}
+)
+
+// Metal3PrefixSource is excluded prefix source of Metal3 bare-metal provisioning: provisioning network CIDRs of
+// Provisioning resources and of Ironic config map, and IPs the provisioning and inspection of BareMetalHosts
+// discovered on their boot NICs
+type Metal3PrefixSource struct {
+	provisioningPrefixes *utils.SynchronizedPrefixesContainer
+	ironicPrefixes       *utils.SynchronizedPrefixesContainer
+	hostPrefixes         *utils.SynchronizedPrefixesContainer
+}
+
+// NewMetal3PrefixSource creates Metal3PrefixSource watching Ironic config map named ironicConfigMapName
+// in ironicNamespace
+func NewMetal3PrefixSource(ctx context.Context, notify *utils.EventBus, ironicNamespace,
+	ironicConfigMapName string) *Metal3PrefixSource {
+	mps := &Metal3PrefixSource{
+		provisioningPrefixes: utils.NewSynchronizedPrefixesContainer(),
+		ironicPrefixes:       utils.NewSynchronizedPrefixesContainer(),
+		hostPrefixes:         utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	client := prefixcollector.DynamicInterface(ctx)
+	prefixcollector.Lifecycle(ctx).Go(mps.Name()+"/provisionings", func() {
+		mps.watch(ctx, "provisionings", &resourceWatch{
+			resourceInterface: client.Resource(ProvisioningResource),
+			key:               mps.Name() + "/provisionings",
+			prefixesFunc:      provisioningPrefixes,
+			prefixes:          mps.provisioningPrefixes,
+			notify:            notify,
+		})
+	})
+	prefixcollector.Lifecycle(ctx).Go(mps.Name()+"/ironic", func() {
+		mps.watch(ctx, "Ironic config map", &resourceWatch{
+			resourceInterface: client.Resource(ConfigMapResource).Namespace(ironicNamespace),
+			key:               mps.Name() + "/ironic",
+			prefixesFunc:      ironicConfigMapPrefixes,
+			prefixes:          mps.ironicPrefixes,
+			notify:            notify,
+			fieldSelector:     fields.OneTermEqualSelector("metadata.name", ironicConfigMapName),
+		})
+	})
+	prefixcollector.Lifecycle(ctx).Go(mps.Name()+"/baremetalhosts", func() {
+		mps.watch(ctx, "bare metal hosts", &resourceWatch{
+			resourceInterface: client.Resource(BareMetalHostResource),
+			key:               mps.Name() + "/baremetalhosts",
+			prefixesFunc:      bareMetalHostPrefixes,
+			prefixes:          mps.hostPrefixes,
+			notify:            notify,
+		})
+	})
+	return mps
+}
+
+// Prefixes returns prefixes from source
+func (mps *Metal3PrefixSource) Prefixes() []string {
+	prefixes := append(mps.provisioningPrefixes.Load(), mps.ironicPrefixes.Load()...)
+	return append(prefixes, mps.hostPrefixes.Load()...)
+}
+
+// Name returns name of the source
+func (mps *Metal3PrefixSource) Name() string {
+	return "metal3"
+}
+
+func (mps *Metal3PrefixSource) watch(ctx context.Context, resources string, rw *resourceWatch) {
+	span := spanhelper.FromContext(ctx, "Watch Metal3 "+resources)
+	defer span.Finish()
+
+	rw.versions = prefixcollector.ResourceVersions(ctx)
+	rw.logger = span.Logger()
+	rw.run(ctx)
+}
+
+// provisioningPrefixes returns provisioning network CIDR of the Provisioning, disabled network has no prefixes
+func provisioningPrefixes(provisioning *unstructured.Unstructured) ([]string, error) {
+	network, _, err := unstructured.NestedString(provisioning.Object, "spec", "provisioningNetwork")
+	if err != nil || network == ProvisioningNetworkDisabled {
+		return nil, err
+	}
+	cidr, _, err := unstructured.NestedString(provisioning.Object, "spec", "provisioningNetworkCIDR")
+	if err != nil || cidr == "" {
+		return nil, err
+	}
+	return []string{cidr}, nil
+}
+
+// ironicConfigMapPrefixes returns provisioning network of Ironic config map. Network is set either as CIDR or as
+// prefix length of the provisioning IP.
+func ironicConfigMapPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	data, _, err := unstructured.NestedStringMap(configMap.Object, "data")
+	if err != nil || data[IronicProvisioningCIDRKey] == "" {
+		return nil, err
+	}
+	cidr := data[IronicProvisioningCIDRKey]
+	if !strings.Contains(cidr, "/") {
+		cidr = data[IronicProvisioningIPKey] + "/" + cidr
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid Ironic provisioning network %q", cidr)
+	}
+	return []string{network.String()}, nil
+}
+
+// bareMetalHostPrefixes returns single address prefixes of IPs of the boot NICs of the bare metal host
+// hardware inspection status. NICs booting with PXE or having the boot MAC address are boot NICs.
+func bareMetalHostPrefixes(host *unstructured.Unstructured) ([]string, error) {
+	bootMACAddress, _, err := unstructured.NestedString(host.Object, "spec", "bootMACAddress")
+	if err != nil {
+		return nil, err
+	}
+	nics, _, err := unstructured.NestedSlice(host.Object, "status", "hardware", "nics")
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	for _, nic := range nics {
+		fields, ok := nic.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pxe, _ := fields["pxe"].(bool)
+		mac, _ := fields["mac"].(string)
+		value, _ := fields["ip"].(string)
+		if value == "" || !pxe && (bootMACAddress == "" || !strings.EqualFold(mac, bootMACAddress)) {
+			continue
+		}
+		// inspection reports IPv6 link-local addresses with the zone
+		ip := net.ParseIP(strings.SplitN(value, "%", 2)[0])
+		if ip == nil {
+			return nil, errors.Errorf("Invalid bare metal host NIC IP %q", value)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+		if !ip.IsLinkLocalUnicast() {
+			prefixes = append(prefixes, ipToNet(ip).String())
+		}
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func provisioning(network, cidr string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prefixsource.Metal3APIGroup + "/v1alpha1",
+		"kind":       "Provisioning",
+		"metadata":   map[string]interface{}{"name": "provisioning-configuration"},
+		"spec": map[string]interface{}{
+			"provisioningNetwork":     network,
+			"provisioningNetworkCIDR": cidr,
+			"watchAllNamespaces":      false,
+		},
+	}}
+}
+
+func bareMetalHost(name, bootMACAddress string, nics ...map[string]interface{}) *unstructured.Unstructured {
+	hardwareNICs := make([]interface{}, 0, len(nics))
+	for _, nic := range nics {
+		hardwareNICs = append(hardwareNICs, nic)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": prefixsource.Metal3APIGroup + "/v1alpha1",
+		"kind":       "BareMetalHost",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "openshift-machine-api"},
+		"spec":       map[string]interface{}{"bootMACAddress": bootMACAddress, "online": true},
+		"status":     map[string]interface{}{"hardware": map[string]interface{}{"nics": hardwareNICs}},
+	}}
+}
+
+func TestMetal3PrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ironic := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "ironic-bmo-configmap", "namespace": "baremetal-operator-system"},
+		"data": map[string]interface{}{
+			prefixsource.IronicProvisioningIPKey:   "172.22.0.2",
+			prefixsource.IronicProvisioningCIDRKey: "24",
+			"DHCP_RANGE":                           "172.22.0.10,172.22.0.100",
+		},
+	}}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		ironic,
+		provisioning("Managed", "172.23.0.0/24"),
+		bareMetalHost("worker-0", "00:5C:52:31:3A:9C",
+			map[string]interface{}{"name": "eno1", "mac": "00:5c:52:31:3a:9c", "ip": "172.22.0.50", "pxe": false},
+			map[string]interface{}{"name": "eno2", "mac": "00:5c:52:31:3a:9d", "ip": "192.168.111.20", "pxe": false}),
+		bareMetalHost("worker-1", "",
+			map[string]interface{}{"name": "eno1", "mac": "00:5c:52:31:3a:ac", "ip": "fd00:1101::51", "pxe": true},
+			map[string]interface{}{"name": "eno1", "mac": "00:5c:52:31:3a:ac", "ip": "fe80::1%eno1", "pxe": true}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewMetal3PrefixSource(ctx, utils.NewEventBus(), "baremetal-operator-system", "ironic-bmo-configmap")
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"172.22.0.0/24", "172.22.0.50/32", "172.23.0.0/24", "fd00:1101::51/128",
+	}))
+
+	_, err := client.Resource(prefixsource.ProvisioningResource).Update(ctx,
+		provisioning(prefixsource.ProvisioningNetworkDisabled, "172.23.0.0/24"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	err = client.Resource(prefixsource.BareMetalHostResource).Namespace("openshift-machine-api").
+		Delete(ctx, "worker-1", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"172.22.0.0/24", "172.22.0.50/32"}))
+}
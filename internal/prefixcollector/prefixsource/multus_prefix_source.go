@@ -0,0 +1,184 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const maxVLAN = 4094
+
+// NetworkAttachmentDefinitionResource is Multus NetworkAttachmentDefinition custom resource
+var NetworkAttachmentDefinitionResource = schema.GroupVersionResource{
+	Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions",
+}
+
+// MultusPrefixSource is excluded prefix source of Multus secondary networks. Subnets of IPAM configurations of
+// NetworkAttachmentDefinition CNI configs are excluded and attributed to VLAN tags of bridge, vlan, SR-IOV and
+// OVS plugins and of macvlan and ipvlan VLAN master interfaces like eth0.100.
+type MultusPrefixSource struct {
+	prefixes *utils.SynchronizedPrefixesContainer
+	// resourceVLANs are prefixes of the network attachment definitions by VLAN tag by namespace/name,
+	// they are used only by the watch
+	resourceVLANs map[string]map[int][]string
+	vlanPrefixes  map[int][]string
+	vlanMutex     sync.RWMutex
+}
+
+// cniNetworkConfig is CNI network configuration or configuration list of plugins
+type cniNetworkConfig struct {
+	Type string `json:"type"`
+	// Master is parent interface of macvlan and ipvlan plugins
+	Master string `json:"master"`
+	// VLAN is VLAN tag of bridge, SR-IOV and OVS plugins
+	VLAN int `json:"vlan"`
+	// VLANID is VLAN tag of vlan plugin
+	VLANID  int                `json:"vlanId"`
+	IPAM    json.RawMessage    `json:"ipam"`
+	Plugins []cniNetworkConfig `json:"plugins"`
+}
+
+// NewMultusPrefixSource creates MultusPrefixSource watching network attachment definitions of all the namespaces
+func NewMultusPrefixSource(ctx context.Context, notify *utils.EventBus) *MultusPrefixSource {
+	mps := &MultusPrefixSource{
+		prefixes:      utils.NewSynchronizedPrefixesContainer(),
+		resourceVLANs: map[string]map[int][]string{},
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(mps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Watch network attachment definitions")
+		defer span.Finish()
+
+		rw := &resourceWatch{
+			resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(NetworkAttachmentDefinitionResource),
+			versions:          prefixcollector.ResourceVersions(ctx),
+			key:               NetworkAttachmentDefinitionResource.Resource,
+			prefixesFunc:      mps.networkAttachmentPrefixes,
+			prefixes:          mps.prefixes,
+			notify:            notify,
+			logger:            span.Logger(),
+			onStore:           mps.storeVLANPrefixes,
+		}
+		rw.run(ctx)
+	})
+	return mps
+}
+
+// Prefixes returns prefixes from source
+func (mps *MultusPrefixSource) Prefixes() []string {
+	return mps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (mps *MultusPrefixSource) Name() string {
+	return "multus"
+}
+
+// VLANPrefixes returns prefixes of the source by VLAN tag
+func (mps *MultusPrefixSource) VLANPrefixes() map[int][]string {
+	mps.vlanMutex.RLock()
+	defer mps.vlanMutex.RUnlock()
+	return mps.vlanPrefixes
+}
+
+// networkAttachmentPrefixes returns subnets of the network attachment definition CNI config and keeps
+// the tagged ones by VLAN
+func (mps *MultusPrefixSource) networkAttachmentPrefixes(nad *unstructured.Unstructured) ([]string, error) {
+	name := nad.GetNamespace() + "/" + nad.GetName()
+	delete(mps.resourceVLANs, name)
+
+	config, _, err := unstructured.NestedString(nad.Object, "spec", "config")
+	if err != nil || strings.TrimSpace(config) == "" {
+		return nil, err
+	}
+	network := &cniNetworkConfig{}
+	if err := json.Unmarshal([]byte(config), network); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse CNI config")
+	}
+
+	var prefixes []string
+	vlanPrefixes := map[int][]string{}
+	for _, plugin := range append([]cniNetworkConfig{*network}, network.Plugins...) {
+		pluginPrefixes, err := cniIPAMPrefixes(string(plugin.IPAM))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, pluginPrefixes...)
+		if vlan := plugin.vlan(); vlan > 0 && len(pluginPrefixes) > 0 {
+			vlanPrefixes[vlan] = append(vlanPrefixes[vlan], pluginPrefixes...)
+		}
+	}
+	if len(vlanPrefixes) > 0 {
+		mps.resourceVLANs[name] = vlanPrefixes
+	}
+	return prefixes, nil
+}
+
+// storeVLANPrefixes stores prefixes by VLAN of the network attachment definitions having valid prefixes
+func (mps *MultusPrefixSource) storeVLANPrefixes(resourcePrefixes map[string][]string) {
+	vlanPrefixes := map[int][]string{}
+	for name, resourceVLANs := range mps.resourceVLANs {
+		valid := map[string]bool{}
+		for _, prefix := range resourcePrefixes[name] {
+			valid[prefix] = true
+		}
+		if len(valid) == 0 {
+			delete(mps.resourceVLANs, name)
+			continue
+		}
+		for vlan, prefixes := range resourceVLANs {
+			for _, prefix := range prefixes {
+				if valid[prefix] {
+					vlanPrefixes[vlan] = append(vlanPrefixes[vlan], prefix)
+				}
+			}
+		}
+	}
+
+	mps.vlanMutex.Lock()
+	defer mps.vlanMutex.Unlock()
+	mps.vlanPrefixes = vlanPrefixes
+}
+
+// vlan returns VLAN tag of the plugin network, 0 if it is untagged
+func (c *cniNetworkConfig) vlan() int {
+	vlan := c.VLAN
+	if c.Type == "vlan" {
+		vlan = c.VLANID
+	}
+	if vlan == 0 && (c.Type == "macvlan" || c.Type == "ipvlan") {
+		if i := strings.LastIndex(c.Master, "."); i >= 0 {
+			vlan, _ = strconv.Atoi(c.Master[i+1:])
+		}
+	}
+	if vlan < 0 || vlan > maxVLAN {
+		return 0
+	}
+	return vlan
+}
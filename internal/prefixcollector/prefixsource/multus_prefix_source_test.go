@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func networkAttachmentDefinition(namespace, name, config string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "k8s.cni.cncf.io/v1",
+		"kind":       "NetworkAttachmentDefinition",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"config": config},
+	}}
+}
+
+func TestMultusPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	// definitions are created with the resource, the fake client guesses other resource of the kind
+	nads := client.Resource(prefixsource.NetworkAttachmentDefinitionResource)
+	for _, created := range []*unstructured.Unstructured{
+		networkAttachmentDefinition("cnf", "bridge", `{"cniVersion": "0.3.1", "plugins": [
+			{"type": "bridge", "bridge": "br1", "vlan": 100,
+				"ipam": {"type": "host-local", "ranges": [[{"subnet": "10.100.0.0/24"}]]}},
+			{"type": "tuning"}]}`),
+		networkAttachmentDefinition("cnf", "macvlan", `{"cniVersion": "0.3.1", "type": "macvlan",
+			"master": "ens3.200", "ipam": {"type": "whereabouts", "range": "10.200.0.0/24"}}`),
+		networkAttachmentDefinition("cnf", "untagged", `{"cniVersion": "0.3.1", "type": "ipvlan",
+			"master": "ens4", "ipam": {"type": "static", "addresses": [{"address": "192.168.10.5/24"}]}}`),
+	} {
+		_, err := nads.Namespace(created.GetNamespace()).Create(ctx, created, metav1.CreateOptions{})
+		g.Expect(err).To(BeNil())
+	}
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewMultusPrefixSource(ctx, notify)
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.100.0.0/24", "10.200.0.0/24", "192.168.10.0/24",
+	}))
+	g.Expect(source.VLANPrefixes()).To(Equal(map[int][]string{100: {"10.100.0.0/24"}, 200: {"10.200.0.0/24"}}))
+
+	g.Expect(nads.Namespace("cnf").Delete(ctx, "macvlan", metav1.DeleteOptions{})).To(Succeed())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.100.0.0/24", "192.168.10.0/24"}))
+	g.Expect(source.VLANPrefixes()).To(Equal(map[int][]string{100: {"10.100.0.0/24"}}))
+}
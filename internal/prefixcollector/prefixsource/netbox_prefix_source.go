@@ -0,0 +1,129 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const netboxPageSize = "1000"
+
+// NetboxPrefixSource is NetBox IPAM excluded prefix source. It excludes prefixes of NetBox
+// /api/ipam/prefixes/ endpoint matching configured tags and sites.
+type NetboxPrefixSource struct {
+	prefixesURL string
+	tokenPath   string
+	client      *http.Client
+	prefixes    *utils.SynchronizedPrefixesContainer
+}
+
+// NetboxOptions are NetboxPrefixSource settings
+type NetboxOptions struct {
+	// URL is NetBox base URL, e.g. https://netbox.example.com
+	URL string
+	// TokenPath is path of file containing NetBox API token
+	TokenPath string
+	// Tags are slugs of tags, prefixes having any of them are excluded
+	Tags []string
+	// Sites are slugs of sites, prefixes of any of them are excluded
+	Sites           []string
+	RefreshInterval time.Duration
+	Client          *http.Client
+}
+
+// NewNetboxPrefixSource creates NetboxPrefixSource
+func NewNetboxPrefixSource(ctx context.Context, notify *utils.EventBus, options *NetboxOptions) *NetboxPrefixSource {
+	query := url.Values{"limit": {netboxPageSize}}
+	for _, tag := range options.Tags {
+		query.Add("tag", tag)
+	}
+	for _, site := range options.Sites {
+		query.Add("site", site)
+	}
+
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	nps := &NetboxPrefixSource{
+		prefixesURL: strings.TrimSuffix(options.URL, "/") + "/api/ipam/prefixes/?" + query.Encode(),
+		tokenPath:   options.TokenPath,
+		client:      client,
+		prefixes:    utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(nps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll NetBox prefixes")
+		defer span.Finish()
+		pollPrefixes(ctx, nps.Name(), options.RefreshInterval, nps.fetchPrefixes, nps.prefixes, notify, span.Logger())
+	})
+	return nps
+}
+
+// Prefixes returns prefixes from source
+func (nps *NetboxPrefixSource) Prefixes() []string {
+	return nps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (nps *NetboxPrefixSource) Name() string {
+	return "netbox"
+}
+
+// Scope returns scope of the source prefixes
+func (nps *NetboxPrefixSource) Scope() string {
+	return prefixcollector.ExternalScope
+}
+
+// fetchPrefixes fetches all pages of the NetBox prefixes list
+func (nps *NetboxPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	token, err := readSecret(ctx, nps.tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Token "+token)
+	}
+
+	prefixes := []string{}
+	for pageURL := nps.prefixesURL; pageURL != ""; {
+		page := struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Prefix string `json:"prefix"`
+			} `json:"results"`
+		}{}
+		if err := getJSON(ctx, nps.client, pageURL, header, &page); err != nil {
+			return nil, err
+		}
+		for _, result := range page.Results {
+			prefixes = append(prefixes, result.Prefix)
+		}
+		pageURL = page.Next
+	}
+	return prefixes, nil
+}
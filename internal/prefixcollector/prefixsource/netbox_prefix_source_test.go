@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+func TestNetboxPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	g.Expect(ioutil.WriteFile(tokenPath, []byte("secret\n"), 0600)).To(Succeed())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("tag") != "nsm" || query.Get("site") != "dc1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if query.Get("offset") == "" {
+			_, _ = fmt.Fprintf(w, `{"next": "http://%s/api/ipam/prefixes/?tag=nsm&site=dc1&offset=1",
+				"results": [{"prefix": "10.10.0.0/16"}, {"prefix": "not-a-cidr"}]}`, r.Host)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"next": null, "results": [{"prefix": "fd00::/64"}]}`)
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewNetboxPrefixSource(ctx, notify, &prefixsource.NetboxOptions{
+		URL:             server.URL,
+		TokenPath:       tokenPath,
+		Tags:            []string{"nsm"},
+		Sites:           []string{"dc1"},
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.10.0.0/16", "fd00::/64"}))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NodeSelectorPrefixSource is excluded prefix source of static prefix groups selected by labels of the collector
+// node, so topology labels scope the groups to regions or zones of a stretched cluster
+type NodeSelectorPrefixSource struct {
+	prefixes []string
+}
+
+// NewNodeSelectorPrefixSource creates NodeSelectorPrefixSource of prefixes of the groups, which label selectors
+// match nodeLabels. Groups with invalid selectors are skipped.
+func NewNodeSelectorPrefixSource(groups map[string][]string, nodeLabels map[string]string) *NodeSelectorPrefixSource {
+	selectors := make([]string, 0, len(groups))
+	for selector := range groups {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+
+	nsps := &NodeSelectorPrefixSource{}
+	for _, selector := range selectors {
+		if parsed, err := labels.Parse(selector); err == nil && parsed.Matches(labels.Set(nodeLabels)) {
+			nsps.prefixes = append(nsps.prefixes, groups[selector]...)
+		}
+	}
+	return nsps
+}
+
+// Prefixes returns prefixes from source
+func (nsps *NodeSelectorPrefixSource) Prefixes() []string {
+	return nsps.prefixes
+}
+
+// Name returns name of the source
+func (nsps *NodeSelectorPrefixSource) Name() string {
+	return "node-selector"
+}
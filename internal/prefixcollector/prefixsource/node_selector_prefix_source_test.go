@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNodeSelectorPrefixSource(t *testing.T) {
+	g := NewWithT(t)
+
+	groups := map[string][]string{
+		"topology.kubernetes.io/region=onprem":            {"10.0.0.0/8"},
+		"topology.kubernetes.io/region in (onprem, edge)": {"172.16.0.0/12"},
+		"topology.kubernetes.io/region=eu-west-1":         {"192.168.0.0/16"},
+		"!topology.kubernetes.io/zone":                    {"fd00::/8"},
+	}
+	source := prefixsource.NewNodeSelectorPrefixSource(groups, map[string]string{
+		"topology.kubernetes.io/region": "onprem",
+		"topology.kubernetes.io/zone":   "rack-1",
+	})
+	g.Expect(source.Prefixes()).To(ConsistOf("10.0.0.0/8", "172.16.0.0/12"))
+
+	source = prefixsource.NewNodeSelectorPrefixSource(groups, nil)
+	g.Expect(source.Prefixes()).To(ConsistOf("fd00::/8"))
+}
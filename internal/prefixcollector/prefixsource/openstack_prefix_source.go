@@ -0,0 +1,297 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bufio"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// KuryrConfKey is key of kuryr-config config map containing kuryr.conf
+	KuryrConfKey = "kuryr.conf"
+
+	keystoneTokenHeader = "X-Subject-Token"
+	neutronTokenHeader  = "X-Auth-Token"
+)
+
+// kuryrSubnetOptions are kuryr.conf options containing Neutron subnet IDs or CIDRs, per section
+var kuryrSubnetOptions = map[string][]string{
+	"neutron_defaults": {"pod_subnet", "pod_subnets", "service_subnet", "external_svc_subnet"},
+	"pod_vif_nested":   {"worker_nodes_subnet", "worker_nodes_subnets"},
+}
+
+// OpenstackPrefixSource is excluded prefix source of OpenStack clusters networked by Kuryr. It excludes the pod,
+// service and worker nodes subnets configured in kuryr.conf of kuryr-config config map, the prefixes of the
+// namespace subnet pool and CIDRs of all the subnets of the provider networks.
+type OpenstackPrefixSource struct {
+	options  *OpenstackOptions
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// OpenstackOptions are OpenstackPrefixSource settings
+type OpenstackOptions struct {
+	// NeutronURL is Neutron API endpoint URL, subnet IDs are resolved with it. Only CIDRs set in kuryr.conf
+	// are excluded if it is empty.
+	NeutronURL string
+	// AuthURL is Keystone v3 URL application credential is exchanged for token at, TokenPath is used if it is empty
+	AuthURL string
+	// CredentialID is ID of Keystone application credential
+	CredentialID string
+	// CredentialPath is path of file containing Keystone application credential secret
+	CredentialPath string
+	// TokenPath is path of file containing Keystone token
+	TokenPath string
+	// ProviderNetworks are Neutron network IDs, CIDRs of all their subnets are excluded
+	ProviderNetworks []string
+	// KuryrConfigMapName is name of config map containing kuryr.conf, it isn't read if it is empty
+	KuryrConfigMapName      string
+	KuryrConfigMapNamespace string
+	RefreshInterval         time.Duration
+	Client                  *http.Client
+}
+
+// kuryrConfig are subnets of kuryr.conf, either Neutron IDs or CIDRs
+type kuryrConfig struct {
+	subnets     []string
+	subnetPools []string
+	networks    []string
+}
+
+// NewOpenstackPrefixSource creates OpenstackPrefixSource
+func NewOpenstackPrefixSource(ctx context.Context, notify *utils.EventBus, options *OpenstackOptions) *OpenstackPrefixSource {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ops := &OpenstackPrefixSource{
+		options:  options,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(ops.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll OpenStack subnets")
+		defer span.Finish()
+		pollPrefixes(ctx, ops.Name(), options.RefreshInterval, ops.fetchPrefixes, ops.prefixes, notify, span.Logger())
+	})
+	return ops
+}
+
+// Prefixes returns prefixes from source
+func (ops *OpenstackPrefixSource) Prefixes() []string {
+	return ops.prefixes.Load()
+}
+
+// Name returns name of the source
+func (ops *OpenstackPrefixSource) Name() string {
+	return "openstack"
+}
+
+// fetchPrefixes reads kuryr.conf and resolves its subnets and the provider networks with Neutron
+func (ops *OpenstackPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	config, err := ops.readKuryrConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config.networks = append(config.networks, ops.options.ProviderNetworks...)
+
+	prefixes := []string{}
+	var ids []string
+	for _, subnet := range config.subnets {
+		if _, _, err := net.ParseCIDR(subnet); err == nil {
+			prefixes = append(prefixes, subnet)
+			continue
+		}
+		ids = append(ids, subnet)
+	}
+	if ops.options.NeutronURL == "" {
+		if len(ids) > 0 || len(config.subnetPools) > 0 || len(config.networks) > 0 {
+			return nil, errors.New("Neutron URL should be set to resolve Kuryr subnet IDs and provider networks")
+		}
+		return prefixes, nil
+	}
+
+	neutronPrefixes, err := ops.fetchNeutronPrefixes(ctx, ids, config)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefixes, neutronPrefixes...), nil
+}
+
+// fetchNeutronPrefixes fetches CIDRs of the subnets, prefixes of the subnet pools and CIDRs of the network subnets
+func (ops *OpenstackPrefixSource) fetchNeutronPrefixes(ctx context.Context, subnetIDs []string,
+	config *kuryrConfig) ([]string, error) {
+	token, err := ops.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set(neutronTokenHeader, token)
+	}
+	baseURL := strings.TrimSuffix(ops.options.NeutronURL, "/") + "/v2.0"
+
+	prefixes := []string{}
+	for _, id := range subnetIDs {
+		subnet := struct {
+			Subnet struct {
+				CIDR string `json:"cidr"`
+			} `json:"subnet"`
+		}{}
+		if err := getJSON(ctx, ops.client, baseURL+"/subnets/"+url.PathEscape(id), header, &subnet); err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, subnet.Subnet.CIDR)
+	}
+	for _, id := range config.subnetPools {
+		pool := struct {
+			SubnetPool struct {
+				Prefixes []string `json:"prefixes"`
+			} `json:"subnetpool"`
+		}{}
+		if err := getJSON(ctx, ops.client, baseURL+"/subnetpools/"+url.PathEscape(id), header, &pool); err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, pool.SubnetPool.Prefixes...)
+	}
+	for _, id := range config.networks {
+		subnets := struct {
+			Subnets []struct {
+				CIDR string `json:"cidr"`
+			} `json:"subnets"`
+		}{}
+		query := url.Values{"network_id": {id}, "fields": {"cidr"}}
+		if err := getJSON(ctx, ops.client, baseURL+"/subnets?"+query.Encode(), header, &subnets); err != nil {
+			return nil, err
+		}
+		for _, subnet := range subnets.Subnets {
+			prefixes = append(prefixes, subnet.CIDR)
+		}
+	}
+	return prefixes, nil
+}
+
+// token returns Keystone token issued for the application credential if Keystone URL is set,
+// the token of the token file otherwise
+func (ops *OpenstackPrefixSource) token(ctx context.Context) (string, error) {
+	if ops.options.AuthURL == "" {
+		return readSecret(ctx, ops.options.TokenPath)
+	}
+	secret, err := readSecret(ctx, ops.options.CredentialPath)
+	if err != nil {
+		return "", err
+	}
+
+	credential := map[string]string{"id": ops.options.CredentialID, "secret": secret}
+	body := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods":                []string{"application_credential"},
+				"application_credential": credential,
+			},
+		},
+	}
+	tokensURL := strings.TrimSuffix(ops.options.AuthURL, "/") + "/auth/tokens"
+	header, err := requestJSON(ctx, ops.client, http.MethodPost, tokensURL, nil, body, &struct{}{})
+	if err != nil {
+		return "", err
+	}
+	token := header.Get(keystoneTokenHeader)
+	if token == "" {
+		return "", errors.Errorf("Keystone response of %s doesn't contain token", tokensURL)
+	}
+	return token, nil
+}
+
+// readKuryrConfig returns subnets of kuryr.conf of the Kuryr config map. Missing config map has no subnets.
+func (ops *OpenstackPrefixSource) readKuryrConfig(ctx context.Context) (*kuryrConfig, error) {
+	if ops.options.KuryrConfigMapName == "" {
+		return &kuryrConfig{}, nil
+	}
+	configMap, err := prefixcollector.KubernetesInterface(ctx).
+		CoreV1().
+		ConfigMaps(ops.options.KuryrConfigMapNamespace).
+		Get(ctx, ops.options.KuryrConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &kuryrConfig{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get Kuryr config map %s/%s",
+			ops.options.KuryrConfigMapNamespace, ops.options.KuryrConfigMapName)
+	}
+	return parseKuryrConf(configMap.Data[KuryrConfKey]), nil
+}
+
+// parseKuryrConf returns subnets, namespace subnet pool and external service network of kuryr.conf INI
+func parseKuryrConf(conf string) *kuryrConfig {
+	config := &kuryrConfig{}
+	var section string
+	scanner := bufio.NewScanner(strings.NewReader(conf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := splitOption(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case section == "namespace_subnet" && key == "pod_subnet_pool":
+			config.subnetPools = append(config.subnetPools, value...)
+		case section == "neutron_defaults" && key == "external_svc_net":
+			config.networks = append(config.networks, value...)
+		case containsString(kuryrSubnetOptions[section], key):
+			config.subnets = append(config.subnets, value...)
+		}
+	}
+	return config
+}
+
+// splitOption splits INI option line to key and comma separated values
+func splitOption(line string) (key string, values []string, ok bool) {
+	separator := strings.IndexAny(line, "=:")
+	if separator < 0 {
+		return "", nil, false
+	}
+	for _, value := range strings.Split(line[separator+1:], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.TrimSpace(line[:separator]), values, true
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	apiV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const kuryrConf = `[DEFAULT]
+debug = true
+
+[neutron_defaults]
+pod_subnets = pod-subnet, 10.128.0.0/14
+service_subnet = service-subnet
+external_svc_net = external-net
+
+[namespace_subnet]
+pod_subnet_pool = pod-pool
+
+[pod_vif_nested]
+worker_nodes_subnets = nodes-subnet
+`
+
+func TestOpenstackPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	g.Expect(ioutil.WriteFile(secretPath, []byte("credential-secret\n"), 0600)).To(Succeed())
+
+	subnets := map[string]string{
+		"pod-subnet":     "10.0.0.0/16",
+		"service-subnet": "172.30.0.0/16",
+		"nodes-subnet":   "192.168.0.0/24",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Auth struct {
+				Identity struct {
+					Credential struct {
+						ID     string `json:"id"`
+						Secret string `json:"secret"`
+					} `json:"application_credential"`
+				} `json:"identity"`
+			} `json:"auth"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || r.Method != http.MethodPost ||
+			request.Auth.Identity.Credential.ID != "credential" ||
+			request.Auth.Identity.Credential.Secret != "credential-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"token": {}}`)
+	})
+	neutron := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Auth-Token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("/network/v2.0/subnets/", neutron(func(w http.ResponseWriter, r *http.Request) {
+		cidr, ok := subnets[filepath.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"subnet": {"cidr": %q}}`, cidr)
+	}))
+	mux.HandleFunc("/network/v2.0/subnetpools/pod-pool", neutron(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"subnetpool": {"prefixes": ["10.64.0.0/12"]}}`)
+	}))
+	mux.HandleFunc("/network/v2.0/subnets", neutron(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("network_id") {
+		case "external-net":
+			_, _ = fmt.Fprint(w, `{"subnets": [{"cidr": "203.0.113.0/24"}]}`)
+		case "provider-net":
+			_, _ = fmt.Fprint(w, `{"subnets": [{"cidr": "198.51.100.0/24"}, {"cidr": "2001:db8::/64"}]}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"subnets": []}`)
+		}
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, fake.NewSimpleClientset(&apiV1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kuryr-config", Namespace: "kube-system"},
+		Data:       map[string]string{prefixsource.KuryrConfKey: kuryrConf},
+	}))
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewOpenstackPrefixSource(ctx, notify, &prefixsource.OpenstackOptions{
+		NeutronURL:              server.URL + "/network",
+		AuthURL:                 server.URL + "/identity/v3",
+		CredentialID:            "credential",
+		CredentialPath:          secretPath,
+		ProviderNetworks:        []string{"provider-net"},
+		KuryrConfigMapName:      "kuryr-config",
+		KuryrConfigMapNamespace: "kube-system",
+		RefreshInterval:         time.Hour,
+		Client:                  client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(sortedPrefixes(source)()).To(Equal([]string{
+		"10.0.0.0/16", "10.128.0.0/14", "10.64.0.0/12", "172.30.0.0/16", "192.168.0.0/24",
+		"198.51.100.0/24", "2001:db8::/64", "203.0.113.0/24",
+	}))
+}
+
+func TestOpenstackPrefixSourceKuryrCIDRs(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithKubernetesInterface(ctx, fake.NewSimpleClientset(&apiV1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kuryr-config", Namespace: "openshift-kuryr"},
+		Data: map[string]string{
+			prefixsource.KuryrConfKey: "[neutron_defaults]\npod_subnet = 10.128.0.0/14\nservice_subnet = 172.30.0.0/16\n",
+		},
+	}))
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewOpenstackPrefixSource(ctx, notify, &prefixsource.OpenstackOptions{
+		KuryrConfigMapName:      "kuryr-config",
+		KuryrConfigMapNamespace: "openshift-kuryr",
+		RefreshInterval:         time.Hour,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(sortedPrefixes(source)()).To(Equal([]string{"10.128.0.0/14", "172.30.0.0/16"}))
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// TailscaleIPv4Range is CGNAT range Tailscale assigns node addresses from
+	TailscaleIPv4Range = "100.64.0.0/10"
+	// TailscaleIPv6Range is ULA range Tailscale assigns node addresses from
+	TailscaleIPv6Range = "fd7a:115c:a1e0::/48"
+	// DefaultSysfsNetDir is sysfs directory of the node network interfaces
+	DefaultSysfsNetDir = "/sys/class/net"
+)
+
+// overlayInterface is VPN overlay interface of the node
+type overlayInterface struct {
+	hostInterface
+	tailscale bool
+}
+
+// OverlayPrefixSource is excluded prefix source of the VPN overlays of the node, which frequently collide with
+// NSM pools: Tailscale and WireGuard interfaces networks and routes over them. Tailscale addresses exclude the
+// whole Tailscale ranges, since peers are assigned addresses from them. It requires hostNetwork.
+type OverlayPrefixSource struct {
+	options  *OverlayOptions
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// OverlayOptions are OverlayPrefixSource settings
+type OverlayOptions struct {
+	// TailscaleInterfaces and WireGuardInterfaces are path.Match patterns of the overlay interfaces names
+	TailscaleInterfaces []string
+	WireGuardInterfaces []string
+	// SysfsNetDir is sysfs directory WireGuard interfaces are detected in by their device type regardless
+	// of names, DefaultSysfsNetDir if it is empty
+	SysfsNetDir     string
+	RefreshInterval time.Duration
+}
+
+// NewOverlayPrefixSource creates OverlayPrefixSource
+func NewOverlayPrefixSource(ctx context.Context, notify *utils.EventBus, options *OverlayOptions) *OverlayPrefixSource {
+	ops := &OverlayPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(ops.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll overlay interfaces")
+		defer span.Finish()
+		pollPrefixes(ctx, ops.Name(), options.RefreshInterval, ops.fetchPrefixes, ops.prefixes, notify, span.Logger())
+	})
+	return ops
+}
+
+// Prefixes returns prefixes from source
+func (ops *OverlayPrefixSource) Prefixes() []string {
+	return ops.prefixes.Load()
+}
+
+// Name returns name of the source
+func (ops *OverlayPrefixSource) Name() string {
+	return "overlay-interfaces"
+}
+
+func (ops *OverlayPrefixSource) fetchPrefixes(context.Context) ([]string, error) {
+	interfaces, err := ops.listOverlayInterfaces()
+	if err != nil || len(interfaces) == 0 {
+		return []string{}, err
+	}
+	routes, err := listHostRoutes()
+	if err != nil {
+		return nil, err
+	}
+	return overlayPrefixes(interfaces, routes), nil
+}
+
+// listOverlayInterfaces returns the node interfaces matching Tailscale or WireGuard patterns and WireGuard
+// interfaces detected by sysfs device type
+func (ops *OverlayPrefixSource) listOverlayInterfaces() ([]overlayInterface, error) {
+	sysfsNetDir := ops.options.SysfsNetDir
+	if sysfsNetDir == "" {
+		sysfsNetDir = DefaultSysfsNetDir
+	}
+	interfaces, err := listHostInterfaces(func(name string) bool {
+		return matchesAny(ops.options.TailscaleInterfaces, name) || matchesAny(ops.options.WireGuardInterfaces, name) ||
+			isWireGuard(sysfsNetDir, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	overlays := make([]overlayInterface, 0, len(interfaces))
+	for _, hostIface := range interfaces {
+		overlays = append(overlays, overlayInterface{
+			hostInterface: hostIface,
+			tailscale:     matchesAny(ops.options.TailscaleInterfaces, hostIface.name),
+		})
+	}
+	return overlays, nil
+}
+
+// isWireGuard returns true if sysfs uevent of the interface has WireGuard device type
+func isWireGuard(sysfsNetDir, name string) bool {
+	data, err := ioutil.ReadFile(filepath.Clean(filepath.Join(sysfsNetDir, name, "uevent")))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "DEVTYPE=wireguard" {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayPrefixes returns networks of the overlay interfaces addresses and prefixes of the routes over them,
+// e.g. WireGuard allowed IPs and Tailscale subnet routes. Addresses of Tailscale ranges are replaced with the ranges,
+// link-local addresses and default routes are never excluded.
+func overlayPrefixes(interfaces []overlayInterface, routes []hostRoute) []string {
+	_, tailscaleIPv4, _ := net.ParseCIDR(TailscaleIPv4Range)
+	_, tailscaleIPv6, _ := net.ParseCIDR(TailscaleIPv6Range)
+
+	prefixes := []string{}
+	seen := map[string]bool{}
+	add := func(prefix string) {
+		if !seen[prefix] && prefix != "0.0.0.0/0" && prefix != "::/0" {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	names := map[string]bool{}
+	for i := range interfaces {
+		names[interfaces[i].name] = true
+		for _, address := range interfaces[i].addresses {
+			ip, ipNet, err := net.ParseCIDR(address)
+			switch {
+			case err != nil || ip.IsLinkLocalUnicast():
+			case interfaces[i].tailscale && tailscaleIPv4.Contains(ip):
+				add(TailscaleIPv4Range)
+			case interfaces[i].tailscale && tailscaleIPv6.Contains(ip):
+				add(TailscaleIPv6Range)
+			default:
+				add(ipNet.String())
+			}
+		}
+	}
+	for i := range routes {
+		if names[routes[i].iface] && !strings.HasPrefix(routes[i].prefix, "fe80:") {
+			add(routes[i].prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestOverlayPrefixes(t *testing.T) {
+	g := NewWithT(t)
+
+	interfaces := []overlayInterface{
+		{hostInterface: hostInterface{name: "tailscale0", addresses: []string{
+			"100.101.102.103/32", "fd7a:115c:a1e0::1/128", "fe80::1/64",
+		}}, tailscale: true},
+		{hostInterface: hostInterface{name: "wg0", addresses: []string{"10.8.0.2/24"}}},
+	}
+	routes := []hostRoute{
+		{prefix: "10.0.0.0/24", protocol: "kernel", table: 254, iface: "eth0"},
+		{prefix: "100.100.1.1/32", protocol: "boot", table: 52, iface: "tailscale0"},
+		{prefix: "192.168.50.0/24", protocol: "boot", table: 52, iface: "tailscale0"},
+		{prefix: "0.0.0.0/0", protocol: "boot", table: 51820, iface: "wg0"},
+		{prefix: "10.8.0.0/24", protocol: "kernel", table: 254, iface: "wg0"},
+		{prefix: "172.31.0.0/16", protocol: "boot", table: 254, iface: "wg0"},
+		{prefix: "fe80::/64", protocol: "kernel", table: 254, iface: "wg0"},
+	}
+
+	g.Expect(overlayPrefixes(interfaces, routes)).To(Equal([]string{
+		TailscaleIPv4Range, TailscaleIPv6Range, "10.8.0.0/24", "100.100.1.1/32", "192.168.50.0/24", "172.31.0.0/16",
+	}))
+	g.Expect(overlayPrefixes(nil, routes)).To(BeEmpty())
+}
+
+func TestIsWireGuard(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(writeUevent(dir, "vpn0", "DEVTYPE=wireguard\nINTERFACE=vpn0\nIFINDEX=5\n")).To(Succeed())
+	g.Expect(writeUevent(dir, "eth0", "INTERFACE=eth0\nIFINDEX=2\n")).To(Succeed())
+
+	g.Expect(isWireGuard(dir, "vpn0")).To(BeTrue())
+	g.Expect(isWireGuard(dir, "eth0")).To(BeFalse())
+	g.Expect(isWireGuard(dir, "missing")).To(BeFalse())
+}
+
+func writeUevent(dir, name, uevent string) error {
+	if err := os.MkdirAll(filepath.Join(dir, name), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, name, "uevent"), []byte(uevent), 0600)
+}
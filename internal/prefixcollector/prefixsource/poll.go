@@ -0,0 +1,208 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fetchPrefixesFunc fetches prefixes from external system
+type fetchPrefixesFunc func(ctx context.Context) ([]string, error)
+
+// pollPrefixes fetches prefixes every interval, on forced resync and on re-authentication request until ctx is done,
+// stores them and notifies about changes. Prefixes are kept on fetch errors, so outage of the external system doesn't
+// remove its exclusions. Mounted secrets the fetches read are checked every secrets check interval of ctx, prefixes
+// are fetched again as soon as they are rotated. Successful fetches refresh source name.
+func pollPrefixes(ctx context.Context, name string, interval time.Duration, fetch fetchPrefixesFunc,
+	prefixes *utils.SynchronizedPrefixesContainer, notify *utils.EventBus, logger logrus.FieldLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	resync := prefixcollector.ResyncSignal(ctx).Subscribe()
+	reauth := prefixcollector.ReauthSignal(ctx).Subscribe()
+	refreshTimes := prefixcollector.RefreshTimes(ctx)
+	var secretChecks <-chan time.Time
+	if checkInterval := prefixcollector.SecretsCheckInterval(ctx); checkInterval > 0 {
+		secretsTicker := time.NewTicker(checkInterval)
+		defer secretsTicker.Stop()
+		secretChecks = secretsTicker.C
+	}
+	secrets := &secretFiles{hashes: map[string][sha256.Size]byte{}}
+	fetchCtx := context.WithValue(ctx, secretFilesKey{}, secrets)
+
+	for {
+		fetched, err := fetch(fetchCtx)
+		if err == nil {
+			fetched = validPrefixes(fetched, logger)
+			refreshTimes.Touch(name)
+		}
+		switch {
+		case err != nil:
+			logger.Errorf("Failed to fetch prefixes: %v", err)
+		case !utils.UnorderedSlicesEquals(fetched, prefixes.Load()):
+			prefixes.Store(fetched)
+			notify.Notify()
+			logger.Infof("Prefixes sent from external source: %v", fetched)
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				break wait
+			case <-resync:
+				logger.Info("Resync requested, fetching prefixes")
+				break wait
+			case <-reauth:
+				logger.Info("Re-authentication requested, fetching prefixes with fresh credentials")
+				break wait
+			case <-secretChecks:
+				if rotated := secrets.rotated(); len(rotated) > 0 {
+					logger.Infof("Secrets %v are rotated, fetching prefixes with them", rotated)
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// validPrefixes returns valid CIDRs of prefixes, invalid ones are reported and skipped
+func validPrefixes(prefixes []string, logger logrus.FieldLogger) []string {
+	valid := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if _, _, err := net.ParseCIDR(prefix); err != nil {
+			logger.Warnf("Skipping invalid prefix %q: %v", prefix, err)
+			continue
+		}
+		valid = append(valid, prefix)
+	}
+	return valid
+}
+
+// secretFilesKey is key of secretFiles in fetch context
+type secretFilesKey struct{}
+
+// secretFiles are hashes of the secret files read by fetches of a source by their paths
+type secretFiles struct {
+	mutex  sync.Mutex
+	hashes map[string][sha256.Size]byte
+}
+
+// store keeps hash of the secret file data
+func (s *secretFiles) store(filePath string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hashes[filePath] = sha256.Sum256(data)
+}
+
+// rotated returns paths of the secret files changed since they were read, unreadable ones are left to the next fetch
+func (s *secretFiles) rotated() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var rotated []string
+	for filePath, hash := range s.hashes {
+		if data, err := ioutil.ReadFile(filepath.Clean(filePath)); err == nil && sha256.Sum256(data) != hash {
+			rotated = append(rotated, filePath)
+		}
+	}
+	sort.Strings(rotated)
+	return rotated
+}
+
+// readSecret returns trimmed content of the secret file, empty path is an empty secret.
+// Secret is read on every use, so rotated Kubernetes secrets are picked up without restart, polled sources
+// also watch the secrets they read to fetch again right after rotation.
+func readSecret(ctx context.Context, filePath string) (string, error) {
+	if filePath == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read secret %s", filePath)
+	}
+	if secrets, ok := ctx.Value(secretFilesKey{}).(*secretFiles); ok {
+		secrets.store(filePath, data)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getJSON sends GET request with header to url and decodes JSON response to result
+func getJSON(ctx context.Context, client *http.Client, url string, header http.Header, result interface{}) error {
+	return doJSON(ctx, client, http.MethodGet, url, header, nil, result)
+}
+
+// doJSON sends request with header and JSON encoded body to url and decodes JSON response to result.
+// Request without body is sent if body is nil.
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header,
+	body, result interface{}) error {
+	_, err := requestJSON(ctx, client, method, url, header, body, result)
+	return err
+}
+
+// requestJSON is doJSON returning header of the response. Responses with 200 OK and 201 Created status are successful.
+func requestJSON(ctx context.Context, client *http.Client, method, url string, header http.Header,
+	body, result interface{}) (http.Header, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to encode request to %s", url)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create request to %s", url)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to %s %s", method, url)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return nil, errors.Errorf("Failed to %s %s: %s", method, url, response.Status)
+	}
+	return response.Header, errors.Wrapf(json.NewDecoder(response.Body).Decode(result), "Failed to decode response of %s", url)
+}
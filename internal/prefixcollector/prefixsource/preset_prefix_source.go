@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import "cmd-exclude-prefixes-k8s/internal/prefixcollector"
+
+// PresetPrefixSource is excluded prefix source of the configured well-known range presets
+type PresetPrefixSource struct {
+	prefixes []string
+}
+
+// Prefixes returns prefixes from source
+func (p *PresetPrefixSource) Prefixes() []string {
+	return p.prefixes
+}
+
+// Name returns name of the source
+func (p *PresetPrefixSource) Name() string {
+	return "presets"
+}
+
+// NewPresetPrefixSource creates PresetPrefixSource of the presets, unknown presets are rejected by config validation
+// and have no prefixes
+func NewPresetPrefixSource(presets []string) *PresetPrefixSource {
+	var prefixes []string
+	for _, preset := range presets {
+		presetPrefixes, _ := prefixcollector.PresetPrefixes([]string{preset})
+		prefixes = append(prefixes, presetPrefixes...)
+	}
+	return &PresetPrefixSource{
+		prefixes: prefixes,
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/networkservicemesh/api/pkg/api/registry"
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// RegistryCIDRsLabel is default network service label of NSEs listing IP context prefixes the NSE allocates
+// addresses of the network service from
+const RegistryCIDRsLabel = "exclude-prefixes.nsm.io/cidrs"
+
+// RegistryPrefixSource is excluded prefix source of NSM registry. IP context prefixes NSEs advertise in
+// network service labels are excluded, so they aren't allocated again for other network services.
+type RegistryPrefixSource struct {
+	options  *RegistryOptions
+	client   registry.NetworkServiceEndpointRegistryClient
+	prefixes *utils.SynchronizedPrefixesContainer
+	logger   logrus.FieldLogger
+}
+
+// RegistryOptions are RegistryPrefixSource settings
+type RegistryOptions struct {
+	// URL is URL of NSM registry gRPC API
+	URL *url.URL
+	// CIDRsLabel is network service label containing comma separated IP context prefixes
+	CIDRsLabel string
+	// NetworkService is network service excluded prefixes are allocated for, its prefixes aren't excluded
+	NetworkService  string
+	RefreshInterval time.Duration
+	DialOptions     []grpc.DialOption
+}
+
+// NewRegistryPrefixSource creates RegistryPrefixSource
+func NewRegistryPrefixSource(ctx context.Context, notify *utils.EventBus, options *RegistryOptions) *RegistryPrefixSource {
+	rps := &RegistryPrefixSource{
+		options:  options,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(rps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll NSM registry")
+		defer span.Finish()
+
+		cc, err := grpc.DialContext(ctx, grpcutils.URLToTarget(options.URL), options.DialOptions...)
+		if err != nil {
+			span.Logger().Errorf("Failed to dial NSM registry %s: %v", options.URL, err)
+			return
+		}
+		defer func() { _ = cc.Close() }()
+
+		rps.client = registry.NewNetworkServiceEndpointRegistryClient(cc)
+		rps.logger = span.Logger()
+		pollPrefixes(ctx, rps.Name(), options.RefreshInterval, rps.fetchPrefixes, rps.prefixes, notify, span.Logger())
+	})
+	return rps
+}
+
+// Prefixes returns prefixes from source
+func (rps *RegistryPrefixSource) Prefixes() []string {
+	return rps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (rps *RegistryPrefixSource) Name() string {
+	return "nsm-registry"
+}
+
+// fetchPrefixes finds all the registered NSEs and returns IP context prefixes of their unexpired network services
+func (rps *RegistryPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, rps.options.RefreshInterval)
+	defer cancel()
+
+	stream, err := rps.client.Find(ctx, &registry.NetworkServiceEndpointQuery{
+		NetworkServiceEndpoint: &registry.NetworkServiceEndpoint{},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find NSEs of NSM registry %s", rps.options.URL)
+	}
+
+	prefixes := []string{}
+	now := time.Now()
+	for {
+		nse, err := stream.Recv()
+		if err == io.EOF {
+			return prefixes, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to receive NSEs of NSM registry %s", rps.options.URL)
+		}
+		if expiration, err := ptypes.Timestamp(nse.ExpirationTime); err == nil && expiration.Before(now) {
+			continue
+		}
+		for service, labels := range nse.NetworkServiceLabels {
+			if service == rps.options.NetworkService || labels == nil || labels.Labels[rps.options.CIDRsLabel] == "" {
+				continue
+			}
+			var servicePrefixes prefixcollector.PrefixList
+			if err := servicePrefixes.Decode(labels.Labels[rps.options.CIDRsLabel]); err != nil {
+				rps.logger.Warnf("Skipping prefixes of NSE %s network service %s: %v", nse.Name, service, err)
+				continue
+			}
+			prefixes = append(prefixes, servicePrefixes...)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+
+	"github.com/networkservicemesh/api/pkg/api/registry"
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+)
+
+type testNSERegistry struct {
+	registry.UnimplementedNetworkServiceEndpointRegistryServer
+	nses []*registry.NetworkServiceEndpoint
+}
+
+func (r *testNSERegistry) Find(_ *registry.NetworkServiceEndpointQuery,
+	server registry.NetworkServiceEndpointRegistry_FindServer) error {
+	for _, nse := range r.nses {
+		if err := server.Send(nse); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cidrLabels(cidrs string) *registry.NetworkServiceLabels {
+	return &registry.NetworkServiceLabels{Labels: map[string]string{prefixsource.RegistryCIDRsLabel: cidrs}}
+}
+
+func TestRegistryPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	expired, err := ptypes.TimestampProto(time.Now().Add(-time.Minute))
+	g.Expect(err).To(BeNil())
+	server := grpc.NewServer()
+	registry.RegisterNetworkServiceEndpointRegistryServer(server, &testNSERegistry{nses: []*registry.NetworkServiceEndpoint{
+		{
+			Name:                "vpn-gateway",
+			NetworkServiceNames: []string{"vpn", "secure-intranet"},
+			NetworkServiceLabels: map[string]*registry.NetworkServiceLabels{
+				"vpn":             cidrLabels("172.16.0.0/24, fd00:16::/64"),
+				"secure-intranet": cidrLabels("172.16.1.0/24"),
+			},
+		},
+		{
+			Name:                 "icmp-responder",
+			NetworkServiceNames:  []string{"icmp"},
+			NetworkServiceLabels: map[string]*registry.NetworkServiceLabels{"icmp": cidrLabels("169.254.0.0/16")},
+		},
+		{
+			Name:                 "expired",
+			NetworkServiceNames:  []string{"vpn"},
+			NetworkServiceLabels: map[string]*registry.NetworkServiceLabels{"vpn": cidrLabels("172.16.2.0/24")},
+			ExpirationTime:       expired,
+		},
+		{
+			Name:                 "unlabeled",
+			NetworkServiceNames:  []string{"vpn"},
+			NetworkServiceLabels: map[string]*registry.NetworkServiceLabels{"vpn": {}},
+		},
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	listenURL := &url.URL{Scheme: "tcp", Host: "127.0.0.1:0"}
+	errCh := grpcutils.ListenAndServe(serverCtx, listenURL, server)
+	defer func() {
+		stopServer()
+		<-errCh
+	}()
+
+	sourceCtx, stopSource := context.WithCancel(ctx)
+	defer stopSource()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewRegistryPrefixSource(sourceCtx, notify, &prefixsource.RegistryOptions{
+		URL:             listenURL,
+		CIDRsLabel:      prefixsource.RegistryCIDRsLabel,
+		NetworkService:  "icmp",
+		RefreshInterval: time.Hour,
+		DialOptions:     []grpc.DialOption{grpc.WithInsecure()},
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(sortedPrefixes(source)()).To(Equal([]string{"172.16.0.0/24", "172.16.1.0/24", "fd00:16::/64"}))
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ReservationPrefixSource is excluded prefix source of the prefixes operators reserved in the reservations
+// config map. Reservation prefix is excluded until it is released or its lease expires.
+type ReservationPrefixSource struct {
+	ctx      context.Context
+	notify   *utils.EventBus
+	prefixes *utils.SynchronizedPrefixesContainer
+	// changed is signalled when the watched reservations change
+	changed chan struct{}
+	// resourceReservations are reservations of the config maps by namespace/name, they are used only by the watch
+	resourceReservations map[string][]prefixcollector.Reservation
+	reservations         []prefixcollector.Reservation
+	reservationMutex     sync.Mutex
+}
+
+// NewReservationPrefixSource creates ReservationPrefixSource watching the reservations config map
+func NewReservationPrefixSource(ctx context.Context, notify *utils.EventBus, namespace, name string) *ReservationPrefixSource {
+	rps := &ReservationPrefixSource{
+		ctx:      ctx,
+		notify:   notify,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+		changed:  make(chan struct{}, 1),
+
+		resourceReservations: map[string][]prefixcollector.Reservation{},
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(rps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Watch prefix reservations")
+		defer span.Finish()
+
+		rw := &resourceWatch{
+			resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ConfigMapResource).Namespace(namespace),
+			versions:          prefixcollector.ResourceVersions(ctx),
+			key:               rps.Name(),
+			prefixesFunc:      rps.reservedPrefixes,
+			prefixes:          utils.NewSynchronizedPrefixesContainer(),
+			notify:            utils.NewEventBus(),
+			logger:            span.Logger(),
+			fieldSelector:     fields.OneTermEqualSelector("metadata.name", name),
+			onStore:           rps.storeReservations,
+		}
+		rw.run(ctx)
+	})
+	prefixcollector.Lifecycle(ctx).Go(rps.Name()+"/leases", rps.expire)
+	return rps
+}
+
+// Prefixes returns prefixes from source
+func (rps *ReservationPrefixSource) Prefixes() []string {
+	return rps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (rps *ReservationPrefixSource) Name() string {
+	return "reservations"
+}
+
+// reservedPrefixes returns prefixes of the reservations config map and keeps its reservations
+func (rps *ReservationPrefixSource) reservedPrefixes(configMap *unstructured.Unstructured) ([]string, error) {
+	name := configMap.GetNamespace() + "/" + configMap.GetName()
+	delete(rps.resourceReservations, name)
+
+	data, _, err := unstructured.NestedStringMap(configMap.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := prefixcollector.DecodeReservations(data)
+	if err != nil {
+		return nil, err
+	}
+	rps.resourceReservations[name] = reservations
+
+	prefixes := make([]string, 0, len(reservations))
+	for i := range reservations {
+		prefixes = append(prefixes, reservations[i].Prefix)
+	}
+	return prefixes, nil
+}
+
+// storeReservations keeps reservations of the watched config map and signals the change. Reservations of
+// the deleted config map are removed.
+func (rps *ReservationPrefixSource) storeReservations(resourcePrefixes map[string][]string) {
+	var reservations []prefixcollector.Reservation
+	for name := range rps.resourceReservations {
+		if _, ok := resourcePrefixes[name]; !ok {
+			delete(rps.resourceReservations, name)
+			continue
+		}
+		reservations = append(reservations, rps.resourceReservations[name]...)
+	}
+	rps.reservationMutex.Lock()
+	rps.reservations = reservations
+	rps.reservationMutex.Unlock()
+
+	select {
+	case rps.changed <- struct{}{}:
+	default:
+	}
+}
+
+// expire updates prefixes on reservations changes and at lease expirations until ctx is done
+func (rps *ReservationPrefixSource) expire() {
+	span := spanhelper.FromContext(rps.ctx, "Expire prefix reservations")
+	defer span.Finish()
+	logger := span.Logger()
+
+	for {
+		now := time.Now()
+		prefixes, next := rps.activePrefixes(now)
+		if !utils.UnorderedSlicesEquals(prefixes, rps.prefixes.Load()) {
+			rps.prefixes.Store(prefixes)
+			rps.notify.Notify()
+			logger.Infof("Reserved prefixes changed, active prefixes: %v", prefixes)
+		}
+
+		if !rps.wait(next.Sub(now)) {
+			return
+		}
+	}
+}
+
+// wait waits for the reservations change or the timeout, non-positive timeout is infinite.
+// Returns false if ctx is done.
+func (rps *ReservationPrefixSource) wait(timeout time.Duration) bool {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-rps.ctx.Done():
+		return false
+	case <-rps.changed:
+	case <-expired:
+	}
+	return true
+}
+
+// activePrefixes returns prefixes of the reservations active at now and the earliest expiration after now,
+// zero if there is none
+func (rps *ReservationPrefixSource) activePrefixes(now time.Time) (prefixes []string, next time.Time) {
+	rps.reservationMutex.Lock()
+	defer rps.reservationMutex.Unlock()
+
+	prefixes = []string{}
+	for i := range rps.reservations {
+		reservation := &rps.reservations[i]
+		if !reservation.Active(now) {
+			continue
+		}
+		prefixes = append(prefixes, reservation.Prefix)
+		if !reservation.Expires.IsZero() && (next.IsZero() || reservation.Expires.Before(next)) {
+			next = reservation.Expires
+		}
+	}
+	return prefixes, next
+}
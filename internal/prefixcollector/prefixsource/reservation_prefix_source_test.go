@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func reservationsConfigMap(t *testing.T, reservations ...prefixcollector.Reservation) *unstructured.Unstructured {
+	data, err := json.Marshal(reservations)
+	NewWithT(t).Expect(err).To(BeNil())
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "reservations", "namespace": "nsm-system"},
+		"data":       map[string]interface{}{prefixcollector.ReservationsKey: string(data)},
+	}}
+}
+
+func TestReservationPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	configMaps := client.Resource(prefixsource.ConfigMapResource).Namespace("nsm-system")
+	now := time.Now()
+	_, err := configMaps.Create(ctx, reservationsConfigMap(t,
+		prefixcollector.Reservation{Prefix: "10.20.0.0/16", Requester: "operator", Created: now},
+		prefixcollector.Reservation{Prefix: "10.30.0.0/16", Requester: "operator", Created: now, Expires: now.Add(300 * time.Millisecond)},
+		prefixcollector.Reservation{Prefix: "10.40.0.0/16", Requester: "operator", Created: now, Expires: now.Add(-time.Second)},
+	), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+
+	source := prefixsource.NewReservationPrefixSource(ctx, utils.NewEventBus(), "nsm-system", "reservations")
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.20.0.0/16", "10.30.0.0/16"}))
+	// the lease expires without changes of the config map
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.20.0.0/16"}))
+
+	g.Expect(configMaps.Delete(ctx, "reservations", metav1.DeleteOptions{})).To(Succeed())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(BeEmpty())
+}
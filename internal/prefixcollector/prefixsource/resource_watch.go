@@ -0,0 +1,209 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// resourcePrefixesFunc returns excluded prefixes of the custom resource
+type resourcePrefixesFunc func(resource *unstructured.Unstructured) ([]string, error)
+
+// resourceWatch lists and watches custom resources and keeps union of their excluded prefixes.
+// The last observed resource version is kept in versions under key, the same way config maps are watched.
+type resourceWatch struct {
+	resourceInterface dynamic.ResourceInterface
+	versions          *utils.ResourceVersions
+	key               string
+	prefixesFunc      resourcePrefixesFunc
+	prefixes          *utils.SynchronizedPrefixesContainer
+	notify            *utils.EventBus
+	logger            logrus.FieldLogger
+	// selector selects watched resources by labels, all the resources are watched if nil
+	selector labels.Selector
+	// fieldSelector selects watched resources by metadata fields, all the resources are watched if nil
+	fieldSelector fields.Selector
+	// onStore is called on every store with prefixes of the resources by namespace/name, if it is set
+	onStore func(resourcePrefixes map[string][]string)
+	// resourcePrefixes are prefixes of the resources by namespace/name
+	resourcePrefixes map[string][]string
+}
+
+// run lists and watches resources until ctx is done, forced resync lists them again from the latest version.
+// Lists and watch events refresh source key. Failed list and watch requests, e.g. timed out over flaky links,
+// are retried with backoff.
+func (rw *resourceWatch) run(ctx context.Context) {
+	resync := prefixcollector.ResyncSignal(ctx).Subscribe()
+	backoff := &utils.Backoff{}
+	for ctx.Err() == nil {
+		list, err := rw.resourceInterface.List(ctx, metav1.ListOptions{
+			LabelSelector:   rw.labelSelector(),
+			FieldSelector:   rw.fieldSelectorString(),
+			ResourceVersion: rw.versions.Load(rw.key),
+		})
+		if err != nil {
+			rw.logger.Errorf("Failed to list %s, retrying: %v", rw.key, err)
+			backoff.Wait(ctx)
+			continue
+		}
+		backoff.Reset()
+		rw.resourcePrefixes = map[string][]string{}
+		for i := range list.Items {
+			rw.setResource(&list.Items[i])
+		}
+		rw.versions.Store(rw.key, list.GetResourceVersion())
+		prefixcollector.RefreshTimes(ctx).Touch(rw.key)
+		rw.store()
+
+		for expired := false; !expired && ctx.Err() == nil; {
+			watcher, err := rw.resourceInterface.Watch(ctx, metav1.ListOptions{
+				LabelSelector:       rw.labelSelector(),
+				FieldSelector:       rw.fieldSelectorString(),
+				ResourceVersion:     rw.versions.Load(rw.key),
+				AllowWatchBookmarks: true,
+				TimeoutSeconds:      prefixcollector.WatchTimeoutSeconds(ctx),
+			})
+			if err != nil {
+				rw.logger.Errorf("Failed to watch %s, retrying: %v", rw.key, err)
+				backoff.Wait(ctx)
+				continue
+			}
+			backoff.Reset()
+			expired = rw.handleEvents(ctx, watcher, resync)
+			watcher.Stop()
+		}
+	}
+}
+
+// handleEvents handles watcher events until it is closed. Returns true if the watched resource version expired
+// or resync is requested.
+func (rw *resourceWatch) handleEvents(ctx context.Context, watcher watch.Interface, resync <-chan struct{}) (expired bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resync:
+			rw.logger.Infof("Resync requested, listing %s again", rw.key)
+			rw.versions.Store(rw.key, "")
+			return true
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+
+			if event.Type == watch.Error {
+				if err := apierrors.FromObject(event.Object); apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					rw.logger.Infof("Watch of %s resource version expired, listing again", rw.key)
+					rw.versions.Store(rw.key, "")
+					return true
+				}
+				continue
+			}
+
+			resource, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			rw.versions.Store(rw.key, resource.GetResourceVersion())
+			prefixcollector.RefreshTimes(ctx).Touch(rw.key)
+
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				rw.setResource(resource)
+			case watch.Deleted:
+				delete(rw.resourcePrefixes, resource.GetNamespace()+"/"+resource.GetName())
+			default:
+				continue
+			}
+			rw.store()
+		}
+	}
+}
+
+// labelSelector returns label selector of the list options
+func (rw *resourceWatch) labelSelector() string {
+	if rw.selector == nil {
+		return ""
+	}
+	return rw.selector.String()
+}
+
+// fieldSelectorString returns field selector of the list options
+func (rw *resourceWatch) fieldSelectorString() string {
+	if rw.fieldSelector == nil {
+		return ""
+	}
+	return rw.fieldSelector.String()
+}
+
+// selected returns true if the resource matches the selectors
+func (rw *resourceWatch) selected(resource *unstructured.Unstructured) bool {
+	if rw.fieldSelector != nil && !rw.fieldSelector.Matches(fields.Set{
+		"metadata.name":      resource.GetName(),
+		"metadata.namespace": resource.GetNamespace(),
+	}) {
+		return false
+	}
+	return rw.selector == nil || rw.selector.Matches(labels.Set(resource.GetLabels()))
+}
+
+// setResource sets prefixes of the resource, resources with invalid prefixes are reported and skipped.
+// Prefixes of the resource not matching the selector anymore are removed.
+func (rw *resourceWatch) setResource(resource *unstructured.Unstructured) {
+	name := resource.GetNamespace() + "/" + resource.GetName()
+	if !rw.selected(resource) {
+		delete(rw.resourcePrefixes, name)
+		return
+	}
+	prefixes, err := rw.prefixesFunc(resource)
+	if err != nil {
+		rw.logger.Warnf("Skipping prefixes of %s %s: %v", resource.GetKind(), name, err)
+		delete(rw.resourcePrefixes, name)
+		return
+	}
+	rw.resourcePrefixes[name] = validPrefixes(prefixes, rw.logger)
+}
+
+// store stores union of the resources prefixes and notifies if it is changed
+func (rw *resourceWatch) store() {
+	if rw.onStore != nil {
+		rw.onStore(rw.resourcePrefixes)
+	}
+	prefixes := []string{}
+	for _, resourcePrefixes := range rw.resourcePrefixes {
+		prefixes = append(prefixes, resourcePrefixes...)
+	}
+	sort.Strings(prefixes)
+	if utils.UnorderedSlicesEquals(prefixes, rw.prefixes.Load()) {
+		return
+	}
+	rw.prefixes.Store(prefixes)
+	rw.notify.Notify()
+	rw.logger.Infof("Prefixes sent from %s: %v", rw.key, prefixes)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// RestPrefixSource is excluded prefix source of arbitrary REST API returning JSON. Prefixes are extracted
+// from responses with Kubernetes JSONPath template, so APIs returning address and mask separately
+// are supported too, e.g. {range .data[*]}{.subnet}/{.mask}{"\n"}{end}.
+type RestPrefixSource struct {
+	options  *RestOptions
+	urls     []string
+	path     *jsonpath.JSONPath
+	client   *http.Client
+	prefixes *utils.SynchronizedPrefixesContainer
+	parseErr error
+}
+
+// RestOptions are RestPrefixSource settings
+type RestOptions struct {
+	// URLTemplates are text/template templates of the requested URLs executed with Params
+	URLTemplates []string
+	Params       map[string]string
+	// PrefixPath is Kubernetes JSONPath template producing whitespace or comma separated prefixes
+	PrefixPath string
+	// AuthHeader is name of the header containing content of AuthValuePath file
+	AuthHeader      string
+	AuthValuePath   string
+	RefreshInterval time.Duration
+	Client          *http.Client
+}
+
+// NewRestPrefixSource creates RestPrefixSource
+func NewRestPrefixSource(ctx context.Context, notify *utils.EventBus, options *RestOptions) *RestPrefixSource {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	rps := &RestPrefixSource{
+		options:  options,
+		client:   client,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+	rps.urls, rps.path, rps.parseErr = parseRestTemplates(options.URLTemplates, options.Params, options.PrefixPath)
+
+	prefixcollector.Lifecycle(ctx).Go(rps.Name(), func() {
+		span := spanhelper.FromContext(ctx, "Poll REST prefixes")
+		defer span.Finish()
+		pollPrefixes(ctx, rps.Name(), options.RefreshInterval, rps.fetchPrefixes, rps.prefixes, notify, span.Logger())
+	})
+	return rps
+}
+
+// parseRestTemplates returns URLs of the URL templates executed with params and parsed prefix JSONPath template
+func parseRestTemplates(urlTemplates []string, params map[string]string, prefixPath string) ([]string, *jsonpath.JSONPath, error) {
+	urls := make([]string, 0, len(urlTemplates))
+	for _, urlTemplate := range urlTemplates {
+		parsed, err := template.New("url").Option("missingkey=error").Parse(urlTemplate)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to parse URL template %q", urlTemplate)
+		}
+		buffer := &bytes.Buffer{}
+		if err = parsed.Execute(buffer, params); err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to execute URL template %q", urlTemplate)
+		}
+		urls = append(urls, buffer.String())
+	}
+
+	path := jsonpath.New("prefixes").AllowMissingKeys(true)
+	if err := path.Parse(prefixPath); err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to parse prefix JSONPath %q", prefixPath)
+	}
+	return urls, path, nil
+}
+
+// Prefixes returns prefixes from source
+func (rps *RestPrefixSource) Prefixes() []string {
+	return rps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (rps *RestPrefixSource) Name() string {
+	return "rest"
+}
+
+// Scope returns scope of the source prefixes
+func (rps *RestPrefixSource) Scope() string {
+	return prefixcollector.ExternalScope
+}
+
+// fetchPrefixes fetches prefixes of all the URLs
+func (rps *RestPrefixSource) fetchPrefixes(ctx context.Context) ([]string, error) {
+	if rps.parseErr != nil {
+		return nil, rps.parseErr
+	}
+
+	header := http.Header{}
+	if rps.options.AuthHeader != "" {
+		value, err := readSecret(ctx, rps.options.AuthValuePath)
+		if err != nil {
+			return nil, err
+		}
+		header.Set(rps.options.AuthHeader, value)
+	}
+
+	prefixes := []string{}
+	for _, url := range rps.urls {
+		var response interface{}
+		if err := getJSON(ctx, rps.client, url, header, &response); err != nil {
+			return nil, err
+		}
+		buffer := &bytes.Buffer{}
+		if err := rps.path.Execute(buffer, response); err != nil {
+			return nil, errors.Wrapf(err, "Failed to extract prefixes of %s", url)
+		}
+		prefixes = append(prefixes, strings.FieldsFunc(buffer.String(), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+	return prefixes, nil
+}
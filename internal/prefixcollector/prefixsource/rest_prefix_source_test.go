@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+func TestRestPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	g.Expect(ioutil.WriteFile(tokenPath, []byte("secret"), 0600)).To(Succeed())
+
+	// phpIPAM subnets response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("token") != "secret" || r.URL.Path != "/api/nsm/subnets/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"code": 200, "data": [
+			{"id": "1", "subnet": "10.10.0.0", "mask": "16"},
+			{"id": "2", "subnet": "fd00::", "mask": "64"}
+		]}`)
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewRestPrefixSource(ctx, notify, &prefixsource.RestOptions{
+		URLTemplates:    []string{server.URL + "/api/{{.app}}/subnets/"},
+		Params:          map[string]string{"app": "nsm"},
+		PrefixPath:      `{range .data[*]}{.subnet}/{.mask}{"\n"}{end}`,
+		AuthHeader:      "token",
+		AuthValuePath:   tokenPath,
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.10.0.0/16", "fd00::/64"}))
+}
+
+func TestRestPrefixSourceResync(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"prefixes": ["10.%d.0.0/16"]}`, atomic.AddInt32(&requests, 1))
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	signal := utils.NewResyncSignal()
+	ctx, cancel := context.WithCancel(prefixcollector.WithResyncSignal(context.Background(), signal))
+	defer cancel()
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewRestPrefixSource(ctx, notify, &prefixsource.RestOptions{
+		URLTemplates:    []string{server.URL},
+		PrefixPath:      `{.prefixes[*]}`,
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.1.0.0/16"}))
+
+	signal.Trigger()
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.2.0.0/16"}))
+}
+
+func TestRestPrefixSourceSecretRotation(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	g.Expect(ioutil.WriteFile(tokenPath, []byte("revoked"), 0600)).To(Succeed())
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("token") != "rotated" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"prefixes": ["10.%d.0.0/16"]}`, atomic.AddInt32(&requests, 1))
+	}))
+	defer server.Close()
+	client := server.Client()
+	defer client.CloseIdleConnections()
+
+	signal := utils.NewResyncSignal()
+	ctx, cancel := context.WithCancel(prefixcollector.WithReauthSignal(context.Background(), signal))
+	defer cancel()
+	ctx = prefixcollector.WithSecretsCheckInterval(ctx, 10*time.Millisecond)
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewRestPrefixSource(ctx, notify, &prefixsource.RestOptions{
+		URLTemplates:    []string{server.URL},
+		PrefixPath:      `{.prefixes[*]}`,
+		AuthHeader:      "token",
+		AuthValuePath:   tokenPath,
+		RefreshInterval: time.Hour,
+		Client:          client,
+	})
+
+	// rotated secret is used right away instead of waiting for the refresh interval
+	g.Expect(ioutil.WriteFile(tokenPath, []byte("rotated"), 0600)).To(Succeed())
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.1.0.0/16"}))
+
+	signal.Trigger()
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.2.0.0/16"}))
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	routerAdvertisementHeaderLen = 16
+	prefixInformationOption      = 3
+	prefixInformationLen         = 32
+	onLinkFlag                   = 0x80
+	// expiryCheckInterval is interval of advertised prefixes lifetime checks
+	expiryCheckInterval        = time.Minute
+	routerSolicitationHopLimit = 255
+)
+
+// advertisedPrefix is on-link prefix of router advertisement prefix information option
+type advertisedPrefix struct {
+	prefix        string
+	validLifetime time.Duration
+}
+
+// RouterAdvertisementPrefixSource is excluded prefix source of on-link prefixes advertised by IPv6 routers
+// of the node networks. Prefixes are excluded until their valid lifetime expires.
+// It requires hostNetwork and NET_RAW capability.
+type RouterAdvertisementPrefixSource struct {
+	ctx      context.Context
+	notify   *utils.EventBus
+	prefixes *utils.SynchronizedPrefixesContainer
+	// expiry is expiration time of the advertised prefixes, zero time is infinite lifetime
+	expiry map[string]time.Time
+}
+
+// NewRouterAdvertisementPrefixSource creates RouterAdvertisementPrefixSource
+func NewRouterAdvertisementPrefixSource(ctx context.Context, notify *utils.EventBus) *RouterAdvertisementPrefixSource {
+	raps := &RouterAdvertisementPrefixSource{
+		ctx:      ctx,
+		notify:   notify,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+		expiry:   map[string]time.Time{},
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(raps.Name(), raps.listen)
+	return raps
+}
+
+// Prefixes returns prefixes from source
+func (raps *RouterAdvertisementPrefixSource) Prefixes() []string {
+	return raps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (raps *RouterAdvertisementPrefixSource) Name() string {
+	return "router-advertisement"
+}
+
+func (raps *RouterAdvertisementPrefixSource) listen() {
+	span := spanhelper.FromContext(raps.ctx, "Listen IPv6 router advertisements")
+	defer span.Finish()
+	logger := span.Logger()
+
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		logger.Errorf("Failed to listen ICMPv6: %v", err)
+		return
+	}
+	go func() {
+		<-raps.ctx.Done()
+		_ = conn.Close()
+	}()
+
+	filter := &ipv6.ICMPFilter{}
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterAdvertisement)
+	if err = conn.IPv6PacketConn().SetICMPFilter(filter); err != nil {
+		logger.Warnf("Failed to set ICMPv6 filter: %v", err)
+	}
+	solicitRouters(conn, logger)
+
+	buffer := make([]byte, math.MaxUint16)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(expiryCheckInterval))
+		n, _, err := conn.ReadFrom(buffer)
+		if raps.ctx.Err() != nil {
+			return
+		}
+		var advertised []advertisedPrefix
+		if err == nil {
+			if advertised, err = parseRouterAdvertisement(buffer[:n]); err != nil {
+				logger.Debugf("Skipping ICMPv6 message: %v", err)
+			} else {
+				prefixcollector.RefreshTimes(raps.ctx).Touch(raps.Name())
+			}
+		} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			logger.Errorf("Failed to read ICMPv6: %v", err)
+			return
+		}
+		raps.update(advertised, time.Now())
+	}
+}
+
+// update applies advertised prefixes lifetimes and removes expired prefixes
+func (raps *RouterAdvertisementPrefixSource) update(advertised []advertisedPrefix, now time.Time) {
+	for _, a := range advertised {
+		switch a.validLifetime {
+		case 0:
+			delete(raps.expiry, a.prefix)
+		case math.MaxUint32 * time.Second:
+			raps.expiry[a.prefix] = time.Time{}
+		default:
+			raps.expiry[a.prefix] = now.Add(a.validLifetime)
+		}
+	}
+
+	prefixes := make([]string, 0, len(raps.expiry))
+	for prefix, expiry := range raps.expiry {
+		if !expiry.IsZero() && !now.Before(expiry) {
+			delete(raps.expiry, prefix)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	if !utils.UnorderedSlicesEquals(prefixes, raps.prefixes.Load()) {
+		raps.prefixes.Store(prefixes)
+		raps.notify.Notify()
+	}
+}
+
+// solicitRouters sends router solicitation to all routers multicast address of every IPv6 interface,
+// so routers advertise prefixes without waiting for the periodic advertisement
+func solicitRouters(conn *icmp.PacketConn, logger logrus.FieldLogger) {
+	message, err := (&icmp.Message{
+		Type: ipv6.ICMPTypeRouterSolicitation,
+		Body: &icmp.RawBody{Data: make([]byte, 4)},
+	}).Marshal(nil)
+	if err != nil {
+		logger.Warnf("Failed to marshal router solicitation: %v", err)
+		return
+	}
+	if err = conn.IPv6PacketConn().SetMulticastHopLimit(routerSolicitationHopLimit); err != nil {
+		logger.Warnf("Failed to set router solicitation hop limit: %v", err)
+		return
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		logger.Warnf("Failed to list network interfaces: %v", err)
+		return
+	}
+	for i := range interfaces {
+		if interfaces[i].Flags&net.FlagUp == 0 || interfaces[i].Flags&net.FlagMulticast == 0 ||
+			interfaces[i].Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		destination := &net.IPAddr{IP: net.ParseIP("ff02::2"), Zone: interfaces[i].Name}
+		if _, err = conn.WriteTo(message, destination); err != nil {
+			logger.Debugf("Failed to solicit routers on %s: %v", interfaces[i].Name, err)
+		}
+	}
+}
+
+// parseRouterAdvertisement returns on-link prefixes of ICMPv6 router advertisement message
+func parseRouterAdvertisement(message []byte) ([]advertisedPrefix, error) {
+	if len(message) < routerAdvertisementHeaderLen || message[0] != byte(ipv6.ICMPTypeRouterAdvertisement) {
+		return nil, errors.New("Not a router advertisement")
+	}
+
+	var prefixes []advertisedPrefix
+	for options := message[routerAdvertisementHeaderLen:]; len(options) > 0; {
+		if len(options) < 2 || options[1] == 0 || len(options) < int(options[1])*8 {
+			return nil, errors.New("Malformed router advertisement option")
+		}
+		option := options[:int(options[1])*8]
+		options = options[len(option):]
+
+		if option[0] != prefixInformationOption || len(option) != prefixInformationLen || option[3]&onLinkFlag == 0 {
+			continue
+		}
+		prefixLength := int(option[2])
+		if prefixLength > net.IPv6len*8 {
+			return nil, errors.Errorf("Wrong advertised prefix length %d", prefixLength)
+		}
+		mask := net.CIDRMask(prefixLength, net.IPv6len*8)
+		prefix := &net.IPNet{IP: net.IP(option[16:32]).Mask(mask), Mask: mask}
+		prefixes = append(prefixes, advertisedPrefix{
+			prefix:        prefix.String(),
+			validLifetime: time.Duration(binary.BigEndian.Uint32(option[4:8])) * time.Second,
+		})
+	}
+	return prefixes, nil
+}
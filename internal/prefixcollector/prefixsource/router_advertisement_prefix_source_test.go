@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func prefixInformation(prefix string, flags byte, validLifetime uint32) []byte {
+	_, ipNet, _ := net.ParseCIDR(prefix)
+	ones, _ := ipNet.Mask.Size()
+	option := make([]byte, prefixInformationLen)
+	option[0], option[1], option[2], option[3] = prefixInformationOption, prefixInformationLen/8, byte(ones), flags
+	binary.BigEndian.PutUint32(option[4:8], validLifetime)
+	copy(option[16:], ipNet.IP)
+	return option
+}
+
+func TestParseRouterAdvertisement(t *testing.T) {
+	g := NewWithT(t)
+
+	message := make([]byte, routerAdvertisementHeaderLen)
+	message[0] = 134
+	// source link-layer address option
+	message = append(message, 1, 1, 0, 1, 2, 3, 4, 5)
+	message = append(message, prefixInformation("2001:db8:1::/64", onLinkFlag|0x40, 3600)...)
+	message = append(message, prefixInformation("2001:db8:2::/64", 0x40, 3600)...)
+
+	prefixes, err := parseRouterAdvertisement(message)
+	g.Expect(err).To(BeNil())
+	g.Expect(prefixes).To(Equal([]advertisedPrefix{{prefix: "2001:db8:1::/64", validLifetime: time.Hour}}))
+
+	_, err = parseRouterAdvertisement(message[:routerAdvertisementHeaderLen+3])
+	g.Expect(err).NotTo(BeNil())
+}
+
+func TestRouterAdvertisementPrefixesExpiry(t *testing.T) {
+	g := NewWithT(t)
+
+	notify := utils.NewEventBus()
+	source := &RouterAdvertisementPrefixSource{
+		notify:   notify,
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+		expiry:   map[string]time.Time{},
+	}
+
+	now := time.Now()
+	source.update([]advertisedPrefix{
+		{prefix: "2001:db8:1::/64", validLifetime: time.Hour},
+		{prefix: "2001:db8:2::/64", validLifetime: 0xffffffff * time.Second},
+	}, now)
+	g.Expect(notify.Events()).To(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"2001:db8:1::/64", "2001:db8:2::/64"}))
+
+	source.update(nil, now.Add(time.Hour))
+	g.Expect(notify.Events()).To(Receive())
+	g.Expect(source.Prefixes()).To(Equal([]string{"2001:db8:2::/64"}))
+
+	source.update([]advertisedPrefix{{prefix: "2001:db8:2::/64"}}, now.Add(time.Hour))
+	g.Expect(notify.Events()).To(Receive())
+	g.Expect(source.Prefixes()).To(BeEmpty())
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"time"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ScheduledPrefixSource is excluded prefix source of static prefixes active within their schedule,
+// so exclusions of planned network migrations can be staged in advance and activated at cutover time
+type ScheduledPrefixSource struct {
+	ctx       context.Context
+	notify    *utils.EventBus
+	scheduled []prefixcollector.ScheduledPrefix
+	prefixes  *utils.SynchronizedPrefixesContainer
+}
+
+// NewScheduledPrefixSource creates ScheduledPrefixSource
+func NewScheduledPrefixSource(ctx context.Context, notify *utils.EventBus,
+	scheduled []prefixcollector.ScheduledPrefix) *ScheduledPrefixSource {
+	sps := &ScheduledPrefixSource{
+		ctx:       ctx,
+		notify:    notify,
+		scheduled: scheduled,
+		prefixes:  utils.NewSynchronizedPrefixesContainer(),
+	}
+	sps.prefixes.Store(sps.activePrefixes(time.Now()))
+
+	prefixcollector.Lifecycle(ctx).Go(sps.Name(), sps.schedule)
+	return sps
+}
+
+// Prefixes returns prefixes from source
+func (sps *ScheduledPrefixSource) Prefixes() []string {
+	return sps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (sps *ScheduledPrefixSource) Name() string {
+	return "scheduled"
+}
+
+// PrefixesExpiry returns end times of the scheduled prefixes active now, prefixes also active without end
+// don't expire
+func (sps *ScheduledPrefixSource) PrefixesExpiry() map[string]time.Time {
+	now := time.Now()
+	expiry := map[string]time.Time{}
+	unbounded := map[string]bool{}
+	for i := range sps.scheduled {
+		scheduled := &sps.scheduled[i]
+		switch {
+		case !scheduled.Active(now):
+		case scheduled.End.IsZero():
+			unbounded[scheduled.Prefix] = true
+		case expiry[scheduled.Prefix].IsZero() || scheduled.End.After(expiry[scheduled.Prefix]):
+			// overlapping schedules of the prefix keep it excluded until the latest of them ends
+			expiry[scheduled.Prefix] = scheduled.End
+		}
+	}
+	for prefix := range unbounded {
+		delete(expiry, prefix)
+	}
+	return expiry
+}
+
+// schedule updates prefixes at every start and end of the schedules until ctx is done
+func (sps *ScheduledPrefixSource) schedule() {
+	span := spanhelper.FromContext(sps.ctx, "Schedule excluded prefixes")
+	defer span.Finish()
+	logger := span.Logger()
+
+	for {
+		next, ok := sps.nextChange(time.Now())
+		if !ok {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-sps.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		prefixes := sps.activePrefixes(time.Now())
+		if !utils.UnorderedSlicesEquals(prefixes, sps.prefixes.Load()) {
+			sps.prefixes.Store(prefixes)
+			sps.notify.Notify()
+			logger.Infof("Scheduled prefixes changed, active prefixes: %v", prefixes)
+		}
+	}
+}
+
+// activePrefixes returns prefixes active at now
+func (sps *ScheduledPrefixSource) activePrefixes(now time.Time) []string {
+	var prefixes []string
+	for i := range sps.scheduled {
+		if sps.scheduled[i].Active(now) {
+			prefixes = append(prefixes, sps.scheduled[i].Prefix)
+		}
+	}
+	return prefixes
+}
+
+// nextChange returns the earliest start or end of the schedules after now, false if there is none
+func (sps *ScheduledPrefixSource) nextChange(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for i := range sps.scheduled {
+		for _, change := range []time.Time{sps.scheduled[i].Start, sps.scheduled[i].End} {
+			if change.After(now) && (next.IsZero() || change.Before(next)) {
+				next = change
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
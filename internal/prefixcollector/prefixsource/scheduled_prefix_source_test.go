@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+func TestScheduledPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	cutover := now.Add(100 * time.Millisecond)
+	notify := utils.NewEventBus()
+	source := prefixsource.NewScheduledPrefixSource(ctx, notify, []prefixcollector.ScheduledPrefix{
+		{Prefix: "10.0.0.0/16"},
+		{Prefix: "10.1.0.0/16", End: cutover},
+		{Prefix: "10.2.0.0/16", Start: cutover},
+		{Prefix: "10.3.0.0/16", Start: now.Add(-time.Hour), End: now.Add(-time.Minute)},
+	})
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.0.0.0/16", "10.1.0.0/16"}))
+	g.Expect(source.PrefixesExpiry()).To(Equal(map[string]time.Time{"10.1.0.0/16": cutover}))
+
+	g.Eventually(notify.Events(), time.Second).Should(Receive())
+	g.Expect(time.Now()).NotTo(BeTemporally("<", cutover))
+	g.Expect(source.Prefixes()).To(Equal([]string{"10.0.0.0/16", "10.2.0.0/16"}))
+	g.Expect(source.PrefixesExpiry()).To(BeEmpty())
+}
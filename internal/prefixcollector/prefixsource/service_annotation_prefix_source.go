@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+// ServiceCIDRsAnnotation is opt-in service annotation listing CIDRs excluded for the workloads of the service,
+// they are separated by commas or whitespaces or are JSON array
+const ServiceCIDRsAnnotation = "exclude-prefixes.nsm.io/cidrs"
+
+// ServiceResource is Kubernetes Service resource
+var ServiceResource = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+
+// ServiceAnnotationPrefixSource is excluded prefix source of ServiceCIDRsAnnotation of the services of all
+// the namespaces, so application teams declare exclusions next to the workloads needing them
+type ServiceAnnotationPrefixSource struct {
+	prefixes *utils.SynchronizedPrefixesContainer
+}
+
+// NewServiceAnnotationPrefixSource creates ServiceAnnotationPrefixSource
+func NewServiceAnnotationPrefixSource(ctx context.Context, notify *utils.EventBus) *ServiceAnnotationPrefixSource {
+	saps := &ServiceAnnotationPrefixSource{
+		prefixes: utils.NewSynchronizedPrefixesContainer(),
+	}
+
+	prefixcollector.Lifecycle(ctx).Go(saps.Name(), func() {
+		saps.watch(ctx, notify)
+	})
+	return saps
+}
+
+// Prefixes returns prefixes from source
+func (saps *ServiceAnnotationPrefixSource) Prefixes() []string {
+	return saps.prefixes.Load()
+}
+
+// Name returns name of the source
+func (saps *ServiceAnnotationPrefixSource) Name() string {
+	return "service-annotations"
+}
+
+func (saps *ServiceAnnotationPrefixSource) watch(ctx context.Context, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch services annotations")
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(ServiceResource),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               saps.Name(),
+		prefixesFunc:      serviceAnnotationPrefixes,
+		prefixes:          saps.prefixes,
+		notify:            notify,
+		logger:            span.Logger(),
+	}
+	rw.run(ctx)
+}
+
+// serviceAnnotationPrefixes returns CIDRs of the service ServiceCIDRsAnnotation, services without it have no prefixes
+func serviceAnnotationPrefixes(service *unstructured.Unstructured) ([]string, error) {
+	value, ok := service.GetAnnotations()[ServiceCIDRsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var prefixes prefixcollector.PrefixList
+	if err := prefixes.Decode(value); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
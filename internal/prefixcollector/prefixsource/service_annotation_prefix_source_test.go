@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func annotatedService(namespace, name, cidrs string) *unstructured.Unstructured {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+	}}
+	if cidrs != "" {
+		service.SetAnnotations(map[string]string{prefixsource.ServiceCIDRsAnnotation: cidrs})
+	}
+	return service
+}
+
+func TestServiceAnnotationPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		annotatedService("team-a", "database", "10.10.0.0/16, 10.11.0.0/16"),
+		annotatedService("team-b", "cache", `["fd00:20::/64", "invalid"]`),
+		annotatedService("team-b", "frontend", ""),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	source := prefixsource.NewServiceAnnotationPrefixSource(ctx, utils.NewEventBus())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.10.0.0/16", "10.11.0.0/16", "fd00:20::/64",
+	}))
+
+	services := client.Resource(prefixsource.ServiceResource)
+	_, err := services.Namespace("team-a").Update(ctx, annotatedService("team-a", "database", ""), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	_, err = services.Namespace("team-b").Update(ctx,
+		annotatedService("team-b", "frontend", "10.20.0.0/16"), metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.20.0.0/16", "fd00:20::/64"}))
+
+	err = services.Namespace("team-b").Delete(ctx, "cache", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{"10.20.0.0/16"}))
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+var (
+	// SriovNetworkResource is SR-IOV network operator SriovNetwork custom resource
+	SriovNetworkResource = schema.GroupVersionResource{
+		Group: "sriovnetwork.openshift.io", Version: "v1", Resource: "sriovnetworks",
+	}
+	// SriovIBNetworkResource is SR-IOV network operator SriovIBNetwork custom resource
+	SriovIBNetworkResource = schema.GroupVersionResource{
+		Group: "sriovnetwork.openshift.io", Version: "v1", Resource: "sriovibnetworks",
+	}
+)
+
+// SriovNetworkPrefixSource is excluded prefix source of SR-IOV secondary networks. Subnets of SriovNetwork and
+// SriovIBNetwork IPAM configurations are excluded. SriovNetworkNodePolicy resources only select devices
+// and don't define addresses, so they aren't watched.
+type SriovNetworkPrefixSource struct {
+	namespace string
+	// prefixes are prefixes of the networks by custom resource
+	prefixes map[schema.GroupVersionResource]*utils.SynchronizedPrefixesContainer
+}
+
+// NewSriovNetworkPrefixSource creates SriovNetworkPrefixSource watching networks of the namespace,
+// usually the SR-IOV network operator one
+func NewSriovNetworkPrefixSource(ctx context.Context, notify *utils.EventBus, namespace string) *SriovNetworkPrefixSource {
+	snps := &SriovNetworkPrefixSource{
+		namespace: namespace,
+		prefixes: map[schema.GroupVersionResource]*utils.SynchronizedPrefixesContainer{
+			SriovNetworkResource:   utils.NewSynchronizedPrefixesContainer(),
+			SriovIBNetworkResource: utils.NewSynchronizedPrefixesContainer(),
+		},
+	}
+
+	for resource, prefixes := range snps.prefixes {
+		resource, prefixes := resource, prefixes
+		prefixcollector.Lifecycle(ctx).Go(snps.Name()+"/"+resource.Resource, func() {
+			snps.watch(ctx, resource, prefixes, notify)
+		})
+	}
+	return snps
+}
+
+// Prefixes returns prefixes from source
+func (snps *SriovNetworkPrefixSource) Prefixes() []string {
+	var prefixes []string
+	for _, resourcePrefixes := range snps.prefixes {
+		prefixes = append(prefixes, resourcePrefixes.Load()...)
+	}
+	return prefixes
+}
+
+// Name returns name of the source
+func (snps *SriovNetworkPrefixSource) Name() string {
+	return "sriov"
+}
+
+func (snps *SriovNetworkPrefixSource) watch(ctx context.Context, resource schema.GroupVersionResource,
+	prefixes *utils.SynchronizedPrefixesContainer, notify *utils.EventBus) {
+	span := spanhelper.FromContext(ctx, "Watch "+resource.Resource)
+	defer span.Finish()
+
+	rw := &resourceWatch{
+		resourceInterface: prefixcollector.DynamicInterface(ctx).Resource(resource).Namespace(snps.namespace),
+		versions:          prefixcollector.ResourceVersions(ctx),
+		key:               resource.Resource + "/" + snps.namespace,
+		prefixesFunc:      sriovNetworkPrefixes,
+		prefixes:          prefixes,
+		notify:            notify,
+		logger:            span.Logger(),
+	}
+	rw.run(ctx)
+}
+
+// sriovNetworkPrefixes returns subnets of SR-IOV network spec.ipam CNI IPAM configuration
+func sriovNetworkPrefixes(network *unstructured.Unstructured) ([]string, error) {
+	ipam, _, err := unstructured.NestedString(network.Object, "spec", "ipam")
+	if err != nil {
+		return nil, err
+	}
+	return cniIPAMPrefixes(ipam)
+}
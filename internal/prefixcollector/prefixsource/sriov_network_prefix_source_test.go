@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixsource_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+const sriovNamespace = "sriov-network-operator"
+
+func sriovNetwork(kind, name, ipam string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sriovnetwork.openshift.io/v1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": sriovNamespace},
+		"spec":       map[string]interface{}{"resourceName": "intelnics", "ipam": ipam},
+	}}
+}
+
+func sortedPrefixes(source prefixcollector.PrefixSource) func() []string {
+	return func() []string {
+		prefixes := append([]string(nil), source.Prefixes()...)
+		sort.Strings(prefixes)
+		return prefixes
+	}
+}
+
+func TestSriovNetworkPrefixSource(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	g := NewWithT(t)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		sriovNetwork("SriovNetwork", "host-local",
+			`{"type": "host-local", "ranges": [[{"subnet": "10.56.217.0/24"}], [{"subnet": "fd00:56::/64"}]]}`),
+		sriovNetwork("SriovNetwork", "no-ipam", ""),
+		sriovNetwork("SriovNetwork", "broken", "{"),
+		sriovNetwork("SriovIBNetwork", "whereabouts",
+			`{"type": "whereabouts", "range": "192.168.2.225-192.168.2.230/28"}`),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = prefixcollector.WithDynamicInterface(ctx, client)
+
+	notify := utils.NewEventBus()
+	source := prefixsource.NewSriovNetworkPrefixSource(ctx, notify, sriovNamespace)
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.56.217.0/24", "192.168.2.224/28", "fd00:56::/64",
+	}))
+
+	_, err := client.Resource(prefixsource.SriovNetworkResource).Namespace(sriovNamespace).Create(ctx,
+		sriovNetwork("SriovNetwork", "static", `{"type": "static", "addresses": [{"address": "10.70.0.5/16"}]}`),
+		metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	err = client.Resource(prefixsource.SriovIBNetworkResource).Namespace(sriovNamespace).Delete(ctx,
+		"whereabouts", metav1.DeleteOptions{})
+	g.Expect(err).To(BeNil())
+
+	g.Eventually(sortedPrefixes(source), time.Second).Should(Equal([]string{
+		"10.56.217.0/24", "10.70.0.0/16", "fd00:56::/64",
+	}))
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// wellKnownPresets are well-known address ranges by preset names, so whole classes are excluded with one setting
+var wellKnownPresets = map[string][]string{
+	// rfc1918 are IPv4 private networks
+	"rfc1918": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+	// cgnat is RFC 6598 shared address space of carrier-grade NAT, also used by Tailscale
+	"cgnat": {"100.64.0.0/10"},
+	// ula are RFC 4193 IPv6 unique local addresses
+	"ula":        {"fc00::/7"},
+	"link-local": {"169.254.0.0/16", "fe80::/10"},
+	"multicast":  {"224.0.0.0/4", "ff00::/8"},
+	// benchmarking are RFC 2544 and RFC 5180 ranges of network interconnect devices benchmarks
+	"benchmarking": {"198.18.0.0/15", "2001:2::/48"},
+	// documentation are RFC 5737 and RFC 3849 ranges reserved for documentation and examples
+	"documentation": {"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"},
+}
+
+// Presets returns sorted names of the well-known range presets
+func Presets() []string {
+	names := make([]string, 0, len(wellKnownPresets))
+	for name := range wellKnownPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetPrefixes returns prefixes of the well-known range presets in order, error if a preset is unknown
+func PresetPrefixes(presets []string) ([]string, error) {
+	prefixes := []string{}
+	for _, preset := range presets {
+		presetPrefixes, ok := wellKnownPresets[preset]
+		if !ok {
+			return nil, errors.Errorf("Unknown preset %q, known ones are %s", preset, strings.Join(Presets(), ", "))
+		}
+		prefixes = append(prefixes, presetPrefixes...)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PublicPrefixesWarnPolicy keeps the prefixes covering public address space and only reports them
+	PublicPrefixesWarnPolicy = "warn"
+	// PublicPrefixesBlockPolicy drops the prefixes covering public address space from the sources prefixes
+	PublicPrefixesBlockPolicy = "block"
+	// PublicPrefixesIgnorePolicy disables the check of public address space
+	PublicPrefixesIgnorePolicy = "ignore"
+)
+
+// nonPublicRanges are IANA special-purpose IPv4 ranges, IPv6 space outside of 2000::/3 global unicast and IPv6
+// documentation and benchmarking ranges. Prefixes not covered by them cover public address space.
+var nonPublicRanges = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24",
+	"224.0.0.0/4", "240.0.0.0/4",
+	"::/3", "4000::/2", "8000::/1", "2001:2::/48", "2001:db8::/32",
+}
+
+// publicPrefixesCheck flags prefixes of the sources covering public address space, which are usually typos
+// like 100.0.0.0/8 instead of 10.0.0.0/8
+type publicPrefixesCheck struct {
+	policy string
+	// allowed are prefixes of public address space, which are excluded intentionally
+	allowed []string
+	ranges  []*net.IPNet
+}
+
+// WithPublicPrefixesCheck is ExcludedPrefixCollector option, which checks that prefixes of the sources don't cover
+// public address space unless they are covered by allowed prefixes, with policy: warn, block or ignore. Flagged
+// prefixes are reported in status.
+func WithPublicPrefixesCheck(policy string, allowed []string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		if policy == PublicPrefixesIgnorePolicy {
+			return
+		}
+		check := &publicPrefixesCheck{policy: policy, allowed: allowed}
+		for _, prefix := range nonPublicRanges {
+			_, ipNet, _ := net.ParseCIDR(prefix)
+			check.ranges = append(check.ranges, ipNet)
+		}
+		collector.publicPrefixes = check
+		collector.status.PublicPrefixesChecked = true
+	}
+}
+
+// applyPublicPrefixesCheck returns the source sets with public prefixes policy applied and reports status if
+// the flagged prefixes are changed
+func (epc *ExcludedPrefixCollector) applyPublicPrefixesCheck(ctx context.Context, sets []sourceSet) []sourceSet {
+	if epc.publicPrefixes == nil {
+		return sets
+	}
+	var flagged []string
+	checked := make([]sourceSet, 0, len(sets))
+	for _, set := range sets {
+		var kept []string
+		for _, prefix := range set.prefixes {
+			if !epc.publicPrefixes.isPublic(prefix) {
+				kept = append(kept, prefix)
+				continue
+			}
+			flagged = append(flagged, set.name+": "+prefix)
+			if epc.publicPrefixes.policy != PublicPrefixesBlockPolicy {
+				kept = append(kept, prefix)
+			}
+		}
+		if len(kept) < len(set.prefixes) {
+			set.prefixes = kept
+		}
+		checked = append(checked, set)
+	}
+
+	sort.Strings(flagged)
+	if !utils.UnorderedSlicesEquals(flagged, epc.status.PublicPrefixes) {
+		epc.status.PublicPrefixes = flagged
+		if len(flagged) > 0 {
+			logrus.Warnf("Sources exclude prefixes of public address space, %s policy is applied: %v",
+				epc.publicPrefixes.policy, flagged)
+		}
+		epc.reportStatus(ctx)
+	}
+	return checked
+}
+
+// isPublic returns true if prefix covers public address space and isn't covered by allowed prefixes
+func (c *publicPrefixesCheck) isPublic(prefix string) bool {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil || utils.CoveredBy(prefix, c.allowed) {
+		return false
+	}
+	return !coveredByRanges(ipNet, c.ranges)
+}
+
+// coveredByRanges returns true if every address of ipNet belongs to one of ranges. Networks containing ranges
+// are split in halves until they are covered by single ranges or have addresses outside of all of them.
+func coveredByRanges(ipNet *net.IPNet, ranges []*net.IPNet) bool {
+	ones, bits := ipNet.Mask.Size()
+	containsRange := false
+	for _, r := range ranges {
+		if len(r.IP) != len(ipNet.IP) {
+			continue
+		}
+		rangeOnes, _ := r.Mask.Size()
+		if rangeOnes <= ones && r.Contains(ipNet.IP) {
+			return true
+		}
+		if rangeOnes > ones && ipNet.Contains(r.IP) {
+			containsRange = true
+		}
+	}
+	if !containsRange {
+		return false
+	}
+
+	mask := net.CIDRMask(ones+1, bits)
+	lower := &net.IPNet{IP: append(net.IP(nil), ipNet.IP...), Mask: mask}
+	upper := &net.IPNet{IP: append(net.IP(nil), ipNet.IP...), Mask: mask}
+	upper.IP[ones/8] |= 0x80 >> (ones % 8)
+	return coveredByRanges(lower, ranges) && coveredByRanges(upper, ranges)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestPublicPrefixesPolicies(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, testCase := range []struct {
+		policy   string
+		allowed  []string
+		expected []string
+	}{
+		{
+			policy:   prefixcollector.PublicPrefixesWarnPolicy,
+			expected: []string{"10.96.0.0/12", "100.0.0.0/8", "203.0.113.0/24", "224.0.0.0/3", "2001:db8::/32", "2a01:4f8::/32"},
+		},
+		{
+			policy:   prefixcollector.PublicPrefixesBlockPolicy,
+			expected: []string{"10.96.0.0/12", "203.0.113.0/24", "224.0.0.0/3", "2001:db8::/32"},
+		},
+		{
+			policy:   prefixcollector.PublicPrefixesBlockPolicy,
+			allowed:  []string{"2a01:4f8::/29"},
+			expected: []string{"10.96.0.0/12", "203.0.113.0/24", "224.0.0.0/3", "2001:db8::/32", "2a01:4f8::/32"},
+		},
+	} {
+		t.Run(testCase.policy, func(t *testing.T) {
+			prefixes := collectOnce(t,
+				prefixcollector.WithSources(
+					&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12", "100.0.0.0/8"}},
+					&namedPrefixSource{name: "netbox", prefixes: []string{
+						"203.0.113.0/24", "224.0.0.0/3", "2001:db8::/32", "2a01:4f8::/32",
+					}},
+				),
+				prefixcollector.WithPublicPrefixesCheck(testCase.policy, testCase.allowed),
+			)
+			require.Equal(t, testCase.expected, prefixes)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"bufio"
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// NATSPublisherScheme is URL scheme of NATS server the prefixes changes are published to
+	NATSPublisherScheme = "nats"
+	// KafkaPublisherScheme is URL scheme prefix of Kafka REST proxy the prefixes changes are published with,
+	// e.g. kafka+https://kafka-rest:8082
+	KafkaPublisherScheme = "kafka+"
+
+	kafkaRecordsContentType = "application/vnd.kafka.json.v2+json"
+	kafkaRecordKey          = "excluded-prefixes"
+	publishTimeout          = 10 * time.Second
+)
+
+// PublishedPrefixes is message published on every prefixes change with the full set of prefixes after it
+type PublishedPrefixes struct {
+	PrefixesChange
+	Prefixes []string `json:"prefixes"`
+	Hash     string   `json:"hash"`
+}
+
+// Publisher publishes messages to a message bus subject or topic
+type Publisher interface {
+	Publish(ctx context.Context, data []byte) error
+}
+
+// WithPublisher is ExcludedPrefixCollector option, which publishes every prefixes change as JSON PublishedPrefixes.
+// Changes are published by goroutine of the context Lifecycle, so a slow message bus doesn't delay the output
+// updates. Changes made while the previous one is being published are coalesced into one with the latest prefixes.
+func WithPublisher(publisher Publisher) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		changes := &changePublisher{publisher: publisher, prefixes: prefixSet{}, ready: make(chan struct{}, 1)}
+		collector.changeHandlers = append(collector.changeHandlers, changes.handle)
+	}
+}
+
+// changePublisher keeps the latest not yet published change for the goroutine publishing them
+type changePublisher struct {
+	publisher Publisher
+	// prefixes are prefixes after the latest handled change
+	prefixes prefixSet
+	start    sync.Once
+	ready    chan struct{}
+
+	mutex   sync.Mutex
+	pending *PrefixesChange
+	latest  []string
+}
+
+// handle coalesces change with the pending one and wakes up the publishing goroutine, which is started
+// on the first change
+func (p *changePublisher) handle(ctx context.Context, change *PrefixesChange) {
+	p.start.Do(func() {
+		Lifecycle(ctx).Go("prefixes publisher", func() { p.run(ctx) })
+	})
+	p.prefixes.apply(change)
+
+	p.mutex.Lock()
+	if p.pending == nil {
+		p.pending = &PrefixesChange{}
+	}
+	p.pending.Timestamp = change.Timestamp
+	p.pending.Sources = append(p.pending.Sources, change.Sources...)
+	p.latest = p.prefixes.sorted()
+	p.mutex.Unlock()
+
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the pending changes until ctx is done. Added and removed prefixes of the coalesced change
+// are the difference between the latest and the last published prefixes.
+func (p *changePublisher) run(ctx context.Context) {
+	var published []string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.ready:
+		}
+
+		p.mutex.Lock()
+		change, prefixes := p.pending, p.latest
+		p.pending = nil
+		p.mutex.Unlock()
+		if change == nil {
+			continue
+		}
+		change.Added = utils.Difference(prefixes, published)
+		change.Removed = utils.Difference(published, prefixes)
+		publishChange(ctx, p.publisher, change, prefixes)
+		published = prefixes
+	}
+}
+
+// publishChange publishes change with the prefixes after it
+func publishChange(ctx context.Context, publisher Publisher, change *PrefixesChange, prefixes []string) {
+	span := spanhelper.FromContext(ctx, "Publish excluded prefixes change")
+	defer span.Finish()
+
+	data, err := json.Marshal(&PublishedPrefixes{PrefixesChange: *change, Prefixes: prefixes, Hash: PrefixesHash(prefixes)})
+	if err != nil {
+		span.Logger().Errorf("Can not marshal prefixes change: %v", err)
+		return
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	if err := publisher.Publish(publishCtx, data); err != nil {
+		span.Logger().Errorf("Failed to publish prefixes change: %v", err)
+	}
+}
+
+// NewPublisher creates Publisher of topic at rawURL: NATS subject of nats://host:port server or Kafka topic of
+// kafka+http(s)://host:port REST proxy. Kafka REST proxy is requested with client, TLS connections to NATS
+// server use tlsConfig.
+func NewPublisher(rawURL, topic string, client *http.Client, tlsConfig *tls.Config) (Publisher, error) {
+	publisherURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Wrong publisher URL %q", rawURL)
+	}
+	switch {
+	case topic == "" || strings.ContainsAny(topic, " \t\r\n"):
+		return nil, errors.Errorf("Publisher topic %q should be non-empty and contain no whitespace", topic)
+	case publisherURL.Scheme == NATSPublisherScheme && publisherURL.Host != "":
+		return &natsPublisher{server: publisherURL, subject: topic, tlsConfig: tlsConfig}, nil
+	case strings.HasPrefix(publisherURL.Scheme, KafkaPublisherScheme) && publisherURL.Host != "":
+		proxyURL := *publisherURL
+		proxyURL.Scheme = strings.TrimPrefix(publisherURL.Scheme, KafkaPublisherScheme)
+		proxyURL.Path = strings.TrimSuffix(proxyURL.Path, "/") + "/topics/" + url.PathEscape(topic)
+		return &kafkaPublisher{client: client, topicURL: proxyURL.String()}, nil
+	default:
+		return nil, errors.Errorf("Publisher URL %q should be nats:// or kafka+http(s):// URL", rawURL)
+	}
+}
+
+// natsPublisher publishes messages to NATS subject using NATS client protocol. Connection is established
+// for every message, the changes are rare and the collector holds no connection to a server being restarted.
+type natsPublisher struct {
+	server    *url.URL
+	subject   string
+	tlsConfig *tls.Config
+}
+
+// natsInfo is the part of NATS server INFO the publisher depends on
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is NATS client CONNECT options
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"pass,omitempty"`
+}
+
+// Publish publishes data to the subject and waits for the server to process it
+func (p *natsPublisher) Publish(ctx context.Context, data []byte) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", p.server.Host)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to connect to NATS server %s", p.server.Host)
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	info := &natsInfo{}
+	if err = readNATSInfo(reader, info); err != nil {
+		return err
+	}
+	if info.TLSRequired {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if p.tlsConfig != nil {
+			tlsConfig = p.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = p.server.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect := &natsConnect{Name: "excluded-prefixes-collector"}
+	if p.server.User != nil {
+		connect.User = p.server.User.Username()
+		connect.Password, _ = p.server.User.Password()
+	}
+	options, err := json.Marshal(connect)
+	if err != nil {
+		return errors.Wrap(err, "Can not marshal NATS connect options")
+	}
+	message := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", options, p.subject, len(data), data)
+	if _, err = io.WriteString(conn, message); err != nil {
+		return errors.Wrap(err, "Failed to write to NATS server")
+	}
+	return readNATSPong(reader)
+}
+
+// readNATSInfo reads INFO the NATS server sends on connect
+func readNATSInfo(reader *bufio.Reader, info *natsInfo) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "Failed to read NATS server INFO")
+	}
+	payload := strings.TrimPrefix(strings.TrimSpace(line), "INFO ")
+	if payload == strings.TrimSpace(line) {
+		return errors.Errorf("Unexpected NATS server greeting %q", line)
+	}
+	return errors.Wrap(json.Unmarshal([]byte(payload), info), "Can not unmarshal NATS server INFO")
+}
+
+// readNATSPong reads the NATS server replies until PONG confirming the published message was processed
+func readNATSPong(reader *bufio.Reader) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return errors.Wrap(err, "Failed to read NATS server reply")
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// kafkaPublisher publishes messages to Kafka topic using Kafka REST proxy v2 API
+type kafkaPublisher struct {
+	client   *http.Client
+	topicURL string
+}
+
+// kafkaRecord is Kafka REST proxy record with JSON value
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaRecords is Kafka REST proxy produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// Publish produces data as a record of the topic. Records share the key, so the changes keep their order
+// in a single partition.
+func (p *kafkaPublisher) Publish(ctx context.Context, data []byte) error {
+	body, err := json.Marshal(&kafkaRecords{Records: []kafkaRecord{{Key: kafkaRecordKey, Value: data}}})
+	if err != nil {
+		return errors.Wrap(err, "Can not marshal Kafka records")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.topicURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create Kafka REST proxy request")
+	}
+	request.Header.Set("Content-Type", kafkaRecordsContentType)
+	request.Header.Set("Accept", kafkaRecordsContentType)
+	response, err := p.client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to request Kafka REST proxy %s", p.topicURL)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return errors.Errorf("Kafka REST proxy responded with %s: %s", response.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
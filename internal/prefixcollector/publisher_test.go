@@ -0,0 +1,225 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"bufio"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestNATSPublisher(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	published := make(chan string, 1)
+	go serveNATS(t, listener, published)
+
+	publisher, err := prefixcollector.NewPublisher("nats://"+listener.Addr().String(), "nsm.prefixes", nil, nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithPublisher(publisher),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	select {
+	case data := <-published:
+		message := &prefixcollector.PublishedPrefixes{}
+		require.NoError(t, json.Unmarshal([]byte(data), message))
+		require.Equal(t, []string{"10.96.0.0/12"}, message.Prefixes)
+		require.Equal(t, []string{"10.96.0.0/12"}, message.Added)
+		require.Equal(t, prefixcollector.PrefixesHash(message.Prefixes), message.Hash)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Prefixes change wasn't published")
+	}
+}
+
+func TestKafkaPublisher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		if request.URL.Path != "/topics/nsm-prefixes" || !strings.Contains(request.Header.Get("Content-Type"), "kafka.json") ||
+			!strings.Contains(string(body), `"value":{"prefixes":[]}`) {
+			http.Error(writer, "unexpected request", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	publisher, err := prefixcollector.NewPublisher("kafka+"+server.URL, "nsm-prefixes", server.Client(), nil)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(context.Background(), []byte(`{"prefixes":[]}`)))
+	require.Error(t, publisher.Publish(context.Background(), []byte(`{"prefixes":["10.96.0.0/12"]}`)))
+}
+
+func TestSlowPublisher(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	publisher := &blockingPublisher{published: make(chan []byte, 10), release: make(chan struct{})}
+	source := &mutablePrefixSource{prefixes: []string{"10.96.0.0/12"}}
+	bus := utils.NewEventBus()
+	written := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			written <- prefixes
+			return nil
+		}),
+		prefixcollector.WithPublisher(publisher),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	requireWritten(t, written, []string{"10.96.0.0/12"})
+	message := requirePublished(t, publisher.published)
+	require.Equal(t, []string{"10.96.0.0/12"}, message.Added)
+
+	// the output is updated while the first change is still being published
+	source.set([]string{"10.97.0.0/16"})
+	bus.Notify()
+	requireWritten(t, written, []string{"10.97.0.0/16"})
+	source.set([]string{"10.98.0.0/16"})
+	bus.Notify()
+	requireWritten(t, written, []string{"10.98.0.0/16"})
+
+	close(publisher.release)
+	message = requirePublished(t, publisher.published)
+	require.Equal(t, []string{"10.98.0.0/16"}, message.Prefixes)
+	require.Equal(t, []string{"10.98.0.0/16"}, message.Added)
+	require.Equal(t, []string{"10.96.0.0/12"}, message.Removed)
+	select {
+	case data := <-publisher.published:
+		require.FailNowf(t, "Coalesced changes were published separately", "%s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWrongPublisher(t *testing.T) {
+	for _, publisherURL := range []string{"http://localhost:8082", "nats://", "kafka+https://"} {
+		_, err := prefixcollector.NewPublisher(publisherURL, "excluded-prefixes", nil, nil)
+		require.Error(t, err, publisherURL)
+	}
+	_, err := prefixcollector.NewPublisher("nats://localhost:4222", "excluded prefixes", nil, nil)
+	require.Error(t, err)
+}
+
+// serveNATS accepts a single NATS client connection on listener and sends payload of the published message
+// to published
+func serveNATS(t *testing.T, listener net.Listener, published chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "PUB":
+			size, err := strconv.Atoi(fields[2])
+			require.NoError(t, err)
+			payload := make([]byte, size+2)
+			_, err = io.ReadFull(reader, payload)
+			require.NoError(t, err)
+			published <- string(payload[:size])
+		case len(fields) == 1 && fields[0] == "PING":
+			_, _ = conn.Write([]byte("PONG\r\n"))
+			return
+		}
+	}
+}
+
+// blockingPublisher sends the published messages to published and blocks until release is closed
+type blockingPublisher struct {
+	published chan []byte
+	release   chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, data []byte) error {
+	p.published <- data
+	select {
+	case <-p.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mutablePrefixSource is prefix source, which prefixes can be changed concurrently with the collector
+type mutablePrefixSource struct {
+	mutex    sync.Mutex
+	prefixes []string
+}
+
+func (s *mutablePrefixSource) Prefixes() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.prefixes
+}
+
+func (s *mutablePrefixSource) set(prefixes []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prefixes = prefixes
+}
+
+func requireWritten(t *testing.T, written <-chan []string, expected []string) {
+	select {
+	case prefixes := <-written:
+		require.Equal(t, expected, prefixes)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Prefixes weren't written")
+	}
+}
+
+func requirePublished(t *testing.T, published <-chan []byte) *prefixcollector.PublishedPrefixes {
+	select {
+	case data := <-published:
+		message := &prefixcollector.PublishedPrefixes{}
+		require.NoError(t, json.Unmarshal(data, message))
+		return message
+	case <-time.After(time.Second):
+		require.FailNow(t, "Prefixes change wasn't published")
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// QuotaTruncatePolicy keeps the widest prefixes of the source exceeding its quota up to the quota
+	QuotaTruncatePolicy = "truncate"
+	// QuotaAlarmPolicy keeps all the prefixes of the source exceeding its quota and only reports it
+	QuotaAlarmPolicy = "alarm"
+	// QuotaRejectPolicy keeps the last prefixes of the source within its quota while it exceeds the quota
+	QuotaRejectPolicy = "reject"
+)
+
+// sourceQuotas limits number of prefixes the sources contribute
+type sourceQuotas struct {
+	limits map[string]int
+	policy string
+	// accepted are the last prefixes of the sources within their quotas, they are used by reject policy
+	accepted map[string][]string
+}
+
+// WithSourceQuotas is ExcludedPrefixCollector option, which limits number of prefixes the sources contribute
+// by source name with overflow policy: truncate, alarm or reject. Exceeded quotas are reported in status.
+func WithSourceQuotas(limits map[string]int, policy string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		if len(limits) == 0 {
+			return
+		}
+		collector.quotas = &sourceQuotas{limits: limits, policy: policy, accepted: map[string][]string{}}
+		collector.status.QuotasChecked = true
+	}
+}
+
+// applyQuotas returns the source sets with quotas overflow policy applied and reports status if the sources
+// exceeding their quotas are changed
+func (epc *ExcludedPrefixCollector) applyQuotas(ctx context.Context, sets []sourceSet) []sourceSet {
+	if epc.quotas == nil {
+		return sets
+	}
+	var exceeded []string
+	limited := make([]sourceSet, 0, len(sets))
+	for _, set := range sets {
+		limit, ok := epc.quotas.limits[set.name]
+		if !ok || len(set.prefixes) <= limit {
+			epc.quotas.accepted[set.name] = set.prefixes
+			limited = append(limited, set)
+			continue
+		}
+		exceeded = append(exceeded, fmt.Sprintf("%s (%d/%d)", set.name, len(set.prefixes), limit))
+		switch epc.quotas.policy {
+		case QuotaAlarmPolicy:
+		case QuotaRejectPolicy:
+			set.prefixes = epc.quotas.accepted[set.name]
+		default:
+			set.prefixes = widestPrefixes(set.prefixes, limit)
+		}
+		limited = append(limited, set)
+	}
+
+	if !utils.UnorderedSlicesEquals(exceeded, epc.status.QuotaExceeded) {
+		epc.status.QuotaExceeded = exceeded
+		if len(exceeded) > 0 {
+			logrus.Errorf("Sources exceed their prefix quotas, %s policy is applied: %v", epc.quotas.policy, exceeded)
+		}
+		epc.reportStatus(ctx)
+	}
+	return limited
+}
+
+// widestPrefixes returns limit prefixes covering the most addresses, prefixes of the same size are sorted
+func widestPrefixes(prefixes []string, limit int) []string {
+	hostBits := func(prefix string) int {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return -1
+		}
+		ones, bits := ipNet.Mask.Size()
+		return bits - ones
+	}
+	sorted := append([]string(nil), prefixes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if x, y := hostBits(sorted[i]), hostBits(sorted[j]); x != y {
+			return x > y
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted[:limit]
+}
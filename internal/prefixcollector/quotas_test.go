@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestSourceQuotaPolicies(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, testCase := range []struct {
+		policy   string
+		expected []string
+	}{
+		{
+			policy:   prefixcollector.QuotaTruncatePolicy,
+			expected: []string{"10.96.0.0/12", "10.244.0.0/16", "172.16.0.0/12"},
+		},
+		{
+			policy:   prefixcollector.QuotaAlarmPolicy,
+			expected: []string{"10.96.0.0/12", "10.244.0.0/16", "10.245.1.0/24", "10.246.0.0/16", "172.16.0.0/12"},
+		},
+		{
+			policy:   prefixcollector.QuotaRejectPolicy,
+			expected: []string{"10.96.0.0/12", "10.244.0.0/16"},
+		},
+	} {
+		t.Run(testCase.policy, func(t *testing.T) {
+			prefixes := collectOnce(t,
+				prefixcollector.WithSources(
+					&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12", "10.244.0.0/16"}},
+					&namedPrefixSource{name: "netbox", prefixes: []string{"10.245.1.0/24", "172.16.0.0/12", "10.246.0.0/16"}},
+				),
+				prefixcollector.WithSourceQuotas(map[string]int{"kubeadm": 2, "netbox": 1}, testCase.policy),
+			)
+			require.Equal(t, testCase.expected, prefixes)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// OutputRecreatedReason is reason of the event reported when the deleted output config map is recreated
+const OutputRecreatedReason = "OutputRecreated"
+
+// recreateConfigMap creates the deleted output config map again with its labels, annotations and owner references
+// and writes prefixes to it. Config map recreated by somebody else is left as it is.
+func recreateConfigMap(ctx context.Context, deleted *apiV1.ConfigMap, prefixes []string,
+	configMapInterface v1.ConfigMapInterface, output *configMapOutput) error {
+	configMap, err := configMapInterface.Create(ctx, &apiV1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            deleted.Name,
+			Labels:          deleted.Labels,
+			Annotations:     deleted.Annotations,
+			OwnerReferences: deleted.OwnerReferences,
+		},
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to recreate NSM ConfigMap %s", deleted.Name)
+	}
+	if err = output.write(ctx, prefixes, configMap, configMapInterface); err != nil {
+		return errors.Wrapf(err, "Failed to write prefixes to recreated NSM ConfigMap %s", deleted.Name)
+	}
+
+	err = reportOutputEvent(ctx, deleted.Namespace, configMap, OutputRecreatedReason,
+		"Deleted NSM ConfigMap is recreated with the last excluded prefixes")
+	return errors.Wrapf(err, "Failed to report recreation of NSM ConfigMap %s", deleted.Name)
+}
+
+// reportOutputEvent reports warning event with reason and message about the output config map in namespace
+func reportOutputEvent(ctx context.Context, namespace string, configMap *apiV1.ConfigMap, reason, message string) error {
+	now := metav1.Now()
+	_, err := KubernetesInterface(ctx).CoreV1().Events(namespace).Create(ctx, &apiV1.Event{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: configMap.Name + "-"},
+		InvolvedObject: apiV1.ObjectReference{
+			Kind: "ConfigMap", APIVersion: "v1", Namespace: namespace, Name: configMap.Name, UID: configMap.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           apiV1.EventTypeWarning,
+		Source:         apiV1.EventSource{Component: "excluded-prefixes-collector"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	return err
+}
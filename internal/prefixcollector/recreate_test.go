@@ -0,0 +1,198 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDeletedOutputRecreated(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nsmConfigMapName,
+			Namespace: configMapNamespace,
+			Labels:    map[string]string{"app": "nsm"},
+		},
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	configMaps := clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	written := func() bool {
+		configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
+		return err == nil && len(prefixes) == 1 && prefixes[0] == "10.96.0.0/12" && configMap.Labels["app"] == "nsm"
+	}
+	require.Eventually(t, written, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, configMaps.Delete(ctx, nsmConfigMapName, metav1.DeleteOptions{}))
+	require.Eventually(t, written, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		events, err := clientSet.CoreV1().Events(configMapNamespace).List(ctx, metav1.ListOptions{})
+		return err == nil && len(events.Items) == 1 && events.Items[0].Reason == prefixcollector.OutputRecreatedReason
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMissingOutputCreated(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	require.Eventually(t, func() bool {
+		configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
+		return err == nil && len(prefixes) == 1 && prefixes[0] == "10.96.0.0/12"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOutputWatchResumed(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	// the first watch fails with expired resource version, the second one is closed by API server
+	watchers := []*watch.FakeWatcher{watch.NewFake(), watch.NewFake()}
+	var watches, lists int32
+	clientSet.PrependWatchReactor("configmaps", func(k8stesting.Action) (bool, watch.Interface, error) {
+		if i := atomic.AddInt32(&watches, 1) - 1; int(i) < len(watchers) {
+			return true, watchers[i], nil
+		}
+		return false, nil, nil
+	})
+	clientSet.PrependReactor("list", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&lists, 1)
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	configMaps := clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	written := func() bool {
+		configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
+		return err == nil && len(prefixes) == 1 && prefixes[0] == "10.96.0.0/12"
+	}
+	require.Eventually(t, written, time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&watches) == 1 }, time.Second, 10*time.Millisecond)
+	watchers[0].Error(&metav1.Status{Status: metav1.StatusFailure, Code: http.StatusGone, Reason: metav1.StatusReasonExpired})
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&watches) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&lists))
+
+	watchers[1].Stop()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&watches) == 3 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&lists))
+
+	require.NoError(t, configMaps.Delete(ctx, nsmConfigMapName, metav1.DeleteOptions{}))
+	require.Eventually(t, written, time.Second, 10*time.Millisecond)
+}
+
+func TestOwnWriteNotRestored(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	// updates return after the watch receives them, so it sees the write before the collector finishes it
+	updates := make(chan []string, 10)
+	clientSet.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		configMap := action.(k8stesting.UpdateAction).GetObject().(*v1.ConfigMap)
+		prefixes, err := utils.YamlToPrefixes([]byte(configMap.Data[excludedPrefixesKey]))
+		if err != nil {
+			return true, nil, err
+		}
+		handled, object, err := k8stesting.ObjectReaction(clientSet.Tracker())(action)
+		time.Sleep(50 * time.Millisecond)
+		updates <- prefixes
+		return handled, object, err
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	source.Store([]string{"10.96.0.0/12"})
+	notifyChan := make(chan struct{}, 1)
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	nextUpdate := func() []string {
+		select {
+		case prefixes := <-updates:
+			return prefixes
+		case <-time.After(time.Second):
+			require.FailNow(t, "NSM config map is not updated")
+			return nil
+		}
+	}
+	require.Equal(t, []string{"10.96.0.0/12"}, nextUpdate())
+
+	source.Store([]string{"172.16.0.0/12"})
+	notifyChan <- struct{}{}
+	require.Equal(t, []string{"172.16.0.0/12"}, nextUpdate())
+	select {
+	case prefixes := <-updates:
+		require.FailNowf(t, "Own write is restored", "%v", prefixes)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
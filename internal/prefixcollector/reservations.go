@@ -0,0 +1,433 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	authenticationV1 "k8s.io/api/authentication/v1"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// ReservationsPath is HTTP API path of prefix reservations: GET lists them, POST reserves a prefix and
+	// DELETE with prefix query parameter releases it
+	ReservationsPath = "/reservations"
+	// ReservationsKey is key of the reservations config map containing JSON array of the reservations
+	ReservationsKey = "reservations.json"
+	// DefaultReservationsConfigMapName is default name of the reservations config map
+	DefaultReservationsConfigMapName = "excluded-prefixes-reservations"
+
+	// ReservationsAPIGroup is API group of the reservations resource requesters are authorized for
+	ReservationsAPIGroup = "networkservicemesh.io"
+	// ReservationsResource is resource requesters of the reservations HTTP API are authorized for: list verb allows
+	// GET, create allows POST and delete allows DELETE of the own reservations
+	ReservationsResource = "prefixreservations"
+	// ReservationsOverrideVerb is verb of the reservations resource allowing to replace and release reservations
+	// of the other requesters
+	ReservationsOverrideVerb = "override"
+)
+
+var (
+	// ErrReservationNotFound is returned on release of the prefix without reservation
+	ErrReservationNotFound = errors.New("Prefix isn't reserved")
+	// ErrReservationNotOwned is returned on replace or release of the reservation of another requester
+	// without override permission
+	ErrReservationNotOwned = errors.New("Prefix is reserved by another requester")
+)
+
+// reservationVerbs are verbs of the reservations resource the reservations HTTP API methods require
+var reservationVerbs = map[string]string{
+	http.MethodGet:    "list",
+	http.MethodPost:   "create",
+	http.MethodDelete: "delete",
+}
+
+// Reservation is prefix excluded on request of an operator until it is released or its lease expires.
+// Reservation with zero Expires doesn't expire.
+type Reservation struct {
+	Prefix    string    `json:"prefix"`
+	Requester string    `json:"requester"`
+	Reason    string    `json:"reason,omitempty"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires,omitempty"`
+}
+
+// ReservationRequest is body of the reservation HTTP API POST request. Lease is Go duration the prefix is
+// reserved for, reservation without lease doesn't expire.
+type ReservationRequest struct {
+	Prefix string `json:"prefix"`
+	Lease  string `json:"lease,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Requester is authenticated Kubernetes user sending the reservation HTTP API request
+type Requester struct {
+	Name   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+}
+
+// RequesterFunc returns identity of the reservation HTTP API request sender
+type RequesterFunc func(request *http.Request) (*Requester, error)
+
+// AuthorizerFunc returns true if requester is allowed verb of the reservations resource
+type AuthorizerFunc func(ctx context.Context, requester *Requester, verb string) (bool, error)
+
+// ownerCheck returns nil if requester may replace or release existing reservation of another requester
+type ownerCheck func(existing *Reservation) error
+
+// Active returns true if the reservation isn't expired at now
+func (r *Reservation) Active(now time.Time) bool {
+	return r.Expires.IsZero() || now.Before(r.Expires)
+}
+
+// DecodeReservations returns reservations of the reservations config map data
+func DecodeReservations(data map[string]string) ([]Reservation, error) {
+	var reservations []Reservation
+	if strings.TrimSpace(data[ReservationsKey]) == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(data[ReservationsKey]), &reservations); err != nil {
+		return nil, errors.Wrap(err, "Can not unmarshal reservations")
+	}
+	return reservations, nil
+}
+
+// ReadReservations returns active reservations of the reservations config map, missing config map has none
+func ReadReservations(ctx context.Context, configMaps v1.ConfigMapInterface, name string) ([]Reservation, error) {
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get reservations config map %s", name)
+	}
+	reservations, err := DecodeReservations(configMap.Data)
+	return activeReservations(reservations, time.Now()), err
+}
+
+// Reserve stores reservation to the reservations config map, replacing the previous reservation of the prefix.
+// Config map is created if it is missing, expired reservations are removed from it.
+func Reserve(ctx context.Context, configMaps v1.ConfigMapInterface, name string, reservation *Reservation) error {
+	return reserve(ctx, configMaps, name, reservation, nil)
+}
+
+// reserve stores reservation like Reserve, active reservation of the prefix made by another requester is replaced
+// only if check allows it. nil check allows replacing any reservation.
+func reserve(ctx context.Context, configMaps v1.ConfigMapInterface, name string, reservation *Reservation,
+	check ownerCheck) error {
+	_, ipNet, err := net.ParseCIDR(reservation.Prefix)
+	if err != nil {
+		return errors.Wrapf(err, "Wrong reserved prefix %q", reservation.Prefix)
+	}
+	reservation.Prefix = ipNet.String()
+	return updateReservations(ctx, configMaps, name, func(reservations []Reservation) ([]Reservation, error) {
+		if err := checkOwner(reservations, reservation.Prefix, reservation.Requester, check); err != nil {
+			return nil, err
+		}
+		return append(withoutReservation(reservations, reservation.Prefix), *reservation), nil
+	})
+}
+
+// Release removes reservation of prefix from the reservations config map, returns ErrReservationNotFound
+// if there is no active reservation of prefix
+func Release(ctx context.Context, configMaps v1.ConfigMapInterface, name, prefix string) error {
+	return release(ctx, configMaps, name, prefix, "", nil)
+}
+
+// release removes reservation like Release, reservation made by another requester than releaser is removed
+// only if check allows it. nil check allows releasing any reservation.
+func release(ctx context.Context, configMaps v1.ConfigMapInterface, name, prefix, releaser string, check ownerCheck) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return errors.Wrapf(err, "Wrong released prefix %q", prefix)
+	}
+	return updateReservations(ctx, configMaps, name, func(reservations []Reservation) ([]Reservation, error) {
+		if err := checkOwner(reservations, ipNet.String(), releaser, check); err != nil {
+			return nil, err
+		}
+		remaining := withoutReservation(reservations, ipNet.String())
+		if len(remaining) == len(reservations) {
+			return nil, ErrReservationNotFound
+		}
+		return remaining, nil
+	})
+}
+
+// updateReservations replaces active reservations of the config map with the updated ones, update is retried
+// on conflicts with concurrent changes
+func updateReservations(ctx context.Context, configMaps v1.ConfigMapInterface, name string,
+	update func(reservations []Reservation) ([]Reservation, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		missing := apierrors.IsNotFound(err)
+		if missing {
+			configMap, err = &apiV1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get reservations config map %s", name)
+		}
+		reservations, err := DecodeReservations(configMap.Data)
+		if err != nil {
+			return err
+		}
+		if reservations, err = update(activeReservations(reservations, time.Now())); err != nil {
+			return err
+		}
+		sort.Slice(reservations, func(i, j int) bool { return reservations[i].Prefix < reservations[j].Prefix })
+
+		data, err := json.Marshal(reservations)
+		if err != nil {
+			return errors.Wrap(err, "Can not marshal reservations")
+		}
+		configMap.Data = map[string]string{ReservationsKey: string(data)}
+		if missing {
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+		} else {
+			_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		}
+		// conflicts are returned as they are, so they are retried
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			return apierrors.NewConflict(apiV1.Resource("configmaps"), name, err)
+		}
+		return errors.Wrapf(err, "Failed to update reservations config map %s", name)
+	})
+}
+
+// activeReservations returns reservations active at now
+func activeReservations(reservations []Reservation, now time.Time) []Reservation {
+	active := make([]Reservation, 0, len(reservations))
+	for i := range reservations {
+		if reservations[i].Active(now) {
+			active = append(active, reservations[i])
+		}
+	}
+	return active
+}
+
+// checkOwner returns error of check if reservation of prefix is made by another requester than requester
+func checkOwner(reservations []Reservation, prefix, requester string, check ownerCheck) error {
+	if check == nil {
+		return nil
+	}
+	for i := range reservations {
+		if reservations[i].Prefix == prefix && reservations[i].Requester != requester {
+			return check(&reservations[i])
+		}
+	}
+	return nil
+}
+
+// withoutReservation returns reservations except the one of prefix
+func withoutReservation(reservations []Reservation, prefix string) []Reservation {
+	remaining := make([]Reservation, 0, len(reservations))
+	for i := range reservations {
+		if reservations[i].Prefix != prefix {
+			remaining = append(remaining, reservations[i])
+		}
+	}
+	return remaining
+}
+
+// TokenReviewRequester returns RequesterFunc authenticating bearer token of the request with TokenReview,
+// requester is the Kubernetes user of the token
+func TokenReviewRequester(clientSet kubernetes.Interface) RequesterFunc {
+	return func(request *http.Request) (*Requester, error) {
+		token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == request.Header.Get("Authorization") {
+			return nil, errors.New("Bearer token is required")
+		}
+		review, err := clientSet.AuthenticationV1().TokenReviews().Create(request.Context(), &authenticationV1.TokenReview{
+			Spec: authenticationV1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to review token")
+		}
+		if !review.Status.Authenticated {
+			return nil, errors.Errorf("Token isn't authenticated: %s", review.Status.Error)
+		}
+		requester := &Requester{
+			Name:   review.Status.User.Username,
+			UID:    review.Status.User.UID,
+			Groups: review.Status.User.Groups,
+			Extra:  map[string][]string{},
+		}
+		for key, value := range review.Status.User.Extra {
+			requester.Extra[key] = value
+		}
+		return requester, nil
+	}
+}
+
+// SubjectAccessReviewAuthorizer returns AuthorizerFunc checking with SubjectAccessReview the requester is allowed
+// the verb of ReservationsAPIGroup ReservationsResource in namespace of the reservations config map
+func SubjectAccessReviewAuthorizer(clientSet kubernetes.Interface, namespace string) AuthorizerFunc {
+	return func(ctx context.Context, requester *Requester, verb string) (bool, error) {
+		extra := make(map[string]authorizationV1.ExtraValue, len(requester.Extra))
+		for key, value := range requester.Extra {
+			extra[key] = value
+		}
+		review, err := clientSet.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationV1.SubjectAccessReview{
+			Spec: authorizationV1.SubjectAccessReviewSpec{
+				User:   requester.Name,
+				UID:    requester.UID,
+				Groups: requester.Groups,
+				Extra:  extra,
+				ResourceAttributes: &authorizationV1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     ReservationsAPIGroup,
+					Resource:  ReservationsResource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "Failed to review subject access")
+		}
+		return review.Status.Allowed, nil
+	}
+}
+
+// ReservationsHandler returns HTTP handler of the prefix reservations stored in the reservations config map.
+// Requests are served over TLS only, senders are authenticated by requester and authorized by authorizer
+// for the verb of the request method. Reservations of the other requesters are replaced and released only
+// by requesters allowed ReservationsOverrideVerb. Reservations and releases are recorded with the requester name.
+func ReservationsHandler(configMaps v1.ConfigMapInterface, name string, requester RequesterFunc,
+	authorizer AuthorizerFunc) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.TLS == nil {
+			http.Error(writer, "Reservations API is served over TLS only", http.StatusForbidden)
+			return
+		}
+		verb, ok := reservationVerbs[request.Method]
+		if !ok {
+			writer.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+			http.Error(writer, "Only GET, POST and DELETE requests are supported", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, err := requester(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		allowed, err := authorizer(request.Context(), identity, verb)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(writer, errors.Errorf("%s isn't allowed to %s %s", identity.Name, verb, ReservationsResource).Error(),
+				http.StatusForbidden)
+			return
+		}
+		// the other requesters reservations are overridden only with override permission
+		check := func(existing *Reservation) error {
+			allowed, err := authorizer(request.Context(), identity, ReservationsOverrideVerb)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return ErrReservationNotOwned
+			}
+			logrus.Infof("Reservation of prefix %s made by %s is overridden by %s", existing.Prefix, existing.Requester, identity.Name)
+			return nil
+		}
+
+		switch request.Method {
+		case http.MethodGet:
+			reservations, err := ReadReservations(request.Context(), configMaps, name)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(writer, http.StatusOK, reservations)
+		case http.MethodPost:
+			reservation, err := decodeReservationRequest(request, identity.Name)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = reserve(request.Context(), configMaps, name, reservation, check)
+			switch {
+			case err == ErrReservationNotOwned:
+				http.Error(writer, err.Error(), http.StatusForbidden)
+			case err != nil:
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+			default:
+				logrus.Infof("Prefix %s is reserved by %s until %v: %s", reservation.Prefix, identity.Name, reservation.Expires, reservation.Reason)
+				writeJSON(writer, http.StatusCreated, reservation)
+			}
+		case http.MethodDelete:
+			prefix := request.URL.Query().Get("prefix")
+			err := release(request.Context(), configMaps, name, prefix, identity.Name, check)
+			switch {
+			case err == ErrReservationNotFound:
+				http.Error(writer, err.Error(), http.StatusNotFound)
+			case err == ErrReservationNotOwned:
+				http.Error(writer, err.Error(), http.StatusForbidden)
+			case err != nil:
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+			default:
+				logrus.Infof("Prefix %s reservation is released by %s", prefix, identity.Name)
+				writer.WriteHeader(http.StatusNoContent)
+			}
+		}
+	})
+}
+
+// decodeReservationRequest returns reservation of the POST request body made by requester
+func decodeReservationRequest(request *http.Request, requester string) (*Reservation, error) {
+	body := &ReservationRequest{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return nil, errors.Wrap(err, "Can not decode reservation request")
+	}
+	reservation := &Reservation{Prefix: body.Prefix, Requester: requester, Reason: body.Reason, Created: time.Now().UTC()}
+	if _, _, err := net.ParseCIDR(body.Prefix); err != nil {
+		return nil, errors.Wrapf(err, "Wrong reserved prefix %q", body.Prefix)
+	}
+	if body.Lease != "" {
+		lease, err := time.ParseDuration(body.Lease)
+		if err != nil || lease <= 0 {
+			return nil, errors.Errorf("Lease %q should be positive duration", body.Lease)
+		}
+		reservation.Expires = reservation.Created.Add(lease)
+	}
+	return reservation, nil
+}
+
+// writeJSON writes JSON encoded value with status
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const reservationsConfigMapName = "reservations"
+
+// reservationsTokens are tokens of the reservations API requesters
+var reservationsTokens = map[string]string{
+	"operator-token": "operator",
+	"team-token":     "team",
+	"viewer-token":   "viewer",
+	"admin-token":    "admin",
+}
+
+// reservationsVerbs are reservations resource verbs the requesters are allowed
+var reservationsVerbs = map[string][]string{
+	"operator": {"list", "create", "delete"},
+	"team":     {"list", "create", "delete"},
+	"viewer":   {"list"},
+	"admin":    {"list", "create", "delete", prefixcollector.ReservationsOverrideVerb},
+}
+
+func reservationsRequester(request *http.Request) (*prefixcollector.Requester, error) {
+	name, ok := reservationsTokens[strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		return nil, errors.New("Unknown token")
+	}
+	return &prefixcollector.Requester{Name: name}, nil
+}
+
+func reservationsAuthorizer(_ context.Context, requester *prefixcollector.Requester, verb string) (bool, error) {
+	for _, allowed := range reservationsVerbs[requester.Name] {
+		if allowed == verb {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func reservationsRequest(t *testing.T, client *http.Client, token, method, url, body string) *http.Response {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	return response
+}
+
+func requireReservationsStatus(t *testing.T, client *http.Client, token, method, url, body string, status int) {
+	response := reservationsRequest(t, client, token, method, url, body)
+	_ = response.Body.Close()
+	require.Equal(t, status, response.StatusCode, "%s %s by %s", method, url, token)
+}
+
+func TestReservationsHandler(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps(configMapNamespace)
+	server := httptest.NewTLSServer(prefixcollector.ReservationsHandler(configMaps, reservationsConfigMapName,
+		reservationsRequester, reservationsAuthorizer))
+	defer server.Close()
+	client := server.Client()
+	url := server.URL + prefixcollector.ReservationsPath
+
+	response, err := client.Get(url)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	requireReservationsStatus(t, client, "operator-token", http.MethodPost, url,
+		`{"prefix": "10.20.1.0/24", "lease": "1h", "reason": "migration"}`, http.StatusCreated)
+	requireReservationsStatus(t, client, "operator-token", http.MethodPost, url, `{"prefix": "10.30.0.1/16"}`, http.StatusCreated)
+	requireReservationsStatus(t, client, "operator-token", http.MethodPost, url, `{"prefix": "10.40.0.0/16", "lease": "-1h"}`,
+		http.StatusBadRequest)
+
+	response = reservationsRequest(t, client, "operator-token", http.MethodGet, url, "")
+	var reservations []prefixcollector.Reservation
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reservations))
+	_ = response.Body.Close()
+	require.Len(t, reservations, 2)
+	require.Equal(t, "10.20.1.0/24", reservations[0].Prefix)
+	require.Equal(t, "operator", reservations[0].Requester)
+	require.Equal(t, "migration", reservations[0].Reason)
+	require.WithinDuration(t, time.Now().Add(time.Hour), reservations[0].Expires, time.Minute)
+	require.Equal(t, "10.30.0.0/16", reservations[1].Prefix)
+	require.True(t, reservations[1].Expires.IsZero())
+
+	requireReservationsStatus(t, client, "operator-token", http.MethodDelete, url+"?prefix=10.20.1.0/24", "", http.StatusNoContent)
+	requireReservationsStatus(t, client, "operator-token", http.MethodDelete, url+"?prefix=10.20.1.0/24", "", http.StatusNotFound)
+
+	reservations, err = prefixcollector.ReadReservations(context.Background(), configMaps, reservationsConfigMapName)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	require.Equal(t, "10.30.0.0/16", reservations[0].Prefix)
+}
+
+func TestReservationsHandlerAuthorization(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps(configMapNamespace)
+	handler := prefixcollector.ReservationsHandler(configMaps, reservationsConfigMapName,
+		reservationsRequester, reservationsAuthorizer)
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	client := server.Client()
+	url := server.URL + prefixcollector.ReservationsPath
+
+	// requesters are allowed the verbs of the methods only
+	requireReservationsStatus(t, client, "viewer-token", http.MethodGet, url, "", http.StatusOK)
+	requireReservationsStatus(t, client, "viewer-token", http.MethodPost, url, `{"prefix": "10.20.0.0/16"}`, http.StatusForbidden)
+	requireReservationsStatus(t, client, "operator-token", http.MethodPost, url, `{"prefix": "10.20.0.0/16"}`, http.StatusCreated)
+	requireReservationsStatus(t, client, "viewer-token", http.MethodDelete, url+"?prefix=10.20.0.0/16", "", http.StatusForbidden)
+
+	// reservations of the other requesters are replaced and released with override permission only
+	requireReservationsStatus(t, client, "team-token", http.MethodPost, url, `{"prefix": "10.20.0.0/16"}`, http.StatusForbidden)
+	requireReservationsStatus(t, client, "team-token", http.MethodDelete, url+"?prefix=10.20.0.0/16", "", http.StatusForbidden)
+	reservations, err := prefixcollector.ReadReservations(context.Background(), configMaps, reservationsConfigMapName)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	require.Equal(t, "operator", reservations[0].Requester)
+	requireReservationsStatus(t, client, "admin-token", http.MethodDelete, url+"?prefix=10.20.0.0/16", "", http.StatusNoContent)
+
+	// bearer tokens aren't accepted in plain text
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+	requireReservationsStatus(t, plainServer.Client(), "operator-token", http.MethodGet,
+		plainServer.URL+prefixcollector.ReservationsPath, "", http.StatusForbidden)
+}
+
+func TestSubjectAccessReviewAuthorizer(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationV1.SubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "operator" && review.Spec.Groups[0] == "operators" &&
+			attributes.Group == prefixcollector.ReservationsAPIGroup && attributes.Resource == prefixcollector.ReservationsResource &&
+			attributes.Namespace == configMapNamespace && attributes.Verb == "create"
+		return true, review, nil
+	})
+	authorizer := prefixcollector.SubjectAccessReviewAuthorizer(clientSet, configMapNamespace)
+
+	requester := &prefixcollector.Requester{Name: "operator", Groups: []string{"operators"}}
+	allowed, err := authorizer(context.Background(), requester, "create")
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = authorizer(context.Background(), requester, prefixcollector.ReservationsOverrideVerb)
+	require.NoError(t, err)
+	require.False(t, allowed)
+}
+
+func TestReservationsExpire(t *testing.T) {
+	ctx := context.Background()
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps(configMapNamespace)
+
+	require.NoError(t, prefixcollector.Reserve(ctx, configMaps, reservationsConfigMapName, &prefixcollector.Reservation{
+		Prefix: "10.20.0.0/16", Requester: "operator", Created: time.Now(), Expires: time.Now().Add(-time.Second),
+	}))
+	reservations, err := prefixcollector.ReadReservations(ctx, configMaps, reservationsConfigMapName)
+	require.NoError(t, err)
+	require.Empty(t, reservations)
+	require.Equal(t, prefixcollector.ErrReservationNotFound,
+		prefixcollector.Release(ctx, configMaps, reservationsConfigMapName, "10.20.0.0/16"))
+}
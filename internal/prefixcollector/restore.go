@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OutputRestoredReason is reason of the event reported when the missing output config map is restored from backup
+const OutputRestoredReason = "OutputRestored"
+
+// backupRestore seeds the missing output config map with the latest backup snapshot on start and holds it
+// until all the sources provide prefixes or hold time passes
+type backupRestore struct {
+	store     *ObjectStore
+	name      string
+	namespace string
+	holdTime  time.Duration
+	// holding is true while the restored output is kept instead of the sources prefixes until deadline
+	holding  bool
+	deadline time.Time
+	timer    *time.Timer
+	// expired is notified when hold time of the restored output passes
+	expired chan struct{}
+}
+
+// WithBackupRestore is ExcludedPrefixCollector option, which creates the missing output config map name
+// in namespace on start with prefixes of the latest snapshot of store, e.g. after the cluster rebuild.
+// Restored prefixes are kept until every source provides prefixes or is refreshed, or holdTime passes.
+func WithBackupRestore(store *ObjectStore, name, namespace string, holdTime time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.restore = &backupRestore{
+			store:     store,
+			name:      name,
+			namespace: namespace,
+			holdTime:  holdTime,
+			expired:   make(chan struct{}, 1),
+		}
+	}
+}
+
+// restoreOutput restores the output config map from backup if it is missing, failures leave the output
+// to the sources
+func (epc *ExcludedPrefixCollector) restoreOutput(ctx context.Context) {
+	r := epc.restore
+	if r == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+	prefixes, err := r.restore(ctx, &epc.configMapOutput)
+	if err != nil {
+		logrus.Errorf("Failed to restore NSM ConfigMap from backup: %v", err)
+		return
+	}
+	if prefixes == nil {
+		return
+	}
+	epc.previousPrefixes.Store(prefixes)
+	r.holding, r.deadline = true, time.Now().Add(r.holdTime)
+	r.timer = time.AfterFunc(r.holdTime, func() {
+		select {
+		case r.expired <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// restore creates the missing output config map with the latest snapshot prefixes. Returns nil prefixes
+// if the config map exists or there are no snapshots.
+func (r *backupRestore) restore(ctx context.Context, output *configMapOutput) ([]string, error) {
+	configMapInterface := KubernetesInterface(ctx).CoreV1().ConfigMaps(r.namespace)
+	_, err := configMapInterface.Get(ctx, r.name, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	key, prefixes, err := latestSnapshot(ctx, r.store)
+	if err != nil || key == "" {
+		return nil, err
+	}
+	if prefixes == nil {
+		prefixes = []string{}
+	}
+
+	configMap, err := configMapInterface.Create(ctx, &apiV1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: r.name},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create NSM ConfigMap %s", r.name)
+	}
+	if err = output.write(ctx, prefixes, configMap, configMapInterface); err != nil {
+		return nil, errors.Wrapf(err, "Failed to write backup prefixes to NSM ConfigMap %s", r.name)
+	}
+	logrus.Infof("NSM ConfigMap %s is restored from backup snapshot %s: %v", r.name, key, prefixes)
+
+	err = reportOutputEvent(ctx, r.namespace, configMap, OutputRestoredReason,
+		fmt.Sprintf("Missing NSM ConfigMap is restored from backup snapshot %s", key))
+	if err != nil {
+		logrus.Errorf("Failed to report restore of NSM ConfigMap %s: %v", r.name, err)
+	}
+	return prefixes, nil
+}
+
+// hold returns true while the restored output should be kept, which is until every source provides
+// prefixes or is refreshed, or hold time passes
+func (r *backupRestore) hold(ctx context.Context, sources []PrefixSource) bool {
+	if r == nil || !r.holding {
+		return false
+	}
+	if !time.Now().Before(r.deadline) {
+		logrus.Warnf("Restored NSM ConfigMap hold time %v passed, sources take over the output", r.holdTime)
+		r.holding = false
+		return false
+	}
+	for _, source := range sources {
+		if len(source.Prefixes()) == 0 && RefreshTimes(ctx).Load(SourceName(source)).IsZero() {
+			return true
+		}
+	}
+	logrus.Info("All the sources provided prefixes, they take over the restored NSM ConfigMap")
+	r.stop()
+	r.holding = false
+	return false
+}
+
+// expiredChan returns channel notified when hold time of the restored output passes
+func (r *backupRestore) expiredChan() <-chan struct{} {
+	if r == nil || !r.holding {
+		return nil
+	}
+	return r.expired
+}
+
+// stop stops hold timer
+func (r *backupRestore) stop() {
+	if r != nil && r.timer != nil {
+		r.timer.Stop()
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const backupLatestSnapshot = "nsm/excluded-prefixes-20200102T000000.000Z.yaml"
+
+func TestBackupRestore(t *testing.T) {
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	notifyChan := make(chan struct{}, 1)
+	clientSet, configMapPrefixes := serveRestoredCollector(t, source, notifyChan, time.Minute)
+
+	require.Eventually(t, func() bool {
+		return configMapPrefixes() == "Prefixes:\n- 10.96.0.0/12\n"
+	}, time.Second, 10*time.Millisecond)
+	events, err := clientSet.CoreV1().Events(configMapNamespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	require.Equal(t, prefixcollector.OutputRestoredReason, events.Items[0].Reason)
+
+	// restored output is kept until the source provides prefixes
+	notifyChan <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, "Prefixes:\n- 10.96.0.0/12\n", configMapPrefixes())
+
+	source.Store([]string{"10.244.0.0/16"})
+	notifyChan <- struct{}{}
+	require.Eventually(t, func() bool {
+		return configMapPrefixes() == "Prefixes:\n- 10.244.0.0/16\n"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBackupRestoreHoldTime(t *testing.T) {
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	_, configMapPrefixes := serveRestoredCollector(t, source, make(chan struct{}), 200*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return configMapPrefixes() == "Prefixes:\n- 10.96.0.0/12\n"
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return configMapPrefixes() == "Prefixes: []\n"
+	}, time.Second, 10*time.Millisecond)
+}
+
+// serveRestoredCollector serves collector of source restoring the missing output config map from the bucket
+// with the latest snapshot of 10.96.0.0/12 until the test ends. Returns function returning the output prefixes.
+func serveRestoredCollector(t *testing.T, source prefixcollector.PrefixSource, notifyChan <-chan struct{},
+	holdTime time.Duration) (*fake.Clientset, func() string) {
+	bucket := newFakeBucket(backupOldSnapshot, backupLatestSnapshot)
+	data, err := utils.PrefixesToYaml([]string{"10.96.0.0/12"})
+	require.NoError(t, err)
+	bucket.objects[backupLatestSnapshot] = data
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	store, err := prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{
+		BucketURL:     server.URL + "/bucket/nsm/",
+		AccessKeyID:   backupAccessKeyID,
+		SecretKeyPath: backupSecretKeyPath(t),
+		Client:        server.Client(),
+	})
+	require.NoError(t, err)
+
+	clientSet := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	t.Cleanup(cancel)
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithBackupRestore(store, nsmConfigMapName, configMapNamespace, holdTime),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	return clientSet, func() string {
+		configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return ""
+		}
+		return configMap.Data[excludedPrefixesKey]
+	}
+}
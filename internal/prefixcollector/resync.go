@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ResyncPath is HTTP API path accepting POST forced resync requests
+	ResyncPath = "/resync"
+	// ReauthPath is HTTP API path accepting POST external sources re-authentication requests
+	ReauthPath = "/reauth"
+)
+
+// ResyncHandler returns HTTP handler requesting forced resync from signal on POST requests
+func ResyncHandler(signal *utils.ResyncSignal) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", http.MethodPost)
+			http.Error(writer, "Only POST requests resync", http.StatusMethodNotAllowed)
+			return
+		}
+		logrus.Infof("Resync requested by %s", request.RemoteAddr)
+		signal.Trigger()
+		writer.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// ReauthHandler returns HTTP handler requesting external sources to fetch prefixes with fresh credentials
+// from signal on POST requests, e.g. after credentials are revoked before the rotated secrets are mounted
+func ReauthHandler(signal *utils.ResyncSignal) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", http.MethodPost)
+			http.Error(writer, "Only POST requests re-authentication", http.StatusMethodNotAllowed)
+			return
+		}
+		logrus.Infof("Re-authentication of external sources requested by %s", request.RemoteAddr)
+		signal.Trigger()
+		writer.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// resyncAnnotationTracker detects changes of ResyncAnnotation of the output config map.
+// The first observed value is the current one, so requests made before the watch start aren't repeated.
+type resyncAnnotationTracker struct {
+	observed bool
+	value    string
+}
+
+// changed returns true if ResyncAnnotation of configMap differs from the previously observed one
+func (t *resyncAnnotationTracker) changed(configMap *apiV1.ConfigMap) bool {
+	value := configMap.Annotations[ResyncAnnotation]
+	changed := t.observed && value != t.value
+	t.observed, t.value = true, value
+	return changed
+}
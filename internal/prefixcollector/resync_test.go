@@ -0,0 +1,140 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResyncRewritesOutput(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	signal := utils.NewResyncSignal()
+	ctx, cancel := context.WithCancel(prefixcollector.WithResyncSignal(context.Background(), signal))
+	defer cancel()
+
+	written := make(chan []string, 1)
+	collector := prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			written <- prefixes
+			return nil
+		}),
+	)
+	go collector.Serve(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case prefixes := <-written:
+			require.Equal(t, []string{"10.96.0.0/12"}, prefixes)
+		case <-time.After(time.Second):
+			require.FailNow(t, "Output is not written")
+		}
+		signal.Trigger()
+	}
+}
+
+func TestResyncHandler(t *testing.T) {
+	signal := utils.NewResyncSignal()
+	resync := signal.Subscribe()
+	server := httptest.NewServer(prefixcollector.ResyncHandler(signal))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + prefixcollector.ResyncPath)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	require.Empty(t, resync)
+
+	response, err = http.Post(server.URL+prefixcollector.ResyncPath, "", http.NoBody)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	require.Len(t, resync, 1)
+}
+
+func TestReauthHandler(t *testing.T) {
+	signal := utils.NewResyncSignal()
+	reauth := signal.Subscribe()
+	server := httptest.NewServer(prefixcollector.ReauthHandler(signal))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + prefixcollector.ReauthPath)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	require.Empty(t, reauth)
+
+	response, err = http.Post(server.URL+prefixcollector.ReauthPath, "", http.NoBody)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	require.Len(t, reauth, 1)
+}
+
+func TestResyncAnnotation(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	signal := utils.NewResyncSignal()
+	resync := signal.Subscribe()
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(
+		prefixcollector.WithResyncSignal(context.Background(), signal), clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	configMaps := clientSet.CoreV1().ConfigMaps(configMapNamespace)
+	require.Eventually(t, func() bool {
+		configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		return err == nil && configMap.Data[excludedPrefixesKey] != ""
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, resync)
+
+	// the watch may be started after the first requests, so resync is requested until it is noticed
+	require.Eventually(t, func() bool {
+		configMap, err := configMaps.Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		require.NoError(t, err)
+		configMap.Annotations[prefixcollector.ResyncAnnotation] = time.Now().String()
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		select {
+		case <-resync:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
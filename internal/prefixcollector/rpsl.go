@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultRPSLOrigin is origin of the exported route objects, AS0 marks prefixes that shouldn't be routed
+	DefaultRPSLOrigin = "AS0"
+	// DefaultRPSLSource is source attribute of the exported route objects
+	DefaultRPSLSource = "NSM"
+
+	rpslAttributeWidth = 16
+)
+
+// RPSLOptions are attributes of the route objects exported by RPSLRouteObjects
+type RPSLOptions struct {
+	// Origin is AS number the routes originate from, DefaultRPSLOrigin if it is empty
+	Origin string
+	// Maintainer is mnt-by maintainer of the routes, omitted if it is empty
+	Maintainer string
+	// Source is registry source attribute of the routes, DefaultRPSLSource if it is empty
+	Source string
+}
+
+// RPSLRouteObjects returns RPSL route and route6 objects of the document prefixes separated by blank lines,
+// for network teams reconciling cluster exclusions against their IRR and route policy tooling. Sources of the
+// prefixes are described by descr attribute.
+func RPSLRouteObjects(document *PrefixesDocument, options *RPSLOptions) string {
+	origin, source := options.Origin, options.Source
+	if origin == "" {
+		origin = DefaultRPSLOrigin
+	}
+	if source == "" {
+		source = DefaultRPSLSource
+	}
+
+	var objects []string
+	for _, entry := range document.Prefixes {
+		class := "route"
+		if entry.Family == FamilyIPv6 {
+			class = "route6"
+		}
+		descr := "NSM excluded prefix"
+		if len(entry.Sources) > 0 {
+			descr += " of " + strings.Join(entry.Sources, ", ")
+		}
+		object := rpslAttribute(class, entry.Prefix) + rpslAttribute("descr", descr) + rpslAttribute("origin", origin)
+		if options.Maintainer != "" {
+			object += rpslAttribute("mnt-by", options.Maintainer)
+		}
+		objects = append(objects, object+rpslAttribute("source", source))
+	}
+	return strings.Join(objects, "\n")
+}
+
+// rpslAttribute returns RPSL attribute line with value aligned to the values of the other attributes
+func rpslAttribute(name, value string) string {
+	return fmt.Sprintf("%-*s%s\n", rpslAttributeWidth, name+":", value)
+}
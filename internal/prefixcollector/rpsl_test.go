@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPSLRouteObjects(t *testing.T) {
+	document := &prefixcollector.PrefixesDocument{
+		Version: prefixcollector.SchemaV2,
+		Prefixes: []prefixcollector.PrefixEntry{
+			{Prefix: "10.96.0.0/12", Family: prefixcollector.FamilyIPv4, Sources: []string{"kubeadm", "env"}},
+			{Prefix: "fd00:10:96::/112", Family: prefixcollector.FamilyIPv6},
+		},
+	}
+
+	require.Equal(t, `route:          10.96.0.0/12
+descr:          NSM excluded prefix of kubeadm, env
+origin:         AS0
+source:         NSM
+
+route6:         fd00:10:96::/112
+descr:          NSM excluded prefix
+origin:         AS0
+source:         NSM
+`, prefixcollector.RPSLRouteObjects(document, &prefixcollector.RPSLOptions{}))
+
+	require.Equal(t, `route:          10.96.0.0/12
+descr:          NSM excluded prefix of kubeadm, env
+origin:         AS64512
+mnt-by:         MAINT-NSM
+source:         CLUSTER
+`, prefixcollector.RPSLRouteObjects(&prefixcollector.PrefixesDocument{Prefixes: document.Prefixes[:1]},
+		&prefixcollector.RPSLOptions{Origin: "AS64512", Maintainer: "MAINT-NSM", Source: "CLUSTER"}))
+}
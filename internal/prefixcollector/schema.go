@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SchemaAnnotation is output config map annotation containing comma separated list of the schema versions written
+	SchemaAnnotation = "networkservicemesh.io/excluded-prefixes-schema"
+	// SchemaV1 is schema of plain YAML prefixes list kept under excluded_prefixes.yaml key
+	SchemaV1 = "v1"
+	// SchemaV2 is schema of PrefixesDocument kept under SchemaV2Key
+	SchemaV2 = "v2"
+	// SchemaV2Key is output config map key containing PrefixesDocument
+	SchemaV2Key = "excluded_prefixes_v2.yaml"
+
+	// FamilyIPv4 is PrefixEntry family of IPv4 prefixes
+	FamilyIPv4 = "IPv4"
+	// FamilyIPv6 is PrefixEntry family of IPv6 prefixes
+	FamilyIPv6 = "IPv6"
+)
+
+// PrefixEntry is excluded prefix with its attributes
+type PrefixEntry struct {
+	Prefix string `json:"prefix"`
+	Family string `json:"family"`
+	// Sources are names of the sources, whose prefixes are aggregated to the entry
+	Sources []string `json:"sources,omitempty"`
+	// TTL is duration the entry is valid for since the document update, provided by ExpiringPrefixSource sources.
+	// Entries without TTL don't expire.
+	TTL string `json:"ttl,omitempty"`
+	// VLANs are tags of the VLANs the entry prefixes are used on, provided by VLANPrefixSource sources
+	VLANs []int `json:"vlans,omitempty"`
+}
+
+// PrefixesDocument is v2 schema of excluded prefixes
+type PrefixesDocument struct {
+	Version  string        `json:"version"`
+	Prefixes []PrefixEntry `json:"prefixes"`
+}
+
+// WithOutputSchemas is ExcludedPrefixCollector option, which sets schema versions of configMap output.
+// Writing both v1 and v2 lets consumers migrate to v2 one by one. Only v1 is written by default.
+func WithOutputSchemas(versions ...string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.schemas = versions
+	}
+}
+
+// schemaVersions returns schema versions of the output
+func (o *configMapOutput) schemaVersions() []string {
+	if len(o.schemas) == 0 {
+		return []string{SchemaV1}
+	}
+	return o.schemas
+}
+
+// hasSchema returns true if the output is written in the schema version
+func (o *configMapOutput) hasSchema(version string) bool {
+	for _, v := range o.schemaVersions() {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSchemas sets payloads of the output schema versions to the config map and returns the payload signed
+// in SignatureAnnotation: v1 one if it is written, v2 one otherwise. Every written key is also signed on its own.
+func writeSchemas(configMap *apiV1.ConfigMap, prefixes []string, encoding string, output *configMapOutput) (string, error) {
+	delete(configMap.Data, configMapKey)
+	delete(configMap.Data, SchemaV2Key)
+
+	var payload string
+	if output.hasSchema(SchemaV2) {
+		entries, err := PrefixEntries(prefixes, output.loadSourcePrefixes())
+		if err != nil {
+			return "", err
+		}
+		AttributeVLANs(entries, output.loadVLANPrefixes())
+		AttributeTTLs(entries, output.loadPrefixesExpiry(), time.Now())
+		data, err := yaml.Marshal(&PrefixesDocument{Version: SchemaV2, Prefixes: entries})
+		if err != nil {
+			return "", errors.Wrap(err, "Can not marshal prefixes document")
+		}
+		if payload, err = encodePayload(data, encoding); err != nil {
+			return "", err
+		}
+		configMap.Data[SchemaV2Key] = payload
+	}
+	if output.hasSchema(SchemaV1) {
+		var err error
+		if payload, err = encodePrefixes(prefixes, encoding); err != nil {
+			return "", err
+		}
+		configMap.Data[configMapKey] = payload
+	}
+
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[SchemaAnnotation] = strings.Join(output.schemaVersions(), ",")
+	return payload, nil
+}
+
+// DecodeDocument decodes v2 schema payload in the encoding, which is the value of EncodingAnnotation
+func DecodeDocument(payload, encoding string) (*PrefixesDocument, error) {
+	data, err := decodePayload(payload, encoding)
+	if err != nil {
+		return nil, err
+	}
+	document := &PrefixesDocument{}
+	if err = yaml.Unmarshal(data, document); err != nil {
+		return nil, errors.Wrap(err, "Can not unmarshal prefixes document")
+	}
+	return document, nil
+}
+
+// PrefixEntries returns entries of the aggregated prefixes attributed to the sources of sourcePrefixes
+func PrefixEntries(prefixes []string, sourcePrefixes map[string][]string) ([]PrefixEntry, error) {
+	entries := make([]PrefixEntry, 0, len(prefixes))
+	entryIndex := make(map[string]int, len(prefixes))
+	for _, prefix := range prefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Wrong CIDR: %v", prefix)
+		}
+		family := FamilyIPv6
+		if len(ipNet.IP) == net.IPv4len {
+			family = FamilyIPv4
+		}
+		entryIndex[ipNet.String()] = len(entries)
+		entries = append(entries, PrefixEntry{Prefix: prefix, Family: family})
+	}
+
+	names := make([]string, 0, len(sourcePrefixes))
+	for name := range sourcePrefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, prefix := range sourcePrefixes[name] {
+			i, ok := containingEntry(entryIndex, prefix)
+			if !ok {
+				continue
+			}
+			if sources := entries[i].Sources; len(sources) == 0 || sources[len(sources)-1] != name {
+				entries[i].Sources = append(sources, name)
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/networkservicemesh/api/pkg/api/networkservice"
+	"github.com/networkservicemesh/sdk/pkg/networkservice/common/excludedprefixes"
+)
+
+// sdkOutputTimeout is time to write the output, encoding of the huge case takes over a second with race detector
+const sdkOutputTimeout = 5 * time.Second
+
+// sdkCompatibilityCases are prefix sets, which NSM SDK excludedprefixes chain element should read from the output
+func sdkCompatibilityCases() map[string][]string {
+	huge := make([]string, 0, 4096)
+	for i := 0; i < cap(huge); i++ {
+		huge = append(huge, fmt.Sprintf("10.%d.%d.0/24", i/128, i%128*2))
+	}
+	return map[string][]string{
+		"empty": {},
+		"ipv4":  {"10.96.0.0/12", "172.16.0.0/12"},
+		"ipv6":  {"2001:db8::/32", "fd00::/64"},
+		"dual":  {"10.244.0.0/16", "fd00::/64"},
+		"huge":  huge,
+	}
+}
+
+func TestSDKCompatibilityFileOutput(t *testing.T) {
+	for name, prefixes := range sdkCompatibilityCases() {
+		prefixes := prefixes
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			filePath := filepath.Join(t.TempDir(), prefixesFileName)
+			collector := prefixcollector.NewExcludePrefixCollector(
+				prefixcollector.WithFileOutput(filePath),
+				prefixcollector.WithSources(newDummyPrefixSource(prefixes)),
+			)
+			ctx, stop := serveCollector(ctx, collector)
+			defer stop()
+
+			require.Eventually(t, func() bool {
+				info, err := os.Stat(filePath)
+				return err == nil && info.Size() > 0
+			}, sdkOutputTimeout, 10*time.Millisecond)
+
+			requireSDKExcludedPrefixes(ctx, t, filePath, prefixes)
+		})
+	}
+}
+
+func TestSDKCompatibilityConfigMapOutput(t *testing.T) {
+	for name, prefixes := range sdkCompatibilityCases() {
+		prefixes := prefixes
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+			clientSet := fake.NewSimpleClientset(getConfigMap(t, nsmConfigMapPath))
+			ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+			defer cancel()
+
+			// v2 schema and family keys are written alongside v1 one and shouldn't break the consumers
+			collector := prefixcollector.NewExcludePrefixCollector(
+				prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+				prefixcollector.WithOutputSchemas(prefixcollector.SchemaV1, prefixcollector.SchemaV2),
+				prefixcollector.WithFamilyKeys(),
+				prefixcollector.WithSources(newDummyPrefixSource(prefixes)),
+			)
+			ctx, stop := serveCollector(ctx, collector)
+			defer stop()
+
+			var data string
+			require.Eventually(t, func() bool {
+				configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+				require.NoError(t, err)
+				data = configMap.Data[excludedPrefixesKey]
+				return configMap.Annotations[prefixcollector.SchemaAnnotation] != ""
+			}, sdkOutputTimeout, 10*time.Millisecond)
+
+			// consumers mount the config map key as a file
+			filePath := filepath.Join(t.TempDir(), prefixesFileName)
+			require.NoError(t, ioutil.WriteFile(filePath, []byte(data), 0600))
+
+			requireSDKExcludedPrefixes(ctx, t, filePath, prefixes)
+		})
+	}
+}
+
+// serveCollector serves collector until the returned stop function is called, stop returns after Serve and
+// the goroutines it started are finished
+func serveCollector(ctx context.Context, collector *prefixcollector.ExcludedPrefixCollector) (context.Context, func()) {
+	lifecycle := utils.NewLifecycle()
+	ctx, cancel := context.WithCancel(prefixcollector.WithLifecycle(ctx, lifecycle))
+	served := make(chan struct{})
+	go func() {
+		collector.Serve(ctx)
+		close(served)
+	}()
+	return ctx, func() {
+		cancel()
+		<-served
+		lifecycle.Wait(time.Second)
+	}
+}
+
+// requireSDKExcludedPrefixes checks that excludedprefixes server reading filePath adds prefixes to the connection
+func requireSDKExcludedPrefixes(ctx context.Context, t *testing.T, filePath string, prefixes []string) {
+	server := excludedprefixes.NewServer(ctx, excludedprefixes.WithConfigPath(filePath))
+	conn, err := server.Request(ctx, &networkservice.NetworkServiceRequest{
+		Connection: &networkservice.Connection{Context: &networkservice.ConnectionContext{}},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, prefixes, conn.GetContext().GetIpContext().GetExcludedPrefixes())
+}
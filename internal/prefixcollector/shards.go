@@ -0,0 +1,160 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// ShardIndexKey is output config map key containing ShardIndex, when the output is sharded
+const ShardIndexKey = "excluded_prefixes_index.yaml"
+
+// ShardIndex lists config maps the excluded prefixes are split across. Every shard keeps its part of
+// the prefixes under the excluded_prefixes.yaml key in the encoding of its EncodingAnnotation. Hash is hex encoded SHA-256 of the complete prefixes list,
+// so consumers can detect that they have read shards of different versions.
+type ShardIndex struct {
+	Shards []string `json:"shards"`
+	Hash   string   `json:"hash"`
+}
+
+// WithOutputShards is ExcludedPrefixCollector option, which splits configMap output across config maps
+// holding at most shardSize prefixes each. Output config map keeps ShardIndex of them.
+func WithOutputShards(shardSize int) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.shardSize = shardSize
+	}
+}
+
+// ShardName returns name of the i-th shard of the output config map
+func ShardName(configMapName string, i int) string {
+	return fmt.Sprintf("%s-%d", configMapName, i)
+}
+
+// PrefixesHash returns hex encoded SHA-256 of the prefixes list
+func PrefixesHash(prefixes []string) string {
+	hash := sha256.New()
+	for _, prefix := range prefixes {
+		_, _ = hash.Write([]byte(prefix))
+		_, _ = hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// decodeShardIndex decodes ShardIndex of the output config map, missing index is decoded as an empty one
+func decodeShardIndex(configMap *apiV1.ConfigMap) (*ShardIndex, error) {
+	index := &ShardIndex{}
+	if data, ok := configMap.Data[ShardIndexKey]; ok {
+		if err := yaml.Unmarshal([]byte(data), index); err != nil {
+			return nil, errors.Wrap(err, "Can not unmarshal shard index")
+		}
+	}
+	return index, nil
+}
+
+// updateShardedConfigMap writes shards first and the index after them, then removes shards no longer listed in the index
+func updateShardedConfigMap(ctx context.Context, newPrefixes []string,
+	configMap *apiV1.ConfigMap, configMapInterface v1.ConfigMapInterface, output *configMapOutput) error {
+	previousIndex, err := decodeShardIndex(configMap)
+	if err != nil {
+		return err
+	}
+
+	encoding := payloadEncoding(configMap, output)
+	index := &ShardIndex{Hash: PrefixesHash(newPrefixes)}
+	for start := 0; start < len(newPrefixes); start += output.shardSize {
+		end := start + output.shardSize
+		if end > len(newPrefixes) {
+			end = len(newPrefixes)
+		}
+		name := ShardName(configMap.Name, len(index.Shards))
+		if err = writeShard(ctx, name, newPrefixes[start:end], encoding, configMapInterface, output); err != nil {
+			return err
+		}
+		index.Shards = append(index.Shards, name)
+	}
+
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "Can not marshal shard index")
+	}
+	configMap.Data[ShardIndexKey] = string(data)
+	delete(configMap.Data, configMapKey)
+	setEncoding(configMap, encoding)
+	if err = annotateOutput(ctx, configMap, newPrefixes, configMap.Data[ShardIndexKey], output); err != nil {
+		return err
+	}
+	if _, err = configMapInterface.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "Failed to update NSM ConfigMap")
+	}
+
+	for _, name := range utils.Difference(previousIndex.Shards, index.Shards) {
+		err = configMapInterface.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "Failed to delete NSM ConfigMap shard %s", name)
+		}
+	}
+	return nil
+}
+
+// writeShard creates or updates shard config map with prefixes
+func writeShard(ctx context.Context, name string, prefixes []string, encoding string,
+	configMapInterface v1.ConfigMapInterface, output *configMapOutput) error {
+	data, err := encodePrefixes(prefixes, encoding)
+	if err != nil {
+		return err
+	}
+
+	shard, err := configMapInterface.Get(ctx, name, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return errors.Wrapf(err, "Failed to get NSM ConfigMap shard %s", name)
+	}
+	if notFound {
+		shard = &apiV1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	shard.Data = map[string]string{configMapKey: data}
+	setOwnerReference(shard, output.owner)
+	setEncoding(shard, encoding)
+	if size := configMapDataSize(shard); size > maxConfigMapDataSize {
+		return errors.Errorf("NSM ConfigMap shard %s data size %d exceeds Kubernetes limit %d", name, size, maxConfigMapDataSize)
+	}
+	if output.signingKey != nil {
+		if shard.Annotations == nil {
+			shard.Annotations = map[string]string{}
+		}
+		shard.Annotations[SignatureAnnotation] = signPayload(output.signingKey, shard.Data[configMapKey])
+		shard.Annotations[PublicKeyAnnotation] = output.publicKeyConfigMapName
+	}
+
+	if notFound {
+		_, err = configMapInterface.Create(ctx, shard, metav1.CreateOptions{})
+		return errors.Wrapf(err, "Failed to create NSM ConfigMap shard %s", name)
+	}
+	_, err = configMapInterface.Update(ctx, shard, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "Failed to update NSM ConfigMap shard %s", name)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// SignatureAnnotation is output config map annotation containing base64 encoded ed25519 signature
+	// of the excluded prefixes payload
+	SignatureAnnotation = "networkservicemesh.io/excluded-prefixes-signature"
+	// KeySignatureAnnotationPrefix prefixes output config map annotations containing base64 encoded ed25519
+	// signatures of the data keys, the data key follows the prefix
+	KeySignatureAnnotationPrefix = "networkservicemesh.io/signature-"
+	// PublicKeyAnnotation is output config map annotation containing name of the config map with the public key
+	PublicKeyAnnotation = "networkservicemesh.io/excluded-prefixes-public-key"
+	// PublicKeyConfigMapKey is public key config map key containing PEM encoded public key
+	PublicKeyConfigMapKey = "public_key.pem"
+
+	pemBlockPublicKey = "PUBLIC KEY"
+)
+
+// LoadSigningKey reads PEM encoded PKCS #8 ed25519 private key from file
+func LoadSigningKey(filePath string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read signing key")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("No PEM data found in %s", filePath)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse signing key")
+	}
+
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("Signing key is not an ed25519 key")
+	}
+
+	return signingKey, nil
+}
+
+// signPayload returns base64 encoded signature of payload
+func signPayload(key ed25519.PrivateKey, payload string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(payload)))
+}
+
+// KeySignatureAnnotation returns output config map annotation containing signature of the data key
+func KeySignatureAnnotation(key string) string {
+	return KeySignatureAnnotationPrefix + key
+}
+
+// VerifyKeySignature checks signature of the data key of the output config map with the public key
+func VerifyKeySignature(configMap *apiV1.ConfigMap, key string, publicKey ed25519.PublicKey) error {
+	payload, ok := configMap.Data[key]
+	if !ok {
+		return errors.Errorf("No %s key in config map %s", key, configMap.Name)
+	}
+	signature, err := base64.StdEncoding.DecodeString(configMap.Annotations[KeySignatureAnnotation(key)])
+	if err != nil {
+		return errors.Wrapf(err, "Failed to decode signature of %s key", key)
+	}
+	if !ed25519.Verify(publicKey, []byte(payload), signature) {
+		return errors.Errorf("Signature of %s key doesn't match its payload", key)
+	}
+	return nil
+}
+
+// signDataKeys sets signature annotations of every data key of configMap, so consumers of any of the schema,
+// diff and family keys can verify the one they read. Signatures of the removed keys are dropped.
+func signDataKeys(key ed25519.PrivateKey, configMap *apiV1.ConfigMap) {
+	for annotation := range configMap.Annotations {
+		if strings.HasPrefix(annotation, KeySignatureAnnotationPrefix) {
+			delete(configMap.Annotations, annotation)
+		}
+	}
+	for dataKey, payload := range configMap.Data {
+		configMap.Annotations[KeySignatureAnnotation(dataKey)] = signPayload(key, payload)
+	}
+}
+
+// publishPublicKey creates or updates config map containing public part of key
+func publishPublicKey(ctx context.Context, key ed25519.PrivateKey,
+	configMapName string, configMapInterface v1.ConfigMapInterface) error {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal public key")
+	}
+	data := map[string]string{
+		PublicKeyConfigMapKey: string(pem.EncodeToMemory(&pem.Block{Type: pemBlockPublicKey, Bytes: publicKeyBytes})),
+	}
+
+	configMap, err := configMapInterface.Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMapInterface.Create(ctx, &apiV1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: configMapName},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		return errors.Wrap(err, "Failed to create public key ConfigMap")
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to get public key ConfigMap")
+	}
+
+	if configMap.Data[PublicKeyConfigMapKey] == data[PublicKeyConfigMapKey] {
+		return nil
+	}
+	configMap.Data = data
+	_, err = configMapInterface.Update(ctx, configMap, metav1.UpdateOptions{})
+	return errors.Wrap(err, "Failed to update public key ConfigMap")
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SourceInit is initialization of the named source notifying notify about changes. Init returns nil
+// if the source is disabled.
+type SourceInit struct {
+	Name   string
+	Notify *utils.EventBus
+	Init   func(ctx context.Context) PrefixSource
+}
+
+// PendingPrefixSource is PrefixSource, which initialization may be still pending
+type PendingPrefixSource interface {
+	PrefixSource
+	Pending() bool
+}
+
+// InitSources runs the sources initializations concurrently and waits for each of them for timeout since start,
+// so a slow initialization doesn't delay the others. Sources not initialized within timeout are returned pending:
+// they have no prefixes and are reported in SourcesDegraded condition until initialized, their bus is notified then.
+// Returns the sources in order of inits without the disabled ones.
+func InitSources(ctx context.Context, timeout time.Duration, inits ...SourceInit) []PrefixSource {
+	results := make([]chan PrefixSource, len(inits))
+	for i := range inits {
+		results[i] = make(chan PrefixSource, 1)
+		go func(init SourceInit, result chan<- PrefixSource) {
+			result <- init.Init(ctx)
+		}(inits[i], results[i])
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	expired := false
+	sources := make([]PrefixSource, 0, len(inits))
+	var pending []string
+	for i := range inits {
+		var source PrefixSource
+		initialized := true
+		if expired {
+			select {
+			case source = <-results[i]:
+			default:
+				initialized = false
+			}
+		} else {
+			select {
+			case source = <-results[i]:
+			case <-deadline.C:
+				expired = true
+				initialized = false
+			}
+		}
+		switch {
+		case !initialized:
+			sources = append(sources, newPendingSource(ctx, inits[i], results[i]))
+			pending = append(pending, inits[i].Name)
+		case source != nil:
+			sources = append(sources, source)
+		}
+	}
+	if len(pending) > 0 {
+		logrus.Warnf("Sources aren't initialized in %v, they are served once initialized: %v", timeout, pending)
+	}
+	return sources
+}
+
+// pendingSource is source initialized after the initialization timeout, it delegates to the source once initialized
+type pendingSource struct {
+	name    string
+	mutex   sync.Mutex
+	pending bool
+	source  PrefixSource
+}
+
+func newPendingSource(ctx context.Context, init SourceInit, result <-chan PrefixSource) *pendingSource {
+	ps := &pendingSource{name: init.Name, pending: true}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case source := <-result:
+			ps.mutex.Lock()
+			ps.pending = false
+			ps.source = source
+			ps.mutex.Unlock()
+			if source == nil {
+				logrus.Warnf("Source %s is disabled after initialization", init.Name)
+			} else {
+				logrus.Infof("Source %s is initialized", init.Name)
+			}
+			init.Notify.Notify()
+		}
+	}()
+	return ps
+}
+
+func (ps *pendingSource) initialized() PrefixSource {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return ps.source
+}
+
+// Prefixes returns prefixes of the source, nil until it's initialized
+func (ps *pendingSource) Prefixes() []string {
+	if source := ps.initialized(); source != nil {
+		return source.Prefixes()
+	}
+	return nil
+}
+
+// Name returns name of the source
+func (ps *pendingSource) Name() string {
+	return ps.name
+}
+
+// Pending returns true until the source is initialized
+func (ps *pendingSource) Pending() bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return ps.pending
+}
+
+// Scope returns scope of the source, cluster until it's initialized
+func (ps *pendingSource) Scope() string {
+	return SourceScope(ps.initialized())
+}
+
+// VLANPrefixes returns prefixes of the VLAN aware source by VLAN tag, nil until it's initialized
+func (ps *pendingSource) VLANPrefixes() map[int][]string {
+	if vlanSource, ok := ps.initialized().(VLANPrefixSource); ok {
+		return vlanSource.VLANPrefixes()
+	}
+	return nil
+}
+
+// PrefixesExpiry returns end times of the expiring prefixes of the source, nil until it's initialized
+func (ps *pendingSource) PrefixesExpiry() map[string]time.Time {
+	if expiringSource, ok := ps.initialized().(ExpiringPrefixSource); ok {
+		return expiringSource.PrefixesExpiry()
+	}
+	return nil
+}
+
+// Health returns health of the health reporting source, healthy for the other ones
+func (ps *pendingSource) Health() SourceHealth {
+	if healthSource, ok := ps.initialized().(HealthReportingSource); ok {
+		return healthSource.Health()
+	}
+	return SourceHealth{Healthy: true}
+}
+
+// updatePendingSources reports status if the sources with pending initialization are changed
+func (epc *ExcludedPrefixCollector) updatePendingSources(ctx context.Context) {
+	var pending []string
+	for _, source := range epc.sources {
+		if pendingSource, ok := source.(PendingPrefixSource); ok && pendingSource.Pending() {
+			pending = append(pending, SourceName(source))
+		}
+	}
+	sort.Strings(pending)
+	if utils.UnorderedSlicesEquals(pending, epc.status.PendingSources) {
+		return
+	}
+	epc.status.PendingSources = pending
+	epc.reportStatus(ctx)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInitSources(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := utils.NewEventBus()
+	release := make(chan struct{})
+	start := time.Now()
+	sources := prefixcollector.InitSources(ctx, 100*time.Millisecond,
+		prefixcollector.SourceInit{
+			Name:   "slow",
+			Notify: bus.Source("slow"),
+			Init: func(context.Context) prefixcollector.PrefixSource {
+				<-release
+				return newDummyPrefixSource([]string{"10.96.0.0/12"})
+			},
+		},
+		prefixcollector.SourceInit{
+			Name:   "fast",
+			Notify: bus.Source("fast"),
+			Init: func(context.Context) prefixcollector.PrefixSource {
+				return newDummyPrefixSource([]string{"10.244.0.0/16"})
+			},
+		},
+		prefixcollector.SourceInit{
+			Name:   "disabled",
+			Notify: bus.Source("disabled"),
+			Init:   func(context.Context) prefixcollector.PrefixSource { return nil },
+		},
+	)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.Len(t, sources, 2)
+	require.Equal(t, []string{"10.244.0.0/16"}, sources[1].Prefixes())
+
+	slow, ok := sources[0].(prefixcollector.PendingPrefixSource)
+	require.True(t, ok)
+	require.Equal(t, "slow", prefixcollector.SourceName(slow))
+	require.True(t, slow.Pending())
+	require.Empty(t, slow.Prefixes())
+
+	close(release)
+	select {
+	case <-bus.Events():
+	case <-time.After(time.Second):
+		t.Fatal("initialized source doesn't notify")
+	}
+	require.False(t, slow.Pending())
+	require.Equal(t, []string{"10.96.0.0/12"}, slow.Prefixes())
+}
+
+func TestPendingSourcesCondition(t *testing.T) {
+	status := &prefixcollector.Status{OutputWritten: true, PendingSources: []string{"netbox"}}
+	for _, condition := range status.Conditions() {
+		if condition.Type == prefixcollector.ConditionSourcesDegraded {
+			require.Equal(t, metav1.ConditionTrue, condition.Status)
+			require.Equal(t, "SourcesPending", condition.Reason)
+			require.Equal(t, "Sources initialization is pending: netbox", condition.Message)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// staleChecksPerWindow is number of the sources staleness checks done per stale window
+const staleChecksPerWindow = 4
+
+// WithStaleWindow is ExcludedPrefixCollector option, which reports the sources stale if none of them is
+// refreshed within window. Sources refresh times are taken from RefreshTimes of the context.
+func WithStaleWindow(window time.Duration) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.staleWindow = window
+	}
+}
+
+// staleTicks returns channel ticking when the sources staleness should be checked, nil if it isn't checked
+func (epc *ExcludedPrefixCollector) staleTicks() (ticks <-chan time.Time, stop func()) {
+	if epc.staleWindow <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(epc.staleWindow / staleChecksPerWindow)
+	return ticker.C, ticker.Stop
+}
+
+// checkStale updates staleness of the sources and reports status if it is changed.
+// Sources are never stale until any of them is refreshed, so sources without refreshes don't raise the alarm.
+func (epc *ExcludedPrefixCollector) checkStale(ctx context.Context) {
+	refreshTimes := RefreshTimes(ctx)
+	epc.status.LastRefresh = refreshTimes.Latest()
+	stale := !epc.status.LastRefresh.IsZero() && time.Since(epc.status.LastRefresh) > epc.staleWindow
+	if stale == epc.status.SourcesStale {
+		return
+	}
+	epc.status.SourcesStale = stale
+
+	if stale {
+		logrus.WithField("refreshed", refreshTimes.Snapshot()).
+			Warnf("None of the sources is refreshed within %v, their watches may be dead", epc.staleWindow)
+	} else {
+		logrus.Info("Sources are refreshed again")
+	}
+	epc.reportStatus(ctx)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const statusResourceName = "prefix-collector"
+
+func TestStaleSources(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	refreshTimes := utils.NewRefreshTimes()
+	ctx := prefixcollector.WithDynamicInterface(context.Background(), dynamicClient)
+	ctx, cancel := context.WithCancel(prefixcollector.WithRefreshTimes(ctx, refreshTimes))
+	defer cancel()
+
+	refreshTimes.Touch("kubeadm")
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithOutputFunc(func(context.Context, []string) error { return nil }),
+		prefixcollector.WithStatusResource(statusResourceName, configMapNamespace),
+		prefixcollector.WithStaleWindow(200*time.Millisecond),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	degradedReason := func() string {
+		resource, err := dynamicClient.Resource(prefixcollector.StatusResource).Namespace(configMapNamespace).
+			Get(ctx, statusResourceName, metav1.GetOptions{})
+		if err != nil {
+			return ""
+		}
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		for _, condition := range conditions {
+			if fields, ok := condition.(map[string]interface{}); ok && fields["type"] == prefixcollector.ConditionSourcesDegraded {
+				return fields["reason"].(string)
+			}
+		}
+		return ""
+	}
+
+	require.Eventually(t, func() bool {
+		return degradedReason() == "SourcesStale"
+	}, time.Second, 10*time.Millisecond)
+
+	refreshTimes.Touch("kubeadm")
+	require.Eventually(t, func() bool {
+		return degradedReason() == "AllSourcesServed"
+	}, time.Second, 10*time.Millisecond)
+}
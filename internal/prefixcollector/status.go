@@ -0,0 +1,427 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/networkservicemesh/sdk/pkg/tools/spanhelper"
+)
+
+const (
+	// ConditionReady is True when excluded prefixes are written to the output
+	ConditionReady = "Ready"
+	// ConditionSourcesDegraded is True when some of the configured sources can't be served, are still initialized
+	// or report unhealthy state, or none of them is refreshed within stale window
+	ConditionSourcesDegraded = "SourcesDegraded"
+	// ConditionOutputStale is True when the output doesn't contain the latest collected prefixes
+	ConditionOutputStale = "OutputStale"
+	// ConditionConsumersSynced is True when all the tracked consumers applied the latest written prefixes
+	ConditionConsumersSynced = "ConsumersSynced"
+	// ConditionAllocationConflicts is True when the last excluded prefixes overlap addresses of live NSM connections
+	ConditionAllocationConflicts = "AllocationConflicts"
+	// ConditionPoolExhausted is True when excluded prefixes leave too few free addresses of NSM IPAM pool
+	ConditionPoolExhausted = "PoolExhausted"
+	// ConditionQuotaExceeded is True when some of the sources provide more prefixes than their quotas allow
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// ConditionPublicPrefixes is True when some of the sources provide prefixes covering public address space
+	ConditionPublicPrefixes = "PublicPrefixes"
+
+	statusKind = "PrefixCollectorStatus"
+)
+
+// StatusResource is group version resource of the collector status custom resource
+var StatusResource = schema.GroupVersionResource{
+	Group:    "networkservicemesh.io",
+	Version:  "v1alpha1",
+	Resource: "prefixcollectorstatuses",
+}
+
+// StatusCustomResourceDefinition is YAML of PrefixCollectorStatus custom resource definition
+const StatusCustomResourceDefinition = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: prefixcollectorstatuses.networkservicemesh.io
+spec:
+  group: networkservicemesh.io
+  names:
+    kind: PrefixCollectorStatus
+    listKind: PrefixCollectorStatusList
+    plural: prefixcollectorstatuses
+    singular: prefixcollectorstatus
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          status:
+            type: object
+            properties:
+              conditions:
+                type: array
+                items:
+                  type: object
+                  required: [type, status]
+                  properties:
+                    type:
+                      type: string
+                    status:
+                      type: string
+                    reason:
+                      type: string
+                    message:
+                      type: string
+                    lastTransitionTime:
+                      type: string
+                      format: date-time
+`
+
+// Condition is standard Kubernetes condition of the collector status
+type Condition struct {
+	Type               string
+	Status             metav1.ConditionStatus
+	Reason             string
+	Message            string
+	LastTransitionTime time.Time
+}
+
+// Status is excluded prefix collector status
+type Status struct {
+	// OutputWritten is true when excluded prefixes were written at least once
+	OutputWritten bool
+	// OutputError is the last output write error
+	OutputError error
+	// DegradedSources are names of the sources, which can't be served
+	DegradedSources []string
+	// PendingSources are names of the sources, which initialization is still pending
+	PendingSources []string
+	// UnhealthySources are names of the health reporting sources, which report unhealthy state, with their messages
+	UnhealthySources []string
+	// OutputPaused is true when the output is frozen, PendingChange is the change held since then
+	OutputPaused  bool
+	PendingChange *PrefixesChange
+	// SourcesStale is true when none of the sources is refreshed within stale window since LastRefresh
+	SourcesStale bool
+	LastRefresh  time.Time
+	// ConsumersTracked is true when consumers acknowledgments are checked, ConsumersUpToDate of Consumers applied
+	// the prefixes written at PrefixesWrittenAt
+	ConsumersTracked  bool
+	Consumers         int
+	ConsumersUpToDate int
+	PrefixesWrittenAt time.Time
+	// AllocationsChecked is true when newly excluded prefixes are checked against NSM connection allocations,
+	// AllocationConflicts are the last excluded prefixes overlapping them
+	AllocationsChecked  bool
+	AllocationConflicts []string
+	// PoolLinted is true when excluded prefixes are checked to leave enough addresses of NSM IPAM pool,
+	// PoolExhausted is true when they leave less, PoolFreeAddresses is number of the left ones and PoolUsable
+	// is their percentage of the last coverage report
+	PoolLinted        bool
+	PoolExhausted     bool
+	PoolFreeAddresses string
+	PoolUsable        string
+	// Panics are numbers of the recovered panics per goroutine of the sources, which were restarted after them
+	Panics map[string]uint64
+	// CachedSources are names of the sources, which prefixes are loaded from the source cache
+	CachedSources []string
+	// QuotasChecked is true when prefixes of the sources are limited by quotas, QuotaExceeded are the sources
+	// exceeding them with their prefixes numbers and quotas
+	QuotasChecked bool
+	QuotaExceeded []string
+	// PublicPrefixesChecked is true when prefixes of the sources are checked to not cover public address space,
+	// PublicPrefixes are the flagged prefixes prefixed by names of their sources
+	PublicPrefixesChecked bool
+	PublicPrefixes        []string
+}
+
+// statusHandlerFunc is collector status handler func
+type statusHandlerFunc func(context.Context, *Status)
+
+// WithStatusResource is ExcludedPrefixCollector option, which publishes collector status to
+// PrefixCollectorStatus custom resource name in namespace
+func WithStatusResource(name, namespace string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.statusHandlers = append(collector.statusHandlers,
+			statusResourcePublisher(name, namespace, &collector.configMapOutput))
+	}
+}
+
+// WithDegradedSources is ExcludedPrefixCollector option, which reports sources, configured but not served
+func WithDegradedSources(names ...string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.status.DegradedSources = names
+	}
+}
+
+// Conditions returns standard conditions describing status
+func (s *Status) Conditions() []Condition {
+	ready := Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "OutputWritten"}
+	stale := Condition{Type: ConditionOutputStale, Status: metav1.ConditionFalse, Reason: "OutputUpToDate"}
+	switch {
+	case s.OutputError != nil:
+		ready = Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "OutputFailed", Message: s.OutputError.Error()}
+		stale = Condition{Type: ConditionOutputStale, Status: metav1.ConditionTrue, Reason: "OutputFailed", Message: s.OutputError.Error()}
+	case !s.OutputWritten:
+		ready = Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "OutputPending"}
+		stale = Condition{Type: ConditionOutputStale, Status: metav1.ConditionTrue, Reason: "OutputPending"}
+	case len(s.CachedSources) > 0:
+		stale = Condition{
+			Type:    ConditionOutputStale,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesCached",
+			Message: "Cached prefixes are used for sources: " + strings.Join(s.CachedSources, ", "),
+		}
+	}
+	if s.OutputPaused && s.PendingChange != nil {
+		stale = Condition{
+			Type:   ConditionOutputStale,
+			Status: metav1.ConditionTrue,
+			Reason: "OutputPaused",
+			Message: fmt.Sprintf("Output is paused, %d prefixes would be added and %d removed",
+				len(s.PendingChange.Added), len(s.PendingChange.Removed)),
+		}
+	}
+
+	degraded := Condition{Type: ConditionSourcesDegraded, Status: metav1.ConditionFalse, Reason: "AllSourcesServed"}
+	switch {
+	case s.SourcesStale:
+		degraded = Condition{
+			Type:    ConditionSourcesDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesStale",
+			Message: "None of the sources is refreshed since " + s.LastRefresh.UTC().Format(time.RFC3339),
+		}
+	case len(s.PendingSources) > 0:
+		degraded = Condition{
+			Type:    ConditionSourcesDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesPending",
+			Message: "Sources initialization is pending: " + strings.Join(s.PendingSources, ", "),
+		}
+	case len(s.DegradedSources) > 0:
+		degraded = Condition{
+			Type:    ConditionSourcesDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesNotServed",
+			Message: "Sources not served: " + strings.Join(s.DegradedSources, ", "),
+		}
+	case len(s.UnhealthySources) > 0:
+		degraded = Condition{
+			Type:    ConditionSourcesDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesUnhealthy",
+			Message: "Sources report unhealthy state: " + strings.Join(s.UnhealthySources, "; "),
+		}
+	case len(s.Panics) > 0:
+		degraded = Condition{
+			Type:    ConditionSourcesDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesPanicked",
+			Message: "Sources restarted after panics: " + panicsMessage(s.Panics),
+		}
+	}
+
+	conditions := []Condition{ready, degraded, stale}
+	if s.ConsumersTracked {
+		conditions = append(conditions, s.consumersCondition())
+	}
+	if s.AllocationsChecked {
+		conditions = append(conditions, s.allocationsCondition())
+	}
+	if s.PoolLinted {
+		conditions = append(conditions, s.poolCondition())
+	}
+	if s.QuotasChecked {
+		conditions = append(conditions, s.quotaCondition())
+	}
+	if s.PublicPrefixesChecked {
+		conditions = append(conditions, s.publicPrefixesCondition())
+	}
+	return conditions
+}
+
+// quotaCondition returns condition describing the sources exceeding their prefix quotas
+func (s *Status) quotaCondition() Condition {
+	if len(s.QuotaExceeded) > 0 {
+		return Condition{
+			Type:    ConditionQuotaExceeded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "SourcesOverQuota",
+			Message: "Sources exceed their prefix quotas: " + strings.Join(s.QuotaExceeded, ", "),
+		}
+	}
+	return Condition{Type: ConditionQuotaExceeded, Status: metav1.ConditionFalse, Reason: "SourcesWithinQuotas"}
+}
+
+// publicPrefixesCondition returns condition describing the prefixes of the sources covering public address space
+func (s *Status) publicPrefixesCondition() Condition {
+	if len(s.PublicPrefixes) > 0 {
+		return Condition{
+			Type:    ConditionPublicPrefixes,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PublicPrefixesFound",
+			Message: "Sources provide prefixes of public address space: " + strings.Join(s.PublicPrefixes, ", "),
+		}
+	}
+	return Condition{Type: ConditionPublicPrefixes, Status: metav1.ConditionFalse, Reason: "NoPublicPrefixes"}
+}
+
+// panicsMessage returns sorted goroutine names with their panics numbers
+func panicsMessage(panics map[string]uint64) string {
+	names := make([]string, 0, len(panics))
+	for name, count := range panics {
+		names = append(names, fmt.Sprintf("%s (%d)", name, count))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// poolCondition returns condition describing free addresses of NSM IPAM pool left by excluded prefixes
+func (s *Status) poolCondition() Condition {
+	message := s.PoolFreeAddresses + " addresses of NSM IPAM pool are free"
+	if s.PoolUsable != "" {
+		message += ", " + s.PoolUsable + " of the pool is usable"
+	}
+	if s.PoolExhausted {
+		return Condition{Type: ConditionPoolExhausted, Status: metav1.ConditionTrue, Reason: "TooFewFreeAddresses", Message: message}
+	}
+	return Condition{Type: ConditionPoolExhausted, Status: metav1.ConditionFalse, Reason: "EnoughFreeAddresses", Message: message}
+}
+
+// allocationsCondition returns condition describing conflicts of excluded prefixes with NSM connection allocations
+func (s *Status) allocationsCondition() Condition {
+	if len(s.AllocationConflicts) > 0 {
+		return Condition{
+			Type:    ConditionAllocationConflicts,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PrefixesOverlapConnections",
+			Message: "Excluded prefixes overlap live NSM connections: " + strings.Join(s.AllocationConflicts, ", "),
+		}
+	}
+	return Condition{Type: ConditionAllocationConflicts, Status: metav1.ConditionFalse, Reason: "NoConflicts"}
+}
+
+// consumersCondition returns condition describing how many consumers applied the latest prefixes
+func (s *Status) consumersCondition() Condition {
+	message := fmt.Sprintf("%d of %d consumers applied prefixes written at %s",
+		s.ConsumersUpToDate, s.Consumers, s.PrefixesWrittenAt.UTC().Format(time.RFC3339))
+	if s.ConsumersUpToDate < s.Consumers {
+		return Condition{Type: ConditionConsumersSynced, Status: metav1.ConditionFalse, Reason: "ConsumersLagging", Message: message}
+	}
+	return Condition{Type: ConditionConsumersSynced, Status: metav1.ConditionTrue, Reason: "AllConsumersSynced", Message: message}
+}
+
+// statusResourcePublisher - creates custom resource statusHandlerFunc
+func statusResourcePublisher(name, namespace string, output *configMapOutput) statusHandlerFunc {
+	var previous []Condition
+	return func(ctx context.Context, status *Status) {
+		conditions := mergeConditions(previous, status.Conditions(), time.Now().UTC())
+		if conditionsEqual(previous, conditions) {
+			return
+		}
+
+		span := spanhelper.FromContext(ctx, "Update collector status")
+		defer span.Finish()
+
+		if err := publishStatus(ctx, name, namespace, conditions, output.owner); err != nil {
+			span.Logger().Error(err)
+			return
+		}
+		previous = conditions
+	}
+}
+
+func publishStatus(ctx context.Context, name, namespace string, conditions []Condition, owner *metav1.OwnerReference) error {
+	resourceInterface := DynamicInterface(ctx).Resource(StatusResource).Namespace(namespace)
+
+	resource, err := resourceInterface.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		resource = &unstructured.Unstructured{}
+		resource.SetAPIVersion(StatusResource.GroupVersion().String())
+		resource.SetKind(statusKind)
+		resource.SetName(name)
+		setOwnerReference(resource, owner)
+		resource, err = resourceInterface.Create(ctx, resource, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get collector status '%s/%s'", namespace, name)
+	}
+
+	if err = unstructured.SetNestedSlice(resource.Object, conditionsToUnstructured(conditions), "status", "conditions"); err != nil {
+		return errors.Wrap(err, "Failed to set collector status conditions")
+	}
+	_, err = resourceInterface.UpdateStatus(ctx, resource, metav1.UpdateOptions{})
+	return errors.Wrap(err, "Failed to update collector status")
+}
+
+// mergeConditions keeps LastTransitionTime of the conditions, which status hasn't changed
+func mergeConditions(previous, current []Condition, now time.Time) []Condition {
+	merged := make([]Condition, 0, len(current))
+	for i := range current {
+		condition := current[i]
+		condition.LastTransitionTime = now
+		for j := range previous {
+			if previous[j].Type == condition.Type && previous[j].Status == condition.Status {
+				condition.LastTransitionTime = previous[j].LastTransitionTime
+			}
+		}
+		merged = append(merged, condition)
+	}
+	return merged
+}
+
+func conditionsEqual(x, y []Condition) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func conditionsToUnstructured(conditions []Condition) []interface{} {
+	result := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		result = append(result, map[string]interface{}{
+			"type":               conditions[i].Type,
+			"status":             string(conditions[i].Status),
+			"reason":             conditions[i].Reason,
+			"message":            conditions[i].Message,
+			"lastTransitionTime": conditions[i].LastTransitionTime.Format(time.RFC3339),
+		})
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func conditionStatuses(status *prefixcollector.Status) map[string]metav1.ConditionStatus {
+	statuses := map[string]metav1.ConditionStatus{}
+	for _, condition := range status.Conditions() {
+		statuses[condition.Type] = condition.Status
+	}
+	return statuses
+}
+
+func TestStatusConditions(t *testing.T) {
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionFalse,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionTrue,
+	}, conditionStatuses(&prefixcollector.Status{}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionTrue,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, DegradedSources: []string{"kubeadm"}}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionFalse,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionTrue,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, OutputError: errors.New("forbidden")}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionTrue,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, SourcesStale: true, LastRefresh: time.Now()}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+		prefixcollector.ConditionConsumersSynced: metav1.ConditionFalse,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, ConsumersTracked: true, Consumers: 2, ConsumersUpToDate: 1}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionTrue,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, Panics: map[string]uint64{"sriov/sriovnetworks": 1}}))
+
+	require.Equal(t, map[string]metav1.ConditionStatus{
+		prefixcollector.ConditionReady:           metav1.ConditionTrue,
+		prefixcollector.ConditionSourcesDegraded: metav1.ConditionFalse,
+		prefixcollector.ConditionOutputStale:     metav1.ConditionFalse,
+		prefixcollector.ConditionQuotaExceeded:   metav1.ConditionTrue,
+	}, conditionStatuses(&prefixcollector.Status{OutputWritten: true, QuotasChecked: true, QuotaExceeded: []string{"netbox (3/2)"}}))
+}
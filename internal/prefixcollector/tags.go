@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"net"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// SourceTag is prefix tag containing name of the source provided the prefix
+	SourceTag = "source"
+	// FamilyTag is prefix tag containing FamilyIPv4 or FamilyIPv6
+	FamilyTag = "family"
+	// ScopeTag is prefix tag containing scope of the source provided the prefix
+	ScopeTag = "scope"
+
+	// ClusterScope is scope of prefixes the cluster itself and its nodes use
+	ClusterScope = "cluster"
+	// ExternalScope is scope of prefixes of the infrastructure outside of the cluster, e.g. IPAM or DHCP servers
+	ExternalScope = "external"
+	// FederatedScope is scope of prefixes pulled from remote collectors
+	FederatedScope = "federated"
+)
+
+// ScopedPrefixSource is PrefixSource knowing scope of its prefixes. Prefixes of other sources have ClusterScope.
+type ScopedPrefixSource interface {
+	PrefixSource
+	Scope() string
+}
+
+// WithOutputSelector is ExcludedPrefixCollector option, which sets selector of prefix tags the output receives.
+// Output receives all the prefixes by default.
+func WithOutputSelector(selector labels.Selector) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.outputSelector = selector
+	}
+}
+
+// WithAuditSelector is ExcludedPrefixCollector option, which sets selector of prefix tags the audit receives.
+// Audit receives all the prefixes by default.
+func WithAuditSelector(selector labels.Selector) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.auditSelector = selector
+	}
+}
+
+// SourceScope returns scope of prefixes of the source
+func SourceScope(source PrefixSource) string {
+	if scopedSource, ok := source.(ScopedPrefixSource); ok {
+		return scopedSource.Scope()
+	}
+	return ClusterScope
+}
+
+// PrefixTags returns tags of the prefix provided by the source with name and scope
+func PrefixTags(name, scope, prefix string) labels.Set {
+	tags := labels.Set{SourceTag: name, ScopeTag: scope}
+	if _, ipNet, err := net.ParseCIDR(prefix); err == nil {
+		tags[FamilyTag] = FamilyIPv6
+		if len(ipNet.IP) == net.IPv4len {
+			tags[FamilyTag] = FamilyIPv4
+		}
+	}
+	return tags
+}
+
+// selectPrefixes returns source sets containing only prefixes with tags matching selector
+func selectPrefixes(sets []sourceSet, selector labels.Selector) []sourceSet {
+	if selector == nil {
+		return sets
+	}
+	selected := make([]sourceSet, 0, len(sets))
+	for _, set := range sets {
+		selectedSet := sourceSet{name: set.name, scope: set.scope}
+		for _, prefix := range set.prefixes {
+			if selector.Matches(PrefixTags(set.name, set.scope, prefix)) {
+				selectedSet.prefixes = append(selectedSet.prefixes, prefix)
+			}
+		}
+		selected = append(selected, selectedSet)
+	}
+	return selected
+}
+
+// setsPrefixes returns prefixes of the source sets by source names
+func setsPrefixes(sets []sourceSet) map[string][]string {
+	sourcePrefixes := make(map[string][]string, len(sets))
+	for _, set := range sets {
+		sourcePrefixes[set.name] = set.prefixes
+	}
+	return sourcePrefixes
+}
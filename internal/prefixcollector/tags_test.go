@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type scopedPrefixSource struct {
+	namedPrefixSource
+	scope string
+}
+
+func (s *scopedPrefixSource) Scope() string {
+	return s.scope
+}
+
+func taggedSources() []prefixcollector.PrefixSource {
+	return []prefixcollector.PrefixSource{
+		&namedPrefixSource{name: "kubeadm", prefixes: []string{"10.96.0.0/12", "fd00:10:96::/112"}},
+		&scopedPrefixSource{
+			namedPrefixSource: namedPrefixSource{name: "netbox", prefixes: []string{"172.16.0.0/12"}},
+			scope:             prefixcollector.ExternalScope,
+		},
+		&scopedPrefixSource{
+			namedPrefixSource: namedPrefixSource{name: "federation/east", prefixes: []string{"10.128.0.0/14"}},
+			scope:             prefixcollector.FederatedScope,
+		},
+	}
+}
+
+func TestPrefixTags(t *testing.T) {
+	source := taggedSources()[1]
+	require.Equal(t, prefixcollector.ExternalScope, prefixcollector.SourceScope(source))
+	require.Equal(t, prefixcollector.ClusterScope, prefixcollector.SourceScope(taggedSources()[0]))
+
+	require.Equal(t, labels.Set{
+		prefixcollector.SourceTag: "netbox",
+		prefixcollector.ScopeTag:  prefixcollector.ExternalScope,
+		prefixcollector.FamilyTag: prefixcollector.FamilyIPv4,
+	}, prefixcollector.PrefixTags("netbox", prefixcollector.ExternalScope, "172.16.0.0/12"))
+	require.Equal(t, prefixcollector.FamilyIPv6,
+		prefixcollector.PrefixTags("kubeadm", prefixcollector.ClusterScope, "fd00:10:96::/112")[prefixcollector.FamilyTag])
+}
+
+func TestOutputSelector(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, testCase := range []struct {
+		selector string
+		expected []string
+	}{
+		{
+			selector: "scope=cluster",
+			expected: []string{"10.96.0.0/12", "fd00:10:96::/112"},
+		},
+		{
+			selector: "scope in (cluster,federated),family=IPv4",
+			expected: []string{"10.96.0.0/12", "10.128.0.0/14"},
+		},
+		{
+			selector: "source!=kubeadm",
+			expected: []string{"10.128.0.0/14", "172.16.0.0/12"},
+		},
+	} {
+		selector, err := labels.Parse(testCase.selector)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expected, collectOnce(t,
+			prefixcollector.WithSources(taggedSources()...),
+			prefixcollector.WithOutputSelector(selector),
+		), testCase.selector)
+	}
+}
+
+func TestAuditSelector(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	auditFilePath := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	outputSelector, err := labels.Parse("scope=cluster")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.96.0.0/12", "fd00:10:96::/112"}, collectOnce(t,
+		prefixcollector.WithSources(taggedSources()...),
+		prefixcollector.WithOutputSelector(outputSelector),
+		prefixcollector.WithAuditFile(auditFilePath),
+	))
+
+	require.Eventually(t, func() bool {
+		data, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+		return err == nil && strings.HasSuffix(string(data), "\n")
+	}, time.Second, 10*time.Millisecond)
+
+	data, err := ioutil.ReadFile(filepath.Clean(auditFilePath))
+	require.NoError(t, err)
+	change := &prefixcollector.PrefixesChange{}
+	require.NoError(t, json.Unmarshal(data, change))
+	require.Equal(t, []string{"10.96.0.0/12", "10.128.0.0/14", "172.16.0.0/12", "fd00:10:96::/112"}, change.Added)
+}
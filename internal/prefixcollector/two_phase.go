@@ -0,0 +1,148 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	apiV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationClientV1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// CommitPointerKey is output config map key naming the slot key the committed prefixes are in, when the output
+	// is published with two-phase commit. Readers following it always see a complete snapshot.
+	CommitPointerKey = "excluded_prefixes_pointer"
+	// CommitSlotAKey and CommitSlotBKey are output config map keys two-phase commit stages prefixes in alternately
+	CommitSlotAKey = "excluded_prefixes_a.yaml"
+	CommitSlotBKey = "excluded_prefixes_b.yaml"
+
+	defaultCommitLeaseDuration = 30 * time.Second
+)
+
+// twoPhaseCommit publishes the output in two phases guarded by Lease: prefixes are staged in the slot key
+// the pointer doesn't name, then the pointer is flipped to it with the rest of the output
+type twoPhaseCommit struct {
+	leaseName     string
+	holder        string
+	leaseDuration time.Duration
+}
+
+// WithTwoPhaseCommit is ExcludedPrefixCollector option, which publishes configMap output with two-phase commit
+// guarded by coordination Lease leaseName of the output namespace held by holder, so concurrent collectors
+// don't interleave their phases
+func WithTwoPhaseCommit(leaseName, holder string) Option {
+	return func(collector *ExcludedPrefixCollector) {
+		collector.configMapOutput.twoPhase = &twoPhaseCommit{
+			leaseName:     leaseName,
+			holder:        holder,
+			leaseDuration: defaultCommitLeaseDuration,
+		}
+	}
+}
+
+// commit stages newPrefixes in the free slot of the config map and then updates the output flipping the pointer
+// to the slot. The lease is held from the staging to the flip.
+func (t *twoPhaseCommit) commit(ctx context.Context, newPrefixes []string,
+	configMap *apiV1.ConfigMap, configMapInterface v1.ConfigMapInterface, output *configMapOutput) error {
+	leases := KubernetesInterface(ctx).CoordinationV1().Leases(configMap.Namespace)
+	if err := t.acquire(ctx, leases); err != nil {
+		return err
+	}
+	defer t.release(ctx, leases)
+
+	newPrefixes, err := utils.CanonicalPrefixes(newPrefixes)
+	if err != nil {
+		return errors.Wrap(err, "Can not canonicalize prefixes")
+	}
+	staging := CommitSlotAKey
+	if configMap.Data[CommitPointerKey] == CommitSlotAKey {
+		staging = CommitSlotBKey
+	}
+	payload, err := encodePrefixes(newPrefixes, payloadEncoding(configMap, output))
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[staging] = payload
+	if configMap, err = configMapInterface.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "Failed to stage prefixes in NSM ConfigMap key %s", staging)
+	}
+
+	configMap.Data[CommitPointerKey] = staging
+	return updateConfigMap(ctx, newPrefixes, configMap, configMapInterface, output)
+}
+
+// acquire takes the lease if it is free, expired or already held by the holder
+func (t *twoPhaseCommit) acquire(ctx context.Context, leases coordinationClientV1.LeaseInterface) error {
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(t.leaseDuration.Seconds())
+	lease, err := leases.Get(ctx, t.leaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationV1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: t.leaseName},
+			Spec: coordinationV1.LeaseSpec{
+				HolderIdentity: &t.holder, LeaseDurationSeconds: &seconds, AcquireTime: &now, RenewTime: &now,
+			},
+		}, metav1.CreateOptions{})
+		return errors.Wrapf(err, "Failed to create output commit lease %s", t.leaseName)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get output commit lease %s", t.leaseName)
+	}
+
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" && *holder != t.holder &&
+		!leaseExpired(lease, now.Time) {
+		return errors.Errorf("Output commit lease %s is held by %s", t.leaseName, *holder)
+	}
+	lease.Spec.HolderIdentity = &t.holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "Failed to acquire output commit lease %s", t.leaseName)
+}
+
+// release frees the lease held by the holder, so the other collectors don't wait for its expiration
+func (t *twoPhaseCommit) release(ctx context.Context, leases coordinationClientV1.LeaseInterface) {
+	lease, err := leases.Get(ctx, t.leaseName, metav1.GetOptions{})
+	if err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == t.holder {
+		lease.Spec.HolderIdentity = nil
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		logrus.Warnf("Failed to release output commit lease %s: %v", t.leaseName, err)
+	}
+}
+
+// leaseExpired returns true if the lease isn't renewed within its duration before now
+func leaseExpired(lease *coordinationV1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const commitLeaseName = "nsm-config-commit"
+
+func TestTwoPhaseCommit(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace},
+	})
+	updates := make(chan *v1.ConfigMap, 10)
+	clientSet.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates <- action.(k8stesting.UpdateAction).GetObject().(*v1.ConfigMap).DeepCopy()
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	source := containerPrefixSource{utils.NewSynchronizedPrefixesContainer()}
+	source.Store([]string{"10.96.0.0/12"})
+	notifyChan := make(chan struct{}, 1)
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithTwoPhaseCommit(commitLeaseName, "collector-0"),
+		prefixcollector.WithNotifyChan(notifyChan),
+		prefixcollector.WithSources(source),
+	).Serve(ctx)
+
+	nextUpdate := func() *v1.ConfigMap {
+		select {
+		case configMap := <-updates:
+			return configMap
+		case <-time.After(time.Second):
+			require.FailNow(t, "NSM config map is not updated")
+			return nil
+		}
+	}
+
+	// prefixes are staged without the pointer and then committed by the pointer flip
+	staged := nextUpdate()
+	require.NotContains(t, staged.Data, prefixcollector.CommitPointerKey)
+	require.NotContains(t, staged.Data, excludedPrefixesKey)
+	committed := nextUpdate()
+	require.Equal(t, prefixcollector.CommitSlotAKey, committed.Data[prefixcollector.CommitPointerKey])
+	require.Equal(t, staged.Data[prefixcollector.CommitSlotAKey], committed.Data[prefixcollector.CommitSlotAKey])
+
+	source.Store([]string{"10.96.0.0/12", "172.16.0.0/12"})
+	notifyChan <- struct{}{}
+	staged = nextUpdate()
+	require.Equal(t, prefixcollector.CommitSlotAKey, staged.Data[prefixcollector.CommitPointerKey])
+	prefixes, err := prefixcollector.DecodePrefixes(staged.Data[prefixcollector.CommitSlotBKey], "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.96.0.0/12", "172.16.0.0/12"}, prefixes)
+	committed = nextUpdate()
+	require.Equal(t, prefixcollector.CommitSlotBKey, committed.Data[prefixcollector.CommitPointerKey])
+
+	require.Eventually(t, func() bool {
+		lease, err := clientSet.CoordinationV1().Leases(configMapNamespace).Get(ctx, commitLeaseName, metav1.GetOptions{})
+		return err == nil && lease.Spec.HolderIdentity == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTwoPhaseCommitWaitsForHeldLease(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	holder, seconds, now := "collector-1", int32(60), metav1.NewMicroTime(time.Now())
+	clientSet := fake.NewSimpleClientset(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: nsmConfigMapName, Namespace: configMapNamespace}},
+		&coordinationV1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: commitLeaseName, Namespace: configMapNamespace},
+			Spec:       coordinationV1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &seconds, RenewTime: &now},
+		},
+	)
+	ctx, cancel := context.WithCancel(prefixcollector.WithKubernetesInterface(context.Background(), clientSet))
+	defer cancel()
+
+	go prefixcollector.NewExcludePrefixCollector(
+		prefixcollector.WithConfigMapOutput(nsmConfigMapName, configMapNamespace),
+		prefixcollector.WithTwoPhaseCommit(commitLeaseName, "collector-0"),
+		prefixcollector.WithSources(newDummyPrefixSource([]string{"10.96.0.0/12"})),
+	).Serve(ctx)
+
+	// the output isn't staged while the other collector holds the lease
+	require.Never(t, func() bool {
+		configMap, err := clientSet.CoreV1().ConfigMaps(configMapNamespace).Get(ctx, nsmConfigMapName, metav1.GetOptions{})
+		return err != nil || len(configMap.Data) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prefixcollector
+
+import (
+	"net"
+	"sort"
+)
+
+// VLANPrefixSource is PrefixSource knowing VLAN tags of the L2 networks its prefixes are used on.
+// VLAN tags are published in v2 schema entries, so the address planning can be audited per VLAN.
+type VLANPrefixSource interface {
+	PrefixSource
+	// VLANPrefixes returns prefixes of the source by VLAN tag, prefixes of untagged networks aren't returned
+	VLANPrefixes() map[int][]string
+}
+
+// sourcesVLANPrefixes returns prefixes of the VLAN aware sources by VLAN tag
+func sourcesVLANPrefixes(sources []PrefixSource) map[int][]string {
+	vlanPrefixes := map[int][]string{}
+	for _, source := range sources {
+		vlanSource, ok := source.(VLANPrefixSource)
+		if !ok {
+			continue
+		}
+		for vlan, prefixes := range vlanSource.VLANPrefixes() {
+			vlanPrefixes[vlan] = append(vlanPrefixes[vlan], prefixes...)
+		}
+	}
+	return vlanPrefixes
+}
+
+// AttributeVLANs sets VLAN tags of the entries containing prefixes of vlanPrefixes
+func AttributeVLANs(entries []PrefixEntry, vlanPrefixes map[int][]string) {
+	entryIndex := prefixEntryIndex(entries)
+	vlans := make([]int, 0, len(vlanPrefixes))
+	for vlan := range vlanPrefixes {
+		vlans = append(vlans, vlan)
+	}
+	sort.Ints(vlans)
+
+	for _, vlan := range vlans {
+		for _, prefix := range vlanPrefixes[vlan] {
+			i, ok := containingEntry(entryIndex, prefix)
+			if !ok {
+				continue
+			}
+			if tags := entries[i].VLANs; len(tags) == 0 || tags[len(tags)-1] != vlan {
+				entries[i].VLANs = append(tags, vlan)
+			}
+		}
+	}
+}
+
+// prefixEntryIndex returns indexes of the entries by their network
+func prefixEntryIndex(entries []PrefixEntry) map[string]int {
+	entryIndex := make(map[string]int, len(entries))
+	for i := range entries {
+		if _, ipNet, err := net.ParseCIDR(entries[i].Prefix); err == nil {
+			entryIndex[ipNet.String()] = i
+		}
+	}
+	return entryIndex
+}
+
+// containingEntry returns index of the entry containing prefix, aggregated entry containing it is one of its supernets
+func containingEntry(entryIndex map[string]int, prefix string) (int, bool) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return 0, false
+	}
+	for ones, bits := ipNet.Mask.Size(); ones >= 0; ones-- {
+		mask := net.CIDRMask(ones, bits)
+		if i, ok := entryIndex[(&net.IPNet{IP: ipNet.IP.Mask(mask), Mask: mask}).String()]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
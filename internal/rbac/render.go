@@ -0,0 +1,117 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	rbacV1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const documentSeparator = "---\n"
+
+// Render returns YAML of minimal ClusterRole and Roles named name, granting rules.
+// Cluster wide rules are granted by ClusterRole, namespaced ones by Role in the corresponding namespace.
+func Render(name string, rules ...Rule) ([]byte, error) {
+	policyRules := map[string][]rbacV1.PolicyRule{}
+	for _, rule := range mergeRules(rules) {
+		policyRules[rule.Namespace] = append(policyRules[rule.Namespace], rbacV1.PolicyRule{
+			APIGroups: []string{rule.APIGroup},
+			Resources: []string{rule.Resource},
+			Verbs:     rule.Verbs,
+		})
+	}
+
+	namespaces := make([]string, 0, len(policyRules))
+	for namespace := range policyRules {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var documents []interface{}
+	for _, namespace := range namespaces {
+		if namespace == "" {
+			documents = append(documents, &rbacV1.ClusterRole{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacV1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Rules:      policyRules[namespace],
+			})
+			continue
+		}
+		documents = append(documents, &rbacV1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacV1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Rules:      policyRules[namespace],
+		})
+	}
+
+	var buffer bytes.Buffer
+	for i, document := range documents {
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buffer.WriteString(documentSeparator)
+		}
+		buffer.Write(data)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// mergeRules merges verbs of rules with the same namespace and resource preserving the rules order
+func mergeRules(rules []Rule) []Rule {
+	type ruleKey struct {
+		namespace, apiGroup, resource string
+	}
+
+	var merged []Rule
+	indexes := map[ruleKey]int{}
+	for _, rule := range rules {
+		key := ruleKey{rule.Namespace, rule.APIGroup, rule.Resource}
+		index, ok := indexes[key]
+		if !ok {
+			indexes[key] = len(merged)
+			merged = append(merged, Rule{
+				Namespace: rule.Namespace,
+				APIGroup:  rule.APIGroup,
+				Resource:  rule.Resource,
+			})
+			index = len(merged) - 1
+		}
+		for _, verb := range rule.Verbs {
+			if !containsString(merged[index].Verbs, verb) {
+				merged[index].Verbs = append(merged[index].Verbs, verb)
+			}
+		}
+	}
+
+	return merged
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/rbac"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/require"
+	rbacV1 "k8s.io/api/rbac/v1"
+)
+
+func TestRender(t *testing.T) {
+	data, err := rbac.Render("test",
+		rbac.Rule{Namespace: "kube-system", Resource: "configmaps", Verbs: []string{"get"}},
+		rbac.Rule{Resource: "nodes", Verbs: []string{"watch"}},
+		rbac.Rule{Namespace: "kube-system", Resource: "configmaps", Verbs: []string{"get", "watch"}},
+	)
+	require.NoError(t, err)
+
+	documents := strings.Split(string(data), "---\n")
+	require.Len(t, documents, 2)
+
+	clusterRole := &rbacV1.ClusterRole{}
+	require.NoError(t, yaml.Unmarshal([]byte(documents[0]), clusterRole))
+	require.Equal(t, "ClusterRole", clusterRole.Kind)
+	require.Equal(t, []rbacV1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"watch"}},
+	}, clusterRole.Rules)
+
+	role := &rbacV1.Role{}
+	require.NoError(t, yaml.Unmarshal([]byte(documents[1]), role))
+	require.Equal(t, "kube-system", role.Namespace)
+	require.Equal(t, []rbacV1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "watch"}},
+	}, role.Rules)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac contains Kubernetes API permissions required by excluded prefix collector and functions working with them
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Rule is Kubernetes API permission. Rule with empty Namespace is cluster wide.
+type Rule struct {
+	Namespace string
+	APIGroup  string
+	Resource  string
+	Verbs     []string
+}
+
+// String returns human readable representation of the rule
+func (r *Rule) String() string {
+	resource := r.Resource
+	if r.APIGroup != "" {
+		resource = r.Resource + "." + r.APIGroup
+	}
+	namespace := "all namespaces"
+	if r.Namespace != "" {
+		namespace = "namespace " + r.Namespace
+	}
+	return fmt.Sprintf("%s %s in %s", strings.Join(r.Verbs, ","), resource, namespace)
+}
+
+// Denied checks rules against the current ServiceAccount permissions using SelfSubjectAccessReview
+// and returns rules containing only denied verbs
+func Denied(ctx context.Context, clientSet kubernetes.Interface, rules ...Rule) ([]Rule, error) {
+	reviews := clientSet.AuthorizationV1().SelfSubjectAccessReviews()
+
+	var denied []Rule
+	for _, rule := range rules {
+		deniedRule := rule
+		deniedRule.Verbs = nil
+		for _, verb := range rule.Verbs {
+			review, err := reviews.Create(ctx, &authorizationV1.SelfSubjectAccessReview{
+				Spec: authorizationV1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationV1.ResourceAttributes{
+						Namespace: rule.Namespace,
+						Group:     rule.APIGroup,
+						Resource:  rule.Resource,
+						Verb:      verb,
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to review access to %s", rule.String())
+			}
+			if !review.Status.Allowed {
+				deniedRule.Verbs = append(deniedRule.Verbs, verb)
+			}
+		}
+		if len(deniedRule.Verbs) > 0 {
+			denied = append(denied, deniedRule)
+		}
+	}
+
+	return denied, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/rbac"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDenied(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationV1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = attributes.Resource == "configmaps" && attributes.Verb == "get"
+			return true, review, nil
+		})
+
+	denied, err := rbac.Denied(context.Background(), clientSet,
+		rbac.Rule{Namespace: "kube-system", Resource: "configmaps", Verbs: []string{"get", "watch"}},
+		rbac.Rule{Resource: "nodes", Verbs: []string{"watch"}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []rbac.Rule{
+		{Namespace: "kube-system", Resource: "configmaps", Verbs: []string{"watch"}},
+		{Resource: "nodes", Verbs: []string{"watch"}},
+	}, denied)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"net"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// AggregatePrefixes returns minimal sorted list of prefixes covering the same addresses as prefixes:
+// nested prefixes are removed and sibling prefixes are joined to their parent.
+// Prefixes are processed as sorted intervals, so it takes O(n log n) time and O(n) memory.
+func AggregatePrefixes(prefixes []string) ([]string, error) {
+	networks, err := sortedNetworks(prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregated []*net.IPNet
+	for _, ipNet := range networks {
+		if len(aggregated) > 0 && aggregated[len(aggregated)-1].Contains(ipNet.IP) &&
+			len(aggregated[len(aggregated)-1].IP) == len(ipNet.IP) {
+			continue
+		}
+		aggregated = append(aggregated, ipNet)
+		for len(aggregated) > 1 {
+			parent, ok := joinSiblings(aggregated[len(aggregated)-2], aggregated[len(aggregated)-1])
+			if !ok {
+				break
+			}
+			aggregated = append(aggregated[:len(aggregated)-2], parent)
+		}
+	}
+
+	result := make([]string, 0, len(aggregated))
+	for _, ipNet := range aggregated {
+		result = append(result, ipNet.String())
+	}
+	return result, nil
+}
+
+// CanonicalPrefixes returns prefixes in the canonical form the output is serialized in: host bits are cleared,
+// IPv6 addresses are compressed lower case, IPv4-mapped IPv6 prefixes are IPv4 ones, duplicates are removed and
+// prefixes are sorted by family, network address and prefix length. Unlike AggregatePrefixes it keeps nested
+// and sibling prefixes, so the same prefixes are always serialized the same way.
+func CanonicalPrefixes(prefixes []string) ([]string, error) {
+	networks, err := sortedNetworks(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(networks))
+	for i, ipNet := range networks {
+		if i > 0 && CompareNetworks(networks[i-1], ipNet) == 0 {
+			continue
+		}
+		result = append(result, ipNet.String())
+	}
+	return result, nil
+}
+
+// sortedNetworks returns canonical networks of prefixes sorted with CompareNetworks
+func sortedNetworks(prefixes []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ipNet, err := canonicalNetwork(prefix)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, ipNet)
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		return CompareNetworks(networks[i], networks[j]) < 0
+	})
+	return networks, nil
+}
+
+// canonicalNetwork returns network of the prefix, IPv4-mapped IPv6 prefix is returned as IPv4 one
+func canonicalNetwork(prefix string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Wrong CIDR: %v", prefix)
+	}
+	const mappedBits = 8 * (net.IPv6len - net.IPv4len)
+	if ones, bits := ipNet.Mask.Size(); bits == 8*net.IPv6len && ones >= mappedBits && ipNet.IP.To4() != nil {
+		ipNet = &net.IPNet{IP: ipNet.IP.To4(), Mask: net.CIDRMask(ones-mappedBits, 8*net.IPv4len)}
+	}
+	return ipNet, nil
+}
+
+// CompareNetworks orders networks by family (IPv4 first), then by network address, then by prefix length
+func CompareNetworks(x, y *net.IPNet) int {
+	if len(x.IP) != len(y.IP) {
+		return len(x.IP) - len(y.IP)
+	}
+	if result := bytes.Compare(x.IP, y.IP); result != 0 {
+		return result
+	}
+	xOnes, _ := x.Mask.Size()
+	yOnes, _ := y.Mask.Size()
+	return xOnes - yOnes
+}
+
+// joinSiblings returns parent of x and y if they are the two halves of it
+func joinSiblings(x, y *net.IPNet) (*net.IPNet, bool) {
+	xOnes, bits := x.Mask.Size()
+	yOnes, _ := y.Mask.Size()
+	if len(x.IP) != len(y.IP) || xOnes != yOnes || xOnes == 0 {
+		return nil, false
+	}
+
+	parentMask := net.CIDRMask(xOnes-1, bits)
+	parentIP := x.IP.Mask(parentMask)
+	if !parentIP.Equal(y.IP.Mask(parentMask)) || x.IP.Equal(y.IP) {
+		return nil, false
+	}
+	return &net.IPNet{IP: parentIP, Mask: parentMask}, true
+}
+
+// CoveredBy returns true if prefix is a subnet of one of prefixes. Invalid prefixes aren't covered by anything.
+func CoveredBy(prefix string, prefixes []string) bool {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+	ones, _ := ipNet.Mask.Size()
+	for _, other := range prefixes {
+		_, otherNet, err := net.ParseCIDR(other)
+		if err != nil || len(otherNet.IP) != len(ipNet.IP) {
+			continue
+		}
+		if otherOnes, _ := otherNet.Mask.Size(); otherOnes <= ones && otherNet.Contains(ipNet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps returns true if prefixes x and y share any address. Invalid prefixes don't overlap anything.
+func Overlaps(x, y string) bool {
+	_, xNet, err := net.ParseCIDR(x)
+	if err != nil {
+		return false
+	}
+	_, yNet, err := net.ParseCIDR(y)
+	if err != nil || len(xNet.IP) != len(yNet.IP) {
+		return false
+	}
+	return xNet.Contains(yNet.IP) || yNet.Contains(xNet.IP)
+}
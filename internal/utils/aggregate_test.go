@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatePrefixes(t *testing.T) {
+	prefixes, err := utils.AggregatePrefixes([]string{
+		"168.92.0.1/24",
+		"127.0.3.1/18",
+		"127.0.0.1/16",
+		"10.0.1.0/24",
+		"10.0.0.0/24",
+		"fd00::2:0/112",
+		"fd00::/112",
+		"134.56.0.1/8",
+		"168.92.0.1/16",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"10.0.0.0/23",
+		"127.0.0.0/16",
+		"134.0.0.0/8",
+		"168.92.0.0/16",
+		"fd00::/112",
+		"fd00::2:0/112",
+	}, prefixes)
+
+	_, err = utils.AggregatePrefixes([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+}
+
+func TestCanonicalPrefixes(t *testing.T) {
+	prefixes, err := utils.CanonicalPrefixes([]string{
+		"FD00:0:0::1/64",
+		"10.0.1.7/24",
+		"::ffff:192.168.1.0/120",
+		"10.0.0.0/8",
+		"10.0.1.0/24",
+		"2001:db8::/32",
+		"10.0.0.0/24",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"10.0.0.0/8",
+		"10.0.0.0/24",
+		"10.0.1.0/24",
+		"192.168.1.0/24",
+		"2001:db8::/32",
+		"fd00::/64",
+	}, prefixes)
+
+	_, err = utils.CanonicalPrefixes([]string{"fd00::/129"})
+	require.Error(t, err)
+}
+
+func TestAggregateLargePrefixSet(t *testing.T) {
+	prefixes := make([]string, 0, 256*256)
+	for i := 255; i >= 0; i-- {
+		for j := 0; j < 256; j++ {
+			prefixes = append(prefixes, fmt.Sprintf("10.20.%d.%d/32", i, j))
+		}
+	}
+
+	aggregated, err := utils.AggregatePrefixes(prefixes)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.20.0.0/16"}, aggregated)
+}
+
+func TestCoveredBy(t *testing.T) {
+	prefixes := []string{"10.96.0.0/12", "fd00::/8"}
+	require.True(t, utils.CoveredBy("10.96.0.0/12", prefixes))
+	require.True(t, utils.CoveredBy("10.100.1.0/24", prefixes))
+	require.True(t, utils.CoveredBy("fd00:10::/64", prefixes))
+	require.False(t, utils.CoveredBy("10.0.0.0/8", prefixes))
+	require.False(t, utils.CoveredBy("192.168.0.0/16", prefixes))
+	require.False(t, utils.CoveredBy("invalid", prefixes))
+}
+
+func TestOverlaps(t *testing.T) {
+	require.True(t, utils.Overlaps("10.0.0.0/8", "10.1.2.3/32"))
+	require.True(t, utils.Overlaps("10.1.2.3/32", "10.0.0.0/8"))
+	require.False(t, utils.Overlaps("10.0.0.0/16", "10.1.0.0/16"))
+	require.False(t, utils.Overlaps("10.0.0.0/8", "fd00::/8"))
+	require.False(t, utils.Overlaps("10.0.0.0/8", "invalid"))
+}
+
+func BenchmarkAggregatePrefixes(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		prefixes := make([]string, 0, size)
+		for i := 0; i < size; i++ {
+			prefixes = append(prefixes, fmt.Sprintf("10.%d.%d.0/24", (i*7919)%256, (i*104729)%256))
+		}
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := utils.AggregatePrefixes(prefixes); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat       = "20060102T150405Z"
+	amzSigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// AWSCredentials are credentials and scope of AWS Signature Version 4 signed requests
+type AWSCredentials struct {
+	Region      string
+	Service     string
+	AccessKeyID string
+	SecretKey   string
+}
+
+// SignAWSRequest signs request with body sent at now with AWS Signature Version 4. Host, payload hash
+// and date headers are signed, URL of request should be escaped with AWSEscapePath and AWSCanonicalQuery.
+func SignAWSRequest(request *http.Request, body []byte, credentials *AWSCredentials, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.UTC().Format(amzDateFormat)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + request.Header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		request.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scopeParts := []string{amzDate[:8], credentials.Region, credentials.Service, "aws4_request"}
+	scope := strings.Join(scopeParts, "/")
+	stringToSign := strings.Join([]string{amzSigningAlgorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+	key := []byte("AWS4" + credentials.SecretKey)
+	for _, part := range scopeParts {
+		key = hmacSHA256(key, part)
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		amzSigningAlgorithm, credentials.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+// AWSEscapePath escapes path as AWS Signature Version 4 canonical URI, keeping the slashes
+func AWSEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// AWSCanonicalQuery returns query sorted and escaped as AWS Signature Version 4 canonical query string
+func AWSCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape escapes all the characters of value except the unreserved ones
+func awsEscape(value string) string {
+	var escaped strings.Builder
+	for _, c := range []byte(value) {
+		unreserved := 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9'
+		if unreserved || c == '-' || c == '_' || c == '.' || c == '~' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
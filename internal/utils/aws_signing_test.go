@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSCanonicalQuery(t *testing.T) {
+	query := url.Values{"prefix": {"nsm/excluded prefixes"}, "list-type": {"2"}, "Filter.1.Name": {"tag:nsm.io/exclude"}}
+	require.Equal(t, "Filter.1.Name=tag%3Ansm.io%2Fexclude&list-type=2&prefix=nsm%2Fexcluded%20prefixes",
+		utils.AWSCanonicalQuery(query))
+	require.Equal(t, "/bucket/excluded%2Bprefixes~1.yaml", utils.AWSEscapePath("/bucket/excluded+prefixes~1.yaml"))
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	credentials := &utils.AWSCredentials{
+		Region: "eu-west-1", Service: "s3", AccessKeyID: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI",
+	}
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	signature := func(body string) string {
+		request, err := http.NewRequest(http.MethodPut, "https://s3.eu-west-1.amazonaws.com/bucket/key", strings.NewReader(body))
+		require.NoError(t, err)
+		utils.SignAWSRequest(request, []byte(body), credentials, now)
+		require.Equal(t, "20210501T120000Z", request.Header.Get("X-Amz-Date"))
+		authorization := request.Header.Get("Authorization")
+		require.True(t, strings.HasPrefix(authorization,
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20210501/eu-west-1/s3/aws4_request, "+
+				"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="), authorization)
+		return authorization[strings.LastIndex(authorization, "=")+1:]
+	}
+
+	require.Len(t, signature("[]"), 64)
+	require.Equal(t, signature("[]"), signature("[]"))
+	require.NotEqual(t, signature("[]"), signature("- 10.96.0.0/12"))
+}
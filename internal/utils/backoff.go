@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// retryInitialBackoff is delay of the first retry, it doubles on every next failure
+	retryInitialBackoff = 100 * time.Millisecond
+	// retryMaxBackoff is the maximum delay of retry
+	retryMaxBackoff = 30 * time.Second
+)
+
+// Backoff is exponential delay of retries of failed Kubernetes API or external system requests.
+// The delay doubles from 100ms up to 30s, success resets it.
+type Backoff struct {
+	next time.Duration
+}
+
+// Wait waits the next delay of the retry, returns false if ctx is done first
+func (b *Backoff) Wait(ctx context.Context) bool {
+	if b.next == 0 {
+		b.next = retryInitialBackoff
+	}
+	timer := time.NewTimer(b.next)
+	defer timer.Stop()
+	if b.next *= 2; b.next > retryMaxBackoff {
+		b.next = retryMaxBackoff
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Reset starts delays from the initial one again
+func (b *Backoff) Reset() {
+	b.next = 0
+}
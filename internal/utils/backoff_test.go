@@ -0,0 +1,44 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := &utils.Backoff{}
+	delay := func() time.Duration {
+		started := time.Now()
+		require.True(t, backoff.Wait(context.Background()))
+		return time.Since(started)
+	}
+	require.GreaterOrEqual(t, int64(delay()), int64(100*time.Millisecond))
+	require.GreaterOrEqual(t, int64(delay()), int64(200*time.Millisecond))
+
+	backoff.Reset()
+	require.Less(t, int64(delay()), int64(200*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, backoff.Wait(ctx))
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventBus - delivers prefixes change notifications of the sources to the collector without blocking the sources.
+// Notifications published while the previous one isn't received yet are coalesced into it, so a slow collector
+// never delays event processing of the sources.
+//
+// EventBus records time of the first notification of every source not taken by the collector yet, so latency of
+// the notifications propagation to the output can be measured.
+//
+// EventBus created with batch window batches notifications of every source: the first notification is delivered
+// immediately, the following ones are suppressed until the window ends and delivered once then, so an event storm
+// is processed once per window with the final state of the source.
+type EventBus struct {
+	events    chan struct{}
+	published uint64
+	coalesced uint64
+
+	window  time.Duration
+	mutex   sync.Mutex
+	sources map[string]*EventBus
+	// pending are times of the first notifications of the sources since they were taken last time
+	pending map[string]time.Time
+	// parent and name are set for EventBus of the source returned by Source, batch is set if it batches notifications
+	parent *EventBus
+	name   string
+	batch  *sourceBatch
+}
+
+// sourceBatch batches notifications of a single source to the parent EventBus
+type sourceBatch struct {
+	parent     *EventBus
+	mutex      sync.Mutex
+	timer      *time.Timer
+	pending    bool
+	suppressed uint64
+}
+
+// EventBusStats are counters of the notifications published to EventBus
+type EventBusStats struct {
+	// Published is number of all the published notifications
+	Published uint64
+	// Coalesced is number of the notifications merged into the pending ones
+	Coalesced uint64
+	// Suppressed are numbers of the notifications suppressed by batch window per source
+	Suppressed map[string]uint64
+}
+
+// NewEventBus creates EventBus
+func NewEventBus() *EventBus {
+	return NewBatchingEventBus(0)
+}
+
+// NewBatchingEventBus creates EventBus batching notifications of every source within window, 0 disables batching
+func NewBatchingEventBus(window time.Duration) *EventBus {
+	return &EventBus{
+		events:  make(chan struct{}, 1),
+		window:  window,
+		sources: map[string]*EventBus{},
+		pending: map[string]time.Time{},
+	}
+}
+
+// Source returns EventBus the source name publishes notifications to, which batches them if the bus has batch window
+func (b *EventBus) Source(name string) *EventBus {
+	if b.parent != nil {
+		return b
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	source, ok := b.sources[name]
+	if !ok {
+		source = &EventBus{events: b.events, parent: b, name: name}
+		if b.window > 0 {
+			source.batch = &sourceBatch{parent: b}
+		}
+		b.sources[name] = source
+	}
+	return source
+}
+
+// Notify publishes notification, it never blocks
+func (b *EventBus) Notify() {
+	root := b
+	if b.parent != nil {
+		root = b.parent
+	}
+	root.markPending(b.name, time.Now())
+	if b.batch != nil {
+		b.batch.notify()
+		return
+	}
+	atomic.AddUint64(&root.published, 1)
+	root.deliver()
+}
+
+// markPending records time of the notification of the source name unless it has earlier pending one
+func (b *EventBus) markPending(name string, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.pending[name]; !ok {
+		b.pending[name] = now
+	}
+}
+
+// TakePending returns times of the first notifications per source published since the previous call.
+// Notifications published to the bus itself rather than to EventBus of a source are under empty name.
+func (b *EventBus) TakePending() map[string]time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	pending := b.pending
+	b.pending = map[string]time.Time{}
+	return pending
+}
+
+// deliver sends notification to the events channel unless there is pending one
+func (b *EventBus) deliver() {
+	select {
+	case b.events <- struct{}{}:
+	default:
+		atomic.AddUint64(&b.coalesced, 1)
+	}
+}
+
+// Events returns channel receiving the published notifications
+func (b *EventBus) Events() <-chan struct{} {
+	return b.events
+}
+
+// Stats returns counters of the published notifications
+func (b *EventBus) Stats() EventBusStats {
+	stats := EventBusStats{
+		Published: atomic.LoadUint64(&b.published),
+		Coalesced: atomic.LoadUint64(&b.coalesced),
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for name, source := range b.sources {
+		if source.batch == nil {
+			continue
+		}
+		if stats.Suppressed == nil {
+			stats.Suppressed = make(map[string]uint64, len(b.sources))
+		}
+		stats.Suppressed[name] = atomic.LoadUint64(&source.batch.suppressed)
+	}
+	return stats
+}
+
+// notify delivers the notification opening a new batch window or suppresses it until the window ends
+func (s *sourceBatch) notify() {
+	atomic.AddUint64(&s.parent.published, 1)
+	s.mutex.Lock()
+	if s.timer != nil {
+		s.pending = true
+		atomic.AddUint64(&s.suppressed, 1)
+		s.mutex.Unlock()
+		return
+	}
+	s.timer = time.AfterFunc(s.parent.window, s.flush)
+	s.mutex.Unlock()
+	s.parent.deliver()
+}
+
+// flush delivers the last notification suppressed in the ended window and opens the next one,
+// the window is closed if no notification was suppressed
+func (s *sourceBatch) flush() {
+	s.mutex.Lock()
+	if !s.pending {
+		s.timer = nil
+		s.mutex.Unlock()
+		return
+	}
+	s.pending = false
+	s.timer.Reset(s.parent.window)
+	s.mutex.Unlock()
+	s.parent.deliver()
+}
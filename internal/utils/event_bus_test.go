@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBusCoalesces(t *testing.T) {
+	bus := utils.NewEventBus()
+	for i := 0; i < 3; i++ {
+		bus.Notify()
+	}
+	require.Equal(t, utils.EventBusStats{Published: 3, Coalesced: 2}, bus.Stats())
+
+	<-bus.Events()
+	select {
+	case <-bus.Events():
+		t.Fatal("coalesced notifications are delivered")
+	default:
+	}
+
+	bus.Notify()
+	require.Len(t, bus.Events(), 1)
+}
+
+func TestEventBusBatchesSource(t *testing.T) {
+	bus := utils.NewBatchingEventBus(100 * time.Millisecond)
+	source := bus.Source("kubernetes")
+	require.Equal(t, source, bus.Source("kubernetes"))
+
+	source.Notify()
+	require.Len(t, bus.Events(), 1)
+	<-bus.Events()
+
+	for i := 0; i < 10; i++ {
+		source.Notify()
+	}
+	require.Len(t, bus.Events(), 0)
+	require.Eventually(t, func() bool {
+		return len(bus.Events()) == 1
+	}, time.Second, 10*time.Millisecond)
+	<-bus.Events()
+
+	stats := bus.Stats()
+	require.Equal(t, uint64(11), stats.Published)
+	require.Equal(t, map[string]uint64{"kubernetes": 10}, stats.Suppressed)
+}
+
+func TestEventBusPending(t *testing.T) {
+	bus := utils.NewEventBus()
+	source := bus.Source("kubernetes")
+	before := time.Now()
+	source.Notify()
+	first := bus.TakePending()["kubernetes"]
+	require.False(t, first.Before(before))
+
+	source.Notify()
+	source.Notify()
+	bus.Notify()
+	require.Equal(t, utils.EventBusStats{Published: 4, Coalesced: 3}, bus.Stats())
+
+	pending := bus.TakePending()
+	require.Len(t, pending, 2)
+	require.Contains(t, pending, "")
+	require.False(t, pending["kubernetes"].Before(first))
+	require.Len(t, bus.TakePending(), 0)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// restartInitialBackoff is delay of the first restart of panicked goroutine, it doubles on every next panic
+	restartInitialBackoff = 100 * time.Millisecond
+	// restartMaxBackoff is the maximum delay of panicked goroutine restart. Backoff is reset if goroutine runs
+	// longer than it before the next panic.
+	restartMaxBackoff = 30 * time.Second
+)
+
+// Lifecycle - accounts long running goroutines of the sources, so their shutdown can be awaited.
+// Goroutines are supervised: panics are recovered and counted, panicked goroutines are restarted with backoff,
+// so a buggy source doesn't take down collection of the others.
+// nil Lifecycle is valid and runs goroutines without accounting and supervision.
+type Lifecycle struct {
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	running  map[string]int
+	panics   map[string]uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLifecycle creates Lifecycle
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		running: map[string]int{},
+		panics:  map[string]uint64{},
+		stop:    make(chan struct{}),
+	}
+}
+
+// Go runs f in goroutine accounted under name, f is restarted if it panics until Wait is called
+func (l *Lifecycle) Go(name string, f func()) {
+	if l == nil {
+		go f()
+		return
+	}
+
+	l.mutex.Lock()
+	l.running[name]++
+	l.mutex.Unlock()
+	l.wg.Add(1)
+
+	go func() {
+		defer l.wg.Done()
+		defer func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			if l.running[name]--; l.running[name] == 0 {
+				delete(l.running, name)
+			}
+		}()
+		l.supervise(name, f)
+	}()
+}
+
+// supervise runs f and restarts it with backoff every time it panics until Wait is called
+func (l *Lifecycle) supervise(name string, f func()) {
+	backoff := restartInitialBackoff
+	for {
+		started := time.Now()
+		if !l.recovered(name, f) {
+			return
+		}
+		if time.Since(started) > restartMaxBackoff {
+			backoff = restartInitialBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-l.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		logrus.Warnf("Restarting goroutine %s after panic", name)
+		if backoff *= 2; backoff > restartMaxBackoff {
+			backoff = restartMaxBackoff
+		}
+	}
+}
+
+// recovered runs f, returns true if it panicked. Panic is counted and logged with the stack trace.
+func (l *Lifecycle) recovered(name string, f func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.mutex.Lock()
+			l.panics[name]++
+			l.mutex.Unlock()
+			logrus.Errorf("Goroutine %s panicked: %v\n%s", name, r, debug.Stack())
+			panicked = true
+		}
+	}()
+	f()
+	return false
+}
+
+// Panics returns numbers of the recovered panics per goroutine name, nil if there were none
+func (l *Lifecycle) Panics() map[string]uint64 {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.panics) == 0 {
+		return nil
+	}
+	panics := make(map[string]uint64, len(l.panics))
+	for name, count := range l.panics {
+		panics[name] = count
+	}
+	return panics
+}
+
+// Wait stops restarts of the panicked goroutines and waits for all the accounted goroutines to stop for timeout.
+// Returns sorted names of the goroutines, which are still running.
+func (l *Lifecycle) Wait(timeout time.Duration) []string {
+	if l == nil {
+		return nil
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	stopped := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+		return nil
+	case <-timer.C:
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	running := make([]string, 0, len(l.running))
+	for name := range l.running {
+		running = append(running, name)
+	}
+	sort.Strings(running)
+	return running
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleWait(t *testing.T) {
+	lifecycle := utils.NewLifecycle()
+	release := make(chan struct{})
+	lifecycle.Go("stopped", func() {})
+	lifecycle.Go("blocked", func() { <-release })
+
+	require.Equal(t, []string{"blocked"}, lifecycle.Wait(50*time.Millisecond))
+
+	close(release)
+	require.Empty(t, lifecycle.Wait(time.Second))
+}
+
+func TestLifecycleRestartsPanicked(t *testing.T) {
+	lifecycle := utils.NewLifecycle()
+	runs := make(chan int, 3)
+	count := 0
+	lifecycle.Go("buggy", func() {
+		count++
+		runs <- count
+		if count < 3 {
+			panic("unexpected resource shape")
+		}
+	})
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case run := <-runs:
+			require.Equal(t, i, run)
+		case <-time.After(time.Second):
+			require.FailNow(t, "goroutine isn't restarted")
+		}
+	}
+	require.Empty(t, lifecycle.Wait(time.Second))
+	require.Equal(t, map[string]uint64{"buggy": 2}, lifecycle.Panics())
+}
+
+func TestLifecycleWaitStopsRestarts(t *testing.T) {
+	lifecycle := utils.NewLifecycle()
+	lifecycle.Go("buggy", func() { panic("unexpected resource shape") })
+
+	require.Eventually(t, func() bool { return lifecycle.Panics()["buggy"] == 1 }, time.Second, time.Millisecond)
+	require.Empty(t, lifecycle.Wait(time.Second))
+}
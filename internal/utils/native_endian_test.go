@@ -0,0 +1,44 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"encoding/binary"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bigEndianArchitectures are GOARCH values of the big endian architectures Go supports
+var bigEndianArchitectures = map[string]bool{
+	"mips": true, "mips64": true, "ppc64": true, "s390x": true,
+}
+
+func TestNativeEndian(t *testing.T) {
+	if bigEndianArchitectures[runtime.GOARCH] {
+		require.Equal(t, binary.BigEndian, utils.NativeEndian)
+	} else {
+		require.Equal(t, binary.LittleEndian, utils.NativeEndian)
+	}
+
+	value := uint32(0x01020304)
+	memory := (*[4]byte)(unsafe.Pointer(&value))[:]
+	require.Equal(t, value, utils.NativeEndian.Uint32(memory))
+}
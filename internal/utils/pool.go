@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"math/big"
+	"net"
+)
+
+// FreeAddresses returns number of the pool addresses not covered by excluded prefixes
+func FreeAddresses(pool, excluded []string) (*big.Int, error) {
+	poolNetworks, err := aggregatedNetworks(pool)
+	if err != nil {
+		return nil, err
+	}
+	excludedNetworks, err := aggregatedNetworks(excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	free := new(big.Int)
+	for _, poolNet := range poolNetworks {
+		poolFree := networkSize(poolNet)
+		for _, excludedNet := range excludedNetworks {
+			if len(excludedNet.IP) != len(poolNet.IP) {
+				continue
+			}
+			if excludedNet.Contains(poolNet.IP) && networkSize(excludedNet).Cmp(networkSize(poolNet)) >= 0 {
+				poolFree.SetInt64(0)
+				break
+			}
+			if poolNet.Contains(excludedNet.IP) {
+				poolFree.Sub(poolFree, networkSize(excludedNet))
+			}
+		}
+		free.Add(free, poolFree)
+	}
+	return free, nil
+}
+
+// aggregatedNetworks returns networks of the aggregated prefixes, which don't overlap each other
+func aggregatedNetworks(prefixes []string) ([]*net.IPNet, error) {
+	aggregated, err := AggregatePrefixes(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	networks := make([]*net.IPNet, 0, len(aggregated))
+	for _, prefix := range aggregated {
+		_, ipNet, _ := net.ParseCIDR(prefix)
+		networks = append(networks, ipNet)
+	}
+	return networks, nil
+}
+
+// networkSize returns number of the network addresses
+func networkSize(ipNet *net.IPNet) *big.Int {
+	ones, bits := ipNet.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+}
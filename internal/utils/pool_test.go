@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeAddresses(t *testing.T) {
+	for _, sample := range []struct {
+		pool     []string
+		excluded []string
+		free     int64
+	}{
+		{pool: []string{"169.254.0.0/16"}, excluded: nil, free: 65536},
+		{pool: []string{"169.254.0.0/16"}, excluded: []string{"169.254.0.0/24", "169.254.1.0/24", "10.0.0.0/8"}, free: 65024},
+		{pool: []string{"169.254.0.0/16"}, excluded: []string{"169.0.0.0/8"}, free: 0},
+		{pool: []string{"169.254.0.0/24", "169.254.0.0/25"}, excluded: []string{"169.254.0.0/26"}, free: 192},
+		{pool: []string{"fd00::/120"}, excluded: []string{"169.254.0.0/16", "fd00::/121"}, free: 128},
+	} {
+		free, err := utils.FreeAddresses(sample.pool, sample.excluded)
+		require.NoError(t, err)
+		require.Equal(t, sample.free, free.Int64(), "pool %v excluded %v", sample.pool, sample.excluded)
+	}
+
+	_, err := utils.FreeAddresses([]string{"invalid"}, nil)
+	require.Error(t, err)
+}
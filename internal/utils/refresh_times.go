@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RefreshTimes - synchronized container of the last times sources refreshed their prefixes by source name or watch key.
+// Source is refreshed when it successfully fetches its prefixes or gets watch event, even if prefixes are the same.
+// nil RefreshTimes is valid and doesn't keep anything.
+type RefreshTimes struct {
+	mutex sync.Mutex
+	times map[string]time.Time
+}
+
+// NewRefreshTimes creates RefreshTimes
+func NewRefreshTimes() *RefreshTimes {
+	return &RefreshTimes{times: map[string]time.Time{}}
+}
+
+// Touch sets refresh time of the source name to now
+func (r *RefreshTimes) Touch(name string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.times[name] = time.Now()
+}
+
+// Load returns refresh time of the source name, zero time if it isn't refreshed
+func (r *RefreshTimes) Load(name string) time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.times[name]
+}
+
+// Snapshot returns copy of all refresh times
+func (r *RefreshTimes) Snapshot() map[string]time.Time {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	snapshot := make(map[string]time.Time, len(r.times))
+	for name, refreshed := range r.times {
+		snapshot[name] = refreshed
+	}
+	return snapshot
+}
+
+// Latest returns the latest refresh time of all the sources, zero time if none of them is refreshed
+func (r *RefreshTimes) Latest() time.Time {
+	var latest time.Time
+	for _, refreshed := range r.Snapshot() {
+		if refreshed.After(latest) {
+			latest = refreshed
+		}
+	}
+	return latest
+}
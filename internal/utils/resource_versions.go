@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+)
+
+// ResourceVersions - synchronized container of the last observed Kubernetes resource versions by watch key.
+// nil ResourceVersions is valid and doesn't keep anything.
+type ResourceVersions struct {
+	mutex    sync.Mutex
+	versions map[string]string
+}
+
+// NewResourceVersions creates ResourceVersions filled with versions
+func NewResourceVersions(versions map[string]string) *ResourceVersions {
+	container := &ResourceVersions{versions: map[string]string{}}
+	for key, version := range versions {
+		container.versions[key] = version
+	}
+	return container
+}
+
+// Load returns resource version stored by key
+func (r *ResourceVersions) Load(key string) string {
+	if r == nil {
+		return ""
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.versions[key]
+}
+
+// Store sets resource version by key, empty version removes the key
+func (r *ResourceVersions) Store(key, version string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if version == "" {
+		delete(r.versions, key)
+		return
+	}
+	r.versions[key] = version
+}
+
+// Snapshot returns copy of all stored resource versions
+func (r *ResourceVersions) Snapshot() map[string]string {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	snapshot := make(map[string]string, len(r.versions))
+	for key, version := range r.versions {
+		snapshot[key] = version
+	}
+	return snapshot
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+)
+
+// ResyncSignal - broadcasts forced resync requests to its subscribers.
+// nil ResyncSignal is valid and never requests resync.
+type ResyncSignal struct {
+	mutex       sync.Mutex
+	subscribers []chan struct{}
+}
+
+// NewResyncSignal creates ResyncSignal
+func NewResyncSignal() *ResyncSignal {
+	return &ResyncSignal{}
+}
+
+// Subscribe returns channel receiving resync requests. Requests made while the previous one isn't received yet
+// are merged into it.
+func (s *ResyncSignal) Subscribe() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	subscriber := make(chan struct{}, 1)
+	s.subscribers = append(s.subscribers, subscriber)
+	return subscriber
+}
+
+// Trigger requests resync from all the subscribers
+func (s *ResyncSignal) Trigger() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, subscriber := range s.subscribers {
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WaitSettled waits until notify doesn't receive notifications for settle time
+func WaitSettled(ctx context.Context, notify <-chan struct{}, settle time.Duration) error {
+	timer := time.NewTimer(settle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-notify:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(settle)
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "Sources haven't settled")
+		}
+	}
+}
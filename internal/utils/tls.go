@@ -0,0 +1,149 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ClientTLSConfig returns TLS config of the clients: CA bundle caPath is trusted in addition to the system CAs and
+// client certificate certPath with key keyPath is presented if they are set. Returns nil if none of them is set.
+// Client certificate is read on every handshake, so rotated certificates are picked up without restart.
+func ClientTLSConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	if caPath == "" && certPath == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caPath != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if err := appendCertsFromFile(pool, caPath); err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certPath != "" {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+			return &certificate, errors.Wrap(err, "Failed to load client certificate")
+		}
+	}
+	return tlsConfig, nil
+}
+
+// ServerTLSConfig returns TLS config of the servers presenting certificate certPath with key keyPath. Clients
+// are required to present certificates issued by CA bundle clientCAPath if it is set. Returns nil if certPath
+// isn't set. Server certificate is read on every handshake, so rotated certificates are picked up without restart.
+func ServerTLSConfig(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	if certPath == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+			return &certificate, errors.Wrap(err, "Failed to load server certificate")
+		},
+	}
+	if clientCAPath != "" {
+		pool := x509.NewCertPool()
+		if err := appendCertsFromFile(pool, clientCAPath); err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// AuthorizeSpiffeIDs makes tlsConfig accept only peers, which certificates have one of SPIFFE ids as URI SAN.
+// SPIFFE X.509 SVIDs identify workloads by URI SAN only, so client configs verify the server certificate chain
+// with RootCAs, the system CAs if they are nil, skipping host name verification. Server configs should require
+// and verify client certificates.
+func AuthorizeSpiffeIDs(tlsConfig *tls.Config, ids []string) {
+	authorized := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		authorized[id] = true
+	}
+	verifyClient := tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert
+	roots := tlsConfig.RootCAs
+	tlsConfig.InsecureSkipVerify = !verifyClient
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certificates := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, rawCert := range rawCerts {
+			certificate, err := x509.ParseCertificate(rawCert)
+			if err != nil {
+				return errors.Wrap(err, "Can not parse peer certificate")
+			}
+			certificates = append(certificates, certificate)
+		}
+		if len(certificates) == 0 {
+			return errors.New("Peer presented no certificate")
+		}
+		if !verifyClient {
+			intermediates := x509.NewCertPool()
+			for _, certificate := range certificates[1:] {
+				intermediates.AddCert(certificate)
+			}
+			if _, err := certificates[0].Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			}); err != nil {
+				return errors.Wrap(err, "Failed to verify peer certificate")
+			}
+		}
+		for _, uri := range certificates[0].URIs {
+			if authorized[uri.String()] {
+				return nil
+			}
+		}
+		return errors.Errorf("Peer certificate has no authorized SPIFFE ID: %v", certificates[0].URIs)
+	}
+}
+
+// ValidateSpiffeID checks id is spiffe://trust-domain/path SPIFFE ID
+func ValidateSpiffeID(id string) error {
+	spiffeURL, err := url.Parse(id)
+	if err != nil || spiffeURL.Scheme != "spiffe" || spiffeURL.Host == "" || spiffeURL.RawQuery != "" ||
+		spiffeURL.Fragment != "" || spiffeURL.User != nil {
+		return errors.Errorf("SPIFFE ID %q should be spiffe://trust-domain/path URI", id)
+	}
+	return nil
+}
+
+// appendCertsFromFile adds PEM certificates of CA bundle caPath to pool
+func appendCertsFromFile(pool *x509.CertPool, caPath string) error {
+	data, err := ioutil.ReadFile(filepath.Clean(caPath))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read CA bundle %s", caPath)
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.Errorf("CA bundle %s doesn't contain PEM certificates", caPath)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	collectorSpiffeID = "spiffe://example.org/ns/nsm-system/sa/collector"
+	agentSpiffeID     = "spiffe://example.org/ns/nsm-system/sa/agent"
+	otherSpiffeID     = "spiffe://example.org/ns/default/sa/other"
+)
+
+func TestAuthorizeSpiffeIDs(t *testing.T) {
+	dir := t.TempDir()
+	writeSVIDs(t, dir, map[string]string{"collector": collectorSpiffeID, "agent": agentSpiffeID, "other": otherSpiffeID})
+
+	serverConfig, err := utils.ServerTLSConfig(filepath.Join(dir, "collector.pem"), filepath.Join(dir, "collector-key.pem"),
+		filepath.Join(dir, "bundle.pem"))
+	require.NoError(t, err)
+	utils.AuthorizeSpiffeIDs(serverConfig, []string{agentSpiffeID})
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		}
+	}()
+
+	request := func(client string, serverIDs ...string) error {
+		clientConfig, err := utils.ClientTLSConfig(filepath.Join(dir, "bundle.pem"), filepath.Join(dir, client+".pem"),
+			filepath.Join(dir, client+"-key.pem"))
+		require.NoError(t, err)
+		utils.AuthorizeSpiffeIDs(clientConfig, serverIDs)
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = ioutil.ReadAll(conn)
+		return err
+	}
+
+	// server certificate is verified by SPIFFE ID, it has no host name of the address
+	require.NoError(t, request("agent", collectorSpiffeID))
+	require.Error(t, request("agent", otherSpiffeID))
+	require.Error(t, request("other", collectorSpiffeID))
+}
+
+func TestValidateSpiffeID(t *testing.T) {
+	require.NoError(t, utils.ValidateSpiffeID(agentSpiffeID))
+	for _, id := range []string{"", "example.org/agent", "https://example.org/agent", "spiffe:///agent", "spiffe://example.org/agent?x=1"} {
+		require.Error(t, utils.ValidateSpiffeID(id), id)
+	}
+}
+
+// writeSVIDs writes bundle.pem CA and X.509 SVIDs <name>.pem of the SPIFFE IDs by names it issued
+// with their <name>-key.pem keys to dir
+func writeSVIDs(t *testing.T, dir string, ids map[string]string) {
+	now := time.Now()
+	caPublic, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.org"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, caPublic, caKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "bundle.pem"), "CERTIFICATE", caDER)
+
+	serial := int64(1)
+	for name, id := range ids {
+		spiffeID, err := url.Parse(id)
+		require.NoError(t, err)
+		public, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		serial++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			URIs:         []*url.URL{spiffeID},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, public, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+		writePEM(t, filepath.Join(dir, name+"-key.pem"), "PRIVATE KEY", keyDER)
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
@@ -69,3 +69,18 @@ func UnorderedSlicesEquals(x, y []string) bool {
 	}
 	return len(diff) == 0
 }
+
+// Difference returns elements of specified slice x, which are not present in specified slice y
+func Difference(x, y []string) []string {
+	present := make(map[string]struct{}, len(y))
+	for _, yValue := range y {
+		present[yValue] = struct{}{}
+	}
+	var diff []string
+	for _, xValue := range x {
+		if _, ok := present[xValue]; !ok {
+			diff = append(diff, xValue)
+		}
+	}
+	return diff
+}
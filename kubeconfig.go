@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/networkservicemesh/sdk-k8s/pkg/k8s"
+)
+
+// clientConfig returns Kubernetes client config of the collector: config of the kubeconfig context if it is set,
+// in cluster one otherwise. Impersonation, user agent, rate limit, APF retry, timeout and keep-alive settings are applied
+// to both of them.
+func clientConfig(config *prefixcollector.Config) (*rest.Config, error) {
+	var clientSetConfig *rest.Config
+	var err error
+	if config.UsesKubeconfig() {
+		clientSetConfig, err = kubeconfigClientConfig(config).ClientConfig()
+	} else {
+		clientSetConfig, err = k8s.NewClientSetConfig()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to build Kubernetes client config")
+	}
+
+	clientSetConfig.Impersonate = rest.ImpersonationConfig{
+		UserName: config.ImpersonateUser,
+		Groups:   config.ImpersonateGroups,
+	}
+	if config.APIUserAgent != "" {
+		clientSetConfig.UserAgent = config.APIUserAgent
+	}
+	clientSetConfig.QPS = config.APIClientQPS
+	clientSetConfig.Burst = config.APIClientBurst
+	if config.APFRetries > 0 {
+		clientSetConfig.Wrap(apfRetryWrapper(config.APFRetries))
+	}
+	// timeout wraps APF retries, so it limits the whole request
+	if config.APIRequestTimeout > 0 {
+		clientSetConfig.Wrap(requestTimeoutWrapper(config.APIRequestTimeout))
+	}
+	clientSetConfig.Dial = apiDialer(config.APIDialTimeout, config.APIKeepAlive)
+	return clientSetConfig, nil
+}
+
+// kubeconfigClientConfig returns client config of the configured kubeconfig and context,
+// KUBECONFIG or ~/.kube/config and their current context are used if they aren't set
+func kubeconfigClientConfig(config *prefixcollector.Config) clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = config.Kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: config.KubeconfigContext})
+}
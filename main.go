@@ -17,18 +17,23 @@
 package main
 
 import (
+	"cmd-exclude-prefixes-k8s/internal/aggregation"
 	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
-	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/utils"
 	"context"
+	"crypto/tls"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
-
-	"github.com/networkservicemesh/sdk-k8s/pkg/k8s"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/networkservicemesh/sdk/pkg/tools/jaeger"
@@ -38,6 +43,7 @@ import (
 const (
 	envPrefix            = "exclude_prefixes_k8s"
 	currentNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	httpAPIReadTimeout   = 10 * time.Second
 )
 
 func main() {
@@ -60,59 +66,249 @@ func main() {
 
 	// Get clientSetConfig from environment
 	config := &prefixcollector.Config{}
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			span.Logger().Fatal(err)
+		}
+		return
+	}
+
 	if err := envconfig.Usage(envPrefix, config); err != nil {
 		span.Logger().Fatal(err)
 	}
-	if err := envconfig.Process(envPrefix, config); err != nil {
-		span.Logger().Fatalf("Error processing clientSetConfig from env: %v", err)
+	if err := loadConfig(config); err != nil {
+		span.Logger().Fatal(err)
 	}
-	if err := config.Validate(); err != nil {
-		span.Logger().Fatalf("Error validating Config from env: %v", err)
+
+	if config.Mode == prefixcollector.AgentMode {
+		span.Finish()
+		if err := runAgent(ctx, config); err != nil {
+			logrus.Fatal(err)
+		}
+		return
 	}
 
 	span.Logger().Info("Building Kubernetes clientSet...")
-	clientSetConfig, err := k8s.NewClientSetConfig()
+	ctx, clientSet, err := withKubernetesClients(ctx, config)
+	if err != nil {
+		span.Logger().Fatal(err)
+	}
+	span.Logger().Info("Starting prefix service...")
+
+	ctx, prefixCollector, err := newCollector(ctx, config, clientSet)
 	if err != nil {
-		span.Logger().Fatalf("Failed to build Kubernetes clientSet: %v", err)
+		span.Logger().Fatal(err)
 	}
 
-	span.Logger().Info("Starting prefix service...")
+	span.Finish() // exclude main cycle run time from span timing
+	prefixCollector.Serve(ctx)
+}
+
+// newCollector builds sources and outputs of the configured collector using Kubernetes clients of ctx.
+// Returns ctx with the state shared by them the collector should be served with.
+func newCollector(ctx context.Context, config *prefixcollector.Config,
+	clientSet kubernetes.Interface) (context.Context, *prefixcollector.ExcludedPrefixCollector, error) {
+	logrus.Infof("Collector pod namespace: %q, node: %q", config.PodNamespace, config.NodeName)
+
+	var outputNamespace string
+	if config.UsesNSMNamespace() {
+		var err error
+		if outputNamespace, err = nsmConfigMapNamespace(config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctx = withSharedState(ctx, resourceVersions(ctx, config, outputNamespace))
+	ctx = prefixcollector.WithSecretsCheckInterval(ctx, config.SecretsCheckInterval)
+
+	entries, err := withSourceCredentials(config, nodeSelectedEntries(ctx, clientSet, config, sourceEntries(config)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.ProbeAccess {
+		probeOutputAccess(ctx, clientSet, outputRules(config, outputNamespace))
+	}
+
+	bus := utils.NewBatchingEventBus(config.EventBatchWindow)
+	sources, disabledSources := initSources(ctx, clientSet, config, entries, bus)
+	var aggregator *aggregation.Aggregator
+	if config.AggregatorListenURL != "" && featureEnabled(config, prefixcollector.CollectorAPIFeature, true) {
+		if sources, aggregator, err = serveCollectorAPI(ctx, config, bus, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	options, err := outputOptions(config, outputNamespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.OutputOwner != "" {
+		owner, err := prefixcollector.ResolveOwnerReference(ctx, config.OutputOwner, outputNamespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, prefixcollector.WithOwnerReference(owner))
+	}
+	if aggregator != nil {
+		options = append(options, prefixcollector.WithPublisher(aggregator))
+	}
+	options = append(options,
+		prefixcollector.WithEventBus(bus),
+		prefixcollector.WithSources(sources...),
+		prefixcollector.WithDegradedSources(disabledSources...),
+	)
+	apiOptions, err := serveHTTPAPIs(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctx, prefixcollector.NewExcludePrefixCollector(append(options, apiOptions...)...), nil
+}
 
+// serveHTTPAPIs serves the configured HTTP APIs until ctx is done, APIs configured with the same address
+// share the server. APIs are served with TLS of apiTLSConfig if the API certificate is configured.
+// Returns options of the collector the APIs require.
+func serveHTTPAPIs(ctx context.Context, config *prefixcollector.Config) ([]prefixcollector.Option, error) {
+	tlsConfig, err := apiTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	var options []prefixcollector.Option
+	muxes := map[string]*http.ServeMux{}
+	handle := func(address, path string, handler http.Handler) {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		muxes[address].Handle(path, handler)
+		logrus.Infof("Serving %s API on %s%s", strings.TrimPrefix(path, "/"), address, path)
+	}
+
+	if config.ResyncListenAddress != "" {
+		handle(config.ResyncListenAddress, prefixcollector.ResyncPath, prefixcollector.ResyncHandler(prefixcollector.ResyncSignal(ctx)))
+		handle(config.ResyncListenAddress, prefixcollector.ReauthPath, prefixcollector.ReauthHandler(prefixcollector.ReauthSignal(ctx)))
+	}
+	if config.MetricsListenAddress != "" {
+		metrics := prefixcollector.NewPropagationMetrics()
+		options = append(options, prefixcollector.WithPropagationMetrics(metrics))
+		handle(config.MetricsListenAddress, prefixcollector.MetricsPath, prefixcollector.MetricsHandler(metrics))
+	}
+	if config.ChangelogListenAddress != "" {
+		changelog := prefixcollector.NewChangelog(config.ChangelogSize)
+		options = append(options, prefixcollector.WithChangelog(changelog))
+		handle(config.ChangelogListenAddress, prefixcollector.ChangelogPath, prefixcollector.ChangelogHandler(changelog))
+	}
+	if config.DashboardListenAddress != "" {
+		dashboard := prefixcollector.NewDashboard(config.DashboardChanges)
+		options = append(options, prefixcollector.WithDashboard(dashboard))
+		handle(config.DashboardListenAddress, prefixcollector.DashboardPath, prefixcollector.DashboardHandler(dashboard))
+	}
+	if config.ReservationsListenAddress != "" {
+		clientSet := prefixcollector.KubernetesInterface(ctx)
+		handle(config.ReservationsListenAddress, prefixcollector.ReservationsPath, prefixcollector.ReservationsHandler(
+			clientSet.CoreV1().ConfigMaps(config.ReservationsNamespace), config.ReservationsConfigMapName,
+			prefixcollector.TokenReviewRequester(clientSet),
+			prefixcollector.SubjectAccessReviewAuthorizer(clientSet, config.ReservationsNamespace)))
+	}
+	for address, mux := range muxes {
+		serveHTTPAPI(ctx, address, mux, tlsConfig)
+	}
+	return options, nil
+}
+
+// withKubernetesClients builds Kubernetes clients of the collector config and puts them to context
+func withKubernetesClients(ctx context.Context, config *prefixcollector.Config) (context.Context, kubernetes.Interface, error) {
+	clientSetConfig, err := clientConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
 	clientSet, err := kubernetes.NewForConfig(clientSetConfig)
 	if err != nil {
-		span.Logger().Fatalf("Failed to build Kubernetes clientSet: %v", err)
+		return nil, nil, errors.Wrap(err, "Failed to build Kubernetes clientSet")
+	}
+	dynamicClient, err := dynamic.NewForConfig(clientSetConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to build Kubernetes dynamic client")
 	}
 
 	ctx = prefixcollector.WithKubernetesInterface(ctx, kubernetes.Interface(clientSet))
+	ctx = prefixcollector.WithDynamicInterface(ctx, dynamicClient)
+	ctx = prefixcollector.WithWatchTimeout(ctx, config.APIWatchTimeout)
+	return ctx, clientSet, nil
+}
+
+// withSharedState puts state shared by the sources and the collector to context
+func withSharedState(ctx context.Context, versions *utils.ResourceVersions) context.Context {
+	ctx = prefixcollector.WithResourceVersions(ctx, versions)
+	ctx = prefixcollector.WithResyncSignal(ctx, utils.NewResyncSignal())
+	ctx = prefixcollector.WithReauthSignal(ctx, utils.NewResyncSignal())
+	ctx = prefixcollector.WithRefreshTimes(ctx, utils.NewRefreshTimes())
+	return prefixcollector.WithLifecycle(ctx, utils.NewLifecycle())
+}
 
-	prefixesOutputOption := prefixcollector.WithFileOutput(config.OutputFilePath)
+// serveHTTPAPI serves HTTP API of handler on address until ctx is done, with TLS if tlsConfig isn't nil
+func serveHTTPAPI(ctx context.Context, address string, handler http.Handler, tlsConfig *tls.Config) {
+	server := &http.Server{Addr: address, Handler: handler, ReadHeaderTimeout: httpAPIReadTimeout, TLSConfig: tlsConfig}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		serve := server.ListenAndServe
+		if tlsConfig != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != http.ErrServerClosed {
+			logrus.Fatalf("Failed to serve HTTP API on %s: %v", address, err)
+		}
+	}()
+}
+
+// resourceVersions returns resource versions persisted in the output config map, so the sources resume from them
+func resourceVersions(ctx context.Context, config *prefixcollector.Config, outputNamespace string) *utils.ResourceVersions {
 	if config.PrefixesOutputType == prefixcollector.ConfigMapOutputType {
-		currentNamespaceBytes, ioErr := ioutil.ReadFile(currentNamespacePath)
-		if ioErr != nil {
-			span.Logger().Fatalf("Error reading namespace from secret: %v", ioErr)
+		versions, err := prefixcollector.LoadResourceVersions(ctx, config.NSMConfigMapName, outputNamespace)
+		if err == nil {
+			return versions
 		}
-		currentNamespace := strings.TrimSpace(string(currentNamespaceBytes))
-		prefixesOutputOption = prefixcollector.WithConfigMapOutput(config.NSMConfigMapName, currentNamespace)
+		logrus.Warnf("Unable to load persisted resource versions: %v", err)
 	}
+	return utils.NewResourceVersions(nil)
+}
 
-	if err != nil {
-		span.Logger().Fatal(err)
+// loadConfig processes and validates config from environment
+func loadConfig(config *prefixcollector.Config) error {
+	if err := envconfig.Process(envPrefix, config); err != nil {
+		return errors.Wrap(err, "Error processing clientSetConfig from env")
+	}
+	if err := config.Validate(); err != nil {
+		return errors.Wrap(err, "Error validating Config from env")
 	}
+	return nil
+}
 
-	notifyChan := make(chan struct{}, 1)
-	prefixCollector := prefixcollector.NewExcludePrefixCollector(
-		prefixesOutputOption,
-		prefixcollector.WithNotifyChan(notifyChan),
-		prefixcollector.WithSources(
-			prefixsource.NewEnvPrefixSource(config.ExcludedPrefixes),
-			prefixsource.NewKubeAdmPrefixSource(ctx, notifyChan),
-			prefixsource.NewKubernetesPrefixSource(ctx, notifyChan),
-			prefixsource.NewConfigMapPrefixSource(ctx, notifyChan, config.ConfigMapName, config.ConfigMapNamespace),
-		),
-	)
+// nsmConfigMapNamespace returns namespace of the output config map
+func nsmConfigMapNamespace(config *prefixcollector.Config) (string, error) {
+	if config.NSMConfigMapNamespace != "" {
+		return config.NSMConfigMapNamespace, nil
+	}
+	return currentNamespace(config)
+}
+
+// currentNamespace returns the namespace the collector runs in. Namespace provided by the Downward API
+// takes priority over the one mounted with the service account secret. Collector running out of cluster
+// uses namespace of the kubeconfig context.
+func currentNamespace(config *prefixcollector.Config) (string, error) {
+	if config.PodNamespace != "" {
+		return config.PodNamespace, nil
+	}
+	if config.UsesKubeconfig() {
+		namespace, _, err := kubeconfigClientConfig(config).Namespace()
+		return namespace, errors.Wrap(err, "Error reading namespace of kubeconfig context")
+	}
 
-	go prefixCollector.Serve(ctx)
+	currentNamespaceBytes, err := ioutil.ReadFile(currentNamespacePath)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading namespace from secret")
+	}
 
-	span.Finish() // exclude main cycle run time from span timing
-	<-ctx.Done()
+	return strings.TrimSpace(string(currentNamespaceBytes)), nil
 }
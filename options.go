@@ -0,0 +1,263 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/networkservicemesh/api/pkg/api/networkservice"
+	"github.com/networkservicemesh/sdk/pkg/tools/grpcutils"
+)
+
+// outputOptions returns collector options configuring the output and its extensions
+func outputOptions(config *prefixcollector.Config, outputNamespace string) ([]prefixcollector.Option, error) {
+	options := []prefixcollector.Option{prefixcollector.WithFileOutput(config.OutputFilePath)}
+	if config.PrefixesOutputType == prefixcollector.ConfigMapOutputType {
+		options = []prefixcollector.Option{prefixcollector.WithConfigMapOutput(config.NSMConfigMapName, outputNamespace)}
+	}
+	options = append(options, layoutOptions(config)...)
+	if config.OutputPaused {
+		options = append(options, prefixcollector.WithOutputPaused())
+	}
+	options = append(options, sourceStateOptions(config)...)
+	if config.CanaryConfigMapName != "" {
+		options = append(options,
+			prefixcollector.WithCanary(config.CanaryConfigMapName, outputNamespace, config.CanarySoakTime))
+	}
+
+	if config.SigningKeyPath != "" {
+		signingKey, err := prefixcollector.LoadSigningKey(config.SigningKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, prefixcollector.WithSigningKey(signingKey, config.PublicKeyConfigMapName))
+	}
+
+	sinks, err := sinkOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, sinks...)
+
+	if config.AuditFilePath != "" {
+		options = append(options, prefixcollector.WithAuditFile(config.AuditFilePath))
+	}
+	if config.AuditConfigMapName != "" {
+		options = append(options,
+			prefixcollector.WithAuditConfigMap(config.AuditConfigMapName, outputNamespace, config.AuditConfigMapSize))
+	}
+	exports, err := exportOptions(config, outputNamespace)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, exports...)
+	monitoring, err := monitoringOptions(config, outputNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return append(options, monitoring...), nil
+}
+
+// exportOptions returns collector options configuring export of the prefixes to systems outside the cluster
+func exportOptions(config *prefixcollector.Config, outputNamespace string) ([]prefixcollector.Option, error) {
+	var options []prefixcollector.Option
+	if config.PublisherURL != "" {
+		publisher, err := changesPublisher(config)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, prefixcollector.WithPublisher(publisher))
+	}
+	if config.BGPPeerAddress != "" {
+		bgpOptions, err := config.BGPOptions()
+		if err != nil {
+			return nil, err
+		}
+		announcer, err := prefixcollector.NewBGPAnnouncer(bgpOptions)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, prefixcollector.WithBGPAnnouncer(announcer))
+	}
+	if config.BackupBucketURL != "" {
+		store, err := backupStore(config)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, prefixcollector.WithBackup(store, config.BackupRetention, config.BackupRetentionCount))
+		if config.BackupRestore {
+			options = append(options, prefixcollector.WithBackupRestore(store, config.NSMConfigMapName,
+				outputNamespace, config.BackupRestoreHoldTime))
+		}
+	}
+	return options, nil
+}
+
+// monitoringOptions returns collector options configuring status and checks of the output propagation
+func monitoringOptions(config *prefixcollector.Config, outputNamespace string) ([]prefixcollector.Option, error) {
+	var options []prefixcollector.Option
+	if config.StatusResourceName != "" {
+		options = append(options, prefixcollector.WithStatusResource(config.StatusResourceName, outputNamespace))
+	}
+	if config.ConsumerSelector != "" {
+		selector, _ := labels.Parse(config.ConsumerSelector)
+		options = append(options,
+			prefixcollector.WithConsumerTracking(config.ConsumerNamespace, selector, config.ConsumerCheckInterval))
+	}
+	if len(config.NSMManagerURLs) > 0 {
+		managers, err := nsmManagerClients(config.NSMManagerURLs)
+		if err != nil {
+			return nil, err
+		}
+		var eventConfigMapName string
+		if config.PrefixesOutputType == prefixcollector.ConfigMapOutputType {
+			eventConfigMapName = config.NSMConfigMapName
+		}
+		options = append(options, prefixcollector.WithAllocationCheck(eventConfigMapName, outputNamespace,
+			config.AllocationCheckTimeout, managers...))
+	}
+	poolConfigured := len(config.NSMIPAMPool) > 0 || config.NSMIPAMPoolConfigMapName != ""
+	if poolConfigured {
+		options = append(options, prefixcollector.WithPoolLint(config.NSMIPAMPool,
+			config.NSMIPAMMinFreeAddresses, config.RefuseExhaustingPrefixes))
+	}
+	if config.NSMIPAMPoolConfigMapName != "" {
+		options = append(options, prefixcollector.WithPoolConfigMap(config.NSMIPAMPoolConfigMapName, outputNamespace))
+	}
+	if poolConfigured && config.PoolCoverageInterval > 0 {
+		options = append(options, prefixcollector.WithCoverageReport(config.PoolCoverageInterval))
+	}
+	return options, nil
+}
+
+// nsmManagerClients returns connection monitor clients of NSM managers at urls. Connections are established
+// lazily and kept for the collector lifetime.
+func nsmManagerClients(urls []string) ([]networkservice.MonitorConnectionClient, error) {
+	clients := make([]networkservice.MonitorConnectionClient, 0, len(urls))
+	for _, rawURL := range urls {
+		managerURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Wrong NSM manager URL %q", rawURL)
+		}
+		cc, err := grpc.Dial(grpcutils.URLToTarget(managerURL), grpc.WithInsecure())
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to dial NSM manager %s", rawURL)
+		}
+		clients = append(clients, networkservice.NewMonitorConnectionClient(cc))
+	}
+	return clients, nil
+}
+
+// changesPublisher returns publisher of the prefixes changes to the configured message bus, which is connected
+// with the external sources proxy and TLS settings
+func changesPublisher(config *prefixcollector.Config) (prefixcollector.Publisher, error) {
+	client, err := externalHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := externalTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return prefixcollector.NewPublisher(config.PublisherURL, config.PublisherTopic, client, tlsConfig)
+}
+
+// backupStore returns object store of the output backup, which is requested with the external sources
+// proxy and TLS settings
+func backupStore(config *prefixcollector.Config) (*prefixcollector.ObjectStore, error) {
+	client, err := externalHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return prefixcollector.NewObjectStore(&prefixcollector.ObjectStoreOptions{
+		BucketURL:     config.BackupBucketURL,
+		Region:        config.BackupRegion,
+		AccessKeyID:   config.BackupAccessKeyID,
+		SecretKeyPath: config.BackupSecretKeyPath,
+		Client:        client,
+	})
+}
+
+// layoutOptions returns collector options configuring keys and encoding of the output payload
+func layoutOptions(config *prefixcollector.Config) []prefixcollector.Option {
+	var options []prefixcollector.Option
+	if config.OutputShardSize > 0 {
+		options = append(options, prefixcollector.WithOutputShards(config.OutputShardSize))
+	}
+	if config.PrefixesOutputType == prefixcollector.ConfigMapOutputType {
+		options = append(options, prefixcollector.WithOutputSchemas(config.OutputSchemas...))
+	}
+	if config.OutputFamilyKeys {
+		options = append(options, prefixcollector.WithFamilyKeys())
+	}
+	if config.OutputDiffKey {
+		options = append(options, prefixcollector.WithDiffKey())
+	}
+	if config.OutputCommitLease != "" {
+		// pod name is the hostname, so the lease holder is the collector replica
+		holder, _ := os.Hostname()
+		options = append(options, prefixcollector.WithTwoPhaseCommit(config.OutputCommitLease, holder))
+	}
+	if config.OutputCompression {
+		options = append(options, prefixcollector.WithOutputCompression())
+	}
+	return options
+}
+
+// sourceStateOptions returns collector options configuring how state of the sources is tracked and persisted
+func sourceStateOptions(config *prefixcollector.Config) []prefixcollector.Option {
+	options := []prefixcollector.Option{prefixcollector.WithShutdownTimeout(config.ShutdownTimeout)}
+	if config.StaleSourcesWindow > 0 {
+		options = append(options, prefixcollector.WithStaleWindow(config.StaleSourcesWindow))
+	}
+	if config.SourceCachePath != "" {
+		options = append(options, prefixcollector.WithSourceCache(config.SourceCachePath))
+	}
+	return options
+}
+
+// sinkOptions returns collector options configuring how prefixes of the sources are combined and selected for sinks
+func sinkOptions(config *prefixcollector.Config) ([]prefixcollector.Option, error) {
+	options := []prefixcollector.Option{
+		prefixcollector.WithOutputMergeStrategy(config.OutputMergeStrategy),
+		prefixcollector.WithAuditMergeStrategy(config.AuditMergeStrategy),
+		prefixcollector.WithSourcePriorities(config.SourcePriorities...),
+		prefixcollector.WithSourceQuotas(config.SourceQuotas, config.SourceQuotaPolicy),
+		prefixcollector.WithPublicPrefixesCheck(config.PublicPrefixesPolicy, config.AllowedPublicPrefixes),
+	}
+	if config.OutputSelector != "" {
+		selector, err := labels.Parse(config.OutputSelector)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid output prefix tags selector")
+		}
+		options = append(options, prefixcollector.WithOutputSelector(selector))
+	}
+	if config.AuditSelector != "" {
+		selector, err := labels.Parse(config.AuditSelector)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid audit prefix tags selector")
+		}
+		options = append(options, prefixcollector.WithAuditSelector(selector))
+	}
+	return options, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sourcetest contains conformance test suite of excluded prefix sources. Any source implementation,
+// in-tree or external, can run it to verify it honors context cancellation, never blocks on notifications,
+// survives watch errors and produces canonical prefixes.
+package sourcetest
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	checkInterval  = 10 * time.Millisecond
+	// watchErrorsTime is time the source runs with failing watches
+	watchErrorsTime = 100 * time.Millisecond
+)
+
+// Source is tested excluded prefix source
+type Source interface {
+	Prefixes() []string
+}
+
+// Env is environment the tested source is created in
+type Env struct {
+	// Ctx is context the source runs in until the check ends. It carries resource versions, resync signal,
+	// refresh times and lifecycle the source goroutines should be started with.
+	Ctx context.Context
+	// Notify is event bus the source notifies about prefixes changes, its events are never received
+	Notify *utils.EventBus
+}
+
+// Suite is conformance test suite of a source
+type Suite struct {
+	// New creates the tested source in env
+	New func(env *Env) Source
+	// Setup prepares context of the source before it is created, e.g. puts fake Kubernetes clients to it.
+	// Context is used as is if nil.
+	Setup func(ctx context.Context) context.Context
+	// Expected are prefixes the source should eventually provide in any order
+	Expected []string
+	// BreakWatch makes the source watches or fetches fail from now on, e.g. injects watch errors to fake clients.
+	// Watch errors aren't checked if nil.
+	BreakWatch func(env *Env)
+	// Timeout is timeout of every check, 5s if zero
+	Timeout time.Duration
+}
+
+// Run runs all the conformance checks of the suite source
+func Run(t *testing.T, suite Suite) {
+	require.NotNil(t, suite.New, "Suite should create the tested source")
+	if suite.Timeout == 0 {
+		suite.Timeout = defaultTimeout
+	}
+
+	t.Run("ProducesCanonicalPrefixes", suite.checkCanonicalPrefixes)
+	t.Run("HonorsContextCancellation", suite.checkContextCancellation)
+	t.Run("NeverBlocksOnNotify", suite.checkNotify)
+	if suite.BreakWatch != nil {
+		t.Run("SurvivesWatchErrors", suite.checkWatchErrors)
+	}
+}
+
+// checkCanonicalPrefixes checks that the source provides expected prefixes, which are valid CIDRs with
+// zero host bits in canonical notation
+func (s *Suite) checkCanonicalPrefixes(t *testing.T) {
+	env, cancel := s.newEnv()
+	defer cancel()
+	source := s.New(env)
+
+	s.requireExpected(t, source)
+	for _, prefix := range source.Prefixes() {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		require.NoError(t, err, "Prefix %q should be valid CIDR", prefix)
+		require.Equal(t, ipNet.String(), prefix, "Prefix %q should be canonical", prefix)
+	}
+}
+
+// checkContextCancellation checks that all the source goroutines stop after its context is done
+func (s *Suite) checkContextCancellation(t *testing.T) {
+	env, cancel := s.newEnv()
+	source := s.New(env)
+	s.requireExpected(t, source)
+
+	s.requireStops(t, env, cancel)
+	_ = source.Prefixes()
+}
+
+// checkNotify checks that the source keeps serving prefixes and resyncs while nobody receives its notifications
+func (s *Suite) checkNotify(t *testing.T) {
+	env, cancel := s.newEnv()
+	defer cancel()
+	source := s.New(env)
+	s.requireExpected(t, source)
+
+	for i := 0; i < 3; i++ {
+		prefixcollector.ResyncSignal(env.Ctx).Trigger()
+		s.requireExpected(t, source)
+	}
+	s.requireStops(t, env, cancel)
+}
+
+// checkWatchErrors checks that the source doesn't panic and stops on context cancellation after its watches fail
+func (s *Suite) checkWatchErrors(t *testing.T) {
+	env, cancel := s.newEnv()
+	defer cancel()
+	source := s.New(env)
+	s.requireExpected(t, source)
+
+	s.BreakWatch(env)
+	prefixcollector.ResyncSignal(env.Ctx).Trigger()
+	time.Sleep(watchErrorsTime)
+	_ = source.Prefixes()
+	require.Empty(t, prefixcollector.Lifecycle(env.Ctx).Panics(), "Source should not panic on watch errors")
+	s.requireStops(t, env, cancel)
+}
+
+// newEnv returns new source environment and function cancelling its context
+func (s *Suite) newEnv() (*Env, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = prefixcollector.WithResourceVersions(ctx, utils.NewResourceVersions(nil))
+	ctx = prefixcollector.WithResyncSignal(ctx, utils.NewResyncSignal())
+	ctx = prefixcollector.WithRefreshTimes(ctx, utils.NewRefreshTimes())
+	ctx = prefixcollector.WithLifecycle(ctx, utils.NewLifecycle())
+	if s.Setup != nil {
+		ctx = s.Setup(ctx)
+	}
+	return &Env{Ctx: ctx, Notify: utils.NewEventBus()}, cancel
+}
+
+// requireExpected requires the source to provide expected prefixes within timeout
+func (s *Suite) requireExpected(t *testing.T, source Source) {
+	require.Eventually(t, func() bool {
+		return utils.UnorderedSlicesEquals(source.Prefixes(), s.Expected)
+	}, s.Timeout, checkInterval, "Source should provide prefixes %v", s.Expected)
+}
+
+// requireStops requires all the source goroutines to stop within timeout after cancel
+func (s *Suite) requireStops(t *testing.T, env *Env, cancel context.CancelFunc) {
+	cancel()
+	require.Empty(t, prefixcollector.Lifecycle(env.Ctx).Wait(s.Timeout), "Source goroutines should stop after context is done")
+}
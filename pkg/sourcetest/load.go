@@ -0,0 +1,117 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sourcetest
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// LoadGenerator generates synthetic load of sources providing prefixes, part of which churns on every Churn
+type LoadGenerator struct {
+	sources   []*syntheticSource
+	churnRate float64
+	random    *rand.Rand
+	// churned is number of the churned prefixes, churned prefixes are unique, so every churn changes the output
+	churned uint32
+}
+
+// syntheticSource is named prefix source of the load generator
+type syntheticSource struct {
+	name     string
+	mutex    sync.Mutex
+	prefixes []string
+}
+
+// NewLoadGenerator creates LoadGenerator of sources providing random IPv4 /24 prefixes each. Churn replaces
+// churnRate fraction of all the prefixes, at least one. Load is reproducible with the same seed.
+func NewLoadGenerator(sources, prefixes int, churnRate float64, seed int64) *LoadGenerator {
+	g := &LoadGenerator{
+		churnRate: churnRate,
+		random:    rand.New(rand.NewSource(seed)),
+	}
+	for i := 0; i < sources; i++ {
+		source := &syntheticSource{name: fmt.Sprintf("synthetic-%d", i), prefixes: make([]string, prefixes)}
+		for j := range source.prefixes {
+			source.prefixes[j] = fmt.Sprintf("10.%d.%d.0/24", g.random.Intn(256), g.random.Intn(256))
+		}
+		g.sources = append(g.sources, source)
+	}
+	return g
+}
+
+// Sources returns the generated sources
+func (g *LoadGenerator) Sources() []prefixcollector.PrefixSource {
+	sources := make([]prefixcollector.PrefixSource, 0, len(g.sources))
+	for _, source := range g.sources {
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// Prefixes returns total number of the prefixes of the sources
+func (g *LoadGenerator) Prefixes() int {
+	total := 0
+	for _, source := range g.sources {
+		total += len(source.Prefixes())
+	}
+	return total
+}
+
+// Churn replaces random prefixes of random sources with unique IPv6 ones, returns number of the replaced prefixes
+func (g *LoadGenerator) Churn() int {
+	count := int(g.churnRate * float64(g.Prefixes()))
+	if count < 1 {
+		count = 1
+	}
+	for i := 0; i < count; i++ {
+		source := g.sources[g.random.Intn(len(g.sources))]
+		g.churned++
+		ip := make(net.IP, net.IPv6len)
+		ip[0] = 0xfd
+		binary.BigEndian.PutUint32(ip[2:6], g.churned)
+		source.replace(g.random, (&net.IPNet{IP: ip, Mask: net.CIDRMask(64, 128)}).String())
+	}
+	return count
+}
+
+// Prefixes returns prefixes from source
+func (s *syntheticSource) Prefixes() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.prefixes...)
+}
+
+// Name returns name of the source
+func (s *syntheticSource) Name() string {
+	return s.name
+}
+
+// replace replaces random prefix of the source with prefix
+func (s *syntheticSource) replace(random *rand.Rand, prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.prefixes) == 0 {
+		s.prefixes = append(s.prefixes, prefix)
+		return
+	}
+	s.prefixes[random.Intn(len(s.prefixes))] = prefix
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/networkservicemesh/sdk-k8s/pkg/k8s"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	simulateCommand     = "simulate"
+	textSimulateFormat  = "text"
+	jsonSimulateFormat  = "json"
+	defaultSettleTime   = 5 * time.Second
+	defaultSimulateTime = time.Minute
+)
+
+// simulationSource is prefixes provided by a single source during simulation
+type simulationSource struct {
+	Name     string   `json:"name"`
+	Scope    string   `json:"scope"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// simulationConflict is a pair of overlapping prefixes provided by different sources
+type simulationConflict struct {
+	Prefix      string `json:"prefix"`
+	Source      string `json:"source"`
+	OtherPrefix string `json:"otherPrefix"`
+	OtherSource string `json:"otherSource"`
+}
+
+// simulationReport is excluded prefixes the collector would publish with the current configuration
+type simulationReport struct {
+	Sources         []simulationSource             `json:"sources"`
+	DisabledSources []string                       `json:"disabledSources,omitempty"`
+	Prefixes        []prefixcollector.PrefixEntry  `json:"prefixes"`
+	Conflicts       []simulationConflict           `json:"conflicts,omitempty"`
+	Dropped         []prefixcollector.SourceChange `json:"dropped,omitempty"`
+}
+
+// runSimulate runs all the configured sources once without writing anything and prints excluded prefixes
+// the collector would publish with per source attribution and conflicts
+func runSimulate(args []string) error {
+	flags := flag.NewFlagSet(simulateCommand, flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path of kubeconfig of the simulated cluster, in cluster config or KUBECONFIG is used if empty")
+	envFile := flags.String("env-file", "", "File with KEY=VALUE environment configuration, process environment is used if empty")
+	settle := flags.Duration("settle", defaultSettleTime, "Time sources should stay unchanged to consider their prefixes complete")
+	timeout := flags.Duration("timeout", defaultSimulateTime, "Maximum time of the simulation")
+	format := flags.String("o", textSimulateFormat, "Output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != textSimulateFormat && *format != jsonSimulateFormat {
+		return errors.Errorf("Unknown output format %q", *format)
+	}
+
+	if *envFile != "" {
+		if err := setEnvFromFile(*envFile); err != nil {
+			return err
+		}
+	}
+	config := &prefixcollector.Config{}
+	if err := loadConfig(config); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	simulation, err := simulate(ctx, config, *kubeconfig, *settle)
+	if err != nil {
+		return err
+	}
+	if *format == jsonSimulateFormat {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(simulation)
+	}
+	return printSimulation(os.Stdout, simulation)
+}
+
+// simulate runs the configured sources until they settle and merges their prefixes as the collector does
+func simulate(ctx context.Context, config *prefixcollector.Config, kubeconfig string, settle time.Duration) (*simulationReport, error) {
+	clientSetConfig, err := simulationClientConfig(kubeconfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to build Kubernetes client config")
+	}
+	clientSet, err := kubernetes.NewForConfig(clientSetConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to build Kubernetes clientSet")
+	}
+	dynamicClient, err := dynamic.NewForConfig(clientSetConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to build Kubernetes dynamic client")
+	}
+	ctx = prefixcollector.WithKubernetesInterface(ctx, kubernetes.Interface(clientSet))
+	ctx = prefixcollector.WithDynamicInterface(ctx, dynamicClient)
+	ctx = prefixcollector.WithResourceVersions(ctx, utils.NewResourceVersions(nil))
+
+	simulation := &simulationReport{}
+	bus := utils.NewEventBus()
+	var sources []prefixcollector.PrefixSource
+	sources, simulation.DisabledSources = initSources(ctx, clientSet, config, sourceEntries(config), bus)
+	if err = utils.WaitSettled(ctx, bus.Events(), settle); err != nil {
+		return nil, err
+	}
+
+	prefixes, err := mergeSimulated(ctx, config, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	sourcePrefixes := make(map[string][]string, len(sources))
+	for _, source := range sources {
+		name := prefixcollector.SourceName(source)
+		sourcePrefixes[name] = source.Prefixes()
+		simulation.Sources = append(simulation.Sources, simulationSource{
+			Name:     name,
+			Scope:    prefixcollector.SourceScope(source),
+			Prefixes: sourcePrefixes[name],
+		})
+	}
+	if simulation.Prefixes, err = prefixcollector.PrefixEntries(prefixes, sourcePrefixes); err != nil {
+		return nil, err
+	}
+	simulation.Conflicts = simulationConflicts(simulation.Sources)
+	simulation.Dropped = droppedPrefixes(simulation.Sources, prefixes)
+	return simulation, nil
+}
+
+// simulationClientConfig returns client config of kubeconfig or the default one of the collector
+func simulationClientConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		return k8s.NewClientSetConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", kubeconfig)
+}
+
+// mergeSimulated returns prefixes the collector would write to the output with the configured sink options
+func mergeSimulated(ctx context.Context, config *prefixcollector.Config, sources []prefixcollector.PrefixSource) ([]string, error) {
+	options, err := sinkOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collectCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	written := make(chan []string, 1)
+	options = append(options,
+		prefixcollector.WithSources(sources...),
+		prefixcollector.WithNotifyChan(make(chan struct{})),
+		prefixcollector.WithOutputFunc(func(_ context.Context, prefixes []string) error {
+			written <- prefixes
+			cancel()
+			return nil
+		}),
+	)
+	go prefixcollector.NewExcludePrefixCollector(options...).Serve(collectCtx)
+
+	select {
+	case prefixes := <-written:
+		return prefixes, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "Failed to merge prefixes")
+	}
+}
+
+// simulationConflicts returns overlapping prefixes of different sources, equal prefixes aren't conflicting
+func simulationConflicts(sources []simulationSource) []simulationConflict {
+	var conflicts []simulationConflict
+	for i := range sources {
+		for j := i + 1; j < len(sources); j++ {
+			for _, prefix := range sources[i].Prefixes {
+				for _, otherPrefix := range sources[j].Prefixes {
+					if prefix != otherPrefix && prefixesOverlap(prefix, otherPrefix) {
+						conflicts = append(conflicts, simulationConflict{
+							Prefix:      prefix,
+							Source:      sources[i].Name,
+							OtherPrefix: otherPrefix,
+							OtherSource: sources[j].Name,
+						})
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// droppedPrefixes returns prefixes of the sources, which aren't covered by the merged prefixes because of
+// the merge strategy or the output selector
+func droppedPrefixes(sources []simulationSource, prefixes []string) []prefixcollector.SourceChange {
+	var dropped []prefixcollector.SourceChange
+	for i := range sources {
+		change := prefixcollector.SourceChange{Source: sources[i].Name}
+		for _, prefix := range sources[i].Prefixes {
+			if !utils.CoveredBy(prefix, prefixes) {
+				change.Removed = append(change.Removed, prefix)
+			}
+		}
+		if len(change.Removed) > 0 {
+			dropped = append(dropped, change)
+		}
+	}
+	return dropped
+}
+
+func prefixesOverlap(prefix, otherPrefix string) bool {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+	_, otherNet, err := net.ParseCIDR(otherPrefix)
+	if err != nil {
+		return false
+	}
+	return ipNet.Contains(otherNet.IP) || otherNet.Contains(ipNet.IP)
+}
+
+// printSimulation prints human readable simulation report to writer
+func printSimulation(writer io.Writer, simulation *simulationReport) error {
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "SOURCE\tSCOPE\tPREFIXES")
+	for _, source := range simulation.Sources {
+		prefixes := append([]string(nil), source.Prefixes...)
+		sort.Strings(prefixes)
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", source.Name, source.Scope, strings.Join(prefixes, ","))
+	}
+	for _, name := range simulation.DisabledSources {
+		_, _ = fmt.Fprintf(tw, "%s\tdisabled\t\n", name)
+	}
+
+	_, _ = fmt.Fprintf(tw, "\nEXCLUDED PREFIX (%d)\tFAMILY\tSOURCES\n", len(simulation.Prefixes))
+	for _, entry := range simulation.Prefixes {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Prefix, entry.Family, strings.Join(entry.Sources, ","))
+	}
+
+	if len(simulation.Conflicts) > 0 {
+		_, _ = fmt.Fprintf(tw, "\nCONFLICT (%d)\tSOURCE\tOVERLAPS\n", len(simulation.Conflicts))
+		for _, conflict := range simulation.Conflicts {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s (%s)\n", conflict.Prefix, conflict.Source, conflict.OtherPrefix, conflict.OtherSource)
+		}
+	}
+	if len(simulation.Dropped) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nDROPPED FROM SOURCE\tPREFIXES")
+		for _, change := range simulation.Dropped {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\n", change.Source, strings.Join(change.Removed, ","))
+		}
+	}
+	return tw.Flush()
+}
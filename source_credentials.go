@@ -0,0 +1,110 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// sourceClients are Kubernetes clients of the source using its own credentials
+type sourceClients struct {
+	kubernetes kubernetes.Interface
+	dynamic    dynamic.Interface
+}
+
+// withClients puts the source clients to context
+func (c *sourceClients) withClients(ctx context.Context) context.Context {
+	if c == nil {
+		return ctx
+	}
+	ctx = prefixcollector.WithKubernetesInterface(ctx, c.kubernetes)
+	return prefixcollector.WithDynamicInterface(ctx, c.dynamic)
+}
+
+// withSourceCredentials sets clients of the entries having own credentials configured. Kubeconfig replaces
+// the collector cluster and credentials, ServiceAccount token file replaces credentials of the collector or
+// kubeconfig client config, impersonated user replaces the collector one.
+func withSourceCredentials(config *prefixcollector.Config, entries []*sourceEntry) ([]*sourceEntry, error) {
+	if len(config.SourceTokenFiles) == 0 && len(config.SourceImpersonateUsers) == 0 && len(config.SourceKubeconfigs) == 0 {
+		return entries, nil
+	}
+	clientSetConfig, err := clientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		tokenFile, user := config.SourceTokenFiles[entry.name], config.SourceImpersonateUsers[entry.name]
+		kubeconfig := config.SourceKubeconfigs[entry.name]
+		if tokenFile == "" && user == "" && kubeconfig == "" {
+			continue
+		}
+		sourceConfig := rest.CopyConfig(clientSetConfig)
+		if kubeconfig != "" {
+			if sourceConfig, err = kubeconfigSourceConfig(kubeconfig, clientSetConfig); err != nil {
+				return nil, errors.Wrapf(err, "Failed to load kubeconfig of %s source", entry.name)
+			}
+		}
+		if tokenFile != "" {
+			// token file is reread by the client, so rotated tokens are picked up without restart
+			sourceConfig = rest.AnonymousClientConfig(sourceConfig)
+			sourceConfig.BearerTokenFile = tokenFile
+		}
+		if user != "" {
+			sourceConfig.Impersonate = rest.ImpersonationConfig{UserName: user}
+		}
+
+		if entry.clients, err = newSourceClients(sourceConfig); err != nil {
+			return nil, errors.Wrapf(err, "Failed to build clients of %s source", entry.name)
+		}
+	}
+	return entries, nil
+}
+
+// kubeconfigSourceConfig returns client config of the cluster of kubeconfig current context, client settings
+// of the collector config are kept, but the collector impersonated user isn't known to the cluster
+func kubeconfigSourceConfig(kubeconfig string, collectorConfig *rest.Config) (*rest.Config, error) {
+	sourceConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	sourceConfig.UserAgent = collectorConfig.UserAgent
+	sourceConfig.QPS = collectorConfig.QPS
+	sourceConfig.Burst = collectorConfig.Burst
+	sourceConfig.WrapTransport = collectorConfig.WrapTransport
+	sourceConfig.Dial = collectorConfig.Dial
+	return sourceConfig, nil
+}
+
+func newSourceClients(config *rest.Config) (*sourceClients, error) {
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceClients{kubernetes: clientSet, dynamic: dynamicClient}, nil
+}
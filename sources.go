@@ -0,0 +1,555 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"cmd-exclude-prefixes-k8s/internal/rbac"
+	"cmd-exclude-prefixes-k8s/internal/utils"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sourceEntry describes configured prefix source and Kubernetes API access it requires.
+// Node-local sources are served by node agents in agent mode.
+type sourceEntry struct {
+	name      string
+	rules     []rbac.Rule
+	nodeLocal bool
+	build     func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource
+	// clients are Kubernetes clients of the source having own credentials, the collector ones are used if nil
+	clients *sourceClients
+}
+
+// sourceEntries returns all prefix sources configured by config
+func sourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	entries := []*sourceEntry{
+		{
+			name: "env",
+			build: func(context.Context, *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewEnvPrefixSource(config.ExcludedPrefixes)
+			},
+		},
+		kubeadmEntry(config),
+		{
+			name: "kubernetes",
+			rules: []rbac.Rule{
+				{Resource: "nodes", Verbs: []string{"watch"}},
+				{Resource: "namespaces", Verbs: []string{"list"}},
+				{Resource: "services", Verbs: []string{"watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewKubernetesPrefixSource(ctx, notify)
+			},
+		},
+		configMapEntry(config),
+	}
+	if len(config.ExcludedPresets) > 0 {
+		entries = append(entries, &sourceEntry{
+			name: "presets",
+			build: func(context.Context, *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewPresetPrefixSource(config.ExcludedPresets)
+			},
+		})
+	}
+	if len(config.NodeSelectorPrefixes) > 0 {
+		entries = append(entries, &sourceEntry{
+			name:  "node-selector",
+			rules: []rbac.Rule{{Resource: "nodes", Verbs: []string{"get"}}},
+			build: func(ctx context.Context, _ *utils.EventBus) prefixcollector.PrefixSource {
+				nodeLabels := nodeLabels(ctx, prefixcollector.KubernetesInterface(ctx), config.NodeName)
+				return prefixsource.NewNodeSelectorPrefixSource(config.NodeSelectorPrefixes, nodeLabels)
+			},
+		})
+	}
+	if len(config.ScheduledPrefixes) > 0 {
+		entries = append(entries, &sourceEntry{
+			name: "scheduled",
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewScheduledPrefixSource(ctx, notify, config.ScheduledPrefixes)
+			},
+		})
+	}
+	if config.ReservationSource {
+		entries = append(entries, &sourceEntry{
+			name: "reservations",
+			rules: []rbac.Rule{
+				{Namespace: config.ReservationsNamespace, Resource: "configmaps", Verbs: []string{"list", "watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewReservationPrefixSource(ctx, notify, config.ReservationsNamespace, config.ReservationsConfigMapName)
+			},
+		})
+	}
+	if config.DistroDetection {
+		entries = append(entries, &sourceEntry{
+			name:  "distro",
+			rules: []rbac.Rule{{Resource: "nodes", Verbs: []string{"list"}}},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewDistroPrefixSource(ctx, notify)
+			},
+		})
+	}
+	entries = append(entries, kubernetesResourceEntries(config)...)
+	entries = append(entries, serviceSourceEntries(config)...)
+	entries = append(entries, configMapSelectorEntries(config)...)
+	entries = append(entries, externalSourceEntries(config)...)
+	entries = append(entries, hostSourceEntries(config)...)
+	return append(entries, federationSourceEntries(config)...)
+}
+
+// kubernetesResourceEntries returns the configured optional sources of Kubernetes resources
+func kubernetesResourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	var entries []*sourceEntry
+	if config.KubeletConfigSource {
+		entries = append(entries, &sourceEntry{
+			name: "kubelet-config",
+			rules: []rbac.Rule{
+				{Namespace: prefixsource.KubeNamespace, Resource: "configmaps", Verbs: []string{"list", "watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewKubeletConfigPrefixSource(ctx, notify)
+			},
+		})
+	}
+	if config.SriovNetworkSource {
+		entries = append(entries, &sourceEntry{
+			name: "sriov",
+			rules: []rbac.Rule{
+				{
+					Namespace: config.SriovNetworkNamespace,
+					APIGroup:  prefixsource.SriovNetworkResource.Group,
+					Resource:  prefixsource.SriovNetworkResource.Resource,
+					Verbs:     []string{"list", "watch"},
+				},
+				{
+					Namespace: config.SriovNetworkNamespace,
+					APIGroup:  prefixsource.SriovIBNetworkResource.Group,
+					Resource:  prefixsource.SriovIBNetworkResource.Resource,
+					Verbs:     []string{"list", "watch"},
+				},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewSriovNetworkPrefixSource(ctx, notify, config.SriovNetworkNamespace)
+			},
+		})
+	}
+	if config.MultusSource {
+		entries = append(entries, &sourceEntry{
+			name: "multus",
+			rules: []rbac.Rule{{
+				APIGroup: prefixsource.NetworkAttachmentDefinitionResource.Group,
+				Resource: prefixsource.NetworkAttachmentDefinitionResource.Resource,
+				Verbs:    []string{"list", "watch"},
+			}},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewMultusPrefixSource(ctx, notify)
+			},
+		})
+	}
+	if config.Metal3Source {
+		entries = append(entries, &sourceEntry{
+			name: "metal3",
+			rules: []rbac.Rule{
+				{APIGroup: prefixsource.Metal3APIGroup, Resource: "provisionings", Verbs: []string{"list", "watch"}},
+				{APIGroup: prefixsource.Metal3APIGroup, Resource: "baremetalhosts", Verbs: []string{"list", "watch"}},
+				{Namespace: config.Metal3IronicNamespace, Resource: "configmaps", Verbs: []string{"list", "watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewMetal3PrefixSource(ctx, notify, config.Metal3IronicNamespace, config.Metal3IronicConfigMapName)
+			},
+		})
+	}
+	if config.CapiSource {
+		entries = append(entries, clusterAPIEntry(config))
+	}
+	if config.HostNetworkPodSource {
+		entries = append(entries, &sourceEntry{
+			name:  "host-network-pods",
+			rules: []rbac.Rule{{Resource: "pods", Verbs: []string{"list", "watch"}}},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewHostNetworkPodPrefixSource(ctx, notify)
+			},
+		})
+	}
+	if config.GatewayAPISource {
+		entries = append(entries, &sourceEntry{
+			name: "gateway-api",
+			rules: []rbac.Rule{
+				{APIGroup: prefixsource.GatewayAPIGroup, Resource: "gateways", Verbs: []string{"list", "watch"}},
+				{APIGroup: prefixsource.GatewayAPIGroup, Resource: "gatewayclasses", Verbs: []string{"list", "watch"}},
+				{Resource: "configmaps", Verbs: []string{"get"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewGatewayPrefixSource(ctx, notify, config.GatewayAPIVersion)
+			},
+		})
+	}
+	return entries
+}
+
+// serviceSourceEntries returns configured prefix sources of the service IPs and the CIDRs services are annotated with
+func serviceSourceEntries(config *prefixcollector.Config) []*sourceEntry {
+	var entries []*sourceEntry
+	if config.IngressControllerSource {
+		entries = append(entries, &sourceEntry{
+			name: "ingress-controllers",
+			rules: []rbac.Rule{
+				{Resource: "services", Verbs: []string{"list", "watch"}},
+				{Resource: "configmaps", Verbs: []string{"list", "watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				selector, _ := labels.Parse(config.IngressControllerSelector)
+				return prefixsource.NewIngressControllerPrefixSource(ctx, notify, selector)
+			},
+		})
+	}
+	if len(config.CriticalServices) > 0 {
+		entries = append(entries, &sourceEntry{
+			name:  "critical-services",
+			rules: []rbac.Rule{{Resource: "services", Verbs: []string{"list", "watch"}}},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewCriticalServicePrefixSource(ctx, notify, config.CriticalServices)
+			},
+		})
+	}
+	if config.ServiceAnnotationSource {
+		entries = append(entries, &sourceEntry{
+			name:  "service-annotations",
+			rules: []rbac.Rule{{Resource: "services", Verbs: []string{"list", "watch"}}},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewServiceAnnotationPrefixSource(ctx, notify)
+			},
+		})
+	}
+	return entries
+}
+
+// configMapEntry returns source of the user config map, which is merged from all the configured namespaces
+// if they are set
+func configMapEntry(config *prefixcollector.Config) *sourceEntry {
+	if len(config.ConfigMapNamespaces) == 0 {
+		return &sourceEntry{
+			name: "configmap",
+			rules: []rbac.Rule{
+				{Namespace: config.ConfigMapNamespace, Resource: "configmaps", Verbs: []string{"list", "watch"}},
+			},
+			build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+				return prefixsource.NewConfigMapPrefixSource(ctx, notify, config.ConfigMapName, config.ConfigMapNamespace)
+			},
+		}
+	}
+
+	var namespaces []string
+	if config.ConfigMapNamespaces[0] != prefixcollector.AllNamespaces {
+		namespaces = config.ConfigMapNamespaces
+	}
+	entry := &sourceEntry{
+		name: "configmap",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewConfigMapNamespacesPrefixSource(ctx, notify, config.ConfigMapName, namespaces...)
+		},
+	}
+	if len(namespaces) == 0 {
+		entry.rules = []rbac.Rule{{Resource: "configmaps", Verbs: []string{"list", "watch"}}}
+	}
+	for _, namespace := range namespaces {
+		entry.rules = append(entry.rules,
+			rbac.Rule{Namespace: namespace, Resource: "configmaps", Verbs: []string{"list", "watch"}})
+	}
+	return entry
+}
+
+// kubeadmEntry returns source of the kubeadm config map and the kubeadm-style ones selected by label selector
+func kubeadmEntry(config *prefixcollector.Config) *sourceEntry {
+	entry := &sourceEntry{
+		name: "kubeadm",
+		rules: []rbac.Rule{
+			{Namespace: prefixsource.KubeNamespace, Resource: "configmaps", Verbs: []string{"list", "watch"}},
+		},
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewKubeAdmPrefixSource(ctx, notify)
+		},
+	}
+	if config.KubeadmConfigMapSelector == "" {
+		return entry
+	}
+	entry.build = func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+		selector, _ := labels.Parse(config.KubeadmConfigMapSelector)
+		return prefixsource.NewKubeAdmSelectorPrefixSource(ctx, notify, selector, config.KubeadmConfigMapNamespaces...)
+	}
+	for _, namespace := range config.KubeadmConfigMapNamespaces {
+		if namespace != prefixsource.KubeNamespace {
+			entry.rules = append(entry.rules,
+				rbac.Rule{Namespace: namespace, Resource: "configmaps", Verbs: []string{"list", "watch"}})
+		}
+	}
+	return entry
+}
+
+// clusterAPIEntry returns source of Cluster API Cluster resources
+func clusterAPIEntry(config *prefixcollector.Config) *sourceEntry {
+	entry := &sourceEntry{
+		name: "capi",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			return prefixsource.NewClusterAPIPrefixSource(ctx, notify, config.CapiClusterName, config.CapiNamespaces...)
+		},
+	}
+	namespaces := config.CapiNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		entry.rules = append(entry.rules, rbac.Rule{
+			Namespace: namespace, APIGroup: prefixsource.ClusterAPIGroup, Resource: "clusters", Verbs: []string{"list", "watch"},
+		})
+	}
+	return entry
+}
+
+// configMapSelectorEntries returns source of the user config maps selected by label selector if it is configured
+func configMapSelectorEntries(config *prefixcollector.Config) []*sourceEntry {
+	if config.ConfigMapSelector == "" {
+		return nil
+	}
+	entry := &sourceEntry{
+		name: "configmaps",
+		build: func(ctx context.Context, notify *utils.EventBus) prefixcollector.PrefixSource {
+			selector, _ := labels.Parse(config.ConfigMapSelector)
+			return prefixsource.NewConfigMapSelectorPrefixSource(ctx, notify, selector, config.ConfigMapSelectorNamespaces...)
+		},
+	}
+	namespaces := config.ConfigMapSelectorNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		entry.rules = append(entry.rules,
+			rbac.Rule{Namespace: namespace, Resource: "configmaps", Verbs: []string{"list", "watch"}})
+	}
+	return []*sourceEntry{entry}
+}
+
+// nodeSelectedEntries returns entries, which node selectors match labels of the collector node.
+// Entries without node selector are always selected.
+func nodeSelectedEntries(ctx context.Context, clientSet kubernetes.Interface, config *prefixcollector.Config,
+	entries []*sourceEntry) []*sourceEntry {
+	if len(config.SourceNodeSelectors) == 0 {
+		return entries
+	}
+	nodeLabels := labels.Set(nodeLabels(ctx, clientSet, config.NodeName))
+	unknown := make(map[string]bool, len(config.SourceNodeSelectors))
+	for name := range config.SourceNodeSelectors {
+		unknown[name] = true
+	}
+
+	selected := make([]*sourceEntry, 0, len(entries))
+	for _, entry := range entries {
+		delete(unknown, entry.name)
+		selector, ok := config.SourceNodeSelectors[entry.name]
+		if !ok {
+			selected = append(selected, entry)
+			continue
+		}
+		if parsed, err := labels.Parse(selector); err == nil && parsed.Matches(nodeLabels) {
+			selected = append(selected, entry)
+			continue
+		}
+		logrus.Infof("Source %s is disabled, node %s doesn't match selector %q", entry.name, config.NodeName, selector)
+	}
+	for name := range unknown {
+		logrus.Warnf("Node selector of unknown source %s is ignored", name)
+	}
+	return selected
+}
+
+// nodeLabels returns labels of the collector node, nil if they can't be read
+func nodeLabels(ctx context.Context, clientSet kubernetes.Interface, nodeName string) map[string]string {
+	node, err := clientSet.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		logrus.Errorf("Failed to get labels of node %s, node selectors match no labels: %v", nodeName, err)
+		return nil
+	}
+	return node.Labels
+}
+
+// buildSources builds prefix sources of entries notifying notify about changes
+func buildSources(ctx context.Context, entries []*sourceEntry, notify *utils.EventBus) []prefixcollector.PrefixSource {
+	sources := make([]prefixcollector.PrefixSource, 0, len(entries))
+	sourceNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sources = append(sources, entry.build(entry.clients.withClients(ctx), notify.Source(entry.name)))
+		sourceNames = append(sourceNames, entry.name)
+	}
+	logrus.Infof("Enabled prefix sources: %v", sourceNames)
+	return sources
+}
+
+// nodeLocalEntries returns node-local sources of entries
+func nodeLocalEntries(entries []*sourceEntry) []*sourceEntry {
+	var nodeLocal []*sourceEntry
+	for _, entry := range entries {
+		if entry.nodeLocal {
+			nodeLocal = append(nodeLocal, entry)
+		}
+	}
+	return nodeLocal
+}
+
+// outputRules returns Kubernetes API access required by the configured output, audit, status and output checks
+func outputRules(config *prefixcollector.Config, outputNamespace string) []rbac.Rule {
+	var rules []rbac.Rule
+	if config.PrefixesOutputType == prefixcollector.ConfigMapOutputType {
+		// deleted output config map is recreated, missing one is restored from backup, both are reported with event
+		verbs := []string{"get", "update", "watch", "create"}
+		if config.OutputShardSize > 0 {
+			verbs = append(verbs, "delete")
+		}
+		rules = append(rules,
+			rbac.Rule{Namespace: outputNamespace, Resource: "configmaps", Verbs: verbs},
+			rbac.Rule{Namespace: outputNamespace, Resource: "events", Verbs: []string{"create"}},
+		)
+	}
+	if config.OutputCommitLease != "" {
+		rules = append(rules, rbac.Rule{
+			Namespace: outputNamespace, APIGroup: "coordination.k8s.io", Resource: "leases", Verbs: []string{"get", "create", "update"},
+		})
+	}
+	if config.AuditConfigMapName != "" || config.CanaryConfigMapName != "" {
+		rules = append(rules, rbac.Rule{
+			Namespace: outputNamespace, Resource: "configmaps", Verbs: []string{"get", "create", "update"},
+		})
+	}
+	if config.StatusResourceName != "" {
+		rules = append(rules,
+			rbac.Rule{
+				Namespace: outputNamespace,
+				APIGroup:  prefixcollector.StatusResource.Group,
+				Resource:  prefixcollector.StatusResource.Resource,
+				Verbs:     []string{"get", "create"},
+			},
+			rbac.Rule{
+				Namespace: outputNamespace,
+				APIGroup:  prefixcollector.StatusResource.Group,
+				Resource:  prefixcollector.StatusResource.Resource + "/status",
+				Verbs:     []string{"update"},
+			},
+		)
+	}
+	if resource, _, err := prefixcollector.ParseOwner(config.OutputOwner); err == nil {
+		rules = append(rules, rbac.Rule{
+			Namespace: outputNamespace, APIGroup: resource.Group, Resource: resource.Resource, Verbs: []string{"get"},
+		})
+	}
+	if config.ConsumerSelector != "" {
+		rules = append(rules, rbac.Rule{Namespace: config.ConsumerNamespace, Resource: "pods", Verbs: []string{"list"}})
+	}
+	if config.NSMIPAMPoolConfigMapName != "" {
+		rules = append(rules, rbac.Rule{Namespace: outputNamespace, Resource: "configmaps", Verbs: []string{"get"}})
+	}
+	return rules
+}
+
+// reservationsAPIRules returns Kubernetes API access required by the reservations API: requesters are authenticated
+// with TokenReview and authorized with SubjectAccessReview, reservations are stored in the reservations config map
+func reservationsAPIRules(config *prefixcollector.Config) []rbac.Rule {
+	if config.ReservationsListenAddress == "" {
+		return nil
+	}
+	return []rbac.Rule{
+		{APIGroup: "authentication.k8s.io", Resource: "tokenreviews", Verbs: []string{"create"}},
+		{APIGroup: "authorization.k8s.io", Resource: "subjectaccessreviews", Verbs: []string{"create"}},
+		{Namespace: config.ReservationsNamespace, Resource: "configmaps", Verbs: []string{"get", "create", "update"}},
+	}
+}
+
+// initSources initializes sources of entries concurrently notifying notify about changes: the access of every
+// source is probed, if configured, and the allowed ones are built. Returns the sources and names of the disabled ones.
+func initSources(ctx context.Context, clientSet kubernetes.Interface, config *prefixcollector.Config,
+	entries []*sourceEntry, notify *utils.EventBus) (sources []prefixcollector.PrefixSource, disabled []string) {
+	var mutex sync.Mutex
+	inits := make([]prefixcollector.SourceInit, 0, len(entries))
+	for _, entry := range entries {
+		entry := entry
+		inits = append(inits, prefixcollector.SourceInit{
+			Name:   entry.name,
+			Notify: notify.Source(entry.name),
+			Init: func(ctx context.Context) prefixcollector.PrefixSource {
+				if config.ProbeAccess {
+					probeCtx, cancel := context.WithTimeout(ctx, config.SourceInitTimeout)
+					allowed := sourceAllowed(probeCtx, clientSet, entry)
+					cancel()
+					if !allowed {
+						mutex.Lock()
+						disabled = append(disabled, entry.name)
+						mutex.Unlock()
+						return nil
+					}
+				}
+				return entry.build(entry.clients.withClients(ctx), notify.Source(entry.name))
+			},
+		})
+	}
+	sources = prefixcollector.InitSources(ctx, config.SourceInitTimeout, inits...)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	sort.Strings(disabled)
+	sourceNames := make([]string, 0, len(sources))
+	for _, source := range sources {
+		sourceNames = append(sourceNames, prefixcollector.SourceName(source))
+	}
+	logrus.Infof("Enabled prefix sources: %v", sourceNames)
+	return sources, append([]string(nil), disabled...)
+}
+
+// sourceAllowed probes the ServiceAccount permissions required by the source of entry and reports denied ones.
+// If permissions can't be probed, the source is considered allowed.
+func sourceAllowed(ctx context.Context, clientSet kubernetes.Interface, entry *sourceEntry) bool {
+	entryClientSet := clientSet
+	if entry.clients != nil {
+		entryClientSet = entry.clients.kubernetes
+	}
+	denied, err := rbac.Denied(ctx, entryClientSet, entry.rules...)
+	if err != nil {
+		logrus.Warnf("Unable to probe permissions of %s source, considering it allowed: %v", entry.name, err)
+		return true
+	}
+	for i := range denied {
+		logrus.Warnf("Source %s is disabled, access denied: %s", entry.name, denied[i].String())
+	}
+	return len(denied) == 0
+}
+
+// probeOutputAccess probes the ServiceAccount permissions required by the output and reports denied ones
+func probeOutputAccess(ctx context.Context, clientSet kubernetes.Interface, rules []rbac.Rule) {
+	denied, err := rbac.Denied(ctx, clientSet, rules...)
+	if err != nil {
+		logrus.Warnf("Unable to probe permissions of the output: %v", err)
+		return
+	}
+	for i := range denied {
+		logrus.Errorf("Output access denied: %s", denied[i].String())
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector"
+	"cmd-exclude-prefixes-k8s/internal/prefixcollector/prefixsource"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	apiV1 "k8s.io/api/core/v1"
+)
+
+const envKeysFormat = "{{range .}}{{usage_key .}}\n{{end}}"
+
+// runValidate checks environment configuration and user config map, printing every found problem
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+	envFile := flags.String("env-file", "", "File with KEY=VALUE environment configuration, process environment is used if empty")
+	configMapFile := flags.String("config-map", "", "File with user config map YAML")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *envFile != "" {
+		if err := setEnvFromFile(*envFile); err != nil {
+			return err
+		}
+	}
+
+	problems, err := unknownEnvKeys()
+	if err != nil {
+		return err
+	}
+	config := &prefixcollector.Config{}
+	if err = loadConfig(config); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = append(problems,
+			prefixcollector.PoolProblems(config.NSMIPAMPool, config.ExcludedPrefixes, config.NSMIPAMMinFreeAddresses)...)
+	}
+	if *configMapFile != "" {
+		problems = append(problems, validateConfigMapFile(*configMapFile)...)
+	}
+
+	for _, problem := range problems {
+		_, _ = fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("%d configuration problems found", len(problems))
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, "Configuration is valid")
+	return err
+}
+
+// setEnvFromFile replaces collector environment configuration with KEY=VALUE lines of file
+func setEnvFromFile(filePath string) error {
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return errors.Wrap(err, "Failed to read env file")
+	}
+
+	envKeyPrefix := strings.ToUpper(envPrefix) + "_"
+	for _, env := range os.Environ() {
+		if key := strings.SplitN(env, "=", 2)[0]; strings.HasPrefix(key, envKeyPrefix) {
+			_ = os.Unsetenv(key)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		keyValue := strings.SplitN(text, "=", 2)
+		if len(keyValue) != 2 {
+			return errors.Errorf("Line %d of env file is not KEY=VALUE", line)
+		}
+		if err = os.Setenv(strings.TrimSpace(keyValue[0]), strings.Trim(keyValue[1], `"'`)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// unknownEnvKeys returns problems for collector prefixed environment variables not matching any config field
+func unknownEnvKeys() ([]string, error) {
+	var keysBuffer bytes.Buffer
+	if err := envconfig.Usagef(envPrefix, &prefixcollector.Config{}, &keysBuffer, envKeysFormat); err != nil {
+		return nil, err
+	}
+	knownKeys := map[string]bool{}
+	for _, key := range strings.Fields(keysBuffer.String()) {
+		knownKeys[key] = true
+	}
+
+	var problems []string
+	envKeyPrefix := strings.ToUpper(envPrefix) + "_"
+	for _, env := range os.Environ() {
+		key := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(key, envKeyPrefix) && !knownKeys[key] {
+			problems = append(problems, fmt.Sprintf("Unknown environment variable %s", key))
+		}
+	}
+	return problems, nil
+}
+
+// validateConfigMapFile returns problems of user config map YAML file
+func validateConfigMapFile(filePath string) []string {
+	data, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return []string{fmt.Sprintf("Failed to read config map file: %v", err)}
+	}
+
+	configMap := &apiV1.ConfigMap{}
+	if err = yaml.Unmarshal(data, configMap); err != nil {
+		return []string{fmt.Sprintf("Failed to decode config map: %v", err)}
+	}
+
+	var problems []string
+	for key := range configMap.Data {
+		if key != prefixsource.ConfigMapPrefixesKey {
+			problems = append(problems, fmt.Sprintf("Unknown config map key %s", key))
+		}
+	}
+
+	prefixesField, ok := configMap.Data[prefixsource.ConfigMapPrefixesKey]
+	if !ok {
+		return append(problems, fmt.Sprintf("Config map key %s is missing", prefixsource.ConfigMapPrefixesKey))
+	}
+	jsonData, err := yaml.YAMLToJSON([]byte(prefixesField))
+	if err != nil {
+		return append(problems, fmt.Sprintf("Failed to decode %s: %v", prefixsource.ConfigMapPrefixesKey, err))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	destination := struct {
+		Prefixes prefixcollector.PrefixList
+	}{}
+	if err = decoder.Decode(&destination); err != nil {
+		return append(problems, fmt.Sprintf("Failed to decode %s: %v", prefixsource.ConfigMapPrefixesKey, err))
+	}
+	if err = destination.Prefixes.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("Config map %s: %v", prefixsource.ConfigMapPrefixesKey, err))
+	}
+	return problems
+}